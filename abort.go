@@ -0,0 +1,106 @@
+package twunproxy
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// DefaultClientName is the connection name that adapters are encouraged to set with CLIENT SETNAME,
+// such as with redigo's DialClientName, so that AbortAll can find connections made through twunproxy.
+const DefaultClientName = "twunproxy"
+
+// AbortResult records what AbortAll did on one instance.
+type AbortResult struct {
+	Server        string `json:"server"`
+	ScriptKilled  bool   `json:"script_killed"`
+	ClientsKilled int    `json:"clients_killed"`
+	Err           error  `json:"-"`
+}
+
+// AbortAll is an emergency stop for the whole pool. On every instance concurrently it issues SCRIPT KILL,
+// stopping any runaway read-only script, then kills every client connection with the input name,
+// which unblocks a fleet stuck in blocking commands. The connection issuing the kills is spared.
+// Instances with no script running are not treated as failures. Scripts that have written cannot be killed
+// by SCRIPT KILL; that requires SHUTDOWN NOSAVE, which is left to an operator.
+func (r *ProxyConn) AbortAll(clientName string) []AbortResult {
+	t := r.topology()
+	res := make([]AbortResult, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		res[i].Server = t.server(i)
+
+		_, err := c.Do("SCRIPT", "KILL")
+		if err != nil && !strings.HasPrefix(err.Error(), "NOTBUSY") {
+			return err
+		}
+		res[i].ScriptKilled = err == nil
+
+		n, err := killClients(c, clientName)
+		res[i].ClientsKilled = n
+		return err
+	})
+
+	for i, err := range errs {
+		res[i].Err = err
+	}
+	return res
+}
+
+// Kills every client of the instance with the input name other than the input connection,
+// returning the number killed.
+func killClients(c Conn, name string) (int, error) {
+	self, err := c.Do("CLIENT", "ID")
+	if err != nil {
+		return 0, err
+	}
+	selfID, _ := replyInt(self)
+
+	v, err := c.Do("CLIENT", "LIST")
+	if err != nil {
+		return 0, err
+	}
+	clients, err := parseClientList(v)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, cl := range clients {
+		id, err := strconv.ParseInt(cl["id"], 10, 64)
+		if err != nil || id == selfID || cl["name"] != name {
+			continue
+		}
+
+		if _, err := c.Do("CLIENT", "KILL", "ID", id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Parses the reply of CLIENT LIST into the fields of each client, such as "id", "addr" and "name".
+func parseClientList(v interface{}) ([]map[string]string, error) {
+	s, ok := replyString(v)
+	if !ok {
+		return nil, errors.New("Unexpected CLIENT LIST reply type.")
+	}
+
+	var clients []map[string]string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := make(map[string]string)
+		for _, f := range strings.Fields(line) {
+			if i := strings.Index(f, "="); i > 0 {
+				fields[f[:i]] = f[i+1:]
+			}
+		}
+		clients = append(clients, fields)
+	}
+	return clients, nil
+}
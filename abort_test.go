@@ -0,0 +1,36 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestAbortAllKillsScriptsAndNamedClients(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clients := "id=7 addr=10.0.0.9:5000 name=twunproxy cmd=client\n" +
+		"id=8 addr=10.0.0.9:5001 name=twunproxy cmd=blpop\n" +
+		"id=9 addr=10.0.0.8:5000 name=other cmd=blpop\n"
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("SCRIPT", "KILL").Return("OK", nil)
+	mockConn1.EXPECT().Do("CLIENT", "ID").Return(int64(7), nil)
+	mockConn1.EXPECT().Do("CLIENT", "LIST").Return([]byte(clients), nil)
+	mockConn1.EXPECT().Do("CLIENT", "KILL", "ID", int64(8)).Return("OK", nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("SCRIPT", "KILL").Return(nil, errors.New("NOTBUSY No scripts in execution right now."))
+	mockConn2.EXPECT().Do("CLIENT", "ID").Return(int64(1), nil)
+	mockConn2.EXPECT().Do("CLIENT", "LIST").Return([]byte("id=1 addr=10.0.0.9:5000 name= cmd=client\n"), nil)
+	mockConn2.EXPECT().Close()
+
+	res := getMockProxy(mockPool1, mockPool2).AbortAll(DefaultClientName)
+	if res[0].Err != nil || !res[0].ScriptKilled || res[0].ClientsKilled != 1 {
+		t.Fatalf("Unexpected result: %+v", res[0])
+	}
+	if res[1].Err != nil || res[1].ScriptKilled || res[1].ClientsKilled != 0 {
+		t.Fatalf("Unexpected result: %+v", res[1])
+	}
+}
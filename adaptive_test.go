@@ -0,0 +1,58 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestAdaptiveDiscoveryProbesLikelyInstanceAlone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithAdaptiveDiscovery(":", 2)(proxy)
+	proxy.adaptive.record("parsed:soccer:1", "1")
+	proxy.adaptive.record("parsed:soccer:2", "1")
+
+	// Only the second instance is probed.
+	mockConn2.EXPECT().Do("GET", "parsed:soccer:3").Return([]byte("v"), nil)
+	mockConn2.EXPECT().Close()
+
+	canMap := func(v interface{}) bool { return v != nil }
+	if v, err := proxy.Do(NewRedisCmd("GET", "parsed:soccer:3"), canMap); err != nil || v == nil {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+
+	if proxy.KeyInstance["parsed:soccer:3"] != mockPool2 {
+		t.Fatal("Expected key to be mapped to the likely instance.")
+	}
+}
+
+func TestAdaptiveDiscoveryFallsBackToRemainingInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithAdaptiveDiscovery(":", 1)(proxy)
+	proxy.adaptive.record("parsed:soccer:1", "1")
+
+	mockConn2.EXPECT().Do("GET", "parsed:soccer:3").Return(nil, nil)
+	mockConn2.EXPECT().Close()
+	mockConn1.EXPECT().Do("GET", "parsed:soccer:3").Return([]byte("v"), nil)
+	mockConn1.EXPECT().Close()
+
+	canMap := func(v interface{}) bool { return v != nil }
+	if v, err := proxy.Do(NewRedisCmd("GET", "parsed:soccer:3"), canMap); err != nil || v == nil {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+
+	if _, ok := proxy.adaptive.likely("parsed:soccer:4", proxy.topology()); ok {
+		t.Fatal("Expected no majority after contradicting discovery.")
+	}
+}
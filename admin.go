@@ -0,0 +1,220 @@
+package twunproxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// InstanceOptions control commands issued to each instance in turn, such as by PromoteEach and BGSaveEach.
+// Timeout bounds the wait for each instance; zero waits until the context ends.
+// If Continue is true, an instance that fails or times out is recorded and the next instance is tried.
+// Otherwise the first failure stops the run.
+type InstanceOptions struct {
+	Timeout  time.Duration
+	Continue bool
+}
+
+// InstanceResult records the outcome of a command on one instance.
+// Instances not reached because the run stopped early are reported with Issued false and no error.
+// Skipped instances were passed over by the stagger strategy. Name is the name of the instance, as for Instance.
+type InstanceResult struct {
+	Server   string `json:"server"`
+	Name     string `json:"name"`
+	Issued   bool   `json:"issued"`
+	Skipped  bool   `json:"skipped"`
+	TimedOut bool   `json:"timed_out"`
+	Err      error  `json:"-"`
+}
+
+// PromoteEach issues "SLAVEOF NO ONE" to each instance in turn, as for Promote, and reports on every instance.
+// A wedged instance no longer holds up the rest if a timeout is set and Continue is true.
+// The error is that of the context, or of the instance that stopped the run.
+func (r *ProxyConn) PromoteEach(ctx context.Context, opts InstanceOptions) ([]InstanceResult, error) {
+	return r.eachInstance(ctx, opts, Stagger{}, "SLAVEOF", "NO", "ONE")
+}
+
+// BGSaveEach issues BGSAVE to each instance in turn, waiting for the input interval after each,
+// as for BGSave, and reports on every instance. BGSaveStaggered offers other strategies.
+func (r *ProxyConn) BGSaveEach(ctx context.Context, interval time.Duration, opts InstanceOptions) ([]InstanceResult, error) {
+	return r.eachInstance(ctx, opts, Stagger{Interval: interval}, "BGSAVE")
+}
+
+// Issues the input command to the instances in batches, staggered according to the input strategy.
+func (r *ProxyConn) eachInstance(
+	ctx context.Context,
+	opts InstanceOptions,
+	s Stagger,
+	name string,
+	args ...interface{}) ([]InstanceResult, error) {
+
+	t := r.topology()
+	res := make([]InstanceResult, len(t.pools))
+	for i := range res {
+		res[i].Server = t.server(i)
+		res[i].Name = t.instance(i).Name
+	}
+
+	if err := r.guardAdmin(ctx, name); err != nil {
+		return res, err
+	}
+
+	size := s.batchSize(len(t.pools))
+	for start := 0; start < len(t.pools); start += size {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		end := start + size
+		if end > len(t.pools) {
+			end = len(t.pools)
+		}
+
+		wg := new(sync.WaitGroup)
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				r.issue(ctx, opts, s, t.pools[i], &res[i], name, args...)
+			}(i)
+		}
+		wg.Wait()
+
+		for i := start; i < end; i++ {
+			if res[i].Err == nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				return res, ctx.Err()
+			}
+			if !opts.Continue {
+				return res, res[i].Err
+			}
+		}
+
+		if end == len(t.pools) {
+			break
+		}
+		if err := r.staggerWait(ctx, opts, s, t, res, start, end); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// Issues the command to the pool unless the strategy skips it, and records the outcome in the input result.
+func (r *ProxyConn) issue(
+	ctx context.Context,
+	opts InstanceOptions,
+	s Stagger,
+	pool ConnGetter,
+	res *InstanceResult,
+	name string,
+	args ...interface{}) {
+
+	ictx, cancel := ctx, context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		ictx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	defer cancel()
+
+	c := pool.Get()
+	defer c.Close()
+
+	busy, err := s.busy(ictx, c)
+	if err == nil && !busy {
+		_, err = doContext(ictx, c, name, args...)
+		res.Issued = err == nil
+	}
+
+	res.Skipped = busy
+	res.Err = err
+	res.TimedOut = err == context.DeadlineExceeded && ctx.Err() == nil
+}
+
+// Waits between batches: for saves in the batch to complete, if required, then for the fixed interval.
+func (r *ProxyConn) staggerWait(
+	ctx context.Context,
+	opts InstanceOptions,
+	s Stagger,
+	t *topology,
+	res []InstanceResult,
+	start, end int) error {
+
+	if err := r.awaitBatch(ctx, opts, s, t, res, start, end); err != nil {
+		return err
+	}
+
+	if s.Interval > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.Interval):
+		}
+	}
+	return nil
+}
+
+// Waits for saves on the instances of the batch that were issued the command to complete, if required.
+// An instance that does not complete within the completion timeout, or whose save fails, carries the error
+// in its result, and stops the run unless Continue is set.
+func (r *ProxyConn) awaitBatch(
+	ctx context.Context,
+	opts InstanceOptions,
+	s Stagger,
+	t *topology,
+	res []InstanceResult,
+	start, end int) error {
+
+	if !s.WaitForCompletion {
+		return nil
+	}
+
+	for i := start; i < end; i++ {
+		if !res[i].Issued {
+			continue
+		}
+
+		wctx, cancel := ctx, context.CancelFunc(func() {})
+		if s.CompletionTimeout > 0 {
+			wctx, cancel = context.WithTimeout(ctx, s.CompletionTimeout)
+		}
+
+		c := t.pools[i].Get()
+		err := s.awaitCompletion(wctx, c)
+		c.Close()
+		cancel()
+
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		res[i].Err = err
+		res[i].TimedOut = err == context.DeadlineExceeded
+		if !opts.Continue {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs the input command on the connection, returning the context error if the context ends before the reply.
+// The command itself is not cancelled; its reply is discarded when it arrives.
+func doContext(ctx context.Context, c Conn, name string, args ...interface{}) (interface{}, error) {
+	done := make(chan redisReturn, 1)
+	go func() {
+		v, err := c.Do(name, args...)
+		done <- redisReturn{val: v, err: err}
+	}()
+
+	select {
+	case rr := <-done:
+		return rr.val, rr.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,56 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestPromoteEachContinuesPastTimedOutInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conns := make([]*MockConn, 3)
+	pools := make([]ConnGetter, 3)
+	for i := range pools {
+		conns[i], pools[i] = setupMockPool(ctrl)
+		conns[i].EXPECT().Close()
+	}
+	conns[0].EXPECT().Do("SLAVEOF", "NO", "ONE").Return("OK", nil)
+	conns[1].EXPECT().Do("SLAVEOF", "NO", "ONE").DoAndReturn(func(string, ...interface{}) (interface{}, error) {
+		time.Sleep(300 * time.Millisecond)
+		return "OK", nil
+	})
+	conns[2].EXPECT().Do("SLAVEOF", "NO", "ONE").Return("OK", nil)
+
+	proxy := getMockProxy(pools...)
+	res, err := proxy.PromoteEach(context.Background(), InstanceOptions{Timeout: 50 * time.Millisecond, Continue: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !res[0].Issued || res[1].Issued || !res[1].TimedOut || !res[2].Issued {
+		t.Fatalf("Unexpected results: %+v", res)
+	}
+
+	// Allow the abandoned command to complete before the controller checks expectations.
+	time.Sleep(300 * time.Millisecond)
+}
+
+func TestBGSaveEachStopsOnFirstErrorByDefault(t *testing.T) {
+	errTest := errors.New("MISCONF")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	_, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("BGSAVE").Return(nil, errTest)
+	mockConn1.EXPECT().Close()
+
+	res, err := getMockProxy(mockPool1, mockPool2).BGSaveEach(context.Background(), time.Millisecond, InstanceOptions{})
+	if err != errTest || res[0].Err != errTest || res[1].Issued || res[1].Server != "1" {
+		t.Fatalf("Unexpected result: %+v, %v", res, err)
+	}
+}
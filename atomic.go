@@ -0,0 +1,99 @@
+package twunproxy
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// The hash tag delimiters used to decide whether keys are colocated, for proxies not created from a configuration.
+const defaultHashTag = "{}"
+
+// Atomic runs the input commands atomically on the instance holding their keys, by wrapping them in a generated
+// Lua script. This gives transaction-like atomicity for small groups of operations without MULTI/EXEC,
+// which Twemproxy does not support. Each command's reply is returned in order.
+// Every key must share the same hash tag, such as "{user:1}" in "{user:1}:profile" and "{user:1}:sessions",
+// or be identical, so that Twemproxy places them all on the same instance. The hash tag is that of the pool
+// configuration; if the pool has no hash_tag, keys must be identical.
+// As with any script, an error from one command stops the remainder but writes already made are not rolled back.
+func (r *ProxyConn) Atomic(cmds ...*RedisCmd) ([]interface{}, error) {
+	if len(cmds) == 0 {
+		return nil, errors.New("No commands to run.")
+	}
+
+	delims := r.colocationTag()
+	tag := hashTagOf(cmds[0].key, delims)
+	for _, c := range cmds[1:] {
+		if hashTagOf(c.key, delims) != tag {
+			return nil, errors.New("Keys do not share a hash tag: " + cmds[0].key + ", " + c.key + ".")
+		}
+	}
+
+	script, keys, argv := atomicScript(cmds)
+	args := append([]interface{}{script, len(keys)}, keys[1:]...)
+	args = append(args, argv...)
+
+	v, err := r.doKeyed(&RedisCmd{name: "EVAL", key: keys[0].(string), args: args, keyPos: 2}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	res, ok := v.([]interface{})
+	if !ok || len(res) != len(cmds) {
+		return nil, errors.New("Unexpected reply to atomic script.")
+	}
+	return res, nil
+}
+
+// Generates a Lua script running the input commands in order and returning their replies as an array.
+// Keys are passed in KEYS and all other arguments in ARGV, so that the script is the same for the same command shapes.
+func atomicScript(cmds []*RedisCmd) (string, []interface{}, []interface{}) {
+	var b strings.Builder
+	var keys, argv []interface{}
+
+	b.WriteString("local r = {}\n")
+	for i, c := range cmds {
+		b.WriteString("r[" + strconv.Itoa(i+1) + "] = redis.call(" + strconv.Quote(c.name))
+		for j, a := range c.getArgs() {
+			if j == c.keyPos {
+				keys = append(keys, a)
+				b.WriteString(", KEYS[" + strconv.Itoa(len(keys)) + "]")
+			} else {
+				argv = append(argv, a)
+				b.WriteString(", ARGV[" + strconv.Itoa(len(argv)) + "]")
+			}
+		}
+		b.WriteString(")\n")
+	}
+	b.WriteString("return r\n")
+
+	return b.String(), keys, argv
+}
+
+// Returns the hash tag delimiters that decide whether keys are colocated.
+// This is the configured hash_tag, which may be empty, or the default for proxies not created from a configuration.
+func (r *ProxyConn) colocationTag() string {
+	if r.config == nil {
+		return defaultHashTag
+	}
+	return r.topology().hashTag
+}
+
+// Returns the part of the key between the first occurrence of the tag's opening delimiter and the next closing
+// delimiter, as Twemproxy does. The whole key is returned if there is no non-empty tag.
+func hashTagOf(key, tag string) string {
+	if len(tag) != 2 {
+		return key
+	}
+
+	start := strings.IndexByte(key, tag[0])
+	if start < 0 {
+		return key
+	}
+
+	end := strings.IndexByte(key[start+1:], tag[1])
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
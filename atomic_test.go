@@ -0,0 +1,53 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestAtomicWrapsCommandsInScript(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	script := "local r = {}\n" +
+		"r[1] = redis.call(\"SET\", KEYS[1], ARGV[1])\n" +
+		"r[2] = redis.call(\"INCR\", KEYS[2])\n" +
+		"return r\n"
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("EVAL", script, 2, "{u1}:a", "{u1}:b", "v").Return([]interface{}{"OK", int64(1)}, nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["{u1}:a"] = mockPool
+
+	res, err := proxy.Atomic(NewRedisCmd("SET", "{u1}:a", "v"), NewRedisCmd("INCR", "{u1}:b"))
+	if err != nil || len(res) != 2 || res[1] != int64(1) {
+		t.Fatalf("Unexpected result: %v, %v", res, err)
+	}
+}
+
+func TestAtomicRejectsKeysWithoutSharedTag(t *testing.T) {
+	proxy := getMockProxy()
+
+	if _, err := proxy.Atomic(NewRedisCmd("GET", "{u1}:a"), NewRedisCmd("GET", "{u2}:a")); err == nil {
+		t.Fatal("Expected error for keys with different hash tags.")
+	}
+}
+
+func TestHashTagOf(t *testing.T) {
+	cases := map[string]string{
+		"{u1}:a":   "u1",
+		"a{u1}b":   "u1",
+		"{}:a":     "{}:a",
+		"plain":    "plain",
+		"a{open":   "a{open",
+		"{a}{b}:c": "a",
+	}
+
+	for key, want := range cases {
+		if got := hashTagOf(key, "{}"); got != want {
+			t.Errorf("hashTagOf(%q) = %q, expected %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package twunproxy
+
+import (
+	"errors"
+	"sort"
+)
+
+// MappingAudit describes a stale entry in the key-to-pool mapping found by AuditMappings.
+// Exists indicates whether the key exists on its mapped instance.
+// Elsewhere lists the other instances the key was found on, if they were checked.
+type MappingAudit struct {
+	Key       string   `json:"key"`
+	Server    string   `json:"server"`
+	Exists    bool     `json:"exists"`
+	Elsewhere []string `json:"elsewhere"`
+	Repaired  bool     `json:"repaired"`
+}
+
+// AuditMappings verifies that each key in the mapping cache still exists on the instance it is mapped to.
+// If checkElsewhere is set, every other instance is also checked for the key.
+// Stale entries are returned, ordered by key. These are keys missing from their mapped instance,
+// mapped to a pool that is no longer configured, or present on more than one instance.
+// If repair is set, a key missing from its mapped instance is remapped to the instance it was found on,
+// or unmapped if it was found on none or several. Keys present on several instances are only reported.
+// This is useful after failovers, or after restoring instances from a snapshot.
+func (r *ProxyConn) AuditMappings(checkElsewhere, repair bool) ([]MappingAudit, error) {
+	t := r.topology()
+
+	all, ok := r.mappings()
+	if !ok {
+		return nil, errors.New("Key mapper cannot enumerate its mappings.")
+	}
+
+	mapped := make(map[string]int, len(all))
+	for k, p := range all {
+		mapped[k] = t.indexOf(p)
+	}
+
+	keys := make([]string, 0, len(mapped))
+	for k := range mapped {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	found := make([]map[string]bool, len(t.pools))
+	errs := t.forEach(func(i int, c Conn) error {
+		found[i] = make(map[string]bool)
+		for _, k := range keys {
+			if !checkElsewhere && mapped[k] != i {
+				continue
+			}
+
+			v, err := c.Do("EXISTS", k)
+			if err != nil {
+				return err
+			}
+
+			n, _ := replyInt(v)
+			found[i][k] = n > 0
+		}
+		return nil
+	})
+
+	if err := firstError(errs); err != nil {
+		return nil, err
+	}
+
+	var audits []MappingAudit
+	for _, k := range keys {
+		idx := mapped[k]
+		a := MappingAudit{Key: k, Exists: idx >= 0 && found[idx][k], Elsewhere: make([]string, 0)}
+		if idx >= 0 {
+			a.Server = t.server(idx)
+		}
+
+		owner := -1
+		for i := range t.pools {
+			if i != idx && found[i][k] {
+				a.Elsewhere = append(a.Elsewhere, t.server(i))
+				owner = i
+			}
+		}
+
+		if a.Exists && len(a.Elsewhere) == 0 {
+			continue
+		}
+
+		if repair && !a.Exists {
+			if len(a.Elsewhere) == 1 {
+				r.mapKey(k, t.pools[owner])
+			} else {
+				r.unmap(k)
+			}
+			a.Repaired = true
+		}
+
+		audits = append(audits, a)
+	}
+
+	return audits, nil
+}
@@ -0,0 +1,76 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestAuditMappingsReportsAndRepairsStaleEntries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	mockConn1.EXPECT().Do("EXISTS", "good").Return(int64(1), nil)
+	mockConn1.EXPECT().Do("EXISTS", "gone").Return(int64(0), nil)
+	mockConn1.EXPECT().Do("EXISTS", "moved").Return(int64(0), nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("EXISTS", "good").Return(int64(0), nil)
+	mockConn2.EXPECT().Do("EXISTS", "gone").Return(int64(0), nil)
+	mockConn2.EXPECT().Do("EXISTS", "moved").Return(int64(1), nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.KeyInstance["good"] = mockPool1
+	proxy.KeyInstance["gone"] = mockPool1
+	proxy.KeyInstance["moved"] = mockPool1
+
+	audits, err := proxy.AuditMappings(true, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(audits) != 2 || audits[0].Key != "gone" || audits[1].Key != "moved" {
+		t.Fatalf("Unexpected audits: %+v", audits)
+	}
+
+	if !audits[1].Repaired || len(audits[1].Elsewhere) != 1 || audits[1].Elsewhere[0] != "1" {
+		t.Fatalf("Unexpected audit: %+v", audits[1])
+	}
+
+	if _, ok := proxy.KeyInstance["gone"]; ok {
+		t.Fatal("Expected missing key to be unmapped.")
+	}
+
+	if proxy.KeyInstance["moved"] != mockPool2 {
+		t.Fatal("Expected moved key to be remapped.")
+	}
+}
+
+func TestAuditMappingsOnlyChecksMappedInstanceByDefault(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("EXISTS", "KEY").Return(int64(0), nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.KeyInstance["KEY"] = mockPool2
+
+	audits, err := proxy.AuditMappings(false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(audits) != 1 || audits[0].Exists || audits[0].Repaired {
+		t.Fatalf("Unexpected audits: %+v", audits)
+	}
+
+	if _, ok := proxy.KeyInstance["KEY"]; !ok {
+		t.Fatal("Expected mapping to be left alone without repair.")
+	}
+}
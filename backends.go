@@ -0,0 +1,150 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// BackendSource supplies the server descriptors of a pool from somewhere other than the Twemproxy configuration,
+// such as a service registry. Descriptors take the Twemproxy form "host:port:weight name".
+type BackendSource interface {
+	Servers(ctx context.Context) ([]string, error)
+}
+
+// SyncBackends replaces the servers of the pool with those from the input source.
+// Pools for servers that are unchanged are kept, and pools for new servers are created and checked with PING
+// before anything is changed, so on failure the proxy is left as it was. Hashing, distribution, hash tag and auth
+// are taken from the pool configuration. Mappings to removed servers are dropped, to be rediscovered; mappings
+// to the remaining servers are kept, unless the key mapper cannot enumerate them, in which case all are dropped.
+func (r *ProxyConn) SyncBackends(ctx context.Context, src BackendSource) error {
+	if r.create == nil {
+		return errors.New("Proxy was not created from a configuration.")
+	}
+
+	servers, err := src.Servers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return errNoServers
+	}
+
+	conf, err := r.readConfig()
+	if err != nil {
+		return err
+	}
+	conf.Servers = servers
+	return r.replaceServers(conf)
+}
+
+// WatchBackends calls SyncBackends immediately and then at the input interval, keeping the pool in step with
+// the source. An interval that is not positive is taken as DefaultWatchInterval.
+// Errors are passed to onErr, which may be nil. Call the returned function, or Close, to stop watching.
+func (r *ProxyConn) WatchBackends(src BackendSource, interval time.Duration, onErr func(error)) func() {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			if err := r.SyncBackends(ctx, src); err != nil && ctx.Err() == nil && onErr != nil {
+				onErr(err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	return r.onClose(cancel)
+}
+
+// Installs a topology for the servers of the input configuration, reusing the pools of servers that are unchanged.
+// Nothing is changed if the servers, hashing, distribution and hash tag are the same as the current ones.
+// Pools of removed servers are drained.
+func (r *ProxyConn) replaceServers(conf PoolConfig) error {
+	old := r.topology()
+	ring, _ := newHashRing(conf.Servers, conf.Hash, conf.Distribution, conf.HashTag)
+	if equalStrings(old.servers, conf.Servers) && old.hashTag == conf.HashTag && sameHashing(old.ring, ring) {
+		return nil
+	}
+
+	existing := make(map[string]ConnGetter, len(old.servers))
+	for i, desc := range old.servers {
+		if i < len(old.pools) {
+			existing[desc] = old.pools[i]
+		}
+	}
+
+	pools := make([]ConnGetter, len(conf.Servers))
+	for i, desc := range conf.Servers {
+		if p, ok := existing[desc]; ok {
+			pools[i] = p
+			continue
+		}
+
+		p, err := r.createPool(conf, desc)
+		if err == nil {
+			c := p.Get()
+			_, err = c.Do("PING")
+			c.Close()
+		}
+		if err != nil {
+			return err
+		}
+		pools[i] = p
+	}
+
+	t := &topology{pools: pools, servers: conf.Servers, ring: ring, hashTag: conf.HashTag}
+	r.setTopology(t)
+	r.dropRemoved(t)
+	r.drainRemoved(old, t)
+	return nil
+}
+
+// Reports whether the input hash rings use the same hash and distribution. Nil rings are only the same as each other.
+func sameHashing(a, b *hashRing) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.hashName == b.hashName && a.dist == b.dist
+}
+
+// Unmaps keys mapped to pools that are not in the input topology, or every key if mappings cannot be enumerated.
+// The mapper is then pruned of the removed pools.
+func (r *ProxyConn) dropRemoved(t *topology) {
+	defer r.pruneMappings()
+
+	m, ok := r.mappings()
+	if !ok {
+		r.purgeMappings()
+		return
+	}
+
+	for k, p := range m {
+		if t.indexOf(p) < 0 {
+			r.unmap(k)
+		}
+	}
+}
+
+// Reports whether the input slices hold the same strings in the same order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
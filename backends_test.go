@@ -0,0 +1,68 @@
+package twunproxy
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// Supplies a fixed set of server descriptors.
+type staticSource []string
+
+func (s staticSource) Servers(context.Context) ([]string, error) { return s, nil }
+
+func TestSyncBackendsKeepsUnchangedPoolsAndMappings(t *testing.T) {
+	created := make(map[string]int)
+	create := func(desc, auth string) ConnGetter {
+		created[desc]++
+		return connPool{&nilStyleConn{reply: "PONG"}}
+	}
+
+	path := writeConfig(t, "alpha:\n  hash: fnv1a_64\n  distribution: ketama\n  servers:\n   - 10.0.0.1:6379:1 a\n   - 10.0.0.2:6379:1 b\n")
+	defer os.Remove(path)
+
+	proxy, err := NewProxyConn(path, "alpha", 0, create)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	kept, removed := proxy.Pools[0], proxy.Pools[1]
+	proxy.mapKey("KEPT", kept)
+	proxy.mapKey("REMOVED", removed)
+
+	src := staticSource{"10.0.0.1:6379:1 a", "10.0.0.3:6379:1 c"}
+	if err := proxy.SyncBackends(context.Background(), src); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if created["10.0.0.1:6379:1 a"] != 1 || created["10.0.0.3:6379:1 c"] != 1 {
+		t.Fatalf("Expected only the new server to be created, got %v", created)
+	}
+	if proxy.Pools[0] != kept || proxy.topology().server(1) != "10.0.0.3:6379" || proxy.topology().ring == nil {
+		t.Fatalf("Unexpected pools after sync: %v", proxy.Servers)
+	}
+	if _, ok := proxy.Lookup("KEPT"); !ok {
+		t.Fatal("Expected mapping to an unchanged server to be kept")
+	}
+	if _, ok := proxy.Lookup("REMOVED"); ok {
+		t.Fatal("Expected mapping to a removed server to be dropped")
+	}
+}
+
+func TestSyncBackendsRejectsEmptySource(t *testing.T) {
+	proxy := getMockProxy()
+	proxy.create = func(desc, auth string) ConnGetter { return nil }
+
+	if err := proxy.SyncBackends(context.Background(), staticSource{}); err != errNoServers {
+		t.Fatalf("Expected errNoServers, got %v", err)
+	}
+}
+
+func TestWatchBackendsDefaultsNonPositiveInterval(t *testing.T) {
+	proxy := getMockProxy()
+	proxy.create = func(desc, auth string) ConnGetter { return nil }
+
+	stop := proxy.WatchBackends(staticSource{}, 0, nil)
+	time.Sleep(10 * time.Millisecond)
+	stop()
+}
@@ -0,0 +1,97 @@
+package twunproxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultBenchmarkRequests is the number of commands Benchmark issues to each instance, if none is configured.
+const DefaultBenchmarkRequests = 100
+
+// BenchmarkConfig configures Benchmark.
+// Requests is the number of commands issued to each instance, one after another on one connection.
+// Command and Args give the command timed, which is PING if Command is empty.
+type BenchmarkConfig struct {
+	Requests int
+	Command  string
+	Args     []interface{}
+}
+
+// BenchmarkResult holds the round-trip latencies measured on one instance by Benchmark.
+// Percentiles and Min, Avg and Max are over the successful requests, which Samples counts.
+// Errors counts failed requests, and Err is the first of their errors.
+type BenchmarkResult struct {
+	LatencyPercentiles
+	Name   string        `json:"name"`
+	Min    time.Duration `json:"min_ns"`
+	Avg    time.Duration `json:"avg_ns"`
+	Max    time.Duration `json:"max_ns"`
+	Errors int           `json:"errors"`
+	Err    error         `json:"-"`
+}
+
+// Benchmark times the configured command against every instance concurrently and reports the latencies of each,
+// so that slow instances can be found without connecting to each directly. The command is issued to each instance
+// the configured number of times in turn. The error is that of the context, if it ends first.
+func (r *ProxyConn) Benchmark(ctx context.Context, conf BenchmarkConfig) ([]BenchmarkResult, error) {
+	if conf.Requests <= 0 {
+		conf.Requests = DefaultBenchmarkRequests
+	}
+	if conf.Command == "" {
+		conf.Command = "PING"
+	}
+
+	t := r.topology()
+	res := make([]BenchmarkResult, len(t.pools))
+	wg := new(sync.WaitGroup)
+	for i := range t.pools {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res[i] = benchmark(ctx, t.pools[i], conf)
+			res[i].Server = t.server(i)
+			res[i].Name = t.instance(i).Name
+		}(i)
+	}
+	wg.Wait()
+
+	return res, ctx.Err()
+}
+
+// Issues the configured command to the pool the configured number of times and measures each round trip.
+func benchmark(ctx context.Context, pool ConnGetter, conf BenchmarkConfig) BenchmarkResult {
+	c := pool.Get()
+	defer c.Close()
+
+	var res BenchmarkResult
+	samples := make([]time.Duration, 0, conf.Requests)
+	var total time.Duration
+	for n := 0; n < conf.Requests && ctx.Err() == nil; n++ {
+		start := time.Now()
+		_, err := doContext(ctx, c, conf.Command, conf.Args...)
+		d := time.Since(start)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			res.Errors++
+			if res.Err == nil {
+				res.Err = err
+			}
+			continue
+		}
+
+		samples = append(samples, d)
+		total += d
+	}
+
+	res.LatencyPercentiles = percentilesOf("", samples)
+	if len(samples) > 0 {
+		res.Min = samples[0]
+		res.Max = samples[len(samples)-1]
+		res.Avg = total / time.Duration(len(samples))
+	}
+	return res
+}
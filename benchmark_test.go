@@ -0,0 +1,32 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestBenchmarkReportsEachInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("PING").Return("PONG", nil).Times(5)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("PING").Return(nil, errors.New("LOADING")).Times(2)
+	mockConn2.EXPECT().Do("PING").Return("PONG", nil).Times(3)
+	mockConn2.EXPECT().Close()
+
+	res, err := getMockProxy(mockPool1, mockPool2).Benchmark(context.Background(), BenchmarkConfig{Requests: 5})
+	if err != nil || len(res) != 2 {
+		t.Fatalf("Unexpected result: %v, %v", res, err)
+	}
+	if res[0].Server != "0" || res[0].Samples != 5 || res[0].Errors != 0 || res[0].Min > res[0].Avg || res[0].Avg > res[0].Max {
+		t.Fatalf("Unexpected result for first instance: %+v", res[0])
+	}
+	if res[1].Samples != 3 || res[1].Errors != 2 || res[1].Err == nil {
+		t.Fatalf("Unexpected result for second instance: %+v", res[1])
+	}
+}
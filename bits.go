@@ -0,0 +1,79 @@
+package twunproxy
+
+import (
+	"errors"
+	"strings"
+)
+
+/******************************************************
+ * Bit operations, routed to the instance holding the key.
+ * BITFIELD in particular is not supported by Twemproxy.
+ ******************************************************/
+
+// BitField runs BITFIELD with the input subcommands against the instance holding the key.
+// Each element of the result is an int64, or nil where an OVERFLOW FAIL suppressed an operation.
+// Subcommands are passed as they would be to Redis, for example "INCRBY", "u8", 0, 1.
+func (r *ProxyConn) BitField(key string, ops ...interface{}) ([]interface{}, error) {
+	write := false
+	for _, op := range ops {
+		if s, ok := op.(string); ok && (strings.EqualFold(s, "SET") || strings.EqualFold(s, "INCRBY")) {
+			write = true
+		}
+	}
+
+	v, err := r.doKeyed(&RedisCmd{name: "BITFIELD", key: key, args: ops}, write)
+	if err != nil {
+		return nil, err
+	}
+
+	res, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("Unexpected reply to BITFIELD.")
+	}
+	return res, nil
+}
+
+// SetBit sets the bit at the input offset of the string at key, returning the bit's previous value.
+func (r *ProxyConn) SetBit(key string, offset int64, value int) (int, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "SETBIT", key: key, args: []interface{}{offset, value}}, true)
+	return bitReply(v, err)
+}
+
+// GetBit returns the bit at the input offset of the string at key.
+func (r *ProxyConn) GetBit(key string, offset int64) (int, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "GETBIT", key: key, args: []interface{}{offset}}, false)
+	return bitReply(v, err)
+}
+
+// BitCount returns the number of set bits in the string at key.
+// An optional start and end byte range may be given, as for BITCOUNT.
+func (r *ProxyConn) BitCount(key string, byteRange ...int64) (int64, error) {
+	args := make([]interface{}, len(byteRange))
+	for i, b := range byteRange {
+		args[i] = b
+	}
+
+	v, err := r.doKeyed(&RedisCmd{name: "BITCOUNT", key: key, args: args}, false)
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := replyInt(v)
+	if !ok {
+		return 0, errors.New("Unexpected reply to BITCOUNT.")
+	}
+	return n, nil
+}
+
+// Converts an integer reply holding a single bit.
+func bitReply(v interface{}, err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := replyInt(v)
+	if !ok {
+		return 0, errors.New("Unexpected reply for bit.")
+	}
+	return int(n), nil
+}
@@ -0,0 +1,71 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestSetBitOnMissingKeyRunsOnRingOwnerAndMaps(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.ring, _ = newHashRing(proxy.Servers, "fnv1a_32", "modula", "")
+
+	owner, _ := proxy.ring.owner("bits")
+	conns := []*MockConn{mockConn1, mockConn2}
+	pools := []ConnGetter{mockPool1, mockPool2}
+
+	mockConn1.EXPECT().Do("EXISTS", "bits").Return(int64(0), nil)
+	mockConn1.EXPECT().Close().AnyTimes()
+	mockConn2.EXPECT().Do("EXISTS", "bits").Return(int64(0), nil)
+	mockConn2.EXPECT().Close().AnyTimes()
+	conns[owner].EXPECT().Do("SETBIT", "bits", int64(7), 1).Return(int64(0), nil)
+
+	if prev, err := proxy.SetBit("bits", 7, 1); err != nil || prev != 0 {
+		t.Fatalf("Unexpected result: %d, %v", prev, err)
+	}
+
+	if proxy.KeyInstance["bits"] != pools[owner] {
+		t.Fatal("Expected key to be mapped to its ring owner.")
+	}
+}
+
+func TestBitCountDiscoversExistingKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	mockConn1.EXPECT().Do("EXISTS", "bits").Return(int64(0), nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("EXISTS", "bits").Return(int64(1), nil)
+	mockConn2.EXPECT().Do("BITCOUNT", "bits", int64(0), int64(-1)).Return(int64(12), nil)
+	mockConn2.EXPECT().Close().Times(2)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+
+	if n, err := proxy.BitCount("bits", 0, -1); err != nil || n != 12 {
+		t.Fatalf("Unexpected result: %d, %v", n, err)
+	}
+}
+
+func TestBitFieldWriteWithoutPlacementFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("EXISTS", "bits").Return(int64(0), nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+
+	if _, err := proxy.BitField("bits", "INCRBY", "u8", 0, 1); err != errNoPlacement {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"github.com/txodds/twunproxy/reply"
+	"strconv"
+	"time"
+)
+
+/******************************************************
+ * Blocking pops from lists and sorted sets across several keys.
+ * Keys may live on different instances, so the command is split into one per instance holding any of the keys.
+ ******************************************************/
+
+// Returned when a multi-key command is issued without keys.
+var errNoKeys = errors.New("At least one key is required.")
+
+// The reply from one instance to a blocking pop: the key popped from, followed by what was popped.
+type popReturn struct {
+	pool   int
+	server string
+	items  []string
+	ok     bool
+	err    error
+}
+
+// A blocking pop command, with the number of items in its reply and the command restoring what it popped.
+type popKind struct {
+	name    string
+	items   int
+	restore func(items []string) *RedisCmd
+}
+
+// Returns the kind of a blocking list pop, whose values are restored with the named push command.
+func listPop(name, push string) popKind {
+	return popKind{name: name, items: 2, restore: func(items []string) *RedisCmd {
+		return NewRedisCmd(push, items[0], items[1])
+	}}
+}
+
+// Returns the kind of a blocking sorted set pop, whose members are restored with ZADD.
+func zsetPop(name string) popKind {
+	return popKind{name: name, items: 3, restore: func(items []string) *RedisCmd {
+		return NewRedisCmd("ZADD", items[0], items[2], items[1])
+	}}
+}
+
+// Popped is a value popped from a list, with the key of the list and the server of the instance holding it.
+type Popped struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Server string `json:"server"`
+}
+
+// BLPopKeys pops from the first non-empty list among the input keys, blocking for up to the timeout,
+// and returns the key popped from with its value. False is returned if the timeout passed with nothing popped.
+// Mapped keys are popped from their instance. Unmapped keys are popped from their ring owner with hash routing,
+// or else from every instance. A BLPOP is issued concurrently to each instance with the keys it may hold.
+// The first value popped is returned and its key is mapped. If other instances then also pop a value,
+// it is pushed back to the head of its list, so no value is lost, though its position relative to values
+// pushed meanwhile may change.
+func (r *ProxyConn) BLPopKeys(timeout time.Duration, keys ...string) (KeyValue, bool, error) {
+	return r.BLPopKeysContext(context.Background(), timeout, keys...)
+}
+
+// BLPopKeysContext pops as for BLPopKeys, but returns the context error if the context ends first.
+func (r *ProxyConn) BLPopKeysContext(ctx context.Context, timeout time.Duration, keys ...string) (KeyValue, bool, error) {
+	res, err := r.blockingPop(ctx, listPop("BLPOP", "LPUSH"), timeout, keys)
+	if !res.ok {
+		return KeyValue{}, false, err
+	}
+	return KeyValue{Key: res.items[0], Value: res.items[1]}, true, nil
+}
+
+// BLPopFrom pops as for BLPopKeys, but also returns the server of the instance the value was popped from.
+// Consumers of several lists can tell the origin of each value without parsing the raw reply.
+func (r *ProxyConn) BLPopFrom(timeout time.Duration, keys ...string) (Popped, bool, error) {
+	return r.BLPopFromContext(context.Background(), timeout, keys...)
+}
+
+// BLPopFromContext pops as for BLPopFrom, but returns the context error if the context ends first.
+func (r *ProxyConn) BLPopFromContext(ctx context.Context, timeout time.Duration, keys ...string) (Popped, bool, error) {
+	res, err := r.blockingPop(ctx, listPop("BLPOP", "LPUSH"), timeout, keys)
+	if !res.ok {
+		return Popped{}, false, err
+	}
+	return Popped{Key: res.items[0], Value: res.items[1], Server: res.server}, true, nil
+}
+
+// ZPopped is a member popped from a sorted set, with its score, the key of the set and the server of the instance
+// holding it.
+type ZPopped struct {
+	Key    string  `json:"key"`
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+	Server string  `json:"server"`
+}
+
+// BZPopMin pops the member with the lowest score from the first non-empty sorted set among the input keys,
+// blocking for up to the timeout. A timeout of zero blocks until a member is popped. False is returned if the
+// timeout passed with nothing popped. Keys are popped from as for BLPopKeys, and members popped by other
+// instances are restored with ZADD.
+func (r *ProxyConn) BZPopMin(timeout time.Duration, keys ...string) (ZPopped, bool, error) {
+	return r.BZPopMinContext(context.Background(), timeout, keys...)
+}
+
+// BZPopMinContext pops as for BZPopMin, but returns the context error if the context ends first.
+func (r *ProxyConn) BZPopMinContext(ctx context.Context, timeout time.Duration, keys ...string) (ZPopped, bool, error) {
+	return r.zpop(ctx, "BZPOPMIN", timeout, keys)
+}
+
+// BZPopMax pops the member with the highest score, as for BZPopMin.
+func (r *ProxyConn) BZPopMax(timeout time.Duration, keys ...string) (ZPopped, bool, error) {
+	return r.BZPopMaxContext(context.Background(), timeout, keys...)
+}
+
+// BZPopMaxContext pops as for BZPopMax, but returns the context error if the context ends first.
+func (r *ProxyConn) BZPopMaxContext(ctx context.Context, timeout time.Duration, keys ...string) (ZPopped, bool, error) {
+	return r.zpop(ctx, "BZPOPMAX", timeout, keys)
+}
+
+// Runs the named blocking sorted set pop for the keys and decodes the member popped.
+func (r *ProxyConn) zpop(ctx context.Context, name string, timeout time.Duration, keys []string) (ZPopped, bool, error) {
+	res, err := r.blockingPop(ctx, zsetPop(name), timeout, keys)
+	if !res.ok {
+		return ZPopped{}, false, err
+	}
+
+	score, err := strconv.ParseFloat(res.items[2], 64)
+	if err != nil {
+		return ZPopped{}, false, errors.New("Unexpected score in reply to " + name + ".")
+	}
+	return ZPopped{Key: res.items[0], Member: res.items[1], Score: score, Server: res.server}, true, nil
+}
+
+// Issues the blocking pop for the keys to each instance that may hold them and returns the first reply popping any.
+// What other instances pop afterwards is restored. A timeout of zero re-issues the pop in slices until something
+// is popped or the context ends.
+func (r *ProxyConn) blockingPop(ctx context.Context, kind popKind, timeout time.Duration, keys []string) (popReturn, error) {
+	if timeout > 0 {
+		return r.blockingPopOnce(ctx, kind, timeout, keys)
+	}
+
+	for {
+		res, err := r.blockingPopOnce(ctx, kind, blockForeverSlice, keys)
+		if res.ok || err != nil {
+			return res, err
+		}
+		if err := ctx.Err(); err != nil {
+			return popReturn{}, err
+		}
+	}
+}
+
+// Issues the blocking pop for the keys once, blocking for up to the timeout.
+func (r *ProxyConn) blockingPopOnce(ctx context.Context, kind popKind, timeout time.Duration, keys []string) (popReturn, error) {
+	if len(keys) == 0 {
+		return popReturn{}, errNoKeys
+	}
+
+	t := r.topology()
+	if len(t.pools) == 0 {
+		return popReturn{}, errNoPools
+	}
+
+	block, err := r.blockTimeout(ctx, t, timeout)
+	if err != nil {
+		return popReturn{}, err
+	}
+
+	groups := r.groupKeys(t, keys)
+	results := make(chan popReturn, len(groups))
+	for i, ks := range groups {
+		go func(i int, ks []string) {
+			args := make([]interface{}, 0, len(ks))
+			for _, k := range ks[1:] {
+				args = append(args, k)
+			}
+			args = append(args, block)
+
+			c := t.pools[i].Get()
+			defer c.Close()
+			v, err := r.runContext(ctx, c, NewRedisCmd(kind.name, ks[0], args...))
+
+			// Only a reply with the key and everything popped is accepted; a timeout replies nil.
+			res := popReturn{pool: i, server: t.server(i), err: err}
+			if err == nil && v != nil {
+				res.items, res.err = reply.Strings(v, nil)
+				if res.err == nil && len(res.items) != kind.items {
+					res.err = errors.New("Unexpected reply to " + kind.name + ".")
+				}
+				res.ok = res.err == nil
+			}
+			results <- res
+		}(i, ks)
+	}
+
+	var first error
+	for n := 0; n < len(groups); n++ {
+		res := <-results
+		if res.ok {
+			r.mapKey(res.items[0], t.pools[res.pool])
+			go r.restorePops(t, kind, results, len(groups)-n-1)
+			return res, nil
+		}
+		if first == nil {
+			first = res.err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return popReturn{}, err
+	}
+	return popReturn{}, first
+}
+
+// Receives the input number of outstanding pop replies and restores anything they popped.
+func (r *ProxyConn) restorePops(t *topology, kind popKind, results chan popReturn, n int) {
+	for ; n > 0; n-- {
+		res := <-results
+		if !res.ok {
+			continue
+		}
+
+		c := t.pools[res.pool].Get()
+		if _, err := r.run(c, kind.restore(res.items)); err != nil {
+			r.counter("blocking_pop_restore_errors", res.server, 1)
+			r.log().Error("Failed to restore popped items", "server", res.server, "items", len(res.items), "err", err)
+		}
+		c.Close()
+	}
+}
+
+// Groups the input keys by the index of each pool that may hold them, preserving their order.
+func (r *ProxyConn) groupKeys(t *topology, keys []string) map[int][]string {
+	groups := make(map[int][]string)
+	for _, k := range keys {
+		if pool, ok := r.lookup(k); ok {
+			if i := t.indexOf(pool); i >= 0 {
+				groups[i] = append(groups[i], k)
+				continue
+			}
+		}
+
+		if r.hashRouting != nil {
+			if i, ok := t.ring.owner(k); ok {
+				groups[i] = append(groups[i], k)
+				continue
+			}
+		}
+
+		for i := range t.pools {
+			groups[i] = append(groups[i], k)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,130 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestBLPopKeysGroupsKeysByInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("BLPOP", "A", "B", float64(1)).Return(nil, nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("BLPOP", "B", float64(1)).DoAndReturn(func(string, ...interface{}) (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		return []interface{}{[]byte("B"), []byte("VAL")}, nil
+	})
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.KeyInstance["A"] = mockPool1
+
+	kv, ok, err := proxy.BLPopKeys(time.Second, "A", "B")
+	if err != nil || !ok || kv != (KeyValue{Key: "B", Value: "VAL"}) {
+		t.Fatalf("Unexpected result: %+v, %v, %v", kv, ok, err)
+	}
+	if proxy.KeyInstance["B"] != mockPool2 {
+		t.Fatal("Expected popped key to be mapped.")
+	}
+}
+
+func TestBLPopKeysRestoresValuesPoppedByOtherInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("BLPOP", "A", float64(1)).Return([]interface{}{[]byte("A"), []byte("first")}, nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("BLPOP", "A", float64(1)).DoAndReturn(func(string, ...interface{}) (interface{}, error) {
+		time.Sleep(100 * time.Millisecond)
+		return []interface{}{[]byte("A"), []byte("second")}, nil
+	})
+
+	restored := make(chan bool)
+	mockConn2.EXPECT().Do("LPUSH", "A", "second").DoAndReturn(func(string, ...interface{}) (interface{}, error) {
+		close(restored)
+		return int64(1), nil
+	})
+	mockConn2.EXPECT().Close().Times(2)
+
+	kv, ok, err := getMockProxy(mockPool1, mockPool2).BLPopKeys(time.Second, "A")
+	if err != nil || !ok || kv.Value != "first" {
+		t.Fatalf("Unexpected result: %+v, %v, %v", kv, ok, err)
+	}
+
+	select {
+	case <-restored:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the second popped value to be restored.")
+	}
+}
+
+func TestBLPopKeysTimesOut(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("BLPOP", "A", "B", float64(1)).Return(nil, nil)
+	mockConn.EXPECT().Close()
+
+	if _, ok, err := getMockProxy(mockPool).BLPopKeys(time.Second, "A", "B"); ok || err != nil {
+		t.Fatalf("Unexpected result: %v, %v", ok, err)
+	}
+}
+
+func TestBLPopFromReturnsSourceServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("BLPOP", "A", float64(1)).Return([]interface{}{[]byte("A"), []byte("VAL")}, nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("BLPOP", "B", float64(1)).DoAndReturn(func(string, ...interface{}) (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		return nil, nil
+	})
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.KeyInstance["A"] = mockPool1
+	proxy.KeyInstance["B"] = mockPool2
+
+	p, ok, err := proxy.BLPopFrom(time.Second, "A", "B")
+	if err != nil || !ok || p != (Popped{Key: "A", Value: "VAL", Server: "0"}) {
+		t.Fatalf("Unexpected result: %+v, %v, %v", p, ok, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestBZPopMinRestoresMembersPoppedByOtherInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	restored := make(chan bool)
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("BZPOPMIN", "Z", float64(1)).Return([]interface{}{[]byte("Z"), []byte("a"), []byte("1.5")}, nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("BZPOPMIN", "Z", float64(1)).DoAndReturn(func(string, ...interface{}) (interface{}, error) {
+		time.Sleep(10 * time.Millisecond)
+		return []interface{}{[]byte("Z"), []byte("b"), []byte("2")}, nil
+	})
+	mockConn2.EXPECT().Do("ZADD", "Z", "2", "b").DoAndReturn(func(string, ...interface{}) (interface{}, error) {
+		restored <- true
+		return int64(1), nil
+	})
+	mockConn2.EXPECT().Close().Times(2)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	z, ok, err := proxy.BZPopMin(time.Second, "Z")
+	if err != nil || !ok || z != (ZPopped{Key: "Z", Member: "a", Score: 1.5, Server: "0"}) {
+		t.Fatalf("Unexpected result: %v, %v, %v", z, ok, err)
+	}
+	<-restored
+}
@@ -0,0 +1,102 @@
+package twunproxy
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// TimeoutRounding selects how blocking command timeouts are rounded to whole seconds for instances older than
+// Redis 6.0, which reject fractional timeouts. Positive timeouts are never rounded to zero, which blocks forever.
+type TimeoutRounding int
+
+const (
+	// Round sub-second parts up, so that commands never time out early. This is the default.
+	RoundUp TimeoutRounding = iota
+
+	// Round sub-second parts down, so that commands never block longer than requested, but for at least a second.
+	RoundDown
+
+	// Round to the nearest second, but to at least a second.
+	RoundNearest
+)
+
+// WithTimeoutRounding sets how blocking command timeouts are rounded for instances older than Redis 6.0.
+func WithTimeoutRounding(rounding TimeoutRounding) Option {
+	return func(r *ProxyConn) {
+		r.rounding = rounding
+	}
+}
+
+// Returns the timeout argument for a blocking command, clamped so that the command blocks no longer than the context
+// deadline. An orphaned command then never holds a connection after its caller has given up. A timeout of zero,
+// which blocks indefinitely, is clamped in the same way. The context error is returned if the deadline has passed.
+// Whole seconds are sent as they are. Fractional timeouts are sent as such if every instance of the input topology
+// runs Redis 6.0 or later, and are otherwise rounded to whole seconds by the rounding policy. Rounding up may then
+// block beyond the deadline, though the caller still returns at the deadline.
+func (r *ProxyConn) blockTimeout(ctx context.Context, t *topology, timeout time.Duration) (interface{}, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+		if timeout == 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	if timeout%time.Second == 0 || r.fractionalTimeouts(t) {
+		return timeout.Seconds(), nil
+	}
+
+	secs := timeout.Seconds()
+	switch r.rounding {
+	case RoundDown:
+		secs = math.Floor(secs)
+	case RoundNearest:
+		secs = math.Round(secs)
+	default:
+		secs = math.Ceil(secs)
+	}
+	return int64(math.Max(secs, 1)), nil
+}
+
+// Reports whether every instance of the topology accepts fractional timeouts, which Redis 6.0 introduced.
+// Versions are queried once per pool and cached. Instances whose version cannot be determined are assumed not to.
+func (r *ProxyConn) fractionalTimeouts(t *topology) bool {
+	r.mu.Lock()
+	if r.versions == nil {
+		r.versions = make(map[ConnGetter]redisVersion)
+	}
+	var unknown []int
+	for i, p := range t.pools {
+		if _, ok := r.versions[p]; !ok {
+			unknown = append(unknown, i)
+		}
+	}
+	r.mu.Unlock()
+
+	ok := true
+	for _, i := range unknown {
+		c := t.pools[i].Get()
+		v, err := serverVersion(c)
+		c.Close()
+		if err != nil {
+			ok = false
+			continue
+		}
+
+		r.mu.Lock()
+		r.versions[t.pools[i]] = v
+		r.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range t.pools {
+		if v, known := r.versions[p]; known && !v.atLeast(6, 0) {
+			ok = false
+		}
+	}
+	return ok
+}
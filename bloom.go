@@ -0,0 +1,108 @@
+package twunproxy
+
+import (
+	"errors"
+	"sort"
+)
+
+/******************************************************
+ * RedisBloom filter commands, routed to the instance holding the filter.
+ ******************************************************/
+
+// BFReserve creates an empty Bloom filter at key with the input false-positive rate and capacity.
+// The filter is created on the instance that the key is mapped to or that the hash ring places it on.
+// If broadcast is set, it is instead created on every instance, which suits pools without a usable ring
+// where the filter's eventual instance is not yet known; the key is then left unmapped.
+func (r *ProxyConn) BFReserve(key string, errorRate float64, capacity int64, broadcast bool) error {
+	args := []interface{}{errorRate, capacity}
+	if !broadcast {
+		_, err := r.doKeyed(&RedisCmd{name: "BF.RESERVE", key: key, args: args}, true)
+		return err
+	}
+
+	errs := r.topology().forEach(func(_ int, c Conn) error {
+		_, err := c.Do("BF.RESERVE", append([]interface{}{key}, args...)...)
+		return err
+	})
+	return firstError(errs)
+}
+
+// BFAdd adds the input item to the Bloom filter at key, creating the filter with default settings if needed.
+// True is returned if the item was not already present.
+func (r *ProxyConn) BFAdd(key, item string) (bool, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "BF.ADD", key: key, args: []interface{}{item}}, true)
+	n, err := intReply("BF.ADD", v, err)
+	return n == 1, err
+}
+
+// BFExists reports whether the input item may be in the Bloom filter at key.
+func (r *ProxyConn) BFExists(key, item string) (bool, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "BF.EXISTS", key: key, args: []interface{}{item}}, false)
+	n, err := intReply("BF.EXISTS", v, err)
+	return n == 1, err
+}
+
+// BFMAdd adds the input items to the Bloom filter at key, reporting for each whether it was newly added.
+func (r *ProxyConn) BFMAdd(key string, items ...string) ([]bool, error) {
+	args := make([]interface{}, len(items))
+	for i, item := range items {
+		args[i] = item
+	}
+
+	v, err := r.doKeyed(&RedisCmd{name: "BF.MADD", key: key, args: args}, true)
+	return boolsReply("BF.MADD", v, err)
+}
+
+// BFAddBatch adds items to several Bloom filters at once, atomically, reporting for each item whether it was
+// newly added. The filter keys must share a hash tag so that they are colocated on one instance; see Atomic.
+func (r *ProxyConn) BFAddBatch(batch map[string][]string) (map[string][]bool, error) {
+	keys := make([]string, 0, len(batch))
+	for k := range batch {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	cmds := make([]*RedisCmd, len(keys))
+	for i, k := range keys {
+		args := make([]interface{}, len(batch[k]))
+		for j, item := range batch[k] {
+			args[j] = item
+		}
+		cmds[i] = NewRedisCmd("BF.MADD", k, args...)
+	}
+
+	replies, err := r.Atomic(cmds...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string][]bool, len(keys))
+	for i, k := range keys {
+		if res[k], err = boolsReply("BF.MADD", replies[i], nil); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Converts an array reply of integer flags from the named command.
+func boolsReply(name string, v interface{}, err error) ([]bool, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("Unexpected reply to " + name + ".")
+	}
+
+	res := make([]bool, len(items))
+	for i, item := range items {
+		n, ok := replyInt(item)
+		if !ok {
+			return nil, errors.New("Unexpected reply to " + name + ".")
+		}
+		res[i] = n == 1
+	}
+	return res, nil
+}
@@ -0,0 +1,53 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestBFAddAndExists(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("BF.ADD", "seen", "a").Return(int64(1), nil)
+	mockConn.EXPECT().Do("BF.EXISTS", "seen", "b").Return(int64(0), nil)
+	mockConn.EXPECT().Close().Times(2)
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["seen"] = mockPool
+
+	if added, err := proxy.BFAdd("seen", "a"); err != nil || !added {
+		t.Fatalf("Unexpected result: %v, %v", added, err)
+	}
+	if exists, err := proxy.BFExists("seen", "b"); err != nil || exists {
+		t.Fatalf("Unexpected result: %v, %v", exists, err)
+	}
+}
+
+func TestBFReserveBroadcast(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	for _, c := range []*MockConn{mockConn1, mockConn2} {
+		c.EXPECT().Do("BF.RESERVE", "seen", 0.01, int64(1000)).Return("OK", nil)
+		c.EXPECT().Close()
+	}
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+
+	if err := proxy.BFReserve("seen", 0.01, 1000, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestBFAddBatchRejectsUncolocatedKeys(t *testing.T) {
+	proxy := getMockProxy()
+
+	_, err := proxy.BFAddBatch(map[string][]string{"{a}:f": {"x"}, "{b}:f": {"y"}})
+	if err == nil {
+		t.Fatal("Expected error for keys without a shared hash tag.")
+	}
+}
@@ -0,0 +1,264 @@
+package twunproxy
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/******************************************************
+ * Circuit breakers around connection pools.
+ * Repeated connection failures open the circuit, so that commands fail fast rather than each
+ * borrowing a connection and waiting on an instance that is down.
+ ******************************************************/
+
+// Defaults for BreakerConfig.
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCoolDown  = 10 * time.Second
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState string
+
+const (
+	// BreakerClosed lets commands through.
+	BreakerClosed BreakerState = "closed"
+
+	// BreakerOpen fails commands without running them until the cool-down passes.
+	BreakerOpen BreakerState = "open"
+
+	// BreakerHalfOpen lets a single command through to test the instance. Its outcome closes or reopens the circuit.
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerConfig configures circuit breakers. The circuit opens after Threshold consecutive connection failures
+// and stays open for CoolDown. Error replies from Redis are not failures. Zero values take the defaults.
+// OnStateChange, if not nil, is called with the server address whenever a breaker changes state.
+type BreakerConfig struct {
+	Threshold     int
+	CoolDown      time.Duration
+	OnStateChange func(server string, state BreakerState)
+}
+
+// BreakerOpenError is returned for commands on a pool whose circuit is open.
+type BreakerOpenError struct {
+	Server  string
+	RetryAt time.Time
+}
+
+func (e *BreakerOpenError) Error() string {
+	return fmt.Sprintf("Circuit for %s is open until %s.", e.Server, e.RetryAt.Format(time.RFC3339))
+}
+
+// Is reports whether the target is ErrPoolUnavailable.
+func (e *BreakerOpenError) Is(target error) bool {
+	return target == ErrPoolUnavailable
+}
+
+// BreakerStatus is the state of the circuit breaker of one pool.
+type BreakerStatus struct {
+	Server   string       `json:"server"`
+	State    BreakerState `json:"state"`
+	Failures int          `json:"failures"`
+	OpenedAt time.Time    `json:"opened_at,omitempty"`
+}
+
+// Breaker is a ConnGetter wrapping a pool in a circuit breaker.
+// While the circuit is open, Get returns a connection that fails every command without borrowing from the pool.
+type Breaker struct {
+	pool   ConnGetter
+	server string
+	conf   BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+// NewBreaker wraps the input pool for the server with the input address in a circuit breaker.
+func NewBreaker(pool ConnGetter, server string, conf BreakerConfig) *Breaker {
+	if conf.Threshold <= 0 {
+		conf.Threshold = DefaultBreakerThreshold
+	}
+	if conf.CoolDown <= 0 {
+		conf.CoolDown = DefaultBreakerCoolDown
+	}
+	return &Breaker{pool: pool, server: server, conf: conf, state: BreakerClosed}
+}
+
+// WithBreakers wraps the input CreatePool so that every pool it creates has a circuit breaker.
+// Pass the result to NewProxyConn, and read the state of the breakers with ProxyConn.Breakers.
+func WithBreakers(create CreatePool, conf BreakerConfig) CreatePool {
+	return func(desc string, auth string) ConnGetter {
+		return NewBreaker(create(desc, auth), ServerAddr(desc), conf)
+	}
+}
+
+// Get returns a connection from the pool, or a failing connection if the circuit is open.
+// Once the cool-down passes, a single connection is returned to test the instance.
+func (b *Breaker) Get() Conn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		retryAt := b.openedAt.Add(b.conf.CoolDown)
+		if time.Now().Before(retryAt) {
+			return openConn{&BreakerOpenError{Server: b.server, RetryAt: retryAt}}
+		}
+		b.setState(BreakerHalfOpen)
+		return &breakerConn{Conn: b.pool.Get(), breaker: b}
+	case BreakerHalfOpen:
+		// A test is already in flight.
+		return openConn{&BreakerOpenError{Server: b.server, RetryAt: time.Now().Add(b.conf.CoolDown)}}
+	}
+	return &breakerConn{Conn: b.pool.Get(), breaker: b}
+}
+
+// Close closes the wrapped pool, if it implements PoolCloser.
+func (b *Breaker) Close() error {
+	if c, ok := b.pool.(PoolCloser); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// SelectDB selects the database of the wrapped pool, which must implement DBSelector.
+func (b *Breaker) SelectDB(db int) error {
+	s, ok := b.pool.(DBSelector)
+	if !ok {
+		return errCannotSelectDB(b.server, db)
+	}
+	return s.SelectDB(db)
+}
+
+// Status returns the state of the breaker.
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerStatus{Server: b.server, State: b.state, Failures: b.failures}
+	if b.state != BreakerClosed {
+		s.OpenedAt = b.openedAt
+	}
+	return s
+}
+
+// Records the outcome of a command, opening or closing the circuit as needed.
+// A test connection that ran no command, or whose command was aborted, leaves the circuit half open for the next.
+func (b *Breaker) record(err error, ran bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case !ran:
+		if b.state == BreakerHalfOpen {
+			b.setState(BreakerOpen)
+			b.openedAt = time.Now().Add(-b.conf.CoolDown)
+		}
+	case !isUnavailable(err):
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.setState(BreakerClosed)
+		}
+	case b.state == BreakerHalfOpen:
+		b.failures++
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	default:
+		b.failures++
+		if b.state == BreakerClosed && b.failures >= b.conf.Threshold {
+			b.openedAt = time.Now()
+			b.setState(BreakerOpen)
+		}
+	}
+}
+
+// Changes the state of the breaker and notifies any listener. The mutex must be held.
+func (b *Breaker) setState(s BreakerState) {
+	if s == b.state {
+		return
+	}
+	b.state = s
+	if b.conf.OnStateChange != nil {
+		b.conf.OnStateChange(b.server, s)
+	}
+}
+
+// Breakers returns the state of the circuit breaker of every pool that has one, in pool order.
+func (r *ProxyConn) Breakers() []BreakerStatus {
+	var res []BreakerStatus
+	for _, pool := range r.topology().pools {
+		if b, ok := pool.(*Breaker); ok {
+			res = append(res, b.Status())
+		}
+	}
+	return res
+}
+
+// A connection from a pool with a circuit breaker, which records the outcome of each command.
+type breakerConn struct {
+	Conn
+	breaker *Breaker
+	ran     bool
+	aborted int32
+}
+
+func (c *breakerConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	v, err := c.Conn.Do(commandName, args...)
+	c.ran = true
+	c.breaker.record(err, atomic.LoadInt32(&c.aborted) == 0)
+	return v, err
+}
+
+// DoWithTimeout applies the timeout if the wrapped connection supports it, so that command timeouts still apply.
+func (c *breakerConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	tc, ok := c.Conn.(TimeoutConn)
+	if !ok {
+		return c.Do(commandName, args...)
+	}
+	v, err := tc.DoWithTimeout(timeout, commandName, args...)
+	c.ran = true
+	c.breaker.record(err, atomic.LoadInt32(&c.aborted) == 0)
+	return v, err
+}
+
+// Abort interrupts the command in progress if the wrapped connection supports it.
+// The error of an aborted command is not counted as a failure of the instance.
+func (c *breakerConn) Abort() error {
+	ac, ok := c.Conn.(AbortableConn)
+	if !ok {
+		return errNotAbortable
+	}
+	atomic.StoreInt32(&c.aborted, 1)
+	return ac.Abort()
+}
+
+// IsNilReply defers to the wrapped connection, so that its nil replies are still recognised.
+func (c *breakerConn) IsNilReply(err error) bool {
+	nr, ok := c.Conn.(NilReplier)
+	return ok && nr.IsNilReply(err)
+}
+
+func (c *breakerConn) Close() error {
+	if !c.ran {
+		c.breaker.record(nil, false)
+	}
+	return c.Conn.Close()
+}
+
+// A connection that fails every command because its circuit is open.
+type openConn struct {
+	err error
+}
+
+func (c openConn) Do(string, ...interface{}) (interface{}, error) {
+	return nil, c.err
+}
+
+func (c openConn) Close() error {
+	return nil
+}
@@ -0,0 +1,91 @@
+package twunproxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterThresholdAndFailsFast(t *testing.T) {
+	flaky := &flakyConn{down: true}
+	states := make(chan BreakerState, 4)
+	b := NewBreaker(connPool{flaky}, "a:6379", BreakerConfig{
+		Threshold:     2,
+		CoolDown:      50 * time.Millisecond,
+		OnStateChange: func(server string, s BreakerState) { states <- s },
+	})
+
+	for i := 0; i < 2; i++ {
+		c := b.Get()
+		c.Do("PING")
+		c.Close()
+	}
+	if s := <-states; s != BreakerOpen {
+		t.Fatalf("Expected the circuit to open, got %s", s)
+	}
+
+	calls := flaky.set(false)
+	c := b.Get()
+	_, err := c.Do("PING")
+	c.Close()
+
+	var open *BreakerOpenError
+	if !errors.As(err, &open) || open.Server != "a:6379" {
+		t.Fatalf("Expected a BreakerOpenError, got %v", err)
+	}
+	if flaky.set(false) != calls {
+		t.Fatal("Expected no command to reach the instance while the circuit is open.")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	c = b.Get()
+	if _, err := b.Get().Do("PING"); err == nil {
+		t.Fatal("Expected only one test command while half open.")
+	}
+	if _, err := c.Do("PING"); err != nil {
+		t.Fatalf("Expected the test command to succeed, got %v", err)
+	}
+	c.Close()
+
+	if s := <-states; s != BreakerHalfOpen {
+		t.Fatalf("Expected the circuit to half open, got %s", s)
+	}
+	if s := <-states; s != BreakerClosed {
+		t.Fatalf("Expected the circuit to close, got %s", s)
+	}
+	if st := b.Status(); st.State != BreakerClosed || st.Failures != 0 {
+		t.Fatalf("Unexpected status %+v", st)
+	}
+}
+
+func TestBreakerReopensWhenTestFails(t *testing.T) {
+	flaky := &flakyConn{down: true}
+	b := NewBreaker(connPool{flaky}, "a:6379", BreakerConfig{Threshold: 1, CoolDown: 20 * time.Millisecond})
+
+	b.Get().Do("PING")
+	time.Sleep(30 * time.Millisecond)
+	b.Get().Do("PING")
+
+	if st := b.Status(); st.State != BreakerOpen || st.Failures != 2 {
+		t.Fatalf("Expected the circuit to reopen, got %+v", st)
+	}
+}
+
+func TestBreakerIgnoresErrorReplies(t *testing.T) {
+	b := NewBreaker(connPool{&nilStyleConn{err: errors.New("WRONGTYPE")}}, "a:6379", BreakerConfig{Threshold: 1})
+	b.Get().Do("GET", "KEY")
+
+	if st := b.Status(); st.State != BreakerClosed {
+		t.Fatalf("Expected error replies to leave the circuit closed, got %+v", st)
+	}
+}
+
+func TestBreakersReportsWrappedPools(t *testing.T) {
+	b := NewBreaker(connPool{&flakyConn{}}, "a:6379", BreakerConfig{})
+	proxy := getMockProxy(b, connPool{&nilStyleConn{}})
+
+	st := proxy.Breakers()
+	if len(st) != 1 || st[0].Server != "a:6379" || st[0].State != BreakerClosed {
+		t.Fatalf("Unexpected breaker status %+v", st)
+	}
+}
@@ -0,0 +1,75 @@
+package twunproxy
+
+import (
+	"context"
+)
+
+// PoolResult is the reply of one instance to a command broadcast by DoAll or DoStream.
+type PoolResult struct {
+	Server string      `json:"server"`
+	Reply  interface{} `json:"reply"`
+	Err    error       `json:"-"`
+}
+
+// DoAll runs the input command on every instance concurrently and returns the reply of each, in pool order.
+// Commands without a key are created with NewCommand. Instances that fail carry their error,
+// and the first error is returned with the results, or a PartialError if partial results are enabled.
+// Nothing is mapped, whatever the replies.
+func (r *ProxyConn) DoAll(cmd *RedisCmd) ([]PoolResult, error) {
+	return r.DoAllContext(context.Background(), cmd)
+}
+
+// DoAllContext runs the command as for DoAll, but instances that have not replied when the context ends
+// carry the context error.
+func (r *ProxyConn) DoAllContext(ctx context.Context, cmd *RedisCmd) ([]PoolResult, error) {
+	t := r.topology()
+	res := make([]PoolResult, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := r.broadcast(ctx, t, i, c, cmd)
+		res[i].Reply = v
+		return err
+	})
+
+	for i, err := range errs {
+		res[i].Server = t.server(i)
+		res[i].Err = err
+	}
+	return res, r.fanOutError(t, errs)
+}
+
+// DoStream runs the input command on every instance concurrently, as for DoAll, but sends the reply of each
+// instance on the returned channel as it arrives, so that callers aggregating replies from many instances can start
+// on the first without waiting for the slowest. The channel receives one result per instance, in no particular
+// order, and is closed once every instance has replied. It is buffered for every result, so callers may stop
+// receiving early without blocking the instances still to reply.
+func (r *ProxyConn) DoStream(cmd *RedisCmd) <-chan PoolResult {
+	return r.DoStreamContext(context.Background(), cmd)
+}
+
+// DoStreamContext streams replies as for DoStream, but instances that have not replied when the context ends
+// send the context error. Cancel the context to stop waiting for the remaining instances once enough have replied.
+func (r *ProxyConn) DoStreamContext(ctx context.Context, cmd *RedisCmd) <-chan PoolResult {
+	t := r.topology()
+	res := make(chan PoolResult, len(t.pools))
+
+	go func() {
+		t.forEach(func(i int, c Conn) error {
+			v, err := r.broadcast(ctx, t, i, c, cmd)
+			res <- PoolResult{Server: t.server(i), Reply: v, Err: err}
+			return err
+		})
+		close(res)
+	}()
+	return res
+}
+
+// Runs the broadcast command on the connection to the instance at the input index, once its rate limit allows.
+func (r *ProxyConn) broadcast(ctx context.Context, t *topology, i int, c Conn, cmd *RedisCmd) (interface{}, error) {
+	if !r.waitRate(ctx, t.server(i), nil) {
+		return nil, ctx.Err()
+	}
+	return r.intercept(ctx, t.server(i), false, cmd, func() (interface{}, error) {
+		return r.runContext(ctx, c, cmd)
+	})
+}
@@ -0,0 +1,75 @@
+package twunproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDoAllReturnsEveryInstanceReply(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: []byte("OK")}}, connPool{&nilStyleConn{err: errors.New("ERR busy")}})
+
+	res, err := proxy.DoAll(NewCommand("BGSAVE"))
+	if err == nil || err.Error() != "ERR busy" {
+		t.Fatalf("Expected the failing instance's error, got %v", err)
+	}
+	if len(res) != 2 || res[0].Server != "0" || res[1].Server != "1" || res[1].Err == nil {
+		t.Fatalf("Unexpected results %+v", res)
+	}
+
+	b, err := json.Marshal(res[0])
+	if err != nil || string(b) != `{"server":"0","reply":"OK"}` {
+		t.Fatalf("Unexpected JSON %s, %v", b, err)
+	}
+}
+
+func TestNewCommandSendsNoKey(t *testing.T) {
+	if args := NewCommand("INFO", "memory").getArgs(); len(args) != 1 || args[0] != "memory" {
+		t.Fatalf("Expected only the arguments, got %v", args)
+	}
+}
+
+func TestDoStreamSendsRepliesAsTheyArrive(t *testing.T) {
+	proxy := getMockProxy(
+		connPool{slowConn{reply: []byte("slow"), delay: 200 * time.Millisecond, calls: new(int32)}},
+		connPool{&nilStyleConn{reply: []byte("fast")}})
+
+	start := time.Now()
+	res := proxy.DoStream(NewCommand("INFO"))
+
+	first := <-res
+	if first.Server != "1" || string(first.Reply.([]byte)) != "fast" || time.Since(start) > 100*time.Millisecond {
+		t.Fatalf("Expected the fast reply first, got %+v after %v", first, time.Since(start))
+	}
+	if second := <-res; second.Server != "0" || second.Err != nil {
+		t.Fatalf("Unexpected second result %+v", second)
+	}
+	if _, ok := <-res; ok {
+		t.Fatal("Expected the channel to be closed once every instance replied.")
+	}
+}
+
+func TestDoStreamContextEndsWaitForRemainingInstances(t *testing.T) {
+	proxy := getMockProxy(
+		connPool{slowConn{reply: []byte("slow"), delay: time.Second, calls: new(int32)}},
+		connPool{&nilStyleConn{reply: []byte("fast")}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res := proxy.DoStreamContext(ctx, NewCommand("SLOWLOG", "GET"))
+
+	if first := <-res; first.Err != nil {
+		t.Fatalf("Unexpected error: %v", first.Err)
+	}
+	cancel()
+
+	select {
+	case second := <-res:
+		if second.Err != context.Canceled {
+			t.Fatalf("Expected the context error, got %+v", second)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Expected the remaining instance to stop waiting once the context ended.")
+	}
+}
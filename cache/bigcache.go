@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"encoding/binary"
+	"github.com/allegro/bigcache/v3"
+	"github.com/txodds/twunproxy"
+	"sync"
+)
+
+// BigCache is a twunproxy.KeyMapper backed by a bigcache cache, which holds mappings off the garbage-collected heap.
+// Pools are stored as small integer references into a registry of the pools in use, so entries cost a few bytes
+// each. The registry is pruned of pools removed from the proxy, and references are never reused, so entries
+// left referring to a removed pool are treated as unmapped rather than resolving to another pool.
+type BigCache struct {
+	c *bigcache.BigCache
+
+	mu    sync.RWMutex
+	next  uint32
+	pools map[uint32]twunproxy.ConnGetter
+	refs  map[twunproxy.ConnGetter]uint32
+}
+
+// NewBigCache returns a KeyMapper storing mappings in the input cache.
+func NewBigCache(c *bigcache.BigCache) *BigCache {
+	return &BigCache{
+		c:     c,
+		pools: make(map[uint32]twunproxy.ConnGetter),
+		refs:  make(map[twunproxy.ConnGetter]uint32),
+	}
+}
+
+// Lookup returns the pool mapped to the input key.
+func (b *BigCache) Lookup(key string) (twunproxy.ConnGetter, bool) {
+	v, err := b.c.Get(key)
+	if err != nil || len(v) != 4 {
+		return nil, false
+	}
+	return b.pool(binary.LittleEndian.Uint32(v))
+}
+
+// Map maps the input key to the pool.
+func (b *BigCache) Map(key string, pool twunproxy.ConnGetter) {
+	v := make([]byte, 4)
+	binary.LittleEndian.PutUint32(v, b.ref(pool))
+	b.c.Set(key, v)
+}
+
+// Unmap removes any mapping for the input key.
+func (b *BigCache) Unmap(key string) {
+	b.c.Delete(key)
+}
+
+// Purge removes every mapping.
+func (b *BigCache) Purge() {
+	b.c.Reset()
+}
+
+// Range calls fn for each mapping until it returns false.
+func (b *BigCache) Range(fn func(key string, pool twunproxy.ConnGetter) bool) {
+	it := b.c.Iterator()
+	for it.SetNext() {
+		e, err := it.Value()
+		if err != nil || len(e.Value()) != 4 {
+			continue
+		}
+
+		if pool, ok := b.pool(binary.LittleEndian.Uint32(e.Value())); ok && !fn(e.Key(), pool) {
+			return
+		}
+	}
+}
+
+// Prune releases the references to pools other than the input ones.
+func (b *BigCache) Prune(pools []twunproxy.ConnGetter) {
+	live := make(map[twunproxy.ConnGetter]bool, len(pools))
+	for _, p := range pools {
+		live[p] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for p, ref := range b.refs {
+		if !live[p] {
+			delete(b.refs, p)
+			delete(b.pools, ref)
+		}
+	}
+}
+
+// Returns the reference for the input pool, registering it if it has not been seen.
+func (b *BigCache) ref(pool twunproxy.ConnGetter) uint32 {
+	b.mu.RLock()
+	ref, ok := b.refs[pool]
+	b.mu.RUnlock()
+	if ok {
+		return ref
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ref, ok := b.refs[pool]; ok {
+		return ref
+	}
+
+	ref = b.next
+	b.next++
+	b.pools[ref] = pool
+	b.refs[pool] = ref
+	return ref
+}
+
+// Returns the pool for the input reference.
+func (b *BigCache) pool(ref uint32) (twunproxy.ConnGetter, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	pool, ok := b.pools[ref]
+	return pool, ok
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"github.com/allegro/bigcache/v3"
+	"github.com/dgraph-io/ristretto"
+	"github.com/txodds/twunproxy"
+	"testing"
+	"time"
+)
+
+// A pool that is never used to get connections, only compared.
+type pool struct {
+	name string
+}
+
+func (p *pool) Get() twunproxy.Conn {
+	return nil
+}
+
+func TestRistrettoMapsAndUnmaps(t *testing.T) {
+	c, err := ristretto.NewCache(&ristretto.Config{NumCounters: 100, MaxCost: 10, BufferItems: 64, IgnoreInternalCost: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	p := &pool{"a"}
+	m := NewRistretto(c)
+	m.Map("KEY", p)
+	c.Wait()
+
+	if got, ok := m.Lookup("KEY"); !ok || got != p {
+		t.Fatalf("Unexpected lookup: %v, %v", got, ok)
+	}
+
+	m.Unmap("KEY")
+	if _, ok := m.Lookup("KEY"); ok {
+		t.Fatal("Expected key to be unmapped.")
+	}
+}
+
+func TestBigCacheMapsRangesAndPurges(t *testing.T) {
+	c, err := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	p1, p2 := &pool{"a"}, &pool{"b"}
+	m := NewBigCache(c)
+	m.Map("k1", p1)
+	m.Map("k2", p2)
+	m.Map("k3", p1)
+
+	if got, ok := m.Lookup("k2"); !ok || got != p2 {
+		t.Fatalf("Unexpected lookup: %v, %v", got, ok)
+	}
+
+	seen := make(map[string]twunproxy.ConnGetter)
+	m.Range(func(k string, p twunproxy.ConnGetter) bool {
+		seen[k] = p
+		return true
+	})
+	if len(seen) != 3 || seen["k3"] != p1 {
+		t.Fatalf("Unexpected mappings: %v", seen)
+	}
+
+	m.Purge()
+	if _, ok := m.Lookup("k1"); ok {
+		t.Fatal("Expected mappings to be purged.")
+	}
+}
+
+func TestBigCachePrunesRemovedPools(t *testing.T) {
+	c, err := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	p1, p2 := &pool{"a"}, &pool{"b"}
+	m := NewBigCache(c)
+	m.Map("k1", p1)
+	m.Map("k2", p2)
+
+	m.Prune([]twunproxy.ConnGetter{p2})
+	if _, ok := m.Lookup("k1"); ok {
+		t.Fatal("Expected the entry of a pruned pool to be unmapped.")
+	}
+	if got, ok := m.Lookup("k2"); !ok || got != p2 {
+		t.Fatalf("Unexpected lookup: %v, %v", got, ok)
+	}
+
+	// A stale reference does not resolve to a pool registered later.
+	p3 := &pool{"c"}
+	m.Map("k3", p3)
+	if _, ok := m.Lookup("k1"); ok {
+		t.Fatal("Expected the pruned reference not to be reused.")
+	}
+	if len(m.refs) != 2 || len(m.pools) != 2 {
+		t.Fatalf("Expected two registered pools, got %d", len(m.pools))
+	}
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"github.com/dgraph-io/ristretto"
+	"github.com/txodds/twunproxy"
+)
+
+// Ristretto is a twunproxy.KeyMapper backed by a ristretto cache, which bounds the number of mappings held
+// and admits and evicts them by access frequency. Each mapping has a cost of 1, so the cache's MaxCost is the
+// maximum number of mappings provided the cache is configured with IgnoreInternalCost.
+// Writes are buffered by ristretto, so a mapping may not be visible immediately.
+type Ristretto struct {
+	c *ristretto.Cache
+}
+
+// NewRistretto returns a KeyMapper storing mappings in the input cache.
+func NewRistretto(c *ristretto.Cache) *Ristretto {
+	return &Ristretto{c: c}
+}
+
+// Lookup returns the pool mapped to the input key.
+func (r *Ristretto) Lookup(key string) (twunproxy.ConnGetter, bool) {
+	v, ok := r.c.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	pool, ok := v.(twunproxy.ConnGetter)
+	return pool, ok
+}
+
+// Map maps the input key to the pool.
+func (r *Ristretto) Map(key string, pool twunproxy.ConnGetter) {
+	r.c.Set(key, pool, 1)
+}
+
+// Unmap removes any mapping for the input key.
+func (r *Ristretto) Unmap(key string) {
+	r.c.Del(key)
+}
+
+// Purge removes every mapping.
+func (r *Ristretto) Purge() {
+	r.c.Clear()
+}
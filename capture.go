@@ -0,0 +1,84 @@
+package twunproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WireCapture records the full request and reply of a sampled fraction of commands to a writer.
+// Each captured command is written as a single line of JSON.
+// Arguments and replies are rendered as text and truncated to MaxBytes.
+// Arguments and replies are redacted by the proxy before capture, so credentials and values matched by its Redactor are masked. This is intended for debugging reply-decoding issues against real backend responses.
+type WireCapture struct {
+	Rate     float64
+	MaxBytes int
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// A single captured command as written to the output.
+type wireRecord struct {
+	Time   time.Time `json:"time"`
+	Server string    `json:"server"`
+	Name   string    `json:"name"`
+	Args   []string  `json:"args"`
+	Reply  string    `json:"reply"`
+	Err    string    `json:"error,omitempty"`
+}
+
+// NewWireCapture creates a capture writing to the input writer.
+// Rate is the fraction of commands captured, from 0 to 1. Payloads longer than maxBytes are truncated.
+func NewWireCapture(w io.Writer, rate float64, maxBytes int) *WireCapture {
+	return &WireCapture{Rate: rate, MaxBytes: maxBytes, w: w}
+}
+
+// Writes the input command and reply if it is selected by sampling.
+// The input arguments and reply must already be redacted.
+func (c *WireCapture) capture(server, name string, args []interface{}, val interface{}, err error) {
+	if c.Rate <= 0 || rand.Float64() >= c.Rate {
+		return
+	}
+
+	rec := wireRecord{Time: time.Now(), Server: server, Name: name, Err: errString(err)}
+	for _, a := range args {
+		rec.Args = append(rec.Args, c.truncate(formatReply(a)))
+	}
+	rec.Reply = c.truncate(formatReply(val))
+
+	b, _ := json.Marshal(rec)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.w.Write(append(b, '\n'))
+}
+
+// Cuts the input string down to the configured maximum size.
+func (c *WireCapture) truncate(s string) string {
+	if c.MaxBytes > 0 && len(s) > c.MaxBytes {
+		return s[:c.MaxBytes] + "...(truncated)"
+	}
+	return s
+}
+
+// Renders a Redis reply or argument as text, with bulk strings shown as strings and arrays in brackets.
+func formatReply(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "(nil)"
+	case []byte:
+		return string(t)
+	case []interface{}:
+		parts := make([]string, len(t))
+		for i, e := range t {
+			parts[i] = formatReply(e)
+		}
+		return "[" + strings.Join(parts, " ") + "]"
+	}
+	return fmt.Sprint(v)
+}
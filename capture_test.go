@@ -0,0 +1,45 @@
+package twunproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestWireCaptureRecordsTruncatedPayloads(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("CMD", "KEY", "A1", "A2").Return([]interface{}{[]byte("KEY"), []byte("a long value")}, nil)
+	mockConn.EXPECT().Close()
+
+	buf := new(bytes.Buffer)
+	proxy := getMockProxy(mockPool)
+	WithWireCapture(NewWireCapture(buf, 1, 10))(proxy)
+
+	proxy.Do(getRedisCmd(), func(v interface{}) bool { return true })
+
+	var rec wireRecord
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if rec.Name != "CMD" || len(rec.Args) != 3 || rec.Args[0] != "KEY" {
+		t.Fatalf("Unexpected request capture: %+v", rec)
+	}
+
+	if rec.Reply != "[KEY a lon...(truncated)" {
+		t.Fatalf("Unexpected reply capture: %q", rec.Reply)
+	}
+}
+
+func TestWireCaptureSkipsUnsampledCommands(t *testing.T) {
+	buf := new(bytes.Buffer)
+	NewWireCapture(buf, 0, 0).capture("", "CMD", getRedisCmd().getArgs(), "OK", nil)
+
+	if buf.Len() != 0 {
+		t.Fatalf("Unexpected capture: %s", buf.String())
+	}
+}
@@ -0,0 +1,135 @@
+package twunproxy
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Client is a connection to an instance, as reported by CLIENT LIST. Fields holds every field as returned.
+type Client struct {
+	Server      string            `json:"server"`
+	ID          int64             `json:"id"`
+	Addr        string            `json:"addr"`
+	Name        string            `json:"name,omitempty"`
+	AgeSeconds  int64             `json:"age"`
+	IdleSeconds int64             `json:"idle"`
+	Cmd         string            `json:"cmd"`
+	Fields      map[string]string `json:"fields"`
+}
+
+// ClientList lists the clients connected to every instance, queried concurrently.
+// Clients of instances that fail are omitted, and the first error is returned with the rest.
+func (r *ProxyConn) ClientList() ([]Client, error) {
+	t := r.topology()
+	lists := make([][]Client, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("CLIENT", "LIST")
+		if err != nil {
+			return err
+		}
+
+		clients, err := parseClientList(v)
+		if err != nil {
+			return err
+		}
+
+		for _, fields := range clients {
+			num := func(field string) int64 {
+				n, _ := strconv.ParseInt(fields[field], 10, 64)
+				return n
+			}
+			lists[i] = append(lists[i], Client{
+				Server:      t.server(i),
+				ID:          num("id"),
+				Addr:        fields["addr"],
+				Name:        fields["name"],
+				AgeSeconds:  num("age"),
+				IdleSeconds: num("idle"),
+				Cmd:         fields["cmd"],
+				Fields:      fields,
+			})
+		}
+		return nil
+	})
+
+	var all []Client
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	return all, r.fanOutError(t, errs)
+}
+
+// ClientFilter selects the clients killed by ClientKill. Every field set must match.
+// Type is one of "normal", "master", "replica" or "pubsub". User requires Redis 6.0 and LAddr Redis 6.2.
+type ClientFilter struct {
+	ID    int64
+	Type  string
+	Addr  string
+	LAddr string
+	User  string
+}
+
+// Returned when a kill filter matches every client.
+var errEmptyClientFilter = errors.New("Client filter must set at least one field.")
+
+// KillResult records the number of clients killed on one instance.
+type KillResult struct {
+	Server string `json:"server"`
+	Killed int64  `json:"killed"`
+	Err    error  `json:"-"`
+}
+
+// ClientKill kills the clients matching the filter on every instance concurrently and reports the number killed on each.
+// The connection issuing the kill is spared. The first error is returned with the results.
+func (r *ProxyConn) ClientKill(filter ClientFilter) ([]KillResult, error) {
+	args := filter.args()
+	if len(args) == 0 {
+		return nil, errEmptyClientFilter
+	}
+	args = append([]interface{}{"KILL"}, args...)
+
+	t := r.topology()
+	res := make([]KillResult, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("CLIENT", args...)
+		if err != nil {
+			return err
+		}
+
+		n, ok := replyInt(v)
+		if !ok {
+			return errors.New("Unexpected reply to CLIENT KILL.")
+		}
+		res[i].Killed = n
+		return nil
+	})
+
+	for i, err := range errs {
+		res[i].Server = t.server(i)
+		res[i].Err = err
+	}
+	return res, firstError(errs)
+}
+
+// Returns the CLIENT KILL arguments for the fields set in the filter.
+func (f ClientFilter) args() []interface{} {
+	var args []interface{}
+	if f.ID != 0 {
+		args = append(args, "ID", f.ID)
+	}
+	if f.Type != "" {
+		args = append(args, "TYPE", f.Type)
+	}
+	if f.Addr != "" {
+		args = append(args, "ADDR", f.Addr)
+	}
+	if f.LAddr != "" {
+		args = append(args, "LADDR", f.LAddr)
+	}
+	if f.User != "" {
+		args = append(args, "USER", f.User)
+	}
+	return args
+}
@@ -0,0 +1,42 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestClientListAggregatesInstances(t *testing.T) {
+	proxy := getMockProxy(
+		connPool{&nilStyleConn{reply: []byte("id=7 addr=10.0.0.9:5000 name=worker age=30 idle=2 cmd=blpop\n")}},
+		connPool{&nilStyleConn{reply: []byte("id=3 addr=10.0.0.8:5000 name= age=5 idle=5 cmd=get\n")}})
+
+	clients, err := proxy.ClientList()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(clients) != 2 || clients[0].Name != "worker" || clients[0].IdleSeconds != 2 || clients[1].Server != "1" {
+		t.Fatalf("Unexpected clients: %+v", clients)
+	}
+}
+
+func TestClientKillBroadcastsFilter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("CLIENT", "KILL", "TYPE", "pubsub", "ADDR", "10.0.0.9:5000").Return(int64(1), nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("CLIENT", "KILL", "TYPE", "pubsub", "ADDR", "10.0.0.9:5000").Return(nil, errors.New("down"))
+	mockConn2.EXPECT().Close()
+
+	res, err := getMockProxy(mockPool1, mockPool2).ClientKill(ClientFilter{Type: "pubsub", Addr: "10.0.0.9:5000"})
+	if err == nil || res[0].Killed != 1 || res[1].Err == nil {
+		t.Fatalf("Unexpected result: %+v, %v", res, err)
+	}
+
+	if _, err := getMockProxy(mockPool1).ClientKill(ClientFilter{}); err != errEmptyClientFilter {
+		t.Fatalf("Expected empty filter error, got %v", err)
+	}
+}
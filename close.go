@@ -0,0 +1,82 @@
+package twunproxy
+
+import (
+	"sync"
+)
+
+// Close stops the background subsystems of the proxy, such as configuration and backend watches, DNS refreshes,
+// health checks, latency probes, eviction monitors, scheduled jobs and subscribers, then closes each pool
+// implementing PoolCloser, returning the first error. The proxy must not be used once closed.
+// Closing it again does nothing. The pools of proxies in a ProxySet or Migrator are shared, and are closed
+// by closing the set or the migrator instead.
+func (r *ProxyConn) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	stops := r.closers
+	r.closers = nil
+	health := r.health
+	r.mu.Unlock()
+
+	for _, stop := range stops {
+		stop()
+	}
+	if health != nil {
+		health.Stop()
+	}
+
+	if r.poolsShared {
+		return nil
+	}
+	return closePools(r.topology().pools)
+}
+
+// Registers the input function to stop a background subsystem when the proxy is closed.
+// The returned function stops the subsystem early and unregisters it. The input function runs at most once,
+// and runs immediately if the proxy is already closed.
+func (r *ProxyConn) onClose(fn func()) func() {
+	var once sync.Once
+	stop := func() { once.Do(fn) }
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		stop()
+		return stop
+	}
+	if r.closers == nil {
+		r.closers = make(map[int]func())
+	}
+	id := r.nextCloser
+	r.nextCloser++
+	r.closers[id] = stop
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		delete(r.closers, id)
+		r.mu.Unlock()
+		stop()
+	}
+}
+
+// Closes each of the input pools that implements PoolCloser, once however often it appears,
+// returning the first error.
+func closePools(pools []ConnGetter) error {
+	var first error
+	closed := make(map[ConnGetter]bool)
+	for _, pool := range pools {
+		c, ok := pool.(PoolCloser)
+		if !ok || closed[pool] {
+			continue
+		}
+		closed[pool] = true
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,85 @@
+package twunproxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCloseStopsSubsystemsAndClosesPools(t *testing.T) {
+	closable := &closingPool{ConnGetter: &seqPool{conns: []Conn{newFakePubSubConn()}}, closed: make(chan bool, 2)}
+	proxy := getMockProxy(closable, connPool{&nilStyleConn{}})
+
+	s, err := proxy.Subscribe(SubscribeConfig{Channels: []string{"news"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m := proxy.MonitorEvictions(time.Hour)
+
+	stopped := false
+	proxy.onClose(func() { stopped = true })
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !stopped {
+		t.Fatal("Expected registered subsystem to be stopped.")
+	}
+	if _, ok := <-s.Messages(); ok {
+		t.Fatal("Expected subscriber to be closed.")
+	}
+	if len(closable.closed) != 1 {
+		t.Fatalf("Expected pool to be closed once, got %d", len(closable.closed))
+	}
+
+	// Stopping afterwards, or closing again, does nothing more.
+	m.Stop()
+	s.Close()
+	if err := proxy.Close(); err != nil || len(closable.closed) != 1 {
+		t.Fatalf("Expected second Close to do nothing, got %v and %d closes", err, len(closable.closed))
+	}
+}
+
+func TestOnCloseRunsOnceAndImmediatelyOnceClosed(t *testing.T) {
+	proxy := getMockProxy()
+
+	runs := 0
+	stop := proxy.onClose(func() { runs++ })
+	stop()
+	stop()
+	proxy.Close()
+	if runs != 1 {
+		t.Fatalf("Expected one run, got %d", runs)
+	}
+
+	late := false
+	proxy.onClose(func() { late = true })
+	if !late {
+		t.Fatal("Expected function registered after Close to run immediately.")
+	}
+}
+
+func TestProxySetClosesSharedPoolsOnce(t *testing.T) {
+	shared := &closingPool{ConnGetter: connPool{&nilStyleConn{}}, closed: make(chan bool, 2)}
+	a, b := getMockProxy(shared), getMockProxy(shared)
+	a.poolsShared, b.poolsShared = true, true
+
+	s := &ProxySet{names: []string{"a", "b"}, proxies: map[string]*ProxyConn{"a": a, "b": b}}
+
+	a.Close()
+	if len(shared.closed) != 0 {
+		t.Fatal("Expected shared pool to be left open by a proxy of the set.")
+	}
+	if err := s.Close(); err != nil || len(shared.closed) != 1 {
+		t.Fatalf("Expected shared pool to be closed once, got %v and %d closes", err, len(shared.closed))
+	}
+}
+
+func TestBreakerClosesWrappedPool(t *testing.T) {
+	p := &closingPool{ConnGetter: connPool{&nilStyleConn{}}, closed: make(chan bool, 2)}
+	if err := NewBreaker(p, "a:6379", BreakerConfig{}).Close(); err != nil || len(p.closed) != 1 {
+		t.Fatalf("Expected wrapped pool to be closed, got %v and %d closes", err, len(p.closed))
+	}
+	if err := NewBreaker(connPool{&nilStyleConn{}}, "a:6379", BreakerConfig{}).Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"github.com/txodds/twunproxy"
+	"github.com/txodds/twunproxy/dialer"
+	"github.com/txodds/twunproxy/redigo"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Twunctl runs operational tasks against the instances behind a Twemproxy pool.
+// Usage: twunctl <command> [flags]
+const usage = `Usage: twunctl <command> [flags]
+
+Commands:
+  loadgen   Generate synthetic traffic across the pool and report per-instance throughput and latency.
+  runbook   Run a plan of operational steps, such as a failover, rolling back completed steps on failure.
+`
+
+// Dials the backends. By default every address of a hostname is dialed concurrently, so that one unreachable address
+// does not stall commands; the connection flags may route dials through a SOCKS5 proxy or SSH tunnel instead.
+var dial dialer.DialFunc = (&dialer.HappyDialer{Timeout: 5 * time.Second}).Dial
+
+// Flags for reaching the backends from outside their network, shared by every command.
+type connFlags struct {
+	socks5, socks5User, socks5Password *string
+	ssh, sshUser, sshKey, knownHosts   *string
+}
+
+// Registers the connection flags on the input flag set.
+func addConnFlags(fs *flag.FlagSet) *connFlags {
+	return &connFlags{
+		socks5:         fs.String("socks5", "", "Address of a SOCKS5 proxy to dial backends through."),
+		socks5User:     fs.String("socks5-user", "", "User for the SOCKS5 proxy."),
+		socks5Password: fs.String("socks5-password", "", "Password for the SOCKS5 proxy."),
+		ssh:            fs.String("ssh", "", "Address of an SSH bastion to tunnel backend connections through."),
+		sshUser:        fs.String("ssh-user", os.Getenv("USER"), "User for the SSH bastion."),
+		sshKey:         fs.String("ssh-key", os.Getenv("HOME")+"/.ssh/id_rsa", "Private key for the SSH bastion."),
+		knownHosts:     fs.String("ssh-known-hosts", os.Getenv("HOME")+"/.ssh/known_hosts", "Known hosts file for the SSH bastion."),
+	}
+}
+
+// Routes backend dials as the connection flags direct.
+func (f *connFlags) apply() error {
+	switch {
+	case *f.socks5 != "" && *f.ssh != "":
+		return errors.New("Only one of -socks5 and -ssh may be set.")
+	case *f.socks5 != "":
+		d, err := dialer.SOCKS5(*f.socks5, *f.socks5User, *f.socks5Password)
+		if err != nil {
+			return err
+		}
+		dial = d
+	case *f.ssh != "":
+		t, err := dialer.NewSSHKeyTunnel(*f.ssh, *f.sshUser, *f.sshKey, *f.knownHosts)
+		if err != nil {
+			return err
+		}
+		dial = t.Dial
+	}
+	return nil
+}
+
+// Creates a pool for each server descriptor in the Twemproxy configuration, dialing as the connection flags direct.
+var createPool = redigo.NewCreatePool(redigo.Options{
+	MaxIdle: 16,
+	DialOptions: []redis.DialOption{redis.DialNetDial(func(network, addr string) (net.Conn, error) {
+		return dial(network, addr)
+	})},
+})
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "loadgen":
+		err = loadgen(os.Args[2:])
+	case "runbook":
+		err = runbook(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Runs the loadgen command with the input arguments, printing the report as JSON.
+func loadgen(args []string) error {
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	confPath := fs.String("conf", "./nutcracker.yml", "Path to the Twemproxy configuration file.")
+	poolName := fs.String("pool", "", "Name of the pool in the configuration.")
+	mix := fs.String("mix", "get=1,set=1", "Command weights as name=weight pairs for blpop, lpush, get and set.")
+	keys := fs.Int("keys", 1000, "Number of distinct keys.")
+	prefix := fs.String("prefix", "twunctl:loadgen:", "Prefix for generated keys.")
+	zipf := fs.Bool("zipf", false, "Skew keys towards a few hot keys rather than choosing uniformly.")
+	duration := fs.Duration("duration", 10*time.Second, "How long to generate load for.")
+	concurrency := fs.Int("concurrency", 8, "Number of concurrent workers.")
+	rate := fs.Float64("rate", 0, "Maximum commands per second across all workers; 0 for unlimited.")
+	size := fs.Int("value-size", 64, "Size in bytes of written values.")
+	timeout := fs.Duration("blpop-timeout", 100*time.Millisecond, "Timeout for each BLPOP.")
+	conn := addConnFlags(fs)
+	fs.Parse(args)
+
+	if err := conn.apply(); err != nil {
+		return err
+	}
+
+	conf := twunproxy.LoadConfig{
+		Keys:         *keys,
+		KeyPrefix:    *prefix,
+		Duration:     *duration,
+		Concurrency:  *concurrency,
+		Rate:         *rate,
+		ValueSize:    *size,
+		BLPopTimeout: *timeout,
+	}
+	if *zipf {
+		conf.Distribution = twunproxy.ZipfKeys
+	}
+	if err := parseMix(*mix, &conf.Mix); err != nil {
+		return err
+	}
+
+	proxy, err := twunproxy.NewProxyConn(*confPath, *poolName, *keys, createPool)
+	if err != nil {
+		return err
+	}
+	defer proxy.Close()
+
+	report, err := proxy.GenerateLoad(context.Background(), conf)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// Runs the runbook command with the input arguments, printing the result of each step as JSON.
+func runbook(args []string) error {
+	fs := flag.NewFlagSet("runbook", flag.ExitOnError)
+	confPath := fs.String("conf", "./nutcracker.yml", "Path to the Twemproxy configuration file.")
+	poolName := fs.String("pool", "", "Name of the pool in the configuration.")
+	name := fs.String("name", "runbook", "Name of the plan, for reporting.")
+	steps := fs.String("steps", "", "Comma-separated steps to run in order, each name[=duration]: "+
+		"pause=<duration>, unpause, bgsave[=<spacing>], barrier=<timeout>, promote, reload.")
+	mode := fs.String("pause-mode", "write", "Clients suspended by pause steps: write or all.")
+	dryRun := fs.Bool("dry-run", false, "List the steps that would run without running them.")
+	conn := addConnFlags(fs)
+	fs.Parse(args)
+
+	plan, err := parsePlan(*name, *steps, twunproxy.PauseMode(strings.ToUpper(*mode)))
+	if err != nil {
+		return err
+	}
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+	if err := conn.apply(); err != nil {
+		return err
+	}
+
+	proxy, err := twunproxy.NewProxyConn(*confPath, *poolName, 0, createPool)
+	if err != nil {
+		return err
+	}
+	defer proxy.Close()
+
+	res, runErr := plan.Execute(proxy, *dryRun)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// Parses steps such as "pause=10s,bgsave,barrier=30s,promote,reload,unpause" into a plan of the ready-made steps.
+func parsePlan(name, spec string, mode twunproxy.PauseMode) (*twunproxy.Plan, error) {
+	if mode != twunproxy.PauseModeWrite && mode != twunproxy.PauseModeAll {
+		return nil, fmt.Errorf("Unknown pause mode %q.", mode)
+	}
+
+	plan := &twunproxy.Plan{Name: name}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		step, arg := entry, ""
+		if i := strings.Index(entry, "="); i >= 0 {
+			step, arg = entry[:i], entry[i+1:]
+		}
+		var d time.Duration
+		if arg != "" {
+			var err error
+			if d, err = time.ParseDuration(arg); err != nil {
+				return nil, fmt.Errorf("Invalid duration in step %q.", entry)
+			}
+		}
+
+		switch strings.ToLower(step) {
+		case "pause":
+			if d <= 0 {
+				return nil, errors.New("Step pause requires a duration, such as pause=10s.")
+			}
+			plan.Steps = append(plan.Steps, twunproxy.PauseStep(d, mode))
+		case "unpause":
+			plan.Steps = append(plan.Steps, twunproxy.UnpauseStep())
+		case "bgsave":
+			plan.Steps = append(plan.Steps, twunproxy.BGSaveStep(d))
+		case "barrier":
+			if d <= 0 {
+				return nil, errors.New("Step barrier requires a timeout, such as barrier=30s.")
+			}
+			plan.Steps = append(plan.Steps, twunproxy.BarrierStep(d))
+		case "promote":
+			plan.Steps = append(plan.Steps, twunproxy.PromoteStep())
+		case "reload":
+			plan.Steps = append(plan.Steps, twunproxy.ReloadStep())
+		default:
+			return nil, fmt.Errorf("Unknown step %q.", step)
+		}
+	}
+	return plan, nil
+}
+
+// Parses command weights such as "blpop=1,lpush=2" into the input mix.
+func parseMix(s string, mix *twunproxy.LoadMix) error {
+	for _, pair := range strings.Split(s, ",") {
+		var name string
+		var weight int
+		if _, err := fmt.Sscanf(strings.Replace(pair, "=", " ", 1), "%s %d", &name, &weight); err != nil {
+			return fmt.Errorf("Invalid mix entry %q.", pair)
+		}
+
+		switch strings.ToLower(name) {
+		case "blpop":
+			mix.BLPop = weight
+		case "lpush":
+			mix.LPush = weight
+		case "get":
+			mix.Get = weight
+		case "set":
+			mix.Set = weight
+		default:
+			return fmt.Errorf("Unknown command %q in mix.", name)
+		}
+	}
+	return nil
+}
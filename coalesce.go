@@ -0,0 +1,80 @@
+package twunproxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// The discoveries in progress, by key. Each channel is closed when its discovery completes.
+type discoveryFlights struct {
+	mu       sync.Mutex
+	inflight map[string]chan struct{}
+}
+
+// WithDiscoveryCoalescing lets only one discovery per key be in progress at once. Commands for a key that is
+// already being discovered wait for that discovery to complete and then run on the instance it mapped the key to,
+// so that many callers of BLPop on the same new key do not each probe every instance.
+// If the discovery maps nothing, every waiting command is then discovered at once on its own, so a key that
+// exists nowhere is still probed by each command; coalescing only spares the probes of keys that are found.
+// The waiting commands are not coalesced again, since each would then also wait out the discoveries of those
+// ahead of it, such as the timeout of every blocking pop. Only the location of the key is shared: each command
+// still runs on its own, so a popped value is never returned to more than one caller.
+// A waiting command waits as long as the discovery takes, such as the timeout of a blocking pop.
+func WithDiscoveryCoalescing() Option {
+	return func(r *ProxyConn) {
+		r.flights = &discoveryFlights{inflight: make(map[string]chan struct{})}
+	}
+}
+
+// Joins the discovery in progress for the input key, or starts one if there is none.
+// The returned channel is closed when the discovery completes; the leader must close it by calling finish.
+func (f *discoveryFlights) join(key string) (chan struct{}, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if done, ok := f.inflight[key]; ok {
+		return done, false
+	}
+
+	done := make(chan struct{})
+	f.inflight[key] = done
+	return done, true
+}
+
+// Completes the discovery of the input key, releasing any waiting commands.
+func (f *discoveryFlights) finish(key string, done chan struct{}) {
+	f.mu.Lock()
+	delete(f.inflight, key)
+	f.mu.Unlock()
+	close(done)
+}
+
+// Waits for the discovery in progress for the command's key, if there is one, and then runs the command on the
+// instance mapped by it, returning its result. If nil is returned the command should be discovered,
+// and the returned function must be called once discovery completes. Commands released by a discovery that
+// mapped nothing are discovered without coalescing.
+func (r *ProxyConn) coalesce(ctx context.Context, t *topology, cmd *RedisCmd, start time.Time) (*redisReturn, func()) {
+	if r.flights == nil || cmd.noCache {
+		return nil, func() {}
+	}
+
+	done, leader := r.flights.join(cmd.key)
+	if leader {
+		return nil, func() { r.flights.finish(cmd.key, done) }
+	}
+
+	r.counter("coalesced_discoveries", "", 1)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return &redisReturn{err: ctx.Err(), pool: -1}, nil
+	}
+
+	pool, ok := r.lookup(cmd.key)
+	if !ok {
+		return nil, func() {}
+	}
+	v, err := r.doMapped(ctx, t, pool, cmd, start)
+	return &redisReturn{val: v, err: err, pool: t.indexOf(pool)}, nil
+}
@@ -0,0 +1,85 @@
+package twunproxy
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A connection that answers after a delay, counting the commands it receives.
+type slowConn struct {
+	reply interface{}
+	delay time.Duration
+	calls *int32
+}
+
+func (c slowConn) Do(string, ...interface{}) (interface{}, error) {
+	atomic.AddInt32(c.calls, 1)
+	time.Sleep(c.delay)
+	return c.reply, nil
+}
+
+func (c slowConn) Close() error { return nil }
+
+func TestDiscoveryCoalescingProbesOnce(t *testing.T) {
+	var missCalls, holderCalls int32
+	proxy := getMockProxy(
+		connPool{slowConn{delay: 20 * time.Millisecond, calls: &missCalls}},
+		connPool{slowConn{reply: "VALUE", delay: 20 * time.Millisecond, calls: &holderCalls}})
+	WithDiscoveryCoalescing()(proxy)
+
+	canMap := func(v interface{}) bool { return v != nil }
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := proxy.Do(NewRedisCmd("GET", "KEY"), canMap); err != nil || v != "VALUE" {
+				t.Errorf("Expected the value, got %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&missCalls); n != 1 {
+		t.Fatalf("Expected the instance without the key to be probed once, got %d", n)
+	}
+	if n := atomic.LoadInt32(&holderCalls); n != 5 {
+		t.Fatalf("Expected every command to run on the instance holding the key, got %d", n)
+	}
+}
+
+func TestDiscoveryCoalescingFallsBackOnMiss(t *testing.T) {
+	var calls1, calls2 int32
+	proxy := getMockProxy(
+		connPool{slowConn{delay: 20 * time.Millisecond, calls: &calls1}},
+		connPool{slowConn{delay: 20 * time.Millisecond, calls: &calls2}})
+	WithDiscoveryCoalescing()(proxy)
+
+	m := newFakeMetrics()
+	WithMetrics(m)(proxy)
+
+	canMap := func(v interface{}) bool { return v != nil }
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			proxy.Do(NewRedisCmd("GET", "MISSING"), canMap)
+		}()
+		// Start the leader first, so that the others wait on it.
+		if i == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	wg.Wait()
+
+	// The leader's fan-out, then one each for the four waiters released by its miss.
+	if n1, n2 := atomic.LoadInt32(&calls1), atomic.LoadInt32(&calls2); n1 != 5 || n2 != 5 {
+		t.Fatalf("Expected five fan-outs, got %d and %d probes", n1, n2)
+	}
+	if n := m.get("coalesced_discoveries", ""); n != 4 {
+		t.Fatalf("Expected four coalesced commands, got %v", n)
+	}
+}
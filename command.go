@@ -0,0 +1,237 @@
+package twunproxy
+
+import (
+	"errors"
+	"strings"
+)
+
+// CommandInfo describes a command as reported by the COMMAND command.
+// FirstKey, LastKey and Step give the positions of key arguments, counting the command name as position 0.
+// A negative LastKey counts back from the final argument. Commands without keys have a FirstKey of 0.
+// If KeyFunc is set, it is used instead to return the indices of the keys among the arguments,
+// which exclude the command name.
+// If Accept is set, Do uses it as the predicate for the command when none is given. It should accept the replies
+// of instances holding the key and reject those of instances that do not.
+type CommandInfo struct {
+	Name     string                         `json:"name"`
+	Arity    int                            `json:"arity"`
+	Flags    []string                       `json:"flags"`
+	FirstKey int                            `json:"first_key"`
+	LastKey  int                            `json:"last_key"`
+	Step     int                            `json:"step"`
+	KeyFunc  func(args []interface{}) []int `json:"-"`
+	Accept   func(interface{}) bool         `json:"-"`
+}
+
+// HasFlag reports whether the command has the input flag, such as "write", "readonly" or "movablekeys".
+func (ci CommandInfo) HasFlag(flag string) bool {
+	for _, f := range ci.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWrite reports whether the command may modify data.
+func (ci CommandInfo) IsWrite() bool {
+	return ci.HasFlag("write")
+}
+
+// Keys returns the key arguments of the command from the input arguments, which exclude the command name.
+// Nil is returned if the key positions cannot be determined.
+func (ci CommandInfo) Keys(args []interface{}) []string {
+	var keys []string
+	for _, i := range ci.KeyPositions(args) {
+		if k, ok := keyString(args[i]); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// KeyPositions returns the indices of the key arguments among the input arguments, which exclude the command name.
+// Positions for commands with movable keys, such as EVAL and ZUNIONSTORE, are found by parsing their arguments.
+// Nil is returned if the positions cannot be determined.
+func (ci CommandInfo) KeyPositions(args []interface{}) []int {
+	if ci.KeyFunc != nil {
+		return ci.KeyFunc(args)
+	}
+	if ci.HasFlag("movablekeys") {
+		return movableKeyPositions(ci.Name, args)
+	}
+	if ci.FirstKey <= 0 || ci.Step <= 0 {
+		return nil
+	}
+
+	last := ci.LastKey
+	if last < 0 {
+		last = len(args) + 1 + last
+	}
+	if last > len(args) {
+		last = len(args)
+	}
+
+	var pos []int
+	for i := ci.FirstKey; i <= last; i += ci.Step {
+		pos = append(pos, i-1)
+	}
+	return pos
+}
+
+// LoadCommands queries COMMAND from the first reachable instance and uses the reply as the routing table for DoKeyed.
+// Key positions and read/write classification are then taken from the server rather than assumed.
+func (r *ProxyConn) LoadCommands() error {
+	t := r.topology()
+
+	var err error
+	for _, pool := range t.pools {
+		var v interface{}
+		c := pool.Get()
+		v, err = c.Do("COMMAND")
+		c.Close()
+		if err != nil {
+			continue
+		}
+
+		var table map[string]CommandInfo
+		if table, err = parseCommands(v); err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		r.commands = table
+		r.mu.Unlock()
+		return nil
+	}
+
+	if err == nil {
+		err = errors.New("No instances to query for commands.")
+	}
+	return err
+}
+
+// WithCommandIntrospection loads the routing table for DoKeyed from COMMAND when the proxy is created.
+// If this fails, DoKeyed assumes that the key is the first argument, as with LoadCommands not having been called.
+func WithCommandIntrospection() Option {
+	return func(r *ProxyConn) {
+		r.LoadCommands()
+	}
+}
+
+// RegisterCommand adds a command to the routing table used by DoKeyed, typically for a module command
+// such as JSON.GET or BF.ADD that Twemproxy does not know how to route.
+// Key positions are given by FirstKey, LastKey and Step, or by KeyFunc for anything more involved.
+// Include the "write" flag for commands that may create keys.
+// Registered commands take precedence over those loaded from COMMAND, and survive reloading it.
+func (r *ProxyConn) RegisterCommand(ci CommandInfo) error {
+	if ci.Name == "" {
+		return errors.New("Command name is required.")
+	}
+	if ci.KeyFunc == nil && (ci.FirstKey <= 0 || ci.Step <= 0) {
+		return errors.New("Command key positions are required.")
+	}
+
+	ci.Name = strings.ToLower(ci.Name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.registered == nil {
+		r.registered = make(map[string]CommandInfo)
+	}
+	r.registered[ci.Name] = ci
+	return nil
+}
+
+// Command returns the routing table entry for the input command name,
+// if it has been registered or the table has been loaded.
+func (r *ProxyConn) Command(name string) (CommandInfo, bool) {
+	name = strings.ToLower(name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ci, ok := r.registered[name]; ok {
+		return ci, true
+	}
+	ci, ok := r.commands[name]
+	return ci, ok
+}
+
+// DoKeyed runs an arbitrary single-key command on the instance holding its key.
+// The key is located using the routing table loaded by LoadCommands. Commands not in the table are assumed
+// to take the key as their first argument and to be writes, unless they are known to have movable keys.
+// A command may name its key more than once, as with "SORT key STORE key", but every key must be the same.
+// If the key does not exist, writes go to the instance that the hash ring places it on.
+// Any reply processor registered for the command is applied to the result.
+func (r *ProxyConn) DoKeyed(name string, args ...interface{}) (interface{}, error) {
+	ci, ok := r.Command(name)
+	if !ok {
+		ci = CommandInfo{Name: strings.ToLower(name), FirstKey: 1, LastKey: 1, Step: 1, Flags: []string{"write"}}
+		if _, movable := movableKeyParsers[ci.Name]; movable {
+			ci.Flags = append(ci.Flags, "movablekeys")
+		}
+	}
+
+	pos := ci.KeyPositions(args)
+	keys := ci.Keys(args)
+	if len(keys) == 0 || len(keys) != len(pos) {
+		return nil, errors.New("Cannot determine the key for command " + name + ".")
+	}
+	for _, k := range keys[1:] {
+		if k != keys[0] {
+			return nil, errors.New("Commands with more than one key are not supported.")
+		}
+	}
+
+	cmd, err := NewRedisCmdAt(name, pos[0], args...)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := r.doKeyed(cmd, ci.IsWrite())
+	return r.process(name, v, err)
+}
+
+// Parses the reply of the COMMAND command into a table of command information by lower-case command name.
+// Fields beyond the key step, added in later Redis versions, are ignored.
+func parseCommands(v interface{}) (map[string]CommandInfo, error) {
+	entries, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("Unexpected reply to COMMAND.")
+	}
+
+	table := make(map[string]CommandInfo, len(entries))
+	for _, e := range entries {
+		fields, ok := e.([]interface{})
+		if !ok || len(fields) < 6 {
+			return nil, errors.New("Unexpected entry in reply to COMMAND.")
+		}
+
+		var ci CommandInfo
+		ci.Name, _ = replyString(fields[0])
+		ci.Name = strings.ToLower(ci.Name)
+		arity, _ := replyInt(fields[1])
+		first, _ := replyInt(fields[3])
+		last, _ := replyInt(fields[4])
+		step, _ := replyInt(fields[5])
+		ci.Arity, ci.FirstKey, ci.LastKey, ci.Step = int(arity), int(first), int(last), int(step)
+
+		flags, _ := fields[2].([]interface{})
+		for _, f := range flags {
+			if s, ok := replyString(f); ok {
+				ci.Flags = append(ci.Flags, s)
+			}
+		}
+
+		table[ci.Name] = ci
+	}
+	return table, nil
+}
+
+// Converts a key argument to a string.
+func keyString(v interface{}) (string, bool) {
+	if s, ok := replyString(v); ok {
+		return s, true
+	}
+	return "", false
+}
@@ -0,0 +1,99 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+// Returns a COMMAND reply entry in the Redis 6 layout.
+func commandEntry(name string, arity int64, flags []string, first, last, step int64) interface{} {
+	fs := make([]interface{}, len(flags))
+	for i, f := range flags {
+		fs[i] = f
+	}
+	return []interface{}{[]byte(name), arity, fs, first, last, step}
+}
+
+func TestParseCommandsAndExtractKeys(t *testing.T) {
+	table, err := parseCommands([]interface{}{
+		commandEntry("get", 2, []string{"readonly", "fast"}, 1, 1, 1),
+		commandEntry("mset", -3, []string{"write"}, 1, -1, 2),
+		commandEntry("eval", -3, []string{"noscript", "movablekeys"}, 0, 0, 0),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if table["get"].IsWrite() || !table["mset"].IsWrite() {
+		t.Fatal("Unexpected read/write classification.")
+	}
+
+	keys := table["mset"].Keys([]interface{}{"k1", "v1", "k2", "v2"})
+	if len(keys) != 2 || keys[0] != "k1" || keys[1] != "k2" {
+		t.Fatalf("Unexpected keys: %v", keys)
+	}
+
+	if keys := table["eval"].Keys([]interface{}{"return 1", 0}); keys != nil {
+		t.Fatalf("Expected no keys for movable command, got %v", keys)
+	}
+}
+
+func TestDoKeyedUsesLoadedCommandTable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("COMMAND").Return([]interface{}{
+		commandEntry("strlen", 2, []string{"readonly"}, 1, 1, 1),
+	}, nil)
+	mockConn.EXPECT().Do("EXISTS", "KEY").Return(int64(1), nil)
+	mockConn.EXPECT().Do("STRLEN", "KEY").Return(int64(5), nil)
+	mockConn.EXPECT().Close().Times(3)
+
+	proxy := getMockProxy(mockPool)
+	if err := proxy.LoadCommands(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if v, err := proxy.DoKeyed("STRLEN", "KEY"); err != nil || v != int64(5) {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestDoKeyedRejectsMultipleKeys(t *testing.T) {
+	proxy := getMockProxy()
+	proxy.commands = map[string]CommandInfo{"mset": {Name: "mset", FirstKey: 1, LastKey: -1, Step: 2}}
+
+	if _, err := proxy.DoKeyed("MSET", "k1", "v1", "k2", "v2"); err == nil {
+		t.Fatal("Expected error for multiple keys.")
+	}
+}
+
+func TestRegisteredModuleCommandRoutesByKeyFunc(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("MOD.COPY", "opt", "KEY").Return("OK", nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	err := proxy.RegisterCommand(CommandInfo{
+		Name:    "MOD.COPY",
+		Flags:   []string{"write"},
+		KeyFunc: func(args []interface{}) []int { return []int{1} },
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if v, err := proxy.DoKeyed("MOD.COPY", "opt", "KEY"); err != nil || v != "OK" {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+
+	if err := proxy.RegisterCommand(CommandInfo{Name: "MOD.NOKEYS"}); err == nil {
+		t.Fatal("Expected error for command without key positions.")
+	}
+}
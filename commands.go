@@ -1,7 +1,9 @@
 package twunproxy
 
 import (
+	"context"
 	"errors"
+	"github.com/txodds/twunproxy/reply"
 	"time"
 )
 
@@ -11,8 +13,112 @@ import (
  ******************************************************/
 
 // BLPop implements the BLPOP Redis functionality that is unavailable using regular Twemproxy.
-// NOTE: This version is only inplemented for a single key. Implementation of the full command is pending.
+// A timeout of zero blocks until a value is popped, as for Redis. A timeout returns a *TimeoutError.
+// NOTE: This version is only implemented for a single key. Use BLPopKeys to pop from several lists.
 func (r *ProxyConn) BLPop(key string, timeout time.Duration) (string, error) {
+	return r.BLPopContext(context.Background(), key, timeout)
+}
+
+// BLPopContext runs BLPOP as for BLPop, but returns the context error if the context ends before a value is popped.
+// The timeout sent to the server is clamped to the context deadline, so the pop never blocks beyond it.
+// A value popped on cancellation before the deadline is lost, since the server may still pop it after the caller leaves.
+func (r *ProxyConn) BLPopContext(ctx context.Context, key string, timeout time.Duration) (string, error) {
+	return r.pop(ctx, "BLPOP", key, timeout)
+}
+
+// BLPopKeyValue pops from the list as for BLPop, but returns the key popped from with the value.
+// False is returned, without an error, if the timeout passed with nothing popped.
+func (r *ProxyConn) BLPopKeyValue(key string, timeout time.Duration) (KeyValue, bool, error) {
+	return r.BLPopKeyValueContext(context.Background(), key, timeout)
+}
+
+// BLPopKeyValueContext pops as for BLPopKeyValue, but returns the context error if the context ends first.
+func (r *ProxyConn) BLPopKeyValueContext(ctx context.Context, key string, timeout time.Duration) (KeyValue, bool, error) {
+	return r.popKeyValue(ctx, "BLPOP", key, timeout)
+}
+
+// BLPopBytes pops from the list with the input binary key as for BLPop, returning the value as the bytes Redis
+// replies with.
+func (r *ProxyConn) BLPopBytes(key []byte, timeout time.Duration) ([]byte, error) {
+	return r.BLPopBytesContext(context.Background(), key, timeout)
+}
+
+// BLPopBytesContext pops as for BLPopBytes, but returns the context error if the context ends first.
+func (r *ProxyConn) BLPopBytesContext(ctx context.Context, key []byte, timeout time.Duration) ([]byte, error) {
+	v, err := r.pop(ctx, "BLPOP", string(key), timeout)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(v), nil
+}
+
+// BRPop implements the BRPOP Redis functionality for a single key, popping from the tail of the list as for BLPop.
+func (r *ProxyConn) BRPop(key string, timeout time.Duration) (string, error) {
+	return r.BRPopContext(context.Background(), key, timeout)
+}
+
+// BRPopContext runs BRPOP as for BRPop, but returns the context error if the context ends before a value is popped.
+func (r *ProxyConn) BRPopContext(ctx context.Context, key string, timeout time.Duration) (string, error) {
+	return r.pop(ctx, "BRPOP", key, timeout)
+}
+
+// BRPopKeyValue pops from the tail of the list as for BLPopKeyValue.
+func (r *ProxyConn) BRPopKeyValue(key string, timeout time.Duration) (KeyValue, bool, error) {
+	return r.BRPopKeyValueContext(context.Background(), key, timeout)
+}
+
+// BRPopKeyValueContext pops as for BRPopKeyValue, but returns the context error if the context ends first.
+func (r *ProxyConn) BRPopKeyValueContext(ctx context.Context, key string, timeout time.Duration) (KeyValue, bool, error) {
+	return r.popKeyValue(ctx, "BRPOP", key, timeout)
+}
+
+// BRPopBytes pops from the tail of the list with the input binary key as for BLPopBytes.
+func (r *ProxyConn) BRPopBytes(key []byte, timeout time.Duration) ([]byte, error) {
+	return r.BRPopBytesContext(context.Background(), key, timeout)
+}
+
+// BRPopBytesContext pops as for BRPopBytes, but returns the context error if the context ends first.
+func (r *ProxyConn) BRPopBytesContext(ctx context.Context, key []byte, timeout time.Duration) ([]byte, error) {
+	v, err := r.pop(ctx, "BRPOP", string(key), timeout)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(v), nil
+}
+
+// The longest a blocking pop with a timeout of zero is issued for at a time. The pop is re-issued until a value
+// is popped, so that a connection is never held beyond this after the caller's context ends.
+const blockForeverSlice = 5 * time.Second
+
+// Runs the named blocking pop for a single key and returns the popped value, or a *TimeoutError.
+func (r *ProxyConn) pop(ctx context.Context, name, key string, timeout time.Duration) (string, error) {
+	kv, ok, err := r.popKeyValue(ctx, name, key, timeout)
+	if err == nil && !ok {
+		return "", &TimeoutError{Command: name}
+	}
+	return kv.Value, err
+}
+
+// Runs the named blocking pop for a single key and returns the key and value popped, if any.
+// A timeout of zero re-issues the pop in slices until a value is popped or the context ends.
+func (r *ProxyConn) popKeyValue(ctx context.Context, name, key string, timeout time.Duration) (KeyValue, bool, error) {
+	if timeout > 0 {
+		return r.popOnce(ctx, name, key, timeout)
+	}
+
+	for {
+		kv, ok, err := r.popOnce(ctx, name, key, blockForeverSlice)
+		if ok || err != nil {
+			return kv, ok, err
+		}
+		if err := ctx.Err(); err != nil {
+			return KeyValue{}, false, err
+		}
+	}
+}
+
+// Issues the named blocking pop for a single key once, blocking for up to the timeout.
+func (r *ProxyConn) popOnce(ctx context.Context, name, key string, timeout time.Duration) (KeyValue, bool, error) {
 
 	// If the command times out, it will not return a slice of results and is therefore not accepted
 	canMap := func(v interface{}) bool {
@@ -20,52 +126,173 @@ func (r *ProxyConn) BLPop(key string, timeout time.Duration) (string, error) {
 		return ok
 	}
 
+	block, err := r.blockTimeout(ctx, r.topology(), timeout)
+	if err != nil {
+		return KeyValue{}, false, err
+	}
+
 	cmd := RedisCmd{
-		name: "BLPOP",
+		name: name,
 		key:  key,
-		args: []interface{}{timeout.Seconds()},
+		args: []interface{}{block},
 	}
 
-	v, err := r.Do(&cmd, canMap)
+	v, err := r.doRouted(ctx, &cmd, canMap)
+
+	// An unmapped key times out on every instance without a mapping, and a mapped key with a nil reply.
+	if err == ErrNoMapping || (err == nil && v == nil) {
+		return KeyValue{}, false, nil
+	}
+	if err != nil {
+		return KeyValue{}, false, err
+	}
+
+	kv, err := keyValueReply(v)
+	return kv, err == nil, err
+}
+
+// Returned when the source and destination of a list move are held by different instances.
+var errCrossInstance = errors.New("Source and destination keys are on different instances.")
+
+// BRPopLPush implements BRPOPLPUSH, atomically moving the tail of the source list to the head of the destination.
+// Both keys must be on the same instance. Each key is placed on the instance mapped to it or holding it,
+// or else on its owner in the hash ring. If the two are placed differently, errCrossInstance is returned
+// without running the command. If neither can be placed, the source is discovered as for BLPop.
+func (r *ProxyConn) BRPopLPush(src, dst string, timeout time.Duration) (string, error) {
+	return r.BRPopLPushContext(context.Background(), src, dst, timeout)
+}
+
+// BRPopLPushContext moves as for BRPopLPush, but returns the context error if the context ends first.
+func (r *ProxyConn) BRPopLPushContext(ctx context.Context, src, dst string, timeout time.Duration) (string, error) {
+	block, err := r.blockTimeout(ctx, r.topology(), timeout)
+	if err != nil {
+		return "", err
+	}
+	return r.move(ctx, NewRedisCmd("BRPOPLPUSH", src, dst, block), dst)
+}
+
+// BLMove implements BLMOVE, atomically moving an element from one end of the source list to one end of the
+// destination. The ends are "LEFT" or "RIGHT". Keys are placed as for BRPopLPush. BLMOVE requires Redis 6.2.
+func (r *ProxyConn) BLMove(src, dst, whereFrom, whereTo string, timeout time.Duration) (string, error) {
+	return r.BLMoveContext(context.Background(), src, dst, whereFrom, whereTo, timeout)
+}
+
+// BLMoveContext moves as for BLMove, but returns the context error if the context ends first.
+func (r *ProxyConn) BLMoveContext(ctx context.Context, src, dst, whereFrom, whereTo string, timeout time.Duration) (string, error) {
+	block, err := r.blockTimeout(ctx, r.topology(), timeout)
+	if err != nil {
+		return "", err
+	}
+	return r.move(ctx, NewRedisCmd("BLMOVE", src, dst, whereFrom, whereTo, block), dst)
+}
+
+// Runs a blocking list move on the instance that both its source and destination keys are placed on.
+// If neither key can be placed, the move is discovered instead.
+func (r *ProxyConn) move(ctx context.Context, cmd *RedisCmd, dst string) (string, error) {
+	var v interface{}
+	placed := false
+	err := r.retrying(ctx, cmd.name, cmd.key, func() (err error) {
+		v, placed, err = r.movePlaced(ctx, cmd, dst)
+		return err
+	})
+	if err == nil && !placed {
+		v, err = r.doRouted(ctx, cmd, func(v interface{}) bool { return v != nil })
+	}
 	if err != nil {
 		return "", err
 	}
 
-	// This check is required for the case where the key has been mapped, but we still get a timeout.
-	if r, ok := v.([]interface{}); ok {
-		return string(r[1].([]byte)), nil
+	if v == nil {
+		return "", &TimeoutError{Command: cmd.name}
+	}
+
+	if pool, ok := r.lookup(cmd.key); ok {
+		r.mapKey(dst, pool)
 	}
 
-	return "", errors.New("BLPOP timed out.")
+	return reply.String(v, nil)
 }
 
-// Promote turns slave instances into masters by issuing the "SLAVEOF NO ONE" command to each.
-// The number of successfully issued commands is returned.
-func (r *ProxyConn) Promote() (int, error) {
-	i := 0
+// Runs a blocking list move once on the instance its keys are placed on, mapping the source key there if an element
+// is moved. False is returned, and nothing is run, if neither key can be placed.
+func (r *ProxyConn) movePlaced(ctx context.Context, cmd *RedisCmd, dst string) (interface{}, bool, error) {
+	srcPool, srcOK, err := r.place(cmd.key)
+	if err != nil {
+		return nil, false, err
+	}
+	dstPool, dstOK, err := r.place(dst)
+	if err != nil {
+		return nil, false, err
+	}
 
-	for _, pool := range r.Pools {
-		c := pool.Get()
-		defer c.Close()
+	if srcOK && dstOK && srcPool != dstPool {
+		return nil, false, errCrossInstance
+	}
+	if !srcOK && !dstOK {
+		return nil, false, nil
+	}
 
-		if _, err := c.Do("SLAVEOF", "NO", "ONE"); err != nil {
-			return i, err
-		}
+	pool := srcPool
+	if !srcOK {
+		pool = dstPool
+	}
 
-		i++
+	c := pool.Get()
+	defer c.Close()
+	v, err := r.runContext(ctx, c, cmd)
+	if err == nil && v != nil {
+		r.mapKey(cmd.key, pool)
 	}
+	return v, true, err
+}
 
-	return i, nil
+// Promote turns slave instances into masters by issuing the "SLAVEOF NO ONE" command to each that is not
+// already a master, as for PromoteVerified, stopping at the first failure.
+// The number of instances that are masters once the run ends is returned.
+//
+// Deprecated: Use PromoteVerified, which reports the outcome on each instance by name.
+func (r *ProxyConn) Promote() (int, error) {
+	return r.PromoteContext(context.Background())
+}
+
+// PromoteContext promotes instances as for Promote, stopping before the next instance once the context ends.
+//
+// Deprecated: Use PromoteVerified, which reports the outcome on each instance by name.
+func (r *ProxyConn) PromoteContext(ctx context.Context) (int, error) {
+	res, err := r.PromoteVerified(ctx, InstanceOptions{})
+
+	n := 0
+	for _, p := range res {
+		if p.Outcome == PromotePromoted || p.Outcome == PromoteAlreadyMaster {
+			n++
+		}
+	}
+	return n, err
 }
 
 // BGSave runs a background save on each instance, sleeping for the input duration between each save.
 // The number of successfully issued BGSAVE commands is returned.
 // This is usefull to ensure that multiple large Redis instances don't fork at once to persist to disk.
 // Remember to disable persistence in configuration when using this feature.
+// BGSaveAndWait instead waits for each save to complete before starting the next, and BGSaveStaggered offers
+// other strategies. Both report the outcome on each instance by name.
 func (r *ProxyConn) BGSave(interval time.Duration) (int, error) {
+	return r.BGSaveContext(context.Background(), interval)
+}
+
+// BGSaveContext saves instances as for BGSave, but stops without starting further saves once the context ends.
+func (r *ProxyConn) BGSaveContext(ctx context.Context, interval time.Duration) (int, error) {
+	if err := r.guardAdmin(ctx, "BGSAVE"); err != nil {
+		return 0, err
+	}
+
 	i := 0
 
-	for _, pool := range r.Pools {
+	for _, pool := range r.topology().pools {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+
 		c := pool.Get()
 		defer c.Close()
 
@@ -74,7 +301,11 @@ func (r *ProxyConn) BGSave(interval time.Duration) (int, error) {
 		}
 
 		i++
-		time.Sleep(interval)
+		select {
+		case <-ctx.Done():
+			return i, ctx.Err()
+		case <-time.After(interval):
+		}
 	}
 
 	return i, nil
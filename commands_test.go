@@ -1,6 +1,8 @@
 package twunproxy
 
 import (
+	"bytes"
+	"context"
 	"github.com/golang/mock/gomock"
 	"testing"
 	"time"
@@ -98,9 +100,13 @@ func TestPromoteExecutesAgainstEachPool(t *testing.T) {
 
 	mockConn1, mockPool1 := setupMockPool(ctrl)
 	mockConn2, mockPool2 := setupMockPool(ctrl)
-	mockConn1.EXPECT().Do("SLAVEOF", "NO", "ONE").Return(interface{}("+OK\r\n"), nil)
+	gomock.InOrder(
+		mockConn1.EXPECT().Do("INFO", "replication").Return("role:slave\r\n", nil),
+		mockConn1.EXPECT().Do("SLAVEOF", "NO", "ONE").Return(interface{}("+OK\r\n"), nil),
+		mockConn1.EXPECT().Do("INFO", "replication").Return("role:master\r\n", nil),
+	)
 	mockConn1.EXPECT().Close()
-	mockConn2.EXPECT().Do("SLAVEOF", "NO", "ONE").Return(interface{}("+OK\r\n"), nil)
+	mockConn2.EXPECT().Do("INFO", "replication").Return("role:master\r\n", nil)
 	mockConn2.EXPECT().Close()
 
 	c, err := getMockProxy(mockPool1, mockPool2).Promote()
@@ -135,3 +141,221 @@ func TestBGSaveExecutesAgainstEachPool(t *testing.T) {
 		t.Fatalf("Incorrect number of commands issued: %d", c)
 	}
 }
+
+func TestBGSaveContextStopsWhenCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	_, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("BGSAVE").Return(interface{}("+OK\r\n"), nil)
+	mockConn1.EXPECT().Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	c, err := getMockProxy(mockPool1, mockPool2).BGSaveContext(ctx, time.Minute)
+	if err != context.DeadlineExceeded || c != 1 {
+		t.Fatalf("Unexpected result: %d, %v", c, err)
+	}
+}
+
+func TestSingleConnectionExtantKeyBRPopReturnsCorrectly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("BRPOP", "KEY", float64(1)).Return([]interface{}{[]byte("KEY"), []byte("VAL")}, nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	if v, err := proxy.BRPop("KEY", time.Second); err != nil || v != "VAL" {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestBLPopKeyValueReturnsKeyAndReportsTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	gomock.InOrder(
+		mockConn.EXPECT().Do("BLPOP", "KEY", float64(1)).Return([]interface{}{[]byte("KEY"), []byte("VAL")}, nil),
+		mockConn.EXPECT().Do("BLPOP", "KEY", float64(1)).Return(nil, nil),
+	)
+	mockConn.EXPECT().Close().Times(2)
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	if kv, ok, err := proxy.BLPopKeyValue("KEY", time.Second); err != nil || !ok || kv != (KeyValue{Key: "KEY", Value: "VAL"}) {
+		t.Fatalf("Unexpected result: %v, %v, %v", kv, ok, err)
+	}
+	if _, ok, err := proxy.BLPopKeyValue("KEY", time.Second); err != nil || ok {
+		t.Fatalf("Expected a timeout without error, got %v, %v", ok, err)
+	}
+}
+
+func TestBLPopWithZeroTimeoutReissuesUntilPopped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	slice := blockForeverSlice.Seconds()
+	gomock.InOrder(
+		mockConn.EXPECT().Do("BLPOP", "KEY", slice).Return(nil, nil).Times(2),
+		mockConn.EXPECT().Do("BLPOP", "KEY", slice).Return([]interface{}{[]byte("KEY"), []byte("VAL")}, nil),
+	)
+	mockConn.EXPECT().Close().Times(3)
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	if v, err := proxy.BLPop("KEY", 0); err != nil || v != "VAL" {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestBRPopLPushFailsForKeysOnDifferentInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockPool1 := setupMockPool(ctrl)
+	_, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.KeyInstance["SRC"] = mockPool1
+	proxy.KeyInstance["DST"] = mockPool2
+
+	if _, err := proxy.BRPopLPush("SRC", "DST", time.Second); err != errCrossInstance {
+		t.Fatalf("Expected cross-instance error, got %v", err)
+	}
+}
+
+func TestBLMoveRunsOnSourceInstanceAndMapsDestination(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	// The destination does not exist yet and there is no ring, so it follows the source.
+	mockConn1.EXPECT().Do("EXISTS", "DST").Return(int64(0), nil)
+	mockConn2.EXPECT().Do("EXISTS", "DST").Return(int64(0), nil)
+	mockConn1.EXPECT().Do("BLMOVE", "SRC", "DST", "LEFT", "RIGHT", float64(1)).Return([]byte("VAL"), nil)
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.KeyInstance["SRC"] = mockPool1
+
+	if v, err := proxy.BLMove("SRC", "DST", "LEFT", "RIGHT", time.Second); err != nil || v != "VAL" {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+	if proxy.KeyInstance["DST"] != mockPool1 {
+		t.Fatal("Expected destination to be mapped to the source instance.")
+	}
+}
+
+func TestBLPopContextClampsTimeoutToDeadline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	mockConn.EXPECT().Do("INFO", "server").Return([]byte("redis_version:7.2.4\r\n"), nil)
+	mockConn.EXPECT().Do("BLPOP", "KEY", gomock.Any()).DoAndReturn(func(name string, args ...interface{}) (interface{}, error) {
+		if block := args[1].(float64); block <= 0 || block > 1 {
+			t.Errorf("Expected timeout clamped to the deadline, got %v", block)
+		}
+		return []interface{}{[]byte("KEY"), []byte("v")}, nil
+	})
+	mockConn.EXPECT().Close().Times(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if v, err := proxy.BLPopContext(ctx, "KEY", time.Minute); err != nil || v != "v" {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestBlockTimeoutFailsAfterDeadline(t *testing.T) {
+	proxy := getMockProxy()
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	if _, err := proxy.blockTimeout(ctx, proxy.topology(), 0); err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline error, got %v", err)
+	}
+	if block, err := proxy.blockTimeout(context.Background(), proxy.topology(), 0); err != nil || block != float64(0) {
+		t.Fatalf("Expected an unbounded timeout without a deadline, got %v, %v", block, err)
+	}
+}
+
+func TestBlockTimeoutRoundsForOldVersions(t *testing.T) {
+	old := connPool{&nilStyleConn{reply: []byte("redis_version:5.0.14\r\n")}}
+	proxy := getMockProxy(old)
+	top := &topology{pools: []ConnGetter{old}}
+
+	if block, _ := proxy.blockTimeout(context.Background(), top, 1500*time.Millisecond); block != int64(2) {
+		t.Fatalf("Expected timeout rounded up, got %v", block)
+	}
+
+	WithTimeoutRounding(RoundDown)(proxy)
+	if block, _ := proxy.blockTimeout(context.Background(), top, 300*time.Millisecond); block != int64(1) {
+		t.Fatalf("Expected timeout rounded down to at least a second, got %v", block)
+	}
+
+	proxy.versions[old] = redisVersion{6, 2, 0}
+	if block, _ := proxy.blockTimeout(context.Background(), top, 300*time.Millisecond); block != 0.3 {
+		t.Fatalf("Expected fractional timeout for Redis 6, got %v", block)
+	}
+}
+
+func TestDoKeyDiscoversInstanceWithNonEmptyReply(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("LRANGE", "KEY", 0, -1).Return([]interface{}{}, nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("LRANGE", "KEY", 0, -1).Return([]interface{}{[]byte("a")}, nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	v, err := proxy.DoKey(context.Background(), "LRANGE", "KEY", 0, -1)
+	if err != nil || len(v.([]interface{})) != 1 {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+	if proxy.KeyInstance["KEY"] != mockPool2 {
+		t.Fatal("Expected the key to be mapped to the instance holding it.")
+	}
+}
+
+func TestBLPopBytesPreservesBinaryKeysAndValues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	key := []byte{0xff, 0x00, 'k'}
+	value := []byte{0x00, 0xfe, 0x01}
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("BLPOP", string(key), 5.0).Return(nil, nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("BLPOP", string(key), 5.0).Return([]interface{}{key, value}, nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	if v, err := proxy.BLPopBytes(key, 5*time.Second); err != nil || !bytes.Equal(v, value) {
+		t.Fatalf("Expected binary value, got %v and %v", v, err)
+	}
+	if pool, ok := proxy.lookup(string(key)); !ok || pool != mockPool2 {
+		t.Fatal("Expected binary key to be mapped to the instance holding it.")
+	}
+}
@@ -0,0 +1,70 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+)
+
+// InstanceConfig holds the configuration parameters of a single instance matching a CONFIG GET pattern.
+type InstanceConfig struct {
+	Server string            `json:"server"`
+	Values map[string]string `json:"values"`
+	Err    error             `json:"-"`
+}
+
+// ConfigGet issues CONFIG GET for the input parameter, which may be a glob pattern, on every instance concurrently
+// and returns the matching parameters of each. Instances that fail carry their error, and the first error is returned
+// with the results. Comparing the values shows instances that have drifted from the rest of the fleet.
+func (r *ProxyConn) ConfigGet(param string) ([]InstanceConfig, error) {
+	t := r.topology()
+	res := make([]InstanceConfig, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("CONFIG", "GET", param)
+		if err != nil {
+			return err
+		}
+
+		reply, ok := v.([]interface{})
+		if !ok || len(reply)%2 != 0 {
+			return errors.New("Unexpected reply to CONFIG GET.")
+		}
+
+		res[i].Values = make(map[string]string, len(reply)/2)
+		for j := 0; j < len(reply); j += 2 {
+			k, _ := replyString(reply[j])
+			res[i].Values[k], _ = replyString(reply[j+1])
+		}
+		return nil
+	})
+
+	for i, err := range errs {
+		res[i].Server = t.server(i)
+		res[i].Err = err
+	}
+	return res, r.fanOutError(t, errs)
+}
+
+// ConfigSet issues CONFIG SET for the input parameter and value on every instance concurrently and reports on each.
+// Every instance is attempted even if some fail; the first error is returned with the results.
+// Settings are not persisted to the instances' configuration files; follow with CONFIG REWRITE to keep them.
+func (r *ProxyConn) ConfigSet(param, value string) ([]InstanceResult, error) {
+	return r.ConfigSetContext(context.Background(), param, value)
+}
+
+// ConfigSetContext issues CONFIG SET as for ConfigSet, returning the context error for instances not answering
+// before the context ends.
+func (r *ProxyConn) ConfigSetContext(ctx context.Context, param, value string) ([]InstanceResult, error) {
+	res, err := r.eachInstance(ctx, InstanceOptions{Continue: true}, Stagger{Concurrency: 1},
+		"CONFIG", "SET", param, value)
+	if err != nil {
+		return res, err
+	}
+
+	for _, ir := range res {
+		if ir.Err != nil {
+			return res, ir.Err
+		}
+	}
+	return res, nil
+}
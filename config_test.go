@@ -0,0 +1,89 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"strings"
+	"testing"
+)
+
+func TestParsePoolConfigReturnsNamedPool(t *testing.T) {
+	data := []byte("alpha:\n  hash: fnv1a_64\n  servers:\n   - 10.0.0.1:6379:1\n   - 10.0.0.2:6379:1\nbeta:\n  servers:\n   - 10.0.1.1:6379:1\n")
+
+	conf, err := ParsePoolConfig(data, "alpha")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if conf.Name != "alpha" || conf.Hash != "fnv1a_64" || len(conf.Servers) != 2 {
+		t.Fatalf("Unexpected configuration: %+v", conf)
+	}
+
+	if conf, err = ParsePoolConfig(data, "gamma"); err != nil || len(conf.Servers) != 0 {
+		t.Fatalf("Expected missing pool to have no servers, got %+v, %v", conf, err)
+	}
+	if _, err = ParsePoolConfig([]byte("alpha: ["), "alpha"); err == nil {
+		t.Fatal("Expected error for invalid configuration.")
+	}
+}
+
+func TestNewProxyConnFromReaderCreatesPools(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("PING").Return("PONG", nil).Times(2)
+	mockConn.EXPECT().Close().Times(2)
+
+	var created []string
+	create := func(desc, auth string) ConnGetter {
+		created = append(created, desc)
+		return mockPool
+	}
+
+	conf := "alpha:\n  servers:\n   - 10.0.0.1:6379:1\n   - 10.0.0.2:6379:1\n"
+	proxy, err := NewProxyConnFromReader(strings.NewReader(conf), "alpha", 0, create)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(proxy.Pools) != 2 || proxy.topology().server(1) != "10.0.0.2:6379" {
+		t.Fatalf("Unexpected pools: %v", proxy.Servers)
+	}
+
+	// Reloading applies the same configuration, which changes nothing.
+	if err := proxy.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(created) != 2 {
+		t.Fatalf("Unexpected pools created: %v", created)
+	}
+}
+
+func TestNewProxyConnFromConfigUsesStruct(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("PING").Return("PONG", nil)
+	mockConn.EXPECT().Close()
+
+	var auth string
+	create := func(desc, a string) ConnGetter {
+		auth = a
+		return mockPool
+	}
+
+	conf := PoolConfig{Name: "alpha", Servers: []string{"10.0.0.1:6379:1"}, Auth: "secret"}
+	proxy, err := NewProxyConnFromConfig(conf, 0, create)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(proxy.Pools) != 1 || auth != "secret" {
+		t.Fatalf("Unexpected pools %v with auth %q", proxy.Servers, auth)
+	}
+}
+
+func TestNewProxyConnFromBytesFailsForPoolWithNoServers(t *testing.T) {
+	create := func(desc, auth string) ConnGetter { return nil }
+	if _, err := NewProxyConnFromBytes([]byte("alpha:\n  servers:\n"), "alpha", 0, create); err != errNoServers {
+		t.Fatalf("Expected no servers error, got %v", err)
+	}
+}
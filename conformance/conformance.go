@@ -0,0 +1,200 @@
+// Package conformance validates user-written Redis client adapters against the behaviour twunproxy relies on.
+// Call Run from a test in the adapter's package, with a pool connected to a disposable Redis instance,
+// real or in-memory such as miniredis.
+package conformance
+
+import (
+	"fmt"
+	"github.com/txodds/twunproxy"
+	"sync"
+	"testing"
+	"time"
+)
+
+// KeyPrefix is the prefix of every key written by the suite. Keys are deleted when each check completes.
+const KeyPrefix = "twunproxy:conformance:"
+
+// Run runs each conformance check as a subtest against connections from the input pool.
+// Any errors that the adapter's client library returns for nil replies, and that the adapter does not identify by
+// implementing twunproxy.NilReplier, must be supplied as nil errors. These correspond to twunproxy.WithNilErrors.
+func Run(t *testing.T, pool twunproxy.ConnGetter, nilErrors ...error) {
+	s := &suite{pool: pool, nilErrors: nilErrors}
+
+	t.Run("ErrorMapping", s.errorMapping)
+	t.Run("NilHandling", s.nilHandling)
+	t.Run("BlockingCommands", s.blockingCommands)
+	t.Run("ConcurrentGet", s.concurrentGet)
+}
+
+type suite struct {
+	pool      twunproxy.ConnGetter
+	nilErrors []error
+}
+
+// Runs a command on a new connection from the pool.
+func (s *suite) do(cmd string, args ...interface{}) (interface{}, error) {
+	c := s.pool.Get()
+	defer c.Close()
+	return c.Do(cmd, args...)
+}
+
+// Deletes the input keys, failing the test if that is not possible.
+func (s *suite) cleanup(t *testing.T, keys ...string) {
+	t.Cleanup(func() {
+		args := make([]interface{}, len(keys))
+		for i, k := range keys {
+			args[i] = k
+		}
+		if _, err := s.do("DEL", args...); err != nil {
+			t.Errorf("Deleting conformance keys: %v", err)
+		}
+	})
+}
+
+// Redis errors must be returned as errors, not replies, and must not leave the pool unusable.
+func (s *suite) errorMapping(t *testing.T) {
+	if v, err := s.do("TWUNPROXY.NOSUCHCOMMAND"); err == nil {
+		t.Fatalf("Unknown command returned reply %v without an error.", v)
+	}
+
+	key := KeyPrefix + "list"
+	s.cleanup(t, key)
+	if _, err := s.do("RPUSH", key, "a"); err != nil {
+		t.Fatalf("RPUSH: %v", err)
+	}
+	if v, err := s.do("GET", key); err == nil {
+		t.Fatalf("GET against a list returned reply %v without an error.", v)
+	}
+
+	if _, err := s.do("PING"); err != nil {
+		t.Fatalf("PING after error replies: %v", err)
+	}
+}
+
+// Nil bulk and nil array replies must be recognisable as nil, so that canMap predicates reject them.
+func (s *suite) nilHandling(t *testing.T) {
+	key := KeyPrefix + "missing"
+	s.cleanup(t, key)
+
+	c := s.pool.Get()
+	defer c.Close()
+
+	if v, err := c.Do("GET", key); !twunproxy.IsNilReply(c, v, err, s.nilErrors...) {
+		t.Fatalf("GET of a missing key is not a nil reply: %#v, %v", v, err)
+	}
+
+	if v, err := c.Do("EXISTS", key); err != nil || v == nil {
+		t.Fatalf("EXISTS of a missing key must return a non-nil integer reply: %#v, %v", v, err)
+	}
+}
+
+// Blocking commands must honour their timeout with a nil reply and must not block other connections.
+func (s *suite) blockingCommands(t *testing.T) {
+	key := KeyPrefix + "queue"
+	s.cleanup(t, key)
+
+	c := s.pool.Get()
+	defer c.Close()
+
+	start := time.Now()
+	v, err := c.Do("BLPOP", key, 1)
+	if !twunproxy.IsNilReply(c, v, err, s.nilErrors...) {
+		t.Fatalf("BLPOP timeout is not a nil reply: %#v, %v", v, err)
+	}
+	if d := time.Since(start); d < 500*time.Millisecond || d > 5*time.Second {
+		t.Fatalf("BLPOP with a 1s timeout returned after %v.", d)
+	}
+
+	// Push from a second connection while the first is blocked.
+	res := make(chan error, 1)
+	go func() {
+		v, err := c.Do("BLPOP", key, 5)
+		if err == nil {
+			err = checkPopped(v, key, "value")
+		}
+		res <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := s.do("RPUSH", key, "value"); err != nil {
+		t.Fatalf("RPUSH while another connection is blocked: %v", err)
+	}
+
+	select {
+	case err := <-res:
+		if err != nil {
+			t.Fatalf("BLPOP: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("BLPOP did not return after a value was pushed.")
+	}
+}
+
+// Checks that a BLPOP reply is an array of the input key and value, as bulk or simple strings.
+func checkPopped(v interface{}, key, val string) error {
+	items, ok := v.([]interface{})
+	if !ok || len(items) != 2 {
+		return fmt.Errorf("Reply %#v is not a two-element array.", v)
+	}
+
+	for i, want := range []string{key, val} {
+		var got string
+		switch s := items[i].(type) {
+		case []byte:
+			got = string(s)
+		case string:
+			got = s
+		}
+		if got != want {
+			return fmt.Errorf("Reply element %d is %#v, not %q.", i, items[i], want)
+		}
+	}
+	return nil
+}
+
+// Get must be safe for concurrent use and must not hand the same connection to two callers at once.
+func (s *suite) concurrentGet(t *testing.T) {
+	const n = 50
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%sconcurrent:%d", KeyPrefix, i)
+	}
+	s.cleanup(t, keys...)
+
+	errs := make(chan error, n)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			c := s.pool.Get()
+			defer c.Close()
+
+			val := fmt.Sprintf("value:%d", i)
+			if _, err := c.Do("SET", keys[i], val); err != nil {
+				errs <- err
+				return
+			}
+
+			v, err := c.Do("GET", keys[i])
+			if err != nil {
+				errs <- err
+				return
+			}
+			if got, ok := v.([]byte); ok && string(got) == val {
+				return
+			}
+			if got, ok := v.(string); ok && got == val {
+				return
+			}
+			errs <- fmt.Errorf("GET %s returned %#v, not %q.", keys[i], v, val)
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,30 @@
+package conformance
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+	"github.com/txodds/twunproxy"
+	"testing"
+)
+
+// Wraps a redigo pool as in the example, which is the reference adapter.
+type redigoPool struct {
+	wrapped *redis.Pool
+}
+
+func (p *redigoPool) Get() twunproxy.Conn {
+	return p.wrapped.Get()
+}
+
+func TestRedigoAdapterConforms(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	}
+	defer pool.Close()
+
+	Run(t, &redigoPool{wrapped: pool})
+}
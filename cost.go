@@ -0,0 +1,194 @@
+package twunproxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultQuotaWindow is the period over which quotas are enforced, if a quota does not set one.
+const DefaultQuotaWindow = time.Minute
+
+// The context key holding the cost label of a command.
+type costLabelKey struct{}
+
+// WithCostLabel returns a context labelling the commands issued with it, such as by tenant or feature,
+// so that their cost is accounted to the label and its quota enforced.
+func WithCostLabel(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, costLabelKey{}, label)
+}
+
+// CostLabel returns the cost label of the input context, or an empty string if it has none.
+func CostLabel(ctx context.Context) string {
+	label, _ := ctx.Value(costLabelKey{}).(string)
+	return label
+}
+
+// Cost is the approximate cost of the commands issued under a label: their number and the bytes of their arguments
+// and replies. Bytes are counted from the values exchanged rather than the wire protocol, so exclude framing.
+type Cost struct {
+	Commands int64 `json:"commands"`
+	BytesOut int64 `json:"bytes_out"`
+	BytesIn  int64 `json:"bytes_in"`
+}
+
+// Quota limits the cost that a label may incur in each window. Zero limits are unlimited.
+type Quota struct {
+	Commands int64
+	BytesOut int64
+	BytesIn  int64
+	Window   time.Duration
+}
+
+// QuotaError is returned for a command whose label has used up its quota for the current window.
+// The command is not sent to any instance.
+type QuotaError struct {
+	Label  string
+	Limit  string
+	Window time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("Quota for %q exceeded: %s limit reached for the current %s window.", e.Label, e.Limit, e.Window)
+}
+
+// Accounts for the cost of commands per label and enforces their quotas.
+type costAccount struct {
+	mu      sync.Mutex
+	quotas  map[string]Quota
+	def     Quota
+	totals  map[string]*Cost
+	windows map[string]*costWindow
+}
+
+// The cost incurred by a label in the current quota window.
+type costWindow struct {
+	start time.Time
+	used  Cost
+}
+
+// WithCostAccounting accounts for the cost of commands issued through DoContext and the blocking helpers, per the
+// label of their context, and enforces the input quotas. Labels without a quota of their own are held to the default,
+// which may be the zero Quota for none. Commands without a label are accounted under an empty label.
+// Commands rejected by a quota fail with a QuotaError and are counted as "quota_rejections".
+// A command is admitted if its label is under quota when it starts, so a large reply may overshoot the byte limits.
+func WithCostAccounting(quotas map[string]Quota, def Quota) Option {
+	return func(r *ProxyConn) {
+		r.costs = &costAccount{
+			quotas:  quotas,
+			def:     def,
+			totals:  make(map[string]*Cost),
+			windows: make(map[string]*costWindow),
+		}
+	}
+}
+
+// Costs returns the total cost incurred by each label since cost accounting was configured.
+func (r *ProxyConn) Costs() map[string]Cost {
+	res := make(map[string]Cost)
+	if r.costs == nil {
+		return res
+	}
+
+	r.costs.mu.Lock()
+	defer r.costs.mu.Unlock()
+	for label, c := range r.costs.totals {
+		res[label] = *c
+	}
+	return res
+}
+
+// Returns a QuotaError if the label has used up its quota for the current window.
+func (a *costAccount) admit(label string) error {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	q, ok := a.quotas[label]
+	if !ok {
+		q = a.def
+	}
+	if q.Window <= 0 {
+		q.Window = DefaultQuotaWindow
+	}
+
+	w := a.window(label, q.Window)
+	switch {
+	case q.Commands > 0 && w.used.Commands >= q.Commands:
+		return &QuotaError{Label: label, Limit: "command", Window: q.Window}
+	case q.BytesOut > 0 && w.used.BytesOut >= q.BytesOut:
+		return &QuotaError{Label: label, Limit: "bytes out", Window: q.Window}
+	case q.BytesIn > 0 && w.used.BytesIn >= q.BytesIn:
+		return &QuotaError{Label: label, Limit: "bytes in", Window: q.Window}
+	}
+	return nil
+}
+
+// Adds the cost of the input command and its reply to the label.
+func (a *costAccount) charge(label string, cmd *RedisCmd, v interface{}) {
+	if a == nil {
+		return
+	}
+
+	c := Cost{Commands: 1, BytesIn: replySize(v)}
+	for _, arg := range cmd.getArgs() {
+		c.BytesOut += replySize(arg)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	total, ok := a.totals[label]
+	if !ok {
+		total = new(Cost)
+		a.totals[label] = total
+	}
+	total.add(c)
+
+	if w, ok := a.windows[label]; ok {
+		w.used.add(c)
+	}
+}
+
+// Returns the current window of the label, starting a new one if the last has ended. The mutex must be held.
+func (a *costAccount) window(label string, d time.Duration) *costWindow {
+	w, ok := a.windows[label]
+	if !ok || time.Since(w.start) >= d {
+		w = &costWindow{start: time.Now()}
+		a.windows[label] = w
+	}
+	return w
+}
+
+// Adds the input cost to this one.
+func (c *Cost) add(o Cost) {
+	c.Commands += o.Commands
+	c.BytesOut += o.BytesOut
+	c.BytesIn += o.BytesIn
+}
+
+// Returns the approximate size in bytes of a command argument or reply: the length of strings and the sum of
+// the sizes of array elements. Integers count as 8 bytes and nil as none.
+func replySize(v interface{}) int64 {
+	switch t := v.(type) {
+	case nil:
+		return 0
+	case []byte:
+		return int64(len(t))
+	case string:
+		return int64(len(t))
+	case []interface{}:
+		var n int64
+		for _, e := range t {
+			n += replySize(e)
+		}
+		return n
+	case int, int64, uint64, float64:
+		return 8
+	}
+	return int64(len(fmt.Sprint(v)))
+}
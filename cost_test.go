@@ -0,0 +1,39 @@
+package twunproxy
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCostAccountingChargesAndEnforcesQuota(t *testing.T) {
+	pool := connPool{&nilStyleConn{reply: []byte("value")}}
+	proxy := getMockProxy(pool)
+	proxy.KeyInstance["KEY"] = pool
+	WithCostAccounting(map[string]Quota{"tenant": {Commands: 2}}, Quota{})(proxy)
+
+	ctx := WithCostLabel(context.Background(), "tenant")
+	canMap := func(v interface{}) bool { return v != nil }
+	for i := 0; i < 2; i++ {
+		if _, err := proxy.DoContext(ctx, NewRedisCmd("GET", "KEY"), canMap); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	_, err := proxy.DoContext(ctx, NewRedisCmd("GET", "KEY"), canMap)
+	if qe, ok := err.(*QuotaError); !ok || qe.Label != "tenant" || qe.Limit != "command" {
+		t.Fatalf("Expected quota error, got %v", err)
+	}
+
+	// Other labels are held to the default, which is unlimited.
+	if _, err := proxy.Do(NewRedisCmd("GET", "KEY"), canMap); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	costs := proxy.Costs()
+	if c := costs["tenant"]; c.Commands != 2 || c.BytesOut != 6 || c.BytesIn != 10 {
+		t.Fatalf("Unexpected tenant cost: %+v", c)
+	}
+	if costs[""].Commands != 1 {
+		t.Fatalf("Unexpected unlabelled cost: %+v", costs[""])
+	}
+}
@@ -0,0 +1,45 @@
+package twunproxy
+
+import (
+	"time"
+)
+
+// DeadLetter is a command that could not be routed to any instance, along with the reason.
+// This is either a failure to discover an instance for the key, or its instance being unavailable.
+// Args are the arguments other than the key, recorded unredacted so that the command can be persisted and replayed
+// by the application. KeyPos is the index among the arguments at which the key belongs, usually 0.
+type DeadLetter struct {
+	Time   time.Time     `json:"time"`
+	Name   string        `json:"name"`
+	Key    string        `json:"key"`
+	Args   []interface{} `json:"args"`
+	KeyPos int           `json:"key_pos,omitempty"`
+	Err    error         `json:"-"`
+}
+
+// DeadLetterChan returns a dead-letter handler that sends to the input channel.
+// Sends never block; if the channel is full the dead letter is dropped.
+func DeadLetterChan(ch chan<- DeadLetter) func(DeadLetter) {
+	return func(d DeadLetter) {
+		select {
+		case ch <- d:
+		default:
+		}
+	}
+}
+
+// Passes the input command and the reason it could not be routed to the dead-letter handler, if one is configured.
+func (r *ProxyConn) deadLetter(cmd *RedisCmd, err error) {
+	if r.onDeadLetter == nil {
+		return
+	}
+
+	r.onDeadLetter(DeadLetter{
+		Time:   time.Now(),
+		Name:   cmd.name,
+		Key:    cmd.key,
+		Args:   cmd.args,
+		KeyPos: cmd.keyPos,
+		Err:    err,
+	})
+}
@@ -0,0 +1,40 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestDoSendsUnroutableCommandToDeadLetter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("CMD", "KEY", "A1", "A2").Return(nil, nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("CMD", "KEY", "A1", "A2").Return(nil, nil)
+	mockConn2.EXPECT().Close()
+
+	ch := make(chan DeadLetter, 1)
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithDeadLetter(DeadLetterChan(ch))(proxy)
+
+	if _, err := proxy.Do(getRedisCmd(), func(v interface{}) bool { return v != nil }); err == nil {
+		t.Fatal("Expected error for unroutable command.")
+	}
+
+	select {
+	case d := <-ch:
+		if d.Name != "CMD" || d.Key != "KEY" || len(d.Args) != 2 || d.Err == nil {
+			t.Fatalf("Unexpected dead letter: %+v", d)
+		}
+	default:
+		t.Fatal("Expected dead letter.")
+	}
+}
+
+func TestDeadLetterChanDoesNotBlockWhenFull(t *testing.T) {
+	f := DeadLetterChan(make(chan DeadLetter))
+	f(DeadLetter{Name: "CMD"})
+}
@@ -0,0 +1,72 @@
+package twunproxy
+
+import (
+	"errors"
+	"time"
+)
+
+// Returned by DeleteByPattern for an empty pattern.
+var errNoDeletePattern = errors.New("A pattern is required to delete keys; use FlushAll to delete every key.")
+
+// DeleteByPattern scans every instance concurrently for keys matching the input pattern and deletes them with UNLINK,
+// in batches of up to the input size, pausing for the throttle interval between batches so that the sweep does not
+// starve other clients. Batch is also the COUNT hint for SCAN, and defaults to the usual scan size if below 1.
+// Mappings of deleted keys are removed. The number of keys deleted is returned by server, including servers with
+// none, along with the first error, if any; instances that failed report the keys deleted before the failure.
+// This is for maintenance sweeps, such as clearing expired feeds, that Twemproxy cannot run since it does not
+// forward SCAN. UNLINK requires Redis 4.0 or later.
+// NOTE: Keys created during the sweep may or may not be deleted, as for SCAN.
+func (r *ProxyConn) DeleteByPattern(pattern string, batch int, throttle time.Duration) (map[string]int64, error) {
+	if pattern == "" {
+		return nil, errNoDeletePattern
+	}
+	if batch < 1 {
+		batch = scanCount
+	}
+
+	t := r.topology()
+	deleted := make([]int64, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		first := true
+		return scanKeys(c, pattern, batch, func(keys []string) error {
+			for len(keys) > 0 {
+				n := batch
+				if n > len(keys) {
+					n = len(keys)
+				}
+
+				if !first && throttle > 0 {
+					time.Sleep(throttle)
+				}
+				first = false
+
+				args := make([]interface{}, n)
+				for j, k := range keys[:n] {
+					args[j] = k
+				}
+				v, err := c.Do("UNLINK", args...)
+				removed, err := intReply("UNLINK", v, err)
+				if err != nil {
+					return err
+				}
+				deleted[i] += removed
+
+				for _, k := range keys[:n] {
+					r.unmap(k)
+				}
+				keys = keys[n:]
+			}
+			return nil
+		})
+	})
+
+	counts := make(map[string]int64, len(t.pools))
+	for i := range t.pools {
+		counts[t.server(i)] = deleted[i]
+		if deleted[i] > 0 {
+			r.counter("pattern_deletes", t.server(i), float64(deleted[i]))
+		}
+	}
+	return counts, firstError(errs)
+}
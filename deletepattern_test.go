@@ -0,0 +1,93 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestDeleteByPatternUnlinksInBatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.KeyInstance["feed:1"] = mockPool1
+	proxy.KeyInstance["other"] = mockPool1
+
+	page := func(cursor string, keys ...string) interface{} {
+		items := make([]interface{}, len(keys))
+		for i, k := range keys {
+			items[i] = []byte(k)
+		}
+		return []interface{}{[]byte(cursor), items}
+	}
+
+	gomock.InOrder(
+		mockConn1.EXPECT().Do("SCAN", "0", "MATCH", "feed:*", "COUNT", 2).Return(page("7", "feed:1", "feed:2", "feed:3"), nil),
+		mockConn1.EXPECT().Do("UNLINK", "feed:1", "feed:2").Return(int64(2), nil),
+		mockConn1.EXPECT().Do("UNLINK", "feed:3").Return(int64(0), nil),
+		mockConn1.EXPECT().Do("SCAN", "7", "MATCH", "feed:*", "COUNT", 2).Return(page("0", "feed:4"), nil),
+		mockConn1.EXPECT().Do("UNLINK", "feed:4").Return(int64(1), nil),
+	)
+	mockConn1.EXPECT().Close()
+
+	mockConn2.EXPECT().Do("SCAN", "0", "MATCH", "feed:*", "COUNT", 2).Return(page("0"), nil)
+	mockConn2.EXPECT().Close()
+
+	start := time.Now()
+	counts, err := proxy.DeleteByPattern("feed:*", 2, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("Expected batches to be throttled, took %v.", elapsed)
+	}
+
+	if len(counts) != 2 || counts["a:6379"] != 3 || counts["b:6379"] != 0 {
+		t.Fatalf("Unexpected counts: %v", counts)
+	}
+	if _, ok := proxy.KeyInstance["feed:1"]; ok {
+		t.Fatal("Expected the mapping of a deleted key to be removed.")
+	}
+	if _, ok := proxy.KeyInstance["other"]; !ok {
+		t.Fatal("Expected other mappings to be kept.")
+	}
+}
+
+func TestDeleteByPatternReportsPartialCounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.Servers = []string{"a:6379:1"}
+
+	page := []interface{}{[]byte("0"), []interface{}{[]byte("k1"), []byte("k2")}}
+	fail := errors.New("LOADING")
+	gomock.InOrder(
+		mockConn.EXPECT().Do("SCAN", "0", "MATCH", "k*", "COUNT", 1).Return(page, nil),
+		mockConn.EXPECT().Do("UNLINK", "k1").Return(int64(1), nil),
+		mockConn.EXPECT().Do("UNLINK", "k2").Return(nil, fail),
+	)
+	mockConn.EXPECT().Close()
+
+	counts, err := proxy.DeleteByPattern("k*", 1, 0)
+	if err != fail {
+		t.Fatalf("Expected the UNLINK error, got %v", err)
+	}
+	if counts["a:6379"] != 1 {
+		t.Fatalf("Unexpected counts: %v", counts)
+	}
+}
+
+func TestDeleteByPatternRequiresPattern(t *testing.T) {
+	proxy := getMockProxy()
+	if _, err := proxy.DeleteByPattern("", 100, 0); err != errNoDeletePattern {
+		t.Fatalf("Expected a pattern to be required, got %v", err)
+	}
+}
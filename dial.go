@@ -0,0 +1,15 @@
+package twunproxy
+
+import (
+	"github.com/txodds/twunproxy/dialer"
+)
+
+// DefaultHeadStart is the delay before each further address is tried by a HappyDialer, if none is configured.
+//
+// Deprecated: Use dialer.DefaultHeadStart.
+const DefaultHeadStart = dialer.DefaultHeadStart
+
+// HappyDialer dials every address of a host concurrently, keeping the first connection to succeed.
+//
+// Deprecated: Use dialer.HappyDialer, which this aliases.
+type HappyDialer = dialer.HappyDialer
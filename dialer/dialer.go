@@ -0,0 +1,155 @@
+// Package dialer provides dial functions for Redis instances. HappyDialer races the addresses of a host, and the others
+// reach instances through a SOCKS5 proxy or an SSH tunnel, for operators running admin tasks against production shards
+// from outside their network, such as from a bastion.
+// Each returns a DialFunc, which client libraries accept in place of net.Dial; for redigo pass it to redis.DialNetDial.
+package dialer
+
+import (
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+// DialFunc connects to the input address.
+type DialFunc func(network, addr string) (net.Conn, error)
+
+// Direct dials the address without a proxy.
+var Direct DialFunc = net.Dial
+
+// SOCKS5 returns a DialFunc connecting through the SOCKS5 proxy at the input address.
+// User and password are sent if user is not empty.
+func SOCKS5(addr, user, password string) (DialFunc, error) {
+	var auth *proxy.Auth
+	if user != "" {
+		auth = &proxy.Auth{User: user, Password: password}
+	}
+
+	d, err := proxy.SOCKS5("tcp", addr, auth, proxy.Direct)
+	if err != nil {
+		return nil, err
+	}
+	return d.Dial, nil
+}
+
+// SSHTunnel dials instances through an SSH connection to a bastion host, which is opened on first use and
+// shared by every connection. A broken SSH connection is re-established on the next dial.
+type SSHTunnel struct {
+	addr   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// NewSSHTunnel returns a tunnel through the SSH server at the input address, authenticating with the input config.
+func NewSSHTunnel(addr string, config *ssh.ClientConfig) *SSHTunnel {
+	return &SSHTunnel{addr: addr, config: config}
+}
+
+// NewSSHKeyTunnel returns a tunnel through the SSH server at the input address, authenticating as the input user
+// with the private key file at keyPath. Host keys are checked against the known_hosts file at knownHostsPath,
+// or not at all if it is empty, which should be reserved for testing. Hashed host names and @revoked keys are
+// honoured as by OpenSSH, and an error is returned if the file cannot be parsed.
+func NewSSHKeyTunnel(addr, user, keyPath, knownHostsPath string) (*SSHTunnel, error) {
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKey := ssh.InsecureIgnoreHostKey()
+	if knownHostsPath != "" {
+		if hostKey, err = knownhosts.New(knownHostsPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewSSHTunnel(addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKey,
+	}), nil
+}
+
+// Dial connects to the input address from the SSH server.
+func (t *SSHTunnel) Dial(network, addr string) (net.Conn, error) {
+	client, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := client.Dial(network, addr)
+	if err == nil {
+		return c, nil
+	}
+
+	// The SSH connection may have dropped; retry once on a fresh one.
+	t.reset(client)
+	if client, err = t.connect(); err != nil {
+		return nil, err
+	}
+	return client.Dial(network, addr)
+}
+
+// Close closes the SSH connection, if open. Connections made through it are closed too.
+func (t *SSHTunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == nil {
+		return nil
+	}
+	err := t.client.Close()
+	t.client = nil
+	return err
+}
+
+// Returns the SSH connection, opening it if needed.
+func (t *SSHTunnel) connect() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	client, err := ssh.Dial("tcp", t.addr, t.config)
+	if err != nil {
+		return nil, err
+	}
+	t.client = client
+	return client, nil
+}
+
+// Closes the input SSH connection and forgets it, unless it has already been replaced.
+func (t *SSHTunnel) reset(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == client {
+		client.Close()
+		t.client = nil
+	}
+}
+
+// PerBackend returns a DialFunc choosing a dial function by the address being dialed,
+// so that each backend may be reached its own way. Addresses without an entry use the fallback,
+// or Direct if it is nil.
+func PerBackend(dials map[string]DialFunc, fallback DialFunc) DialFunc {
+	if fallback == nil {
+		fallback = Direct
+	}
+
+	return func(network, addr string) (net.Conn, error) {
+		if d, ok := dials[addr]; ok {
+			return d(network, addr)
+		}
+		return fallback(network, addr)
+	}
+}
@@ -0,0 +1,168 @@
+package dialer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestPerBackendChoosesDialByAddress(t *testing.T) {
+	var used string
+	dial := func(name string) DialFunc {
+		return func(network, addr string) (net.Conn, error) {
+			used = name
+			return nil, nil
+		}
+	}
+
+	d := PerBackend(map[string]DialFunc{"10.0.0.1:6379": dial("tunnel")}, dial("fallback"))
+
+	d("tcp", "10.0.0.1:6379")
+	if used != "tunnel" {
+		t.Fatalf("Expected the backend's dial, got %s", used)
+	}
+	d("tcp", "10.0.0.2:6379")
+	if used != "fallback" {
+		t.Fatalf("Expected the fallback dial, got %s", used)
+	}
+}
+
+func TestSOCKS5ConnectsThroughProxy(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer target.Close()
+	go func() {
+		c, err := target.Accept()
+		if err == nil {
+			c.Write([]byte("+PONG\r\n"))
+			c.Close()
+		}
+	}()
+
+	socks, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer socks.Close()
+	go serveSOCKS5(socks)
+
+	dial, err := SOCKS5(socks.Addr().String(), "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c, err := dial("tcp", target.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "+PONG\r\n" {
+		t.Fatalf("Unexpected reply through proxy: %q, %v", buf, err)
+	}
+}
+
+// Serves a single unauthenticated SOCKS5 CONNECT to an IPv4 address.
+func serveSOCKS5(l net.Listener) {
+	c, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	greeting := make([]byte, 2)
+	io.ReadFull(c, greeting)
+	io.ReadFull(c, make([]byte, greeting[1]))
+	c.Write([]byte{5, 0})
+
+	req := make([]byte, 10)
+	if _, err := io.ReadFull(c, req); err != nil || req[3] != 1 {
+		return
+	}
+	addr := &net.TCPAddr{IP: net.IP(req[4:8]), Port: int(binary.BigEndian.Uint16(req[8:10]))}
+
+	up, err := net.DialTCP("tcp", nil, addr)
+	if err != nil {
+		c.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer up.Close()
+
+	c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	io.Copy(c, up)
+}
+
+// Returns a new SSH public key and the path of a file holding a private key for the client.
+func sshKeys(t *testing.T) (ssh.PublicKey, string) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return hostKey, path
+}
+
+func TestSSHKeyTunnelChecksKnownHosts(t *testing.T) {
+	hostKey, keyPath := sshKeys(t)
+	revokedKey, _ := sshKeys(t)
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}
+
+	known := filepath.Join(t.TempDir(), "known_hosts")
+	lines := "@revoked revoked.example " + string(ssh.MarshalAuthorizedKey(revokedKey)) +
+		"revoked.example " + string(ssh.MarshalAuthorizedKey(revokedKey)) +
+		knownhosts.Line([]string{knownhosts.HashHostname("hashed.example")}, hostKey) + "\n"
+	if err := ioutil.WriteFile(known, []byte(lines), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tunnel, err := NewSSHKeyTunnel("bastion:22", "ops", keyPath, known)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	check := tunnel.config.HostKeyCallback
+
+	if err := check("hashed.example:22", remote, hostKey); err != nil {
+		t.Fatalf("Expected a hashed entry to match, got %v", err)
+	}
+	if err := check("revoked.example:22", remote, revokedKey); err == nil {
+		t.Fatal("Expected a revoked key to be rejected.")
+	}
+	if err := check("unknown.example:22", remote, hostKey); err == nil {
+		t.Fatal("Expected an unknown host to be rejected.")
+	}
+}
+
+func TestSSHKeyTunnelRejectsMalformedKnownHosts(t *testing.T) {
+	_, keyPath := sshKeys(t)
+
+	known := filepath.Join(t.TempDir(), "known_hosts")
+	if err := ioutil.WriteFile(known, []byte("host.example not-a-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSSHKeyTunnel("bastion:22", "ops", keyPath, known); err == nil {
+		t.Fatal("Expected error for a malformed known hosts file.")
+	}
+}
@@ -0,0 +1,169 @@
+package dialer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// HostResolver resolves hostnames to IP addresses. It is implemented by *net.Resolver.
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DefaultHeadStart is the delay before each further address is tried by a HappyDialer, if none is configured.
+// It matches the 300ms recommended by RFC 8305.
+const DefaultHeadStart = 300 * time.Millisecond
+
+// HappyDialer dials every address of a host concurrently, alternating IPv6 and IPv4, giving each a head start
+// over the next, and keeps the first connection to succeed. An unreachable address family or a dead A record
+// then costs at most the head start, rather than a full connect timeout as when addresses are tried in turn.
+// A failed attempt starts the next one at once. Timeout bounds the whole dial if set.
+// Its Dial method is a DialFunc, and may be passed to redis.DialNetDial in redigo.
+type HappyDialer struct {
+	HeadStart time.Duration
+	Timeout   time.Duration
+	Resolver  HostResolver
+	Dialer    net.Dialer
+}
+
+// Dial connects to the input address, as DialContext with a background context.
+func (d *HappyDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the input address, racing its resolved IPs.
+// Unix socket addresses are dialed directly.
+func (d *HappyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	if network == "unix" {
+		return d.Dialer.DialContext(ctx, network, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []string
+	if net.ParseIP(host) != nil {
+		ips = []string{host}
+	} else {
+		res := d.Resolver
+		if res == nil {
+			res = net.DefaultResolver
+		}
+		if ips, err = res.LookupHost(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("No addresses found for " + host + ".")
+	}
+
+	return d.race(ctx, network, interleave(ips), port)
+}
+
+// The result of a single connection attempt.
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// Dials the input IPs in order, starting each after the head start or once the previous attempt fails,
+// and returns the first connection. Later connections are closed.
+func (d *HappyDialer) race(ctx context.Context, network string, ips []string, port string) (net.Conn, error) {
+	headStart := d.HeadStart
+	if headStart <= 0 {
+		headStart = DefaultHeadStart
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(ips))
+	next, pending := 0, 0
+	start := func() {
+		addr := net.JoinHostPort(ips[next], port)
+		next++
+		pending++
+		go func() {
+			c, err := d.Dialer.DialContext(ctx, network, addr)
+			results <- dialResult{conn: c, err: err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(headStart)
+	defer timer.Stop()
+
+	var firstErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if next < len(ips) {
+				start()
+				timer.Reset(headStart)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				// Close any connections that complete after the winner.
+				go func(n int) {
+					for ; n > 0; n-- {
+						if late := <-results; late.err == nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			}
+
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if next < len(ips) {
+				start()
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(headStart)
+			}
+		}
+	}
+	return nil, firstErr
+}
+
+// Orders the input IPs to alternate between IPv6 and IPv4, starting with the family of the first,
+// as resolvers already sort them by preference.
+func interleave(ips []string) []string {
+	var first, second []string
+	v4 := net.ParseIP(ips[0]).To4() != nil
+	for _, ip := range ips {
+		if (net.ParseIP(ip).To4() != nil) == v4 {
+			first = append(first, ip)
+		} else {
+			second = append(second, ip)
+		}
+	}
+
+	res := make([]string, 0, len(ips))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			res = append(res, first[i])
+		}
+		if i < len(second) {
+			res = append(res, second[i])
+		}
+	}
+	return res
+}
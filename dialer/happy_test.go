@@ -0,0 +1,83 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// Answers lookups from a fixed map.
+type fakeResolver struct {
+	hosts map[string][]string
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return f.hosts[host], nil
+}
+
+func TestInterleaveAlternatesFamilies(t *testing.T) {
+	ips := interleave([]string{"::1", "::2", "10.0.0.1", "10.0.0.2", "10.0.0.3"})
+	want := []string{"::1", "10.0.0.1", "::2", "10.0.0.2", "10.0.0.3"}
+	for i := range want {
+		if ips[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, ips)
+		}
+	}
+}
+
+func TestHappyDialerFallsBackToReachableAddress(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	// The first address does not answer, so the second should win after the head start.
+	res := &fakeResolver{hosts: map[string][]string{"redis": {"192.0.2.1", "127.0.0.1"}}}
+	d := &HappyDialer{HeadStart: 20 * time.Millisecond, Timeout: 2 * time.Second, Resolver: res}
+
+	start := time.Now()
+	c, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("redis", port))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	if c.RemoteAddr().String() != l.Addr().String() {
+		t.Fatalf("Expected connection to %s, got %s", l.Addr(), c.RemoteAddr())
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Expected the reachable address to win without waiting for the timeout")
+	}
+}
+
+func TestHappyDialerDialsUnixSockets(t *testing.T) {
+	path := t.TempDir() + "/redis.sock"
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+
+	c, err := (&HappyDialer{Timeout: time.Second}).Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c.Close()
+}
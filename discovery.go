@@ -0,0 +1,263 @@
+package twunproxy
+
+import (
+	"context"
+)
+
+/******************************************************
+ * Strategies for discovering the instance holding an unmapped key.
+ ******************************************************/
+
+// DiscoveryStrategy finds the instance holding the key of a command whose key is not mapped, and runs the command
+// there. Strategies work through the input Discovery, whose probes map the key to the instance of the first
+// accepted result, so that later commands for the key skip discovery.
+type DiscoveryStrategy interface {
+	Discover(d *Discovery) DiscoveryResult
+}
+
+// DiscoveryResult is the outcome of discovery. Server is the address of the instance whose result was accepted,
+// with its reply and error. If no result was accepted, Server is empty and Err is ErrNoMapping,
+// unless a fallback of the command accepted a reply, which is given without mapping the key.
+type DiscoveryResult struct {
+	Server string
+	Reply  interface{}
+	Err    error
+}
+
+// WithDiscoveryStrategy discovers unmapped keys with the input strategy, trading latency against the load
+// that discovery puts on the instances. The default is ProbeAll.
+func WithDiscoveryStrategy(s DiscoveryStrategy) Option {
+	return func(r *ProxyConn) {
+		r.discovery = s
+		r.hashRouting = nil
+		if h, ok := s.(HashRouting); ok {
+			r.hashRouting = &hashRouting{fallback: h.Fallback}
+		}
+	}
+}
+
+// WithBlockingPreProbe discovers the keys of blocking commands, such as BLPOP, with ExistsProbe whatever the
+// discovery strategy, so that the blocking command is only issued to the instance holding the key rather than
+// tying up a connection to every instance for its full timeout. Only when the key exists nowhere yet is the
+// command issued to every instance, to wait for the key to be created.
+// Blocking pops of several keys, such as by BLPopKeys, are not affected.
+func WithBlockingPreProbe() Option {
+	return func(r *ProxyConn) {
+		r.preProbe = true
+	}
+}
+
+// Discovery is the discovery of the key of one command, given to a DiscoveryStrategy.
+type Discovery struct {
+	ctx    context.Context
+	r      *ProxyConn
+	t      *topology
+	idxs   []int
+	cmd    *RedisCmd
+	canMap func(interface{}) bool
+}
+
+// Context returns the context of the command, which ends when the command is cancelled or times out.
+func (d *Discovery) Context() context.Context {
+	return d.ctx
+}
+
+// Key returns the key being discovered.
+func (d *Discovery) Key() string {
+	return d.cmd.key
+}
+
+// Command returns the name of the command.
+func (d *Discovery) Command() string {
+	return d.cmd.name
+}
+
+// Servers returns the addresses of the instances that may be probed, heaviest first.
+// Ejected and quarantined instances are left out.
+func (d *Discovery) Servers() []string {
+	servers := make([]string, len(d.idxs))
+	for j, i := range d.idxs {
+		servers[j] = d.t.server(i)
+	}
+	return servers
+}
+
+// Owner returns the address of the instance that Twemproxy places the key on, if it can be computed for
+// the pool configuration and the instance may be probed.
+func (d *Discovery) Owner() (string, bool) {
+	i, ok := d.t.ring.owner(d.cmd.key)
+	if !ok || !containsIndex(d.idxs, i) {
+		return "", false
+	}
+	return d.t.server(i), true
+}
+
+// Probe runs the command on the instances with the input addresses concurrently, and returns the first result
+// accepted, mapping the key to its instance. Addresses of instances that may not be probed are ignored.
+func (d *Discovery) Probe(servers ...string) DiscoveryResult {
+	return d.result(d.probe(d.indexes(servers)))
+}
+
+// Query runs another command, such as EXISTS for the key, on the instances with the input addresses concurrently,
+// and returns the result from each in the same order. Nothing is mapped. Addresses of instances that may not be
+// probed carry an error.
+func (d *Discovery) Query(servers []string, name string, args ...interface{}) []PoolResult {
+	res := make([]PoolResult, len(servers))
+	done := make(chan bool)
+
+	for j, server := range servers {
+		res[j].Server = server
+		go func(j int) {
+			defer func() { done <- true }()
+
+			i, err := d.t.index(res[j].Server)
+			if err != nil || !containsIndex(d.idxs, i) {
+				res[j].Err = errAllEjected
+				return
+			}
+
+			c := d.t.pools[i].Get()
+			defer c.Close()
+			res[j].Reply, res[j].Err = doContext(d.ctx, c, name, args...)
+		}(j)
+	}
+
+	for range servers {
+		<-done
+	}
+	return res
+}
+
+// Runs the command on the pools at the input indices, as for discover.
+func (d *Discovery) probe(idxs []int) redisReturn {
+	if len(idxs) == 0 {
+		return redisReturn{val: nil, err: ErrNoMapping, pool: -1}
+	}
+	return d.r.discover(d.ctx, d.t, idxs, d.cmd, d.canMap)
+}
+
+// Returns the indices of the instances with the input addresses that may be probed.
+func (d *Discovery) indexes(servers []string) []int {
+	var idxs []int
+	for _, server := range servers {
+		if i, err := d.t.index(server); err == nil && containsIndex(d.idxs, i) && !containsIndex(idxs, i) {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
+
+// Converts a return from discover to a result.
+func (d *Discovery) result(rr redisReturn) DiscoveryResult {
+	if rr.pool < 0 {
+		return DiscoveryResult{Reply: rr.val, Err: rr.err}
+	}
+	return DiscoveryResult{Server: d.t.server(rr.pool), Reply: rr.val, Err: rr.err}
+}
+
+// Discovers the key of the command with the discovery strategy of the proxy, probing the pools at the input indices.
+func (r *ProxyConn) discoverWith(
+	ctx context.Context,
+	t *topology,
+	idxs []int,
+	cmd *RedisCmd,
+	canMap func(interface{}) bool) redisReturn {
+
+	s := r.discovery
+	if r.preProbe && r.blocking(cmd.name) {
+		s = ExistsProbe{}
+	} else if s == nil {
+		s = ProbeAll{}
+	}
+
+	dr := s.Discover(&Discovery{ctx: ctx, r: r, t: t, idxs: idxs, cmd: cmd, canMap: canMap})
+	if dr.Server == "" {
+		return redisReturn{val: dr.Reply, err: dr.Err, pool: -1}
+	}
+
+	i, err := t.index(dr.Server)
+	if err != nil {
+		return redisReturn{val: nil, err: err, pool: -1}
+	}
+	return redisReturn{val: dr.Reply, err: dr.Err, pool: i}
+}
+
+// ProbeAll runs the command on every instance concurrently and takes the first accepted result.
+// It is the default strategy, and the fastest, but each discovery puts the command on every instance.
+// If WithPrefixRules or WithAdaptiveDiscovery nominate an instance for the key, it is probed alone first.
+type ProbeAll struct{}
+
+func (ProbeAll) Discover(d *Discovery) DiscoveryResult {
+	r, t, key := d.r, d.t, d.cmd.key
+
+	// A prefix rule or adaptive discovery may nominate an instance to probe alone first.
+	// If another instance then answers, the prefix rule was wrong and is demoted.
+	first, prefix, ruled := r.prefixes.lookup(key, t)
+	if !ruled {
+		first, ruled = r.adaptive.likely(key, t)
+		prefix = ""
+	}
+	if !ruled || !containsIndex(d.idxs, first) {
+		return d.result(d.probe(d.idxs))
+	}
+
+	res := d.probe([]int{first})
+	if res.pool < 0 {
+		if res = d.probe(without(d.idxs, first)); res.pool >= 0 && prefix != "" {
+			r.prefixes.demote(prefix)
+			r.counter("prefix_rule_demotions", t.server(first), 1)
+		}
+	}
+	return d.result(res)
+}
+
+// HashRouting runs the command only on the instance that Twemproxy would place the key on, as for WithHashRouting.
+// If Fallback is true and that instance does not return an accepted result, the others are probed.
+// Keys that cannot be placed are discovered as for ProbeAll.
+type HashRouting struct {
+	Fallback bool
+}
+
+func (h HashRouting) Discover(d *Discovery) DiscoveryResult {
+	t := d.t
+	owner, hashed := t.ring.owner(d.cmd.key)
+	if !hashed {
+		return ProbeAll{}.Discover(d)
+	}
+
+	res := redisReturn{val: nil, err: ErrNoMapping, pool: -1}
+	if containsIndex(d.idxs, owner) {
+		res = d.probe([]int{owner})
+	}
+	if res.pool < 0 && h.Fallback {
+		if res = d.probe(without(d.idxs, owner)); res.pool >= 0 {
+			d.r.counter("hash_routing_misses", t.server(owner), 1)
+		}
+	}
+	return d.result(res)
+}
+
+// ExistsProbe first checks which instances hold the key with EXISTS, which is cheap, and then runs the command only
+// on those. This spares the other instances the command, at the cost of a round trip, and suits expensive or
+// blocking commands. If no instance holds the key, or EXISTS fails everywhere, every instance is probed as for
+// ProbeAll, since commands such as blocking pops may be waiting for the key to be created.
+type ExistsProbe struct{}
+
+func (ExistsProbe) Discover(d *Discovery) DiscoveryResult {
+	servers := d.Servers()
+
+	var holders []string
+	for _, pr := range d.Query(servers, "EXISTS", d.cmd.key) {
+		if n, ok := replyInt(pr.Reply); ok && pr.Err == nil && n > 0 {
+			holders = append(holders, pr.Server)
+		}
+	}
+
+	if len(holders) > 0 {
+		d.r.counter("exists_probe_hits", "", 1)
+		if res := d.Probe(holders...); res.Server != "" || d.ctx.Err() != nil {
+			return res
+		}
+	}
+	return d.Probe(servers...)
+}
@@ -0,0 +1,96 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestExistsProbeRunsCommandOnlyWhereKeyExists(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("EXISTS", "KEY").Return(int64(0), nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("EXISTS", "KEY").Return(int64(1), nil)
+	mockConn2.EXPECT().Do("LRANGE", "KEY", 0, -1).Return([]interface{}{"a"}, nil)
+	mockConn2.EXPECT().Close().Times(2)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithDiscoveryStrategy(ExistsProbe{})(proxy)
+
+	v, err := proxy.Do(NewRedisCmd("LRANGE", "KEY", 0, -1), func(v interface{}) bool { return v != nil })
+	if err != nil || len(v.([]interface{})) != 1 || proxy.KeyInstance["KEY"] != mockPool2 {
+		t.Fatalf("Unexpected reply %v, %v", v, err)
+	}
+}
+
+func TestExistsProbeFallsBackToEveryInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	for _, c := range []*MockConn{mockConn1, mockConn2} {
+		c.EXPECT().Do("EXISTS", "KEY").Return(int64(0), nil)
+		c.EXPECT().Do("GET", "KEY").Return(nil, nil)
+		c.EXPECT().Close().Times(2)
+	}
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithDiscoveryStrategy(ExistsProbe{})(proxy)
+
+	if _, err := proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil }); err != ErrNoMapping {
+		t.Fatalf("Expected no mapping, got %v", err)
+	}
+}
+
+func TestCustomDiscoveryStrategyProbesChosenServers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn2.EXPECT().Do("GET", "KEY").Return("v", nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithDiscoveryStrategy(lastServer{})(proxy)
+
+	if v, err := proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil }); err != nil || v != "v" {
+		t.Fatalf("Unexpected reply %v, %v", v, err)
+	}
+	if proxy.KeyInstance["KEY"] != mockPool2 {
+		t.Fatal("Expected key to be mapped to the probed instance.")
+	}
+}
+
+// A strategy that probes only the last instance.
+type lastServer struct{}
+
+func (lastServer) Discover(d *Discovery) DiscoveryResult {
+	servers := d.Servers()
+	return d.Probe(servers[len(servers)-1])
+}
+
+func TestBlockingPreProbeIssuesBlockingPopOnlyToHolder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("EXISTS", "KEY").Return(int64(1), nil)
+	mockConn1.EXPECT().Do("BLPOP", "KEY", gomock.Any()).Return([]interface{}{[]byte("KEY"), []byte("v")}, nil)
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Do("EXISTS", "KEY").Return(int64(0), nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithBlockingPreProbe()(proxy)
+
+	if v, err := proxy.BLPop("KEY", time.Second); err != nil || v != "v" {
+		t.Fatalf("Unexpected reply %q, %v", v, err)
+	}
+}
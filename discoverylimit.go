@@ -0,0 +1,86 @@
+package twunproxy
+
+import (
+	"context"
+	"sync"
+)
+
+// Limits the number of discovery probes running at once, in total and against each pool.
+// A nil semaphore does not limit.
+type probeLimiter struct {
+	global  chan struct{}
+	perPool int
+
+	mu    sync.Mutex
+	pools map[ConnGetter]chan struct{}
+}
+
+// WithDiscoveryConcurrency limits how many discovery probes may run at once, across every pool and against
+// each pool, so that bursts of commands for unmapped keys cannot exhaust the connection pools of the backends.
+// Each probe borrows a connection, so perPool should be below the size of each connection pool.
+// A limit of 0 leaves that dimension unlimited. Probes wait for a slot, and stop waiting
+// once another instance accepts the command or the context ends. Commands for mapped keys are not limited;
+// WithMaxInFlight limits every command.
+func WithDiscoveryConcurrency(global, perPool int) Option {
+	return func(r *ProxyConn) {
+		l := &probeLimiter{perPool: perPool, pools: make(map[ConnGetter]chan struct{})}
+		if global > 0 {
+			l.global = make(chan struct{}, global)
+		}
+		r.probes = l
+	}
+}
+
+// Waits for a slot to probe the input pool, giving up if the stop channel receives or the context ends.
+// If a slot is taken, the returned function releases it and true is returned.
+// A nil limiter admits every probe immediately.
+func (l *probeLimiter) acquire(ctx context.Context, pool ConnGetter, stop chan bool) (func(), bool) {
+	if l == nil {
+		return func() {}, true
+	}
+
+	sems := make([]chan struct{}, 0, 2)
+	if l.global != nil {
+		sems = append(sems, l.global)
+	}
+	if sem := l.pool(pool); sem != nil {
+		sems = append(sems, sem)
+	}
+
+	release := func(n int) {
+		for _, sem := range sems[:n] {
+			<-sem
+		}
+	}
+
+	// Slots are always taken global first, so that waiters cannot deadlock one another.
+	for i, sem := range sems {
+		select {
+		case sem <- struct{}{}:
+		case <-stop:
+			release(i)
+			return nil, false
+		case <-ctx.Done():
+			release(i)
+			return nil, false
+		}
+	}
+	return func() { release(len(sems)) }, true
+}
+
+// Returns the semaphore limiting probes of the input pool, or nil if they are not limited.
+func (l *probeLimiter) pool(pool ConnGetter) chan struct{} {
+	if l.perPool <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sem, ok := l.pools[pool]
+	if !ok {
+		sem = make(chan struct{}, l.perPool)
+		l.pools[pool] = sem
+	}
+	return sem
+}
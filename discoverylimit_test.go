@@ -0,0 +1,71 @@
+package twunproxy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A connection that tracks the most commands it has had running at once.
+type concurrencyConn struct {
+	running *int32
+	max     *int32
+}
+
+func (c concurrencyConn) Do(string, ...interface{}) (interface{}, error) {
+	n := atomic.AddInt32(c.running, 1)
+	for {
+		m := atomic.LoadInt32(c.max)
+		if n <= m || atomic.CompareAndSwapInt32(c.max, m, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	atomic.AddInt32(c.running, -1)
+	return nil, nil
+}
+
+func (c concurrencyConn) Close() error { return nil }
+
+func TestDiscoveryConcurrencyLimitsProbesPerPool(t *testing.T) {
+	var running, max int32
+	proxy := getMockProxy(connPool{concurrencyConn{&running, &max}})
+	WithDiscoveryConcurrency(0, 2)(proxy)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil })
+		}()
+	}
+	wg.Wait()
+
+	if m := atomic.LoadInt32(&max); m > 2 {
+		t.Fatalf("Expected at most 2 probes at once, got %d", m)
+	}
+}
+
+func TestProbeLimiterStopsWaitingWhenContextEnds(t *testing.T) {
+	l := &probeLimiter{global: make(chan struct{}, 1), pools: make(map[ConnGetter]chan struct{})}
+	pool := connPool{&nilStyleConn{}}
+
+	release, ok := l.acquire(context.Background(), pool, nil)
+	if !ok {
+		t.Fatal("Expected a free slot.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, ok := l.acquire(ctx, pool, nil); ok {
+		t.Fatal("Expected no slot while the only one is held.")
+	}
+
+	release()
+	if _, ok := l.acquire(context.Background(), pool, nil); !ok {
+		t.Fatal("Expected the released slot to be free.")
+	}
+}
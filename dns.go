@@ -0,0 +1,164 @@
+package twunproxy
+
+import (
+	"context"
+	"github.com/txodds/twunproxy/dialer"
+	"net"
+	"sort"
+	"time"
+)
+
+// DefaultDNSRefreshInterval is the interval between DNS refreshes if none is configured.
+const DefaultDNSRefreshInterval = time.Minute
+
+// HostResolver resolves hostnames to IP addresses. It is implemented by *net.Resolver.
+type HostResolver = dialer.HostResolver
+
+// DNSRefresh configures RefreshDNS. Interval defaults to DefaultDNSRefreshInterval,
+// and Resolver to the system resolver.
+// OnChange, if set, is called with the address of each instance whose pool is rebuilt and its old and new IPs.
+// OnError, if set, is called with failures to resolve an instance or to rebuild its pool.
+type DNSRefresh struct {
+	Interval time.Duration
+	Resolver HostResolver
+	OnChange func(server string, old, new []string)
+	OnError  func(server string, err error)
+}
+
+// RefreshDNS periodically re-resolves instances whose server descriptors use hostnames, and rebuilds the pool of
+// any whose set of IPs changes, so that long-lived pools stop dialing an address the instance no longer has,
+// such as after cloud maintenance. The new pool is created from the same descriptor and checked with PING before
+// it replaces the old one; keys mapped to the old pool are moved to it, since the instance is the same.
+// The old pool is closed once the drain timeout set by WithDrainTimeout has passed.
+// A failed lookup or PING leaves the pool as it was, to be retried at the next interval.
+// Instances given by IP address are never rebuilt. Call the returned function, or Close, to stop refreshing.
+func (r *ProxyConn) RefreshDNS(conf DNSRefresh) func() {
+	if conf.Interval <= 0 {
+		conf.Interval = DefaultDNSRefreshInterval
+	}
+	if conf.Resolver == nil {
+		conf.Resolver = net.DefaultResolver
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The IPs last resolved for each hostname. The first resolution only records them.
+	resolved := make(map[string][]string)
+
+	go func() {
+		t := time.NewTicker(conf.Interval)
+		defer t.Stop()
+
+		for {
+			r.refreshDNS(ctx, conf, resolved)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	return r.onClose(cancel)
+}
+
+// Resolves the hostname of each instance and rebuilds the pools of those whose IPs have changed.
+func (r *ProxyConn) refreshDNS(ctx context.Context, conf DNSRefresh, resolved map[string][]string) {
+	t := r.topology()
+
+	for i, desc := range t.servers {
+		if i >= len(t.pools) {
+			break
+		}
+
+		server := t.server(i)
+		host, _, err := net.SplitHostPort(server)
+		if err != nil || net.ParseIP(host) != nil {
+			continue
+		}
+
+		ips, err := conf.Resolver.LookupHost(ctx, host)
+		if err != nil {
+			if ctx.Err() == nil && conf.OnError != nil {
+				conf.OnError(server, err)
+			}
+			continue
+		}
+		sort.Strings(ips)
+
+		old, seen := resolved[host]
+		resolved[host] = ips
+		if !seen || equalStrings(old, ips) {
+			continue
+		}
+
+		if err := r.rebuildPool(t.pools[i], desc); err != nil {
+			// Forget the new IPs so that the rebuild is retried.
+			resolved[host] = old
+			if conf.OnError != nil {
+				conf.OnError(server, err)
+			}
+			continue
+		}
+
+		r.counter("dns_pool_rebuilds", server, 1)
+		r.log().Info("Pool rebuilt for changed DNS", "server", server, "old", old, "new", ips)
+		if conf.OnChange != nil {
+			conf.OnChange(server, old, ips)
+		}
+	}
+}
+
+// Replaces the input pool with a new one created from the input descriptor, which also replaces the descriptor of
+// the old pool, moves its mappings to the new pool, prunes the old pool from the mapper and drains it.
+// Nothing is changed, and the new pool is closed, if it fails its PING or the old pool is no longer configured.
+func (r *ProxyConn) rebuildPool(old ConnGetter, desc string) error {
+	conf, err := r.readConfig()
+	if err != nil {
+		return err
+	}
+
+	p, err := r.createPool(conf, desc)
+	if err == nil {
+		c := p.Get()
+		_, err = c.Do("PING")
+		c.Close()
+	}
+	if err != nil {
+		closePools([]ConnGetter{p})
+		return err
+	}
+
+	t := r.topology()
+	i := t.indexOf(old)
+	if i < 0 {
+		closePools([]ConnGetter{p})
+		return nil
+	}
+
+	pools := append([]ConnGetter(nil), t.pools...)
+	pools[i] = p
+	servers := append([]string(nil), t.servers...)
+	if i < len(servers) {
+		servers[i] = desc
+	}
+	r.setTopology(&topology{pools: pools, servers: servers, ring: t.ring, hashTag: t.hashTag})
+
+	if c, ok := old.(PoolCloser); ok {
+		r.drain(c)
+	}
+
+	defer r.pruneMappings()
+
+	m, ok := r.mappings()
+	if !ok {
+		r.purgeMappings()
+		return nil
+	}
+	for k, mapped := range m {
+		if mapped == old {
+			r.mapKey(k, p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package twunproxy
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Answers lookups from a map that tests may change.
+type fakeResolver struct {
+	mu    sync.Mutex
+	hosts map[string][]string
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hosts[host], nil
+}
+
+func TestRefreshDNSRebuildsPoolOnAddressChange(t *testing.T) {
+	create := func(desc, auth string) ConnGetter {
+		return &closingPool{ConnGetter: connPool{&nilStyleConn{reply: "PONG"}}, closed: make(chan bool, 1)}
+	}
+	path := writeConfig(t, "alpha:\n  servers:\n   - redis-0.cache:6379:1\n   - 10.0.0.2:6379:1\n")
+	defer os.Remove(path)
+
+	proxy, err := NewProxyConn(path, "alpha", 0, create)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	WithDrainTimeout(time.Millisecond)(proxy)
+	old := proxy.Pools[0]
+	proxy.mapKey("KEY", old)
+
+	res := &fakeResolver{hosts: map[string][]string{"redis-0.cache": {"10.0.0.1"}}}
+	conf := DNSRefresh{Resolver: res}
+	resolved := make(map[string][]string)
+
+	proxy.refreshDNS(context.Background(), conf, resolved)
+	if proxy.Pools[0] != old {
+		t.Fatal("Expected the first resolution not to rebuild the pool")
+	}
+
+	res.hosts["redis-0.cache"] = []string{"10.0.0.9"}
+	var changed string
+	conf.OnChange = func(server string, o, n []string) { changed = server }
+	proxy.refreshDNS(context.Background(), conf, resolved)
+
+	if proxy.Pools[0] == old || changed != "redis-0.cache:6379" {
+		t.Fatalf("Expected the pool to be rebuilt, got change for %q", changed)
+	}
+	if pool, ok := proxy.lookup("KEY"); !ok || pool != proxy.Pools[0] {
+		t.Fatal("Expected the mapping to move to the rebuilt pool")
+	}
+
+	select {
+	case <-old.(*closingPool).closed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the old pool to be closed after draining")
+	}
+}
+
+func TestRefreshDNSDefaultsInterval(t *testing.T) {
+	stop := getMockProxy().RefreshDNS(DNSRefresh{Resolver: &fakeResolver{}})
+	time.Sleep(10 * time.Millisecond)
+	stop()
+}
@@ -0,0 +1,16 @@
+// Package twunproxy is a Redis client for the instances behind a Twemproxy pool, for the commands and operations
+// Twemproxy does not support, such as blocking pops, pub/sub, scans and administration across every instance.
+//
+// This package holds the core: ProxyConn, its options, key routing and discovery, the commands it runs on the
+// instance holding a key, the administrative operations it fans out to every instance, and its health, metrics
+// and statistics. Memcached pools are proxied by NewMemcachedProxyConn, which adapts memcached connections
+// to the Redis commands they support.
+//
+// Adapters to client libraries and networks live in subpackages. Package redigo and package goredis provide
+// a CreatePool for their client libraries, package dialer provides dial functions for them, package cache
+// provides mapping caches, and package conformance validates adapters written for other clients.
+// Package metrics exports metrics to Prometheus, and package otel exports spans to OpenTelemetry.
+// Package reply converts command replies to Go types, and package twuntest runs in-memory backends for tests.
+//
+// Command cmd/twunctl runs operational tasks from the command line.
+package twunproxy
@@ -0,0 +1,155 @@
+package twunproxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DuplicatePolicy decides which instance a key is mapped to when discovery finds it on more than one.
+type DuplicatePolicy int
+
+const (
+	// PreferFirstResponder maps the key to the instance that answered first.
+	PreferFirstResponder DuplicatePolicy = iota
+
+	// PreferRingOwner maps the key to the instance that the hash ring places it on, if that instance holds it,
+	// or else to the first responder. Without a supported hash and distribution this is PreferFirstResponder.
+	PreferRingOwner
+
+	// FailOnDuplicate maps the key nowhere and fails the command with a DuplicateKeyError.
+	FailOnDuplicate
+)
+
+// DuplicateKeyError is returned under FailOnDuplicate when discovery finds a key on more than one instance.
+type DuplicateKeyError struct {
+	Key     string
+	Servers []string
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("Key %s exists on several instances: %s.", e.Key, strings.Join(e.Servers, ", "))
+}
+
+// How discovery handles keys found on more than one instance.
+type duplicateHandling struct {
+	policy DuplicatePolicy
+	notify func(Duplicate)
+}
+
+// WithDuplicatePolicy makes discovery wait for every instance, rather than the first to accept a result,
+// so that keys held by more than one instance are detected. The policy decides where such a key is mapped,
+// and the notify function, if not nil, is called with each one found so that operators can clean it up.
+// The Duplicate passed has no deletions. Waiting for every instance makes discovery as slow as the slowest.
+func WithDuplicatePolicy(policy DuplicatePolicy, notify func(Duplicate)) Option {
+	return func(r *ProxyConn) {
+		r.duplicates = &duplicateHandling{policy: policy, notify: notify}
+	}
+}
+
+// The reply of one instance to a command run by discoverAll, and whether the canMap test accepted it.
+type probeReply struct {
+	redisReturn
+	accepted bool
+}
+
+// Runs the input command on every pool at the input indices and waits for all of them to reply,
+// then chooses among the accepted results according to the duplicate policy and maps the key.
+// If no result is accepted, the command's fallback tests are applied to the replies without errors.
+func (r *ProxyConn) discoverAll(
+	ctx context.Context,
+	t *topology,
+	idxs []int,
+	cmd *RedisCmd,
+	canMap func(interface{}) bool) redisReturn {
+
+	replies := make(chan probeReply, len(idxs))
+	for _, i := range idxs {
+		go func(i int) {
+			if !r.waitRate(ctx, t.server(i), nil) {
+				replies <- probeReply{redisReturn{err: ctx.Err(), pool: i}, false}
+				return
+			}
+
+			release, ok := r.probes.acquire(ctx, t.pools[i], nil)
+			if !ok {
+				replies <- probeReply{redisReturn{err: ctx.Err(), pool: i}, false}
+				return
+			}
+			defer release()
+
+			conn := t.pools[i].Get()
+			defer conn.Close()
+
+			val, err := r.intercept(ctx, t.server(i), true, cmd, func() (interface{}, error) {
+				return r.runContext(ctx, conn, cmd)
+			})
+			if ctx.Err() == nil {
+				r.recordOutcome(t.pools[i], err)
+			}
+			replies <- probeReply{redisReturn{val: val, err: err, pool: i}, canMap(val)}
+		}(i)
+	}
+
+	// Results are kept in the order they arrived.
+	var accepted, others []redisReturn
+	for range idxs {
+		if pr := <-replies; pr.accepted {
+			accepted = append(accepted, pr.redisReturn)
+		} else if pr.err == nil {
+			others = append(others, pr.redisReturn)
+		}
+	}
+
+	if len(accepted) == 0 {
+		return fallback(cmd, others)
+	}
+
+	res := accepted[0]
+	if len(accepted) > 1 {
+		var ok bool
+		if res, ok = r.resolveDuplicate(t, cmd.key, accepted); !ok {
+			return res
+		}
+	}
+
+	if !cmd.noCache {
+		r.mapKey(cmd.key, t.pools[res.pool])
+	}
+	return res
+}
+
+// Reports a key accepted by several instances and chooses the result to return according to the duplicate policy.
+// False is returned if the key should not be mapped, with a result carrying the error.
+func (r *ProxyConn) resolveDuplicate(t *topology, key string, accepted []redisReturn) (redisReturn, bool) {
+	if r.duplicates == nil {
+		return accepted[0], true
+	}
+
+	d := Duplicate{Key: key, Servers: make([]string, len(accepted)), Deleted: make([]string, 0)}
+	for j, rr := range accepted {
+		d.Servers[j] = t.server(rr.pool)
+	}
+
+	owner, placed := t.ring.owner(key)
+	if placed {
+		d.Owner = t.server(owner)
+	}
+
+	r.counter("duplicate_keys", "", 1)
+	if r.duplicates.notify != nil {
+		r.duplicates.notify(d)
+	}
+
+	switch r.duplicates.policy {
+	case FailOnDuplicate:
+		return redisReturn{err: &DuplicateKeyError{Key: key, Servers: d.Servers}, pool: -1}, false
+	case PreferRingOwner:
+		for _, rr := range accepted {
+			if placed && rr.pool == owner {
+				return rr, true
+			}
+		}
+	}
+	return accepted[0], true
+}
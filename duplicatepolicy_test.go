@@ -0,0 +1,119 @@
+package twunproxy
+
+import (
+	"testing"
+	"time"
+)
+
+func duplicatedProxy() *ProxyConn {
+	return getMockProxy(connPool{&nilStyleConn{reply: "A"}}, connPool{&nilStyleConn{}}, connPool{&nilStyleConn{reply: "B"}})
+}
+
+func TestDiscoveryReturnsWhenKeyExistsOnSeveralInstances(t *testing.T) {
+	proxy := duplicatedProxy()
+	canMap := func(v interface{}) bool { return v != nil }
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := proxy.Do(NewRedisCmd("GET", "KEY"), canMap)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected discovery to return.")
+	}
+}
+
+func TestDuplicatePolicyNotifiesAndPrefersFirstResponder(t *testing.T) {
+	var found []Duplicate
+	proxy := duplicatedProxy()
+	WithDuplicatePolicy(PreferFirstResponder, func(d Duplicate) { found = append(found, d) })(proxy)
+
+	v, err := proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(found) != 1 || len(found[0].Servers) != 2 || found[0].Key != "KEY" {
+		t.Fatalf("Unexpected duplicates: %+v", found)
+	}
+
+	server, ok := proxy.Lookup("KEY")
+	if !ok || server != found[0].Servers[0] || (v == "A") != (server == "0") {
+		t.Fatalf("Expected mapping to the first responder, got %s for %v", server, v)
+	}
+}
+
+func TestDuplicatePolicyFailsWithDetails(t *testing.T) {
+	proxy := duplicatedProxy()
+	WithDuplicatePolicy(FailOnDuplicate, nil)(proxy)
+
+	_, err := proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil })
+	if dup, ok := err.(*DuplicateKeyError); !ok || dup.Key != "KEY" || len(dup.Servers) != 2 {
+		t.Fatalf("Expected duplicate key error, got %v", err)
+	}
+	if _, ok := proxy.Lookup("KEY"); ok {
+		t.Fatal("Expected no mapping for a duplicated key.")
+	}
+}
+
+func TestDuplicatePolicyPrefersRingOwner(t *testing.T) {
+	servers := []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}
+	pools := []ConnGetter{connPool{&nilStyleConn{reply: "A"}}, connPool{&nilStyleConn{reply: "B"}}}
+	ring, _ := newHashRing(servers, "fnv1a_64", "ketama", "")
+
+	proxy := getMockProxy(pools...)
+	proxy.setTopology(&topology{pools: pools, servers: servers, ring: ring})
+	WithDuplicatePolicy(PreferRingOwner, nil)(proxy)
+
+	owner, _ := ring.owner("KEY")
+	v, err := proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil })
+	if err != nil || v != []string{"A", "B"}[owner] {
+		t.Fatalf("Expected the ring owner's reply, got %v, %v", v, err)
+	}
+	if server, _ := proxy.Lookup("KEY"); server != ServerAddr(servers[owner]) {
+		t.Fatalf("Expected mapping to the ring owner, got %s", server)
+	}
+}
+
+func TestFirstAcceptedResultWinsAndMapsAlone(t *testing.T) {
+	pools := map[interface{}]ConnGetter{}
+	a := connPool{&nilStyleConn{reply: "A"}}
+	b := connPool{&nilStyleConn{reply: "B"}}
+	pools["A"], pools["B"] = a, b
+
+	metrics := newFakeMetrics()
+	proxy := getMockProxy(a, b)
+	WithMetrics(metrics)(proxy)
+
+	for i := 0; i < 20; i++ {
+		proxy.Unmap("KEY")
+		v, err := proxy.Do(NewRedisCmd("GET", "KEY").NoCache(), func(v interface{}) bool { return v != nil })
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, ok := proxy.lookup("KEY"); ok {
+			t.Fatal("Expected no mapping for an uncached command.")
+		}
+
+		v, err = proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil })
+		if pool, _ := proxy.lookup("KEY"); err != nil || pool != pools[v] {
+			t.Fatalf("Expected the key to be mapped to the instance whose reply was returned, got %v, %v", v, err)
+		}
+	}
+
+	// Commands abandoned by discovery may complete after it returns.
+	discarded := func() float64 {
+		return metrics.get("discarded_accepted_results", "0") + metrics.get("discarded_accepted_results", "1")
+	}
+	for deadline := time.Now().Add(time.Second); discarded() < 40 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := discarded(); n != 40 {
+		t.Fatalf("Expected every second accepted result to be counted, got %v", n)
+	}
+}
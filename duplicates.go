@@ -0,0 +1,163 @@
+package twunproxy
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// The SCAN batch size hint used when walking instance keyspaces.
+var scanCount = 1000
+
+// Duplicate describes a key found on more than one instance by FindDuplicates.
+// Owner is the instance that the configured hash and distribution place the key on.
+// Deleted lists the instances that the copy of the key was removed from.
+type Duplicate struct {
+	Key     string   `json:"key"`
+	Servers []string `json:"servers"`
+	Owner   string   `json:"owner"`
+	Deleted []string `json:"deleted"`
+}
+
+// FindDuplicates scans every instance concurrently for keys matching the input pattern and reports those
+// present on more than one instance, ordered by key. Duplicates are usually the residue of a resharding
+// or a failover, and cause reads to return whichever copy discovery reaches first.
+// If deleteMisplaced is set, copies held by instances other than the owner are deleted,
+// but only where the owner holds a copy itself. Keys are never deleted from the owner.
+// Deletion requires the pool to use a ketama or modula distribution with a supported hash function.
+func (r *ProxyConn) FindDuplicates(pattern string, deleteMisplaced bool) ([]Duplicate, error) {
+	t := r.topology()
+	if deleteMisplaced && t.ring == nil {
+		return nil, errors.New("Key placement is unavailable for the pool configuration.")
+	}
+
+	found, err := scanHolders(t, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var dups []Duplicate
+	for k, idxs := range found {
+		if len(idxs) < 2 {
+			continue
+		}
+
+		d, err := r.duplicate(t, k, idxs, deleteMisplaced)
+		if err != nil {
+			return nil, err
+		}
+		dups = append(dups, d)
+	}
+
+	sort.Slice(dups, func(a, b int) bool { return dups[a].Key < dups[b].Key })
+	return dups, nil
+}
+
+// ConsistencyReport is the result of CheckConsistency: the keys held by more than one instance, and the keys
+// held by a single instance other than their owner, each ordered by key. Misplaced keys are never moved.
+type ConsistencyReport struct {
+	Duplicates []Duplicate `json:"duplicates"`
+	Misplaced  []Misplaced `json:"misplaced"`
+}
+
+// CheckConsistency scans every instance concurrently for keys matching the input pattern, and reports both
+// the duplicates that FindDuplicates would and, where the pool places keys, the misplaced keys that FindMisplaced
+// would, scanning each instance once. If deleteMisplaced is set, duplicates are deleted as for FindDuplicates.
+// Use FindMisplaced to move misplaced keys to their owner.
+func (r *ProxyConn) CheckConsistency(pattern string, deleteMisplaced bool) (*ConsistencyReport, error) {
+	t := r.topology()
+	if deleteMisplaced && t.ring == nil {
+		return nil, errors.New("Key placement is unavailable for the pool configuration.")
+	}
+
+	found, err := scanHolders(t, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &ConsistencyReport{Duplicates: make([]Duplicate, 0), Misplaced: make([]Misplaced, 0)}
+	for k, idxs := range found {
+		if len(idxs) > 1 {
+			d, err := r.duplicate(t, k, idxs, deleteMisplaced)
+			if err != nil {
+				return nil, err
+			}
+			rep.Duplicates = append(rep.Duplicates, d)
+			continue
+		}
+
+		if owner, ok := t.ring.owner(k); ok && owner != idxs[0] {
+			rep.Misplaced = append(rep.Misplaced, Misplaced{Key: k, Server: t.server(idxs[0]), Owner: t.server(owner)})
+		}
+	}
+
+	sort.Slice(rep.Duplicates, func(a, b int) bool { return rep.Duplicates[a].Key < rep.Duplicates[b].Key })
+	sort.Slice(rep.Misplaced, func(a, b int) bool { return rep.Misplaced[a].Key < rep.Misplaced[b].Key })
+	return rep, nil
+}
+
+// Scans every instance concurrently for keys matching the input pattern and returns the indices of the
+// instances holding each, in order.
+func scanHolders(t *topology, pattern string) (map[string][]int, error) {
+	var mu sync.Mutex
+	found := make(map[string][]int)
+	errs := t.forEach(func(i int, c Conn) error {
+		return scanKeys(c, pattern, scanCount, func(keys []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, k := range keys {
+				found[k] = append(found[k], i)
+			}
+			return nil
+		})
+	})
+
+	if err := firstError(errs); err != nil {
+		return nil, err
+	}
+	for _, idxs := range found {
+		sort.Ints(idxs)
+	}
+	return found, nil
+}
+
+// Describes the input key held by the instances at the input indices, deleting the copies held by instances
+// other than its owner if required and the owner holds a copy itself.
+func (r *ProxyConn) duplicate(t *topology, key string, idxs []int, deleteMisplaced bool) (Duplicate, error) {
+	d := Duplicate{Key: key, Servers: make([]string, len(idxs)), Deleted: make([]string, 0)}
+	owner, placed := t.ring.owner(key)
+	ownerHasKey := false
+	for j, i := range idxs {
+		d.Servers[j] = t.server(i)
+		ownerHasKey = ownerHasKey || (placed && i == owner)
+	}
+	if placed {
+		d.Owner = t.server(owner)
+	}
+
+	if deleteMisplaced && ownerHasKey {
+		if err := r.deleteCopies(t, key, idxs, owner, &d); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+// Deletes the input key from each of the instances at the input indices, other than the owner,
+// recording each instance that the key was deleted from.
+func (r *ProxyConn) deleteCopies(t *topology, key string, idxs []int, owner int, d *Duplicate) error {
+	for _, i := range idxs {
+		if i == owner {
+			continue
+		}
+
+		c := t.pools[i].Get()
+		_, err := c.Do("DEL", key)
+		c.Close()
+		if err != nil {
+			return err
+		}
+		d.Deleted = append(d.Deleted, t.server(i))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestFindDuplicatesReportsAndDeletesMisplacedCopies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.ring, _ = newHashRing(proxy.Servers, "fnv1a_32", "modula", "")
+
+	// Find a key owned by each instance.
+	keys := make([]string, 2)
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8"} {
+		i, _ := proxy.ring.owner(k)
+		if keys[i] == "" {
+			keys[i] = k
+		}
+	}
+	if keys[0] == "" || keys[1] == "" {
+		t.Fatal("Expected keys owned by both instances.")
+	}
+
+	scan := func(keys ...string) interface{} {
+		items := make([]interface{}, len(keys))
+		for i, k := range keys {
+			items[i] = []byte(k)
+		}
+		return []interface{}{[]byte("0"), items}
+	}
+
+	mockConn1.EXPECT().Do("SCAN", "0", "MATCH", "*", "COUNT", scanCount).Return(scan(keys[0], keys[1], "only1"), nil)
+	mockConn1.EXPECT().Do("DEL", keys[1]).Return(int64(1), nil)
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Do("SCAN", "0", "MATCH", "*", "COUNT", scanCount).Return(scan(keys[0], keys[1]), nil)
+	mockConn2.EXPECT().Do("DEL", keys[0]).Return(int64(1), nil)
+	mockConn2.EXPECT().Close().Times(2)
+
+	dups, err := proxy.FindDuplicates("*", true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(dups) != 2 {
+		t.Fatalf("Unexpected duplicates: %+v", dups)
+	}
+
+	for _, d := range dups {
+		if len(d.Servers) != 2 || len(d.Deleted) != 1 || d.Deleted[0] == d.Owner {
+			t.Fatalf("Unexpected duplicate: %+v", d)
+		}
+	}
+}
+
+func TestFindDuplicatesRequiresPlacementToDelete(t *testing.T) {
+	proxy := getMockProxy()
+	if _, err := proxy.FindDuplicates("*", true); err == nil {
+		t.Fatal("Expected error without a hash ring.")
+	}
+}
+
+func TestCheckConsistencyReportsDuplicatesAndMisplacedKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.ring, _ = newHashRing(proxy.Servers, "fnv1a_32", "modula", "")
+
+	// Find a key owned by each instance.
+	keys := make([]string, 2)
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8"} {
+		i, _ := proxy.ring.owner(k)
+		if keys[i] == "" {
+			keys[i] = k
+		}
+	}
+
+	// The key owned by a is on both; the key owned by b is only on a.
+	scan := func(keys ...string) interface{} {
+		items := make([]interface{}, len(keys))
+		for i, k := range keys {
+			items[i] = []byte(k)
+		}
+		return []interface{}{[]byte("0"), items}
+	}
+	mockConn1.EXPECT().Do("SCAN", "0", "MATCH", "*", "COUNT", scanCount).Return(scan(keys[0], keys[1]), nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("SCAN", "0", "MATCH", "*", "COUNT", scanCount).Return(scan(keys[0]), nil)
+	mockConn2.EXPECT().Close()
+
+	rep, err := proxy.CheckConsistency("*", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rep.Duplicates) != 1 || rep.Duplicates[0].Key != keys[0] || rep.Duplicates[0].Owner != "a:6379" {
+		t.Fatalf("Unexpected duplicates: %+v", rep.Duplicates)
+	}
+	if len(rep.Misplaced) != 1 || rep.Misplaced[0].Key != keys[1] || rep.Misplaced[0].Server != "a:6379" ||
+		rep.Misplaced[0].Owner != "b:6379" {
+		t.Fatalf("Unexpected misplaced keys: %+v", rep.Misplaced)
+	}
+}
@@ -0,0 +1,195 @@
+package twunproxy
+
+import (
+	"sync"
+	"time"
+)
+
+/******************************************************
+ * Ejection of failing instances, mirroring Twemproxy's auto_eject_hosts.
+ * Ejected instances are left out of discovery until they answer a PING after the retry timeout.
+ ******************************************************/
+
+// Twemproxy's defaults for server_failure_limit and server_retry_timeout.
+const (
+	DefaultServerFailureLimit = 2
+	DefaultServerRetryTimeout = 30 * time.Second
+)
+
+// Returned when discovery has no instance to probe because every one is ejected.
+var errAllEjected error = unavailableError("Every instance is ejected.")
+
+// EjectionPolicy ejects an instance after FailureLimit consecutive connection failures, as Twemproxy does
+// with auto_eject_hosts. Ejected instances are not probed by discovery, so keys are neither found on nor mapped
+// to them, and commands for unmapped keys do not wait on them. Once RetryTimeout passes, the instance is sent
+// a PING and rejoins if it answers, or else stays ejected for another RetryTimeout.
+// Error replies from Redis are not failures. OnChange, if not nil, is called with the server address when an
+// instance is ejected or rejoins.
+type EjectionPolicy struct {
+	FailureLimit int
+	RetryTimeout time.Duration
+	OnChange     func(server string, ejected bool)
+}
+
+// WithAutoEject ejects failing instances according to the input policy, which overrides any auto_eject_hosts
+// settings read from the pool configuration. Zero limits take Twemproxy's defaults.
+func WithAutoEject(p EjectionPolicy) Option {
+	return func(r *ProxyConn) {
+		r.ejector = newEjector(p)
+	}
+}
+
+// The ejection state of the pools, by pool.
+type ejector struct {
+	policy EjectionPolicy
+	mu     sync.Mutex
+	state  map[ConnGetter]*ejectState
+}
+
+// The consecutive failures of a pool and whether it is ejected.
+type ejectState struct {
+	failures int
+	ejected  bool
+}
+
+// Returns an ejector applying the input policy, with defaults for zero limits.
+func newEjector(p EjectionPolicy) *ejector {
+	if p.FailureLimit <= 0 {
+		p.FailureLimit = DefaultServerFailureLimit
+	}
+	if p.RetryTimeout <= 0 {
+		p.RetryTimeout = DefaultServerRetryTimeout
+	}
+	return &ejector{policy: p, state: make(map[ConnGetter]*ejectState)}
+}
+
+// Returns the policy for the auto_eject_hosts settings of the pool configuration.
+func (c PoolConfig) ejectionPolicy() EjectionPolicy {
+	return EjectionPolicy{
+		FailureLimit: c.ServerFailureLimit,
+		RetryTimeout: time.Duration(c.ServerRetryTimeout) * time.Millisecond,
+	}
+}
+
+// Indicates whether the input pool is ejected. Nothing is ejected if ejection is not enabled.
+func (e *ejector) ejected(pool ConnGetter) bool {
+	if e == nil {
+		return false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.state[pool]
+	return ok && s.ejected
+}
+
+// Returns the indices of the pools of the topology that are neither ejected nor quarantined.
+func (r *ProxyConn) liveIndexes(t *topology) []int {
+	idxs := make([]int, 0, len(t.pools))
+	for i, pool := range t.pools {
+		if !r.ejector.ejected(pool) && !r.quarantined(pool) {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
+
+// Records the outcome of a command on the input pool, ejecting it once it reaches the failure limit.
+func (r *ProxyConn) recordOutcome(pool ConnGetter, err error) {
+	e := r.ejector
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	s, ok := e.state[pool]
+	if !ok {
+		s = &ejectState{}
+		e.state[pool] = s
+	}
+
+	if s.ejected {
+		e.mu.Unlock()
+		return
+	}
+	if !isUnavailable(err) {
+		s.failures = 0
+		e.mu.Unlock()
+		return
+	}
+
+	s.failures++
+	eject := s.failures >= e.policy.FailureLimit
+	s.ejected = eject
+	e.mu.Unlock()
+
+	if eject {
+		server := r.topology().serverOf(pool)
+		r.counter("server_ejections", server, 1)
+		r.log().Warn("Instance ejected", "server", server, "failures", e.policy.FailureLimit, "err", err)
+		if e.policy.OnChange != nil {
+			e.policy.OnChange(server, true)
+		}
+		time.AfterFunc(e.policy.RetryTimeout, func() { r.retryEjected(e, pool) })
+	}
+}
+
+// Sends a PING to the input ejected pool and lets it rejoin if it answers, or else retries after the retry timeout.
+// Pools that have been removed from the topology are forgotten, and retries stop once the proxy is closed.
+func (r *ProxyConn) retryEjected(e *ejector, pool ConnGetter) {
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if closed {
+		return
+	}
+
+	t := r.topology()
+	if t.indexOf(pool) < 0 {
+		e.mu.Lock()
+		delete(e.state, pool)
+		e.mu.Unlock()
+		return
+	}
+
+	c := pool.Get()
+	_, err := c.Do("PING")
+	c.Close()
+
+	if err != nil {
+		time.AfterFunc(e.policy.RetryTimeout, func() { r.retryEjected(e, pool) })
+		return
+	}
+
+	e.mu.Lock()
+	delete(e.state, pool)
+	e.mu.Unlock()
+
+	server := t.serverOf(pool)
+	r.counter("server_rejoins", server, 1)
+	r.log().Info("Instance rejoined", "server", server)
+	if e.policy.OnChange != nil {
+		e.policy.OnChange(server, false)
+	}
+}
+
+// Returns the input indices without the input index.
+func without(idxs []int, i int) []int {
+	res := make([]int, 0, len(idxs))
+	for _, j := range idxs {
+		if j != i {
+			res = append(res, j)
+		}
+	}
+	return res
+}
+
+// Indicates whether the input indices include the input index.
+func containsIndex(idxs []int, i int) bool {
+	for _, j := range idxs {
+		if j == i {
+			return true
+		}
+	}
+	return false
+}
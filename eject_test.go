@@ -0,0 +1,109 @@
+package twunproxy
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A connection that fails with a network error while down, and counts the commands it receives.
+type flakyConn struct {
+	mu    sync.Mutex
+	down  bool
+	calls int
+}
+
+func (c *flakyConn) Do(string, ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if c.down {
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}
+	}
+	return "PONG", nil
+}
+
+func (c *flakyConn) Close() error { return nil }
+
+func (c *flakyConn) set(down bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down = down
+	return c.calls
+}
+
+func TestAutoEjectLeavesFailingInstanceOutOfDiscoveryUntilItRejoins(t *testing.T) {
+	flaky := &flakyConn{down: true}
+	proxy := getMockProxy(connPool{flaky}, connPool{&nilStyleConn{}})
+
+	changes := make(chan bool, 2)
+	WithAutoEject(EjectionPolicy{
+		FailureLimit: 2,
+		RetryTimeout: 50 * time.Millisecond,
+		OnChange:     func(server string, ejected bool) { changes <- ejected },
+	})(proxy)
+
+	canMap := func(v interface{}) bool { return v != nil }
+	for i := 0; i < 2; i++ {
+		proxy.Do(NewRedisCmd("GET", "KEY").NoCache(), canMap)
+	}
+	if ejected := <-changes; !ejected {
+		t.Fatal("Expected the failing instance to be ejected.")
+	}
+
+	calls := flaky.set(true)
+	if _, err := proxy.Do(NewRedisCmd("GET", "KEY"), canMap); err != ErrNoMapping {
+		t.Fatalf("Expected no mapping, got %v", err)
+	}
+	if flaky.set(false) != calls {
+		t.Fatal("Expected discovery to skip the ejected instance.")
+	}
+
+	select {
+	case ejected := <-changes:
+		if ejected {
+			t.Fatal("Expected the instance to rejoin.")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the instance to rejoin after the retry timeout.")
+	}
+
+	if _, err := proxy.Do(NewRedisCmd("GET", "KEY"), canMap); err != nil {
+		t.Fatalf("Unexpected error after rejoining: %v", err)
+	}
+	if server, _ := proxy.Lookup("KEY"); server != "0" {
+		t.Fatalf("Expected the key to map to the rejoined instance, got %q", server)
+	}
+}
+
+func TestAutoEjectIgnoresErrorReplies(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{err: errors.New("WRONGTYPE")}})
+	WithAutoEject(EjectionPolicy{FailureLimit: 1})(proxy)
+
+	for i := 0; i < 3; i++ {
+		proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil })
+	}
+	if proxy.ejector.ejected(proxy.Pools[0]) {
+		t.Fatal("Expected error replies not to eject the instance.")
+	}
+}
+
+func TestAutoEjectStopsRetryingOnceClosed(t *testing.T) {
+	flaky := &flakyConn{down: true}
+	proxy := getMockProxy(connPool{flaky}, connPool{&nilStyleConn{}})
+	proxy.poolsShared = true
+	WithAutoEject(EjectionPolicy{FailureLimit: 1, RetryTimeout: 10 * time.Millisecond})(proxy)
+
+	proxy.Do(NewRedisCmd("GET", "KEY").NoCache(), func(v interface{}) bool { return v != nil })
+	proxy.Close()
+
+	// A retry already scheduled may still fire, but finds the proxy closed and schedules no more.
+	time.Sleep(30 * time.Millisecond)
+	calls := flaky.set(true)
+	time.Sleep(50 * time.Millisecond)
+	if flaky.set(true) != calls {
+		t.Fatal("Expected no retries after the proxy was closed.")
+	}
+}
@@ -0,0 +1,110 @@
+package twunproxy
+
+import (
+	"sort"
+	"strings"
+)
+
+// EncodingCount is the number of sampled keys on one instance sharing a key prefix, type and encoding.
+// The prefix is the part of the key before the first colon, or the whole key if it has none.
+type EncodingCount struct {
+	Server   string `json:"server"`
+	Prefix   string `json:"prefix"`
+	Type     string `json:"type"`
+	Encoding string `json:"encoding"`
+	Count    int    `json:"count"`
+}
+
+// EncodingReport tallies the internal encodings of keys sampled from every instance.
+// Counts are ordered by server, prefix, type and encoding.
+type EncodingReport struct {
+	Sampled int             `json:"sampled"`
+	Counts  []EncodingCount `json:"counts"`
+}
+
+// EncodingReport samples up to the input number of random keys from each instance concurrently and tallies
+// their types and OBJECT ENCODING results, such as how many sorted sets are listpacks rather than skiplists.
+// Grouping by instance and key prefix attributes memory-inefficient encodings to specific shards and key patterns.
+// Keys are sampled with RANDOMKEY, so the same key may be counted more than once on small instances.
+func (r *ProxyConn) EncodingReport(sample int) (*EncodingReport, error) {
+	t := r.topology()
+	tallies := make([]map[EncodingCount]int, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		tallies[i] = make(map[EncodingCount]int)
+		for n := 0; n < sample; n++ {
+			v, err := c.Do("RANDOMKEY")
+			if err != nil {
+				return err
+			}
+
+			// The instance is empty.
+			key, ok := replyString(v)
+			if !ok {
+				return nil
+			}
+
+			ec, ok, err := keyEncoding(c, key)
+			if err != nil {
+				return err
+			}
+			if ok {
+				ec.Server = t.server(i)
+				tallies[i][ec]++
+			}
+		}
+		return nil
+	})
+
+	if err := firstError(errs); err != nil {
+		return nil, err
+	}
+
+	rep := &EncodingReport{Counts: make([]EncodingCount, 0)}
+	for _, tally := range tallies {
+		for ec, n := range tally {
+			ec.Count = n
+			rep.Counts = append(rep.Counts, ec)
+			rep.Sampled += n
+		}
+	}
+
+	sort.Slice(rep.Counts, func(a, b int) bool {
+		x, y := rep.Counts[a], rep.Counts[b]
+		if x.Server != y.Server {
+			return x.Server < y.Server
+		}
+		if x.Prefix != y.Prefix {
+			return x.Prefix < y.Prefix
+		}
+		if x.Type != y.Type {
+			return x.Type < y.Type
+		}
+		return x.Encoding < y.Encoding
+	})
+	return rep, nil
+}
+
+// Returns the prefix, type and encoding of the input key.
+// False is returned if the key expired or was deleted after it was sampled.
+func keyEncoding(c Conn, key string) (EncodingCount, bool, error) {
+	ec := EncodingCount{Prefix: key}
+	if i := strings.Index(key, ":"); i >= 0 {
+		ec.Prefix = key[:i]
+	}
+
+	v, err := c.Do("TYPE", key)
+	if err != nil {
+		return ec, false, err
+	}
+	if ec.Type, _ = replyString(v); ec.Type == "none" {
+		return ec, false, nil
+	}
+
+	v, err = c.Do("OBJECT", "ENCODING", key)
+	if err != nil {
+		return ec, false, err
+	}
+	ec.Encoding, _ = replyString(v)
+	return ec, v != nil, nil
+}
@@ -0,0 +1,40 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestEncodingReportTalliesByServerPrefixAndEncoding(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	gomock.InOrder(
+		mockConn1.EXPECT().Do("RANDOMKEY").Return([]byte("rank:a"), nil),
+		mockConn1.EXPECT().Do("TYPE", "rank:a").Return("zset", nil),
+		mockConn1.EXPECT().Do("OBJECT", "ENCODING", "rank:a").Return([]byte("skiplist"), nil),
+		mockConn1.EXPECT().Do("RANDOMKEY").Return([]byte("rank:b"), nil),
+		mockConn1.EXPECT().Do("TYPE", "rank:b").Return("zset", nil),
+		mockConn1.EXPECT().Do("OBJECT", "ENCODING", "rank:b").Return([]byte("skiplist"), nil),
+	)
+	mockConn1.EXPECT().Close()
+
+	// The second instance is empty.
+	mockConn2.EXPECT().Do("RANDOMKEY").Return(nil, nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+
+	rep, err := proxy.EncodingReport(2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	exp := EncodingCount{Server: "0", Prefix: "rank", Type: "zset", Encoding: "skiplist", Count: 2}
+	if rep.Sampled != 2 || len(rep.Counts) != 1 || rep.Counts[0] != exp {
+		t.Fatalf("Unexpected report: %+v", rep)
+	}
+}
@@ -0,0 +1,90 @@
+package twunproxy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Sentinel errors, matched with errors.Is.
+var (
+	// ErrNoMapping is returned when discovery finds no instance that accepts the reply of a command.
+	ErrNoMapping = errors.New("No results returned that could determine a key mapping.")
+
+	// ErrTimeout is matched by the errors of blocking commands that time out without a reply.
+	ErrTimeout = errors.New("Command timed out.")
+
+	// ErrPoolUnavailable is matched by errors returned when no instance can take a command,
+	// such as when no pools are configured, every instance is ejected, or the circuit of a pool is open.
+	ErrPoolUnavailable = errors.New("No instance is available.")
+)
+
+// TimeoutError is returned when the named blocking command times out without a reply. It matches ErrTimeout.
+type TimeoutError struct {
+	Command string
+}
+
+func (e *TimeoutError) Error() string {
+	return e.Command + " timed out."
+}
+
+// Is reports whether the target is ErrTimeout.
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// An error meaning that no instance is available, which matches ErrPoolUnavailable.
+type unavailableError string
+
+func (e unavailableError) Error() string {
+	return string(e)
+}
+
+func (e unavailableError) Is(target error) bool {
+	return target == ErrPoolUnavailable
+}
+
+// MultiError is returned by fan-outs when more than one instance fails, and by fan-out reads with partial results
+// enabled when every instance fails. Failed holds errors by server. errors.Is and errors.As match any of them.
+type MultiError struct {
+	Failed map[string]error
+}
+
+func (e *MultiError) Error() string {
+	return failuresString(e.Failed)
+}
+
+// Unwrap returns the errors of each instance, ordered by server.
+func (e *MultiError) Unwrap() []error {
+	return failuresList(e.Failed)
+}
+
+// Describes the input errors by server, ordered by server.
+func failuresString(failed map[string]error) string {
+	servers := make([]string, 0, len(failed))
+	for s := range failed {
+		servers = append(servers, s)
+	}
+	sort.Strings(servers)
+
+	for i, s := range servers {
+		servers[i] = s + ": " + failed[s].Error()
+	}
+	return fmt.Sprintf("%d instances failed: %s", len(servers), strings.Join(servers, "; "))
+}
+
+// Returns the input errors ordered by server.
+func failuresList(failed map[string]error) []error {
+	servers := make([]string, 0, len(failed))
+	for s := range failed {
+		servers = append(servers, s)
+	}
+	sort.Strings(servers)
+
+	errs := make([]error, len(servers))
+	for i, s := range servers {
+		errs[i] = failed[s]
+	}
+	return errs
+}
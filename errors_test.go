@@ -0,0 +1,42 @@
+package twunproxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBlockingTimeoutMatchesErrTimeout(t *testing.T) {
+	pool := connPool{&nilStyleConn{}}
+	proxy := getMockProxy(pool)
+	proxy.mapKey("KEY", pool)
+
+	_, err := proxy.BLPop("KEY", time.Second)
+	var te *TimeoutError
+	if !errors.Is(err, ErrTimeout) || !errors.As(err, &te) || te.Command != "BLPOP" {
+		t.Fatalf("Expected a BLPOP timeout, got %v", err)
+	}
+}
+
+func TestUnavailableErrorsMatchErrPoolUnavailable(t *testing.T) {
+	if _, err := getMockProxy().Do(NewRedisCmd("GET", "KEY"), nil); !errors.Is(err, ErrPoolUnavailable) {
+		t.Fatalf("Expected no pools to be unavailable, got %v", err)
+	}
+	if !errors.Is(&BreakerOpenError{Server: "a:6379"}, ErrPoolUnavailable) {
+		t.Fatal("Expected an open circuit to be unavailable.")
+	}
+}
+
+func TestFanOutFailuresReturnMultiError(t *testing.T) {
+	down := errors.New("down")
+	proxy := getMockProxy(connPool{&nilStyleConn{err: down}}, connPool{&nilStyleConn{err: errors.New("busy")}})
+
+	_, err := proxy.DoAll(NewCommand("PING"))
+	var me *MultiError
+	if !errors.As(err, &me) || me.Failed["0"] != down || !errors.Is(err, down) {
+		t.Fatalf("Expected a MultiError with each failure, got %v", err)
+	}
+	if err.Error() != "2 instances failed: 0: down; 1: busy" {
+		t.Fatalf("Unexpected message %q", err.Error())
+	}
+}
@@ -0,0 +1,166 @@
+package twunproxy
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultEvictionInterval is the interval between eviction samples if none is given.
+const DefaultEvictionInterval = 10 * time.Second
+
+// EvictionRate is the rate at which keys were evicted and expired on one instance over the last sampling interval.
+// Rates are in keys per second.
+type EvictionRate struct {
+	Server  string  `json:"server"`
+	Evicted float64 `json:"evicted_per_second"`
+	Expired float64 `json:"expired_per_second"`
+}
+
+// EvictionMonitor periodically samples evicted_keys and expired_keys from INFO stats on every instance.
+// Rates are derived from the deltas between consecutive samples and published to the proxy metrics sink as
+// "evicted_keys_per_second" and "expired_keys_per_second" per instance.
+// Markedly uneven eviction across instances is the usual symptom of a skewed key distribution,
+// so the ratio of the highest instance eviction rate to the mean is published as the pool-wide "eviction_skew" gauge.
+type EvictionMonitor struct {
+	proxy *ProxyConn
+	mu    sync.Mutex
+	last  map[string]evictionSample
+	rates map[string]EvictionRate
+	stop  chan bool
+	halt  func()
+}
+
+// A single reading of the cumulative eviction and expiry counters from an instance.
+type evictionSample struct {
+	at      time.Time
+	evicted int64
+	expired int64
+	ok      bool
+}
+
+// MonitorEvictions starts an EvictionMonitor sampling every instance at the input interval,
+// or at DefaultEvictionInterval if it is not positive.
+// Call Stop on the returned monitor, or Close on the proxy, to end sampling.
+func (r *ProxyConn) MonitorEvictions(interval time.Duration) *EvictionMonitor {
+	if interval <= 0 {
+		interval = DefaultEvictionInterval
+	}
+
+	m := newEvictionMonitor(r)
+	m.halt = r.onClose(func() { close(m.stop) })
+	go m.run(interval)
+	return m
+}
+
+// Creates a monitor for the input proxy without starting it.
+func newEvictionMonitor(r *ProxyConn) *EvictionMonitor {
+	return &EvictionMonitor{
+		proxy: r,
+		last:  make(map[string]evictionSample),
+		rates: make(map[string]EvictionRate),
+		stop:  make(chan bool),
+	}
+}
+
+// Samples immediately and then at the input interval until stopped.
+func (m *EvictionMonitor) run(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	m.sample()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-t.C:
+			m.sample()
+		}
+	}
+}
+
+// Rates returns the eviction and expiry rates of every instance calculated from the two most recent samples.
+func (m *EvictionMonitor) Rates() []EvictionRate {
+	t := m.proxy.topology()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rates := make([]EvictionRate, len(t.pools))
+	for i := range rates {
+		rates[i] = m.rates[t.server(i)]
+		rates[i].Server = t.server(i)
+	}
+	return rates
+}
+
+// Stop ends sampling.
+func (m *EvictionMonitor) Stop() {
+	m.halt()
+}
+
+// Reads the counters from every instance and updates rates for instances with a previous sample.
+func (m *EvictionMonitor) sample() {
+	r := m.proxy
+	t := r.topology()
+	samples := make([]evictionSample, len(t.pools))
+
+	t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("INFO", "stats")
+		if err != nil {
+			return err
+		}
+
+		info, err := parseInfo(v)
+		if err != nil {
+			return err
+		}
+
+		s := evictionSample{at: time.Now()}
+		if s.evicted, err = strconv.ParseInt(info["evicted_keys"], 10, 64); err != nil {
+			return err
+		}
+		if s.expired, err = strconv.ParseInt(info["expired_keys"], 10, 64); err != nil {
+			return err
+		}
+
+		s.ok = true
+		samples[i] = s
+		return nil
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var max, total float64
+	for i, s := range samples {
+		server := t.server(i)
+		prev := m.last[server]
+		rate := m.rates[server]
+
+		// Counters reset when an instance restarts, so skip intervals where they went backwards.
+		if s.ok && prev.ok && s.evicted >= prev.evicted && s.expired >= prev.expired {
+			secs := s.at.Sub(prev.at).Seconds()
+			if secs > 0 {
+				rate.Evicted = float64(s.evicted-prev.evicted) / secs
+				rate.Expired = float64(s.expired-prev.expired) / secs
+				m.rates[server] = rate
+				r.gauge("evicted_keys_per_second", server, rate.Evicted)
+				r.gauge("expired_keys_per_second", server, rate.Expired)
+			}
+		}
+
+		if rate.Evicted > max {
+			max = rate.Evicted
+		}
+		total += rate.Evicted
+
+		if s.ok {
+			m.last[server] = s
+		}
+	}
+
+	if total > 0 {
+		r.gauge("eviction_skew", "", max/(total/float64(len(samples))))
+	}
+}
@@ -0,0 +1,58 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestEvictionMonitorCalculatesRatesFromDeltas(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	gomock.InOrder(
+		mockConn1.EXPECT().Do("INFO", "stats").Return([]byte("evicted_keys:100\r\nexpired_keys:50\r\n"), nil),
+		mockConn1.EXPECT().Do("INFO", "stats").Return([]byte("evicted_keys:200\r\nexpired_keys:50\r\n"), nil),
+	)
+	gomock.InOrder(
+		mockConn2.EXPECT().Do("INFO", "stats").Return([]byte("evicted_keys:0\r\nexpired_keys:0\r\n"), nil),
+		mockConn2.EXPECT().Do("INFO", "stats").Return([]byte("evicted_keys:0\r\nexpired_keys:20\r\n"), nil),
+	)
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Close().Times(2)
+
+	metrics := newFakeMetrics()
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithMetrics(metrics)(proxy)
+
+	m := newEvictionMonitor(proxy)
+	m.sample()
+
+	// Pretend the first sample was taken ten seconds ago.
+	for server, s := range m.last {
+		s.at = s.at.Add(-10 * time.Second)
+		m.last[server] = s
+	}
+	m.sample()
+
+	rates := m.Rates()
+	if rates[0].Evicted < 9.9 || rates[0].Evicted > 10 || rates[0].Expired != 0 {
+		t.Fatalf("Unexpected rates: %+v", rates[0])
+	}
+
+	if rates[1].Evicted != 0 || rates[1].Expired < 1.9 || rates[1].Expired > 2 {
+		t.Fatalf("Unexpected rates: %+v", rates[1])
+	}
+
+	if skew := metrics.get("eviction_skew", ""); skew != 2 {
+		t.Fatalf("Unexpected eviction skew: %v", skew)
+	}
+}
+
+func TestMonitorEvictionsDefaultsNonPositiveInterval(t *testing.T) {
+	m := getMockProxy().MonitorEvictions(0)
+	time.Sleep(10 * time.Millisecond)
+	m.Stop()
+}
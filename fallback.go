@@ -0,0 +1,26 @@
+package twunproxy
+
+// Fallback adds tests that discovery applies, in order, when no instance returns a reply accepted by the canMap test
+// passed to Do. Discovery then waits for every instance to reply, rather than for the first accepted reply,
+// and returns the first reply to arrive that passes the earliest fallback test that any reply passes.
+// Replies with errors are never accepted by a fallback, so a test for nil accepts only a nil reply without an error.
+// Replies accepted by a fallback do not map the key, since they do not show which instance holds it.
+// For example, a pop that should return nil when no instance holds the list can accept an array reply with canMap
+// and fall back to a nil reply once every instance has replied.
+func (c *RedisCmd) Fallback(tests ...func(interface{}) bool) *RedisCmd {
+	c.fallbacks = append(c.fallbacks, tests...)
+	return c
+}
+
+// Returns the first of the input replies passing the earliest of the command's fallback tests that any reply passes.
+// If none passes, the return carries ErrNoMapping. Either way the pool index is -1, as the key is not located.
+func fallback(cmd *RedisCmd, replies []redisReturn) redisReturn {
+	for _, test := range cmd.fallbacks {
+		for _, rr := range replies {
+			if test(rr.val) {
+				return redisReturn{val: rr.val, pool: -1}
+			}
+		}
+	}
+	return redisReturn{val: nil, err: ErrNoMapping, pool: -1}
+}
@@ -0,0 +1,45 @@
+package twunproxy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFallbackAcceptsReplyOnceEveryInstanceReplies(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{err: errors.New("down")}}, connPool{&nilStyleConn{}})
+	isArray := func(v interface{}) bool {
+		_, ok := v.([]interface{})
+		return ok
+	}
+	isNil := func(v interface{}) bool { return v == nil }
+
+	v, err := proxy.Do(NewRedisCmd("BLPOP", "KEY", 1).Fallback(isNil), isArray)
+	if err != nil || v != nil {
+		t.Fatalf("Expected a nil reply from the fallback, got %v, %v", v, err)
+	}
+	if _, ok := proxy.Lookup("KEY"); ok {
+		t.Fatal("Expected no mapping for a reply accepted by a fallback.")
+	}
+
+	if _, err := proxy.Do(NewRedisCmd("BLPOP", "KEY", 1), isArray); err != ErrNoMapping {
+		t.Fatalf("Expected no mapping without a fallback, got %v", err)
+	}
+}
+
+func TestFallbacksAreTriedInOrder(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: "first"}}, connPool{&nilStyleConn{reply: int64(0)}})
+	never := func(interface{}) bool { return false }
+	isInt := func(v interface{}) bool {
+		_, ok := replyInt(v)
+		return ok
+	}
+	isString := func(v interface{}) bool {
+		_, ok := replyString(v)
+		return ok
+	}
+
+	v, err := proxy.Do(NewRedisCmd("GET", "KEY").Fallback(never, isInt, isString), never)
+	if err != nil || v != int64(0) {
+		t.Fatalf("Expected the reply accepted by the earliest fallback, got %v, %v", v, err)
+	}
+}
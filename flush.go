@@ -0,0 +1,49 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// FlushConfirmation is the confirmation FlushAll requires of proxies that were not created from a configuration,
+// and so have no pool name.
+const FlushConfirmation = "FLUSHALL"
+
+// Returned by FlushAll when the confirmation does not match.
+var errFlushNotConfirmed = errors.New("Flush not confirmed: the confirmation must be the pool name, or FLUSHALL for proxies without one.")
+
+// FlushAll deletes every key in the pool by issuing FLUSHDB ASYNC to each instance in turn, pausing for the input
+// interval between instances so that they do not all reclaim memory at once. It is meant for resetting test
+// environments. To guard against flushing the wrong pool by accident, confirm must be the name of the pool
+// the proxy was created for, or FlushConfirmation for proxies created otherwise; nothing is flushed if it is not.
+// The number of instances flushed is returned, and key mappings are cleared once any instance is flushed.
+// FLUSHDB ASYNC requires Redis 4.0 or later.
+func (r *ProxyConn) FlushAll(interval time.Duration, confirm string) (int, error) {
+	return r.FlushAllContext(context.Background(), interval, confirm)
+}
+
+// FlushAllContext flushes as for FlushAll, stopping without flushing further instances once the context ends.
+func (r *ProxyConn) FlushAllContext(ctx context.Context, interval time.Duration, confirm string) (int, error) {
+	want := r.poolName
+	if want == "" {
+		want = FlushConfirmation
+	}
+	if confirm != want {
+		return 0, errFlushNotConfirmed
+	}
+
+	res, err := r.eachInstance(ctx, InstanceOptions{}, Stagger{Interval: interval}, "FLUSHDB", "ASYNC")
+
+	n := 0
+	for _, ir := range res {
+		if ir.Issued {
+			n++
+		}
+	}
+	if n > 0 {
+		r.purgeMappings()
+		r.counter("flushed_instances", "", float64(n))
+	}
+	return n, err
+}
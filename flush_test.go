@@ -0,0 +1,42 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestFlushAllRequiresConfirmation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.poolName = "alpha"
+
+	if n, err := proxy.FlushAll(0, "beta"); err != errFlushNotConfirmed || n != 0 {
+		t.Fatalf("Expected confirmation error, got %d, %v", n, err)
+	}
+}
+
+func TestFlushAllFlushesEveryInstanceAndClearsMappings(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.KeyInstance["KEY"] = mockPool1
+
+	for _, c := range []*MockConn{mockConn1, mockConn2} {
+		c.EXPECT().Do("FLUSHDB", "ASYNC").Return("OK", nil)
+		c.EXPECT().Close()
+	}
+
+	n, err := proxy.FlushAll(0, FlushConfirmation)
+	if err != nil || n != 2 {
+		t.Fatalf("Unexpected result: %d, %v", n, err)
+	}
+	if len(proxy.KeyInstance) != 0 {
+		t.Fatal("Expected mappings to be cleared")
+	}
+}
@@ -0,0 +1,76 @@
+package twunproxy
+
+import (
+	"errors"
+)
+
+/******************************************************
+ * Redis Functions, available from Redis 7.0.
+ ******************************************************/
+
+// FunctionLoad loads the input library on every instance, so that its functions can be called with FCall
+// whichever instance holds the key. If replace is set, an existing library of the same name is replaced.
+// Every instance is first checked to run Redis 7.0 or later, and nothing is loaded if any does not.
+// The library name is returned. If loading fails on some instances, the library may be loaded on the others;
+// retrying with replace set is safe.
+func (r *ProxyConn) FunctionLoad(code string, replace bool) (string, error) {
+	t := r.topology()
+	if err := t.requireVersion(7, 0, "FUNCTION LOAD"); err != nil {
+		return "", err
+	}
+
+	args := []interface{}{"LOAD"}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+	args = append(args, code)
+
+	names := make([]string, len(t.pools))
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("FUNCTION", args...)
+		if err != nil {
+			return err
+		}
+		names[i], _ = replyString(v)
+		return nil
+	})
+
+	if err := firstError(errs); err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", errors.New("No instances to load the library on.")
+	}
+	return names[0], nil
+}
+
+// FCall calls the input function on the instance holding the input keys, with the remaining arguments.
+// At least one key is required for routing. All keys must share the same hash tag, as for Atomic.
+func (r *ProxyConn) FCall(function string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.fcall("FCALL", function, keys, args)
+}
+
+// FCallRO calls the input read-only function, as FCall.
+func (r *ProxyConn) FCallRO(function string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.fcall("FCALL_RO", function, keys, args)
+}
+
+// Runs FCALL or FCALL_RO routed by the first key.
+func (r *ProxyConn) fcall(name, function string, keys []string, args []interface{}) (interface{}, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("At least one key is required to route " + name + ".")
+	}
+
+	delims := r.colocationTag()
+	tag := hashTagOf(keys[0], delims)
+	rest := []interface{}{function, len(keys)}
+	for _, k := range keys[1:] {
+		if hashTagOf(k, delims) != tag {
+			return nil, errors.New("Keys do not share a hash tag: " + keys[0] + ", " + k + ".")
+		}
+		rest = append(rest, k)
+	}
+	rest = append(rest, args...)
+
+	return r.doKeyed(&RedisCmd{name: name, key: keys[0], args: rest, keyPos: 2}, name == "FCALL")
+}
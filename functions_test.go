@@ -0,0 +1,61 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestFunctionLoadBroadcastsToEveryInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	code := "#!lua name=lib\nredis.register_function('f', function(keys, args) return 1 end)"
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	for _, c := range []*MockConn{mockConn1, mockConn2} {
+		c.EXPECT().Do("INFO", "server").Return([]byte("# Server\r\nredis_version:7.2.4\r\n"), nil)
+		c.EXPECT().Do("FUNCTION", "LOAD", "REPLACE", code).Return([]byte("lib"), nil)
+		c.EXPECT().Close().Times(2)
+	}
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+
+	if name, err := proxy.FunctionLoad(code, true); err != nil || name != "lib" {
+		t.Fatalf("Unexpected result: %s, %v", name, err)
+	}
+}
+
+func TestFunctionLoadRejectsOldInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("INFO", "server").Return([]byte("redis_version:7.0.0\r\n"), nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("INFO", "server").Return([]byte("redis_version:6.2.14\r\n"), nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+
+	if _, err := proxy.FunctionLoad("code", false); err == nil {
+		t.Fatal("Expected error for Redis 6 instance.")
+	}
+}
+
+func TestFCallRoutesByFirstKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("FCALL", "f", 2, "{u1}:a", "{u1}:b", "x").Return(int64(1), nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["{u1}:a"] = mockPool
+
+	if v, err := proxy.FCall("f", []string{"{u1}:a", "{u1}:b"}, "x"); err != nil || v != int64(1) {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+}
@@ -0,0 +1,117 @@
+// Package goredis adapts go-redis clients to twunproxy.ConnGetter, so that NewProxyConn can be used without redigo.
+package goredis
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"github.com/txodds/twunproxy"
+	"strconv"
+)
+
+// DefaultOptions are the client options used by CreatePool. RESP2 is used, as twunproxy expects of the backends.
+var DefaultOptions = redis.Options{Protocol: 2}
+
+// CreatePool creates a go-redis client with the default options for a server line of the Twemproxy configuration.
+var CreatePool = NewCreatePool(DefaultOptions)
+
+// NewCreatePool returns a CreatePool that creates go-redis clients with the input options.
+// The network, address and password are set from each server line and the pool's redis_auth or the server's
+// override of it, so that Unix socket server lines are dialed as such. Clients select redis_db with SelectDB.
+// Commands are issued with Do, to which go-redis applies its read timeout whatever the command, so ReadTimeout
+// must exceed the timeout of any blocking command issued, or be -1 to disable it.
+func NewCreatePool(opts redis.Options) twunproxy.CreatePool {
+	return func(desc string, auth string) twunproxy.ConnGetter {
+		o := opts
+		o.Network, o.Addr = twunproxy.ServerNetwork(desc), twunproxy.ServerAddr(desc)
+		if auth != "" {
+			o.Password = auth
+		}
+		return &Pool{Client: redis.NewClient(&o)}
+	}
+}
+
+// Pool wraps a go-redis client to satisfy twunproxy.ConnGetter.
+// Each connection got is a dedicated connection from the client's pool, so that commands such as MULTI and EXEC
+// issued on it run on the same connection to the server.
+type Pool struct {
+	Client *redis.Client
+}
+
+// Get returns a dedicated connection from the client's pool.
+func (p *Pool) Get() twunproxy.Conn {
+	return &Conn{conn: p.Client.Conn()}
+}
+
+// SelectDB replaces the client with one for the input database, as twunproxy.DBSelector requires.
+// It should be called before the pool is used, as the previous client is closed.
+func (p *Pool) SelectDB(db int) error {
+	o := *p.Client.Options()
+	o.DB = db
+	old := p.Client
+	p.Client = redis.NewClient(&o)
+	return old.Close()
+}
+
+// Close closes the client and its connection pool, as ProxyConn.Close requires.
+func (p *Pool) Close() error {
+	return p.Client.Close()
+}
+
+// Conn wraps a dedicated go-redis connection to satisfy twunproxy.Conn.
+type Conn struct {
+	conn *redis.Conn
+}
+
+// Do runs the input command, translating the go-redis result to the reply types twunproxy expects.
+// A redis.Nil error is a nil reply. Bulk and status replies are both strings, as go-redis does not distinguish them.
+func (c *Conn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	ctx := context.Background()
+	cmd := redis.NewCmd(ctx, append([]interface{}{commandName}, args...)...)
+	c.conn.Process(ctx, cmd)
+
+	v, err := cmd.Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reply(v), nil
+}
+
+// IsNilReply returns true for redis.Nil.
+func (c *Conn) IsNilReply(err error) bool {
+	return err == redis.Nil
+}
+
+// Close returns the connection to the client's pool.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Translates RESP3 types returned by go-redis to their RESP2 equivalents: maps become flat arrays of keys and values,
+// booleans become integers and doubles become strings.
+func reply(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, e := range t {
+			res[i] = reply(e)
+		}
+		return res
+	case map[interface{}]interface{}:
+		res := make([]interface{}, 0, 2*len(t))
+		for k, e := range t {
+			res = append(res, reply(k), reply(e))
+		}
+		return res
+	case bool:
+		if t {
+			return int64(1)
+		}
+		return int64(0)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return v
+}
@@ -0,0 +1,44 @@
+package goredis
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/txodds/twunproxy/conformance"
+	"testing"
+)
+
+func TestCreatePoolConforms(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.RequireAuth("secret")
+
+	pool := CreatePool(s.Addr()+":1 server1", "secret").(*Pool)
+	defer pool.Client.Close()
+
+	conformance.Run(t, pool)
+}
+
+func TestReplyTranslatesRESP3Types(t *testing.T) {
+	v := reply([]interface{}{true, 1.5, map[interface{}]interface{}{"field": "value"}}).([]interface{})
+	if v[0] != int64(1) || v[1] != "1.5" {
+		t.Fatalf("Unexpected reply: %#v", v)
+	}
+	if m := v[2].([]interface{}); len(m) != 2 || m[0] != "field" || m[1] != "value" {
+		t.Fatalf("Unexpected map translation: %#v", v[2])
+	}
+}
+
+func TestSelectDBSelectsDatabase(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.DB(2).Set("key", "value")
+
+	pool := CreatePool(s.Addr()+":1", "").(*Pool)
+	defer pool.Close()
+	if err := pool.SelectDB(2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c := pool.Get()
+	defer c.Close()
+	if v, err := c.Do("GET", "key"); err != nil || v != "value" {
+		t.Fatalf("Expected value from database 2, got %v and %v", v, err)
+	}
+}
@@ -0,0 +1,195 @@
+package twunproxy
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// InstanceState classifies an instance before an administrative operation, from INFO replication and persistence.
+// Persisting is set while an RDB save or AOF rewrite is in progress. Instances that could not be classified
+// carry their error.
+type InstanceState struct {
+	Server     string `json:"server"`
+	Name       string `json:"name"`
+	Role       string `json:"role,omitempty"`
+	Loading    bool   `json:"loading"`
+	Persisting bool   `json:"persisting"`
+	Err        error  `json:"-"`
+}
+
+// AdminGuard configures the checks WithAdminGuard makes before administrative operations.
+// PersistWait bounds the wait for saves and AOF rewrites in progress to complete before BGSAVE or FLUSHDB is sent;
+// zero refuses at once. PollInterval is the interval between checks while waiting, DefaultStaggerPoll if zero.
+type AdminGuard struct {
+	PersistWait  time.Duration
+	PollInterval time.Duration
+}
+
+// GuardError is returned when the admin guard refuses an operation. Op is the command refused,
+// and Servers are the addresses of the instances whose state caused the refusal.
+type GuardError struct {
+	Op      string
+	Reason  string
+	Servers []string
+}
+
+func (e *GuardError) Error() string {
+	return e.Op + " refused: " + e.Reason + " (" + strings.Join(e.Servers, ", ") + ")."
+}
+
+// The context key marking administrative operations that bypass the guard.
+type forceAdminKey struct{}
+
+// WithAdminGuard classifies every instance before Promote, BGSave, ConfigSet and FlushAll, and their variants,
+// and refuses operations that the state of the pool makes unsafe, returning a *GuardError without sending anything:
+//
+//   - Every operation is refused if an instance cannot be classified or is loading its dataset.
+//   - Promotion is refused if the pool holds both masters and replicas, since promoting the replicas
+//     would leave two masters for the same data.
+//   - FlushAll is refused if the pool holds replicas, which cannot be flushed.
+//   - BGSave and FlushAll wait, up to the PersistWait of the guard, for saves and AOF rewrites in progress
+//     to complete, so that a second fork or a flush does not compete with them for memory.
+//
+// Pass a context from ForceAdmin to the Context variants to override the guard for one operation.
+func WithAdminGuard(g AdminGuard) Option {
+	return func(r *ProxyConn) {
+		r.adminGuard = &g
+	}
+}
+
+// ForceAdmin returns a context for administrative operations that bypasses the guard set by WithAdminGuard,
+// such as to promote replicas deliberately after their master has been lost.
+func ForceAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceAdminKey{}, true)
+}
+
+// InstanceStates classifies every instance concurrently, in order, as the admin guard does.
+// The first error of an instance is returned with the results.
+func (r *ProxyConn) InstanceStates(ctx context.Context) ([]InstanceState, error) {
+	t := r.topology()
+	res := make([]InstanceState, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		repl, err := infoSection(ctx, c, "replication")
+		if err != nil {
+			return err
+		}
+		persist, err := infoSection(ctx, c, "persistence")
+		if err != nil {
+			return err
+		}
+
+		res[i].Role = repl["role"]
+		res[i].Loading = persist["loading"] == "1"
+		res[i].Persisting = forking(persist)
+		return nil
+	})
+
+	for i, err := range errs {
+		res[i].Server = t.server(i)
+		res[i].Name = t.instance(i).Name
+		res[i].Err = err
+	}
+	return res, firstError(errs)
+}
+
+// Checks the state of the pool before the input administrative command, if the guard is set and the context
+// does not force the command. Waits for persistence in progress to complete before BGSAVE and FLUSHDB.
+func (r *ProxyConn) guardAdmin(ctx context.Context, op string) error {
+	g := r.adminGuard
+	if g == nil {
+		return nil
+	}
+	if force, _ := ctx.Value(forceAdminKey{}).(bool); force {
+		return nil
+	}
+
+	waitPersist := op == "BGSAVE" || op == "FLUSHDB"
+	var deadline <-chan time.Time
+	if waitPersist && g.PersistWait > 0 {
+		timer := time.NewTimer(g.PersistWait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		states, _ := r.InstanceStates(ctx)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := guardCheck(op, states, waitPersist)
+		if err == nil {
+			return nil
+		}
+		if ge := err.(*GuardError); ge.Reason != guardPersisting || deadline == nil {
+			r.counter("admin_refusals", "", 1)
+			r.log().Warn("Administrative command refused", "command", op, "reason", ge.Reason, "servers", ge.Servers)
+			return err
+		}
+
+		poll := g.PollInterval
+		if poll <= 0 {
+			poll = DefaultStaggerPoll
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			deadline = nil
+		case <-time.After(poll):
+		}
+	}
+}
+
+// Reason given when the guard refuses an operation because persistence is in progress.
+const guardPersisting = "a save or AOF rewrite is in progress"
+
+// Returns a *GuardError if the input states make the administrative command unsafe, or nil.
+func guardCheck(op string, states []InstanceState, waitPersist bool) error {
+	refuse := func(reason string, match func(InstanceState) bool) error {
+		var servers []string
+		for _, s := range states {
+			if match(s) {
+				servers = append(servers, s.Server)
+			}
+		}
+		if len(servers) == 0 {
+			return nil
+		}
+		sort.Strings(servers)
+		return &GuardError{Op: op, Reason: reason, Servers: servers}
+	}
+
+	if err := refuse("instance state unknown", func(s InstanceState) bool { return s.Err != nil }); err != nil {
+		return err
+	}
+	if err := refuse("instance is loading its dataset", func(s InstanceState) bool { return s.Loading }); err != nil {
+		return err
+	}
+
+	switch op {
+	case "SLAVEOF":
+		for _, s := range states {
+			if s.Role != "master" {
+				continue
+			}
+			return refuse("pool has both masters and replicas", func(s InstanceState) bool {
+				return s.Role != "master"
+			})
+		}
+	case "FLUSHDB":
+		if err := refuse("replicas cannot be flushed", func(s InstanceState) bool {
+			return s.Role != "master"
+		}); err != nil {
+			return err
+		}
+	}
+
+	if waitPersist {
+		return refuse(guardPersisting, func(s InstanceState) bool { return s.Persisting })
+	}
+	return nil
+}
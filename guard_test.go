@@ -0,0 +1,143 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A connection to an instance whose INFO reports the role and persistence state set on it.
+// Other commands are recorded and answered with OK.
+type stateConn struct {
+	mu         sync.Mutex
+	role       string
+	loading    bool
+	persisting int
+	sent       []string
+}
+
+func (c *stateConn) Close() error { return nil }
+
+func (c *stateConn) Do(name string, args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if name != "INFO" {
+		c.sent = append(c.sent, name)
+		return "OK", nil
+	}
+
+	switch args[0] {
+	case "replication":
+		return "# Replication\r\nrole:" + c.role + "\r\n", nil
+	case "persistence":
+		loading, forking := "0", "0"
+		if c.loading {
+			loading = "1"
+		}
+		if c.persisting > 0 {
+			c.persisting--
+			forking = "1"
+		}
+		return "# Persistence\r\nloading:" + loading + "\r\nrdb_bgsave_in_progress:" + forking + "\r\n", nil
+	}
+	return nil, errors.New("Unexpected INFO section.")
+}
+
+func (c *stateConn) commands() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.sent...)
+}
+
+func getGuardedProxy(g AdminGuard, conns ...*stateConn) *ProxyConn {
+	pools := make([]ConnGetter, len(conns))
+	for i, c := range conns {
+		pools[i] = connPool{c}
+	}
+
+	proxy := getMockProxy(pools...)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}[:len(conns)]
+	WithAdminGuard(g)(proxy)
+	return proxy
+}
+
+func TestAdminGuardRefusesPromotingMixedPool(t *testing.T) {
+	master, replica := &stateConn{role: "master"}, &stateConn{role: "slave"}
+	proxy := getGuardedProxy(AdminGuard{}, master, replica)
+
+	_, err := proxy.PromoteVerified(context.Background(), InstanceOptions{})
+	var ge *GuardError
+	if !errors.As(err, &ge) || ge.Op != "SLAVEOF" || len(ge.Servers) != 1 || ge.Servers[0] != "b:6379" {
+		t.Fatalf("Expected promotion to be refused for the replica, got %v", err)
+	}
+	if _, err := proxy.PromoteEach(context.Background(), InstanceOptions{}); !errors.As(err, &ge) {
+		t.Fatalf("Expected PromoteEach to be refused, got %v", err)
+	}
+	if len(replica.commands()) != 0 {
+		t.Fatalf("Expected nothing to be sent, got %v", replica.commands())
+	}
+
+	res, err := proxy.PromoteEach(ForceAdmin(context.Background()), InstanceOptions{})
+	if err != nil || !res[1].Issued {
+		t.Fatalf("Expected a forced promotion to proceed, got %v, %v", res, err)
+	}
+}
+
+func TestAdminGuardAllowsPromotingReplicas(t *testing.T) {
+	a, b := &stateConn{role: "slave"}, &stateConn{role: "slave"}
+	proxy := getGuardedProxy(AdminGuard{}, a, b)
+
+	if _, err := proxy.PromoteEach(context.Background(), InstanceOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(a.commands()) != 1 || len(b.commands()) != 1 {
+		t.Fatal("Expected every replica to be promoted.")
+	}
+}
+
+func TestAdminGuardRefusesLoadingInstances(t *testing.T) {
+	a, b := &stateConn{role: "master"}, &stateConn{role: "master", loading: true}
+	proxy := getGuardedProxy(AdminGuard{}, a, b)
+
+	_, err := proxy.ConfigSet("maxmemory", "1gb")
+	if ge, ok := err.(*GuardError); !ok || ge.Servers[0] != "b:6379" {
+		t.Fatalf("Expected CONFIG SET to be refused, got %v", err)
+	}
+	if len(a.commands()) != 0 {
+		t.Fatal("Expected nothing to be sent.")
+	}
+}
+
+func TestAdminGuardRefusesFlushingReplicas(t *testing.T) {
+	a, b := &stateConn{role: "master"}, &stateConn{role: "slave"}
+	proxy := getGuardedProxy(AdminGuard{}, a, b)
+
+	n, err := proxy.FlushAll(0, FlushConfirmation)
+	if _, ok := err.(*GuardError); !ok || n != 0 {
+		t.Fatalf("Expected the flush to be refused, got %d, %v", n, err)
+	}
+}
+
+func TestAdminGuardWaitsForPersistence(t *testing.T) {
+	a, b := &stateConn{role: "master"}, &stateConn{role: "master", persisting: 2}
+	proxy := getGuardedProxy(AdminGuard{PersistWait: time.Second, PollInterval: time.Millisecond}, a, b)
+
+	if n, err := proxy.BGSave(0); err != nil || n != 2 {
+		t.Fatalf("Expected saves once persistence completed, got %d, %v", n, err)
+	}
+
+	b.mu.Lock()
+	b.persisting = 1000
+	b.mu.Unlock()
+	proxy.adminGuard.PersistWait = 5 * time.Millisecond
+	_, err := proxy.BGSaveEach(context.Background(), 0, InstanceOptions{})
+	if ge, ok := err.(*GuardError); !ok || ge.Reason != guardPersisting {
+		t.Fatalf("Expected the save to be refused after waiting, got %v", err)
+	}
+	if len(b.commands()) != 1 {
+		t.Fatalf("Expected no further save, got %v", b.commands())
+	}
+}
@@ -0,0 +1,47 @@
+package twunproxy
+
+import (
+	"testing"
+)
+
+func TestHashFuncsMatchKnownValues(t *testing.T) {
+	cases := []struct {
+		name string
+		key  string
+		want uint32
+	}{
+		{"fnv1a_32", "a", 0xe40c292c},
+		{"fnv1_32", "a", 0x050c5d7e},
+		{"fnv1a_64", "a", 0x8601ec8c},
+		{"crc32a", "123456789", 0xcbf43926},
+		{"crc32", "123456789", 0x4bf4},
+		{"md5", "", 0xd98c1dd4},
+	}
+
+	for _, c := range cases {
+		f, err := getHashFunc(c.name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := f([]byte(c.key)); got != c.want {
+			t.Errorf("%s(%q) = %#x, expected %#x", c.name, c.key, got, c.want)
+		}
+	}
+}
+
+func TestCRC16MatchesXModemCheckValue(t *testing.T) {
+	if got := hashCRC16([]byte("123456789")) & 0xffff; got != 0x31c3 {
+		t.Fatalf("Unexpected CRC16: %#x", got)
+	}
+}
+
+func TestGetHashFuncDefaultsAndRejectsUnknown(t *testing.T) {
+	f, err := getHashFunc("")
+	if err != nil || f([]byte("a")) != hashFNV1a_64([]byte("a")) {
+		t.Fatal("Expected fnv1a_64 by default.")
+	}
+
+	if _, err := getHashFunc("hsieh"); err == nil {
+		t.Fatal("Expected error for unsupported hash function.")
+	}
+}
@@ -0,0 +1,97 @@
+package twunproxy
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// HealthThresholds are the limits above which an INFO field raises a health warning.
+type HealthThresholds struct {
+	MaxFragmentation       float64
+	MaxEvictedKeys         int64
+	MaxRejectedConnections int64
+}
+
+// DefaultHealthThresholds warns on fragmentation above 1.5 and on any evictions or rejected connections.
+var DefaultHealthThresholds = HealthThresholds{MaxFragmentation: 1.5}
+
+// InstanceHealth is the health of a single instance.
+// Score ranges from 0 (unreachable or failing every check) to 1 (no warnings).
+type InstanceHealth struct {
+	Server   string   `json:"server"`
+	Score    float64  `json:"score"`
+	Warnings []string `json:"warnings"`
+	Err      error    `json:"-"`
+}
+
+// HealthReport combines the health of every instance into a pool-level score, which is their mean.
+type HealthReport struct {
+	Score     float64          `json:"score"`
+	Instances []InstanceHealth `json:"instances"`
+}
+
+// The number of checks applied to each instance. Each failed check reduces the instance score equally.
+const healthChecks = 4
+
+// Health queries INFO on every instance concurrently and scores each against the input thresholds.
+// Checks cover memory fragmentation, evicted keys, rejected connections and the status of the last BGSAVE.
+// Instances that cannot be queried score 0 and carry the error.
+func (r *ProxyConn) Health(th HealthThresholds) *HealthReport {
+	t := r.topology()
+	rep := &HealthReport{Instances: make([]InstanceHealth, len(t.pools))}
+
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("INFO")
+		if err != nil {
+			return err
+		}
+
+		info, err := parseInfo(v)
+		if err != nil {
+			return err
+		}
+
+		rep.Instances[i].Warnings = healthWarnings(info, th)
+		return nil
+	})
+
+	var total float64
+	for i, err := range errs {
+		h := &rep.Instances[i]
+		h.Server = t.server(i)
+		h.Err = err
+
+		if err == nil {
+			h.Score = 1 - float64(len(h.Warnings))/healthChecks
+		}
+		total += h.Score
+	}
+
+	if len(t.pools) > 0 {
+		rep.Score = total / float64(len(t.pools))
+	}
+	return rep
+}
+
+// Returns a warning for each check that the input INFO fields fail.
+func healthWarnings(info map[string]string, th HealthThresholds) []string {
+	warnings := make([]string, 0)
+
+	if f, err := strconv.ParseFloat(info["mem_fragmentation_ratio"], 64); err == nil && f > th.MaxFragmentation {
+		warnings = append(warnings, fmt.Sprintf("Memory fragmentation ratio %.2f exceeds %.2f.", f, th.MaxFragmentation))
+	}
+
+	if n, err := strconv.ParseInt(info["evicted_keys"], 10, 64); err == nil && n > th.MaxEvictedKeys {
+		warnings = append(warnings, fmt.Sprintf("%d keys evicted.", n))
+	}
+
+	if n, err := strconv.ParseInt(info["rejected_connections"], 10, 64); err == nil && n > th.MaxRejectedConnections {
+		warnings = append(warnings, fmt.Sprintf("%d connections rejected.", n))
+	}
+
+	if s, ok := info["rdb_last_bgsave_status"]; ok && s != "ok" {
+		warnings = append(warnings, "Last background save failed.")
+	}
+
+	return warnings
+}
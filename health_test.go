@@ -0,0 +1,43 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestHealthScoresInstancesAndPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn3, mockPool3 := setupMockPool(ctrl)
+
+	mockConn1.EXPECT().Do("INFO").Return([]byte(
+		"mem_fragmentation_ratio:1.10\r\nevicted_keys:0\r\nrejected_connections:0\r\nrdb_last_bgsave_status:ok\r\n"), nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("INFO").Return([]byte(
+		"mem_fragmentation_ratio:2.50\r\nevicted_keys:12\r\nrejected_connections:0\r\nrdb_last_bgsave_status:err\r\n"), nil)
+	mockConn2.EXPECT().Close()
+	mockConn3.EXPECT().Do("INFO").Return(nil, errors.New("connection refused"))
+	mockConn3.EXPECT().Close()
+
+	rep := getMockProxy(mockPool1, mockPool2, mockPool3).Health(DefaultHealthThresholds)
+
+	if rep.Instances[0].Score != 1 || len(rep.Instances[0].Warnings) != 0 {
+		t.Fatalf("Unexpected health for healthy instance: %+v", rep.Instances[0])
+	}
+
+	if rep.Instances[1].Score != 0.25 || len(rep.Instances[1].Warnings) != 3 {
+		t.Fatalf("Unexpected health for degraded instance: %+v", rep.Instances[1])
+	}
+
+	if rep.Instances[2].Score != 0 || rep.Instances[2].Err == nil {
+		t.Fatalf("Unexpected health for unreachable instance: %+v", rep.Instances[2])
+	}
+
+	if rep.Score != 1.25/3 {
+		t.Fatalf("Unexpected pool score: %v", rep.Score)
+	}
+}
@@ -0,0 +1,76 @@
+package twunproxy
+
+import (
+	"sync"
+)
+
+// WithMaxInFlight limits the total number of backend commands that the proxy has outstanding at once.
+// This protects the file-descriptor and memory budget of the process when many goroutines issue wide discovery
+// fan-outs simultaneously. A fan-out counts one command per pool. Callers wait in arrival order for capacity,
+// and a fan-out is admitted whole, so that no caller is starved by a stream of smaller requests.
+func WithMaxInFlight(n int) Option {
+	return func(r *ProxyConn) {
+		if n > 0 {
+			r.inflight = &inflightLimiter{capacity: n}
+		}
+	}
+}
+
+// InflightLimiter is a counting semaphore that admits waiters strictly in arrival order.
+type inflightLimiter struct {
+	mu       sync.Mutex
+	capacity int
+	used     int
+	waiters  []*inflightWaiter
+}
+
+// A caller waiting for capacity. The ready channel is closed once its slots are granted.
+type inflightWaiter struct {
+	n     int
+	ready chan bool
+}
+
+// Waits until the input number of slots are available and takes them, returning the number taken.
+// Requests larger than the capacity are reduced to it, so that they can be admitted.
+// A nil limiter admits everything immediately.
+func (l *inflightLimiter) acquire(n int) int {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	if n > l.capacity {
+		n = l.capacity
+	}
+
+	if len(l.waiters) == 0 && l.used+n <= l.capacity {
+		l.used += n
+		l.mu.Unlock()
+		return n
+	}
+
+	w := &inflightWaiter{n: n, ready: make(chan bool)}
+	l.waiters = append(l.waiters, w)
+	l.mu.Unlock()
+
+	<-w.ready
+	return n
+}
+
+// Returns the input number of slots and admits as many waiters as now fit, in arrival order.
+func (l *inflightLimiter) release(n int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.used -= n
+	for len(l.waiters) > 0 && l.used+l.waiters[0].n <= l.capacity {
+		w := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		l.used += w.n
+		close(w.ready)
+	}
+}
@@ -0,0 +1,55 @@
+package twunproxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInflightLimiterAdmitsInArrivalOrder(t *testing.T) {
+	l := &inflightLimiter{capacity: 3}
+	if n := l.acquire(2); n != 2 {
+		t.Fatalf("Unexpected slots: %d", n)
+	}
+
+	order := make(chan int, 2)
+	go func() {
+		order <- l.acquire(5)
+	}()
+
+	// Wait for the wide request to queue, then issue a narrow one that would otherwise fit.
+	for {
+		l.mu.Lock()
+		n := len(l.waiters)
+		l.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	go func() {
+		order <- l.acquire(1)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case n := <-order:
+		t.Fatalf("Expected no admission before release, got %d", n)
+	default:
+	}
+
+	l.release(2)
+	if n := <-order; n != 3 {
+		t.Fatalf("Expected clamped wide request first, got %d", n)
+	}
+
+	l.release(3)
+	if n := <-order; n != 1 {
+		t.Fatalf("Expected narrow request second, got %d", n)
+	}
+}
+
+func TestNilInflightLimiterAdmitsEverything(t *testing.T) {
+	var l *inflightLimiter
+	l.release(l.acquire(100))
+}
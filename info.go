@@ -0,0 +1,133 @@
+package twunproxy
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// InstanceInfo is the INFO of a single instance, with commonly used fields decoded.
+// Decoded fields are zero if the section requested does not include them. Fields holds every field as returned.
+type InstanceInfo struct {
+	Server           string            `json:"server"`
+	Version          string            `json:"redis_version,omitempty"`
+	Role             string            `json:"role,omitempty"`
+	UptimeSeconds    int64             `json:"uptime_in_seconds"`
+	ConnectedClients int64             `json:"connected_clients"`
+	BlockedClients   int64             `json:"blocked_clients"`
+	UsedMemory       int64             `json:"used_memory"`
+	MaxMemory        int64             `json:"maxmemory"`
+	ConnectedSlaves  int64             `json:"connected_slaves"`
+	MasterReplOffset int64             `json:"master_repl_offset"`
+	SlaveReplOffset  int64             `json:"slave_repl_offset"`
+	MasterLinkStatus string            `json:"master_link_status,omitempty"`
+	Fields           map[string]string `json:"fields"`
+	Err              error             `json:"-"`
+}
+
+// Info queries INFO for the input section on every instance concurrently and decodes each reply.
+// An empty section requests the default sections. Instances that fail carry their error, and the first error
+// is returned with the results, or a PartialError if partial results are enabled.
+func (r *ProxyConn) Info(section string) ([]InstanceInfo, error) {
+	t := r.topology()
+	res := make([]InstanceInfo, len(t.pools))
+
+	args := []interface{}{}
+	if section != "" {
+		args = append(args, section)
+	}
+
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("INFO", args...)
+		if err != nil {
+			return err
+		}
+
+		info, err := parseInfo(v)
+		if err != nil {
+			return err
+		}
+		res[i] = decodeInfo(info)
+		return nil
+	})
+
+	for i, err := range errs {
+		res[i].Server = t.server(i)
+		res[i].Err = err
+	}
+	return res, r.fanOutError(t, errs)
+}
+
+// Decodes the commonly used fields of the input INFO fields.
+func decodeInfo(info map[string]string) InstanceInfo {
+	num := func(field string) int64 {
+		n, _ := strconv.ParseInt(info[field], 10, 64)
+		return n
+	}
+
+	return InstanceInfo{
+		Version:          info["redis_version"],
+		Role:             info["role"],
+		UptimeSeconds:    num("uptime_in_seconds"),
+		ConnectedClients: num("connected_clients"),
+		BlockedClients:   num("blocked_clients"),
+		UsedMemory:       num("used_memory"),
+		MaxMemory:        num("maxmemory"),
+		ConnectedSlaves:  num("connected_slaves"),
+		MasterReplOffset: num("master_repl_offset"),
+		SlaveReplOffset:  num("slave_repl_offset"),
+		MasterLinkStatus: info["master_link_status"],
+		Fields:           info,
+	}
+}
+
+// ParseInfo turns the reply of an INFO command into a map of field names to values.
+// Section headers, blank lines and comments are skipped.
+func parseInfo(v interface{}) (map[string]string, error) {
+	s, ok := replyString(v)
+	if !ok {
+		return nil, errors.New("Unexpected INFO reply type.")
+	}
+
+	fields := make(map[string]string)
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if i := strings.Index(line, ":"); i > 0 {
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+
+	return fields, nil
+}
+
+// ReplyString converts a bulk or status reply to a string.
+func replyString(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case []byte:
+		return string(t), true
+	case string:
+		return t, true
+	}
+	return "", false
+}
+
+// ReplyBytes converts a bulk or status reply to bytes.
+func replyBytes(v interface{}) []byte {
+	switch t := v.(type) {
+	case []byte:
+		return t
+	case string:
+		return []byte(t)
+	}
+	return nil
+}
+
+// ReplyInt converts an integer reply to an int64.
+func replyInt(v interface{}) (int64, bool) {
+	n, ok := v.(int64)
+	return n, ok
+}
@@ -0,0 +1,31 @@
+package twunproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInfoDecodesInstances(t *testing.T) {
+	info := "# Replication\r\nrole:slave\r\nmaster_link_status:up\r\nslave_repl_offset:42\r\n# Clients\r\nconnected_clients:7\r\n"
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: []byte(info)}}, connPool{&nilStyleConn{err: errors.New("down")}})
+
+	res, err := proxy.Info("")
+	if err == nil {
+		t.Fatal("Expected error from the failed instance")
+	}
+
+	i := res[0]
+	if i.Role != "slave" || i.MasterLinkStatus != "up" || i.SlaveReplOffset != 42 || i.ConnectedClients != 7 || i.Fields["role"] != "slave" {
+		t.Fatalf("Unexpected info: %+v", i)
+	}
+	if res[1].Server != "1" || res[1].Err == nil {
+		t.Fatalf("Unexpected failed instance: %+v", res[1])
+	}
+
+	b, _ := json.Marshal(res[1])
+	if !strings.Contains(string(b), `"error":"down"`) {
+		t.Fatalf("Expected error in JSON, got %s", b)
+	}
+}
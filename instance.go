@@ -0,0 +1,90 @@
+package twunproxy
+
+import (
+	"sort"
+)
+
+// Instance describes a Redis instance of a pool, from its Twemproxy server descriptor.
+// Name is the name Twemproxy places keys by: the name given in the descriptor, or else its address.
+// Weight is the share of the key space Twemproxy gives the instance relative to the others.
+// Healthy and Role are only set by ProxyConn.Instances.
+type Instance struct {
+	Name    string `json:"name"`
+	Addr    string `json:"addr"`
+	Weight  int    `json:"weight"`
+	Healthy bool   `json:"healthy"`
+	Role    string `json:"role,omitempty"`
+}
+
+// ParseInstance returns the instance described by a Twemproxy server descriptor of the form
+// "host:port:weight name". A missing weight is 1.
+func ParseInstance(desc string) Instance {
+	addr, name, weight := parseServer(desc)
+	return Instance{Name: name, Addr: addr, Weight: weight}
+}
+
+// Instances returns the instances described by the servers of the pool configuration, in order.
+func (c PoolConfig) Instances() []Instance {
+	res := make([]Instance, len(c.Servers))
+	for i, desc := range c.Servers {
+		res[i] = ParseInstance(desc)
+	}
+	return res
+}
+
+// Instances describes each instance of the pool, in order, querying the role of each concurrently with
+// INFO replication. An instance is healthy if it answers, is neither ejected nor quarantined, and its circuit
+// breaker, if any, is not open. Instances that do not answer have no role.
+func (r *ProxyConn) Instances() []Instance {
+	t := r.topology()
+	res := make([]Instance, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("INFO", "replication")
+		if err != nil {
+			return err
+		}
+
+		info, err := parseInfo(v)
+		if err != nil {
+			return err
+		}
+		res[i].Role = info["role"]
+		return nil
+	})
+
+	for i, pool := range t.pools {
+		inst := t.instance(i)
+		inst.Role = res[i].Role
+		inst.Healthy = errs[i] == nil && !r.ejector.ejected(pool) && !r.quarantined(pool)
+		if b, ok := pool.(*Breaker); ok && b.Status().State == BreakerOpen {
+			inst.Healthy = false
+		}
+		res[i] = inst
+	}
+	return res
+}
+
+// Returns the instance at the input index, named by its index if no descriptor is known for it.
+func (t *topology) instance(i int) Instance {
+	if i >= len(t.servers) {
+		return Instance{Name: t.server(i), Addr: t.server(i), Weight: 1}
+	}
+	return ParseInstance(t.servers[i])
+}
+
+// Returns the weight of the instance at the input index, or 1 if no descriptor is known for it.
+func (t *topology) weight(i int) int {
+	return t.instance(i).Weight
+}
+
+// Returns the input indices ordered by descending weight of their instances, keeping the order of equal weights.
+// Heavier instances hold more of the keys, so discovery starts its probes on them first, which matters
+// when the number of concurrent probes is limited.
+func (t *topology) byWeight(idxs []int) []int {
+	res := append([]int(nil), idxs...)
+	sort.SliceStable(res, func(a, b int) bool {
+		return t.weight(res[a]) > t.weight(res[b])
+	})
+	return res
+}
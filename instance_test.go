@@ -0,0 +1,80 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseInstanceReadsWeightAndName(t *testing.T) {
+	cases := map[string]Instance{
+		"10.0.0.1:6379:3 alpha": {Name: "alpha", Addr: "10.0.0.1:6379", Weight: 3},
+		"10.0.0.2:6379:1":       {Name: "10.0.0.2:6379", Addr: "10.0.0.2:6379", Weight: 1},
+		"/tmp/redis.sock:2 b":   {Name: "b", Addr: "/tmp/redis.sock", Weight: 2},
+	}
+	for desc, want := range cases {
+		if got := ParseInstance(desc); got != want {
+			t.Errorf("ParseInstance(%q) = %+v, want %+v", desc, got, want)
+		}
+	}
+
+	conf := PoolConfig{Servers: []string{"10.0.0.1:6379:3 alpha", "10.0.0.2:6379:1"}}
+	if got := conf.Instances(); len(got) != 2 || got[0].Name != "alpha" || got[1].Weight != 1 {
+		t.Fatalf("Unexpected instances: %+v", got)
+	}
+}
+
+func TestByWeightOrdersHeaviestFirst(t *testing.T) {
+	top := &topology{servers: []string{"10.0.0.1:6379:1", "10.0.0.2:6379:5", "10.0.0.3:6379:1", "10.0.0.4:6379:2"}}
+
+	if got := top.byWeight([]int{0, 1, 2, 3}); !reflect.DeepEqual(got, []int{1, 3, 0, 2}) {
+		t.Fatalf("Unexpected order: %v", got)
+	}
+	if got := top.byWeight([]int{2, 0}); !reflect.DeepEqual(got, []int{2, 0}) {
+		t.Fatalf("Expected order of equal weights to be kept, got %v", got)
+	}
+}
+
+func TestInstancesReportsRoleAndHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("INFO", "replication").Return("# Replication\r\nrole:master\r\n", nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("INFO", "replication").Return(nil, errors.New("Connection refused."))
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"10.0.0.1:6379:2 alpha", "10.0.0.2:6379:1 beta"}
+
+	got := proxy.Instances()
+	want := []Instance{
+		{Name: "alpha", Addr: "10.0.0.1:6379", Weight: 2, Healthy: true, Role: "master"},
+		{Name: "beta", Addr: "10.0.0.2:6379", Weight: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected instances: %+v", got)
+	}
+}
+
+func TestBGSaveEachReportsInstanceNames(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("BGSAVE").Return("Background saving started", nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.Servers = []string{"10.0.0.1:6379:1 alpha"}
+
+	res, err := proxy.BGSaveEach(context.Background(), time.Millisecond, InstanceOptions{})
+	if err != nil || len(res) != 1 || res[0].Name != "alpha" || res[0].Server != "10.0.0.1:6379" {
+		t.Fatalf("Unexpected result: %+v, %v", res, err)
+	}
+}
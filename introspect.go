@@ -0,0 +1,165 @@
+package twunproxy
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/******************************************************
+ * Key introspection: random keys, and the type, expiry, encoding and memory of a key on the instance holding it.
+ ******************************************************/
+
+const (
+	// NoExpiry is returned by TTL for a key without an expiry.
+	NoExpiry time.Duration = -1
+
+	// NoKey is returned by TTL for a key that does not exist.
+	NoKey time.Duration = -2
+)
+
+// DebugObjectInfo is the decoded reply of DEBUG OBJECT. Fields holds every field of the reply, including those
+// not decoded, such as ql_nodes for quicklists.
+type DebugObjectInfo struct {
+	RefCount         int64             `json:"ref_count"`
+	Encoding         string            `json:"encoding"`
+	SerializedLength int64             `json:"serialized_length"`
+	LRUSecondsIdle   int64             `json:"lru_seconds_idle"`
+	Fields           map[string]string `json:"fields"`
+}
+
+// RandomKey returns a random key from a random instance, and maps the key to that instance, so that Lookup
+// gives its server. Empty instances are passed over for another, and an empty string is returned if every
+// instance is empty. Keys are not weighted by the size of each instance.
+func (r *ProxyConn) RandomKey() (string, error) {
+	t := r.topology()
+	idxs := r.liveIndexes(t)
+	if len(idxs) == 0 {
+		return "", errNoPools
+	}
+
+	var first error
+	for _, j := range rand.Perm(len(idxs)) {
+		i := idxs[j]
+		c := t.pools[i].Get()
+		v, err := c.Do("RANDOMKEY")
+		c.Close()
+
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		if key, ok := replyString(v); ok && key != "" {
+			r.mapKey(key, t.pools[i])
+			return key, nil
+		}
+	}
+	return "", first
+}
+
+// Type returns the type of the key, such as "string" or "zset", from the instance holding it.
+// "none" is returned if the key does not exist.
+func (r *ProxyConn) Type(key string) (string, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "TYPE", key: key}, false)
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := replyString(v)
+	if !ok {
+		return "", errors.New("Unexpected reply to TYPE.")
+	}
+	return s, nil
+}
+
+// TTL returns the remaining time to live of the key, to the millisecond, from the instance holding it.
+// NoExpiry is returned if the key has no expiry and NoKey if it does not exist.
+func (r *ProxyConn) TTL(key string) (time.Duration, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "PTTL", key: key}, false)
+	if err != nil {
+		return 0, err
+	}
+
+	ms, ok := replyInt(v)
+	if !ok {
+		return 0, errors.New("Unexpected reply to PTTL.")
+	}
+	if ms < 0 {
+		return time.Duration(ms), nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// ObjectEncoding returns the internal encoding of the value at key, such as "listpack" or "skiplist",
+// from the instance holding it. An empty string is returned if the key does not exist.
+func (r *ProxyConn) ObjectEncoding(key string) (string, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "OBJECT", key: key, args: []interface{}{"ENCODING"}, keyPos: 1}, false)
+	if err != nil || v == nil {
+		return "", err
+	}
+
+	s, ok := replyString(v)
+	if !ok {
+		return "", errors.New("Unexpected reply to OBJECT ENCODING.")
+	}
+	return s, nil
+}
+
+// MemoryUsage returns the number of bytes that the key and its value take in memory on the instance holding it,
+// from MEMORY USAGE. Nested values are sampled, with samples elements; 0 uses the Redis default, of 5.
+// False is returned if the key does not exist.
+func (r *ProxyConn) MemoryUsage(key string, samples int) (int64, bool, error) {
+	var args []interface{}
+	if samples > 0 {
+		args = []interface{}{"SAMPLES", samples}
+	}
+
+	v, err := r.doKeyed(&RedisCmd{name: "MEMORY", key: key, args: append([]interface{}{"USAGE"}, args...), keyPos: 1}, false)
+	if err != nil || v == nil {
+		return 0, false, err
+	}
+
+	n, ok := replyInt(v)
+	if !ok {
+		return 0, false, errors.New("Unexpected reply to MEMORY USAGE.")
+	}
+	return n, true, nil
+}
+
+// DebugObject returns the decoded reply of DEBUG OBJECT for the key, from the instance holding it.
+// Nil is returned if the key does not exist. Redis 7.0 and later only allow DEBUG if enable-debug-command is set.
+func (r *ProxyConn) DebugObject(key string) (*DebugObjectInfo, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "DEBUG", key: key, args: []interface{}{"OBJECT"}, keyPos: 1}, false)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	s, ok := replyString(v)
+	if !ok {
+		return nil, errors.New("Unexpected reply to DEBUG OBJECT.")
+	}
+	return parseDebugObject(s), nil
+}
+
+// Decodes the space-separated name:value fields of a DEBUG OBJECT reply.
+func parseDebugObject(s string) *DebugObjectInfo {
+	info := &DebugObjectInfo{Fields: make(map[string]string)}
+	for _, f := range strings.Fields(s) {
+		if i := strings.IndexByte(f, ':'); i > 0 {
+			info.Fields[f[:i]] = f[i+1:]
+		}
+	}
+
+	info.RefCount, _ = strconv.ParseInt(info.Fields["refcount"], 10, 64)
+	info.Encoding = info.Fields["encoding"]
+	info.SerializedLength, _ = strconv.ParseInt(info.Fields["serializedlength"], 10, 64)
+	info.LRUSecondsIdle, _ = strconv.ParseInt(info.Fields["lru_seconds_idle"], 10, 64)
+	return info
+}
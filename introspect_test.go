@@ -0,0 +1,75 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestRandomKeyPassesOverEmptyInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("RANDOMKEY").Return(nil, nil).MaxTimes(1)
+	mockConn1.EXPECT().Close().MaxTimes(1)
+	mockConn2.EXPECT().Do("RANDOMKEY").Return([]byte("KEY"), nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	if key, err := proxy.RandomKey(); err != nil || key != "KEY" {
+		t.Fatalf("Unexpected result: %q, %v", key, err)
+	}
+	if server, ok := proxy.Lookup("KEY"); !ok || server != "1" {
+		t.Fatalf("Expected the key to be mapped to its instance, got %q", server)
+	}
+}
+
+func TestTypeTTLAndEncodingUseMappedInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("TYPE", "KEY").Return("zset", nil)
+	mockConn.EXPECT().Do("PTTL", "KEY").Return(int64(1500), nil)
+	mockConn.EXPECT().Do("OBJECT", "ENCODING", "KEY").Return([]byte("listpack"), nil)
+	mockConn.EXPECT().Close().Times(3)
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	if typ, err := proxy.Type("KEY"); err != nil || typ != "zset" {
+		t.Fatalf("Unexpected type: %q, %v", typ, err)
+	}
+	if ttl, err := proxy.TTL("KEY"); err != nil || ttl != 1500*time.Millisecond {
+		t.Fatalf("Unexpected TTL: %v, %v", ttl, err)
+	}
+	if enc, err := proxy.ObjectEncoding("KEY"); err != nil || enc != "listpack" {
+		t.Fatalf("Unexpected encoding: %q, %v", enc, err)
+	}
+}
+
+func TestMemoryUsageAndDebugObject(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("MEMORY", "USAGE", "KEY", "SAMPLES", 10).Return(int64(72), nil)
+	mockConn.EXPECT().Do("DEBUG", "OBJECT", "KEY").Return(
+		"Value at:0x7f3c refcount:1 encoding:listpack serializedlength:12 lru:1 lru_seconds_idle:4", nil)
+	mockConn.EXPECT().Close().Times(2)
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	if n, ok, err := proxy.MemoryUsage("KEY", 10); err != nil || !ok || n != 72 {
+		t.Fatalf("Unexpected memory usage: %d, %v, %v", n, ok, err)
+	}
+
+	info, err := proxy.DebugObject("KEY")
+	if err != nil || info.RefCount != 1 || info.Encoding != "listpack" || info.SerializedLength != 12 ||
+		info.LRUSecondsIdle != 4 || info.Fields["lru"] != "1" {
+		t.Fatalf("Unexpected result: %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,217 @@
+package twunproxy
+
+import (
+	"encoding/json"
+)
+
+/******************************************************
+ * JSON encoding of operation results.
+ * Field names are stable so that external automation can consume them.
+ * Errors are rendered as their message and omitted when nil.
+ ******************************************************/
+
+// MarshalJSON encodes the snapshot with its error as a string.
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	type snapshot Snapshot
+	return json.Marshal(struct {
+		snapshot
+		Err string `json:"error,omitempty"`
+	}{snapshot(s), errString(s.Err)})
+}
+
+// MarshalJSON encodes the step result with its errors as strings.
+func (s StepResult) MarshalJSON() ([]byte, error) {
+	type stepResult StepResult
+	return json.Marshal(struct {
+		stepResult
+		Err         string `json:"error,omitempty"`
+		RollbackErr string `json:"rollback_error,omitempty"`
+	}{stepResult(s), errString(s.Err), errString(s.RollbackErr)})
+}
+
+// MarshalJSON encodes the instance health with its error as a string.
+func (h InstanceHealth) MarshalJSON() ([]byte, error) {
+	type instanceHealth InstanceHealth
+	return json.Marshal(struct {
+		instanceHealth
+		Err string `json:"error,omitempty"`
+	}{instanceHealth(h), errString(h.Err)})
+}
+
+// MarshalJSON encodes the trace entry with its error as a string.
+func (e TraceEntry) MarshalJSON() ([]byte, error) {
+	type traceEntry TraceEntry
+	return json.Marshal(struct {
+		traceEntry
+		Err string `json:"error,omitempty"`
+	}{traceEntry(e), errString(e.Err)})
+}
+
+// MarshalJSON encodes the dead letter with its error as a string.
+func (d DeadLetter) MarshalJSON() ([]byte, error) {
+	type deadLetter DeadLetter
+	return json.Marshal(struct {
+		deadLetter
+		Err string `json:"error,omitempty"`
+	}{deadLetter(d), errString(d.Err)})
+}
+
+// MarshalJSON encodes the instance size with its error as a string.
+func (i InstanceSize) MarshalJSON() ([]byte, error) {
+	type instanceSize InstanceSize
+	return json.Marshal(struct {
+		instanceSize
+		Err string `json:"error,omitempty"`
+	}{instanceSize(i), errString(i.Err)})
+}
+
+// MarshalJSON encodes the instance keyspace with its error as a string.
+func (i InstanceKeyspace) MarshalJSON() ([]byte, error) {
+	type instanceKeyspace InstanceKeyspace
+	return json.Marshal(struct {
+		instanceKeyspace
+		Err string `json:"error,omitempty"`
+	}{instanceKeyspace(i), errString(i.Err)})
+}
+
+// MarshalJSON encodes the instance info with its error as a string.
+func (i InstanceInfo) MarshalJSON() ([]byte, error) {
+	type instanceInfo InstanceInfo
+	return json.Marshal(struct {
+		instanceInfo
+		Err string `json:"error,omitempty"`
+	}{instanceInfo(i), errString(i.Err)})
+}
+
+// MarshalJSON encodes the job status with its last error as a string.
+func (j JobStatus) MarshalJSON() ([]byte, error) {
+	type jobStatus JobStatus
+	return json.Marshal(struct {
+		jobStatus
+		LastErr string `json:"last_error,omitempty"`
+	}{jobStatus(j), errString(j.LastErr)})
+}
+
+// MarshalJSON encodes the kill result with its error as a string.
+func (k KillResult) MarshalJSON() ([]byte, error) {
+	type killResult KillResult
+	return json.Marshal(struct {
+		killResult
+		Err string `json:"error,omitempty"`
+	}{killResult(k), errString(k.Err)})
+}
+
+// MarshalJSON encodes the instance configuration with its error as a string.
+func (i InstanceConfig) MarshalJSON() ([]byte, error) {
+	type instanceConfig InstanceConfig
+	return json.Marshal(struct {
+		instanceConfig
+		Err string `json:"error,omitempty"`
+	}{instanceConfig(i), errString(i.Err)})
+}
+
+// MarshalJSON encodes the misplaced key with its error as a string.
+func (m Misplaced) MarshalJSON() ([]byte, error) {
+	type misplaced Misplaced
+	return json.Marshal(struct {
+		misplaced
+		Err string `json:"error,omitempty"`
+	}{misplaced(m), errString(m.Err)})
+}
+
+// MarshalJSON encodes the instance result with its error as a string.
+func (i InstanceResult) MarshalJSON() ([]byte, error) {
+	type instanceResult InstanceResult
+	return json.Marshal(struct {
+		instanceResult
+		Err string `json:"error,omitempty"`
+	}{instanceResult(i), errString(i.Err)})
+}
+
+// MarshalJSON encodes the promote result with its error as a string.
+func (p PromoteResult) MarshalJSON() ([]byte, error) {
+	type promoteResult PromoteResult
+	return json.Marshal(struct {
+		promoteResult
+		Err string `json:"error,omitempty"`
+	}{promoteResult(p), errString(p.Err)})
+}
+
+// MarshalJSON encodes the replication status with its error as a string.
+func (s ReplicationStatus) MarshalJSON() ([]byte, error) {
+	type replicationStatus ReplicationStatus
+	return json.Marshal(struct {
+		replicationStatus
+		Err string `json:"error,omitempty"`
+	}{replicationStatus(s), errString(s.Err)})
+}
+
+// MarshalJSON encodes the abort result with its error as a string.
+func (a AbortResult) MarshalJSON() ([]byte, error) {
+	type abortResult AbortResult
+	return json.Marshal(struct {
+		abortResult
+		Err string `json:"error,omitempty"`
+	}{abortResult(a), errString(a.Err)})
+}
+
+// MarshalJSON encodes the pool result with its error as a string, and bulk strings in its reply as strings.
+func (p PoolResult) MarshalJSON() ([]byte, error) {
+	type poolResult PoolResult
+	p.Reply = jsonReply(p.Reply)
+	return json.Marshal(struct {
+		poolResult
+		Err string `json:"error,omitempty"`
+	}{poolResult(p), errString(p.Err)})
+}
+
+// Converts the bulk strings of the input reply, including those nested in arrays, to strings.
+func jsonReply(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []byte:
+		return string(t)
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, e := range t {
+			res[i] = jsonReply(e)
+		}
+		return res
+	}
+	return v
+}
+
+// Returns the message of the input error, or an empty string if it is nil.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// MarshalJSON encodes the benchmark result with its error as a string.
+func (b BenchmarkResult) MarshalJSON() ([]byte, error) {
+	type benchmarkResult BenchmarkResult
+	return json.Marshal(struct {
+		benchmarkResult
+		Err string `json:"error,omitempty"`
+	}{benchmarkResult(b), errString(b.Err)})
+}
+
+// MarshalJSON encodes the migrated key with its error as a string.
+func (k MigratedKey) MarshalJSON() ([]byte, error) {
+	type migratedKey MigratedKey
+	return json.Marshal(struct {
+		migratedKey
+		Err string `json:"error,omitempty"`
+	}{migratedKey(k), errString(k.Err)})
+}
+
+// MarshalJSON encodes the mismatch with its errors as strings.
+func (m Mismatch) MarshalJSON() ([]byte, error) {
+	type mismatch Mismatch
+	return json.Marshal(struct {
+		mismatch
+		OldErr string `json:"old_error,omitempty"`
+		NewErr string `json:"new_error,omitempty"`
+	}{mismatch(m), errString(m.OldErr), errString(m.NewErr)})
+}
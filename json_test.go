@@ -0,0 +1,56 @@
+package twunproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnapshotMarshalsErrorAsString(t *testing.T) {
+	b, err := json.Marshal([]Snapshot{
+		{Server: "10.0.0.1:6379", Offset: 100},
+		{Server: "10.0.0.2:6379", Err: errors.New("ERR bgsave in progress")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	exp := `[{"server":"10.0.0.1:6379","offset":100},{"server":"10.0.0.2:6379","offset":0,"error":"ERR bgsave in progress"}]`
+	if string(b) != exp {
+		t.Fatalf("Unexpected JSON: %s", b)
+	}
+}
+
+func TestPlanAndStepResultsMarshal(t *testing.T) {
+	plan := Plan{Name: "save", Steps: []Step{PauseStep(time.Second, PauseModeWrite), BGSaveStep(0)}}
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if exp := `{"name":"save","steps":[{"name":"pause"},{"name":"bgsave"}]}`; string(b) != exp {
+		t.Fatalf("Unexpected JSON: %s", b)
+	}
+
+	b, err = json.Marshal(StepResult{Name: "pause", Ran: true, Err: errors.New("failed"), RolledBack: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if exp := `{"name":"pause","ran":true,"rolled_back":true,"error":"failed"}`; string(b) != exp {
+		t.Fatalf("Unexpected JSON: %s", b)
+	}
+}
+
+func TestMisplacedMarshalsErrorAsString(t *testing.T) {
+	b, err := json.Marshal(Misplaced{Key: "KEY", Server: "a:6379", Owner: "b:6379", Err: errOwnerHoldsKey})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	exp := `{"key":"KEY","server":"a:6379","owner":"b:6379","moved":false,"error":"` + errOwnerHoldsKey.Error() + `"}`
+	if string(b) != exp {
+		t.Fatalf("Unexpected JSON: %s", b)
+	}
+}
@@ -0,0 +1,130 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Returned when a new key must be written but no instance can be chosen for it.
+var errNoPlacement = errors.New("Key does not exist and placement is unavailable for the pool configuration.")
+
+// Returns the pool holding the input key, discovering it with EXISTS if it is not already mapped.
+// False is returned if the key does not exist on any instance.
+func (r *ProxyConn) locate(key string) (ConnGetter, bool, error) {
+	if pool, ok := r.lookup(key); ok {
+		return pool, true, nil
+	}
+
+	canMap := func(v interface{}) bool {
+		n, ok := replyInt(v)
+		return ok && n > 0
+	}
+
+	// Probe directly rather than through Do, so that a missing key is not dead-lettered.
+	_, err := r.do(context.Background(), &RedisCmd{name: "EXISTS", key: key, probe: true}, canMap)
+	if err == ErrNoMapping {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	pool, ok := r.lookup(key)
+	return pool, ok, nil
+}
+
+// Returns the pool holding the input key as for locate. If no instance holds it, the pool named by the prefix rule
+// matching the key is returned with ruled set, so that new keys under the prefix are placed by the rule.
+// A rule naming another instance than the one holding a discovered key is wrong, and is demoted.
+func (r *ProxyConn) locateRuled(key string) (pool ConnGetter, ok, ruled bool, err error) {
+	_, mapped := r.lookup(key)
+	if pool, ok, err = r.locate(key); err != nil || mapped || r.prefixes == nil {
+		return pool, ok, false, err
+	}
+
+	t := r.topology()
+	i, prefix, has := r.prefixes.lookup(key, t)
+	if !has {
+		return pool, ok, false, nil
+	}
+	if ok {
+		if t.pools[i] != pool {
+			r.prefixes.demote(prefix)
+			r.counter("prefix_rule_demotions", t.server(i), 1)
+		}
+		return pool, true, false, nil
+	}
+
+	r.counter("prefix_placements", t.server(i), 1)
+	return t.pools[i], false, true, nil
+}
+
+// Returns the pool that the input key is placed on: the pool mapped to it, the pool named by a prefix rule
+// matching it, the pool holding it, or else its owner in the hash ring.
+// False is returned if the key does not exist and the ring cannot place it.
+func (r *ProxyConn) place(key string) (ConnGetter, bool, error) {
+	pool, ok, ruled, err := r.locateRuled(key)
+	if err != nil || ok || ruled {
+		return pool, err == nil, err
+	}
+
+	t := r.topology()
+	if i, placed := t.ring.owner(key); placed {
+		return t.pools[i], true, nil
+	}
+	return nil, false, nil
+}
+
+// Runs the input command on the instance holding its key.
+// Unlike Do, this is safe for commands that return the same reply whether or not the key exists,
+// and for commands that create the key.
+// If the key does not exist and matches a prefix rule, the command is run on the instance the rule names.
+// Otherwise, writes are run on the instance that the hash ring places the key on,
+// and the key is mapped there. Reads are run on that instance too, or on any instance if there is no ring,
+// since every instance then replies as for a missing key.
+// The key is placed again for each retry under the retry policy.
+func (r *ProxyConn) doKeyed(cmd *RedisCmd, write bool) (interface{}, error) {
+	var v interface{}
+	err := r.retrying(context.Background(), cmd.name, cmd.key, func() (err error) {
+		v, err = r.runKeyed(cmd, write)
+		return err
+	})
+	return v, err
+}
+
+// Places the key of the input command and runs it once, as for doKeyed.
+func (r *ProxyConn) runKeyed(cmd *RedisCmd, write bool) (interface{}, error) {
+	start := time.Now()
+
+	pool, ok, ruled, err := r.locateRuled(cmd.key)
+	if err != nil {
+		return nil, err
+	}
+
+	t := r.topology()
+	if !ok && !ruled {
+		if i, placed := t.ring.owner(cmd.key); placed {
+			pool = t.pools[i]
+		} else if !write && len(t.pools) > 0 {
+			pool = t.pools[0]
+		} else {
+			r.deadLetter(cmd, errNoPlacement)
+			return nil, errNoPlacement
+		}
+	}
+
+	defer r.inflight.release(r.inflight.acquire(1))
+
+	c := pool.Get()
+	defer c.Close()
+	v, err := r.intercept(context.Background(), t.serverOf(pool), false, cmd, func() (interface{}, error) {
+		return r.run(c, cmd)
+	})
+	r.observe(cmd, t.serverOf(pool), false, start, v, err)
+
+	if !ok && write && err == nil {
+		r.mapKey(cmd.key, pool)
+	}
+	return v, err
+}
@@ -0,0 +1,189 @@
+package twunproxy
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/******************************************************
+ * Keyspace notifications from every instance, merged into one channel.
+ ******************************************************/
+
+// DefaultKeyspaceFlags is the notify-keyspace-events setting that KeyspaceEvents requires, if none is configured:
+// keyspace notifications for every class of event.
+const DefaultKeyspaceFlags = "KA"
+
+// The event classes that the A flag of notify-keyspace-events stands for.
+const allEventClasses = "g$lshzxetd"
+
+// KeyspaceEventConfig configures KeyspaceEvents.
+// Pattern matches the keys whose events are delivered, as for PSUBSCRIBE; empty matches every key.
+// Events restricts delivery to the named events, such as "set" or "expired"; empty delivers every event.
+// Flags is the notify-keyspace-events setting required on every instance, which must include K.
+// If Configure is set, instances lacking any of the flags have them added with CONFIG SET; otherwise
+// KeyspaceEvents fails for them. Buffer and ReconnectInterval are as for SubscribeConfig.
+type KeyspaceEventConfig struct {
+	Pattern           string
+	Events            []string
+	Flags             string
+	Configure         bool
+	Buffer            int
+	ReconnectInterval time.Duration
+}
+
+// KeyspaceEvent is a keyspace notification: the event on the key in the logical database,
+// with the server of the instance that delivered it.
+type KeyspaceEvent struct {
+	Server string `json:"server"`
+	DB     int    `json:"db"`
+	Key    string `json:"key"`
+	Event  string `json:"event"`
+}
+
+// KeyspaceSubscriber delivers the keyspace notifications of every instance on one channel.
+type KeyspaceSubscriber struct {
+	sub    *Subscriber
+	events chan KeyspaceEvent
+	done   chan bool
+	once   sync.Once
+}
+
+// KeyspaceEvents checks that every instance has keyspace notifications enabled for the configured flags,
+// enabling them if configured to, then subscribes to the keyspace channels of every instance and merges their
+// events into one channel. Notifications are only published by the instance holding the key, so every instance
+// must be subscribed. Call Close on the returned subscriber to unsubscribe.
+func (r *ProxyConn) KeyspaceEvents(conf KeyspaceEventConfig) (*KeyspaceSubscriber, error) {
+	if conf.Flags == "" {
+		conf.Flags = DefaultKeyspaceFlags
+	}
+	if !strings.Contains(conf.Flags, "K") {
+		return nil, errors.New("Keyspace notifications require the K flag.")
+	}
+	if conf.Pattern == "" {
+		conf.Pattern = "*"
+	}
+
+	if err := r.enableKeyspaceEvents(conf.Flags, conf.Configure); err != nil {
+		return nil, err
+	}
+
+	sub, err := r.Subscribe(SubscribeConfig{
+		Patterns:          []string{"__keyspace@*__:" + conf.Pattern},
+		Buffer:            conf.Buffer,
+		ReconnectInterval: conf.ReconnectInterval,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeyspaceSubscriber{sub: sub, events: make(chan KeyspaceEvent, conf.Buffer), done: make(chan bool)}
+	go ks.run(conf.Events)
+	return ks, nil
+}
+
+// Events returns the channel on which events from every instance are delivered.
+// It is closed once the subscriber is closed.
+func (ks *KeyspaceSubscriber) Events() <-chan KeyspaceEvent {
+	return ks.events
+}
+
+// Close ends the subscriptions and closes the event channel.
+func (ks *KeyspaceSubscriber) Close() error {
+	ks.once.Do(func() { close(ks.done) })
+	return ks.sub.Close()
+}
+
+// Decodes the messages of the subscriber into events, delivering those named, until the subscriber is closed.
+func (ks *KeyspaceSubscriber) run(names []string) {
+	defer close(ks.events)
+
+	for m := range ks.sub.Messages() {
+		e, ok := parseKeyspaceEvent(m)
+		if !ok || (len(names) > 0 && !containsString(names, e.Event)) {
+			continue
+		}
+
+		select {
+		case ks.events <- e:
+		case <-ks.done:
+		}
+	}
+}
+
+// Checks notify-keyspace-events on every instance against the required flags, adding any missing if configured to.
+// The error names the instances that lack the flags.
+func (r *ProxyConn) enableKeyspaceEvents(flags string, configure bool) error {
+	t := r.topology()
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("CONFIG", "GET", "notify-keyspace-events")
+		if err != nil {
+			return err
+		}
+
+		items, _ := v.([]interface{})
+		if len(items) != 2 {
+			return errors.New("Unexpected reply to CONFIG GET.")
+		}
+		current, _ := replyString(items[1])
+
+		missing := missingFlags(current, flags)
+		if missing == "" {
+			return nil
+		}
+		if !configure {
+			return errors.New("Keyspace notifications on " + t.server(i) + " lack flags " + missing + ".")
+		}
+		_, err = c.Do("CONFIG", "SET", "notify-keyspace-events", current+missing)
+		return err
+	})
+	return r.fanOutError(t, errs)
+}
+
+// Returns the flags of the required notify-keyspace-events setting that the current setting lacks.
+func missingFlags(current, required string) string {
+	if strings.Contains(current, "A") {
+		current += allEventClasses
+	}
+	if strings.Contains(required, "A") {
+		required = strings.Replace(required, "A", allEventClasses, 1)
+	}
+
+	var missing []byte
+	for i := 0; i < len(required); i++ {
+		if !strings.ContainsRune(current, rune(required[i])) && !strings.ContainsRune(string(missing), rune(required[i])) {
+			missing = append(missing, required[i])
+		}
+	}
+	return string(missing)
+}
+
+// Parses a message on a keyspace channel such as "__keyspace@0__:key", whose data is the event name.
+func parseKeyspaceEvent(m Message) (KeyspaceEvent, bool) {
+	rest := strings.TrimPrefix(m.Channel, "__keyspace@")
+	if rest == m.Channel {
+		return KeyspaceEvent{}, false
+	}
+
+	i := strings.Index(rest, "__:")
+	if i < 0 {
+		return KeyspaceEvent{}, false
+	}
+	db, err := strconv.Atoi(rest[:i])
+	if err != nil {
+		return KeyspaceEvent{}, false
+	}
+	return KeyspaceEvent{Server: m.Server, DB: db, Key: rest[i+3:], Event: string(m.Data)}, true
+}
+
+// Reports whether the input strings include the input string.
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
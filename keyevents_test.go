@@ -0,0 +1,108 @@
+package twunproxy
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A pub/sub connection replying to CONFIG GET with a notify-keyspace-events setting, and recording CONFIG SET.
+type keyspaceConn struct {
+	*fakePubSubConn
+	mu      sync.Mutex
+	setting string
+}
+
+func (c *keyspaceConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(args) == 3 && args[0] == "SET" {
+		c.setting = args[2].(string)
+		return "OK", nil
+	}
+	return []interface{}{[]byte("notify-keyspace-events"), []byte(c.setting)}, nil
+}
+
+func TestMissingFlags(t *testing.T) {
+	cases := []struct{ current, required, missing string }{
+		{"", "KA", "Kg$lshzxetd"},
+		{"KEA", "KA", ""},
+		{"Kx", "KA", "g$lshzetd"},
+		{"Ex", "Kx", "K"},
+	}
+	for _, c := range cases {
+		if got := missingFlags(c.current, c.required); got != c.missing {
+			t.Errorf("missingFlags(%q, %q): expected %q, got %q", c.current, c.required, c.missing, got)
+		}
+	}
+}
+
+func TestParseKeyspaceEvent(t *testing.T) {
+	e, ok := parseKeyspaceEvent(Message{Server: "s", Channel: "__keyspace@3__:a:b", Data: []byte("set")})
+	if !ok || e != (KeyspaceEvent{Server: "s", DB: 3, Key: "a:b", Event: "set"}) {
+		t.Fatalf("Unexpected event: %+v, %v", e, ok)
+	}
+
+	for _, ch := range []string{"news", "__keyevent@0__:set", "__keyspace@x__:a"} {
+		if _, ok := parseKeyspaceEvent(Message{Channel: ch}); ok {
+			t.Errorf("Expected %q not to parse.", ch)
+		}
+	}
+}
+
+func TestKeyspaceEventsRequiresFlagsUnlessConfigured(t *testing.T) {
+	c := &keyspaceConn{fakePubSubConn: newFakePubSubConn(), setting: "Ex"}
+	proxy := getMockProxy(connPool{c})
+
+	if _, err := proxy.KeyspaceEvents(KeyspaceEventConfig{}); err == nil || !strings.Contains(err.Error(), "lack flags") {
+		t.Fatalf("Expected missing flags error, got %v", err)
+	}
+	if _, err := proxy.KeyspaceEvents(KeyspaceEventConfig{Flags: "E$"}); err == nil {
+		t.Fatal("Expected error for flags without K.")
+	}
+}
+
+func TestKeyspaceEventsMergesInstances(t *testing.T) {
+	conf1 := &keyspaceConn{fakePubSubConn: newFakePubSubConn(), setting: "KA"}
+	conf2 := &keyspaceConn{fakePubSubConn: newFakePubSubConn(), setting: ""}
+	c1, c2 := newFakePubSubConn(), newFakePubSubConn()
+
+	proxy := getMockProxy(&seqPool{conns: []Conn{conf1, c1}}, &seqPool{conns: []Conn{conf2, c2}})
+	proxy.Servers = []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}
+
+	ks, err := proxy.KeyspaceEvents(KeyspaceEventConfig{Pattern: "user:*", Events: []string{"set"}, Configure: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if conf1.setting != "KA" || conf2.setting != "Kg$lshzxetd" {
+		t.Fatalf("Unexpected settings %q and %q", conf1.setting, conf2.setting)
+	}
+
+	pattern := []byte("__keyspace@*__:user:*")
+	c1.replies <- []interface{}{[]byte("pmessage"), pattern, []byte("__keyspace@0__:user:1"), []byte("del")}
+	c1.replies <- []interface{}{[]byte("pmessage"), pattern, []byte("__keyspace@0__:user:1"), []byte("set")}
+	c2.replies <- []interface{}{[]byte("pmessage"), pattern, []byte("__keyspace@1__:user:2"), []byte("set")}
+
+	got := make(map[string]KeyspaceEvent)
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-ks.Events():
+			got[e.Server] = e
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for events.")
+		}
+	}
+
+	if e := got["10.0.0.1:6379"]; e.Key != "user:1" || e.Event != "set" || e.DB != 0 {
+		t.Fatalf("Unexpected event: %+v", e)
+	}
+	if e := got["10.0.0.2:6379"]; e.Key != "user:2" || e.Event != "set" || e.DB != 1 {
+		t.Fatalf("Unexpected event: %+v", e)
+	}
+
+	ks.Close()
+	if _, ok := <-ks.Events(); ok {
+		t.Fatal("Expected event channel to be closed.")
+	}
+}
@@ -0,0 +1,126 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InstanceSize is the number of keys held by a single instance, from DBSIZE.
+type InstanceSize struct {
+	Server string `json:"server"`
+	Keys   int64  `json:"keys"`
+	Err    error  `json:"-"`
+}
+
+// DBSizeReport is the number of keys across the pool, with a breakdown per instance.
+// Keys is the sum over the instances that answered.
+type DBSizeReport struct {
+	Keys      int64          `json:"keys"`
+	Instances []InstanceSize `json:"instances"`
+}
+
+// DBKeyspace is the line of INFO keyspace for one logical database of an instance.
+type DBKeyspace struct {
+	DB      int           `json:"db"`
+	Keys    int64         `json:"keys"`
+	Expires int64         `json:"expires"`
+	AvgTTL  time.Duration `json:"avg_ttl_ns"`
+}
+
+// InstanceKeyspace is the keyspace of a single instance, one entry per logical database holding keys.
+type InstanceKeyspace struct {
+	Server string       `json:"server"`
+	DBs    []DBKeyspace `json:"dbs"`
+	Err    error        `json:"-"`
+}
+
+// DBSize issues DBSIZE on every instance concurrently and returns the total number of keys with a breakdown
+// per instance. Instances that fail carry their error and are left out of the total; the first error is returned
+// with the report.
+func (r *ProxyConn) DBSize() (*DBSizeReport, error) {
+	t := r.topology()
+	rep := &DBSizeReport{Instances: make([]InstanceSize, len(t.pools))}
+
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("DBSIZE")
+		if err != nil {
+			return err
+		}
+
+		n, ok := replyInt(v)
+		if !ok {
+			return errors.New("Unexpected reply to DBSIZE.")
+		}
+		rep.Instances[i].Keys = n
+		return nil
+	})
+
+	for i, err := range errs {
+		rep.Instances[i].Server = t.server(i)
+		rep.Instances[i].Err = err
+		rep.Keys += rep.Instances[i].Keys
+	}
+	return rep, r.fanOutError(t, errs)
+}
+
+// KeyspaceInfo parses the INFO keyspace section of every instance, queried concurrently.
+// Instances that fail carry their error, and the first error is returned with the results.
+func (r *ProxyConn) KeyspaceInfo() ([]InstanceKeyspace, error) {
+	t := r.topology()
+	res := make([]InstanceKeyspace, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		info, err := infoSection(context.Background(), c, "keyspace")
+		if err != nil {
+			return err
+		}
+		res[i].DBs = parseKeyspace(info)
+		return nil
+	})
+
+	for i, err := range errs {
+		res[i].Server = t.server(i)
+		res[i].Err = err
+	}
+	return res, r.fanOutError(t, errs)
+}
+
+// Parses INFO keyspace fields such as "db0" = "keys=1,expires=0,avg_ttl=0", ordered by database.
+func parseKeyspace(info map[string]string) []DBKeyspace {
+	dbs := make([]DBKeyspace, 0, len(info))
+	for field, value := range info {
+		if !strings.HasPrefix(field, "db") {
+			continue
+		}
+		n, err := strconv.Atoi(field[2:])
+		if err != nil {
+			continue
+		}
+
+		db := DBKeyspace{DB: n}
+		for _, kv := range strings.Split(value, ",") {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			v, _ := strconv.ParseInt(parts[1], 10, 64)
+
+			switch parts[0] {
+			case "keys":
+				db.Keys = v
+			case "expires":
+				db.Expires = v
+			case "avg_ttl":
+				db.AvgTTL = time.Duration(v) * time.Millisecond
+			}
+		}
+		dbs = append(dbs, db)
+	}
+
+	sort.Slice(dbs, func(a, b int) bool { return dbs[a].DB < dbs[b].DB })
+	return dbs
+}
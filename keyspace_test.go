@@ -0,0 +1,39 @@
+package twunproxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDBSizeSumsInstances(t *testing.T) {
+	down := errors.New("down")
+	proxy := getMockProxy(
+		connPool{&nilStyleConn{reply: int64(3)}},
+		connPool{&nilStyleConn{reply: int64(4)}},
+		connPool{&nilStyleConn{err: down}},
+	)
+
+	rep, err := proxy.DBSize()
+	if err != down {
+		t.Fatalf("Expected instance error, got %v", err)
+	}
+	if rep.Keys != 7 || rep.Instances[1].Keys != 4 || rep.Instances[2].Err != down {
+		t.Fatalf("Unexpected report: %+v", rep)
+	}
+}
+
+func TestKeyspaceInfoParsesDatabases(t *testing.T) {
+	info := "# Keyspace\r\ndb3:keys=2,expires=1,avg_ttl=1500\r\ndb0:keys=10,expires=0,avg_ttl=0\r\n"
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: []byte(info)}})
+
+	res, err := proxy.KeyspaceInfo()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dbs := res[0].DBs
+	if len(dbs) != 2 || dbs[0].DB != 0 || dbs[0].Keys != 10 || dbs[1].Expires != 1 || dbs[1].AvgTTL != 1500*time.Millisecond {
+		t.Fatalf("Unexpected keyspace: %+v", dbs)
+	}
+}
@@ -0,0 +1,226 @@
+package twunproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/******************************************************
+ * Backend sources for pools deployed on Kubernetes.
+ * Use them with SyncBackends or WatchBackends.
+ ******************************************************/
+
+// The service account credentials mounted into every pod.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// HeadlessService resolves the pods behind a headless Service from the SRV records that cluster DNS publishes
+// for its named port. Pods are named by the first label of their SRV target, which for a StatefulSet is the stable
+// pod name, so that each shard keeps its place on the hash ring as its address changes.
+// Domain defaults to "cluster.local", PortName to "redis" and Weight to 1.
+type HeadlessService struct {
+	Name      string
+	Namespace string
+	PortName  string
+	Domain    string
+	Weight    int
+	Resolver  *net.Resolver
+}
+
+// Servers returns a descriptor for every pod behind the service, ordered by name.
+func (s HeadlessService) Servers(ctx context.Context) ([]string, error) {
+	res := s.Resolver
+	if res == nil {
+		res = net.DefaultResolver
+	}
+
+	_, srvs, err := res.LookupSRV(ctx, orDefault(s.PortName, "redis"), "tcp",
+		s.Name+"."+s.Namespace+".svc."+orDefault(s.Domain, "cluster.local"))
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]string)
+	for _, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		name := strings.SplitN(host, ".", 2)[0]
+		members[name] = net.JoinHostPort(host, strconv.Itoa(int(srv.Port)))
+	}
+	return descriptors(members, s.Weight), nil
+}
+
+// EndpointSlices lists the ready endpoints of the EndpointSlices matching a label selector from the Kubernetes API,
+// such as "kubernetes.io/service-name=redis". Endpoints are named by the pod they target, or their hostname.
+// PortName selects the port by name, defaulting to the first port of each slice, and Weight defaults to 1.
+// APIServer, Token and Client default to the in-cluster API server, service account token and CA; the service
+// account needs permission to list endpointslices in the namespace.
+type EndpointSlices struct {
+	Namespace string
+	Selector  string
+	PortName  string
+	Weight    int
+	APIServer string
+	Token     string
+	Client    *http.Client
+}
+
+// The parts of an EndpointSliceList that name and address endpoints.
+type endpointSliceList struct {
+	Items []struct {
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Hostname   string   `json:"hostname"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+			TargetRef *struct {
+				Name string `json:"name"`
+			} `json:"targetRef"`
+		} `json:"endpoints"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"items"`
+}
+
+// Servers returns a descriptor for every ready endpoint, ordered by name.
+func (s EndpointSlices) Servers(ctx context.Context) ([]string, error) {
+	list, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]string)
+	for _, item := range list.Items {
+		port := 0
+		for _, p := range item.Ports {
+			if s.PortName == "" || p.Name == s.PortName {
+				port = p.Port
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+
+		for _, ep := range item.Endpoints {
+			if len(ep.Addresses) == 0 || (ep.Conditions.Ready != nil && !*ep.Conditions.Ready) {
+				continue
+			}
+
+			name := ep.Addresses[0]
+			if ep.TargetRef != nil && ep.TargetRef.Name != "" {
+				name = ep.TargetRef.Name
+			} else if ep.Hostname != "" {
+				name = ep.Hostname
+			}
+			members[name] = net.JoinHostPort(ep.Addresses[0], strconv.Itoa(port))
+		}
+	}
+	return descriptors(members, s.Weight), nil
+}
+
+// Fetches the EndpointSlices matching the selector.
+func (s EndpointSlices) list(ctx context.Context) (*endpointSliceList, error) {
+	server, token, client := s.APIServer, s.Token, s.Client
+
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("Not running in a Kubernetes cluster and no API server is configured.")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+	}
+	if token == "" {
+		b, err := ioutil.ReadFile(serviceAccountDir + "token")
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if client == nil {
+		var err error
+		if client, err = inClusterClient(); err != nil {
+			return nil, err
+		}
+	}
+
+	u := strings.TrimSuffix(server, "/") + "/apis/discovery.k8s.io/v1/namespaces/" + url.PathEscape(s.Namespace) +
+		"/endpointslices?labelSelector=" + url.QueryEscape(s.Selector)
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Listing endpointslices failed with status %s.", resp.Status)
+	}
+
+	list := new(endpointSliceList)
+	if err := json.NewDecoder(resp.Body).Decode(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Returns an HTTP client trusting the CA of the service account.
+func inClusterClient() (*http.Client, error) {
+	ca, err := ioutil.ReadFile(serviceAccountDir + "ca.crt")
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, errors.New("Service account CA certificate is invalid.")
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}, nil
+}
+
+// Returns a Twemproxy server descriptor for each named address, ordered by name.
+func descriptors(members map[string]string, weight int) []string {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	servers := make([]string, len(names))
+	for i, name := range names {
+		servers[i] = members[name] + ":" + strconv.Itoa(weight) + " " + name
+	}
+	return servers
+}
+
+// Returns the input string, or the default if it is empty.
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,51 @@
+package twunproxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEndpointSlicesListsReadyEndpoints(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" ||
+			req.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/cache/endpointslices" ||
+			req.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=redis" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Write([]byte(`{"items": [{
+			"ports": [{"name": "metrics", "port": 9121}, {"name": "redis", "port": 6379}],
+			"endpoints": [
+				{"addresses": ["10.0.0.2"], "conditions": {"ready": true}, "targetRef": {"name": "redis-1"}},
+				{"addresses": ["10.0.0.1"], "targetRef": {"name": "redis-0"}},
+				{"addresses": ["10.0.0.3"], "conditions": {"ready": false}, "targetRef": {"name": "redis-2"}}
+			]
+		}]}`))
+	}))
+	defer srv.Close()
+
+	src := EndpointSlices{
+		Namespace: "cache",
+		Selector:  "kubernetes.io/service-name=redis",
+		PortName:  "redis",
+		APIServer: srv.URL,
+		Token:     "token",
+		Client:    srv.Client(),
+	}
+
+	servers, err := src.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(servers) != 2 || servers[0] != "10.0.0.1:6379:1 redis-0" || servers[1] != "10.0.0.2:6379:1 redis-1" {
+		t.Fatalf("Unexpected servers: %v", servers)
+	}
+
+	src.Token = "wrong"
+	if _, err := src.Servers(context.Background()); err == nil {
+		t.Fatal("Expected error for rejected request")
+	}
+}
@@ -0,0 +1,181 @@
+package twunproxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyProbeInterval is the interval between latency probes if none is configured.
+const DefaultLatencyProbeInterval = 5 * time.Second
+
+// LatencyProbeConfig configures a LatencyProber. Interval defaults to DefaultLatencyProbeInterval.
+// Window is the number of most recent round trips retained per instance for percentile calculation.
+// If GetKey is set, each probe also times a GET of that key in addition to the PING.
+type LatencyProbeConfig struct {
+	Interval time.Duration
+	Window   int
+	GetKey   string
+}
+
+// LatencyPercentiles are the rolling round-trip percentiles for one instance.
+type LatencyPercentiles struct {
+	Server  string        `json:"server"`
+	P50     time.Duration `json:"p50_ns"`
+	P95     time.Duration `json:"p95_ns"`
+	P99     time.Duration `json:"p99_ns"`
+	Samples int           `json:"samples"`
+}
+
+// LatencyProber periodically times round trips to every instance and maintains rolling percentiles.
+// Percentiles are published to the proxy metrics sink as "latency_p50_seconds", "latency_p95_seconds" and
+// "latency_p99_seconds" per instance. Failed probes are counted as "latency_probe_errors".
+type LatencyProber struct {
+	proxy   *ProxyConn
+	conf    LatencyProbeConfig
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	next    map[string]int
+	stop    chan bool
+	halt    func()
+}
+
+// ProbeLatency starts a LatencyProber for the proxy using the input configuration.
+// The prober is retained by the proxy so that routing policies can make use of its measurements.
+// Call Stop on the returned prober, or Close on the proxy, to end probing.
+func (r *ProxyConn) ProbeLatency(conf LatencyProbeConfig) *LatencyProber {
+	p := newLatencyProber(r, conf)
+	p.halt = r.onClose(func() { close(p.stop) })
+
+	r.mu.Lock()
+	r.prober = p
+	r.mu.Unlock()
+
+	go p.run()
+	return p
+}
+
+// Creates a prober for the input proxy without starting it.
+func newLatencyProber(r *ProxyConn, conf LatencyProbeConfig) *LatencyProber {
+	if conf.Interval <= 0 {
+		conf.Interval = DefaultLatencyProbeInterval
+	}
+	if conf.Window <= 0 {
+		conf.Window = 100
+	}
+
+	return &LatencyProber{
+		proxy:   r,
+		conf:    conf,
+		samples: make(map[string][]time.Duration),
+		next:    make(map[string]int),
+		stop:    make(chan bool),
+	}
+}
+
+// Probes immediately and then at the configured interval until stopped.
+func (p *LatencyProber) run() {
+	t := time.NewTicker(p.conf.Interval)
+	defer t.Stop()
+
+	p.probe()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			p.probe()
+		}
+	}
+}
+
+// Stop ends probing.
+func (p *LatencyProber) Stop() {
+	p.halt()
+}
+
+// Percentiles returns the current rolling percentiles for every instance.
+func (p *LatencyProber) Percentiles() []LatencyPercentiles {
+	t := p.proxy.topology()
+	res := make([]LatencyPercentiles, len(t.pools))
+	for i := range res {
+		res[i] = p.percentiles(t.server(i))
+	}
+	return res
+}
+
+// Calculates the rolling percentiles for the instance with the input address.
+func (p *LatencyProber) percentiles(server string) LatencyPercentiles {
+	p.mu.Lock()
+	sorted := append([]time.Duration(nil), p.samples[server]...)
+	p.mu.Unlock()
+
+	return percentilesOf(server, sorted)
+}
+
+// Calculates the percentiles of the input samples, which are sorted in place.
+func percentilesOf(server string, samples []time.Duration) LatencyPercentiles {
+	sort.Slice(samples, func(a, b int) bool { return samples[a] < samples[b] })
+
+	res := LatencyPercentiles{Server: server, Samples: len(samples)}
+	if len(samples) > 0 {
+		res.P50 = samples[(len(samples)-1)*50/100]
+		res.P95 = samples[(len(samples)-1)*95/100]
+		res.P99 = samples[(len(samples)-1)*99/100]
+	}
+	return res
+}
+
+// Times a round trip to each instance, records the samples and publishes updated percentiles.
+func (p *LatencyProber) probe() {
+	r := p.proxy
+	t := r.topology()
+
+	errs := t.forEach(func(i int, c Conn) error {
+		if err := p.timeCmd(t.server(i), c, "PING"); err != nil {
+			return err
+		}
+		if p.conf.GetKey != "" {
+			return p.timeCmd(t.server(i), c, "GET", p.conf.GetKey)
+		}
+		return nil
+	})
+
+	for i, err := range errs {
+		server := t.server(i)
+		if err != nil {
+			r.counter("latency_probe_errors", server, 1)
+			r.log().Debug("Latency probe failed", "server", server, "err", err)
+			continue
+		}
+
+		pc := p.percentiles(server)
+		r.gauge("latency_p50_seconds", server, pc.P50.Seconds())
+		r.gauge("latency_p95_seconds", server, pc.P95.Seconds())
+		r.gauge("latency_p99_seconds", server, pc.P99.Seconds())
+	}
+}
+
+// Runs the input command and records its round-trip time as a sample for the instance with the input address.
+func (p *LatencyProber) timeCmd(server string, c Conn, cmd string, args ...interface{}) error {
+	start := time.Now()
+	if _, err := c.Do(cmd, args...); err != nil {
+		return err
+	}
+	p.record(server, time.Since(start))
+	return nil
+}
+
+// Adds a sample to the ring buffer for the instance with the input address, replacing the oldest once full.
+func (p *LatencyProber) record(server string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.samples[server]) < p.conf.Window {
+		p.samples[server] = append(p.samples[server], d)
+		return
+	}
+
+	p.samples[server][p.next[server]] = d
+	p.next[server] = (p.next[server] + 1) % p.conf.Window
+}
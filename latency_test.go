@@ -0,0 +1,63 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestLatencyProberPercentilesOverRollingWindow(t *testing.T) {
+	proxy := getMockProxy(nil)
+	p := newLatencyProber(proxy, LatencyProbeConfig{Window: 10})
+
+	// The first ten samples are displaced by the second ten.
+	for i := 1; i <= 20; i++ {
+		p.record("0", time.Duration(i)*time.Millisecond)
+	}
+
+	pc := p.Percentiles()[0]
+	if pc.Samples != 10 || pc.P50 != 15*time.Millisecond || pc.P95 != 19*time.Millisecond || pc.P99 != 19*time.Millisecond {
+		t.Fatalf("Unexpected percentiles: %+v", pc)
+	}
+}
+
+func TestLatencyProberProbesEachPoolAndPublishes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("PING").Return("PONG", nil)
+	mockConn1.EXPECT().Do("GET", "probe").Return(nil, nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("PING").Return(nil, errors.New("connection refused"))
+	mockConn2.EXPECT().Close()
+
+	metrics := newFakeMetrics()
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithMetrics(metrics)(proxy)
+
+	p := newLatencyProber(proxy, LatencyProbeConfig{GetKey: "probe"})
+	p.probe()
+
+	pcs := p.Percentiles()
+	if pcs[0].Samples != 2 || pcs[1].Samples != 0 {
+		t.Fatalf("Unexpected percentiles: %+v", pcs)
+	}
+
+	if metrics.get("latency_probe_errors", "1") != 1 {
+		t.Fatal("Expected probe error to be counted.")
+	}
+}
+
+func TestLatencyProberDefaultsInterval(t *testing.T) {
+	proxy := getMockProxy()
+	p := proxy.ProbeLatency(LatencyProbeConfig{})
+	defer p.Stop()
+
+	if p.conf.Interval != DefaultLatencyProbeInterval {
+		t.Fatalf("Expected the default interval, got %v", p.conf.Interval)
+	}
+	time.Sleep(10 * time.Millisecond)
+}
@@ -0,0 +1,269 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoadMix weights the commands issued by GenerateLoad. Each command is chosen with probability proportional to
+// its weight, so {LPush: 1, BLPop: 1} pushes and pops in equal measure.
+type LoadMix struct {
+	BLPop int `json:"blpop"`
+	LPush int `json:"lpush"`
+	Get   int `json:"get"`
+	Set   int `json:"set"`
+}
+
+// KeyDistribution selects how GenerateLoad picks keys from the keyspace.
+type KeyDistribution int
+
+const (
+	// Every key is equally likely.
+	UniformKeys KeyDistribution = iota
+
+	// Low-numbered keys are much more likely than high-numbered ones, to model hot keys.
+	ZipfKeys
+)
+
+// LoadConfig configures GenerateLoad.
+// Keys are named KeyPrefix followed by a number below Keys. Lists and strings use separate keys,
+// suffixed ":list" and ":str", so that types do not clash.
+// Concurrency is the number of workers, each issuing commands back to back; Rate, if set, caps the total
+// commands per second across them, and must be finite.
+// ValueSize must not be negative. BLPopTimeout bounds each pop, and should be short since a pop of an empty
+// unmapped list waits that long on every instance.
+type LoadConfig struct {
+	Mix          LoadMix
+	Keys         int
+	KeyPrefix    string
+	Distribution KeyDistribution
+	Duration     time.Duration
+	Concurrency  int
+	Rate         float64
+	ValueSize    int
+	BLPopTimeout time.Duration
+}
+
+// ShardLoad reports the traffic served by one instance. Server is empty for commands that did not resolve to
+// an instance, such as a GET of a key that exists nowhere.
+type ShardLoad struct {
+	Server     string             `json:"server"`
+	Ops        int                `json:"ops"`
+	Errors     int                `json:"errors"`
+	Throughput float64            `json:"ops_per_second"`
+	Latency    LatencyPercentiles `json:"latency"`
+}
+
+// LoadReport summarises a run of GenerateLoad.
+type LoadReport struct {
+	Duration time.Duration `json:"duration_ns"`
+	Ops      int           `json:"ops"`
+	Errors   int           `json:"errors"`
+	Shards   []ShardLoad   `json:"shards"`
+}
+
+// The commands of a load mix, in the order of their weights.
+var loadCommands = []string{"BLPOP", "LPUSH", "GET", "SET"}
+
+// GenerateLoad issues a synthetic mix of BLPOP, LPUSH, GET and SET traffic through the proxy until the configured
+// duration elapses or the context ends, and reports throughput and latency percentiles per instance.
+// Each command is also published to the metrics sink, counted as "loadgen_ops" or "loadgen_errors" and observed
+// as "loadgen_latency_seconds" per instance. A BLPOP that times out is not counted as an error.
+// Use it to benchmark a pool before cutover; it writes to the keyspace, so choose a prefix that cannot clash.
+func (r *ProxyConn) GenerateLoad(ctx context.Context, conf LoadConfig) (LoadReport, error) {
+	weights := []int{conf.Mix.BLPop, conf.Mix.LPush, conf.Mix.Get, conf.Mix.Set}
+	total := 0
+	for _, w := range weights {
+		if w < 0 {
+			return LoadReport{}, errors.New("Load mix weights must not be negative.")
+		}
+		total += w
+	}
+	if total == 0 {
+		return LoadReport{}, errors.New("Load mix has no commands.")
+	}
+	if math.IsNaN(conf.Rate) || math.IsInf(conf.Rate, 0) {
+		return LoadReport{}, errors.New("Load rate must be finite.")
+	}
+	if conf.ValueSize < 0 {
+		return LoadReport{}, errors.New("Load value size must not be negative.")
+	}
+	if conf.Keys <= 0 {
+		conf.Keys = 1000
+	}
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = 1
+	}
+	if conf.BLPopTimeout <= 0 {
+		conf.BLPopTimeout = time.Second
+	}
+
+	if conf.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.Duration)
+		defer cancel()
+	}
+
+	var tick <-chan time.Time
+	if conf.Rate > 0 {
+		// Rates above one command per nanosecond are paced at that.
+		interval := time.Duration(float64(time.Second) / conf.Rate)
+		if interval < time.Nanosecond {
+			interval = time.Nanosecond
+		}
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	value := strings.Repeat("x", conf.ValueSize)
+	g := &loadGen{samples: make(map[string][]time.Duration), errors: make(map[string]int)}
+
+	start := time.Now()
+	wg := new(sync.WaitGroup)
+	for w := 0; w < conf.Concurrency; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			rnd := rand.New(rand.NewSource(seed))
+			var zipf *rand.Zipf
+			if conf.Distribution == ZipfKeys && conf.Keys > 1 {
+				zipf = rand.NewZipf(rnd, 1.1, 1, uint64(conf.Keys-1))
+			}
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+				if tick != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tick:
+					}
+				}
+
+				n := rnd.Intn(conf.Keys)
+				if zipf != nil {
+					n = int(zipf.Uint64())
+				}
+				key := conf.KeyPrefix + strconv.Itoa(n)
+
+				pick := rnd.Intn(total)
+				name := loadCommands[len(loadCommands)-1]
+				for i, w := range weights {
+					if pick < w {
+						name = loadCommands[i]
+						break
+					}
+					pick -= w
+				}
+
+				r.loadOp(ctx, g, name, key, value, conf.BLPopTimeout)
+			}
+		}(time.Now().UnixNano() + int64(w))
+	}
+	wg.Wait()
+
+	return g.report(time.Since(start)), nil
+}
+
+// Collects the samples of a load run per instance.
+type loadGen struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	errors  map[string]int
+}
+
+// Issues one load command for the input key and records its outcome.
+func (r *ProxyConn) loadOp(ctx context.Context, g *loadGen, name, key, value string, timeout time.Duration) {
+	var err error
+	start := time.Now()
+
+	switch name {
+	case "BLPOP":
+		key += ":list"
+		canMap := func(v interface{}) bool {
+			_, ok := v.([]interface{})
+			return ok
+		}
+		_, err = r.doRouted(ctx, &RedisCmd{name: name, key: key, args: []interface{}{timeout.Seconds()}}, canMap)
+		if err == ErrNoMapping {
+			err = nil
+		}
+	case "LPUSH":
+		key += ":list"
+		_, err = r.doKeyed(&RedisCmd{name: name, key: key, args: []interface{}{value}}, true)
+	case "GET":
+		key += ":str"
+		_, err = r.doKeyed(&RedisCmd{name: name, key: key}, false)
+	case "SET":
+		key += ":str"
+		_, err = r.doKeyed(&RedisCmd{name: name, key: key, args: []interface{}{value}}, true)
+	}
+	d := time.Since(start)
+
+	// Commands cut short by the end of the run are not counted.
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	server, _ := r.Lookup(key)
+	g.mu.Lock()
+	if err != nil {
+		g.errors[server]++
+	} else {
+		g.samples[server] = append(g.samples[server], d)
+	}
+	g.mu.Unlock()
+
+	if err != nil {
+		r.counter("loadgen_errors", server, 1)
+		return
+	}
+	r.counter("loadgen_ops", server, 1)
+	r.histogram("loadgen_latency_seconds", server, d.Seconds())
+}
+
+// Summarises the collected samples over the input duration.
+func (g *loadGen) report(d time.Duration) LoadReport {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	servers := make(map[string]bool)
+	for s := range g.samples {
+		servers[s] = true
+	}
+	for s := range g.errors {
+		servers[s] = true
+	}
+
+	res := LoadReport{Duration: d}
+	for s := range servers {
+		shard := ShardLoad{
+			Server:  s,
+			Ops:     len(g.samples[s]) + g.errors[s],
+			Errors:  g.errors[s],
+			Latency: percentilesOf(s, g.samples[s]),
+		}
+		if d > 0 {
+			shard.Throughput = float64(shard.Ops) / d.Seconds()
+		}
+		res.Ops += shard.Ops
+		res.Errors += shard.Errors
+		res.Shards = append(res.Shards, shard)
+	}
+
+	sort.Slice(res.Shards, func(a, b int) bool { return res.Shards[a].Server < res.Shards[b].Server })
+	return res
+}
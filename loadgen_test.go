@@ -0,0 +1,75 @@
+package twunproxy
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGenerateLoadReportsPerShard(t *testing.T) {
+	rec := &TopologyRecord{Servers: []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}, Hash: "fnv1a_64", Distribution: "ketama"}
+	proxy, err := NewSimulatedProxy(rec, NewMemorySimulator())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m := newFakeMetrics()
+	proxy.metrics = m
+
+	res, err := proxy.GenerateLoad(context.Background(), LoadConfig{
+		Mix:          LoadMix{Get: 1, Set: 1},
+		Keys:         50,
+		KeyPrefix:    "load:",
+		Distribution: ZipfKeys,
+		Duration:     50 * time.Millisecond,
+		Concurrency:  4,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Ops == 0 || res.Errors != 0 {
+		t.Fatalf("Unexpected report: %+v", res)
+	}
+
+	var sum int
+	for _, s := range res.Shards {
+		sum += s.Ops
+		if s.Server != "" && (s.Throughput <= 0 || s.Latency.Samples != s.Ops) {
+			t.Fatalf("Unexpected shard report: %+v", s)
+		}
+	}
+	if sum != res.Ops {
+		t.Fatalf("Expected shard operations to sum to %d, got %d", res.Ops, sum)
+	}
+	if m.get("loadgen_ops", "10.0.0.1:6379")+m.get("loadgen_ops", "10.0.0.2:6379")+m.get("loadgen_ops", "") != float64(res.Ops) {
+		t.Fatal("Expected every operation to be counted in metrics")
+	}
+}
+
+func TestGenerateLoadRejectsEmptyMix(t *testing.T) {
+	proxy := getMockProxy()
+	if _, err := proxy.GenerateLoad(context.Background(), LoadConfig{}); err == nil {
+		t.Fatal("Expected error for empty mix")
+	}
+}
+
+func TestGenerateLoadValidatesRateAndValueSize(t *testing.T) {
+	proxy := getMockProxy()
+	mix := LoadMix{Get: 1}
+
+	for _, conf := range []LoadConfig{
+		{Mix: mix, Rate: math.NaN()},
+		{Mix: mix, Rate: math.Inf(1)},
+		{Mix: mix, ValueSize: -1},
+	} {
+		if _, err := proxy.GenerateLoad(context.Background(), conf); err == nil {
+			t.Fatalf("Expected error for %+v", conf)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := proxy.GenerateLoad(ctx, LoadConfig{Mix: mix, Rate: 1e12}); err != nil {
+		t.Fatalf("Unexpected error for a rate above one per nanosecond: %v", err)
+	}
+}
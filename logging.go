@@ -0,0 +1,38 @@
+package twunproxy
+
+// Logger receives events from the proxy, including failures on background goroutines that are otherwise
+// only counted. The arguments after the message are alternating keys and values, as for log/slog,
+// and *slog.Logger satisfies Logger as it is. Implementations must be safe for concurrent use.
+//
+// Discovery, mapping and probe events are logged at debug level; retries, recoveries and configuration changes
+// at info level; instances becoming unavailable and background failures at warn level; and failures losing data
+// at error level.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// WithLogger sets the logger that receives events from the proxy and its subsystems. Nothing is logged without it.
+func WithLogger(l Logger) Option {
+	return func(r *ProxyConn) {
+		r.logger = l
+	}
+}
+
+// A Logger discarding every event, used when none is configured.
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// Returns the configured logger, or one discarding every event.
+func (r *ProxyConn) log() Logger {
+	if r.logger == nil {
+		return nopLogger{}
+	}
+	return r.logger
+}
@@ -0,0 +1,50 @@
+package twunproxy
+
+import (
+	"sync"
+	"testing"
+)
+
+// Records the messages logged at each level.
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordingLogger) add(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, level+" "+msg)
+}
+
+func (l *recordingLogger) Debug(msg string, _ ...interface{}) { l.add("DEBUG", msg) }
+func (l *recordingLogger) Info(msg string, _ ...interface{})  { l.add("INFO", msg) }
+func (l *recordingLogger) Warn(msg string, _ ...interface{})  { l.add("WARN", msg) }
+func (l *recordingLogger) Error(msg string, _ ...interface{}) { l.add("ERROR", msg) }
+
+func TestLoggerReceivesDiscoveryEvents(t *testing.T) {
+	l := &recordingLogger{}
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: []byte("v")}})
+	WithLogger(l)(proxy)
+
+	if _, err := proxy.Do(NewRedisCmd("GET", "key"), KeyFound); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"DEBUG Discovery started", "DEBUG Discovery finished", "DEBUG Mapping added"}
+	if len(l.msgs) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, l.msgs)
+	}
+	for i, m := range expected {
+		if l.msgs[i] != m {
+			t.Fatalf("Expected %v, got %v", expected, l.msgs)
+		}
+	}
+}
+
+func TestLoggerDefaultsToDiscarding(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: []byte("v")}})
+	if _, ok := proxy.log().(nopLogger); !ok {
+		t.Fatal("Expected events to be discarded without a logger.")
+	}
+}
@@ -0,0 +1,275 @@
+package twunproxy
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MappingStats describes the key mappings of a proxy. Entries is the number of mappings held, if the mapper
+// is the default map or configured by WithMaxMappings or WithMappingTTL, and MaxEntries and TTL are their settings.
+// Hits and Misses count lookups of mappings by commands. Evictions counts mappings dropped to respect the bound,
+// and Expirations mappings dropped once their TTL passed.
+type MappingStats struct {
+	Entries     int           `json:"entries"`
+	MaxEntries  int           `json:"max_entries"`
+	TTL         time.Duration `json:"ttl"`
+	Hits        int64         `json:"hits"`
+	Misses      int64         `json:"misses"`
+	Evictions   int64         `json:"evictions"`
+	Expirations int64         `json:"expirations"`
+}
+
+// Counts of mapping lookups, updated atomically.
+type mappingCounts struct {
+	hits        int64
+	misses      int64
+	evictions   int64
+	expirations int64
+}
+
+// WithMaxMappings bounds the number of key mappings held, evicting the least recently used mapping
+// when a new key is mapped beyond the bound. Evicted keys are simply rediscovered by their next command.
+// This replaces any KeyMapper configured before it other than by WithMappingTTL, whose TTL is kept.
+func WithMaxMappings(n int) Option {
+	return func(r *ProxyConn) {
+		r.lruMapper().max = n
+	}
+}
+
+// WithMappingTTL expires each key mapping the input duration after the key was last mapped, so that keys moved
+// by resharding or failover are rediscovered rather than routed to the wrong instance indefinitely.
+// Expired mappings are dropped when they are next looked up, or when newer mappings push them out.
+// This replaces any KeyMapper configured before it other than by WithMaxMappings, whose bound is kept.
+func WithMappingTTL(ttl time.Duration) Option {
+	return func(r *ProxyConn) {
+		r.lruMapper().ttl = ttl
+	}
+}
+
+// Returns the lruMapper of the proxy, installing an unbounded one without expiry if there is none yet.
+func (r *ProxyConn) lruMapper() *lruMapper {
+	if m, ok := r.mapper.(*lruMapper); ok {
+		return m
+	}
+
+	m := newLRUMapper(0, 0, func(expired bool) {
+		if expired {
+			atomic.AddInt64(&r.mappingCounts.expirations, 1)
+			r.counter("mapping_expirations", "", 1)
+			r.log().Debug("Mapping expired")
+		} else {
+			atomic.AddInt64(&r.mappingCounts.evictions, 1)
+			r.counter("mapping_evictions", "", 1)
+			r.log().Debug("Mapping evicted")
+		}
+	})
+	r.mapper = m
+	return m
+}
+
+// InvalidateKey removes any mapping for the input key, so that it is rediscovered by its next command.
+// It is the same as Unmap.
+func (r *ProxyConn) InvalidateKey(key string) {
+	r.unmap(key)
+}
+
+// InvalidateAll removes every key mapping, such as after resharding, so that every key is rediscovered.
+// An error is returned if the key mapper can neither purge nor enumerate its mappings.
+func (r *ProxyConn) InvalidateAll() error {
+	switch m := r.keys().(type) {
+	case KeyPurger:
+		m.Purge()
+	case KeyRanger:
+		m.Range(func(k string, _ ConnGetter) bool {
+			r.unmap(k)
+			return true
+		})
+	default:
+		return errors.New("Key mapper can neither purge nor enumerate its mappings.")
+	}
+	r.counter("mapping_invalidations", "", 1)
+	return nil
+}
+
+// MappingStats returns the number of key mappings held and the counts of lookups, evictions and expirations.
+func (r *ProxyConn) MappingStats() MappingStats {
+	s := MappingStats{
+		Hits:        atomic.LoadInt64(&r.mappingCounts.hits),
+		Misses:      atomic.LoadInt64(&r.mappingCounts.misses),
+		Evictions:   atomic.LoadInt64(&r.mappingCounts.evictions),
+		Expirations: atomic.LoadInt64(&r.mappingCounts.expirations),
+	}
+
+	switch m := r.keys().(type) {
+	case *lruMapper:
+		s.Entries, s.MaxEntries, s.TTL = m.len(), m.max, m.ttl
+	case instanceMap:
+		m.r.keyInstanceMutex.RLock()
+		s.Entries = len(m.r.KeyInstance)
+		m.r.keyInstanceMutex.RUnlock()
+	}
+	return s
+}
+
+// Counts a lookup of a mapping by a command, and publishes the ratio of hits to lookups as "mapping_hit_ratio".
+func (r *ProxyConn) countLookup(hit bool) {
+	var hits, misses int64
+	if hit {
+		hits = atomic.AddInt64(&r.mappingCounts.hits, 1)
+		misses = atomic.LoadInt64(&r.mappingCounts.misses)
+		r.counter("mapping_hits", "", 1)
+	} else {
+		misses = atomic.AddInt64(&r.mappingCounts.misses, 1)
+		hits = atomic.LoadInt64(&r.mappingCounts.hits)
+		r.counter("mapping_misses", "", 1)
+	}
+	r.gauge("mapping_hit_ratio", "", float64(hits)/float64(hits+misses))
+}
+
+// LRUMapper is a KeyMapper holding at most max mappings, evicting the least recently used beyond that,
+// and expiring each mapping ttl after it was made. A zero max or ttl disables the bound or expiry.
+type lruMapper struct {
+	max     int
+	ttl     time.Duration
+	onEvict func(expired bool)
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// A mapping held by an lruMapper.
+type lruEntry struct {
+	key     string
+	pool    ConnGetter
+	expires time.Time
+}
+
+// Returns whether the entry has expired at the input time.
+func (e *lruEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// Returns an lruMapper with the input bound and TTL, calling onEvict for each mapping evicted or expired.
+func newLRUMapper(max int, ttl time.Duration, onEvict func(expired bool)) *lruMapper {
+	return &lruMapper{max: max, ttl: ttl, onEvict: onEvict, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (m *lruMapper) Lookup(key string) (ConnGetter, bool) {
+	m.mu.Lock()
+	e, ok := m.entries[key]
+	if !ok {
+		m.mu.Unlock()
+		return nil, false
+	}
+
+	entry := e.Value.(*lruEntry)
+	if entry.expired(time.Now()) {
+		m.remove(e)
+		m.mu.Unlock()
+		m.evicted(0, 1)
+		return nil, false
+	}
+
+	m.order.MoveToFront(e)
+	m.mu.Unlock()
+	return entry.pool, true
+}
+
+func (m *lruMapper) Map(key string, pool ConnGetter) {
+	now := time.Now()
+	var expires time.Time
+	if m.ttl > 0 {
+		expires = now.Add(m.ttl)
+	}
+
+	m.mu.Lock()
+	if e, ok := m.entries[key]; ok {
+		entry := e.Value.(*lruEntry)
+		entry.pool, entry.expires = pool, expires
+		m.order.MoveToFront(e)
+		m.mu.Unlock()
+		return
+	}
+
+	m.entries[key] = m.order.PushFront(&lruEntry{key: key, pool: pool, expires: expires})
+
+	// Expired mappings at the back are dropped first, and then the least recently used beyond the bound.
+	evicted, expired := 0, 0
+	for oldest := m.order.Back(); oldest != nil && oldest.Value.(*lruEntry).expired(now); oldest = m.order.Back() {
+		m.remove(oldest)
+		expired++
+	}
+	for m.max > 0 && m.order.Len() > m.max {
+		m.remove(m.order.Back())
+		evicted++
+	}
+	m.mu.Unlock()
+
+	m.evicted(evicted, expired)
+}
+
+// Removes the input element. The mutex must be held.
+func (m *lruMapper) remove(e *list.Element) {
+	m.order.Remove(e)
+	delete(m.entries, e.Value.(*lruEntry).key)
+}
+
+// Reports the input numbers of evicted and expired mappings. The mutex must not be held.
+func (m *lruMapper) evicted(evicted, expired int) {
+	if m.onEvict == nil {
+		return
+	}
+	for ; evicted > 0; evicted-- {
+		m.onEvict(false)
+	}
+	for ; expired > 0; expired-- {
+		m.onEvict(true)
+	}
+}
+
+func (m *lruMapper) Unmap(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[key]; ok {
+		m.remove(e)
+	}
+}
+
+// Range calls fn for a copy of the mappings that have not expired, from most to least recently used,
+// so that fn may itself change them.
+func (m *lruMapper) Range(fn func(key string, pool ConnGetter) bool) {
+	now := time.Now()
+	m.mu.Lock()
+	copied := make([]lruEntry, 0, m.order.Len())
+	for e := m.order.Front(); e != nil; e = e.Next() {
+		if entry := e.Value.(*lruEntry); !entry.expired(now) {
+			copied = append(copied, *entry)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, e := range copied {
+		if !fn(e.key, e.pool) {
+			return
+		}
+	}
+}
+
+func (m *lruMapper) Purge() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.order.Init()
+	m.entries = make(map[string]*list.Element)
+}
+
+// Returns the number of mappings held.
+func (m *lruMapper) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
@@ -0,0 +1,93 @@
+package twunproxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxMappingsEvictsLeastRecentlyUsed(t *testing.T) {
+	pool := connPool{&nilStyleConn{}}
+	metrics := newFakeMetrics()
+	proxy := getMockProxy(pool)
+	WithMetrics(metrics)(proxy)
+	WithMaxMappings(2)(proxy)
+
+	proxy.mapKey("a", pool)
+	proxy.mapKey("b", pool)
+	proxy.lookup("a")
+	proxy.mapKey("c", pool)
+
+	if _, ok := proxy.lookup("b"); ok {
+		t.Fatal("Expected the least recently used mapping to be evicted.")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok := proxy.lookup(k); !ok {
+			t.Fatalf("Expected %s to remain mapped", k)
+		}
+	}
+
+	s := proxy.MappingStats()
+	if s.Entries != 2 || s.MaxEntries != 2 || s.Evictions != 1 || metrics.get("mapping_evictions", "") != 1 {
+		t.Fatalf("Unexpected stats %+v", s)
+	}
+}
+
+func TestMappingStatsCountsCommandLookups(t *testing.T) {
+	pool := connPool{&nilStyleConn{reply: "VALUE"}}
+	proxy := getMockProxy(pool)
+	canMap := func(v interface{}) bool { return v != nil }
+
+	proxy.Do(NewRedisCmd("GET", "KEY"), canMap)
+	proxy.Do(NewRedisCmd("GET", "KEY"), canMap)
+
+	s := proxy.MappingStats()
+	if s.Hits != 1 || s.Misses != 1 || s.Entries != 1 || s.MaxEntries != 0 {
+		t.Fatalf("Unexpected stats %+v", s)
+	}
+}
+
+func TestMappingTTLExpiresMappings(t *testing.T) {
+	pool := connPool{&nilStyleConn{}}
+	proxy := getMockProxy(pool)
+	WithMaxMappings(10)(proxy)
+	WithMappingTTL(20 * time.Millisecond)(proxy)
+
+	proxy.mapKey("a", pool)
+	if _, ok := proxy.lookup("a"); !ok {
+		t.Fatal("Expected the mapping before its TTL.")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := proxy.lookup("a"); ok {
+		t.Fatal("Expected the mapping to expire.")
+	}
+
+	s := proxy.MappingStats()
+	if s.Expirations != 1 || s.Entries != 0 || s.MaxEntries != 10 || s.TTL != 20*time.Millisecond {
+		t.Fatalf("Unexpected stats %+v", s)
+	}
+}
+
+func TestInvalidateAllRemovesEveryMapping(t *testing.T) {
+	pool := connPool{&nilStyleConn{}}
+	proxy := getMockProxy(pool)
+	proxy.mapKey("a", pool)
+	proxy.mapKey("b", pool)
+
+	proxy.InvalidateKey("a")
+	if _, ok := proxy.lookup("a"); ok {
+		t.Fatal("Expected the invalidated key to be unmapped.")
+	}
+
+	if err := proxy.InvalidateAll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := proxy.lookup("b"); ok {
+		t.Fatal("Expected every key to be unmapped.")
+	}
+
+	WithKeyMapper(struct{ KeyMapper }{instanceMap{proxy}})(proxy)
+	if err := proxy.InvalidateAll(); err == nil {
+		t.Fatal("Expected an error for a mapper that can neither purge nor enumerate.")
+	}
+}
@@ -0,0 +1,171 @@
+package twunproxy
+
+/******************************************************
+ * Key-to-pool mapping storage.
+ * By default mappings are held in the KeyInstance map. A KeyMapper may be supplied instead,
+ * for example to bound memory at very high key cardinality.
+ ******************************************************/
+
+// KeyMapper stores the mapping of keys to the pools that hold them. Implementations must be safe for concurrent use.
+// A mapper may forget mappings at any time, such as on eviction; forgotten keys are simply rediscovered.
+type KeyMapper interface {
+	Lookup(key string) (ConnGetter, bool)
+	Map(key string, pool ConnGetter)
+	Unmap(key string)
+}
+
+// KeyRanger is implemented by KeyMappers that can enumerate their mappings.
+// Range calls fn for each mapping until it returns false. AuditMappings requires it.
+type KeyRanger interface {
+	Range(fn func(key string, pool ConnGetter) bool)
+}
+
+// KeyPurger is implemented by KeyMappers that can remove every mapping at once.
+// Purge is called when the pools are reloaded. Mappers without it are left to fail lookups for stale pools,
+// which are then rediscovered.
+type KeyPurger interface {
+	Purge()
+}
+
+// KeyPruner is implemented by KeyMappers that hold references to pools apart from their mappings,
+// such as a registry of the pools seen. Prune is called with the current pools whenever the servers change,
+// once mappings to removed pools have been dropped, and should release references to any other pool.
+type KeyPruner interface {
+	Prune(pools []ConnGetter)
+}
+
+// WithKeyMapper stores key mappings in the input KeyMapper instead of the KeyInstance map.
+func WithKeyMapper(m KeyMapper) Option {
+	return func(r *ProxyConn) {
+		r.mapper = m
+	}
+}
+
+// Lookup returns the address of the instance that the input key is mapped to, if it is mapped.
+// Mappings to pools that are no longer configured, such as after Reload, are not reported.
+func (r *ProxyConn) Lookup(key string) (string, bool) {
+	pool, ok := r.lookup(key)
+	if !ok {
+		return "", false
+	}
+
+	server := r.topology().serverOf(pool)
+	return server, server != ""
+}
+
+// Map maps the input key to the instance with the input address, so that commands for the key are sent there
+// without discovery. It is safe to call concurrently with commands.
+func (r *ProxyConn) Map(key, server string) error {
+	t := r.topology()
+	i, err := t.index(server)
+	if err != nil {
+		return err
+	}
+
+	r.mapKey(key, t.pools[i])
+	return nil
+}
+
+// Unmap removes any mapping for the input key, so that it is rediscovered by the next command.
+func (r *ProxyConn) Unmap(key string) {
+	r.unmap(key)
+}
+
+// Returns the store of key mappings: the configured KeyMapper, or else the KeyInstance map.
+func (r *ProxyConn) keys() KeyMapper {
+	if r.mapper != nil {
+		return r.mapper
+	}
+	return instanceMap{r}
+}
+
+// Returns the pool mapped to the input key.
+func (r *ProxyConn) lookup(key string) (ConnGetter, bool) {
+	return r.keys().Lookup(key)
+}
+
+// Maps the input key to the pool.
+func (r *ProxyConn) mapKey(key string, pool ConnGetter) {
+	r.keys().Map(key, pool)
+}
+
+// Removes any mapping for the input key.
+func (r *ProxyConn) unmap(key string) {
+	r.keys().Unmap(key)
+}
+
+// Returns a copy of every mapping, or false if the mapper cannot enumerate them.
+func (r *ProxyConn) mappings() (map[string]ConnGetter, bool) {
+	kr, ok := r.keys().(KeyRanger)
+	if !ok {
+		return nil, false
+	}
+
+	res := make(map[string]ConnGetter)
+	kr.Range(func(k string, p ConnGetter) bool {
+		res[k] = p
+		return true
+	})
+	return res, true
+}
+
+// Removes every mapping, if the mapper supports it.
+func (r *ProxyConn) purgeMappings() {
+	if kp, ok := r.keys().(KeyPurger); ok {
+		kp.Purge()
+	}
+}
+
+// Releases the references of the mapper to pools not in the current topology, if the mapper supports it.
+func (r *ProxyConn) pruneMappings() {
+	if kp, ok := r.keys().(KeyPruner); ok {
+		kp.Prune(r.topology().pools)
+	}
+}
+
+// InstanceMap is the default KeyMapper, which stores mappings in the KeyInstance map of the proxy under its mutex.
+// The map is retained on the proxy for compatibility; use Lookup, Map and Unmap rather than accessing it directly.
+type instanceMap struct {
+	r *ProxyConn
+}
+
+func (m instanceMap) Lookup(key string) (ConnGetter, bool) {
+	m.r.keyInstanceMutex.RLock()
+	defer m.r.keyInstanceMutex.RUnlock()
+	pool, ok := m.r.KeyInstance[key]
+	return pool, ok
+}
+
+func (m instanceMap) Map(key string, pool ConnGetter) {
+	m.r.keyInstanceMutex.Lock()
+	defer m.r.keyInstanceMutex.Unlock()
+	m.r.KeyInstance[key] = pool
+}
+
+func (m instanceMap) Unmap(key string) {
+	m.r.keyInstanceMutex.Lock()
+	defer m.r.keyInstanceMutex.Unlock()
+	delete(m.r.KeyInstance, key)
+}
+
+// Range calls fn for a copy of the mappings, so that fn may itself change them.
+func (m instanceMap) Range(fn func(key string, pool ConnGetter) bool) {
+	m.r.keyInstanceMutex.RLock()
+	copied := make(map[string]ConnGetter, len(m.r.KeyInstance))
+	for k, p := range m.r.KeyInstance {
+		copied[k] = p
+	}
+	m.r.keyInstanceMutex.RUnlock()
+
+	for k, p := range copied {
+		if !fn(k, p) {
+			return
+		}
+	}
+}
+
+func (m instanceMap) Purge() {
+	m.r.keyInstanceMutex.Lock()
+	defer m.r.keyInstanceMutex.Unlock()
+	m.r.KeyInstance = make(map[string]ConnGetter, len(m.r.KeyInstance))
+}
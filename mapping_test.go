@@ -0,0 +1,97 @@
+package twunproxy
+
+import (
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"sync"
+	"testing"
+)
+
+// A KeyMapper over a plain map, without Range or Purge.
+type mapMapper struct {
+	mu sync.Mutex
+	m  map[string]ConnGetter
+}
+
+func (mm *mapMapper) Lookup(key string) (ConnGetter, bool) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	p, ok := mm.m[key]
+	return p, ok
+}
+
+func (mm *mapMapper) Map(key string, pool ConnGetter) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.m[key] = pool
+}
+
+func (mm *mapMapper) Unmap(key string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	delete(mm.m, key)
+}
+
+func TestDoUsesConfiguredKeyMapper(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("CMD", "KEY", "A1", "A2").Return("OK", nil).Times(2)
+	mockConn.EXPECT().Close().Times(2)
+
+	mm := &mapMapper{m: make(map[string]ConnGetter)}
+	proxy := getMockProxy(mockPool)
+	WithKeyMapper(mm)(proxy)
+
+	canMap := func(v interface{}) bool { return v != nil }
+	proxy.Do(getRedisCmd(), canMap)
+	proxy.Do(getRedisCmd(), canMap)
+
+	if mm.m["KEY"] != mockPool || len(proxy.KeyInstance) != 0 {
+		t.Fatal("Expected mapping to be held by the key mapper.")
+	}
+
+	if _, err := proxy.AuditMappings(false, false); err == nil {
+		t.Fatal("Expected error auditing a mapper that cannot enumerate.")
+	}
+}
+
+func TestMappingAccessorsAreSafeWithConcurrentDo(t *testing.T) {
+	pool := connPool{&nilStyleConn{reply: []byte("VAL")}}
+	proxy := getMockProxy(pool)
+	proxy.Servers = []string{"10.0.0.1:6379:1"}
+	canMap := func(v interface{}) bool { return v != nil }
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		key := fmt.Sprintf("KEY%d", i)
+		go func() {
+			defer wg.Done()
+			proxy.Do(NewRedisCmd("GET", key), canMap)
+		}()
+		go func() {
+			defer wg.Done()
+			proxy.Map(key, "10.0.0.1:6379")
+			proxy.Lookup(key)
+			proxy.Unmap(key)
+		}()
+	}
+	wg.Wait()
+
+	if err := proxy.Map("KEY", "10.0.0.1:6379"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if server, ok := proxy.Lookup("KEY"); !ok || server != "10.0.0.1:6379" {
+		t.Fatalf("Unexpected lookup: %s, %v", server, ok)
+	}
+	if err := proxy.Map("KEY", "10.0.0.9:6379"); err == nil {
+		t.Fatal("Expected error mapping to an unknown server.")
+	}
+
+	proxy.Unmap("KEY")
+	if _, ok := proxy.Lookup("KEY"); ok {
+		t.Fatal("Expected key to be unmapped.")
+	}
+}
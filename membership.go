@@ -0,0 +1,90 @@
+package twunproxy
+
+import (
+	"errors"
+)
+
+// AddPool adds the input pool for the server with the input Twemproxy descriptor, "host:port:weight name",
+// to the live proxy, so that orchestration can follow topology changes without recreating the proxy and losing
+// its mappings. The pool is checked with PING before anything is changed. The hash ring is rebuilt with the same
+// hash and distribution, so keys placed by it may move to the new server; keys already mapped stay mapped.
+// Changes are lost to the next Reload, SyncBackends or WatchBackends, which install the servers of their source.
+func (r *ProxyConn) AddPool(desc string, pool ConnGetter) error {
+	c := pool.Get()
+	_, err := c.Do("PING")
+	c.Close()
+	if err != nil {
+		return err
+	}
+
+	old, t, err := r.updateTopology(func(old *topology) (*topology, error) {
+		if _, err := old.index(ServerAddr(desc)); err == nil {
+			return nil, errors.New("Server " + ServerAddr(desc) + " is already in the pool.")
+		}
+
+		pools := append(append([]ConnGetter(nil), old.pools...), pool)
+		servers := append(append([]string(nil), old.servers...), desc)
+		return &topology{pools: pools, servers: servers, ring: rebuildRing(old.ring, servers), hashTag: old.hashTag}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.drainRemoved(old, t)
+	r.log().Info("Pool added", "server", ServerAddr(desc))
+	return nil
+}
+
+// RemovePool removes the pool for the instance with the input server address from the live proxy.
+// Mappings to the pool are dropped, to be rediscovered, and the pool is drained as set by WithDrainTimeout.
+// Commands already in flight complete against it. The hash ring is rebuilt as for AddPool.
+func (r *ProxyConn) RemovePool(server string) error {
+	old, t, err := r.updateTopology(func(old *topology) (*topology, error) {
+		i, err := old.index(server)
+		if err != nil {
+			return nil, err
+		}
+
+		pools := append(append([]ConnGetter(nil), old.pools[:i]...), old.pools[i+1:]...)
+		servers := append(append([]string(nil), old.servers[:i]...), old.servers[i+1:]...)
+		return &topology{pools: pools, servers: servers, ring: rebuildRing(old.ring, servers), hashTag: old.hashTag}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.dropRemoved(t)
+	r.drainRemoved(old, t)
+	r.log().Info("Pool removed", "server", server)
+	return nil
+}
+
+// Replaces the topology of the proxy with the one derived from it by the input function, holding the topology lock
+// throughout so that concurrent changes are not lost. The old and new topologies are returned.
+// The function cannot derive a topology from pools without server descriptors.
+func (r *ProxyConn) updateTopology(fn func(*topology) (*topology, error)) (*topology, *topology, error) {
+	r.topologyMutex.Lock()
+	defer r.topologyMutex.Unlock()
+
+	old := &topology{pools: r.Pools, servers: r.Servers, ring: r.ring, hashTag: r.hashTag}
+	if len(old.servers) != len(old.pools) {
+		return nil, nil, errors.New("Pools do not have a server descriptor each.")
+	}
+
+	t, err := fn(old)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.Pools, r.Servers, r.ring, r.hashTag = t.pools, t.servers, t.ring, t.hashTag
+	return old, t, nil
+}
+
+// Returns a ring for the input servers with the hash, distribution and hash tag of the input ring,
+// or nil if it is nil.
+func rebuildRing(h *hashRing, servers []string) *hashRing {
+	if h == nil {
+		return nil
+	}
+	ring, _ := newHashRing(servers, h.hashName, h.dist, h.tag)
+	return ring
+}
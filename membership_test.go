@@ -0,0 +1,97 @@
+package twunproxy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddPoolJoinsDiscoveryAndRing(t *testing.T) {
+	a := connPool{&nilStyleConn{}}
+	proxy := getMockProxy(a)
+	proxy.Servers = []string{"a:6379:1"}
+	proxy.ring, _ = newHashRing(proxy.Servers, "fnv1a_32", "modula", "")
+	proxy.KeyInstance["mapped"] = a
+
+	b := connPool{&nilStyleConn{reply: []byte("v")}}
+	if err := proxy.AddPool("b:6379:1", b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := proxy.AddPool("b:6379:2", b); err == nil {
+		t.Fatal("Expected error for server already in the pool.")
+	}
+
+	if proxy.KeyInstance["mapped"] != a {
+		t.Fatal("Expected existing mappings to be kept.")
+	}
+	if v, err := proxy.Do(NewRedisCmd("GET", "key"), KeyFound); err != nil || string(v.([]byte)) != "v" {
+		t.Fatalf("Expected key to be discovered on the added pool, got %v and %v", v, err)
+	}
+	if len(proxy.ring.points) != 2 {
+		t.Fatalf("Expected ring to place keys on both servers, got %d points", len(proxy.ring.points))
+	}
+	if n := proxy.SnapshotStats().Counters["servers_added"]["b:6379"]; n != 1 {
+		t.Fatalf("Expected added server to be counted, got %v", n)
+	}
+}
+
+func TestAddPoolRejectsFailingPool(t *testing.T) {
+	proxy := getMockProxy()
+	if err := proxy.AddPool("a:6379:1", connPool{&nilStyleConn{err: errors.New("Down.")}}); err == nil {
+		t.Fatal("Expected error for pool failing PING.")
+	}
+	if len(proxy.Pools) != 0 {
+		t.Fatal("Expected failing pool not to be added.")
+	}
+}
+
+func TestRemovePoolDropsItsMappings(t *testing.T) {
+	a, b := connPool{&nilStyleConn{}}, connPool{&nilStyleConn{}}
+	proxy := getMockProxy(a, b)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.KeyInstance["on-a"] = a
+	proxy.KeyInstance["on-b"] = b
+
+	if err := proxy.RemovePool("a:6379"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := proxy.RemovePool("c:6379"); err == nil {
+		t.Fatal("Expected error for unknown server.")
+	}
+
+	if len(proxy.Pools) != 1 || proxy.Pools[0] != b || proxy.Servers[0] != "b:6379:1" {
+		t.Fatalf("Unexpected topology: %v", proxy.Servers)
+	}
+	if _, ok := proxy.KeyInstance["on-a"]; ok {
+		t.Fatal("Expected mapping to removed pool to be dropped.")
+	}
+	if proxy.KeyInstance["on-b"] != b {
+		t.Fatal("Expected mapping to remaining pool to be kept.")
+	}
+}
+
+// A mapper recording the pools it is pruned to.
+type pruningMapper struct {
+	*ShardedKeyMapper
+	pruned []ConnGetter
+}
+
+func (m *pruningMapper) Prune(pools []ConnGetter) { m.pruned = pools }
+
+func TestRemovePoolPrunesMapper(t *testing.T) {
+	a, b := connPool{&nilStyleConn{}}, connPool{&nilStyleConn{}}
+	proxy := getMockProxy(a, b)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	m := &pruningMapper{ShardedKeyMapper: NewShardedKeyMapper(1)}
+	WithKeyMapper(m)(proxy)
+	proxy.mapKey("on-a", a)
+
+	if err := proxy.RemovePool("a:6379"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(m.pruned) != 1 || m.pruned[0] != b {
+		t.Fatalf("Expected the mapper to be pruned to the remaining pool, got %v", m.pruned)
+	}
+	if _, ok := m.Lookup("on-a"); ok {
+		t.Fatal("Expected mapping to removed pool to be dropped.")
+	}
+}
@@ -0,0 +1,170 @@
+package twunproxy
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/******************************************************
+ * Memcached pools, for Twemproxy pools that set redis to false.
+ * Memcached connections are adapted to Conn, so that discovery and broadcasts work on them as on Redis.
+ ******************************************************/
+
+// MemcachedConn is the minimum implemented signature for underlying memcached connections, parallel to Conn.
+// Get returns a nil value and no error for a missing key, and Delete returns false for a missing key.
+// An expiration of zero means the item does not expire.
+type MemcachedConn interface {
+	Close() error
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, expiration time.Duration) error
+	Delete(key string) (bool, error)
+	Ping() error
+}
+
+// MemcachedGetter is the interface that underlying memcached connection pools should implement.
+// Pools that also have a Close method returning an error are closed by ProxyConn.Close.
+type MemcachedGetter interface {
+	Get() MemcachedConn
+}
+
+// CreateMemcachedPool is the signature for returning a memcached connection pool for the input address.
+type CreateMemcachedPool func(string) MemcachedGetter
+
+// NewMemcachedProxyConn creates a proxy for a Twemproxy memcached pool, which is one that sets redis to false,
+// as NewProxyConn does for Redis pools. Commands are issued to the memcached connections as Redis commands,
+// of which PING, GET, SET with an optional EX or PX expiration, and DEL are supported; others fail.
+// A missing key is a nil reply to GET, so commands are discovered and broadcast as for Redis.
+// An error is returned if the pool is not a memcached pool.
+func NewMemcachedProxyConn(
+	confPath, poolName string,
+	keyCap int,
+	create CreateMemcachedPool,
+	opts ...Option) (*ProxyConn, error) {
+
+	return newProxyConn(poolName, keyCap, memcachedPools(create), func() (PoolConfig, error) {
+		return readPoolConfig(confPath, poolName)
+	}, true, opts)
+}
+
+// NewMemcachedProxyConnFromConfig creates a proxy for a memcached pool as for NewMemcachedProxyConn,
+// from an already parsed or constructed pool configuration.
+func NewMemcachedProxyConnFromConfig(
+	conf PoolConfig,
+	keyCap int,
+	create CreateMemcachedPool,
+	opts ...Option) (*ProxyConn, error) {
+
+	return newProxyConn(conf.Name, keyCap, memcachedPools(create), func() (PoolConfig, error) {
+		return conf, nil
+	}, true, opts)
+}
+
+// Returns a CreatePool creating memcached pools for the addresses of server descriptors. Memcached has no auth.
+func memcachedPools(create CreateMemcachedPool) CreatePool {
+	return func(desc, _ string) ConnGetter {
+		return memcachedPool{create(ServerAddr(desc))}
+	}
+}
+
+// A memcached pool adapted to ConnGetter.
+type memcachedPool struct {
+	pool MemcachedGetter
+}
+
+func (p memcachedPool) Get() Conn {
+	return memcachedConn{p.pool.Get()}
+}
+
+func (p memcachedPool) Close() error {
+	if c, ok := p.pool.(interface{ Close() error }); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// A memcached connection adapted to Conn, issuing Redis commands as their memcached equivalents.
+type memcachedConn struct {
+	conn MemcachedConn
+}
+
+func (c memcachedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c memcachedConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	switch strings.ToUpper(commandName) {
+	case "PING":
+		if err := c.conn.Ping(); err != nil {
+			return nil, err
+		}
+		return "PONG", nil
+
+	case "GET":
+		if len(args) != 1 {
+			return nil, errors.New("GET takes one key.")
+		}
+		v, err := c.conn.Get(memcachedArg(args[0]))
+		if err != nil || v == nil {
+			return nil, err
+		}
+		return v, nil
+
+	case "SET":
+		if len(args) != 2 && len(args) != 4 {
+			return nil, errors.New("SET takes a key, a value and an optional EX or PX expiration.")
+		}
+		expiration, err := memcachedExpiration(args[2:])
+		if err != nil {
+			return nil, err
+		}
+		if err := c.conn.Set(memcachedArg(args[0]), []byte(memcachedArg(args[1])), expiration); err != nil {
+			return nil, err
+		}
+		return "OK", nil
+
+	case "DEL":
+		var n int64
+		for _, k := range args {
+			deleted, err := c.conn.Delete(memcachedArg(k))
+			if err != nil {
+				return nil, err
+			}
+			if deleted {
+				n++
+			}
+		}
+		return n, nil
+	}
+	return nil, errors.New("Command " + commandName + " is not supported by memcached pools.")
+}
+
+// Returns the expiration of the optional "EX seconds" or "PX milliseconds" arguments of SET.
+func memcachedExpiration(args []interface{}) (time.Duration, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(memcachedArg(args[1]), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errors.New("Invalid SET expiration.")
+	}
+
+	switch strings.ToUpper(memcachedArg(args[0])) {
+	case "EX":
+		return time.Duration(n) * time.Second, nil
+	case "PX":
+		return time.Duration(n) * time.Millisecond, nil
+	}
+	return 0, errors.New("Unsupported SET option " + memcachedArg(args[0]) + ".")
+}
+
+// Returns the input command argument as a string, formatting other types as Redis clients do.
+func memcachedArg(v interface{}) string {
+	if b := replyBytes(v); b != nil {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
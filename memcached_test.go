@@ -0,0 +1,96 @@
+package twunproxy
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemcachedProxyDiscoversAndSetsKeys(t *testing.T) {
+	servers := map[string]*fakeMemcached{
+		"10.0.0.1:11211": {items: map[string][]byte{}},
+		"10.0.0.2:11211": {items: map[string][]byte{"KEY": []byte("value")}},
+	}
+	create := func(addr string) MemcachedGetter { return fakeMemcachedPool{servers[addr]} }
+
+	conf, err := ParsePoolConfig([]byte("beta:\n  redis: false\n  servers:\n   - 10.0.0.1:11211:1\n   - 10.0.0.2:11211:1\n"), "beta")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	proxy, err := NewMemcachedProxyConnFromConfig(conf, 0, create)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	v, err := proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil })
+	if err != nil || string(v.([]byte)) != "value" || proxy.KeyInstance["KEY"] != proxy.Pools[1] {
+		t.Fatalf("Unexpected reply %v, %v", v, err)
+	}
+
+	if _, err := proxy.Do(NewRedisCmd("SET", "KEY", "other", "EX", 10), func(v interface{}) bool { return true }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if item := servers["10.0.0.2:11211"]; string(item.items["KEY"]) != "other" || item.expiration != 10*time.Second {
+		t.Fatalf("Unexpected item: %q, %v", item.items["KEY"], item.expiration)
+	}
+}
+
+func TestMemcachedConnRejectsUnsupportedCommands(t *testing.T) {
+	c := memcachedConn{&fakeMemcached{items: map[string][]byte{"A": nil}}}
+
+	if _, err := c.Do("INCR", "A"); err == nil || !strings.Contains(err.Error(), "INCR") {
+		t.Fatalf("Expected unsupported command error, got %v", err)
+	}
+	if n, err := c.Do("DEL", "A", "B"); err != nil || n != int64(1) {
+		t.Fatalf("Unexpected DEL reply %v, %v", n, err)
+	}
+}
+
+func TestNewProxyConnRejectsMemcachedPool(t *testing.T) {
+	conf, _ := ParsePoolConfig([]byte("beta:\n  redis: false\n  servers:\n   - 10.0.0.1:11211:1\n"), "beta")
+	create := func(desc, auth string) ConnGetter { return nil }
+
+	if _, err := NewProxyConnFromConfig(conf, 0, create); err == nil {
+		t.Fatal("Expected error for memcached pool.")
+	}
+}
+
+// A memcached instance holding items in memory.
+type fakeMemcached struct {
+	mu         sync.Mutex
+	items      map[string][]byte
+	expiration time.Duration
+}
+
+func (m *fakeMemcached) Close() error { return nil }
+
+func (m *fakeMemcached) Ping() error { return nil }
+
+func (m *fakeMemcached) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.items[key], nil
+}
+
+func (m *fakeMemcached) Set(key string, value []byte, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key], m.expiration = value, expiration
+	return nil
+}
+
+func (m *fakeMemcached) Delete(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.items[key]
+	delete(m.items, key)
+	return ok, nil
+}
+
+// A pool returning connections to a fakeMemcached.
+type fakeMemcachedPool struct {
+	m *fakeMemcached
+}
+
+func (p fakeMemcachedPool) Get() MemcachedConn { return p.m }
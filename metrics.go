@@ -0,0 +1,34 @@
+package twunproxy
+
+// Metrics receives measurements from ProxyConn and its subsystems.
+// Names are stable snake_case identifiers such as "evicted_keys_per_second".
+// Instance is the address of the server the measurement relates to, or empty for pool-wide values.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	Counter(name, instance string, delta float64)
+	Gauge(name, instance string, value float64)
+	Observe(name, instance string, value float64)
+}
+
+// Records a gauge value if a metrics sink is configured.
+func (r *ProxyConn) gauge(name, instance string, value float64) {
+	if r.metrics != nil {
+		r.metrics.Gauge(name, instance, value)
+	}
+}
+
+// Records a counter increment, and passes it to the metrics sink if one is configured.
+func (r *ProxyConn) counter(name, instance string, delta float64) {
+	r.stats.add(name, instance, delta)
+	if r.metrics != nil {
+		r.metrics.Counter(name, instance, delta)
+	}
+}
+
+// Records an observation, and passes it to the metrics sink if one is configured.
+func (r *ProxyConn) histogram(name, instance string, value float64) {
+	r.stats.observe(name, instance, value)
+	if r.metrics != nil {
+		r.metrics.Observe(name, instance, value)
+	}
+}
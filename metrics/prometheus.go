@@ -0,0 +1,157 @@
+// Package metrics exports the measurements of a twunproxy.ProxyConn as Prometheus collectors.
+// Prometheus implements twunproxy.Metrics, so other metrics systems can be supported in the same way
+// by implementing that interface and passing it to twunproxy.WithMetrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/txodds/twunproxy"
+	"strings"
+	"sync"
+)
+
+// DefaultNamespace prefixes the names of the metrics exported, unless Options sets another.
+const DefaultNamespace = "twunproxy"
+
+// DefaultBuckets are the histogram buckets of the named observations, unless Options sets others.
+// Other observations, such as "command_latency_seconds", use prometheus.DefBuckets, which suit latencies.
+var DefaultBuckets = map[string][]float64{
+	"discovery_fanout": prometheus.LinearBuckets(1, 1, 16),
+}
+
+// Options configures a Prometheus sink.
+// ConstLabels are added to every metric, such as to tell apart the pools of a ProxySet sharing a registry.
+// Buckets sets the histogram buckets of named observations, taking precedence over DefaultBuckets.
+type Options struct {
+	Namespace   string
+	ConstLabels prometheus.Labels
+	Buckets     map[string][]float64
+}
+
+// Prometheus is a twunproxy.Metrics sink registering a collector for each metric as it is first recorded.
+// Counters are exported with a "_total" suffix, gauges as they are and observations as histograms.
+// Every metric has a "server" label holding the address of the instance, which is empty for pool-wide values.
+// Among them are the command latency of each instance, discovery fan-out sizes, the mapping hit ratio,
+// command errors by instance and, with a health monitor, whether each instance is healthy.
+type Prometheus struct {
+	reg  prometheus.Registerer
+	opts Options
+
+	mu         sync.Mutex
+	counters   map[string]*prometheus.CounterVec
+	gauges     map[string]*prometheus.GaugeVec
+	histograms map[string]*prometheus.HistogramVec
+}
+
+// NewPrometheus returns a sink registering its collectors with the input registerer,
+// such as prometheus.DefaultRegisterer.
+func NewPrometheus(reg prometheus.Registerer, opts Options) *Prometheus {
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultNamespace
+	}
+	return &Prometheus{
+		reg:        reg,
+		opts:       opts,
+		counters:   make(map[string]*prometheus.CounterVec),
+		gauges:     make(map[string]*prometheus.GaugeVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+	}
+}
+
+// WithPrometheus returns an option for NewProxyConn that exports the proxy's metrics with the input registerer.
+func WithPrometheus(reg prometheus.Registerer, opts Options) twunproxy.Option {
+	return twunproxy.WithMetrics(NewPrometheus(reg, opts))
+}
+
+// Counter adds the delta to the named counter of the instance. Negative deltas are ignored,
+// since Prometheus counters only increase.
+func (p *Prometheus) Counter(name, instance string, delta float64) {
+	if delta < 0 {
+		return
+	}
+
+	p.mu.Lock()
+	vec, ok := p.counters[name]
+	if !ok {
+		full := name
+		if !strings.HasSuffix(full, "_total") {
+			full += "_total"
+		}
+		vec = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   p.opts.Namespace,
+			Name:        full,
+			Help:        help(name),
+			ConstLabels: p.opts.ConstLabels,
+		}, []string{"server"})
+		if existing, ok := p.register(vec).(*prometheus.CounterVec); ok {
+			vec = existing
+		}
+		p.counters[name] = vec
+	}
+	p.mu.Unlock()
+
+	vec.WithLabelValues(instance).Add(delta)
+}
+
+// Gauge sets the named gauge of the instance.
+func (p *Prometheus) Gauge(name, instance string, value float64) {
+	p.mu.Lock()
+	vec, ok := p.gauges[name]
+	if !ok {
+		vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   p.opts.Namespace,
+			Name:        name,
+			Help:        help(name),
+			ConstLabels: p.opts.ConstLabels,
+		}, []string{"server"})
+		if existing, ok := p.register(vec).(*prometheus.GaugeVec); ok {
+			vec = existing
+		}
+		p.gauges[name] = vec
+	}
+	p.mu.Unlock()
+
+	vec.WithLabelValues(instance).Set(value)
+}
+
+// Observe records the value in the histogram of the named observation of the instance.
+func (p *Prometheus) Observe(name, instance string, value float64) {
+	p.mu.Lock()
+	vec, ok := p.histograms[name]
+	if !ok {
+		buckets, ok := p.opts.Buckets[name]
+		if !ok {
+			buckets = DefaultBuckets[name]
+		}
+		vec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   p.opts.Namespace,
+			Name:        name,
+			Help:        help(name),
+			ConstLabels: p.opts.ConstLabels,
+			Buckets:     buckets,
+		}, []string{"server"})
+		if existing, ok := p.register(vec).(*prometheus.HistogramVec); ok {
+			vec = existing
+		}
+		p.histograms[name] = vec
+	}
+	p.mu.Unlock()
+
+	vec.WithLabelValues(instance).Observe(value)
+}
+
+// Registers the input collector, returning the collector already registered in its place if there is one.
+// A collector that cannot be registered is still returned, so that recording to it is harmless.
+func (p *Prometheus) register(c prometheus.Collector) prometheus.Collector {
+	if err := p.reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+	}
+	return c
+}
+
+// Returns the help text of the named metric.
+func help(name string) string {
+	return "The twunproxy metric " + name + "."
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+)
+
+func TestPrometheusExportsByServer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p := NewPrometheus(reg, Options{})
+
+	p.Counter("command_errors", "a:6379", 2)
+	p.Counter("command_errors", "a:6379", 1)
+	p.Counter("command_errors", "b:6379", -1)
+	p.Gauge("instance_healthy", "b:6379", 0)
+	p.Observe("discovery_fanout", "", 3)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, mf := range families {
+		found[mf.GetName()] = true
+		m := mf.GetMetric()
+		switch mf.GetName() {
+		case "twunproxy_command_errors_total":
+			if len(m) != 1 || m[0].GetLabel()[0].GetValue() != "a:6379" || m[0].GetCounter().GetValue() != 3 {
+				t.Fatalf("Unexpected counter: %v", m)
+			}
+		case "twunproxy_instance_healthy":
+			if len(m) != 1 || m[0].GetGauge().GetValue() != 0 {
+				t.Fatalf("Unexpected gauge: %v", m)
+			}
+		case "twunproxy_discovery_fanout":
+			if h := m[0].GetHistogram(); h.GetSampleCount() != 1 || len(h.GetBucket()) != 16 {
+				t.Fatalf("Unexpected histogram: %v", h)
+			}
+		}
+	}
+	if len(found) != 3 {
+		t.Fatalf("Unexpected families: %v", found)
+	}
+}
+
+func TestPrometheusSharesRegisteredCollectors(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	a, b := NewPrometheus(reg, Options{}), NewPrometheus(reg, Options{})
+
+	a.Counter("commands", "a:6379", 1)
+	b.Counter("commands", "a:6379", 1)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(families) != 1 || families[0].GetMetric()[0].GetCounter().GetValue() != 2 {
+		t.Fatalf("Expected one shared counter, got %v", families)
+	}
+}
@@ -0,0 +1,58 @@
+package twunproxy
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestGaugeWithoutMetricsSinkIsNoOp(t *testing.T) {
+	getMockProxy().gauge("name", "instance", 1)
+}
+
+func TestGaugeRecordsToMetricsSink(t *testing.T) {
+	m := newFakeMetrics()
+	proxy := getMockProxy()
+	WithMetrics(m)(proxy)
+
+	proxy.gauge("name", "10.0.0.1:6379", 2)
+
+	if v := m.get("name", "10.0.0.1:6379"); v != 2 {
+		t.Fatalf("Unexpected gauge value: %v", v)
+	}
+}
+
+/******************************************************
+ * Helpers
+ ******************************************************/
+
+// FakeMetrics records the latest value for each metric name and instance.
+type fakeMetrics struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{values: make(map[string]float64)}
+}
+
+func (m *fakeMetrics) Counter(name, instance string, delta float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[name+"|"+instance] += delta
+}
+
+func (m *fakeMetrics) Gauge(name, instance string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[name+"|"+instance] = value
+}
+
+func (m *fakeMetrics) Observe(name, instance string, value float64) {
+	m.Gauge(name, instance, value)
+}
+
+func (m *fakeMetrics) get(name, instance string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[name+"|"+instance]
+}
@@ -0,0 +1,54 @@
+package twunproxy
+
+import (
+	"context"
+)
+
+// Command describes a command being sent to an instance, as seen by middleware.
+// Args are the arguments after the command name, including the key. Server is the address of the instance
+// the command is sent to, and Probe is set for the commands of a discovery fan-out.
+type Command struct {
+	Name   string
+	Key    string
+	Args   []interface{}
+	Server string
+	Probe  bool
+}
+
+// Handler sends a command to its instance and returns the reply.
+type Handler func(ctx context.Context, c *Command) (interface{}, error)
+
+// Use adds middleware wrapping each command sent to an instance by Do and the helpers routing single keys,
+// whether to a mapped instance, a replica or as a discovery probe, and by DoAll. Middleware added first is outermost.
+// Middleware sees the reply and error of the command, and may return its own in place of calling next,
+// such as to inject failures in tests, or call next again, such as after refreshing credentials.
+// Changes to the Command are not sent to the instance. Middleware must be safe for concurrent use.
+func (r *ProxyConn) Use(mw func(next Handler) Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, mw)
+}
+
+// Runs the input command with exec through the middleware chain, as sent to the input server.
+func (r *ProxyConn) intercept(
+	ctx context.Context,
+	server string,
+	probe bool,
+	cmd *RedisCmd,
+	exec func() (interface{}, error)) (interface{}, error) {
+
+	r.mu.Lock()
+	mw := r.middleware
+	r.mu.Unlock()
+	if len(mw) == 0 {
+		return exec()
+	}
+
+	h := Handler(func(context.Context, *Command) (interface{}, error) {
+		return exec()
+	})
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h(ctx, &Command{Name: cmd.name, Key: cmd.key, Args: cmd.getArgs(), Server: server, Probe: probe})
+}
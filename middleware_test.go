@@ -0,0 +1,121 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareSeesProbesAndMappedCommands(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: []byte("v")}}, connPool{&nilStyleConn{}})
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+
+	var mu sync.Mutex
+	var order []string
+	seen := make(map[string]interface{})
+	var mapped *Command
+	proxy.Use(func(next Handler) Handler {
+		return func(ctx context.Context, c *Command) (interface{}, error) {
+			mu.Lock()
+			order = append(order, "outer")
+			mu.Unlock()
+			return next(ctx, c)
+		}
+	})
+	proxy.Use(func(next Handler) Handler {
+		return func(ctx context.Context, c *Command) (interface{}, error) {
+			v, err := next(ctx, c)
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, "inner")
+			if c.Probe {
+				seen[c.Server] = v
+			} else {
+				mapped = c
+			}
+			return v, err
+		}
+	})
+
+	if _, err := proxy.Do(NewRedisCmd("GET", "key"), KeyFound); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := proxy.Do(NewRedisCmd("GET", "key"), KeyFound); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The probe of the rejecting instance may complete after the command.
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(order)
+		mu.Unlock()
+		if n == 6 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 2 || string(seen["a:6379"].([]byte)) != "v" || seen["b:6379"] != nil {
+		t.Fatalf("Unexpected probe replies: %v", seen)
+	}
+	if mapped == nil || mapped.Name != "GET" || mapped.Key != "key" || mapped.Server != "a:6379" ||
+		len(mapped.Args) != 1 || mapped.Args[0] != "key" {
+		t.Fatalf("Unexpected mapped command: %+v", mapped)
+	}
+	if len(order) != 6 || order[0] != "outer" || order[5] != "inner" {
+		t.Fatalf("Unexpected middleware order: %v", order)
+	}
+}
+
+func TestMiddlewareCanReplaceReplies(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: []byte("v")}})
+	proxy.KeyInstance["key"] = proxy.Pools[0]
+
+	injected := errors.New("Injected failure.")
+	proxy.Use(func(next Handler) Handler {
+		return func(ctx context.Context, c *Command) (interface{}, error) {
+			return nil, injected
+		}
+	})
+
+	if _, err := proxy.Do(NewRedisCmd("GET", "key"), KeyFound); err != injected {
+		t.Fatalf("Expected injected error, got %v", err)
+	}
+	res, _ := proxy.DoAll(NewCommand("PING"))
+	if res[0].Err != injected {
+		t.Fatalf("Expected injected error for broadcast, got %v", res[0].Err)
+	}
+}
+
+func TestMiddlewareSeesProbesOfDuplicateDiscovery(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: []byte("v")}}, connPool{&nilStyleConn{}})
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	WithDuplicatePolicy(PreferFirstResponder, nil)(proxy)
+
+	var mu sync.Mutex
+	probes := make(map[string]bool)
+	proxy.Use(func(next Handler) Handler {
+		return func(ctx context.Context, c *Command) (interface{}, error) {
+			mu.Lock()
+			probes[c.Server] = c.Probe
+			mu.Unlock()
+			return next(ctx, c)
+		}
+	})
+
+	if _, err := proxy.Do(NewRedisCmd("GET", "key"), KeyFound); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Discovery waits for every instance, so both probes have been seen.
+	mu.Lock()
+	defer mu.Unlock()
+	if len(probes) != 2 || !probes["a:6379"] || !probes["b:6379"] {
+		t.Fatalf("Expected middleware to see a probe of each instance, got %v", probes)
+	}
+}
@@ -0,0 +1,287 @@
+package twunproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/******************************************************
+ * Resharding a pool from an old to a new Twemproxy configuration.
+ * Keys are copied from the instance the old configuration places them on to the one the new configuration does.
+ ******************************************************/
+
+// Returned when either configuration of a Migrator cannot place keys.
+var errMigratorPlacement = errors.New("Both configurations must place keys with a supported hash and distribution.")
+
+// Migrator copies keys between the instances of two configurations of a pool, such as before servers are added,
+// and can write to both during the cut-over, verifying that they agree.
+// Both configurations must use a ketama or modula distribution with a supported hash, so that keys can be placed.
+// Servers with the same address and auth in both configurations share a connection pool.
+type Migrator struct {
+	old, new   *ProxyConn
+	onMismatch func(Mismatch)
+}
+
+// MigratorOption configures a Migrator.
+type MigratorOption func(m *Migrator)
+
+// WithMismatchHandler sets a function called for each write by DualWrite on which the old and new owners disagree.
+func WithMismatchHandler(fn func(Mismatch)) MigratorOption {
+	return func(m *Migrator) {
+		m.onMismatch = fn
+	}
+}
+
+// MigratedKey records the copy of one key by Migrate, from the server holding it to its owner in the new
+// configuration. Existed indicates that the key was already on the new owner, such as from DualWrite, and was
+// left in place. Err is the error from a failed copy.
+type MigratedKey struct {
+	Key     string `json:"key"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Copied  bool   `json:"copied"`
+	Existed bool   `json:"existed"`
+	Err     error  `json:"-"`
+}
+
+// MigrateOptions control Migrate.
+// If Replace is set, keys already on their new owner are replaced rather than left in place.
+// If DeleteSource is set, each key is deleted from its old instance once copied.
+type MigrateOptions struct {
+	Replace      bool
+	DeleteSource bool
+}
+
+// Mismatch is a disagreement between the old and new owners of a key, found by DualWrite or Verify.
+// For DualWrite, Command is the command written, with the replies and errors of each owner.
+// For Verify, Command is DUMP, and a nil reply means the key was missing there.
+type Mismatch struct {
+	Key     string      `json:"key"`
+	Command string      `json:"command"`
+	From    string      `json:"from"`
+	To      string      `json:"to"`
+	Old     interface{} `json:"-"`
+	New     interface{} `json:"-"`
+	OldErr  error       `json:"-"`
+	NewErr  error       `json:"-"`
+}
+
+// NewMigrator creates a Migrator for the named pool from the old and new Twemproxy configuration files.
+func NewMigrator(oldPath, newPath, poolName string, create CreatePool, opts ...MigratorOption) (*Migrator, error) {
+	oldConf, err := readPoolConfig(oldPath, poolName)
+	if err != nil {
+		return nil, err
+	}
+	newConf, err := readPoolConfig(newPath, poolName)
+	if err != nil {
+		return nil, err
+	}
+	return NewMigratorFromConfig(oldConf, newConf, create, opts...)
+}
+
+// NewMigratorFromConfig creates a Migrator as for NewMigrator from already parsed or constructed configurations.
+func NewMigratorFromConfig(oldConf, newConf PoolConfig, create CreatePool, opts ...MigratorOption) (*Migrator, error) {
+	create = sharedPools(create)
+
+	old, err := NewProxyConnFromConfig(oldConf, 0, create)
+	if err != nil {
+		return nil, err
+	}
+	next, err := NewProxyConnFromConfig(newConf, 0, create)
+	if err != nil {
+		old.Close()
+		return nil, err
+	}
+	old.poolsShared, next.poolsShared = true, true
+
+	m := &Migrator{old: old, new: next}
+	if old.topology().ring == nil || next.topology().ring == nil {
+		m.Close()
+		return nil, errMigratorPlacement
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m, nil
+}
+
+// Old returns the proxy for the old configuration.
+func (m *Migrator) Old() *ProxyConn {
+	return m.old
+}
+
+// New returns the proxy for the new configuration.
+func (m *Migrator) New() *ProxyConn {
+	return m.new
+}
+
+// Close closes both proxies, then each of the pools they share, returning the first error.
+func (m *Migrator) Close() error {
+	pools := append(append([]ConnGetter(nil), m.old.topology().pools...), m.new.topology().pools...)
+	m.old.Close()
+	m.new.Close()
+	return closePools(pools)
+}
+
+// Migrate scans every instance of the old configuration concurrently for keys matching the input pattern,
+// and copies each key that the new configuration places on another instance there with DUMP and RESTORE,
+// preserving its TTL. The keys copied, or that failed to copy, are returned ordered by key and server.
+// Keys that stay where they are are not reported. Copy failures do not stop the scan.
+// The error is that of a failed scan, or of the context if it ends first.
+func (m *Migrator) Migrate(ctx context.Context, pattern string, opts MigrateOptions) ([]MigratedKey, error) {
+	oldT, newT := m.old.topology(), m.new.topology()
+
+	var mu sync.Mutex
+	var moved []MigratedKey
+	errs := oldT.forEach(func(i int, c Conn) error {
+		return scanKeys(c, pattern, scanCount, func(keys []string) error {
+			for _, k := range keys {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				owner, _ := newT.ring.owner(k)
+				if newT.pools[owner] == oldT.pools[i] {
+					continue
+				}
+
+				mk := MigratedKey{Key: k, From: oldT.server(i), To: newT.server(owner)}
+				mk.Err = m.copy(c, newT.pools[owner], k, opts)
+				mk.Existed = mk.Err != nil && strings.HasPrefix(mk.Err.Error(), "BUSYKEY")
+				if mk.Existed {
+					mk.Err = nil
+				}
+				mk.Copied = mk.Err == nil && !mk.Existed
+
+				mu.Lock()
+				moved = append(moved, mk)
+				mu.Unlock()
+			}
+			return nil
+		})
+	})
+
+	if err := ctx.Err(); err != nil {
+		return moved, err
+	}
+	if err := firstError(errs); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(moved, func(a, b int) bool {
+		if moved[a].Key != moved[b].Key {
+			return moved[a].Key < moved[b].Key
+		}
+		return moved[a].From < moved[b].From
+	})
+	return moved, nil
+}
+
+// Copies the key from the source connection to the destination pool, deleting it from the source if required.
+func (m *Migrator) copy(src Conn, dst ConnGetter, key string, opts MigrateOptions) error {
+	c := dst.Get()
+	defer c.Close()
+
+	if err := copyKey(src, c, key, opts.Replace); err != nil {
+		return err
+	}
+	if opts.DeleteSource {
+		_, err := src.Do("DEL", key)
+		return err
+	}
+	return nil
+}
+
+// DualWrite runs the named write with the input key as its first argument on the instance that the old
+// configuration places the key on and, if different, on the one the new configuration does, and returns the
+// reply of the old owner. If the replies or errors of the two differ, the mismatch is passed to the handler
+// and counted as "migration_mismatches".
+func (m *Migrator) DualWrite(ctx context.Context, name, key string, args ...interface{}) (interface{}, error) {
+	oldT, newT := m.old.topology(), m.new.topology()
+	oldOwner, _ := oldT.ring.owner(key)
+	newOwner, _ := newT.ring.owner(key)
+
+	cmd := NewRedisCmd(name, key, args...)
+	v, err := m.runOn(ctx, oldT.pools[oldOwner], cmd)
+	if newT.pools[newOwner] == oldT.pools[oldOwner] {
+		return v, err
+	}
+
+	nv, nerr := m.runOn(ctx, newT.pools[newOwner], cmd)
+	if !reflect.DeepEqual(v, nv) || errString(err) != errString(nerr) {
+		m.mismatch(Mismatch{
+			Key: key, Command: name, From: oldT.server(oldOwner), To: newT.server(newOwner),
+			Old: v, New: nv, OldErr: err, NewErr: nerr,
+		})
+	}
+	return v, err
+}
+
+// Verify compares the DUMP of each key matching the input pattern on the instance that the old configuration
+// places it on with that on its owner in the new configuration, and returns the keys that differ,
+// ordered by key. Keys that the new configuration leaves in place are not compared.
+func (m *Migrator) Verify(ctx context.Context, pattern string) ([]Mismatch, error) {
+	oldT, newT := m.old.topology(), m.new.topology()
+
+	var mu sync.Mutex
+	var found []Mismatch
+	errs := oldT.forEach(func(i int, c Conn) error {
+		return scanKeys(c, pattern, scanCount, func(keys []string) error {
+			for _, k := range keys {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				owner, _ := newT.ring.owner(k)
+				if newT.pools[owner] == oldT.pools[i] {
+					continue
+				}
+
+				v, err := c.Do("DUMP", k)
+				nv, nerr := m.runOn(ctx, newT.pools[owner], NewRedisCmd("DUMP", k))
+				if err == nil && nerr == nil && bytes.Equal(replyBytes(v), replyBytes(nv)) && (v == nil) == (nv == nil) {
+					continue
+				}
+
+				mu.Lock()
+				found = append(found, Mismatch{
+					Key: k, Command: "DUMP", From: oldT.server(i), To: newT.server(owner),
+					Old: v, New: nv, OldErr: err, NewErr: nerr,
+				})
+				mu.Unlock()
+			}
+			return nil
+		})
+	})
+
+	if err := ctx.Err(); err != nil {
+		return found, err
+	}
+	if err := firstError(errs); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(found, func(a, b int) bool { return found[a].Key < found[b].Key })
+	return found, nil
+}
+
+// Runs the input command on a connection from the pool, returning early if the context ends.
+func (m *Migrator) runOn(ctx context.Context, pool ConnGetter, cmd *RedisCmd) (interface{}, error) {
+	c := pool.Get()
+	defer c.Close()
+	return m.old.runContext(ctx, c, cmd)
+}
+
+// Counts the mismatch and passes it to the handler, if there is one.
+func (m *Migrator) mismatch(mm Mismatch) {
+	m.old.counter("migration_mismatches", mm.From, 1)
+	if m.onMismatch != nil {
+		m.onMismatch(mm)
+	}
+}
@@ -0,0 +1,65 @@
+package twunproxy
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestMigratorCopiesKeysToNewOwnerAndDualWrites(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConnA, mockPoolA := setupMockPool(ctrl)
+	mockConnB, mockPoolB := setupMockPool(ctrl)
+	mockConnA.EXPECT().Do("PING").Return("PONG", nil).AnyTimes()
+	mockConnB.EXPECT().Do("PING").Return("PONG", nil).AnyTimes()
+	mockConnA.EXPECT().Close().AnyTimes()
+	mockConnB.EXPECT().Close().AnyTimes()
+
+	pools := map[string]ConnGetter{"a:6379": mockPoolA, "b:6379": mockPoolB}
+	create := func(desc, auth string) ConnGetter { return pools[ServerAddr(desc)] }
+
+	oldConf := PoolConfig{Servers: []string{"a:6379:1"}, Hash: "fnv1a_32", Distribution: "modula"}
+	newConf := PoolConfig{Servers: []string{"a:6379:1", "b:6379:1"}, Hash: "fnv1a_32", Distribution: "modula"}
+
+	var mismatches []Mismatch
+	m, err := NewMigratorFromConfig(oldConf, newConf, create, WithMismatchHandler(func(mm Mismatch) {
+		mismatches = append(mismatches, mm)
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Find a key that moves to b and one that stays on a.
+	ring := m.New().topology().ring
+	moves, stays := "", ""
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8"} {
+		if i, _ := ring.owner(k); i == 1 && moves == "" {
+			moves = k
+		} else if i == 0 && stays == "" {
+			stays = k
+		}
+	}
+
+	scan := []interface{}{[]byte("0"), []interface{}{[]byte(moves), []byte(stays)}}
+	mockConnA.EXPECT().Do("SCAN", "0", "MATCH", "k*", "COUNT", scanCount).Return(scan, nil)
+	mockConnA.EXPECT().Do("DUMP", moves).Return([]byte("payload"), nil)
+	mockConnA.EXPECT().Do("PTTL", moves).Return(int64(5000), nil)
+	mockConnB.EXPECT().Do("RESTORE", moves, int64(5000), []byte("payload")).Return("OK", nil)
+
+	moved, err := m.Migrate(context.Background(), "k*", MigrateOptions{})
+	if err != nil || len(moved) != 1 || moved[0].Key != moves || moved[0].From != "a:6379" || moved[0].To != "b:6379" ||
+		!moved[0].Copied {
+		t.Fatalf("Unexpected result: %+v, %v", moved, err)
+	}
+
+	mockConnA.EXPECT().Do("INCR", moves).Return(int64(2), nil)
+	mockConnB.EXPECT().Do("INCR", moves).Return(int64(1), nil)
+	if v, err := m.DualWrite(context.Background(), "INCR", moves); err != nil || v != int64(2) {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+	if len(mismatches) != 1 || mismatches[0].Old != int64(2) || mismatches[0].New != int64(1) {
+		t.Fatalf("Expected one mismatch, got %+v", mismatches)
+	}
+}
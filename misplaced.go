@@ -0,0 +1,92 @@
+package twunproxy
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Misplaced describes a key found by FindMisplaced on an instance other than its owner.
+// Owner is the instance that the configured hash and distribution place the key on.
+// Moved indicates that the key was migrated to its owner. Err is the error from a failed migration,
+// encoded in JSON reports as the "error" string by MarshalJSON.
+type Misplaced struct {
+	Key    string `json:"key"`
+	Server string `json:"server"`
+	Owner  string `json:"owner"`
+	Moved  bool   `json:"moved"`
+	Err    error  `json:"-"`
+}
+
+// FindMisplaced scans every instance concurrently for keys matching the input pattern that are held by an
+// instance other than the one the configured hash and distribution place them on, ordered by key and server.
+// Such orphans are left behind by topology changes, and are unreachable through Twemproxy.
+// If migrate is set, each misplaced key is moved to its owner with DUMP and RESTORE and its mapping is updated.
+// A key that its owner already holds is not migrated, since the owner's copy is the live one that Twemproxy serves;
+// the orphan is left in place and reported with an error. Migration failures are recorded against the key and do not stop the sweep.
+// Placement requires the pool to use a ketama or modula distribution with a supported hash function.
+func (r *ProxyConn) FindMisplaced(pattern string, migrate bool) ([]Misplaced, error) {
+	t := r.topology()
+	if t.ring == nil {
+		return nil, errors.New("Key placement is unavailable for the pool configuration.")
+	}
+
+	var mu sync.Mutex
+	var found []Misplaced
+	errs := t.forEach(func(i int, c Conn) error {
+		return scanKeys(c, pattern, scanCount, func(keys []string) error {
+			for _, k := range keys {
+				owner, ok := t.ring.owner(k)
+				if !ok || owner == i {
+					continue
+				}
+
+				m := Misplaced{Key: k, Server: t.server(i), Owner: t.server(owner)}
+				if migrate {
+					m.Err = r.migrate(t, k, c, owner)
+					m.Moved = m.Err == nil
+				}
+
+				mu.Lock()
+				found = append(found, m)
+				mu.Unlock()
+			}
+			return nil
+		})
+	})
+
+	if err := firstError(errs); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(found, func(a, b int) bool {
+		if found[a].Key != found[b].Key {
+			return found[a].Key < found[b].Key
+		}
+		return found[a].Server < found[b].Server
+	})
+	return found, nil
+}
+
+// Moves the input key from the source connection to the pool at the owner index and maps it there.
+func (r *ProxyConn) migrate(t *topology, key string, src Conn, owner int) error {
+	dst := t.pools[owner].Get()
+	defer dst.Close()
+
+	v, err := dst.Do("EXISTS", key)
+	if err != nil {
+		return err
+	}
+	if n, _ := replyInt(v); n > 0 {
+		return errOwnerHoldsKey
+	}
+
+	if err := moveKey(src, dst, key); err != nil {
+		return err
+	}
+
+	if _, ok := r.lookup(key); ok {
+		r.mapKey(key, t.pools[owner])
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestFindMisplacedMigratesKeysToOwner(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.ring, _ = newHashRing(proxy.Servers, "fnv1a_32", "modula", "")
+
+	// Find a key owned by the second instance.
+	key := ""
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8"} {
+		if i, _ := proxy.ring.owner(k); i == 1 {
+			key = k
+			break
+		}
+	}
+	proxy.KeyInstance[key] = mockPool1
+
+	scan := []interface{}{[]byte("0"), []interface{}{[]byte(key)}}
+	empty := []interface{}{[]byte("0"), []interface{}{}}
+
+	mockConn1.EXPECT().Do("SCAN", "0", "MATCH", "k*", "COUNT", scanCount).Return(scan, nil)
+	mockConn1.EXPECT().Do("DUMP", key).Return([]byte("payload"), nil)
+	mockConn1.EXPECT().Do("PTTL", key).Return(int64(-1), nil)
+	mockConn1.EXPECT().Do("DEL", key).Return(int64(1), nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("SCAN", "0", "MATCH", "k*", "COUNT", scanCount).Return(empty, nil)
+	mockConn2.EXPECT().Do("EXISTS", key).Return(int64(0), nil)
+	mockConn2.EXPECT().Do("RESTORE", key, int64(0), []byte("payload")).Return("OK", nil)
+	mockConn2.EXPECT().Close().Times(2)
+
+	found, err := proxy.FindMisplaced("k*", true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(found) != 1 || found[0].Server != "a:6379" || found[0].Owner != "b:6379" || !found[0].Moved {
+		t.Fatalf("Unexpected result: %+v", found)
+	}
+
+	if proxy.KeyInstance[key] != mockPool2 {
+		t.Fatal("Expected migrated key to be remapped.")
+	}
+}
+
+func TestMoveKeyFailsForMissingKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	src, _ := setupMockPool(ctrl)
+	dst, _ := setupMockPool(ctrl)
+	src.EXPECT().Do("DUMP", "KEY").Return(nil, nil)
+
+	if err := moveKey(src, dst, "KEY"); err != errKeyNotFound {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestFindMisplacedKeepsOwnerCopy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.ring, _ = newHashRing(proxy.Servers, "fnv1a_32", "modula", "")
+
+	key := ""
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8"} {
+		if i, _ := proxy.ring.owner(k); i == 1 {
+			key = k
+			break
+		}
+	}
+
+	scan := []interface{}{[]byte("0"), []interface{}{[]byte(key)}}
+	empty := []interface{}{[]byte("0"), []interface{}{}}
+
+	mockConn1.EXPECT().Do("SCAN", "0", "MATCH", "k*", "COUNT", scanCount).Return(scan, nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("SCAN", "0", "MATCH", "k*", "COUNT", scanCount).Return(empty, nil)
+	mockConn2.EXPECT().Do("EXISTS", key).Return(int64(1), nil)
+	mockConn2.EXPECT().Close().Times(2)
+
+	found, err := proxy.FindMisplaced("k*", true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(found) != 1 || found[0].Moved || found[0].Err != errOwnerHoldsKey {
+		t.Fatalf("Expected the orphan to be reported and kept, got %+v", found)
+	}
+}
+
+func TestMoveKeyFailsForKeyExpiredAfterDump(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	src, _ := setupMockPool(ctrl)
+	dst, _ := setupMockPool(ctrl)
+	src.EXPECT().Do("DUMP", "KEY").Return([]byte("payload"), nil)
+	src.EXPECT().Do("PTTL", "KEY").Return(int64(-2), nil)
+
+	if err := moveKey(src, dst, "KEY"); err != errKeyNotFound {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
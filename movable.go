@@ -0,0 +1,126 @@
+package twunproxy
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parsers returning the key positions of commands whose keys cannot be located from COMMAND's first, last and step.
+// Arguments exclude the command name. Keyed by lower-case command name.
+var movableKeyParsers = map[string]func(args []interface{}) []int{
+	"eval":              numKeysAt(1, false),
+	"evalsha":           numKeysAt(1, false),
+	"eval_ro":           numKeysAt(1, false),
+	"evalsha_ro":        numKeysAt(1, false),
+	"fcall":             numKeysAt(1, false),
+	"fcall_ro":          numKeysAt(1, false),
+	"zunionstore":       numKeysAt(1, true),
+	"zinterstore":       numKeysAt(1, true),
+	"zdiffstore":        numKeysAt(1, true),
+	"zunion":            numKeysAt(0, false),
+	"zinter":            numKeysAt(0, false),
+	"zdiff":             numKeysAt(0, false),
+	"zintercard":        numKeysAt(0, false),
+	"sintercard":        numKeysAt(0, false),
+	"lmpop":             numKeysAt(0, false),
+	"zmpop":             numKeysAt(0, false),
+	"blmpop":            numKeysAt(1, false),
+	"bzmpop":            numKeysAt(1, false),
+	"georadius":         keyThenStore(1),
+	"georadiusbymember": keyThenStore(1),
+	"sort":              keyThenStore(1),
+	"sort_ro":           keyThenStore(1),
+	"xread":             streamKeys,
+	"xreadgroup":        streamKeys,
+}
+
+// Returns the key positions of a command with movable keys, or nil if they cannot be determined.
+func movableKeyPositions(name string, args []interface{}) []int {
+	if f, ok := movableKeyParsers[strings.ToLower(name)]; ok {
+		return f(args)
+	}
+	return nil
+}
+
+// Returns a parser for commands with a numkeys argument at the input index, followed by that many keys.
+// If dest is set, the first argument is also a key, as for the destination of ZUNIONSTORE.
+func numKeysAt(idx int, dest bool) func([]interface{}) []int {
+	return func(args []interface{}) []int {
+		if idx >= len(args) {
+			return nil
+		}
+
+		n, ok := argInt(args[idx])
+		if !ok || n < 0 || idx+1+n > len(args) {
+			return nil
+		}
+
+		pos := make([]int, 0, n+1)
+		if dest {
+			pos = append(pos, 0)
+		}
+		for i := 0; i < n; i++ {
+			pos = append(pos, idx+1+i)
+		}
+		return pos
+	}
+}
+
+// Returns a parser for commands with a key as their first argument and optional STORE or STOREDIST destinations.
+// Arguments before the input index are not searched for options.
+func keyThenStore(from int) func([]interface{}) []int {
+	return func(args []interface{}) []int {
+		if len(args) == 0 {
+			return nil
+		}
+
+		pos := []int{0}
+		for i := from; i < len(args)-1; i++ {
+			s, _ := keyString(args[i])
+			if strings.EqualFold(s, "STORE") || strings.EqualFold(s, "STOREDIST") {
+				pos = append(pos, i+1)
+				i++
+			}
+		}
+		return pos
+	}
+}
+
+// Converts a numeric argument, given either as an integer or as its string form.
+func argInt(v interface{}) (int, bool) {
+	switch t := v.(type) {
+	case int:
+		return t, true
+	case int64:
+		return int(t), true
+	}
+
+	s, ok := keyString(v)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+// Parses XREAD and XREADGROUP, whose keys are the first half of the arguments following STREAMS.
+func streamKeys(args []interface{}) []int {
+	for i, a := range args {
+		s, _ := keyString(a)
+		if !strings.EqualFold(s, "STREAMS") {
+			continue
+		}
+
+		rest := len(args) - i - 1
+		if rest == 0 || rest%2 != 0 {
+			return nil
+		}
+
+		pos := make([]int, rest/2)
+		for j := range pos {
+			pos[j] = i + 1 + j
+		}
+		return pos
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"reflect"
+	"testing"
+)
+
+func TestMovableKeyPositions(t *testing.T) {
+	cases := []struct {
+		name string
+		args []interface{}
+		want []int
+	}{
+		{"EVAL", []interface{}{"return 1", 2, "k1", "k2", "arg"}, []int{2, 3}},
+		{"ZUNIONSTORE", []interface{}{"dst", "2", "k1", "k2", "WEIGHTS", 1, 2}, []int{0, 2, 3}},
+		{"GEORADIUS", []interface{}{"src", 1.0, 2.0, 5, "km", "STORE", "dst"}, []int{0, 6}},
+		{"XREAD", []interface{}{"COUNT", 10, "STREAMS", "s1", "s2", "0", "0"}, []int{3, 4}},
+		{"EVAL", []interface{}{"return 1", 3, "k1"}, nil},
+		{"UNKNOWN", []interface{}{"k1"}, nil},
+	}
+
+	for _, c := range cases {
+		if got := movableKeyPositions(c.name, c.args); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s %v: got %v, expected %v", c.name, c.args, got, c.want)
+		}
+	}
+}
+
+func TestNewRedisCmdAtRestoresArgumentOrder(t *testing.T) {
+	cmd, err := NewRedisCmdAt("EVAL", 2, "return 1", 1, "KEY", "arg")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cmd.key != "KEY" || !reflect.DeepEqual(cmd.getArgs(), []interface{}{"return 1", 1, "KEY", "arg"}) {
+		t.Fatalf("Unexpected command: %+v", cmd)
+	}
+
+	if _, err := NewRedisCmdAt("GET", 1, "KEY"); err == nil {
+		t.Fatal("Expected error for out of range key position.")
+	}
+}
+
+func TestDoKeyedRoutesEvalByKeyArgument(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("EXISTS", "KEY").Return(int64(1), nil)
+	mockConn.EXPECT().Do("EVAL", "return 1", 1, "KEY").Return(int64(1), nil)
+	mockConn.EXPECT().Close().Times(2)
+
+	proxy := getMockProxy(mockPool)
+
+	if v, err := proxy.DoKeyed("EVAL", "return 1", 1, "KEY"); err != nil || v != int64(1) {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+}
@@ -0,0 +1,97 @@
+package twunproxy
+
+import (
+	"errors"
+)
+
+// Returned when a key to be moved does not exist on its source instance.
+var errKeyNotFound = errors.New("Key does not exist on the source instance.")
+
+// Returned when a misplaced key is not migrated because its owner already holds the key.
+var errOwnerHoldsKey = errors.New("Owner already holds the key; the misplaced copy was left in place.")
+
+// Copies the input key from the source connection to the destination with DUMP and RESTORE,
+// preserving its remaining TTL, then deletes it from the source. An existing key on the destination is left in place,
+// with RESTORE failing with a BUSYKEY error, and the source is kept.
+func moveKey(src, dst Conn, key string) error {
+	if err := copyKey(src, dst, key, false); err != nil {
+		return err
+	}
+
+	_, err := src.Do("DEL", key)
+	return err
+}
+
+// MoveKey moves the input key from the instance holding it to the instance with the input address, such as to
+// rebalance a hot key. The key is copied with DUMP and RESTORE, preserving its remaining TTL, then mapped to the
+// target before it is deleted from its source, so that commands from this client never find it missing.
+// An existing key on the target is left in place and the move fails with a BUSYKEY error.
+// Other clients still mapping the key to its source rediscover it once it is deleted there.
+func (r *ProxyConn) MoveKey(key, target string) error {
+	t := r.topology()
+	dst, err := t.index(target)
+	if err != nil {
+		return err
+	}
+
+	pool, ok, err := r.locate(key)
+	if err != nil {
+		return err
+	}
+	src := t.indexOf(pool)
+	if !ok || src < 0 {
+		return errKeyNotFound
+	}
+	if src == dst {
+		r.mapKey(key, t.pools[dst])
+		return nil
+	}
+
+	sc := t.pools[src].Get()
+	defer sc.Close()
+	dc := t.pools[dst].Get()
+	defer dc.Close()
+
+	if err := copyKey(sc, dc, key, false); err != nil {
+		return err
+	}
+	r.mapKey(key, t.pools[dst])
+	r.counter("keys_moved", target, 1)
+
+	_, err = sc.Do("DEL", key)
+	return err
+}
+
+// Copies the input key from the source connection to the destination with DUMP and RESTORE, preserving its
+// remaining TTL. An existing key on the destination is replaced if the input flag is set, and is otherwise left
+// in place, with RESTORE failing with a BUSYKEY error.
+func copyKey(src, dst Conn, key string, replace bool) error {
+	payload, err := src.Do("DUMP", key)
+	if err != nil {
+		return err
+	}
+	if payload == nil {
+		return errKeyNotFound
+	}
+
+	v, err := src.Do("PTTL", key)
+	if err != nil {
+		return err
+	}
+
+	// No expiry is -1, which RESTORE takes as 0. A key that has expired or been deleted since DUMP is -2.
+	ttl, _ := replyInt(v)
+	switch {
+	case ttl == -2:
+		return errKeyNotFound
+	case ttl < 0:
+		ttl = 0
+	}
+
+	args := []interface{}{key, ttl, payload}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+	_, err = dst.Do("RESTORE", args...)
+	return err
+}
@@ -0,0 +1,70 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestMoveKeyRemapsBeforeDeletingSource(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.KeyInstance["KEY"] = mockPool1
+
+	mockConn1.EXPECT().Do("DUMP", "KEY").Return([]byte("payload"), nil)
+	mockConn1.EXPECT().Do("PTTL", "KEY").Return(int64(5000), nil)
+	mockConn2.EXPECT().Do("RESTORE", "KEY", int64(5000), []byte("payload")).Return("OK", nil)
+	mockConn1.EXPECT().Do("DEL", "KEY").DoAndReturn(func(string, ...interface{}) (interface{}, error) {
+		if proxy.KeyInstance["KEY"] != mockPool2 {
+			t.Error("Expected key to be remapped before deletion from its source.")
+		}
+		return int64(1), nil
+	})
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Close()
+
+	if err := proxy.MoveKey("KEY", "b:6379"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestMoveKeyKeepsSourceWhenTargetHoldsKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.KeyInstance["KEY"] = mockPool1
+
+	busy := errors.New("BUSYKEY Target key name already exists.")
+	mockConn1.EXPECT().Do("DUMP", "KEY").Return([]byte("payload"), nil)
+	mockConn1.EXPECT().Do("PTTL", "KEY").Return(int64(-1), nil)
+	mockConn2.EXPECT().Do("RESTORE", "KEY", int64(0), []byte("payload")).Return(nil, busy)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Close()
+
+	if err := proxy.MoveKey("KEY", "b:6379"); err != busy {
+		t.Fatalf("Expected BUSYKEY error, got %v", err)
+	}
+	if proxy.KeyInstance["KEY"] != mockPool1 {
+		t.Fatal("Expected key to remain mapped to its source.")
+	}
+}
+
+func TestMoveKeyRejectsUnknownTarget(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{}})
+	proxy.Servers = []string{"a:6379:1"}
+
+	if err := proxy.MoveKey("KEY", "c:6379"); err == nil {
+		t.Fatal("Expected error for unknown target.")
+	}
+}
@@ -0,0 +1,149 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// MGet returns the values of the input keys in order, with nil for keys that do not exist, as MGET does.
+// Keys are grouped by the instance mapped to them or, with hash routing, their owner in the hash ring, and one MGET
+// is issued per instance concurrently. Keys that cannot be resolved are requested from every instance, and are
+// mapped to the instance that returns a value for them.
+func (r *ProxyConn) MGet(keys ...string) ([]interface{}, error) {
+	if len(keys) == 0 {
+		return nil, errNoKeys
+	}
+
+	var res []interface{}
+	err := r.retrying(context.Background(), "MGET", keys[0], func() (err error) {
+		res, err = r.mget(keys)
+		return err
+	})
+	return res, err
+}
+
+// Reads the input keys once, as for MGet.
+func (r *ProxyConn) mget(keys []string) ([]interface{}, error) {
+	t := r.topology()
+	groups := r.groupKeys(t, keys)
+	found := make(map[string]int)
+	values := make(map[string]interface{})
+
+	var mu sync.Mutex
+	err := t.forGroups(groups, func(i int, group []string) error {
+		args := make([]interface{}, len(group))
+		for j, k := range group {
+			args[j] = k
+		}
+
+		var v interface{}
+		err := r.read(t, i, "MGET", func(c Conn) (err error) {
+			v, err = c.Do("MGET", args...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		reply, ok := v.([]interface{})
+		if !ok || len(reply) != len(group) {
+			return errors.New("Unexpected reply to MGET.")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for j, k := range group {
+			if reply[j] == nil {
+				continue
+			}
+			values[k] = reply[j]
+			found[k] = i
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]interface{}, len(keys))
+	for i, k := range keys {
+		res[i] = values[k]
+		if p, ok := found[k]; ok {
+			if _, mapped := r.lookup(k); !mapped {
+				r.mapKey(k, t.pools[p])
+			}
+		}
+	}
+	return res, nil
+}
+
+// MSet sets each of the input keys to its value, issuing one MSET per instance concurrently.
+// Each key is written to the instance mapped to it or holding it, or else to its owner in the hash ring, and is
+// mapped there. If any key cannot be placed, nothing is written. MSET is atomic on each instance but not across
+// them, so if some instances fail, the keys on the others are still written.
+func (r *ProxyConn) MSet(kvs ...KeyValue) error {
+	if len(kvs) == 0 {
+		return errNoKeys
+	}
+	return r.retrying(context.Background(), "MSET", kvs[0].Key, func() error { return r.mset(kvs) })
+}
+
+// Places and writes the input keys once, as for MSet.
+func (r *ProxyConn) mset(kvs []KeyValue) error {
+	t := r.topology()
+	groups := make(map[int][]string)
+	values := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		pool, ok, err := r.place(kv.Key)
+		if err != nil {
+			return err
+		}
+
+		i := t.indexOf(pool)
+		if !ok || i < 0 {
+			if len(t.pools) != 1 {
+				return errNoPlacement
+			}
+			i = 0
+		}
+
+		if _, dup := values[kv.Key]; !dup {
+			groups[i] = append(groups[i], kv.Key)
+		}
+		values[kv.Key] = kv.Value
+	}
+
+	return t.forGroups(groups, func(i int, group []string) error {
+		args := make([]interface{}, 0, 2*len(group))
+		for _, k := range group {
+			args = append(args, k, values[k])
+		}
+
+		c := t.pools[i].Get()
+		defer c.Close()
+		if _, err := c.Do("MSET", args...); err != nil {
+			return err
+		}
+		for _, k := range group {
+			r.mapKey(k, t.pools[i])
+		}
+		return nil
+	})
+}
+
+// Runs the input function concurrently for each group with the index of its pool, and returns the first error.
+func (t *topology) forGroups(groups map[int][]string, fn func(int, []string) error) error {
+	errs := make([]error, len(t.pools))
+	wg := new(sync.WaitGroup)
+
+	for i, group := range groups {
+		wg.Add(1)
+		go func(i int, group []string) {
+			defer wg.Done()
+			errs[i] = fn(i, group)
+		}(i, group)
+	}
+
+	wg.Wait()
+	return firstError(errs)
+}
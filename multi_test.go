@@ -0,0 +1,87 @@
+package twunproxy
+
+import (
+	"sync"
+	"testing"
+)
+
+// Holds string values and answers MGET, MSET and EXISTS.
+type mapConn struct {
+	mu   sync.Mutex
+	data map[string]string
+	cmds []string
+}
+
+func (c *mapConn) Close() error { return nil }
+
+func (c *mapConn) Do(name string, args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cmds = append(c.cmds, name)
+
+	switch name {
+	case "MGET":
+		res := make([]interface{}, len(args))
+		for i, a := range args {
+			if v, ok := c.data[a.(string)]; ok {
+				res[i] = []byte(v)
+			}
+		}
+		return res, nil
+	case "MSET":
+		for i := 0; i < len(args); i += 2 {
+			c.data[args[i].(string)] = args[i+1].(string)
+		}
+		return "OK", nil
+	case "EXISTS":
+		if _, ok := c.data[args[0].(string)]; ok {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+	return nil, nil
+}
+
+func TestMGetReassemblesInOrderAndMapsKeys(t *testing.T) {
+	first := &mapConn{data: map[string]string{"a": "1"}}
+	second := &mapConn{data: map[string]string{"b": "2"}}
+	proxy := getMockProxy(connPool{first}, connPool{second})
+
+	res, err := proxy.MGet("b", "missing", "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(res) != 3 || string(res[0].([]byte)) != "2" || res[1] != nil || string(res[2].([]byte)) != "1" {
+		t.Fatalf("Unexpected values: %v", res)
+	}
+
+	if pool, ok := proxy.lookup("b"); !ok || pool != proxy.Pools[1] {
+		t.Fatal("Expected key to be mapped to the instance holding it")
+	}
+	if _, ok := proxy.lookup("missing"); ok {
+		t.Fatal("Expected missing key not to be mapped")
+	}
+
+	// Mapped keys are only requested from their instance.
+	first.cmds, second.cmds = nil, nil
+	if _, err := proxy.MGet("a"); err != nil || len(first.cmds) != 1 || len(second.cmds) != 0 {
+		t.Fatalf("Expected a single MGET to the mapped instance, got %v and %v", first.cmds, second.cmds)
+	}
+}
+
+func TestMSetWritesToHoldingInstance(t *testing.T) {
+	first := &mapConn{data: map[string]string{}}
+	second := &mapConn{data: map[string]string{"b": "old"}}
+	proxy := getMockProxy(connPool{first}, connPool{second})
+
+	if err := proxy.MSet(KeyValue{Key: "b", Value: "new"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if second.data["b"] != "new" || len(first.data) != 0 {
+		t.Fatalf("Expected the holding instance to be written, got %v and %v", first.data, second.data)
+	}
+
+	if err := proxy.MSet(KeyValue{Key: "new", Value: "v"}); err != errNoPlacement {
+		t.Fatalf("Expected placement error without a hash ring, got %v", err)
+	}
+}
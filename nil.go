@@ -0,0 +1,62 @@
+package twunproxy
+
+import (
+	"errors"
+	"reflect"
+)
+
+// NilReplier is implemented by connections whose client library reports a nil reply as an error,
+// such as go-redis with redis.Nil. Errors for which IsNilReply returns true are treated as a nil reply.
+type NilReplier interface {
+	IsNilReply(err error) bool
+}
+
+// WithNilErrors treats the input errors, and any errors wrapping them, as nil replies on every connection.
+// This is an alternative to implementing NilReplier on an adapter.
+func WithNilErrors(errs ...error) Option {
+	return func(r *ProxyConn) {
+		r.nilErrors = append(r.nilErrors, errs...)
+	}
+}
+
+// Normalises the ways that client libraries represent a nil reply to an untyped nil with no error.
+// This makes canMap predicates behave the same regardless of the client.
+func (r *ProxyConn) normalizeReply(conn Conn, v interface{}, err error) (interface{}, error) {
+	if IsNilReply(conn, v, err, r.nilErrors...) {
+		return nil, nil
+	}
+	return v, err
+}
+
+// IsNilReply returns true if the input reply from the connection represents a nil reply.
+// That is an error reported as nil by the connection or matching one of the input nil errors,
+// or else no error and a nil or typed nil value, such as a nil []interface{}.
+func IsNilReply(conn Conn, v interface{}, err error, nilErrors ...error) bool {
+	if err == nil {
+		return isNilValue(v)
+	}
+
+	if nr, ok := conn.(NilReplier); ok && nr.IsNilReply(err) {
+		return true
+	}
+
+	for _, e := range nilErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true for nil and for typed nil pointers, slices, maps and interfaces.
+func isNilValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface, reflect.Chan, reflect.Func:
+		return rv.IsNil()
+	}
+	return false
+}
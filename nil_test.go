@@ -0,0 +1,78 @@
+package twunproxy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// A connection returning a fixed reply, standing in for the nil representation of a client library.
+type nilStyleConn struct {
+	reply interface{}
+	err   error
+	isNil func(error) bool
+}
+
+func (c *nilStyleConn) Close() error { return nil }
+
+func (c *nilStyleConn) Do(string, ...interface{}) (interface{}, error) { return c.reply, c.err }
+
+// Wraps a connection with a NilReplier implementation.
+type nilReplierConn struct {
+	*nilStyleConn
+}
+
+func (c nilReplierConn) IsNilReply(err error) bool { return c.isNil(err) }
+
+type connPool struct {
+	conn Conn
+}
+
+func (p connPool) Get() Conn { return p.conn }
+
+var errClientNil = errors.New("redis: nil")
+
+// Every representation of a nil reply must leave discovery to map the key to the instance with a value.
+func TestNilReplyConformance(t *testing.T) {
+	styles := []struct {
+		name string
+		conn Conn
+		opts []Option
+	}{
+		{"untyped nil", &nilStyleConn{}, nil},
+		{"typed nil slice", &nilStyleConn{reply: []interface{}(nil)}, nil},
+		{"typed nil bytes", &nilStyleConn{reply: []byte(nil)}, nil},
+		{"nil replier", nilReplierConn{&nilStyleConn{err: errClientNil, isNil: func(err error) bool {
+			return err == errClientNil
+		}}}, nil},
+		{"nil error option", &nilStyleConn{err: fmt.Errorf("wrapped: %w", errClientNil)}, []Option{WithNilErrors(errClientNil)}},
+	}
+
+	for _, s := range styles {
+		hit := connPool{&nilStyleConn{reply: []byte("VAL")}}
+		proxy := getMockProxy(connPool{s.conn}, hit)
+		for _, opt := range s.opts {
+			opt(proxy)
+		}
+
+		v, err := proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil })
+		if err != nil || string(v.([]byte)) != "VAL" {
+			t.Fatalf("%s: unexpected result: %v, %v", s.name, v, err)
+		}
+		if proxy.KeyInstance["KEY"] != hit {
+			t.Fatalf("%s: key not mapped to the instance with a value.", s.name)
+		}
+	}
+}
+
+func TestNormalizeReplyKeepsErrorsAndEmptyValues(t *testing.T) {
+	proxy := getMockProxy()
+	conn := &nilStyleConn{}
+
+	if _, err := proxy.normalizeReply(conn, nil, errClientNil); err != errClientNil {
+		t.Fatalf("Expected error to be kept, got %v", err)
+	}
+	if v, _ := proxy.normalizeReply(conn, []interface{}{}, nil); v == nil {
+		t.Fatal("Empty array reply should not be treated as nil.")
+	}
+}
@@ -0,0 +1,40 @@
+package twunproxy
+
+// Option configures optional ProxyConn behaviour. Options are passed to NewProxyConn.
+type Option func(*ProxyConn)
+
+// WithMetrics sets the sink that receives measurements from the proxy and its subsystems.
+func WithMetrics(m Metrics) Option {
+	return func(r *ProxyConn) {
+		r.metrics = m
+	}
+}
+
+// WithTracer records every command issued through Do in the input tracer.
+func WithTracer(t *Tracer) Option {
+	return func(r *ProxyConn) {
+		r.tracer = t
+	}
+}
+
+// WithWireCapture records a sample of commands issued through Do, with their replies, to the input capture.
+func WithWireCapture(c *WireCapture) Option {
+	return func(r *ProxyConn) {
+		r.capture = c
+	}
+}
+
+// WithRedactor applies the input Redactor to command arguments before they are traced or captured.
+func WithRedactor(f Redactor) Option {
+	return func(r *ProxyConn) {
+		r.redactor = f
+	}
+}
+
+// WithDeadLetter passes commands that cannot be routed to any instance to the input handler,
+// so that the application can persist and replay them rather than losing them.
+func WithDeadLetter(f func(DeadLetter)) Option {
+	return func(r *ProxyConn) {
+		r.onDeadLetter = f
+	}
+}
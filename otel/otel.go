@@ -0,0 +1,67 @@
+// Package otel traces the commands of a twunproxy.ProxyConn with OpenTelemetry, so that the time spent in
+// twunproxy, and on which instances, shows in request traces.
+package otel
+
+import (
+	"context"
+	"fmt"
+	"github.com/txodds/twunproxy"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer that spans are started with.
+const InstrumentationName = "github.com/txodds/twunproxy"
+
+// Spans is a twunproxy.SpanStarter starting OpenTelemetry client spans.
+type Spans struct {
+	tracer trace.Tracer
+}
+
+// NewSpans returns a SpanStarter starting spans with a tracer of the input provider,
+// such as otel.GetTracerProvider().
+func NewSpans(tp trace.TracerProvider) *Spans {
+	return &Spans{tracer: tp.Tracer(InstrumentationName)}
+}
+
+// WithSpans returns an option for NewProxyConn that traces every command with the input provider.
+func WithSpans(tp trace.TracerProvider) twunproxy.Option {
+	return twunproxy.WithSpans(NewSpans(tp))
+}
+
+// StartSpan starts a client span with the input name as a child of any span in the context.
+func (s *Spans) StartSpan(ctx context.Context, name string) (context.Context, twunproxy.Span) {
+	ctx, span := s.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, otelSpan{span}
+}
+
+// Adapts an OpenTelemetry span to twunproxy.Span.
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetAttribute sets the attribute with its OpenTelemetry type. Values of other types are formatted as strings.
+func (s otelSpan) SetAttribute(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+// End records any error and its status on the span, and ends it.
+func (s otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,33 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestSpansRecordAttributesAndErrors(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	s := NewSpans(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	_, span := s.StartSpan(context.Background(), "GET")
+	span.SetAttribute("server.address", "a:6379")
+	span.SetAttribute("twunproxy.mapping_hit", true)
+	span.End(errors.New("ERR failed"))
+
+	ended := rec.Ended()
+	if len(ended) != 1 || ended[0].Name() != "GET" || ended[0].Status().Code != codes.Error {
+		t.Fatalf("Unexpected spans: %v", ended)
+	}
+
+	attrs := make(map[string]string)
+	for _, kv := range ended[0].Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["server.address"] != "a:6379" || attrs["twunproxy.mapping_hit"] != "true" {
+		t.Fatalf("Unexpected attributes: %v", attrs)
+	}
+}
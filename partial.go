@@ -0,0 +1,50 @@
+package twunproxy
+
+// PartialError is returned by fan-out reads when partial results are enabled and some, but not all,
+// instances fail. The results of the other instances are returned with it. Failed holds errors by server.
+type PartialError struct {
+	Failed map[string]error
+}
+
+func (e *PartialError) Error() string {
+	return failuresString(e.Failed)
+}
+
+// Unwrap returns the errors of each failed instance, ordered by server.
+func (e *PartialError) Unwrap() []error {
+	return failuresList(e.Failed)
+}
+
+// WithPartialResults makes fan-out reads such as Keys, DBSize, Info and SlowLog return the results of the instances
+// that answered, with a PartialError naming those that failed, rather than failing as a whole when any one fails.
+// If every instance fails, the error is returned as without partial results. Monitoring callers usually prefer
+// degraded data.
+func WithPartialResults() Option {
+	return func(r *ProxyConn) {
+		r.partial = true
+	}
+}
+
+// Returns the error of a fan-out from the errors of each instance of the topology.
+// A single failure is returned as it is, and several as a MultiError. With partial results enabled,
+// failures of some but not all instances yield a PartialError instead.
+func (r *ProxyConn) fanOutError(t *topology, errs []error) error {
+	failed := make(map[string]error)
+	var last error
+	for i, err := range errs {
+		if err != nil {
+			failed[t.server(i)] = err
+			last = err
+		}
+	}
+
+	switch {
+	case len(failed) == 0:
+		return nil
+	case r.partial && len(failed) < len(errs):
+		return &PartialError{Failed: failed}
+	case len(failed) == 1:
+		return last
+	}
+	return &MultiError{Failed: failed}
+}
@@ -0,0 +1,48 @@
+package twunproxy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPartialResultsReturnAnsweringInstances(t *testing.T) {
+	down := errors.New("down")
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: int64(3)}}, connPool{&nilStyleConn{err: down}})
+
+	if _, err := proxy.DBSize(); err != down {
+		t.Fatalf("Expected instance error without partial results, got %v", err)
+	}
+
+	WithPartialResults()(proxy)
+	rep, err := proxy.DBSize()
+	pe, ok := err.(*PartialError)
+	if !ok || len(pe.Failed) != 1 || pe.Failed["1"] != down {
+		t.Fatalf("Expected partial error, got %v", err)
+	}
+	if rep.Keys != 3 {
+		t.Fatalf("Expected keys of the answering instance, got %d", rep.Keys)
+	}
+}
+
+func TestPartialResultsFailWhenEveryInstanceFails(t *testing.T) {
+	down := errors.New("down")
+	proxy := getMockProxy(connPool{&nilStyleConn{err: down}}, connPool{&nilStyleConn{err: down}})
+	WithPartialResults()(proxy)
+
+	_, err := proxy.Keys("*", 10)
+	var me *MultiError
+	if !errors.As(err, &me) || len(me.Failed) != 2 || !errors.Is(err, down) {
+		t.Fatalf("Expected instance errors, got %v", err)
+	}
+}
+
+func TestPartialResultsForKeys(t *testing.T) {
+	page := []interface{}{[]byte("0"), []interface{}{[]byte("A"), []byte("B")}}
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: page}}, connPool{&nilStyleConn{err: errors.New("down")}})
+	WithPartialResults()(proxy)
+
+	keys, err := proxy.Keys("*", 10)
+	if _, ok := err.(*PartialError); !ok || len(keys) != 2 {
+		t.Fatalf("Unexpected result: %v, %v", keys, err)
+	}
+}
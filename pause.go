@@ -0,0 +1,61 @@
+package twunproxy
+
+import (
+	"errors"
+	"time"
+)
+
+// PauseMode selects which clients are suspended by CLIENT PAUSE.
+type PauseMode string
+
+const (
+	// PauseModeWrite suspends clients issuing write commands only. Requires Redis 6.2 or later.
+	PauseModeWrite PauseMode = "WRITE"
+	// PauseModeAll suspends all client commands.
+	PauseModeAll PauseMode = "ALL"
+)
+
+// MaxPause is the longest pause accepted by PauseAll.
+// It guards against accidentally freezing the whole pool for a long period.
+var MaxPause = 30 * time.Second
+
+// PauseAll issues CLIENT PAUSE for the input duration and mode against every instance concurrently.
+// The pause is only considered successful if every instance acknowledges it.
+// If any instance fails to pause, all instances are unpaused again and the first error is returned.
+// Regardless of whether Unpause is called, Redis resumes clients by itself once the duration elapses.
+func (r *ProxyConn) PauseAll(d time.Duration, mode PauseMode) error {
+	if d <= 0 || d > MaxPause {
+		return errors.New("Pause duration must be positive and no longer than MaxPause.")
+	}
+
+	ms := d.Nanoseconds() / int64(time.Millisecond)
+	errs := r.topology().forEach(func(_ int, c Conn) error {
+		v, err := c.Do("CLIENT", "PAUSE", ms, string(mode))
+		if err == nil && !isOK(v) {
+			err = errors.New("CLIENT PAUSE was not acknowledged.")
+		}
+		return err
+	})
+
+	if err := firstError(errs); err != nil {
+		r.Unpause()
+		return err
+	}
+
+	return nil
+}
+
+// Unpause issues CLIENT UNPAUSE against every instance concurrently.
+// Unpausing an instance that is not paused is harmless.
+func (r *ProxyConn) Unpause() error {
+	return firstError(r.topology().forEach(func(_ int, c Conn) error {
+		_, err := c.Do("CLIENT", "UNPAUSE")
+		return err
+	}))
+}
+
+// IsOK indicates whether the input reply is the "OK" status.
+func isOK(v interface{}) bool {
+	s, ok := replyString(v)
+	return ok && s == "OK"
+}
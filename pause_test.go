@@ -0,0 +1,52 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestPauseAllPausesEachPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("CLIENT", "PAUSE", int64(2000), "ALL").Return("OK", nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("CLIENT", "PAUSE", int64(2000), "ALL").Return([]byte("OK"), nil)
+	mockConn2.EXPECT().Close()
+
+	if err := getMockProxy(mockPool1, mockPool2).PauseAll(2*time.Second, PauseModeAll); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestPauseAllUnpausesWhenNotAcknowledged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("CLIENT", "PAUSE", int64(100), "WRITE").Return("OK", nil)
+	mockConn2.EXPECT().Do("CLIENT", "PAUSE", int64(100), "WRITE").Return(nil, nil)
+	mockConn1.EXPECT().Do("CLIENT", "UNPAUSE").Return("OK", nil)
+	mockConn2.EXPECT().Do("CLIENT", "UNPAUSE").Return("OK", nil)
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Close().Times(2)
+
+	if err := getMockProxy(mockPool1, mockPool2).PauseAll(100*time.Millisecond, PauseModeWrite); err == nil {
+		t.Fatal("Expected error for unacknowledged pause.")
+	}
+}
+
+func TestPauseAllRejectsExcessiveDuration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockPool := setupMockPool(ctrl)
+
+	if err := getMockProxy(mockPool).PauseAll(MaxPause+time.Second, PauseModeWrite); err == nil {
+		t.Fatal("Expected error for pause longer than MaxPause.")
+	}
+}
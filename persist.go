@@ -0,0 +1,178 @@
+package twunproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+)
+
+/******************************************************
+ * Persistence of key mappings.
+ * Mappings are saved by instance address, so that a restarted proxy can reload them instead of rediscovering
+ * every key against every instance.
+ ******************************************************/
+
+// The version of the saved mappings format. Version 1 had no binary keys, and is still loaded.
+const mappingsVersion = 2
+
+// The saved form of the key mappings: the keys mapped to each instance, by address.
+// Keys that are not valid UTF-8 are saved in Binary, as JSON strings would not preserve them.
+type savedMappings struct {
+	Version   int                 `json:"version"`
+	Saved     time.Time           `json:"saved"`
+	Instances map[string][]string `json:"instances"`
+	Binary    map[string][][]byte `json:"binary,omitempty"`
+}
+
+// SaveMappings writes every key mapping to the input writer and returns the number written.
+// Mappings are recorded against the address of their instance, so they remain valid for any proxy configured
+// with the same instances, whatever their order. The key mapper must be able to enumerate its mappings.
+func (r *ProxyConn) SaveMappings(w io.Writer) (int, error) {
+	all, ok := r.mappings()
+	if !ok {
+		return 0, errors.New("Key mapper cannot enumerate its mappings.")
+	}
+
+	t := r.topology()
+	saved := savedMappings{Version: mappingsVersion, Saved: time.Now(), Instances: make(map[string][]string)}
+	n := 0
+	for k, pool := range all {
+		server := t.serverOf(pool)
+		switch {
+		case server == "":
+			continue
+		case utf8.ValidString(k):
+			saved.Instances[server] = append(saved.Instances[server], k)
+		default:
+			if saved.Binary == nil {
+				saved.Binary = make(map[string][][]byte)
+			}
+			saved.Binary[server] = append(saved.Binary[server], []byte(k))
+		}
+		n++
+	}
+	return n, json.NewEncoder(w).Encode(saved)
+}
+
+// LoadMappings maps the keys read from the input reader, as written by SaveMappings, and returns the number mapped.
+// Keys saved against instances that are no longer configured are skipped, to be rediscovered.
+// Existing mappings are overwritten by those loaded.
+func (r *ProxyConn) LoadMappings(rd io.Reader) (int, error) {
+	var saved savedMappings
+	if err := json.NewDecoder(rd).Decode(&saved); err != nil {
+		return 0, err
+	}
+	if saved.Version < 1 || saved.Version > mappingsVersion {
+		return 0, errors.New("Unsupported mappings version.")
+	}
+
+	if saved.Instances == nil {
+		saved.Instances = make(map[string][]string)
+	}
+	for server, keys := range saved.Binary {
+		for _, k := range keys {
+			saved.Instances[server] = append(saved.Instances[server], string(k))
+		}
+	}
+
+	t := r.topology()
+	n := 0
+	for server, keys := range saved.Instances {
+		i, err := t.index(server)
+		if err != nil {
+			r.counter("mappings_skipped", server, float64(len(keys)))
+			continue
+		}
+		for _, k := range keys {
+			r.mapKey(k, t.pools[i])
+		}
+		n += len(keys)
+	}
+	return n, nil
+}
+
+// SaveMappingsFile saves the key mappings as for SaveMappings to the file at the input path.
+// The file is written in full and then renamed, so that a failed save leaves any previous file intact.
+func (r *ProxyConn) SaveMappingsFile(path string) (int, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+
+	n, err := r.SaveMappings(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, os.Rename(f.Name(), path)
+}
+
+// LoadMappingsFile loads the key mappings saved by SaveMappingsFile at the input path.
+// A missing file loads nothing without error, as on the first start.
+func (r *ProxyConn) LoadMappingsFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return r.LoadMappings(f)
+}
+
+// SaveMappingsKey saves the key mappings as for SaveMappings to the input Redis key,
+// which is written to the instance that holds it or that the hash ring places it on.
+func (r *ProxyConn) SaveMappingsKey(key string) (int, error) {
+	var buf bytes.Buffer
+	n, err := r.SaveMappings(&buf)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.doKeyed(NewRedisCmd("SET", key, buf.Bytes()), true); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// LoadMappingsKey loads the key mappings saved by SaveMappingsKey in the input Redis key.
+// A missing key loads nothing without error.
+func (r *ProxyConn) LoadMappingsKey(key string) (int, error) {
+	v, err := r.doKeyed(NewRedisCmd("GET", key), false)
+	if err != nil || v == nil {
+		return 0, err
+	}
+	return r.LoadMappings(bytes.NewReader(replyBytes(v)))
+}
+
+// WithPersistentMappings loads the key mappings saved at the input path when the proxy is created.
+// Errors loading them are ignored, leaving keys to be discovered. Pass it after any WithKeyMapper option,
+// so that the mappings are loaded into the configured mapper. Save them periodically with SaveMappingsJob,
+// and on shutdown with SaveMappingsFile.
+func WithPersistentMappings(path string) Option {
+	return func(r *ProxyConn) {
+		r.LoadMappingsFile(path)
+	}
+}
+
+// SaveMappingsJob returns a job saving the key mappings to the file at the input path at the input interval.
+func SaveMappingsJob(interval time.Duration, path string) Job {
+	return Job{
+		Name:     "save_mappings",
+		Interval: interval,
+		Run: func(ctx context.Context, r *ProxyConn) error {
+			_, err := r.SaveMappingsFile(path)
+			return err
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package twunproxy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSaveAndLoadMappingsByInstance(t *testing.T) {
+	pool0, pool1 := connPool{&nilStyleConn{}}, connPool{&nilStyleConn{}}
+	proxy := getMockProxy(pool0, pool1)
+	proxy.Servers = []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}
+	proxy.mapKey("a", pool0)
+	proxy.mapKey("b", pool1)
+	proxy.mapKey("c", pool1)
+
+	var buf bytes.Buffer
+	if n, err := proxy.SaveMappings(&buf); err != nil || n != 3 {
+		t.Fatalf("Expected 3 mappings saved, got %d, %v", n, err)
+	}
+
+	// The restarted proxy lists its instances in the opposite order.
+	restarted := getMockProxy(pool1, pool0)
+	restarted.Servers = []string{"10.0.0.2:6379:1", "10.0.0.1:6379:1"}
+	if n, err := restarted.LoadMappings(&buf); err != nil || n != 3 {
+		t.Fatalf("Expected 3 mappings loaded, got %d, %v", n, err)
+	}
+
+	for k, want := range map[string]ConnGetter{"a": pool0, "b": pool1, "c": pool1} {
+		if pool, ok := restarted.lookup(k); !ok || pool != want {
+			t.Fatalf("Expected %s to be mapped to its saved instance", k)
+		}
+	}
+}
+
+func TestLoadMappingsSkipsUnknownInstances(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{}})
+
+	saved := `{"version":1,"instances":{"0":["a"],"10.9.9.9:6379":["b"]}}`
+	if n, err := proxy.LoadMappings(strings.NewReader(saved)); err != nil || n != 1 {
+		t.Fatalf("Expected 1 mapping loaded, got %d, %v", n, err)
+	}
+	if _, ok := proxy.lookup("b"); ok {
+		t.Fatal("Expected the key of an unknown instance to be skipped.")
+	}
+}
+
+func TestPersistentMappingsFileRoundTrip(t *testing.T) {
+	path := t.TempDir() + "/mappings.json"
+	pool := connPool{&nilStyleConn{}}
+
+	proxy := getMockProxy(pool)
+	if n, err := proxy.LoadMappingsFile(path); err != nil || n != 0 {
+		t.Fatalf("Expected a missing file to load nothing, got %d, %v", n, err)
+	}
+
+	proxy.mapKey("a", pool)
+	if _, err := proxy.SaveMappingsFile(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	restarted := getMockProxy(pool)
+	WithPersistentMappings(path)(restarted)
+	if _, ok := restarted.lookup("a"); !ok {
+		t.Fatal("Expected the saved mapping to be loaded.")
+	}
+}
+
+func TestSaveMappingsPreservesBinaryKeys(t *testing.T) {
+	pool := connPool{&nilStyleConn{}}
+	proxy := getMockProxy(pool)
+	binary := string([]byte{0xff, 0x00, 0xfe})
+	proxy.mapKey(binary, pool)
+	proxy.mapKey("text", pool)
+
+	var buf bytes.Buffer
+	if n, err := proxy.SaveMappings(&buf); err != nil || n != 2 {
+		t.Fatalf("Expected 2 mappings saved, got %d, %v", n, err)
+	}
+
+	restarted := getMockProxy(pool)
+	if n, err := restarted.LoadMappings(&buf); err != nil || n != 2 {
+		t.Fatalf("Expected 2 mappings loaded, got %d, %v", n, err)
+	}
+	for _, k := range []string{binary, "text"} {
+		if _, ok := restarted.lookup(k); !ok {
+			t.Fatalf("Expected %q to be mapped", k)
+		}
+	}
+}
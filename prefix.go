@@ -0,0 +1,136 @@
+package twunproxy
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Returned when prefix rules are used without having been enabled.
+var errPrefixRulesDisabled = errors.New("Prefix rules are not enabled.")
+
+// WithPrefixRules enables prefix-level mappings, which direct every key under a prefix to one instance so that
+// new keys skip the discovery fan-out. Rules are added with MapPrefix or, if learnAfter is positive and adaptive
+// discovery is enabled, learned once that many discoveries for a prefix have all been answered by one instance.
+// Commands that discover their key probe the instance of a rule alone first; if the key is then found on another
+// instance, the rule is demoted and removed, and the "prefix_rule_demotions" counter is incremented for the instance
+// it named. Commands routed by key placement, such as writes that may create their key, first check that no
+// instance holds the key, demoting the rule likewise if another does; keys that do not exist are placed on
+// the instance of the rule, and counted by "prefix_placements".
+func WithPrefixRules(learnAfter int) Option {
+	return func(r *ProxyConn) {
+		r.prefixes = &prefixRules{learnAfter: learnAfter, rules: make(map[string]string)}
+	}
+}
+
+// MapPrefix directs every key beginning with the input prefix to the instance with the input address.
+// Where rules overlap, the longest matching prefix applies. Prefix rules must be enabled with WithPrefixRules.
+func (r *ProxyConn) MapPrefix(prefix, server string) error {
+	if r.prefixes == nil {
+		return errPrefixRulesDisabled
+	}
+	if _, err := r.topology().index(server); err != nil {
+		return err
+	}
+
+	r.prefixes.mu.Lock()
+	defer r.prefixes.mu.Unlock()
+	r.prefixes.rules[prefix] = server
+	return nil
+}
+
+// UnmapPrefix removes the rule for the input prefix, if there is one.
+func (r *ProxyConn) UnmapPrefix(prefix string) {
+	r.prefixes.demote(prefix)
+}
+
+// PrefixRules returns the current prefix rules, as server addresses by prefix.
+func (r *ProxyConn) PrefixRules() map[string]string {
+	res := make(map[string]string)
+	if r.prefixes == nil {
+		return res
+	}
+
+	r.prefixes.mu.Lock()
+	defer r.prefixes.mu.Unlock()
+	for p, s := range r.prefixes.rules {
+		res[p] = s
+	}
+	return res
+}
+
+// PrefixRules holds the server address for each mapped key prefix.
+type prefixRules struct {
+	learnAfter int
+	mu         sync.Mutex
+	rules      map[string]string
+}
+
+// Returns the index in the topology of the instance named by the longest rule matching the input key,
+// with the matching prefix. False is returned if no rule matches an instance in the topology.
+// Safe to call on a nil receiver, which matches nothing.
+func (p *prefixRules) lookup(key string, t *topology) (int, string, bool) {
+	if p == nil {
+		return -1, "", false
+	}
+
+	p.mu.Lock()
+	best, server := "", ""
+	for prefix, s := range p.rules {
+		if strings.HasPrefix(key, prefix) && len(prefix) > len(best) {
+			best, server = prefix, s
+		}
+	}
+	p.mu.Unlock()
+
+	if server == "" {
+		return -1, "", false
+	}
+
+	i, err := t.index(server)
+	return i, best, err == nil
+}
+
+// Removes the rule for the input prefix.
+func (p *prefixRules) demote(prefix string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.rules, prefix)
+}
+
+// Adds a rule for the prefix of the input key if learning is enabled and every one of at least learnAfter
+// recorded discoveries for the prefix was answered by the same instance.
+func (p *prefixRules) learn(key string, stats *discoveryStats) {
+	if p == nil || stats == nil || p.learnAfter <= 0 {
+		return
+	}
+
+	prefix, ok := stats.prefix(key)
+	if !ok {
+		return
+	}
+
+	server, n := "", 0
+	stats.mu.Lock()
+	if hits := stats.hits[prefix]; len(hits) == 1 {
+		for s, count := range hits {
+			server, n = s, count
+		}
+	}
+	stats.mu.Unlock()
+
+	if n < p.learnAfter {
+		return
+	}
+
+	// Include the delimiter so that the rule does not match keys that merely begin with the same characters.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.rules[prefix+stats.delimiter]; !ok {
+		p.rules[prefix+stats.delimiter] = server
+	}
+}
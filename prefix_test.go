@@ -0,0 +1,142 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestPrefixRuleSkipsDiscoveryForNewKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithPrefixRules(0)(proxy)
+	if err := proxy.MapPrefix("queue:", "1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mockConn2.EXPECT().Do("RPUSH", "queue:new", "v").Return(int64(1), nil)
+	mockConn2.EXPECT().Close()
+
+	canMap := func(v interface{}) bool { return v != nil }
+	if _, err := proxy.Do(NewRedisCmd("RPUSH", "queue:new", "v"), canMap); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if proxy.KeyInstance["queue:new"] != mockPool2 {
+		t.Fatal("Expected key to be mapped to the prefix instance.")
+	}
+}
+
+func TestPrefixRulePlacesNewKeyedWrites(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.ring, _ = newHashRing(proxy.Servers, "fnv1a_32", "modula", "")
+	WithPrefixRules(0)(proxy)
+	if err := proxy.MapPrefix("bits:", "b:6379"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The ring would place the key on the first instance, but neither holds it, so the rule places it.
+	gomock.InOrder(
+		mockConn2.EXPECT().Do("EXISTS", "bits:new").Return(int64(0), nil),
+		mockConn1.EXPECT().Do("EXISTS", "bits:new").Return(int64(0), nil),
+		mockConn2.EXPECT().Do("SETBIT", "bits:new", int64(7), 1).Return(int64(0), nil),
+	)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Close().Times(2)
+
+	if _, err := proxy.SetBit("bits:new", 7, 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if proxy.KeyInstance["bits:new"] != mockPool2 {
+		t.Fatal("Expected key to be mapped to the prefix instance.")
+	}
+}
+
+func TestPrefixRuleNotTrustedForKeyHeldElsewhere(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	m := newFakeMetrics()
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	WithMetrics(m)(proxy)
+	WithPrefixRules(0)(proxy)
+	proxy.MapPrefix("user:", "b:6379")
+
+	// The key already lives on the first instance, so the write goes there rather than duplicating it.
+	gomock.InOrder(
+		mockConn2.EXPECT().Do("EXISTS", "user:1").Return(int64(0), nil),
+		mockConn1.EXPECT().Do("EXISTS", "user:1").Return(int64(1), nil),
+		mockConn1.EXPECT().Do("SET", "user:1", "v").Return("OK", nil),
+	)
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Close()
+
+	if _, err := proxy.doKeyed(NewRedisCmd("SET", "user:1", "v"), true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if proxy.KeyInstance["user:1"] != mockPool1 {
+		t.Fatal("Expected the key to stay mapped to the instance holding it.")
+	}
+	if len(proxy.PrefixRules()) != 0 || m.get("prefix_rule_demotions", "b:6379") != 1 {
+		t.Fatalf("Expected the rule to be demoted once, got %v", proxy.PrefixRules())
+	}
+}
+
+func TestPrefixRuleDemotedOnContradiction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithPrefixRules(0)(proxy)
+	proxy.MapPrefix("queue:", "1")
+
+	mockConn2.EXPECT().Do("GET", "queue:old").Return(nil, nil)
+	mockConn2.EXPECT().Close()
+	mockConn1.EXPECT().Do("GET", "queue:old").Return([]byte("v"), nil)
+	mockConn1.EXPECT().Close()
+
+	canMap := func(v interface{}) bool { return v != nil }
+	if _, err := proxy.Do(NewRedisCmd("GET", "queue:old"), canMap); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(proxy.PrefixRules()) != 0 {
+		t.Fatal("Expected contradicted rule to be demoted.")
+	}
+}
+
+func TestPrefixRulesLearnedFromUnanimousDiscovery(t *testing.T) {
+	proxy := getMockProxy()
+	WithAdaptiveDiscovery(":", 1)(proxy)
+	WithPrefixRules(2)(proxy)
+
+	proxy.adaptive.record("a:b:1", "1")
+	proxy.prefixes.learn("a:b:1", proxy.adaptive)
+	if len(proxy.PrefixRules()) != 0 {
+		t.Fatal("Expected no rule before enough samples.")
+	}
+
+	proxy.adaptive.record("a:b:2", "1")
+	proxy.prefixes.learn("a:b:2", proxy.adaptive)
+	if rules := proxy.PrefixRules(); rules["a:b:"] != "1" {
+		t.Fatalf("Unexpected rules: %v", rules)
+	}
+}
@@ -0,0 +1,133 @@
+package twunproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ProbeCriteria are the conditions a proxy must meet to pass a readiness or liveness probe.
+// RequireConfig requires the pool configuration to have been parsed and its pools started, which a proxy started
+// under a degraded startup policy may not yet have done. MinHealthy is the minimum number of instances that must
+// answer PING within Timeout. MinMappings is the minimum number of keys in the mapping cache, for services that
+// warm it before taking traffic; it fails for mappers that cannot enumerate their mappings. Zero values disable
+// the corresponding checks.
+type ProbeCriteria struct {
+	RequireConfig bool
+	MinHealthy    int
+	MinMappings   int
+	Timeout       time.Duration
+}
+
+// DefaultReadinessCriteria require the configuration to be loaded and at least one instance to answer PING.
+var DefaultReadinessCriteria = ProbeCriteria{RequireConfig: true, MinHealthy: 1, Timeout: time.Second}
+
+// DefaultLivenessCriteria require only that the configuration is loaded, so that an outage of every instance
+// makes the service unready without it being restarted.
+var DefaultLivenessCriteria = ProbeCriteria{RequireConfig: true}
+
+// ProbeCheck is the outcome of a single check of a probe.
+type ProbeCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// ProbeResult is the outcome of a probe, which passes if every check does.
+type ProbeResult struct {
+	OK     bool         `json:"ok"`
+	Checks []ProbeCheck `json:"checks"`
+}
+
+// Readiness reports whether the proxy meets the input criteria for taking traffic.
+func (r *ProxyConn) Readiness(ctx context.Context, c ProbeCriteria) ProbeResult {
+	return r.probe(ctx, c)
+}
+
+// Liveness reports whether the proxy meets the input criteria for continuing to run.
+// Criteria that depend on the instances are best left to Readiness, since restarting the service does not help them.
+func (r *ProxyConn) Liveness(ctx context.Context, c ProbeCriteria) ProbeResult {
+	return r.probe(ctx, c)
+}
+
+// ProbeHandler serves the result of the input probe as JSON, with status 200 if it passes and 503 if it does not,
+// for wiring into Kubernetes HTTP probes:
+//
+//	http.Handle("/readyz", twunproxy.ProbeHandler(func(ctx context.Context) twunproxy.ProbeResult {
+//		return proxy.Readiness(ctx, twunproxy.DefaultReadinessCriteria)
+//	}))
+func ProbeHandler(probe func(context.Context) ProbeResult) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		res := probe(req.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		if res.OK {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(res)
+	})
+}
+
+// Runs the checks enabled by the input criteria.
+func (r *ProxyConn) probe(ctx context.Context, c ProbeCriteria) ProbeResult {
+	t := r.topology()
+	res := ProbeResult{OK: true, Checks: make([]ProbeCheck, 0)}
+	add := func(check ProbeCheck) {
+		res.OK = res.OK && check.OK
+		res.Checks = append(res.Checks, check)
+	}
+
+	if c.RequireConfig {
+		add(ProbeCheck{
+			Name:   "config",
+			OK:     len(t.pools) > 0,
+			Detail: fmt.Sprintf("%d instances configured.", len(t.pools)),
+		})
+	}
+
+	if c.MinHealthy > 0 {
+		healthy := t.healthy(ctx, c.Timeout)
+		add(ProbeCheck{
+			Name:   "backends",
+			OK:     healthy >= c.MinHealthy,
+			Detail: fmt.Sprintf("%d of %d instances healthy, %d required.", healthy, len(t.pools), c.MinHealthy),
+		})
+	}
+
+	if c.MinMappings > 0 {
+		check := ProbeCheck{Name: "mappings", Detail: "Key mapper cannot enumerate its mappings."}
+		if m, ok := r.mappings(); ok {
+			check.OK = len(m) >= c.MinMappings
+			check.Detail = fmt.Sprintf("%d keys mapped, %d required.", len(m), c.MinMappings)
+		}
+		add(check)
+	}
+
+	return res
+}
+
+// Returns the number of instances that answer PING within the input timeout, or before the context ends.
+func (t *topology) healthy(ctx context.Context, timeout time.Duration) int {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	errs := t.forEach(func(i int, c Conn) error {
+		_, err := doContext(ctx, c, "PING")
+		return err
+	})
+
+	n := 0
+	for _, err := range errs {
+		if err == nil {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,62 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadinessCountsHealthyInstances(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: "PONG"}}, connPool{&nilStyleConn{err: errors.New("down")}})
+	proxy.setTopology(&topology{pools: proxy.Pools})
+
+	res := proxy.Readiness(context.Background(), DefaultReadinessCriteria)
+	if !res.OK || len(res.Checks) != 2 {
+		t.Fatalf("Expected ready with one healthy instance, got %+v", res)
+	}
+
+	res = proxy.Readiness(context.Background(), ProbeCriteria{MinHealthy: 2})
+	if res.OK || res.Checks[0].Detail != "1 of 2 instances healthy, 2 required." {
+		t.Fatalf("Expected unready, got %+v", res)
+	}
+}
+
+func TestLivenessRequiresConfig(t *testing.T) {
+	proxy := getMockProxy()
+	proxy.setTopology(&topology{})
+
+	if res := proxy.Liveness(context.Background(), DefaultLivenessCriteria); res.OK {
+		t.Fatalf("Expected not live without pools, got %+v", res)
+	}
+}
+
+func TestReadinessRequiresMappings(t *testing.T) {
+	pool := connPool{&nilStyleConn{reply: "PONG"}}
+	proxy := getMockProxy(pool)
+	proxy.setTopology(&topology{pools: proxy.Pools})
+
+	crit := ProbeCriteria{MinMappings: 1}
+	if res := proxy.Readiness(context.Background(), crit); res.OK {
+		t.Fatalf("Expected unready without mappings, got %+v", res)
+	}
+
+	proxy.mapKey("KEY", pool)
+	if res := proxy.Readiness(context.Background(), crit); !res.OK {
+		t.Fatalf("Expected ready with mappings, got %+v", res)
+	}
+}
+
+func TestProbeHandlerStatus(t *testing.T) {
+	h := ProbeHandler(func(context.Context) ProbeResult {
+		return ProbeResult{Checks: []ProbeCheck{{Name: "config"}}}
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"name":"config"`) {
+		t.Fatalf("Unexpected response: %d %s", rec.Code, rec.Body.String())
+	}
+}
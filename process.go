@@ -0,0 +1,77 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/txodds/twunproxy/reply"
+	"strings"
+)
+
+// ReplyProcessor transforms the raw reply of a command into a more useful form, such as a map or struct.
+type ReplyProcessor func(reply interface{}) (interface{}, error)
+
+// WithReplyProcessor applies the input processor to every successful reply of the named command returned by Do
+// and DoKeyed. This keeps decoding consistent across an application instead of repeated at every call site.
+// Typed helpers such as BLPop decode replies themselves and are not affected.
+func WithReplyProcessor(name string, p ReplyProcessor) Option {
+	return func(r *ProxyConn) {
+		if r.processors == nil {
+			r.processors = make(map[string]ReplyProcessor)
+		}
+		r.processors[strings.ToUpper(name)] = p
+	}
+}
+
+// Applies the processor registered for the named command to a successful, non-nil reply.
+func (r *ProxyConn) process(name string, v interface{}, err error) (interface{}, error) {
+	if err != nil || v == nil {
+		return v, err
+	}
+
+	if p, ok := r.processors[strings.ToUpper(name)]; ok {
+		return p(v)
+	}
+	return v, nil
+}
+
+// KeyValue is a value popped from a list, with the key of the list, as returned by BLPOP and BRPOP.
+type KeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ReplyStrings decodes an array reply into a []string, as for LRANGE or SMEMBERS.
+func ReplyStrings(v interface{}) (interface{}, error) {
+	return stringsReply("command", v, nil)
+}
+
+// ReplyStringMap decodes a reply of alternating fields and values into a map[string]string, as for HGETALL.
+func ReplyStringMap(v interface{}) (interface{}, error) {
+	pairs, err := pairsReply("command", v, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		m[p[0]] = p[1]
+	}
+	return m, nil
+}
+
+// ReplyKeyValue decodes a two-element array reply into a KeyValue, as for BLPOP.
+func ReplyKeyValue(v interface{}) (interface{}, error) {
+	kv, err := keyValueReply(v)
+	if err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// Decodes a two-element array reply of a key and a value.
+func keyValueReply(v interface{}) (KeyValue, error) {
+	items, err := reply.Strings(v, nil)
+	if err != nil || len(items) != 2 {
+		return KeyValue{}, errors.New("Unexpected reply for key and value.")
+	}
+	return KeyValue{Key: items[0], Value: items[1]}, nil
+}
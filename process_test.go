@@ -0,0 +1,59 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestDoAppliesRegisteredReplyProcessor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("HGETALL", "KEY").Return([]interface{}{[]byte("f1"), []byte("v1"), []byte("f2"), []byte("v2")}, nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+	WithReplyProcessor("hgetall", ReplyStringMap)(proxy)
+
+	v, err := proxy.Do(NewRedisCmd("HGETALL", "KEY"), func(interface{}) bool { return true })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	m, ok := v.(map[string]string)
+	if !ok || len(m) != 2 || m["f1"] != "v1" || m["f2"] != "v2" {
+		t.Fatalf("Unexpected result: %#v", v)
+	}
+}
+
+func TestBLPopIgnoresReplyProcessor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("BLPOP", "KEY", float64(1)).Return([]interface{}{[]byte("KEY"), []byte("VAL")}, nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+	WithReplyProcessor("BLPOP", ReplyKeyValue)(proxy)
+
+	v, err := proxy.BLPop("KEY", time.Second)
+	if err != nil || v != "VAL" {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestReplyKeyValue(t *testing.T) {
+	v, err := ReplyKeyValue([]interface{}{[]byte("KEY"), []byte("VAL")})
+	if err != nil || v != (KeyValue{Key: "KEY", Value: "VAL"}) {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+
+	if _, err := ReplyKeyValue([]interface{}{[]byte("KEY")}); err == nil {
+		t.Fatal("Expected an error for a short reply.")
+	}
+}
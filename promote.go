@@ -0,0 +1,110 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+)
+
+// PromoteOutcome is the outcome of promoting an instance.
+type PromoteOutcome string
+
+const (
+	// PromotePromoted is a replica that was promoted and verified as a master.
+	PromotePromoted PromoteOutcome = "promoted"
+
+	// PromoteAlreadyMaster is an instance that was already a master, so was not sent SLAVEOF NO ONE.
+	PromoteAlreadyMaster PromoteOutcome = "already_master"
+
+	// PromoteFailed is an instance whose role could not be read, or that failed to become a master.
+	PromoteFailed PromoteOutcome = "failed"
+)
+
+// PromoteResult records the outcome of promoting one instance. Name is the name of the instance, as for Instance.
+// Instances not reached because the run stopped early have no outcome.
+type PromoteResult struct {
+	Server  string         `json:"server"`
+	Name    string         `json:"name"`
+	Outcome PromoteOutcome `json:"outcome,omitempty"`
+	Err     error          `json:"-"`
+}
+
+// PromoteVerified promotes each replica instance in turn to master. The role of each instance is read from
+// INFO replication first, so that masters are skipped, and again after "SLAVEOF NO ONE", to verify the change.
+// The outcome on every instance is reported. The timeout of the options bounds the whole promotion of
+// each instance, and if Continue is true, a failed instance does not stop the run.
+// The error is that of the context, or of the instance that stopped the run.
+func (r *ProxyConn) PromoteVerified(ctx context.Context, opts InstanceOptions) ([]PromoteResult, error) {
+	t := r.topology()
+	res := make([]PromoteResult, len(t.pools))
+	for i := range res {
+		res[i].Server = t.server(i)
+		res[i].Name = t.instance(i).Name
+	}
+
+	if err := r.guardAdmin(ctx, "SLAVEOF"); err != nil {
+		return res, err
+	}
+
+	for i, pool := range t.pools {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		ictx, cancel := ctx, context.CancelFunc(func() {})
+		if opts.Timeout > 0 {
+			ictx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		}
+
+		c := pool.Get()
+		res[i].Outcome, res[i].Err = promote(ictx, c)
+		c.Close()
+		cancel()
+
+		if res[i].Err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+		if !opts.Continue {
+			return res, res[i].Err
+		}
+	}
+
+	return res, nil
+}
+
+// Promotes the instance on the input connection unless it is already a master, and verifies its new role.
+func promote(ctx context.Context, c Conn) (PromoteOutcome, error) {
+	role, err := instanceRole(ctx, c)
+	if err != nil {
+		return PromoteFailed, err
+	}
+	if role == "master" {
+		return PromoteAlreadyMaster, nil
+	}
+
+	if _, err := doContext(ctx, c, "SLAVEOF", "NO", "ONE"); err != nil {
+		return PromoteFailed, err
+	}
+
+	if role, err = instanceRole(ctx, c); err != nil {
+		return PromoteFailed, err
+	}
+	if role != "master" {
+		return PromoteFailed, errors.New("Instance has role " + role + " after SLAVEOF NO ONE.")
+	}
+	return PromotePromoted, nil
+}
+
+// Returns the role of the instance on the input connection, from INFO replication.
+func instanceRole(ctx context.Context, c Conn) (string, error) {
+	info, err := infoSection(ctx, c, "replication")
+	if err != nil {
+		return "", err
+	}
+	if info["role"] == "" {
+		return "", errors.New("INFO replication did not report a role.")
+	}
+	return info["role"], nil
+}
@@ -0,0 +1,65 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestPromoteVerifiedReportsEachInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conns := make([]*MockConn, 3)
+	pools := make([]ConnGetter, 3)
+	for i := range pools {
+		conns[i], pools[i] = setupMockPool(ctrl)
+		conns[i].EXPECT().Close()
+	}
+	conns[0].EXPECT().Do("INFO", "replication").Return("role:master\r\n", nil)
+	gomock.InOrder(
+		conns[1].EXPECT().Do("INFO", "replication").Return("role:slave\r\n", nil),
+		conns[1].EXPECT().Do("SLAVEOF", "NO", "ONE").Return("OK", nil),
+		conns[1].EXPECT().Do("INFO", "replication").Return("role:slave\r\n", nil),
+	)
+	gomock.InOrder(
+		conns[2].EXPECT().Do("INFO", "replication").Return("role:slave\r\n", nil),
+		conns[2].EXPECT().Do("SLAVEOF", "NO", "ONE").Return("OK", nil),
+		conns[2].EXPECT().Do("INFO", "replication").Return("role:master\r\n", nil),
+	)
+
+	proxy := getMockProxy(pools...)
+	proxy.Servers = []string{"10.0.0.1:6379:1 a", "10.0.0.2:6379:1 b", "10.0.0.3:6379:1 c"}
+
+	res, err := proxy.PromoteVerified(context.Background(), InstanceOptions{Continue: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []PromoteOutcome{PromoteAlreadyMaster, PromoteFailed, PromotePromoted}
+	for i, p := range res {
+		if p.Outcome != want[i] || p.Name != proxy.topology().instance(i).Name {
+			t.Fatalf("Unexpected result %d: %+v", i, p)
+		}
+	}
+	if res[1].Err == nil {
+		t.Fatal("Expected error for instance that stayed a replica.")
+	}
+}
+
+func TestPromoteVerifiedStopsOnFirstFailureByDefault(t *testing.T) {
+	errTest := errors.New("Connection refused.")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	_, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("INFO", "replication").Return(nil, errTest)
+	mockConn1.EXPECT().Close()
+
+	res, err := getMockProxy(mockPool1, mockPool2).PromoteVerified(context.Background(), InstanceOptions{})
+	if err != errTest || res[0].Outcome != PromoteFailed || res[1].Outcome != "" {
+		t.Fatalf("Unexpected result: %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,140 @@
+package twunproxy
+
+import (
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+/******************************************************
+ * Multiple pools from one Twemproxy configuration.
+ ******************************************************/
+
+// ListPools returns the names of the pools in the Twemproxy configuration file at the input path, in order.
+func ListPools(confPath string) ([]string, error) {
+	f, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pools, err := parsePools(f)
+	if err != nil {
+		return nil, err
+	}
+	return poolNames(pools), nil
+}
+
+// ProxySet is a ProxyConn for each pool of a Twemproxy configuration.
+// Servers appearing in more than one pool with the same address, auth and database share one connection pool.
+type ProxySet struct {
+	names   []string
+	proxies map[string]*ProxyConn
+}
+
+// NewProxySet creates a proxy for every pool in the Twemproxy configuration file at the input path,
+// as NewProxyConn would for each, parsing the file once. Each proxy has its own key mappings with the input
+// initial capacity, and the options are applied to each proxy. Memcached pools are left out of the set.
+// If any proxy cannot be created, an error naming its pool is returned.
+func NewProxySet(confPath string, keyCap int, create CreatePool, opts ...Option) (*ProxySet, error) {
+	f, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pools, err := parsePools(f)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, conf := range pools {
+		if conf.Memcached() {
+			delete(pools, name)
+		}
+	}
+
+	s := &ProxySet{names: poolNames(pools), proxies: make(map[string]*ProxyConn, len(pools))}
+	// Pools selecting different databases of a server cannot be shared.
+	shared := make(map[int]CreatePool)
+	for _, name := range s.names {
+		db := pools[name].DB
+		if shared[db] == nil {
+			shared[db] = sharedPools(create)
+		}
+
+		proxy, err := NewProxyConnFromConfig(pools[name], keyCap, shared[db], opts...)
+		if err != nil {
+			return nil, &PoolError{Pool: name, Err: err}
+		}
+		proxy.poolsShared = true
+		s.proxies[name] = proxy
+	}
+	return s, nil
+}
+
+// Close closes every proxy of the set, then each of the pools they share, returning the first error.
+func (s *ProxySet) Close() error {
+	var pools []ConnGetter
+	for _, name := range s.names {
+		proxy := s.proxies[name]
+		pools = append(pools, proxy.topology().pools...)
+		proxy.Close()
+	}
+	return closePools(pools)
+}
+
+// Names returns the names of the pools in the set, in order.
+func (s *ProxySet) Names() []string {
+	return append([]string(nil), s.names...)
+}
+
+// Pool returns the proxy for the named pool, if it is in the set.
+func (s *ProxySet) Pool(name string) (*ProxyConn, bool) {
+	proxy, ok := s.proxies[name]
+	return proxy, ok
+}
+
+// Returns the names of the input pools, in order.
+func poolNames(pools map[string]PoolConfig) []string {
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns a CreatePool that creates one pool for each server address and auth, and returns it for every
+// server descriptor with the same address and auth, whatever its weight or name.
+func sharedPools(create CreatePool) CreatePool {
+	var mu sync.Mutex
+	pools := make(map[[2]string]ConnGetter)
+
+	return func(desc, auth string) ConnGetter {
+		id := [2]string{ServerAddr(desc), auth}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if p, ok := pools[id]; ok {
+			return p
+		}
+
+		p := create(desc, auth)
+		pools[id] = p
+		return p
+	}
+}
+
+// PoolError is returned by NewProxySet when the proxy for a pool cannot be created.
+type PoolError struct {
+	Pool string
+	Err  error
+}
+
+func (e *PoolError) Error() string {
+	return "Pool " + e.Pool + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error creating the proxy.
+func (e *PoolError) Unwrap() error {
+	return e.Err
+}
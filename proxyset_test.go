@@ -0,0 +1,94 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestListPoolsReturnsSortedNames(t *testing.T) {
+	path := writeConfig(t, "beta:\n  servers:\n   - 10.0.0.2:6379:1\nalpha:\n  servers:\n   - 10.0.0.1:6379:1\n")
+	defer os.Remove(path)
+
+	names, err := ListPools(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"alpha", "beta"}) {
+		t.Fatalf("Unexpected pools: %v", names)
+	}
+}
+
+func TestNewProxySetSharesPoolsForOverlappingServers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("PING").Return("PONG", nil).AnyTimes()
+	mockConn.EXPECT().Close().AnyTimes()
+
+	path := writeConfig(t, "alpha:\n  servers:\n   - 10.0.0.1:6379:1\n   - 10.0.0.2:6379:1\n"+
+		"beta:\n  servers:\n   - 10.0.0.2:6379:2 b2\n   - 10.0.0.3:6379:1\n")
+	defer os.Remove(path)
+
+	var created []string
+	create := func(desc, auth string) ConnGetter {
+		created = append(created, desc)
+		return mockPool
+	}
+
+	set, err := NewProxySet(path, 0, create)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(set.Names(), []string{"alpha", "beta"}) {
+		t.Fatalf("Unexpected pools: %v", set.Names())
+	}
+	if len(created) != 3 {
+		t.Fatalf("Expected 3 connection pools for 3 distinct servers, got %v", created)
+	}
+
+	beta, ok := set.Pool("beta")
+	if !ok || len(beta.Pools) != 2 || beta.topology().server(0) != "10.0.0.2:6379" {
+		t.Fatalf("Unexpected beta proxy: %v", beta)
+	}
+	if _, ok := set.Pool("gamma"); ok {
+		t.Fatal("Expected no proxy for missing pool.")
+	}
+}
+
+func TestNewProxySetNamesFailingPool(t *testing.T) {
+	path := writeConfig(t, "alpha:\n  servers:\n")
+	defer os.Remove(path)
+
+	create := func(desc, auth string) ConnGetter { return nil }
+	_, err := NewProxySet(path, 0, create)
+
+	var poolErr *PoolError
+	if !errors.As(err, &poolErr) || poolErr.Pool != "alpha" || !errors.Is(err, errNoServers) {
+		t.Fatalf("Expected pool error for alpha, got %v", err)
+	}
+}
+
+func TestNewProxySetDoesNotSharePoolsAcrossDatabases(t *testing.T) {
+	path := writeConfig(t, "alpha:\n  servers:\n   - 10.0.0.1:6379:1\n"+
+		"beta:\n  redis_db: 1\n  servers:\n   - 10.0.0.1:6379:1\n")
+	defer os.Remove(path)
+
+	create := func(desc, auth string) ConnGetter {
+		return &selectingPool{ConnGetter: connPool{&nilStyleConn{reply: "PONG"}}}
+	}
+
+	set, err := NewProxySet(path, 0, create)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	alpha, _ := set.Pool("alpha")
+	beta, _ := set.Pool("beta")
+	if alpha.Pools[0] == beta.Pools[0] || beta.Pools[0].(*selectingPool).db != 1 {
+		t.Fatal("Expected a pool of its own for the server in each database.")
+	}
+}
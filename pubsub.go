@@ -0,0 +1,267 @@
+package twunproxy
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// PubSubConn is implemented by connections that support the pub/sub protocol, such as those from redigo.
+// A Subscriber requires every pool to return connections implementing it.
+type PubSubConn interface {
+	Conn
+	Send(commandName string, args ...interface{}) error
+	Flush() error
+	Receive() (reply interface{}, err error)
+}
+
+// DefaultReconnectInterval is the delay before a Subscriber reconnects to an instance, if none is configured.
+const DefaultReconnectInterval = time.Second
+
+// Message is a message received on a subscribed channel. Pattern is set for messages matching a pattern subscription.
+// Server is the address of the instance that delivered it.
+type Message struct {
+	Server  string `json:"server"`
+	Channel string `json:"channel"`
+	Pattern string `json:"pattern,omitempty"`
+	Data    []byte `json:"data"`
+}
+
+// SubscribeConfig configures a Subscriber. Channels are subscribed with SUBSCRIBE and Patterns with PSUBSCRIBE.
+// Buffer is the capacity of the message channel. ReconnectInterval is the delay before reconnecting after an error.
+type SubscribeConfig struct {
+	Channels          []string
+	Patterns          []string
+	Buffer            int
+	ReconnectInterval time.Duration
+}
+
+// Subscriber holds a subscription connection to every instance and merges their messages into one channel.
+// A publisher's key determines the instance it publishes to, which the subscriber cannot know,
+// so channel and pattern subscriptions are both made on every instance.
+// Lost connections are re-established after the reconnect interval and counted as "subscriber_reconnects".
+type Subscriber struct {
+	proxy    *ProxyConn
+	conf     SubscribeConfig
+	messages chan Message
+	stop     chan bool
+	halt     func()
+	wg       sync.WaitGroup
+
+	// Guards the current connection of each instance, which are closed to end blocked receives on Close.
+	mu     sync.Mutex
+	conns  map[int]Conn
+	closed bool
+}
+
+// Publish publishes the input message on the channel and returns the number of clients that received it.
+// If hash routing is enabled, the message is published only on the instance that the hash ring places the channel on;
+// otherwise it is published on every instance and the receiver counts are summed.
+// A Subscriber is subscribed on every instance, so it receives the message either way, but when broadcast it
+// receives a copy from each instance and is counted once per instance.
+// If publishing fails on some instances, the count from the others is returned with the first error.
+func (r *ProxyConn) Publish(channel string, message interface{}) (int64, error) {
+	t := r.topology()
+
+	if r.hashRouting != nil {
+		if i, ok := t.ring.owner(channel); ok {
+			c := t.pools[i].Get()
+			defer c.Close()
+
+			v, err := r.run(c, &RedisCmd{name: "PUBLISH", key: channel, args: []interface{}{message}})
+			if err != nil {
+				return 0, err
+			}
+			n, _ := replyInt(v)
+			return n, nil
+		}
+	}
+
+	if len(t.pools) == 0 {
+		return 0, errNoPools
+	}
+
+	counts := make([]int64, len(t.pools))
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("PUBLISH", channel, message)
+		if err != nil {
+			return err
+		}
+		counts[i], _ = replyInt(v)
+		return nil
+	})
+
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total, firstError(errs)
+}
+
+// Subscribe starts a Subscriber for the input configuration. Call Close on it to unsubscribe.
+func (r *ProxyConn) Subscribe(conf SubscribeConfig) (*Subscriber, error) {
+	if len(conf.Channels) == 0 && len(conf.Patterns) == 0 {
+		return nil, errors.New("No channels or patterns to subscribe to.")
+	}
+	if conf.ReconnectInterval <= 0 {
+		conf.ReconnectInterval = DefaultReconnectInterval
+	}
+
+	s := &Subscriber{
+		proxy:    r,
+		conf:     conf,
+		messages: make(chan Message, conf.Buffer),
+		stop:     make(chan bool),
+		conns:    make(map[int]Conn),
+	}
+	s.halt = r.onClose(s.shutdown)
+
+	t := r.topology()
+	for i := range t.pools {
+		s.wg.Add(1)
+		go s.run(t, i)
+	}
+	return s, nil
+}
+
+// Messages returns the channel on which messages from every instance are delivered.
+// It is closed once the subscriber is closed.
+func (s *Subscriber) Messages() <-chan Message {
+	return s.messages
+}
+
+// Close ends the subscriptions and closes the message channel. Closing the proxy closes its subscribers.
+func (s *Subscriber) Close() error {
+	s.halt()
+	return nil
+}
+
+// Ends the subscriptions and closes the message channel.
+func (s *Subscriber) shutdown() {
+	s.mu.Lock()
+	s.closed = true
+	close(s.stop)
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	close(s.messages)
+}
+
+// Subscribes on the pool at the input index and delivers its messages, reconnecting after errors until closed.
+func (s *Subscriber) run(t *topology, i int) {
+	defer s.wg.Done()
+	server := t.server(i)
+
+	for {
+		err := s.receive(t.pools[i].Get(), i, server)
+
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		if err != nil {
+			s.proxy.counter("subscriber_reconnects", server, 1)
+			s.proxy.log().Warn("Subscriber reconnecting", "server", server, "err", err)
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(s.conf.ReconnectInterval):
+		}
+	}
+}
+
+// Subscribes on the input connection and delivers messages until receiving fails.
+func (s *Subscriber) receive(conn Conn, i int, server string) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	s.conns[i] = conn
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, i)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	c, ok := conn.(PubSubConn)
+	if !ok {
+		return errors.New("Connection does not support pub/sub.")
+	}
+
+	if err := subscribe(c, "SUBSCRIBE", s.conf.Channels); err != nil {
+		return err
+	}
+	if err := subscribe(c, "PSUBSCRIBE", s.conf.Patterns); err != nil {
+		return err
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		v, err := c.Receive()
+		if err != nil {
+			return err
+		}
+
+		m, ok := parseMessage(v)
+		if !ok {
+			continue
+		}
+		m.Server = server
+
+		select {
+		case s.messages <- m:
+		case <-s.stop:
+			return nil
+		}
+	}
+}
+
+// Sends the input subscription command for the input names, if there are any.
+func subscribe(c PubSubConn, cmd string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(names))
+	for i, n := range names {
+		args[i] = n
+	}
+	return c.Send(cmd, args...)
+}
+
+// Parses a "message" or "pmessage" push reply. False is returned for other replies, such as subscription confirmations.
+func parseMessage(v interface{}) (Message, bool) {
+	items, ok := v.([]interface{})
+	if !ok || len(items) < 3 {
+		return Message{}, false
+	}
+
+	kind, _ := replyString(items[0])
+	var m Message
+	switch {
+	case kind == "message" && len(items) == 3:
+		m.Channel, _ = replyString(items[1])
+		m.Data = replyBytes(items[2])
+	case kind == "pmessage" && len(items) == 4:
+		m.Pattern, _ = replyString(items[1])
+		m.Channel, _ = replyString(items[2])
+		m.Data = replyBytes(items[3])
+	default:
+		return Message{}, false
+	}
+	return m, true
+}
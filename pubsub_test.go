@@ -0,0 +1,140 @@
+package twunproxy
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A pub/sub connection fed with replies from a channel. Closing it fails any blocked receive.
+type fakePubSubConn struct {
+	replies chan interface{}
+	mu      sync.Mutex
+	sent    []string
+	closed  chan bool
+	once    sync.Once
+}
+
+func newFakePubSubConn() *fakePubSubConn {
+	return &fakePubSubConn{replies: make(chan interface{}, 10), closed: make(chan bool)}
+}
+
+func (c *fakePubSubConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *fakePubSubConn) Do(string, ...interface{}) (interface{}, error) { return nil, nil }
+
+func (c *fakePubSubConn) Send(cmd string, args ...interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, cmd)
+	return nil
+}
+
+func (c *fakePubSubConn) Flush() error { return nil }
+
+func (c *fakePubSubConn) Receive() (interface{}, error) {
+	select {
+	case v := <-c.replies:
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		return v, nil
+	case <-c.closed:
+		return nil, errors.New("Connection closed.")
+	}
+}
+
+// A pool returning each of its connections in turn, then the last one repeatedly.
+type seqPool struct {
+	mu    sync.Mutex
+	conns []Conn
+}
+
+func (p *seqPool) Get() Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := p.conns[0]
+	if len(p.conns) > 1 {
+		p.conns = p.conns[1:]
+	}
+	return c
+}
+
+func TestSubscriberMergesMessagesAndReconnects(t *testing.T) {
+	c1 := newFakePubSubConn()
+	c2a, c2b := newFakePubSubConn(), newFakePubSubConn()
+
+	proxy := getMockProxy(&seqPool{conns: []Conn{c1}}, &seqPool{conns: []Conn{c2a, c2b}})
+	proxy.Servers = []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}
+
+	s, err := proxy.Subscribe(SubscribeConfig{
+		Channels:          []string{"news"},
+		Patterns:          []string{"events.*"},
+		ReconnectInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c1.replies <- []interface{}{[]byte("subscribe"), []byte("news"), int64(1)}
+	c1.replies <- []interface{}{[]byte("message"), []byte("news"), []byte("hello")}
+	c2a.replies <- errors.New("Connection reset.")
+	c2b.replies <- []interface{}{[]byte("pmessage"), []byte("events.*"), []byte("events.a"), []byte("world")}
+
+	got := make(map[string]Message)
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-s.Messages():
+			got[m.Server] = m
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for messages.")
+		}
+	}
+
+	if m := got["10.0.0.1:6379"]; m.Channel != "news" || string(m.Data) != "hello" {
+		t.Fatalf("Unexpected message: %+v", m)
+	}
+	if m := got["10.0.0.2:6379"]; m.Pattern != "events.*" || m.Channel != "events.a" || string(m.Data) != "world" {
+		t.Fatalf("Unexpected message: %+v", m)
+	}
+
+	s.Close()
+	if _, ok := <-s.Messages(); ok {
+		t.Fatal("Expected message channel to be closed.")
+	}
+
+	c2b.mu.Lock()
+	defer c2b.mu.Unlock()
+	if len(c2b.sent) != 2 || c2b.sent[0] != "SUBSCRIBE" || c2b.sent[1] != "PSUBSCRIBE" {
+		t.Fatalf("Expected subscriptions to be renewed on reconnect, got %v", c2b.sent)
+	}
+}
+
+func TestPublishBroadcastsWithoutHashRouting(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: int64(1)}}, connPool{&nilStyleConn{reply: int64(2)}})
+
+	n, err := proxy.Publish("chan", "msg")
+	if err != nil || n != 3 {
+		t.Fatalf("Expected summed receivers, got %d, %v", n, err)
+	}
+}
+
+func TestPublishRoutesToRingOwner(t *testing.T) {
+	servers := []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}
+	pools := []ConnGetter{connPool{&nilStyleConn{reply: int64(1)}}, connPool{&nilStyleConn{reply: int64(2)}}}
+
+	proxy := getMockProxy(pools...)
+	ring, _ := newHashRing(servers, "fnv1a_64", "ketama", "")
+	proxy.setTopology(&topology{pools: pools, servers: servers, ring: ring})
+	WithHashRouting(false)(proxy)
+
+	owner, _ := ring.owner("chan")
+	n, err := proxy.Publish("chan", "msg")
+	if err != nil || n != int64(owner+1) {
+		t.Fatalf("Expected receivers from instance %d, got %d, %v", owner, n, err)
+	}
+}
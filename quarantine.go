@@ -0,0 +1,220 @@
+package twunproxy
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultHealthCheckInterval is the interval between health checks if none is configured.
+const DefaultHealthCheckInterval = 5 * time.Second
+
+// HealthCheck configures a HealthMonitor. Each interval every pool is sent a PING, which fails if it takes longer
+// than Timeout, if set. A pool is quarantined after FailureLimit consecutive failures, 1 if unset, and re-admitted
+// when it next answers. OnChange, if not nil, is called with the server address when a pool is quarantined
+// or re-admitted.
+type HealthCheck struct {
+	Interval     time.Duration
+	Timeout      time.Duration
+	FailureLimit int
+	OnChange     func(server string, down bool)
+}
+
+// HealthMonitor quarantines pools that fail their health checks. Quarantined pools are left out of discovery,
+// so commands for unmapped keys neither wait on nor error because of a dead instance.
+type HealthMonitor struct {
+	proxy *ProxyConn
+	conf  HealthCheck
+	stop  chan bool
+
+	mu       sync.Mutex
+	failures map[ConnGetter]int
+	down     map[ConnGetter]bool
+}
+
+// MonitorHealth starts checking the health of every pool in the background until the monitor is stopped or the proxy is closed.
+// It replaces any monitor already running on the proxy, which is stopped.
+func (r *ProxyConn) MonitorHealth(conf HealthCheck) *HealthMonitor {
+	m := newHealthMonitor(r, conf)
+	r.installHealthMonitor(m)
+	go m.run()
+	return m
+}
+
+// Creates a health monitor for the input proxy without starting it.
+func newHealthMonitor(r *ProxyConn, conf HealthCheck) *HealthMonitor {
+	if conf.Interval <= 0 {
+		conf.Interval = DefaultHealthCheckInterval
+	}
+	if conf.FailureLimit <= 0 {
+		conf.FailureLimit = 1
+	}
+	return &HealthMonitor{
+		proxy:    r,
+		conf:     conf,
+		stop:     make(chan bool),
+		failures: make(map[ConnGetter]int),
+		down:     make(map[ConnGetter]bool),
+	}
+}
+
+// Makes the input monitor the proxy's, stopping any previous one. The monitor is stopped at once if the proxy is closed.
+func (r *ProxyConn) installHealthMonitor(m *HealthMonitor) {
+	r.mu.Lock()
+	prev := r.health
+	r.health = m
+	closed := r.closed
+	r.mu.Unlock()
+
+	if prev != nil {
+		prev.Stop()
+	}
+	if closed {
+		m.Stop()
+	}
+}
+
+// Stop stops the health checks and re-admits every quarantined pool.
+func (m *HealthMonitor) Stop() {
+	r := m.proxy
+	r.mu.Lock()
+	if r.health == m {
+		r.health = nil
+	}
+	r.mu.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	m.down = make(map[ConnGetter]bool)
+}
+
+// Down returns the addresses of the instances currently quarantined, in order.
+func (m *HealthMonitor) Down() []string {
+	t := m.proxy.topology()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var servers []string
+	for pool := range m.down {
+		if s := t.serverOf(pool); s != "" {
+			servers = append(servers, s)
+		}
+	}
+	sort.Strings(servers)
+	return servers
+}
+
+// Indicates whether the input pool is quarantined by the proxy's health monitor, if it has one.
+func (r *ProxyConn) quarantined(pool ConnGetter) bool {
+	r.mu.Lock()
+	m := r.health
+	r.mu.Unlock()
+	if m == nil {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.down[pool]
+}
+
+// Checks immediately and then at the configured interval until stopped.
+func (m *HealthMonitor) run() {
+	t := time.NewTicker(m.conf.Interval)
+	defer t.Stop()
+
+	m.check()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-t.C:
+			m.check()
+		}
+	}
+}
+
+// Sends a PING to every pool and quarantines or re-admits each according to the outcome.
+func (m *HealthMonitor) check() {
+	ctx := context.Background()
+	if m.conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.conf.Timeout)
+		defer cancel()
+	}
+
+	t := m.proxy.topology()
+	errs := t.forEach(func(i int, c Conn) error {
+		_, err := doContext(ctx, c, "PING")
+		return err
+	})
+
+	for i, err := range errs {
+		m.record(t.pools[i], t.server(i), err)
+	}
+
+	// Each instance is published as healthy (1) or quarantined (0).
+	down := m.Down()
+	for i := range t.pools {
+		healthy := 1.0
+		if containsString(down, t.server(i)) {
+			healthy = 0
+		}
+		m.proxy.gauge("instance_healthy", t.server(i), healthy)
+	}
+	m.proxy.gauge("quarantined_instances", "", float64(len(down)))
+}
+
+// Records the outcome of a health check of the input pool.
+func (m *HealthMonitor) record(pool ConnGetter, server string, err error) {
+	m.mu.Lock()
+	select {
+	case <-m.stop:
+		m.mu.Unlock()
+		return
+	default:
+	}
+
+	wasDown := m.down[pool]
+	if err == nil {
+		delete(m.failures, pool)
+		delete(m.down, pool)
+	} else {
+		m.failures[pool]++
+		if m.failures[pool] >= m.conf.FailureLimit {
+			m.down[pool] = true
+		}
+	}
+	isDown := m.down[pool]
+	m.mu.Unlock()
+
+	if wasDown == isDown {
+		return
+	}
+	if isDown {
+		m.proxy.counter("quarantines", server, 1)
+		m.proxy.log().Warn("Instance quarantined", "server", server, "err", err)
+	} else {
+		m.proxy.log().Info("Instance re-admitted", "server", server)
+	}
+	if m.conf.OnChange != nil {
+		m.conf.OnChange(server, isDown)
+	}
+}
+
+// Marks the pools at the input indices of the topology as quarantined before the monitor starts.
+func (m *HealthMonitor) quarantine(t *topology, idxs []int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, i := range idxs {
+		m.down[t.pools[i]] = true
+		m.failures[t.pools[i]] = m.conf.FailureLimit
+	}
+}
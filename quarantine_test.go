@@ -0,0 +1,75 @@
+package twunproxy
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHealthMonitorQuarantinesAndReadmitsPools(t *testing.T) {
+	flaky := &flakyConn{down: true}
+	proxy := getMockProxy(connPool{flaky}, connPool{&nilStyleConn{}})
+
+	changes := make(chan bool, 2)
+	m := proxy.MonitorHealth(HealthCheck{
+		Interval: 20 * time.Millisecond,
+		OnChange: func(server string, down bool) { changes <- down },
+	})
+	defer m.Stop()
+
+	if down := <-changes; !down {
+		t.Fatal("Expected the failing pool to be quarantined.")
+	}
+	if servers := m.Down(); len(servers) != 1 || servers[0] != "0" {
+		t.Fatalf("Unexpected quarantined servers: %v", servers)
+	}
+	if idxs := proxy.liveIndexes(proxy.topology()); len(idxs) != 1 || idxs[0] != 1 {
+		t.Fatalf("Expected discovery to leave out the quarantined pool, got %v", idxs)
+	}
+
+	flaky.set(false)
+	select {
+	case down := <-changes:
+		if down {
+			t.Fatal("Expected the pool to be re-admitted.")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the pool to be re-admitted once it answers.")
+	}
+	if len(m.Down()) != 0 {
+		t.Fatalf("Unexpected quarantined servers: %v", m.Down())
+	}
+}
+
+func TestQuarantineStartupInstallsEveryPool(t *testing.T) {
+	path := writeConfig(t, "alpha:\n  servers:\n   - 10.0.0.1:6379:1\n   - 10.0.0.2:6379:1\n")
+	defer os.Remove(path)
+
+	flaky := &flakyConn{down: true}
+	create := func(desc, auth string) ConnGetter {
+		if desc == "10.0.0.1:6379:1" {
+			return connPool{flaky}
+		}
+		return connPool{&nilStyleConn{}}
+	}
+
+	var events []StartupEvent
+	policy := StartupPolicy{
+		Mode:          StartupQuarantine,
+		RetryInterval: time.Hour,
+		OnEvent:       func(e StartupEvent) { events = append(events, e) },
+	}
+
+	proxy, err := NewProxyConn(path, "alpha", 0, create, WithStartupPolicy(policy))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer proxy.health.Stop()
+
+	if len(proxy.topology().pools) != 2 || len(events) != 1 || events[0].Err == nil {
+		t.Fatalf("Unexpected startup: %d pools, events %+v", len(proxy.topology().pools), events)
+	}
+	if !proxy.quarantined(proxy.Pools[0]) || proxy.quarantined(proxy.Pools[1]) {
+		t.Fatal("Expected only the failing pool to be quarantined.")
+	}
+}
@@ -0,0 +1,117 @@
+package twunproxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// The interval at which instances are pinged while waiting for recovery from an outage.
+var recoveryPollInterval = 100 * time.Millisecond
+
+// OutageQueue holds commands issued while every instance is unavailable, so that they can be replayed on recovery.
+// The number of waiting commands is bounded by maxSize and the time each may wait by maxAge.
+type outageQueue struct {
+	maxSize int
+	maxAge  time.Duration
+
+	mu        sync.Mutex
+	waiting   int
+	watching  bool
+	recovered chan bool
+}
+
+// WithOutageQueue makes Do absorb brief outages of every instance rather than failing immediately.
+// Up to maxSize commands wait for at least one instance to answer a PING again, and are then replayed.
+// A command that has waited for maxAge since it was issued fails with its original error.
+// Commands issued while the queue is full fail immediately.
+func WithOutageQueue(maxSize int, maxAge time.Duration) Option {
+	return func(r *ProxyConn) {
+		r.queue = &outageQueue{maxSize: maxSize, maxAge: maxAge, recovered: make(chan bool)}
+	}
+}
+
+// Blocks until the proxy recovers from an outage or the command issued at the input time has waited for too long.
+func (q *outageQueue) wait(r *ProxyConn, issued time.Time) error {
+	q.mu.Lock()
+	if q.waiting >= q.maxSize {
+		q.mu.Unlock()
+		return errors.New("Outage queue is full.")
+	}
+
+	q.waiting++
+	recovered := q.recovered
+	if !q.watching {
+		q.watching = true
+		go q.watch(r)
+	}
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		q.waiting--
+		q.mu.Unlock()
+	}()
+
+	select {
+	case <-recovered:
+		return nil
+	case <-time.After(q.maxAge - time.Since(issued)):
+		return errors.New("Timed out waiting for recovery.")
+	}
+}
+
+// Pings every instance until one answers, then releases all waiting commands.
+// Watching stops early if there are no longer any commands waiting.
+func (q *outageQueue) watch(r *ProxyConn) {
+	for {
+		time.Sleep(recoveryPollInterval)
+		alive := r.anyAlive()
+
+		q.mu.Lock()
+		if alive || q.waiting == 0 {
+			if alive {
+				close(q.recovered)
+				q.recovered = make(chan bool)
+			}
+			q.watching = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+	}
+}
+
+// Indicates whether the input error from a command means that no instance is currently available to route it to.
+// A connection error from a mapped instance qualifies; a discovery failure only does if no instance answers a PING.
+func (r *ProxyConn) isOutage(err error) bool {
+	if isUnavailable(err) {
+		return true
+	}
+	return err == ErrNoMapping && !r.anyAlive()
+}
+
+// Indicates whether at least one instance answers a PING.
+func (r *ProxyConn) anyAlive() bool {
+	for _, err := range r.topology().forEach(func(_ int, c Conn) error {
+		_, err := c.Do("PING")
+		return err
+	}) {
+		if err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Indicates whether the input error is a network failure rather than an error reply from Redis.
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var ne net.Error
+	return errors.As(err, &ne) || err == io.EOF || err == io.ErrUnexpectedEOF
+}
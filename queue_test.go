@@ -0,0 +1,55 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestOutageQueueReplaysCommandOnRecovery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recoveryPollInterval = time.Millisecond
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	gomock.InOrder(
+		mockConn.EXPECT().Do("CMD", "KEY", "A1", "A2").Return(nil, io.EOF),
+		mockConn.EXPECT().Do("PING").Return("PONG", nil),
+		mockConn.EXPECT().Do("CMD", "KEY", "A1", "A2").Return(true, nil),
+	)
+	mockConn.EXPECT().Close().Times(3)
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+	WithOutageQueue(10, time.Second)(proxy)
+
+	v, err := proxy.Do(getRedisCmd(), func(v interface{}) bool { return true })
+	if err != nil || v != true {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestOutageQueueFailsImmediatelyWhenFull(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("CMD", "KEY", "A1", "A2").Return(nil, io.EOF)
+	mockConn.EXPECT().Close()
+
+	ch := make(chan DeadLetter, 1)
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+	WithOutageQueue(0, time.Second)(proxy)
+	WithDeadLetter(DeadLetterChan(ch))(proxy)
+
+	if _, err := proxy.Do(getRedisCmd(), func(v interface{}) bool { return true }); err != io.EOF {
+		t.Fatalf("Expected original error, got: %v", err)
+	}
+
+	if len(ch) != 1 {
+		t.Fatal("Expected dead letter for unavailable instance.")
+	}
+}
@@ -0,0 +1,127 @@
+package twunproxy
+
+import (
+	"errors"
+	"strconv"
+)
+
+/******************************************************
+ * Random member commands, routed to the instance holding the key.
+ * A negative count allows the same member to be returned more than once, as in Redis.
+ ******************************************************/
+
+// FieldValue is a hash field with its value.
+type FieldValue struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// ScoredMember is a sorted set member with its score.
+type ScoredMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// HRandField returns up to count random fields from the hash at key.
+func (r *ProxyConn) HRandField(key string, count int) ([]string, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "HRANDFIELD", key: key, args: []interface{}{count}}, false)
+	return stringsReply("HRANDFIELD", v, err)
+}
+
+// HRandFieldWithValues returns up to count random fields from the hash at key, with their values.
+func (r *ProxyConn) HRandFieldWithValues(key string, count int) ([]FieldValue, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "HRANDFIELD", key: key, args: []interface{}{count, "WITHVALUES"}}, false)
+	pairs, err := pairsReply("HRANDFIELD", v, err)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]FieldValue, len(pairs))
+	for i, p := range pairs {
+		res[i] = FieldValue{Field: p[0], Value: p[1]}
+	}
+	return res, nil
+}
+
+// SRandMember returns up to count random members from the set at key.
+func (r *ProxyConn) SRandMember(key string, count int) ([]string, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "SRANDMEMBER", key: key, args: []interface{}{count}}, false)
+	return stringsReply("SRANDMEMBER", v, err)
+}
+
+// ZRandMember returns up to count random members from the sorted set at key.
+func (r *ProxyConn) ZRandMember(key string, count int) ([]string, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "ZRANDMEMBER", key: key, args: []interface{}{count}}, false)
+	return stringsReply("ZRANDMEMBER", v, err)
+}
+
+// ZRandMemberWithScores returns up to count random members from the sorted set at key, with their scores.
+func (r *ProxyConn) ZRandMemberWithScores(key string, count int) ([]ScoredMember, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "ZRANDMEMBER", key: key, args: []interface{}{count, "WITHSCORES"}}, false)
+	pairs, err := pairsReply("ZRANDMEMBER", v, err)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]ScoredMember, len(pairs))
+	for i, p := range pairs {
+		score, err := strconv.ParseFloat(p[1], 64)
+		if err != nil {
+			return nil, errors.New("Unexpected score in reply to ZRANDMEMBER.")
+		}
+		res[i] = ScoredMember{Member: p[0], Score: score}
+	}
+	return res, nil
+}
+
+// Converts an array reply of the named command to strings.
+func stringsReply(name string, v interface{}, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("Unexpected reply to " + name + ".")
+	}
+
+	res := make([]string, len(items))
+	for i, item := range items {
+		if res[i], ok = replyString(item); !ok {
+			return nil, errors.New("Unexpected reply to " + name + ".")
+		}
+	}
+	return res, nil
+}
+
+// Converts an array reply of the named command holding pairs to string pairs.
+// Pairs may be flattened, as in RESP2, or nested, as in RESP3. Numeric values are formatted.
+func pairsReply(name string, v interface{}, err error) ([][2]string, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("Unexpected reply to " + name + ".")
+	}
+
+	var flat []interface{}
+	for _, item := range items {
+		if pair, ok := item.([]interface{}); ok {
+			flat = append(flat, pair...)
+		} else {
+			flat = append(flat, item)
+		}
+	}
+
+	if len(flat)%2 != 0 {
+		return nil, errors.New("Unexpected reply to " + name + ".")
+	}
+
+	res := make([][2]string, len(flat)/2)
+	for i := range res {
+		res[i] = [2]string{formatReply(flat[2*i]), formatReply(flat[2*i+1])}
+	}
+	return res, nil
+}
@@ -0,0 +1,66 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestZRandMemberWithScoresDecodesFlatAndNestedPairs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	gomock.InOrder(
+		mockConn.EXPECT().Do("ZRANDMEMBER", "KEY", 2, "WITHSCORES").
+			Return([]interface{}{[]byte("a"), []byte("1.5"), []byte("b"), []byte("2")}, nil),
+		mockConn.EXPECT().Do("ZRANDMEMBER", "KEY", 2, "WITHSCORES").
+			Return([]interface{}{[]interface{}{[]byte("a"), 1.5}, []interface{}{[]byte("b"), 2.0}}, nil),
+	)
+	mockConn.EXPECT().Close().Times(2)
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	for i := 0; i < 2; i++ {
+		res, err := proxy.ZRandMemberWithScores("KEY", 2)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(res) != 2 || res[0] != (ScoredMember{"a", 1.5}) || res[1] != (ScoredMember{"b", 2}) {
+			t.Fatalf("Unexpected result: %+v", res)
+		}
+	}
+}
+
+func TestHRandFieldWithValues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("HRANDFIELD", "KEY", -1, "WITHVALUES").Return([]interface{}{[]byte("f"), []byte("v")}, nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	res, err := proxy.HRandFieldWithValues("KEY", -1)
+	if err != nil || len(res) != 1 || res[0] != (FieldValue{"f", "v"}) {
+		t.Fatalf("Unexpected result: %+v, %v", res, err)
+	}
+}
+
+func TestSRandMember(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("SRANDMEMBER", "KEY", 3).Return([]interface{}{[]byte("a"), []byte("b")}, nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	if res, err := proxy.SRandMember("KEY", 3); err != nil || len(res) != 2 || res[1] != "b" {
+		t.Fatalf("Unexpected result: %v, %v", res, err)
+	}
+}
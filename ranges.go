@@ -0,0 +1,119 @@
+package twunproxy
+
+import (
+	"errors"
+	"fmt"
+)
+
+/******************************************************
+ * Partial string operations, routed to the instance holding the key.
+ ******************************************************/
+
+// DefaultMaxValueSize is the largest string value that writes may produce unless WithMaxValueSize is given.
+// It matches the default proto-max-bulk-len of Redis.
+const DefaultMaxValueSize = 512 << 20
+
+// ValueSizeError is returned when a write would grow a string beyond the maximum value size.
+// The write is not sent to the instance.
+type ValueSizeError struct {
+	Key  string
+	Size int64
+	Max  int64
+}
+
+func (e *ValueSizeError) Error() string {
+	return fmt.Sprintf("Value of %s would grow to %d bytes, exceeding the maximum of %d.", e.Key, e.Size, e.Max)
+}
+
+// WithMaxValueSize sets the largest string value, in bytes, that SetRange and Append may produce.
+// Keep this below the limits of Twemproxy's mbufs and of the backend, which otherwise fail such writes unpredictably.
+func WithMaxValueSize(n int64) Option {
+	return func(r *ProxyConn) {
+		r.maxValueSize = n
+	}
+}
+
+// SetRange overwrites part of the string at key starting at the input offset, returning the new length.
+// Writes that would grow the string beyond the maximum value size are rejected with a ValueSizeError.
+func (r *ProxyConn) SetRange(key string, offset int64, value string) (int64, error) {
+	if offset < 0 {
+		return 0, errors.New("Offset must not be negative.")
+	}
+
+	if err := r.guardValueSize(key, func(size int64) int64 {
+		if end := offset + int64(len(value)); end > size {
+			return end
+		}
+		return size
+	}); err != nil {
+		return 0, err
+	}
+
+	v, err := r.doKeyed(&RedisCmd{name: "SETRANGE", key: key, args: []interface{}{offset, value}}, true)
+	return intReply("SETRANGE", v, err)
+}
+
+// GetRange returns the substring of the string at key between the input offsets, which are inclusive.
+// Negative offsets count back from the end of the string.
+func (r *ProxyConn) GetRange(key string, start, end int64) (string, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "GETRANGE", key: key, args: []interface{}{start, end}}, false)
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := replyString(v)
+	if !ok {
+		return "", errors.New("Unexpected reply to GETRANGE.")
+	}
+	return s, nil
+}
+
+// Append appends the input value to the string at key, creating it if needed, and returns the new length.
+// Writes that would grow the string beyond the maximum value size are rejected with a ValueSizeError.
+func (r *ProxyConn) Append(key, value string) (int64, error) {
+	if err := r.guardValueSize(key, func(size int64) int64 {
+		return size + int64(len(value))
+	}); err != nil {
+		return 0, err
+	}
+
+	v, err := r.doKeyed(&RedisCmd{name: "APPEND", key: key, args: []interface{}{value}}, true)
+	return intReply("APPEND", v, err)
+}
+
+// Checks the size that the string at key would grow to, given its current length, against the maximum value size.
+// Writes that exceed the maximum by themselves are rejected without querying the current length.
+func (r *ProxyConn) guardValueSize(key string, grow func(size int64) int64) error {
+	max := r.maxValueSize
+	if max <= 0 {
+		max = DefaultMaxValueSize
+	}
+
+	if size := grow(0); size > max {
+		return &ValueSizeError{Key: key, Size: size, Max: max}
+	}
+
+	v, err := r.doKeyed(&RedisCmd{name: "STRLEN", key: key}, false)
+	if err != nil {
+		return err
+	}
+
+	cur, _ := replyInt(v)
+	if size := grow(cur); size > max {
+		return &ValueSizeError{Key: key, Size: size, Max: max}
+	}
+	return nil
+}
+
+// Converts the integer reply of the named command.
+func intReply(name string, v interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := replyInt(v)
+	if !ok {
+		return 0, errors.New("Unexpected reply to " + name + ".")
+	}
+	return n, nil
+}
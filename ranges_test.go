@@ -0,0 +1,63 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestAppendWithinSizeGuard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("STRLEN", "KEY").Return(int64(5), nil)
+	mockConn.EXPECT().Do("APPEND", "KEY", "abc").Return(int64(8), nil)
+	mockConn.EXPECT().Close().Times(2)
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+	WithMaxValueSize(8)(proxy)
+
+	if n, err := proxy.Append("KEY", "abc"); err != nil || n != 8 {
+		t.Fatalf("Unexpected result: %d, %v", n, err)
+	}
+}
+
+func TestAppendRejectedBySizeGuard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("STRLEN", "KEY").Return(int64(9), nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+	WithMaxValueSize(10)(proxy)
+
+	_, err := proxy.Append("KEY", "abc")
+	if e, ok := err.(*ValueSizeError); !ok || e.Size != 12 || e.Max != 10 {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Writes beyond the maximum by themselves are rejected without a round trip.
+	if _, err := proxy.SetRange("KEY", 8, "abc"); err == nil {
+		t.Fatal("Expected error for oversized write.")
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("GETRANGE", "KEY", int64(0), int64(-1)).Return([]byte("value"), nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	if s, err := proxy.GetRange("KEY", 0, -1); err != nil || s != "value" {
+		t.Fatalf("Unexpected result: %s, %v", s, err)
+	}
+}
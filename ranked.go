@@ -0,0 +1,114 @@
+package twunproxy
+
+import (
+	"context"
+	"time"
+)
+
+// The head start of the most likely instance under RankedProbe, if none is set.
+const defaultRankedHeadStart = 2 * time.Millisecond
+
+// RankedProbe runs the command first on the instance most likely to hold the key, and on the rest only if that
+// instance rejects the command or has not replied within the head start. For workloads whose keys are mostly found
+// on the same instances, most discoveries then use one connection rather than one on every instance, at the cost of
+// up to the head start for keys found elsewhere.
+//
+// The most likely instance is, in order of preference: the one answering the majority of discoveries for the prefix
+// of the key, as learnt by WithAdaptiveDiscovery; the one answering the majority of all discoveries since the stats
+// were last reset; and the one that the hash ring places the key on. Without any of these, every instance is probed
+// at once, as for ProbeAll. Discoveries answered by the most likely instance within its head start are counted as
+// "ranked_probe_hits". Blocking commands wait for their full timeout on the most likely instance, so pair it with
+// WithBlockingPreProbe.
+type RankedProbe struct {
+	HeadStart time.Duration
+}
+
+func (p RankedProbe) Discover(d *Discovery) DiscoveryResult {
+	r, t := d.r, d.t
+	first, ok := r.mostLikely(t, d.idxs, d.cmd.key)
+	if !ok || len(d.idxs) == 1 {
+		return d.result(d.probe(d.idxs))
+	}
+
+	headStart := p.HeadStart
+	if headStart <= 0 {
+		headStart = defaultRankedHeadStart
+	}
+
+	// Once a probe is accepted, the other is cancelled. Both are waited for, so that a losing probe cannot map the key
+	// after the winner.
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	results := make(chan redisReturn, 2)
+	probe := func(idxs []int) {
+		results <- r.discover(ctx, t, idxs, d.cmd, d.canMap)
+	}
+	go probe([]int{first})
+
+	timer := time.NewTimer(headStart)
+	defer timer.Stop()
+
+	res := redisReturn{val: nil, err: ErrNoMapping, pool: -1}
+	pending, fannedOut := 1, false
+	fanOut := func() {
+		fannedOut = true
+		pending++
+		go probe(without(d.idxs, first))
+	}
+
+	for pending > 0 {
+		select {
+		case rr := <-results:
+			pending--
+			if res.pool < 0 {
+				res = rr
+			}
+			if res.pool >= 0 {
+				cancel()
+			} else if !fannedOut {
+				fanOut()
+			}
+		case <-timer.C:
+			if !fannedOut && res.pool < 0 {
+				fanOut()
+			}
+		}
+	}
+
+	if res.pool < 0 {
+		return d.result(res)
+	}
+	if !d.cmd.noCache {
+		r.mapKey(d.cmd.key, t.pools[res.pool])
+	}
+	if res.pool == first && !fannedOut {
+		r.counter("ranked_probe_hits", t.server(first), 1)
+	}
+	return d.result(res)
+}
+
+// Returns the index of the instance most likely to hold the input key among those at the input indices,
+// as described for RankedProbe. False is returned if there is no likely instance.
+func (r *ProxyConn) mostLikely(t *topology, idxs []int, key string) (int, bool) {
+	if i, ok := r.adaptive.likely(key, t); ok && containsIndex(idxs, i) {
+		return i, true
+	}
+
+	total, best, leader := 0.0, 0.0, ""
+	for server, n := range r.stats.counter("discoveries") {
+		total += n
+		if n > best {
+			best, leader = n, server
+		}
+	}
+	if best*2 > total {
+		if i, err := t.index(leader); err == nil && containsIndex(idxs, i) {
+			return i, true
+		}
+	}
+
+	if i, ok := t.ring.owner(key); ok && containsIndex(idxs, i) {
+		return i, true
+	}
+	return -1, false
+}
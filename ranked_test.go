@@ -0,0 +1,82 @@
+package twunproxy
+
+import (
+	"testing"
+	"time"
+)
+
+// Returns a proxy over the input pools whose hash ring places keys, and the index of the owner of "KEY".
+func getRankedProxy(pools ...ConnGetter) (*ProxyConn, int) {
+	proxy := getMockProxy(pools...)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	proxy.ring, _ = newHashRing(proxy.Servers, "fnv1a_32", "modula", "")
+	WithDiscoveryStrategy(RankedProbe{HeadStart: time.Second})(proxy)
+	owner, _ := proxy.ring.owner("KEY")
+	return proxy, owner
+}
+
+func TestRankedProbeProbesOwnerAlone(t *testing.T) {
+	var calls [2]int32
+	proxy, owner := getRankedProxy(connPool{slowConn{calls: &calls[0]}}, connPool{slowConn{calls: &calls[1]}})
+	proxy.Pools[owner] = connPool{slowConn{reply: "VALUE", calls: &calls[owner]}}
+
+	canMap := func(v interface{}) bool { return v != nil }
+	if v, err := proxy.Do(NewRedisCmd("GET", "KEY"), canMap); err != nil || v != "VALUE" {
+		t.Fatalf("Expected the value, got %v, %v", v, err)
+	}
+	if calls[1-owner] != 0 {
+		t.Fatal("Expected the other instance not to be probed.")
+	}
+	if n := proxy.SnapshotStats().Counters["ranked_probe_hits"][proxy.topology().server(owner)]; n != 1 {
+		t.Fatalf("Expected a ranked probe hit, got %v", n)
+	}
+}
+
+func TestRankedProbeFansOutWhenOwnerRejects(t *testing.T) {
+	var calls [2]int32
+	proxy, owner := getRankedProxy(connPool{slowConn{calls: &calls[0]}}, connPool{slowConn{calls: &calls[1]}})
+	holder := connPool{slowConn{reply: "VALUE", calls: &calls[1-owner]}}
+	proxy.Pools[1-owner] = holder
+
+	canMap := func(v interface{}) bool { return v != nil }
+	if v, err := proxy.Do(NewRedisCmd("GET", "KEY"), canMap); err != nil || v != "VALUE" {
+		t.Fatalf("Expected the value, got %v, %v", v, err)
+	}
+	if pool, _ := proxy.lookup("KEY"); pool != holder {
+		t.Fatal("Expected the key to be mapped to the instance holding it.")
+	}
+}
+
+func TestRankedProbeFansOutAfterHeadStart(t *testing.T) {
+	var calls int32
+	slow := newBlockingConn(nil)
+	proxy, owner := getRankedProxy(connPool{slow}, connPool{slow})
+	proxy.Pools[1-owner] = connPool{slowConn{reply: "VALUE", calls: &calls}}
+	WithDiscoveryStrategy(RankedProbe{HeadStart: 10 * time.Millisecond})(proxy)
+
+	canMap := func(v interface{}) bool { return v != nil }
+	if v, err := proxy.Do(NewRedisCmd("GET", "KEY"), canMap); err != nil || v != "VALUE" {
+		t.Fatalf("Expected the value, got %v, %v", v, err)
+	}
+	select {
+	case <-slow.aborted:
+	default:
+		t.Fatal("Expected the probe of the slow instance to be aborted.")
+	}
+}
+
+func TestMostLikelyPrefersMajorityOfDiscoveries(t *testing.T) {
+	proxy, owner := getRankedProxy(connPool{&nilStyleConn{}}, connPool{&nilStyleConn{}})
+	t1 := proxy.topology()
+	idxs := []int{0, 1}
+
+	if i, ok := proxy.mostLikely(t1, idxs, "KEY"); !ok || i != owner {
+		t.Fatalf("Expected the owner without history, got %d", i)
+	}
+
+	proxy.stats.add("discoveries", t1.server(1-owner), 3)
+	proxy.stats.add("discoveries", t1.server(owner), 1)
+	if i, ok := proxy.mostLikely(t1, idxs, "KEY"); !ok || i != 1-owner {
+		t.Fatalf("Expected the instance answering most discoveries, got %d", i)
+	}
+}
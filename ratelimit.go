@@ -0,0 +1,142 @@
+package twunproxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit limits the discovery probes and broadcasts sent to an instance with a token bucket,
+// which refills at PerSecond tokens a second up to Burst tokens. Each probe or broadcast command takes a token,
+// waiting for one if the bucket is empty. A PerSecond of zero leaves the instance unlimited,
+// and a Burst below 1 is taken as 1.
+type RateLimit struct {
+	PerSecond float64 `json:"per_second"`
+	Burst     int     `json:"burst"`
+}
+
+// Holds the rate limits of the instances, by server address, and their token buckets.
+// The zero value is ready for use, and limits nothing.
+type rateLimiter struct {
+	mu      sync.Mutex
+	def     RateLimit
+	limits  map[string]RateLimit
+	buckets map[string]*tokenBucket
+}
+
+// Tokens available in the bucket of one instance, as of the last time they were taken.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// WithRateLimit limits the discovery probes and broadcasts sent to each instance, so that a burst of commands
+// for unmapped keys cannot overwhelm small instances. Commands for mapped keys are not limited.
+// Limits can be changed at any time with SetRateLimit.
+func WithRateLimit(limit RateLimit) Option {
+	return func(r *ProxyConn) {
+		r.SetRateLimit("", limit)
+	}
+}
+
+// SetRateLimit changes the rate limit of the instance with the input server address, taking effect immediately.
+// An empty server sets the default limit of every instance without a limit of its own.
+// Tokens already in the bucket of an instance are kept, up to its new burst.
+func (r *ProxyConn) SetRateLimit(server string, limit RateLimit) {
+	r.rates.set(server, limit)
+}
+
+// RateLimit returns the rate limit applied to the instance with the input server address.
+func (r *ProxyConn) RateLimit(server string) RateLimit {
+	return r.rates.limit(server)
+}
+
+func (l *rateLimiter) set(server string, limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if server == "" {
+		l.def = limit
+		return
+	}
+	if l.limits == nil {
+		l.limits = make(map[string]RateLimit)
+	}
+	l.limits[server] = limit
+}
+
+func (l *rateLimiter) limit(server string) RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limitLocked(server)
+}
+
+func (l *rateLimiter) limitLocked(server string) RateLimit {
+	if limit, ok := l.limits[server]; ok {
+		return limit
+	}
+	return l.def
+}
+
+// Takes a token for the input server if one is available. Otherwise returns the time until one will be.
+func (l *rateLimiter) take(server string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limitLocked(server)
+	if limit.PerSecond <= 0 {
+		return 0, true
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+	b, ok := l.buckets[server]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[server] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * limit.PerSecond
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / limit.PerSecond * float64(time.Second)), false
+}
+
+// Waits for a token to send a command to the instance with the input server address, giving up if the stop channel
+// receives or the context ends. Returns whether a token was taken. Commands that had to wait are counted.
+func (r *ProxyConn) waitRate(ctx context.Context, server string, stop chan bool) bool {
+	waited := false
+	for {
+		d, ok := r.rates.take(server, time.Now())
+		if ok {
+			return true
+		}
+		if !waited {
+			r.counter("rate_limited", server, 1)
+			waited = true
+		}
+
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return false
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
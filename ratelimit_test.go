@@ -0,0 +1,107 @@
+package twunproxy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefillsUpToBurst(t *testing.T) {
+	var l rateLimiter
+	l.set("", RateLimit{PerSecond: 10, Burst: 2})
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if _, ok := l.take("a:6379", now); !ok {
+			t.Fatalf("Expected burst token %d to be taken.", i)
+		}
+	}
+	if d, ok := l.take("a:6379", now); ok || d != 100*time.Millisecond {
+		t.Fatalf("Expected wait of 100ms, got %v", d)
+	}
+
+	// Refills are capped at the burst.
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, ok := l.take("a:6379", now); !ok {
+			t.Fatalf("Expected refilled token %d to be taken.", i)
+		}
+	}
+	if _, ok := l.take("a:6379", now); ok {
+		t.Fatal("Expected bucket to be empty.")
+	}
+
+	// Instances have buckets of their own, and those with a limit of their own ignore the default.
+	if _, ok := l.take("b:6379", now); !ok {
+		t.Fatal("Expected token for another instance.")
+	}
+	l.set("a:6379", RateLimit{})
+	if _, ok := l.take("a:6379", now); !ok {
+		t.Fatal("Expected unlimited instance to be admitted.")
+	}
+}
+
+func TestRateLimitDelaysProbesAndIsReportedInStats(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{}}, connPool{&nilStyleConn{}})
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	WithRateLimit(RateLimit{PerSecond: 1000, Burst: 1})(proxy)
+	proxy.SetRateLimit("b:6379", RateLimit{PerSecond: 0.001, Burst: 1})
+
+	proxy.Do(NewRedisCmd("GET", "key"), KeyFound)
+
+	// The second instance has no token left for another discovery, which gives up when the context ends.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := proxy.DoContext(ctx, NewRedisCmd("GET", "key"), KeyFound); err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline error, got %v", err)
+	}
+
+	s := proxy.Stats()
+	if s.Instances[1].RateLimit != (RateLimit{PerSecond: 0.001, Burst: 1}) || s.Instances[1].RateLimited != 1 {
+		t.Fatalf("Unexpected stats for limited instance: %+v", s.Instances[1])
+	}
+	if s.Instances[0].RateLimit != (RateLimit{PerSecond: 1000, Burst: 1}) {
+		t.Fatalf("Unexpected stats for default instance: %+v", s.Instances[0])
+	}
+}
+
+func TestRateLimitAppliesToBroadcasts(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{}})
+	proxy.Servers = []string{"a:6379:1"}
+	proxy.SetRateLimit("a:6379", RateLimit{PerSecond: 0.001})
+
+	if _, err := proxy.DoAll(NewCommand("PING")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res, _ := proxy.DoAllContext(ctx, NewCommand("PING"))
+	if res[0].Err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline error, got %v", res[0].Err)
+	}
+
+	// Raising the limit at runtime takes effect for the next command.
+	proxy.SetRateLimit("a:6379", RateLimit{PerSecond: 1000})
+	time.Sleep(5 * time.Millisecond)
+	if _, err := proxy.DoAll(NewCommand("PING")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestRateLimitAppliesToDuplicateDiscovery(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{}}, connPool{&nilStyleConn{}})
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	WithDuplicatePolicy(PreferFirstResponder, nil)(proxy)
+	WithRateLimit(RateLimit{PerSecond: 0.001, Burst: 1})(proxy)
+
+	proxy.Do(NewRedisCmd("GET", "key"), KeyFound)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	proxy.DoContext(ctx, NewRedisCmd("GET", "key"), KeyFound)
+
+	if s := proxy.Stats(); s.Instances[0].RateLimited != 1 || s.Instances[1].RateLimited != 1 {
+		t.Fatalf("Expected the probes of both instances to wait for the rate limit, got %+v", s.Instances)
+	}
+}
@@ -0,0 +1,177 @@
+package twunproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordedCommand is a command issued through a proxy, as written by a Recorder and read by Replay.
+// Args holds every argument after the command name, including the key at KeyPos, rendered as text.
+// KeyPos is -1 for commands without a key. Probe is set for the commands the proxy issued itself to locate a key.
+type RecordedCommand struct {
+	Time      time.Time     `json:"time"`
+	Name      string        `json:"name"`
+	Args      []string      `json:"args"`
+	KeyPos    int           `json:"key_pos"`
+	Server    string        `json:"server"`
+	Duration  time.Duration `json:"duration_ns"`
+	Discovery bool          `json:"discovery"`
+	Probe     bool          `json:"probe,omitempty"`
+}
+
+// Recorder writes every command issued through a proxy to a writer, one line of JSON per command,
+// so that the traffic can later be replayed against another proxy with Replay.
+// Arguments are recorded unredacted, since replay requires them; treat recordings as sensitive.
+type Recorder struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewRecorder creates a recorder writing to the input writer.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// WithRecorder records every command routed by the proxy to the input recorder.
+func WithRecorder(rec *Recorder) Option {
+	return func(r *ProxyConn) {
+		r.recorder = rec
+	}
+}
+
+// Err returns the first error writing to the output, after which recording stops.
+func (rec *Recorder) Err() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.err
+}
+
+// Writes the input command to the output.
+func (rec *Recorder) record(c RecordedCommand) {
+	b, _ := json.Marshal(c)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.err == nil {
+		_, rec.err = rec.w.Write(append(b, '\n'))
+	}
+}
+
+// ReplayResult summarises a replay. Errors counts commands that returned an error.
+// Skipped counts recorded commands without a key, which are not replayed.
+type ReplayResult struct {
+	Commands int           `json:"commands"`
+	Errors   int           `json:"errors"`
+	Skipped  int           `json:"skipped"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Replay re-issues the commands recorded in the input reader against the target proxy.
+// Commands are issued concurrently at their original pace multiplied by speed, so a speed of 2 replays twice as fast.
+// A speed of 0 or less issues every command as soon as it is read.
+// Each command is run on the target instance holding its key, as located with EXISTS, since the target may place
+// keys differently from the recorded servers. Commands for keys held by no instance are run on the ring owner of
+// the key, so that writes create keys on one instance only. Probes the recorded proxy issued to locate keys
+// are not replayed, and commands without a key are skipped, since the instance they ran on cannot be chosen.
+// Replay returns once every issued command has completed, or early with the context error.
+func Replay(ctx context.Context, rd io.Reader, target *ProxyConn, speed float64) (ReplayResult, error) {
+	var res ReplayResult
+	var mu sync.Mutex
+	wg := new(sync.WaitGroup)
+
+	reads := make(map[string]bool, len(DefaultReplicaReads))
+	for _, name := range DefaultReplicaReads {
+		reads[name] = true
+	}
+
+	start := time.Now()
+	var first time.Time
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+
+	for scanner.Scan() {
+		var c RecordedCommand
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			wg.Wait()
+			return res, err
+		}
+
+		if c.Probe {
+			continue
+		}
+		if c.KeyPos < 0 {
+			res.Skipped++
+			continue
+		}
+
+		if first.IsZero() {
+			first = c.Time
+		}
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(c.Time.Sub(first)) / speed))
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				return res, ctx.Err()
+			case <-time.After(time.Until(due)):
+			}
+		}
+
+		args := make([]interface{}, len(c.Args))
+		for i, a := range c.Args {
+			args[i] = a
+		}
+		cmd, err := NewRedisCmdAt(c.Name, c.KeyPos, args...)
+		if err != nil {
+			wg.Wait()
+			return res, err
+		}
+
+		res.Commands++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := target.doKeyed(cmd, !reads[strings.ToUpper(cmd.name)]); err != nil {
+				mu.Lock()
+				res.Errors++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	res.Duration = time.Since(start)
+	if err := scanner.Err(); err != nil {
+		return res, err
+	}
+	return res, ctx.Err()
+}
+
+// Returns the recording of the input command, completed on the input server.
+func recordedCommand(cmd *RedisCmd, server string, discovery bool, start time.Time) RecordedCommand {
+	args := cmd.getArgs()
+	c := RecordedCommand{
+		Time:      start,
+		Name:      cmd.name,
+		Args:      make([]string, len(args)),
+		KeyPos:    cmd.keyPos,
+		Server:    server,
+		Duration:  time.Since(start),
+		Discovery: discovery,
+		Probe:     cmd.probe,
+	}
+	for i, a := range args {
+		var ok bool
+		if c.Args[i], ok = keyString(a); !ok {
+			c.Args[i] = fmt.Sprint(a)
+		}
+	}
+	return c
+}
@@ -0,0 +1,103 @@
+package twunproxy
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	rec := &TopologyRecord{Servers: []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}}
+
+	source := NewMemorySimulator()
+	source.Set("10.0.0.2:6379", "KEY", "v")
+	proxy, err := NewSimulatedProxy(rec, source)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+	proxy.recorder = recorder
+
+	canMap := func(v interface{}) bool { return v != nil }
+	if _, err := proxy.Do(NewRedisCmd("GET", "KEY"), canMap); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if recorder.Err() != nil {
+		t.Fatalf("Unexpected recorder error: %v", recorder.Err())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"server":"10.0.0.2:6379"`) || !strings.Contains(lines[0], `"args":["KEY"]`) {
+		t.Fatalf("Unexpected recording: %s", buf.String())
+	}
+
+	target := NewMemorySimulator()
+	target.Set("10.0.0.1:6379", "KEY", "w")
+	replayProxy, err := NewSimulatedProxy(&TopologyRecord{Servers: rec.Servers}, target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	res, err := Replay(context.Background(), &buf, replayProxy, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Commands != 1 || res.Errors != 0 {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+	if server, ok := replayProxy.Lookup("KEY"); !ok || server != "10.0.0.1:6379" {
+		t.Fatalf("Expected replayed key to be discovered on the target, got %s, %v", server, ok)
+	}
+}
+
+func TestReplayRejectsMalformedRecording(t *testing.T) {
+	proxy, _ := NewSimulatedProxy(&TopologyRecord{Servers: []string{"10.0.0.1:6379:1"}}, NewMemorySimulator())
+	if _, err := Replay(context.Background(), strings.NewReader("not json\n"), proxy, 0); err == nil {
+		t.Fatal("Expected error for malformed recording")
+	}
+}
+
+func TestReplayPlacesWritesAndSkipsProbesAndKeylessCommands(t *testing.T) {
+	recording := strings.Join([]string{
+		`{"name":"EXISTS","args":["NEW"],"key_pos":0,"server":"","discovery":true,"probe":true}`,
+		`{"name":"SET","args":["NEW","v"],"key_pos":0,"server":"10.0.0.2:6379"}`,
+		`{"name":"PING","args":[],"key_pos":-1,"server":"10.0.0.1:6379","discovery":true}`,
+	}, "\n")
+
+	rec := &TopologyRecord{Servers: []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}, Hash: "fnv1a_64", Distribution: "ketama"}
+	target := NewMemorySimulator()
+	proxy, err := NewSimulatedProxy(rec, target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	res, err := Replay(context.Background(), strings.NewReader(recording), proxy, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Commands != 1 || res.Errors != 0 || res.Skipped != 1 {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+
+	owner, _ := proxy.ring.owner("NEW")
+	for i, desc := range rec.Servers {
+		_, held := target.instance(ServerAddr(desc))["NEW"]
+		if held != (i == owner) {
+			t.Fatalf("Expected the write to be placed on its ring owner only, instance %d holds it: %v", i, held)
+		}
+	}
+}
+
+func TestRecorderMarksProbes(t *testing.T) {
+	var buf bytes.Buffer
+	proxy, _ := NewSimulatedProxy(&TopologyRecord{Servers: []string{"10.0.0.1:6379:1"}}, NewMemorySimulator())
+	proxy.recorder = NewRecorder(&buf)
+
+	proxy.locate("KEY")
+	if !strings.Contains(buf.String(), `"probe":true`) {
+		t.Fatalf("Expected the EXISTS probe to be marked, got %s", buf.String())
+	}
+}
@@ -0,0 +1,81 @@
+package twunproxy
+
+import (
+	"path"
+	"strings"
+)
+
+// Redacted replaces argument values that must not be recorded.
+const Redacted = "[REDACTED]"
+
+// Redactor rewrites command arguments before they are recorded by tracing, wire capture or any other observability
+// feature. It receives the command name and its arguments in command order, and returns the arguments to record.
+// For most commands the key is the first argument.
+// Replies are masked where the Redactor masks them when appended to the arguments, so RedactKeys also masks
+// the replies of commands on matching keys. It must not modify the input slice.
+type Redactor func(name string, args []interface{}) []interface{}
+
+// Commands whose arguments are always redacted, as they carry credentials.
+var secretCommands = map[string]bool{"AUTH": true, "HELLO": true, "MIGRATE": true}
+
+// RedactKeys returns a Redactor that masks every argument after the key for commands with keys matching the input
+// glob pattern, for example "secret:*", and their replies. The key itself is left intact.
+// Only commands whose key is first are matched.
+func RedactKeys(pattern string) Redactor {
+	return func(_ string, args []interface{}) []interface{} {
+		if len(args) == 0 {
+			return args
+		}
+
+		k, ok := args[0].(string)
+		if m, _ := path.Match(pattern, k); !ok || !m {
+			return args
+		}
+
+		res := make([]interface{}, len(args))
+		res[0] = args[0]
+		for i := 1; i < len(res); i++ {
+			res[i] = Redacted
+		}
+		return res
+	}
+}
+
+// Returns the arguments of the input command as they may be recorded.
+// Credential-bearing commands are always masked; the configured Redactor is then applied.
+func (r *ProxyConn) redactedArgs(cmd *RedisCmd) []interface{} {
+	args := cmd.getArgs()
+
+	if secretCommands[strings.ToUpper(cmd.name)] {
+		masked := make([]interface{}, len(args))
+		for i := range masked {
+			masked[i] = Redacted
+		}
+		return masked
+	}
+
+	if r.redactor != nil {
+		return r.redactor(cmd.name, args)
+	}
+	return args
+}
+
+// Returns the reply to the input command as it may be recorded.
+// Replies to credential-bearing commands are always masked; otherwise the reply is masked if the configured
+// Redactor masks it as a trailing argument.
+func (r *ProxyConn) redactedReply(cmd *RedisCmd, val interface{}) interface{} {
+	if secretCommands[strings.ToUpper(cmd.name)] {
+		return Redacted
+	}
+	if r.redactor == nil {
+		return val
+	}
+
+	// The capacity is capped so that appending the reply cannot write into the arguments of the command.
+	args := cmd.getArgs()
+	args = append(args[:len(args):len(args)], val)
+	if res := r.redactor(cmd.name, args); len(res) == len(args) && res[len(res)-1] == Redacted {
+		return Redacted
+	}
+	return val
+}
@@ -0,0 +1,73 @@
+package twunproxy
+
+import (
+	"bytes"
+	"github.com/golang/mock/gomock"
+	"reflect"
+	"testing"
+)
+
+func TestRedactedArgsAlwaysMasksCredentials(t *testing.T) {
+	args := getMockProxy().redactedArgs(&RedisCmd{name: "auth", key: "user", args: []interface{}{"secret"}})
+
+	if !reflect.DeepEqual(args, []interface{}{Redacted, Redacted}) {
+		t.Fatalf("Credentials not redacted: %v", args)
+	}
+}
+
+func TestRedactKeysMasksValuesOfMatchingKeys(t *testing.T) {
+	f := RedactKeys("secret:*")
+
+	if args := f("SET", []interface{}{"secret:token", "abc"}); !reflect.DeepEqual(args, []interface{}{"secret:token", Redacted}) {
+		t.Fatalf("Value not redacted: %v", args)
+	}
+
+	if args := f("SET", []interface{}{"public:token", "abc"}); !reflect.DeepEqual(args, []interface{}{"public:token", "abc"}) {
+		t.Fatalf("Unexpected redaction: %v", args)
+	}
+}
+
+func TestRedactorAppliesToWireCapture(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("SET", "secret:token", "abc").Return("OK", nil)
+	mockConn.EXPECT().Close()
+
+	buf := new(bytes.Buffer)
+	proxy := getMockProxy(mockPool)
+	WithWireCapture(NewWireCapture(buf, 1, 0))(proxy)
+	WithRedactor(RedactKeys("secret:*"))(proxy)
+
+	proxy.Do(&RedisCmd{name: "SET", key: "secret:token", args: []interface{}{"abc"}}, func(v interface{}) bool { return true })
+
+	if bytes.Contains(buf.Bytes(), []byte("abc")) || !bytes.Contains(buf.Bytes(), []byte(Redacted)) {
+		t.Fatalf("Value not redacted: %s", buf.String())
+	}
+}
+
+func TestRedactorAppliesToCapturedReplies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("GET", "secret:token").Return([]byte("abc"), nil)
+	mockConn.EXPECT().Do("GET", "public:token").Return([]byte("xyz"), nil)
+	mockConn.EXPECT().Close().Times(2)
+
+	buf := new(bytes.Buffer)
+	proxy := getMockProxy(mockPool)
+	WithWireCapture(NewWireCapture(buf, 1, 0))(proxy)
+	WithRedactor(RedactKeys("secret:*"))(proxy)
+
+	proxy.Do(&RedisCmd{name: "GET", key: "secret:token"}, func(v interface{}) bool { return true })
+	proxy.Do(&RedisCmd{name: "GET", key: "public:token"}, func(v interface{}) bool { return true })
+
+	if bytes.Contains(buf.Bytes(), []byte("abc")) || !bytes.Contains(buf.Bytes(), []byte(Redacted)) {
+		t.Fatalf("Reply not redacted: %s", buf.String())
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("xyz")) {
+		t.Fatalf("Unexpected redaction: %s", buf.String())
+	}
+}
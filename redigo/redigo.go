@@ -0,0 +1,93 @@
+// Package redigo provides a ready-made twunproxy.CreatePool backed by redigo connection pools,
+// so that NewProxyConn can be used without writing an adapter.
+package redigo
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"github.com/txodds/twunproxy"
+	"time"
+)
+
+// Options configures the pools created for each server.
+// Pools are tested on borrow with a PING if they have been idle for longer than TestIdle; zero disables the test.
+// DialOptions are applied to every connection in addition to the password from redis_auth.
+type Options struct {
+	MaxIdle     int
+	MaxActive   int
+	IdleTimeout time.Duration
+	TestIdle    time.Duration
+	DialOptions []redis.DialOption
+}
+
+// DefaultOptions are the options used by CreatePool.
+var DefaultOptions = Options{
+	MaxIdle:     16,
+	IdleTimeout: 5 * time.Minute,
+	TestIdle:    time.Minute,
+}
+
+// CreatePool creates a redigo pool with the default options for a server line of the Twemproxy configuration.
+var CreatePool = NewCreatePool(DefaultOptions)
+
+// Pool wraps a redigo pool to satisfy twunproxy.ConnGetter.
+// It satisfies twunproxy.PoolCloser with the Close method of the redigo pool.
+type Pool struct {
+	*redis.Pool
+}
+
+// Get returns a connection from the pool.
+func (p *Pool) Get() twunproxy.Conn {
+	return p.Pool.Get()
+}
+
+// SelectDB makes the pool select the input database on every connection it dials, as twunproxy.DBSelector requires.
+// Connections already idle in the pool are unaffected, so it should be called before the pool is used.
+func (p *Pool) SelectDB(db int) error {
+	dial := p.Pool.Dial
+	p.Pool.Dial = func() (redis.Conn, error) {
+		c, err := dial()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.Do("SELECT", db); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil
+}
+
+// NewCreatePool returns a CreatePool that creates redigo pools with the input options.
+// Server lines are of the form "host:port:weight name", or "/path/to/socket:weight name" for Unix sockets,
+// and the auth string is the pool's redis_auth or the server's override of it. Pools select redis_db with SelectDB.
+func NewCreatePool(opts Options) twunproxy.CreatePool {
+	return func(desc string, auth string) twunproxy.ConnGetter {
+		network, addr := twunproxy.ServerNetwork(desc), twunproxy.ServerAddr(desc)
+
+		dialOpts := opts.DialOptions
+		if auth != "" {
+			dialOpts = append(append([]redis.DialOption(nil), dialOpts...), redis.DialPassword(auth))
+		}
+
+		p := &redis.Pool{
+			MaxIdle:     opts.MaxIdle,
+			MaxActive:   opts.MaxActive,
+			IdleTimeout: opts.IdleTimeout,
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial(network, addr, dialOpts...)
+			},
+		}
+
+		if opts.TestIdle > 0 {
+			p.TestOnBorrow = func(c redis.Conn, t time.Time) error {
+				if time.Since(t) < opts.TestIdle {
+					return nil
+				}
+				_, err := c.Do("PING")
+				return err
+			}
+		}
+		return &Pool{p}
+	}
+}
@@ -0,0 +1,68 @@
+package redigo
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/txodds/twunproxy/conformance"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestCreatePoolConforms(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.RequireAuth("secret")
+
+	pool := CreatePool(s.Addr()+":1 server1", "secret").(*Pool)
+	defer pool.Close()
+
+	conformance.Run(t, pool)
+}
+
+func TestCreatePoolDialsUnixSockets(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	// Miniredis only listens on TCP, so relay a Unix socket to it.
+	path := t.TempDir() + "/redis.sock"
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r, err := net.Dial("tcp", s.Addr())
+			if err != nil {
+				c.Close()
+				return
+			}
+			go func() { io.Copy(r, c); r.Close() }()
+			go func() { io.Copy(c, r); c.Close() }()
+		}
+	}()
+
+	pool := CreatePool(path+":0 server1", "").(*Pool)
+	defer pool.Close()
+
+	conformance.Run(t, pool)
+}
+
+func TestSelectDBSelectsDatabaseOnDial(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.DB(2).Set("key", "value")
+
+	pool := CreatePool(s.Addr()+":1", "").(*Pool)
+	defer pool.Close()
+	if err := pool.SelectDB(2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c := pool.Get()
+	defer c.Close()
+	if v, err := c.Do("GET", "key"); err != nil || string(v.([]byte)) != "value" {
+		t.Fatalf("Expected value from database 2, got %v and %v", v, err)
+	}
+}
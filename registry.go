@@ -0,0 +1,143 @@
+package twunproxy
+
+import (
+	"errors"
+	"strings"
+)
+
+/******************************************************
+ * Registry of how commands are routed: whether they block, and which replies show that an instance holds the key.
+ * Do and DoContext infer the predicate from here when none is given.
+ ******************************************************/
+
+// How a command is routed by default.
+// If accept is nil, the command replies the same whether or not the key exists, so discovery cannot use it.
+type commandRouting struct {
+	blocking bool
+	accept   func(interface{}) bool
+}
+
+// Built-in routing of common single-key commands, by lower-case name.
+// Most reads reply nil, an empty array or zero for a missing key, as KeyFound expects.
+var builtinRouting = map[string]commandRouting{
+	// Blocking pops reply nil on timeout.
+	"blpop":      {blocking: true, accept: isArray},
+	"brpop":      {blocking: true, accept: isArray},
+	"brpoplpush": {blocking: true, accept: KeyFound},
+	"blmove":     {blocking: true, accept: KeyFound},
+	"bzpopmin":   {blocking: true, accept: isArray},
+	"bzpopmax":   {blocking: true, accept: isArray},
+
+	// Strings.
+	"get":      {accept: KeyFound},
+	"getrange": {accept: nonEmpty},
+	"strlen":   {accept: KeyFound},
+	"exists":   {accept: KeyFound},
+	"type":     {accept: func(v interface{}) bool { s, ok := replyString(v); return ok && s != "none" }},
+	"ttl":      {accept: func(v interface{}) bool { n, ok := replyInt(v); return ok && n != -2 }},
+	"pttl":     {accept: func(v interface{}) bool { n, ok := replyInt(v); return ok && n != -2 }},
+	"dump":     {accept: KeyFound},
+
+	// Lists.
+	"llen":   {accept: KeyFound},
+	"lindex": {accept: KeyFound},
+	"lrange": {accept: KeyFound},
+	"lpop":   {accept: KeyFound},
+	"rpop":   {accept: KeyFound},
+
+	// Hashes.
+	"hget":    {accept: KeyFound},
+	"hmget":   {accept: anyNonNil},
+	"hgetall": {accept: KeyFound},
+	"hkeys":   {accept: KeyFound},
+	"hvals":   {accept: KeyFound},
+	"hlen":    {accept: KeyFound},
+	"hexists": {accept: KeyFound},
+
+	// Sets.
+	"smembers":  {accept: KeyFound},
+	"scard":     {accept: KeyFound},
+	"sismember": {accept: KeyFound},
+	"spop":      {accept: KeyFound},
+
+	// Sorted sets.
+	"zrange": {accept: KeyFound},
+	"zcard":  {accept: KeyFound},
+	"zscore": {accept: KeyFound},
+	"zrank":  {accept: KeyFound},
+
+	// Streams.
+	"xlen":   {accept: KeyFound},
+	"xrange": {accept: KeyFound},
+}
+
+// Returns the predicate that replies of the named command show the key is present by, and whether there is one.
+// Predicates registered with RegisterCommand come first, then the built-in routing, then KeyFound for other
+// commands that COMMAND reports as read-only.
+func (r *ProxyConn) acceptance(name string) (func(interface{}) bool, bool) {
+	ci, known := r.Command(name)
+	if known && ci.Accept != nil {
+		return ci.Accept, true
+	}
+	if rt, ok := builtinRouting[strings.ToLower(name)]; ok && rt.accept != nil {
+		return rt.accept, true
+	}
+	if known && ci.HasFlag("readonly") {
+		return KeyFound, true
+	}
+	return nil, false
+}
+
+// Reports whether the named command blocks, according to the built-in routing or the flags of its routing entry.
+func (r *ProxyConn) blocking(name string) bool {
+	if builtinRouting[strings.ToLower(name)].blocking {
+		return true
+	}
+	ci, ok := r.Command(name)
+	return ok && ci.HasFlag("blocking")
+}
+
+// Returns the predicate for a command run by Do: the input predicate guarded against panics, or else the
+// predicate inferred from the registry. An error is returned if there is neither.
+func (r *ProxyConn) predicate(cmd *RedisCmd, canMap func(interface{}) bool) (func(interface{}) bool, error) {
+	if canMap == nil {
+		var ok bool
+		if canMap, ok = r.acceptance(cmd.name); !ok {
+			return nil, errors.New("No predicate is known for command " + cmd.name + "; one must be given.")
+		}
+	}
+
+	// A predicate that panics, such as on an unexpected reply type, rejects the reply rather than crashing.
+	return func(v interface{}) (accept bool) {
+		defer func() {
+			if recover() != nil {
+				r.counter("predicate_panics", "", 1)
+				accept = false
+			}
+		}()
+		return canMap(v)
+	}, nil
+}
+
+// Accepts array replies, rejecting the nil reply of a blocking command that timed out.
+func isArray(v interface{}) bool {
+	_, ok := v.([]interface{})
+	return ok
+}
+
+// Accepts replies other than nil and the empty string.
+func nonEmpty(v interface{}) bool {
+	s, ok := replyString(v)
+	return v != nil && (!ok || s != "")
+}
+
+// Accepts array replies with at least one element that is not nil.
+func anyNonNil(v interface{}) bool {
+	items, _ := v.([]interface{})
+	for _, item := range items {
+		if item != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestDoInfersPredicateForKnownCommands(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("TYPE", "KEY").Return("none", nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("TYPE", "KEY").Return("list", nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	if v, err := proxy.Do(NewRedisCmd("TYPE", "KEY"), nil); err != nil || v != "list" {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+	if proxy.KeyInstance["KEY"] != mockPool2 {
+		t.Fatal("Expected the key to be mapped to the instance holding it.")
+	}
+
+	if _, err := proxy.Do(NewRedisCmd("SET", "KEY", "v"), nil); err == nil {
+		t.Fatal("Expected an error for a command without a known predicate.")
+	}
+}
+
+func TestDoRejectsRepliesWherePredicatePanics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("GET", "KEY").Return(nil, nil)
+	mockConn.EXPECT().Close()
+
+	canMap := func(v interface{}) bool { return len(v.([]byte)) > 0 }
+	if _, err := getMockProxy(mockPool).Do(NewRedisCmd("GET", "KEY"), canMap); err != ErrNoMapping {
+		t.Fatalf("Expected no mapping, got %v", err)
+	}
+}
+
+func TestRegisteredAcceptOverridesBuiltinRouting(t *testing.T) {
+	proxy := getMockProxy()
+	accept := func(v interface{}) bool { return true }
+	if err := proxy.RegisterCommand(CommandInfo{Name: "GET", FirstKey: 1, LastKey: 1, Step: 1, Accept: accept}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if canMap, ok := proxy.acceptance("get"); !ok || !canMap(nil) {
+		t.Fatal("Expected the registered predicate.")
+	}
+	if !proxy.blocking("BLPOP") || proxy.blocking("GET") {
+		t.Fatal("Unexpected blocking classification.")
+	}
+}
@@ -0,0 +1,68 @@
+package twunproxy
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+/******************************************************
+ * RedisJSON commands, routed to the instance holding the key.
+ ******************************************************/
+
+// JSONGet reads the document at key, or the values at the input paths, and decodes the result into dst.
+// With no path, or a single path, dst receives that value. With several paths, dst receives an object
+// keyed by path, as returned by RedisJSON. False is returned if the key does not exist.
+func (r *ProxyConn) JSONGet(key string, dst interface{}, paths ...string) (bool, error) {
+	args := make([]interface{}, len(paths))
+	for i, p := range paths {
+		args[i] = p
+	}
+
+	v, err := r.doKeyed(&RedisCmd{name: "JSON.GET", key: key, args: args}, false)
+	if err != nil || v == nil {
+		return false, err
+	}
+
+	s, ok := replyString(v)
+	if !ok {
+		return false, errors.New("Unexpected reply to JSON.GET.")
+	}
+	return true, json.Unmarshal([]byte(s), dst)
+}
+
+// JSONSet encodes the input value as JSON and sets it at the path in the document at key.
+// Cond may be "NX" to only set a path that does not exist, "XX" to only set one that does, or empty.
+// False is returned if the condition prevented the write.
+func (r *ProxyConn) JSONSet(key, path string, v interface{}, cond string) (bool, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+
+	args := []interface{}{path, string(b)}
+	switch cond {
+	case "":
+	case "NX", "XX":
+		args = append(args, cond)
+	default:
+		return false, errors.New("Condition must be NX, XX or empty.")
+	}
+
+	reply, err := r.doKeyed(&RedisCmd{name: "JSON.SET", key: key, args: args}, true)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// JSONDel deletes the values at the input path in the document at key, returning the number deleted.
+// An empty path deletes the whole document.
+func (r *ProxyConn) JSONDel(key, path string) (int64, error) {
+	var args []interface{}
+	if path != "" {
+		args = append(args, path)
+	}
+
+	v, err := r.doKeyed(&RedisCmd{name: "JSON.DEL", key: key, args: args}, true)
+	return intReply("JSON.DEL", v, err)
+}
@@ -0,0 +1,54 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestJSONSetAndGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	type doc struct {
+		Name string `json:"name"`
+	}
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("JSON.SET", "KEY", "$", `{"name":"a"}`, "NX").Return("OK", nil)
+	mockConn.EXPECT().Do("JSON.GET", "KEY", "$").Return([]byte(`[{"name":"a"}]`), nil)
+	mockConn.EXPECT().Do("JSON.GET", "GONE").Return(nil, nil)
+	mockConn.EXPECT().Close().Times(3)
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+	proxy.KeyInstance["GONE"] = mockPool
+
+	if ok, err := proxy.JSONSet("KEY", "$", doc{Name: "a"}, "NX"); err != nil || !ok {
+		t.Fatalf("Unexpected result: %v, %v", ok, err)
+	}
+
+	var got []doc
+	if ok, err := proxy.JSONGet("KEY", &got, "$"); err != nil || !ok || len(got) != 1 || got[0].Name != "a" {
+		t.Fatalf("Unexpected result: %+v, %v, %v", got, ok, err)
+	}
+
+	if ok, err := proxy.JSONGet("GONE", &got); err != nil || ok {
+		t.Fatalf("Expected missing key, got %v, %v", ok, err)
+	}
+}
+
+func TestJSONDelWholeDocument(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("JSON.DEL", "KEY").Return(int64(1), nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	if n, err := proxy.JSONDel("KEY", ""); err != nil || n != 1 {
+		t.Fatalf("Unexpected result: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,122 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+/******************************************************
+ * Reliable work queues, whose items are kept in a processing list until acknowledged.
+ ******************************************************/
+
+// Moves an item from the processing list in KEYS[1] to the consumer end of the pending list in KEYS[2],
+// returning 0 if it was not being processed.
+const requeueScript = `if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call("RPUSH", KEYS[2], ARGV[1])
+return 1
+`
+
+// Moves every item from the processing list in KEYS[1] to the consumer end of the pending list in KEYS[2],
+// oldest nearest the end, returning the number moved.
+const requeueAllScript = `local n = 0
+while true do
+	local v = redis.call("LPOP", KEYS[1])
+	if not v then
+		return n
+	end
+	redis.call("RPUSH", KEYS[2], v)
+	n = n + 1
+end
+`
+
+// ReliableQueue is a work queue whose items are kept in a processing list while consumers work on them, so that
+// items taken by a consumer that fails are not lost. Items are pushed to a pending list, moved atomically to the
+// processing list as they are taken, and removed from it once acknowledged; unacknowledged items can be put back
+// with Requeue or RequeueAll. Both lists share the hash tag of the queue name, so Twemproxy places them on the same
+// instance, and they are routed through the key mappings like any other key.
+type ReliableQueue struct {
+	r          *ProxyConn
+	pending    string
+	processing string
+}
+
+// ReliableQueue returns the reliable queue with the input name, whose lists are "{name}:pending" and
+// "{name}:processing", with the hash tag delimiters of the pool in place of the braces.
+// An error is returned if the pool has no hash tag, as the two lists could then be placed on different instances.
+func (r *ProxyConn) ReliableQueue(name string) (*ReliableQueue, error) {
+	tag := r.colocationTag()
+	if len(tag) != 2 {
+		return nil, errors.New("Pool has no hash tag to place the lists of a queue on one instance.")
+	}
+
+	prefix := tag[:1] + name + tag[1:]
+	return &ReliableQueue{r: r, pending: prefix + ":pending", processing: prefix + ":processing"}, nil
+}
+
+// Keys returns the keys of the pending and processing lists of the queue.
+func (q *ReliableQueue) Keys() (pending, processing string) {
+	return q.pending, q.processing
+}
+
+// Push adds the input items to the queue, to be taken after any already pending, and returns the number pending.
+func (q *ReliableQueue) Push(items ...interface{}) (int64, error) {
+	if len(items) == 0 {
+		return 0, errors.New("No items to push.")
+	}
+	v, err := q.r.doKeyed(&RedisCmd{name: "LPUSH", key: q.pending, args: items}, true)
+	return intReply("LPUSH", v, err)
+}
+
+// BLMoveToProcessing takes the oldest pending item, moving it to the processing list atomically, and returns it.
+// It blocks for up to the input timeout for an item to be pushed, or indefinitely for a timeout of zero,
+// returning a *TimeoutError if none is. The item stays in the processing list until acknowledged with Ack.
+// Items are moved with BRPOPLPUSH, which every Redis version supports.
+func (q *ReliableQueue) BLMoveToProcessing(timeout time.Duration) (string, error) {
+	return q.BLMoveToProcessingContext(context.Background(), timeout)
+}
+
+// BLMoveToProcessingContext takes an item as for BLMoveToProcessing, but returns the context error if the context
+// ends first.
+func (q *ReliableQueue) BLMoveToProcessingContext(ctx context.Context, timeout time.Duration) (string, error) {
+	return q.r.BRPopLPushContext(ctx, q.pending, q.processing, timeout)
+}
+
+// Ack removes the input item from the processing list once it has been worked on.
+// False is returned if the item was not being processed, such as after it was requeued.
+func (q *ReliableQueue) Ack(item string) (bool, error) {
+	v, err := q.r.doKeyed(&RedisCmd{name: "LREM", key: q.processing, args: []interface{}{1, item}}, false)
+	n, err := intReply("LREM", v, err)
+	return n > 0, err
+}
+
+// Requeue atomically moves the input item from the processing list back to the pending list, where it is the next
+// item taken, such as when its consumer cannot work on it. False is returned if the item was not being processed.
+func (q *ReliableQueue) Requeue(item string) (bool, error) {
+	v, err := q.r.Eval(requeueScript, []string{q.processing, q.pending}, item)
+	n, err := intReply("EVALSHA", v, err)
+	return n > 0, err
+}
+
+// RequeueAll atomically moves every item being processed back to the pending list, to be taken before those already
+// pending, oldest first. This recovers the items of consumers that failed, and suits startup when there is one
+// consumer. It returns the number of items moved.
+func (q *ReliableQueue) RequeueAll() (int64, error) {
+	v, err := q.r.Eval(requeueAllScript, []string{q.processing, q.pending})
+	return intReply("EVALSHA", v, err)
+}
+
+// Len returns the number of items pending and being processed.
+func (q *ReliableQueue) Len() (pending, processing int64, err error) {
+	res, err := q.r.Atomic(NewRedisCmd("LLEN", q.pending), NewRedisCmd("LLEN", q.processing))
+	if err != nil {
+		return 0, 0, err
+	}
+	if pending, err = intReply("LLEN", res[0], nil); err != nil {
+		return 0, 0, err
+	}
+	processing, err = intReply("LLEN", res[1], nil)
+	return pending, processing, err
+}
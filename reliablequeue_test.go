@@ -0,0 +1,84 @@
+package twunproxy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestReliableQueueMovesItemsThroughProcessing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool, connPool{&nilStyleConn{}})
+	proxy.KeyInstance["{jobs}:pending"] = mockPool
+
+	q, err := proxy.ReliableQueue("jobs")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	gomock.InOrder(
+		mockConn.EXPECT().Do("LPUSH", "{jobs}:pending", "a").Return(int64(1), nil),
+		mockConn.EXPECT().Do("EXISTS", "{jobs}:processing").Return(int64(0), nil),
+		mockConn.EXPECT().Do("BRPOPLPUSH", "{jobs}:pending", "{jobs}:processing", 1.0).Return([]byte("a"), nil),
+		mockConn.EXPECT().Do("LREM", "{jobs}:processing", 1, "a").Return(int64(1), nil),
+	)
+	mockConn.EXPECT().Close().Times(4)
+
+	if n, err := q.Push("a"); err != nil || n != 1 {
+		t.Fatalf("Unexpected push result: %d, %v", n, err)
+	}
+	if item, err := q.BLMoveToProcessing(time.Second); err != nil || item != "a" {
+		t.Fatalf("Unexpected item: %q, %v", item, err)
+	}
+	if pool, _ := proxy.lookup("{jobs}:processing"); pool != mockPool {
+		t.Fatal("Expected the processing list to be mapped with the pending list.")
+	}
+	if ok, err := q.Ack("a"); err != nil || !ok {
+		t.Fatalf("Unexpected ack result: %v, %v", ok, err)
+	}
+}
+
+func TestReliableQueueRequeuesWithScript(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["{jobs}:processing"] = mockPool
+	q, _ := proxy.ReliableQueue("jobs")
+
+	sum := sha1.Sum([]byte(requeueScript))
+	sha := hex.EncodeToString(sum[:])
+	gomock.InOrder(
+		mockConn.EXPECT().Do("SCRIPT", "LOAD", requeueScript).Return(sha, nil),
+		mockConn.EXPECT().Do("EVALSHA", sha, 2, "{jobs}:processing", "{jobs}:pending", "a").Return(int64(0), nil),
+	)
+	mockConn.EXPECT().Close()
+
+	if ok, err := q.Requeue("a"); err != nil || ok {
+		t.Fatalf("Expected an item not being processed to be reported, got %v, %v", ok, err)
+	}
+}
+
+func TestReliableQueueRequiresHashTag(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{}})
+	proxy.config = func() (PoolConfig, error) { return PoolConfig{}, nil }
+
+	if _, err := proxy.ReliableQueue("jobs"); err == nil {
+		t.Fatal("Expected error for a pool without a hash tag.")
+	}
+
+	proxy.hashTag = "[]"
+	q, err := proxy.ReliableQueue("jobs")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pending, processing := q.Keys(); pending != "[jobs]:pending" || processing != "[jobs]:processing" {
+		t.Fatalf("Unexpected keys: %s, %s", pending, processing)
+	}
+}
@@ -0,0 +1,147 @@
+package twunproxy
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// DefaultDrainTimeout is the time given to commands in flight on the pools of removed servers before they are closed,
+// if WithDrainTimeout does not set one.
+const DefaultDrainTimeout = 30 * time.Second
+
+// DefaultWatchInterval is the interval at which WatchConfig and WatchBackends check for changes,
+// if they are given no positive interval.
+const DefaultWatchInterval = 30 * time.Second
+
+// Reload re-reads the Twemproxy configuration that the proxy was created from and applies changes to its servers.
+// Pools for servers that are unchanged are kept, and pools for added servers are created and checked with PING
+// before anything is changed, so on failure the proxy is left as it was. Otherwise the new topology replaces
+// the old one atomically. Mappings to removed servers are dropped, to be rediscovered, and the pools of removed
+// servers are drained and closed as set by WithDrainTimeout. Commands already in flight complete against the pools they
+// started on. A proxy created from a reader, bytes or PoolConfig applies the configuration it was created with.
+func (r *ProxyConn) Reload() error {
+	if r.create == nil {
+		return errors.New("Proxy was not created from a configuration.")
+	}
+
+	conf, err := r.readConfig()
+	if err != nil {
+		return err
+	}
+	return r.replaceServers(conf)
+}
+
+// WithDrainTimeout closes the pools of servers removed by Reload, SyncBackends or DNS re-resolution once the input
+// duration has passed, giving commands in flight on them time to complete, in place of DefaultDrainTimeout.
+// Only pools implementing PoolCloser are closed. A negative duration leaves removed pools open, for callers that
+// close them themselves. Pools shared by the proxies of a ProxySet are never closed on removal, since other
+// proxies may still use them.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(r *ProxyConn) {
+		r.drainTimeout = d
+	}
+}
+
+// WatchConfig calls Reload at the input interval, so that changes to the Twemproxy configuration file,
+// such as after resharding, are applied without restarting. Reloading an unchanged configuration changes nothing.
+// An interval that is not positive is taken as DefaultWatchInterval.
+// Reload errors are passed to onErr, which may be nil. Call the returned function, or Close, to stop watching.
+func (r *ProxyConn) WatchConfig(interval time.Duration, onErr func(error)) func() {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	done := make(chan bool)
+	stop := r.onClose(func() { close(done) })
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if err := r.Reload(); err != nil && onErr != nil {
+					onErr(err)
+				}
+			}
+		}
+	}()
+
+	return stop
+}
+
+// Counts the servers added and removed between the input topologies, and closes the pools of removed servers
+// after the drain timeout, unless they are shared or draining is disabled.
+func (r *ProxyConn) drainRemoved(old, t *topology) {
+	for i, pool := range t.pools {
+		if old.indexOf(pool) < 0 {
+			r.counter("servers_added", t.server(i), 1)
+		}
+	}
+
+	var removed []PoolCloser
+	for i, pool := range old.pools {
+		if t.indexOf(pool) >= 0 {
+			continue
+		}
+		r.counter("servers_removed", old.server(i), 1)
+		if c, ok := pool.(PoolCloser); ok {
+			removed = append(removed, c)
+		}
+	}
+
+	r.drain(removed...)
+}
+
+// Closes the input pools once the drain timeout has passed, unless they are shared or draining is disabled.
+func (r *ProxyConn) drain(pools ...PoolCloser) {
+	d := r.drainAfter()
+	if d < 0 || r.poolsShared || len(pools) == 0 {
+		return
+	}
+	time.AfterFunc(d, func() {
+		for _, c := range pools {
+			c.Close()
+		}
+	})
+}
+
+// Returns the time to wait before closing removed pools, or a negative duration if they are left open.
+func (r *ProxyConn) drainAfter() time.Duration {
+	if r.drainTimeout == 0 {
+		return DefaultDrainTimeout
+	}
+	return r.drainTimeout
+}
+
+// ReloadOnSignal calls Reload whenever one of the input signals is received, typically syscall.SIGHUP.
+// Long-running daemons can then adopt configuration changes without a redeploy.
+// Reload errors are passed to onErr, which may be nil. Call the returned function, or Close, to stop listening.
+func (r *ProxyConn) ReloadOnSignal(onErr func(error), sigs ...os.Signal) func() {
+	ch := make(chan os.Signal, 1)
+	done := make(chan bool)
+	signal.Notify(ch, sigs...)
+	stop := r.onClose(func() {
+		signal.Stop(ch)
+		close(done)
+	})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ch:
+				if err := r.Reload(); err != nil && onErr != nil {
+					onErr(err)
+				}
+			}
+		}
+	}()
+
+	return stop
+}
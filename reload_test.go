@@ -0,0 +1,159 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReloadAddsPoolsAndKeepsMappings(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("PING").Return("PONG", nil).AnyTimes()
+	mockConn1.EXPECT().Close().AnyTimes()
+	mockConn2.EXPECT().Do("PING").Return("PONG", nil).AnyTimes()
+	mockConn2.EXPECT().Close().AnyTimes()
+
+	pools := map[string]ConnGetter{"10.0.0.1:6379:1": mockPool1, "10.0.0.2:6379:1": mockPool2}
+	create := func(desc, auth string) ConnGetter { return pools[desc] }
+
+	path := writeConfig(t, "alpha:\n  servers:\n   - 10.0.0.1:6379:1\n")
+	defer os.Remove(path)
+
+	proxy, err := NewProxyConn(path, "alpha", 0, create)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	proxy.KeyInstance["KEY"] = mockPool1
+
+	if err := ioutil.WriteFile(path, []byte("alpha:\n  servers:\n   - 10.0.0.1:6379:1\n   - 10.0.0.2:6379:1\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := proxy.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(proxy.Pools) != 2 || proxy.topology().server(1) != "10.0.0.2:6379" {
+		t.Fatalf("Pools not reloaded: %v", proxy.Servers)
+	}
+
+	if proxy.KeyInstance["KEY"] != mockPool1 {
+		t.Fatal("Expected mapping to unchanged server to be kept.")
+	}
+}
+
+func TestReloadDrainsRemovedServersAndDropsTheirMappings(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("PING").Return("PONG", nil).AnyTimes()
+	mockConn.EXPECT().Close().AnyTimes()
+
+	pools := map[string]*closingPool{}
+	create := func(desc, auth string) ConnGetter {
+		p := &closingPool{ConnGetter: mockPool, closed: make(chan bool, 1)}
+		pools[desc] = p
+		return p
+	}
+
+	path := writeConfig(t, "alpha:\n  servers:\n   - 10.0.0.1:6379:1\n   - 10.0.0.2:6379:1\n")
+	defer os.Remove(path)
+
+	proxy, err := NewProxyConn(path, "alpha", 0, create, WithDrainTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	kept, removed := pools["10.0.0.1:6379:1"], pools["10.0.0.2:6379:1"]
+	proxy.KeyInstance["KEPT"] = kept
+	proxy.KeyInstance["REMOVED"] = removed
+
+	if err := ioutil.WriteFile(path, []byte("alpha:\n  servers:\n   - 10.0.0.1:6379:1\n   - 10.0.0.3:6379:1\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := proxy.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(pools) != 3 || proxy.Pools[0] != kept || proxy.topology().server(1) != "10.0.0.3:6379" {
+		t.Fatalf("Unexpected pools after reload: %v", proxy.Servers)
+	}
+	if _, ok := proxy.KeyInstance["REMOVED"]; ok || proxy.KeyInstance["KEPT"] != kept {
+		t.Fatalf("Unexpected mappings after reload: %v", proxy.KeyInstance)
+	}
+
+	select {
+	case <-removed.closed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected removed pool to be closed.")
+	}
+	select {
+	case <-kept.closed:
+		t.Fatal("Expected kept pool to stay open.")
+	default:
+	}
+}
+
+func TestReloadLeavesProxyUnchangedOnError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.create = func(desc, auth string) ConnGetter { return mockPool }
+	proxy.config = func() (PoolConfig, error) { return readPoolConfig("/nonexistent/nutcracker.yml", "") }
+
+	if err := proxy.Reload(); err == nil {
+		t.Fatal("Expected error for missing configuration.")
+	}
+
+	if len(proxy.Pools) != 1 || proxy.Pools[0] != mockPool {
+		t.Fatal("Expected pools to be unchanged.")
+	}
+}
+
+// A pool that reports when it is closed.
+type closingPool struct {
+	ConnGetter
+	closed chan bool
+}
+
+func (p *closingPool) Close() error {
+	p.closed <- true
+	return nil
+}
+
+func TestDrainDefaultsAndSkipsSharedPools(t *testing.T) {
+	proxy := getMockProxy()
+	if proxy.drainAfter() != DefaultDrainTimeout {
+		t.Fatalf("Expected the default drain timeout, got %v", proxy.drainAfter())
+	}
+
+	p := &closingPool{closed: make(chan bool, 1)}
+	WithDrainTimeout(time.Millisecond)(proxy)
+	proxy.poolsShared = true
+	proxy.drain(p)
+
+	WithDrainTimeout(-1)(proxy)
+	proxy.poolsShared = false
+	proxy.drain(p)
+
+	select {
+	case <-p.closed:
+		t.Fatal("Expected shared pools and disabled draining to leave the pool open.")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestWatchConfigDefaultsNonPositiveInterval(t *testing.T) {
+	proxy := getMockProxy()
+	stop := proxy.WatchConfig(0, nil)
+	time.Sleep(10 * time.Millisecond)
+	stop()
+}
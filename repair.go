@@ -0,0 +1,141 @@
+package twunproxy
+
+import (
+	"context"
+	"sync"
+)
+
+// The most keys whose rejected replies are counted at once. Beyond it the counts start again,
+// so that keys rejected once and never used again do not accumulate.
+const maxRepairCandidates = 10000
+
+// Counts consecutive replies from mapped instances that the canMap test rejected, by key.
+type mappingRepair struct {
+	threshold int
+
+	mu       sync.Mutex
+	rejected map[string]int
+}
+
+// WithMappingRepair makes commands rediscover keys whose mapped instance no longer seems to hold them.
+// When the canMap test rejects the replies of the mapped instance for a key the input number of times in a row,
+// such as repeated nil replies or blocking pop timeouts after a resharding, the key is unmapped and the command
+// is run again by discovery, which maps the key to the instance now holding it.
+// Error replies and connection failures are not counted. A threshold above 1 tolerates keys that are
+// legitimately empty for a while, such as queues waiting for producers.
+func WithMappingRepair(threshold int) Option {
+	return func(r *ProxyConn) {
+		if threshold < 1 {
+			threshold = 1
+		}
+		r.repair = &mappingRepair{threshold: threshold, rejected: make(map[string]int)}
+	}
+}
+
+// Records whether the canMap test accepted the reply of the mapped pool for the input command.
+// True is returned if the key has reached the threshold of rejected replies and has been unmapped,
+// in which case the command should be rediscovered.
+func (r *ProxyConn) repairMapping(
+	ctx context.Context,
+	t *topology,
+	pool ConnGetter,
+	cmd *RedisCmd,
+	canMap func(interface{}) bool,
+	v interface{},
+	err error) bool {
+
+	if r.repair == nil || canMap == nil || err != nil || ctx.Err() != nil {
+		return false
+	}
+
+	if !r.repair.rejectedReply(cmd.key, !canMap(v)) {
+		return false
+	}
+
+	r.unmap(cmd.key)
+	r.counter("mapping_repairs", t.serverOf(pool), 1)
+	r.log().Info("Mapping repaired", "key", cmd.key, "server", t.serverOf(pool))
+	return true
+}
+
+// Counts a rejected reply for the input key, or clears the count for an accepted one.
+// Returns true, clearing the count, if the key reaches the threshold.
+func (m *mappingRepair) rejectedReply(key string, rejected bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !rejected {
+		delete(m.rejected, key)
+		return false
+	}
+
+	n := m.rejected[key] + 1
+	if n >= m.threshold {
+		delete(m.rejected, key)
+		return true
+	}
+
+	if len(m.rejected) >= maxRepairCandidates {
+		m.rejected = make(map[string]int)
+	}
+	m.rejected[key] = n
+	return false
+}
+
+// WithBlockingRediscovery makes blocking commands, such as BLPOP, look for their key on the other instances once
+// they time out on the mapped instance the input number of times in a row. After a resharding, items may be pushed
+// to a key on an instance other than the one it is mapped to, where a blocking pop waits for them indefinitely.
+// The other live instances are asked with EXISTS, which does not block. If one holds the key, the key is mapped
+// to it and the command is run there before returning; otherwise the timeout is returned and the mapping is kept.
+// Unlike WithMappingRepair, a timeout is never followed by a second blocking fan-out.
+func WithBlockingRediscovery(timeouts int) Option {
+	return func(r *ProxyConn) {
+		if timeouts < 1 {
+			timeouts = 1
+		}
+		r.blockingRepair = &mappingRepair{threshold: timeouts, rejected: make(map[string]int)}
+	}
+}
+
+// Records whether a blocking command on the mapped pool for its key timed out, which the canMap test rejects.
+// Once the key reaches the threshold of timeouts, the other live pools are checked for it. If one holds it,
+// the key is mapped to that pool, which is returned with true; the command should be run there.
+func (r *ProxyConn) rediscoverBlocked(
+	ctx context.Context,
+	t *topology,
+	pool ConnGetter,
+	cmd *RedisCmd,
+	canMap func(interface{}) bool,
+	v interface{},
+	err error) (ConnGetter, bool) {
+
+	if r.blockingRepair == nil || canMap == nil || err != nil || ctx.Err() != nil || !r.blocking(cmd.name) {
+		return nil, false
+	}
+
+	if !r.blockingRepair.rejectedReply(cmd.key, !canMap(v)) {
+		return nil, false
+	}
+
+	server := t.serverOf(pool)
+	idxs := without(r.liveIndexes(t), t.indexOf(pool))
+	r.counter("blocking_rediscoveries", server, 1)
+	if len(idxs) == 0 {
+		return nil, false
+	}
+
+	exists := &RedisCmd{name: "EXISTS", key: cmd.key, noCache: true, probe: true}
+	res := r.discover(ctx, t, idxs, exists, func(v interface{}) bool {
+		n, ok := replyInt(v)
+		return ok && n > 0
+	})
+	if res.pool < 0 {
+		return nil, false
+	}
+
+	moved := t.pools[res.pool]
+	r.mapKey(cmd.key, moved)
+	r.counter("blocking_remaps", t.server(res.pool), 1)
+	r.log().Info("Mapping moved after blocking timeouts", "key", cmd.key, "from", server, "to", t.server(res.pool))
+	return moved, true
+}
@@ -0,0 +1,87 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestMappingRepairRediscoversAfterRejectedReplies(t *testing.T) {
+	stale, holder := connPool{&nilStyleConn{}}, connPool{&nilStyleConn{reply: "VALUE"}}
+	proxy := getMockProxy(stale, holder)
+	WithMappingRepair(2)(proxy)
+	proxy.mapKey("KEY", stale)
+
+	canMap := func(v interface{}) bool { return v != nil }
+	if v, _ := proxy.Do(NewRedisCmd("GET", "KEY"), canMap); v != nil {
+		t.Fatalf("Expected the stale instance's reply below the threshold, got %v", v)
+	}
+
+	v, err := proxy.Do(NewRedisCmd("GET", "KEY"), canMap)
+	if err != nil || v != "VALUE" {
+		t.Fatalf("Expected the key to be rediscovered, got %v, %v", v, err)
+	}
+	if pool, _ := proxy.lookup("KEY"); pool != holder {
+		t.Fatal("Expected the key to be mapped to the instance holding it.")
+	}
+}
+
+func TestMappingRepairResetsOnAcceptedReply(t *testing.T) {
+	m := &mappingRepair{threshold: 2, rejected: make(map[string]int)}
+	m.rejectedReply("KEY", true)
+	m.rejectedReply("KEY", false)
+	if m.rejectedReply("KEY", true) {
+		t.Fatal("Expected an accepted reply to reset the count.")
+	}
+	if !m.rejectedReply("KEY", true) {
+		t.Fatal("Expected the threshold to be reached.")
+	}
+}
+
+func TestBlockingRediscoveryMovesKeyAfterTimeouts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	WithBlockingRediscovery(2)(proxy)
+	proxy.mapKey("KEY", mockPool1)
+
+	mockConn1.EXPECT().Do("BLPOP", "KEY", 1.0).Return(nil, nil).Times(2)
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Do("EXISTS", "KEY").Return(int64(1), nil)
+	mockConn2.EXPECT().Do("BLPOP", "KEY", 1.0).Return([]interface{}{[]byte("KEY"), []byte("VALUE")}, nil)
+	mockConn2.EXPECT().Close().Times(2)
+
+	if _, err := proxy.BLPop("KEY", time.Second); err == nil {
+		t.Fatal("Expected a timeout below the threshold.")
+	}
+	if v, err := proxy.BLPop("KEY", time.Second); err != nil || v != "VALUE" {
+		t.Fatalf("Expected the value from the instance now holding the key, got %v, %v", v, err)
+	}
+	if pool, _ := proxy.lookup("KEY"); pool != mockPool2 {
+		t.Fatal("Expected the key to be mapped to the instance holding it.")
+	}
+}
+
+func TestBlockingRediscoveryKeepsMappingWhenNoInstanceHoldsKey(t *testing.T) {
+	stale, other := connPool{&nilStyleConn{}}, connPool{&nilStyleConn{reply: int64(0)}}
+	proxy := getMockProxy(stale, other)
+	WithBlockingRediscovery(1)(proxy)
+	proxy.mapKey("KEY", stale)
+
+	if _, err := proxy.BLPop("KEY", time.Second); err == nil {
+		t.Fatal("Expected a timeout.")
+	}
+	if pool, _ := proxy.lookup("KEY"); pool != stale {
+		t.Fatal("Expected the mapping to be kept.")
+	}
+	if n := proxy.SnapshotStats().Counters["blocking_rediscoveries"]["1"]; n != 0 {
+		t.Fatalf("Unexpected count for the other instance: %v", n)
+	}
+	if n := proxy.SnapshotStats().Counters["blocking_rediscoveries"]["0"]; n != 1 {
+		t.Fatalf("Expected one rediscovery, got %v", n)
+	}
+}
@@ -0,0 +1,153 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// ReadPreference determines where read-only commands for mapped keys are run.
+type ReadPreference int
+
+const (
+	// ReadPrimary runs every command on the instance the key is mapped to. This is the default.
+	ReadPrimary ReadPreference = iota
+
+	// ReadReplicaPreferred runs read-only commands on a replica of the instance the key is mapped to,
+	// taking each replica in turn, and falls back to the instance itself if the replica is unavailable.
+	ReadReplicaPreferred
+)
+
+// DefaultReplicaReads are the read-only commands routed to replicas if WithReadPreference is given no commands.
+var DefaultReplicaReads = []string{
+	"EXISTS", "GET", "GETRANGE", "HEXISTS", "HGET", "HGETALL", "HKEYS", "HLEN", "HMGET", "HVALS",
+	"LINDEX", "LLEN", "LRANGE", "MGET", "PTTL", "SCARD", "SISMEMBER", "SMEMBERS", "SRANDMEMBER", "STRLEN",
+	"TTL", "TYPE", "ZCARD", "ZCOUNT", "ZRANGE", "ZRANGEBYSCORE", "ZRANK", "ZREVRANGE", "ZREVRANK", "ZSCORE",
+}
+
+// WithReadPreference routes the input read-only commands, or DefaultReplicaReads if none are given, according to
+// the input preference. Replicas are registered for each instance with RegisterReplicas.
+// Commands for keys that are not yet mapped are discovered on the instances themselves, as are blocking pops,
+// which remove data and so cannot run on replicas. Replicas may lag their instance, so reads from them may be stale.
+func WithReadPreference(pref ReadPreference, commands ...string) Option {
+	return func(r *ProxyConn) {
+		if len(commands) == 0 {
+			commands = DefaultReplicaReads
+		}
+
+		rr := &readRouting{pref: pref, commands: make(map[string]bool, len(commands))}
+		for _, c := range commands {
+			rr.commands[strings.ToUpper(c)] = true
+		}
+		r.reads = rr
+	}
+}
+
+// RegisterReplicas registers the input pools as replicas of the instance with the input address, replacing any
+// registered before. Registering no pools removes the replicas of the instance.
+// Replicas are kept by address, so they survive the pool of the instance being rebuilt.
+// An error is returned if no instance has the address.
+func (r *ProxyConn) RegisterReplicas(server string, replicas ...ConnGetter) error {
+	if _, err := r.topology().index(server); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.replicas == nil {
+		r.replicas = make(map[string][]ConnGetter)
+	}
+	if len(replicas) == 0 {
+		delete(r.replicas, server)
+		return nil
+	}
+	r.replicas[server] = append([]ConnGetter(nil), replicas...)
+	return nil
+}
+
+// The read preference and the commands it applies to.
+type readRouting struct {
+	pref     ReadPreference
+	commands map[string]bool
+	next     uint64
+}
+
+// Returns the replica to run the named command on instead of the pool at the input index, or nil if there is none.
+func (r *ProxyConn) replicaFor(t *topology, i int, name string) ConnGetter {
+	rr := r.reads
+	if rr == nil || rr.pref != ReadReplicaPreferred || !rr.commands[strings.ToUpper(name)] {
+		return nil
+	}
+
+	r.mu.Lock()
+	replicas := r.replicas[t.server(i)]
+	r.mu.Unlock()
+	if len(replicas) == 0 {
+		return nil
+	}
+	return replicas[atomic.AddUint64(&rr.next, 1)%uint64(len(replicas))]
+}
+
+// Runs the input function for the named command on a connection to a replica of the pool at the input index,
+// if the read preference allows, or else or if the replica is unavailable, on a connection from the pool itself.
+func (r *ProxyConn) read(t *topology, i int, name string, fn func(Conn) error) error {
+	if replica := r.replicaFor(t, i, name); replica != nil {
+		c := replica.Get()
+		err := fn(c)
+		c.Close()
+
+		if !replicaUnavailable(err) {
+			r.counter("replica_reads", t.server(i), 1)
+			return err
+		}
+		r.counter("replica_fallbacks", t.server(i), 1)
+	}
+
+	c := t.pools[i].Get()
+	defer c.Close()
+	return fn(c)
+}
+
+// Runs the input command for a mapped key on a replica of its pool, as for read.
+// False is returned if the command is not routed to a replica, or the replica is unavailable,
+// in which case the command should be run on the pool itself.
+func (r *ProxyConn) readReplica(ctx context.Context, t *topology, pool ConnGetter, cmd *RedisCmd) (redisReturn, bool) {
+	i := t.indexOf(pool)
+	if i < 0 {
+		return redisReturn{}, false
+	}
+
+	replica := r.replicaFor(t, i, cmd.name)
+	if replica == nil {
+		return redisReturn{}, false
+	}
+
+	c := replica.Get()
+	defer c.Close()
+	v, err := r.intercept(ctx, t.server(i), false, cmd, func() (interface{}, error) {
+		return r.runContext(ctx, c, cmd)
+	})
+	if replicaUnavailable(err) && ctx.Err() == nil {
+		r.counter("replica_fallbacks", t.server(i), 1)
+		return redisReturn{}, false
+	}
+
+	r.counter("replica_reads", t.server(i), 1)
+	return redisReturn{val: v, err: err, pool: i}, true
+}
+
+// Indicates whether the input error from a replica means the read should be run on its instance instead:
+// the replica is unreachable or open-circuited, still loading its data, or has lost its link to the master
+// and is configured not to serve stale data.
+func replicaUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if isUnavailable(err) || errors.Is(err, ErrPoolUnavailable) {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.HasPrefix(msg, "LOADING") || strings.HasPrefix(msg, "MASTERDOWN")
+}
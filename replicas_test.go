@@ -0,0 +1,65 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"io"
+	"testing"
+)
+
+func TestReadPreferenceRoutesMappedReadsToReplicas(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primaryConn, primary := setupMockPool(ctrl)
+	replicaConn, replica := setupMockPool(ctrl)
+	replicaConn.EXPECT().Do("GET", "KEY").Return("replicated", nil)
+	replicaConn.EXPECT().Close()
+	primaryConn.EXPECT().Do("SET", "KEY", "V").Return("OK", nil)
+	primaryConn.EXPECT().Close()
+
+	proxy := getMockProxy(primary)
+	proxy.Servers = []string{"10.0.0.1:6379:1"}
+	WithReadPreference(ReadReplicaPreferred)(proxy)
+	if err := proxy.RegisterReplicas("10.0.0.1:6379", replica); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	proxy.mapKey("KEY", primary)
+
+	accept := func(v interface{}) bool { return v != nil }
+	if v, err := proxy.Do(NewRedisCmd("GET", "KEY"), accept); err != nil || v != "replicated" {
+		t.Fatalf("Unexpected reply %v, %v", v, err)
+	}
+	if _, err := proxy.Do(NewRedisCmd("SET", "KEY", "V"), accept); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestReadPreferenceFallsBackToPrimary(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primaryConn, primary := setupMockPool(ctrl)
+	replicaConn, replica := setupMockPool(ctrl)
+	replicaConn.EXPECT().Do("MGET", "A").Return(nil, io.EOF)
+	replicaConn.EXPECT().Close()
+	primaryConn.EXPECT().Do("MGET", "A").Return([]interface{}{"1"}, nil)
+	primaryConn.EXPECT().Close()
+
+	proxy := getMockProxy(primary)
+	proxy.Servers = []string{"10.0.0.1:6379:1"}
+	WithReadPreference(ReadReplicaPreferred, "mget")(proxy)
+	proxy.RegisterReplicas("10.0.0.1:6379", replica)
+
+	if v, err := proxy.MGet("A"); err != nil || len(v) != 1 || v[0] != "1" {
+		t.Fatalf("Unexpected reply %v, %v", v, err)
+	}
+}
+
+func TestRegisterReplicasRequiresKnownServer(t *testing.T) {
+	proxy := getMockProxy(nil)
+	proxy.Servers = []string{"10.0.0.1:6379:1"}
+
+	if err := proxy.RegisterReplicas("10.0.0.9:6379", nil); err == nil {
+		t.Fatal("Expected error for unknown server.")
+	}
+}
@@ -0,0 +1,231 @@
+package twunproxy
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The interval between INFO polls while waiting for replication to catch up.
+var offsetPollInterval = 100 * time.Millisecond
+
+// WaitForOffset blocks until the instance with the input address reports a replication offset of at least the input value.
+// For replicas the processed offset (slave_repl_offset) is used, otherwise the master offset.
+// An error is returned if the offset is not reached before the timeout elapses.
+func (r *ProxyConn) WaitForOffset(server string, offset int64, timeout time.Duration) error {
+	t := r.topology()
+	i, err := t.index(server)
+	if err != nil {
+		return err
+	}
+
+	c := t.pools[i].Get()
+	defer c.Close()
+
+	return pollReplication(c, timeout, func(info map[string]string) (bool, error) {
+		field := "master_repl_offset"
+		if info["role"] == "slave" {
+			field = "slave_repl_offset"
+		}
+
+		cur, err := strconv.ParseInt(info[field], 10, 64)
+		if err != nil {
+			return false, errors.New("Unable to read replication offset.")
+		}
+		return cur >= offset, nil
+	})
+}
+
+// BarrierAll waits until every replica attached to each master instance in the pool has caught up with its master.
+// The master replication offset of each instance is recorded first, then INFO is polled until all attached replicas
+// report an offset at least as large. Instances that are themselves replicas are skipped.
+// This is intended to be used after PauseAll and before Promote, so that promoted replicas have all acknowledged writes.
+func (r *ProxyConn) BarrierAll(timeout time.Duration) error {
+	return firstError(r.topology().forEach(func(_ int, c Conn) error {
+		info, err := replicationInfo(c)
+		if err != nil || info["role"] != "master" {
+			return err
+		}
+
+		target, err := strconv.ParseInt(info["master_repl_offset"], 10, 64)
+		if err != nil {
+			return errors.New("Unable to read replication offset.")
+		}
+
+		return pollReplication(c, timeout, func(info map[string]string) (bool, error) {
+			for _, off := range replicaOffsets(info) {
+				if off < target {
+					return false, nil
+				}
+			}
+			return true, nil
+		})
+	}))
+}
+
+// Polls INFO replication on the input connection until the done function returns true, an error occurs,
+// or the timeout elapses.
+func pollReplication(c Conn, timeout time.Duration, done func(map[string]string) (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		info, err := replicationInfo(c)
+		if err != nil {
+			return err
+		}
+
+		if ok, err := done(info); ok || err != nil {
+			return err
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("Timed out waiting for replication offset.")
+		}
+		time.Sleep(offsetPollInterval)
+	}
+}
+
+// Runs INFO replication on the input connection and returns the parsed fields.
+func replicationInfo(c Conn) (map[string]string, error) {
+	v, err := c.Do("INFO", "replication")
+	if err != nil {
+		return nil, err
+	}
+	return parseInfo(v)
+}
+
+// ReplicaStatus describes a replica attached to a master, as the master reports it.
+// Lag is the number of bytes of the replication stream the replica has yet to acknowledge,
+// and LagSeconds the seconds since it last acknowledged any.
+type ReplicaStatus struct {
+	Addr       string `json:"addr"`
+	State      string `json:"state"`
+	Offset     int64  `json:"offset"`
+	Lag        int64  `json:"lag"`
+	LagSeconds int64  `json:"lag_seconds"`
+}
+
+// ReplicationStatus describes the replication of one instance, from INFO replication.
+// Offset is the master replication offset for masters, and the processed offset for replicas.
+// Masters list their attached replicas. Replicas give the address of their master and the status of their link
+// to it; if their master is another instance of the pool, Lag is the number of bytes they are behind it,
+// and otherwise -1. Instances that fail carry their error.
+type ReplicationStatus struct {
+	Server           string          `json:"server"`
+	Name             string          `json:"name"`
+	Role             string          `json:"role"`
+	Offset           int64           `json:"offset"`
+	Replicas         []ReplicaStatus `json:"replicas,omitempty"`
+	MasterAddr       string          `json:"master_addr,omitempty"`
+	MasterLinkStatus string          `json:"master_link_status,omitempty"`
+	Lag              int64           `json:"lag"`
+	Err              error           `json:"-"`
+}
+
+// MaxLag returns the greatest lag in bytes of the replicas attached to the instance, or 0 if it has none.
+func (s ReplicationStatus) MaxLag() int64 {
+	var max int64
+	for _, rs := range s.Replicas {
+		if rs.Lag > max {
+			max = rs.Lag
+		}
+	}
+	return max
+}
+
+// ReplicationStatus queries INFO replication on every instance concurrently and returns the replication of each,
+// such as to check that replicas are linked and caught up before Promote, or before a BGSAVE across the pool.
+// The first error is returned with the results, or a PartialError if partial results are enabled.
+func (r *ProxyConn) ReplicationStatus() ([]ReplicationStatus, error) {
+	t := r.topology()
+	res := make([]ReplicationStatus, len(t.pools))
+
+	errs := t.forEach(func(i int, c Conn) error {
+		info, err := replicationInfo(c)
+		if err != nil {
+			return err
+		}
+		res[i] = decodeReplication(info)
+		return nil
+	})
+
+	masters := make(map[string]int64)
+	for i, err := range errs {
+		res[i].Server = t.server(i)
+		res[i].Name = t.instance(i).Name
+		res[i].Err = err
+		if err == nil && res[i].Role == "master" {
+			masters[res[i].Server] = res[i].Offset
+		}
+	}
+
+	for i := range res {
+		if res[i].Role != "slave" {
+			continue
+		}
+		res[i].Lag = -1
+		if off, ok := masters[res[i].MasterAddr]; ok {
+			res[i].Lag = off - res[i].Offset
+		}
+	}
+	return res, r.fanOutError(t, errs)
+}
+
+// Decodes the input INFO replication fields.
+func decodeReplication(info map[string]string) ReplicationStatus {
+	num := func(field string) int64 {
+		n, _ := strconv.ParseInt(info[field], 10, 64)
+		return n
+	}
+
+	s := ReplicationStatus{Role: info["role"]}
+	if s.Role == "slave" {
+		s.Offset = num("slave_repl_offset")
+		s.MasterAddr = net.JoinHostPort(info["master_host"], info["master_port"])
+		s.MasterLinkStatus = info["master_link_status"]
+		return s
+	}
+
+	s.Offset = num("master_repl_offset")
+	s.Replicas = replicaEntries(info)
+	for i := range s.Replicas {
+		s.Replicas[i].Lag = s.Offset - s.Replicas[i].Offset
+	}
+	return s
+}
+
+// Extracts the attached replicas from master INFO replication fields, in order.
+// Replica entries take the form "slave0:ip=10.0.0.1,port=6379,state=online,offset=1234,lag=0".
+func replicaEntries(info map[string]string) []ReplicaStatus {
+	var replicas []ReplicaStatus
+
+	for n := 0; ; n++ {
+		v, ok := info["slave"+strconv.Itoa(n)]
+		if !ok {
+			return replicas
+		}
+
+		fields := make(map[string]string)
+		for _, kv := range strings.Split(v, ",") {
+			if i := strings.Index(kv, "="); i > 0 {
+				fields[kv[:i]] = kv[i+1:]
+			}
+		}
+
+		rs := ReplicaStatus{Addr: net.JoinHostPort(fields["ip"], fields["port"]), State: fields["state"]}
+		rs.Offset, _ = strconv.ParseInt(fields["offset"], 10, 64)
+		rs.LagSeconds, _ = strconv.ParseInt(fields["lag"], 10, 64)
+		replicas = append(replicas, rs)
+	}
+}
+
+// Extracts the offsets of attached replicas from master INFO replication fields.
+func replicaOffsets(info map[string]string) []int64 {
+	var offsets []int64
+	for _, rs := range replicaEntries(info) {
+		offsets = append(offsets, rs.Offset)
+	}
+	return offsets
+}
@@ -0,0 +1,105 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestWaitForOffsetPollsUntilReplicaCatchesUp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	offsetPollInterval = time.Millisecond
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	gomock.InOrder(
+		mockConn.EXPECT().Do("INFO", "replication").Return([]byte("role:slave\r\nslave_repl_offset:90\r\n"), nil),
+		mockConn.EXPECT().Do("INFO", "replication").Return([]byte("role:slave\r\nslave_repl_offset:120\r\n"), nil),
+	)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.Servers = []string{"10.0.0.1:6379:1"}
+
+	if err := proxy.WaitForOffset("10.0.0.1:6379", 100, time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestWaitForOffsetTimesOut(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	offsetPollInterval = time.Millisecond
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("INFO", "replication").Return([]byte("role:slave\r\nslave_repl_offset:90\r\n"), nil).MinTimes(1)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.Servers = []string{"10.0.0.1:6379:1"}
+
+	if err := proxy.WaitForOffset("10.0.0.1:6379", 100, 10*time.Millisecond); err == nil {
+		t.Fatal("Expected timeout error.")
+	}
+}
+
+func TestBarrierAllWaitsForReplicasOfMasters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	offsetPollInterval = time.Millisecond
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	gomock.InOrder(
+		mockConn1.EXPECT().Do("INFO", "replication").Return([]byte(
+			"role:master\r\nslave0:ip=10.0.0.3,port=6379,state=online,offset=150,lag=1\r\nmaster_repl_offset:200\r\n"), nil),
+		mockConn1.EXPECT().Do("INFO", "replication").Return([]byte(
+			"role:master\r\nslave0:ip=10.0.0.3,port=6379,state=online,offset=150,lag=1\r\nmaster_repl_offset:210\r\n"), nil),
+		mockConn1.EXPECT().Do("INFO", "replication").Return([]byte(
+			"role:master\r\nslave0:ip=10.0.0.3,port=6379,state=online,offset=205,lag=0\r\nmaster_repl_offset:210\r\n"), nil),
+	)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("INFO", "replication").Return([]byte("role:slave\r\nslave_repl_offset:10\r\n"), nil)
+	mockConn2.EXPECT().Close()
+
+	if err := getMockProxy(mockPool1, mockPool2).BarrierAll(time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestReplicationStatusReportsRelationshipsAndLag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("INFO", "replication").Return([]byte("role:master\r\nconnected_slaves:2\r\n"+
+		"slave0:ip=10.0.0.2,port=6379,state=online,offset=180,lag=1\r\n"+
+		"slave1:ip=10.0.0.3,port=6379,state=wait_bgsave,offset=0,lag=4\r\nmaster_repl_offset:200\r\n"), nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("INFO", "replication").Return([]byte("role:slave\r\nmaster_host:10.0.0.1\r\nmaster_port:6379\r\n"+
+		"master_link_status:up\r\nslave_repl_offset:190\r\n"), nil)
+	mockConn2.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"10.0.0.1:6379:1 a", "10.0.0.2:6379:1 b"}
+
+	res, err := proxy.ReplicationStatus()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	master, replica := res[0], res[1]
+	if master.Role != "master" || master.Offset != 200 || len(master.Replicas) != 2 || master.MaxLag() != 200 {
+		t.Fatalf("Unexpected master status: %+v", master)
+	}
+	if r := master.Replicas[0]; r.Addr != "10.0.0.2:6379" || r.State != "online" || r.Lag != 20 || r.LagSeconds != 1 {
+		t.Fatalf("Unexpected replica entry: %+v", r)
+	}
+	if replica.Name != "b" || replica.MasterAddr != "10.0.0.1:6379" || replica.MasterLinkStatus != "up" || replica.Lag != 10 {
+		t.Fatalf("Unexpected replica status: %+v", replica)
+	}
+}
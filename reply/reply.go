@@ -0,0 +1,174 @@
+// Package reply converts the replies of twunproxy commands to Go types.
+// Each helper takes a reply and an error, so that the result of a command can be passed straight to it,
+// such as reply.String(proxy.Do(cmd, canMap)). An error passed in is returned unchanged.
+// Bulk strings may be given as []byte or string, as client libraries differ.
+package reply
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNil is returned when the reply is nil, such as for a missing key or a blocking pop that timed out.
+var ErrNil = errors.New("Nil reply.")
+
+// TypeError is returned when the reply is not of a type that can be converted to the requested one.
+type TypeError struct {
+	Want  string
+	Reply interface{}
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("Unexpected reply type %T for %s.", e.Reply, e.Want)
+}
+
+// String converts a bulk string, status or integer reply to a string.
+func String(v interface{}, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	switch t := v.(type) {
+	case []byte:
+		return string(t), nil
+	case string:
+		return t, nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case nil:
+		return "", ErrNil
+	}
+	return "", &TypeError{Want: "string", Reply: v}
+}
+
+// Bytes converts a bulk string or status reply to bytes.
+func Bytes(v interface{}, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := v.(type) {
+	case []byte:
+		return t, nil
+	case string:
+		return []byte(t), nil
+	case nil:
+		return nil, ErrNil
+	}
+	return nil, &TypeError{Want: "[]byte", Reply: v}
+}
+
+// Int64 converts an integer reply, or a bulk string holding an integer, to an int64.
+func Int64(v interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	switch t := v.(type) {
+	case int64:
+		return t, nil
+	case []byte:
+		return strconv.ParseInt(string(t), 10, 64)
+	case string:
+		return strconv.ParseInt(t, 10, 64)
+	case nil:
+		return 0, ErrNil
+	}
+	return 0, &TypeError{Want: "int64", Reply: v}
+}
+
+// Int converts a reply to an int as for Int64.
+func Int(v interface{}, err error) (int, error) {
+	n, err := Int64(v, err)
+	return int(n), err
+}
+
+// Bool converts an integer reply to true if it is not 0, or a bulk string such as "1" or "true" to a bool.
+func Bool(v interface{}, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+
+	switch t := v.(type) {
+	case int64:
+		return t != 0, nil
+	case []byte:
+		return strconv.ParseBool(string(t))
+	case string:
+		return strconv.ParseBool(t)
+	case nil:
+		return false, ErrNil
+	}
+	return false, &TypeError{Want: "bool", Reply: v}
+}
+
+// Values converts an array reply to a slice of its elements.
+func Values(v interface{}, err error) ([]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := v.(type) {
+	case []interface{}:
+		return t, nil
+	case nil:
+		return nil, ErrNil
+	}
+	return nil, &TypeError{Want: "[]interface{}", Reply: v}
+}
+
+// Strings converts an array reply of bulk strings to strings. Nil elements become empty strings.
+func Strings(v interface{}, err error) ([]string, error) {
+	values, err := Values(v, err)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, len(values))
+	for i, e := range values {
+		if e == nil {
+			continue
+		}
+		if res[i], err = String(e, nil); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// ByteSlices converts an array reply of bulk strings to byte slices. Nil elements remain nil.
+func ByteSlices(v interface{}, err error) ([][]byte, error) {
+	values, err := Values(v, err)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([][]byte, len(values))
+	for i, e := range values {
+		if e == nil {
+			continue
+		}
+		if res[i], err = Bytes(e, nil); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// StringMap converts an array reply of alternating fields and values, such as that of HGETALL, to a map.
+func StringMap(v interface{}, err error) (map[string]string, error) {
+	values, err := Strings(v, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("Reply has an odd number of elements for a map.")
+	}
+
+	res := make(map[string]string, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		res[values[i]] = values[i+1]
+	}
+	return res, nil
+}
@@ -0,0 +1,57 @@
+package reply
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScalarConversions(t *testing.T) {
+	if s, err := String([]byte("a"), nil); err != nil || s != "a" {
+		t.Fatalf("Unexpected string %q, %v", s, err)
+	}
+	if n, err := Int64([]byte("42"), nil); err != nil || n != 42 {
+		t.Fatalf("Unexpected int64 %d, %v", n, err)
+	}
+	if n, err := Int(int64(7), nil); err != nil || n != 7 {
+		t.Fatalf("Unexpected int %d, %v", n, err)
+	}
+	if b, err := Bool(int64(1), nil); err != nil || !b {
+		t.Fatalf("Unexpected bool %v, %v", b, err)
+	}
+	if _, err := String(nil, nil); err != ErrNil {
+		t.Fatalf("Expected ErrNil, got %v", err)
+	}
+
+	var te *TypeError
+	if _, err := Int64([]interface{}{}, nil); !errors.As(err, &te) || te.Want != "int64" {
+		t.Fatalf("Expected a TypeError, got %v", err)
+	}
+
+	cause := errors.New("ERR")
+	if _, err := String("a", cause); err != cause {
+		t.Fatalf("Expected the input error, got %v", err)
+	}
+}
+
+func TestArrayConversions(t *testing.T) {
+	v := []interface{}{[]byte("f1"), []byte("v1"), "f2", nil}
+
+	s, err := Strings(v, nil)
+	if err != nil || len(s) != 4 || s[0] != "f1" || s[3] != "" {
+		t.Fatalf("Unexpected strings %q, %v", s, err)
+	}
+
+	b, err := ByteSlices(v, nil)
+	if err != nil || string(b[2]) != "f2" || b[3] != nil {
+		t.Fatalf("Unexpected byte slices %q, %v", b, err)
+	}
+
+	m, err := StringMap(v, nil)
+	if err != nil || m["f1"] != "v1" || m["f2"] != "" {
+		t.Fatalf("Unexpected map %v, %v", m, err)
+	}
+
+	if _, err := StringMap(v[:3], nil); err == nil {
+		t.Fatal("Expected an error for an odd number of elements.")
+	}
+}
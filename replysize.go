@@ -0,0 +1,53 @@
+package twunproxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReplySizeError is returned in place of a reply larger than the maximum reply size for its command.
+// The reply has already been read by the client library, but is dropped rather than returned to the caller.
+type ReplySizeError struct {
+	Command string
+	Size    int64
+	Max     int64
+}
+
+func (e *ReplySizeError) Error() string {
+	return fmt.Sprintf("Reply to %s of %d bytes exceeds the maximum of %d.", e.Command, e.Size, e.Max)
+}
+
+// WithMaxReplySize sets the largest reply, in bytes, accepted for commands with the input name, or for every
+// command without a limit of its own if the name is empty. Larger replies fail with a ReplySizeError and are counted
+// as "oversized_replies", so that an accidental LRANGE key 0 -1 on a huge list cannot flow on into the caller.
+// Sizes are measured as for cost accounting, from string lengths rather than the wire protocol.
+// To stop the reply being read at all, also bound reads in the client library, such as with a read timeout.
+func WithMaxReplySize(name string, n int64) Option {
+	return func(r *ProxyConn) {
+		if r.maxReplySizes == nil {
+			r.maxReplySizes = make(map[string]int64)
+		}
+		r.maxReplySizes[strings.ToUpper(name)] = n
+	}
+}
+
+// Returns a ReplySizeError if the reply is larger than the maximum for the command.
+func (r *ProxyConn) guardReplySize(cmd *RedisCmd, v interface{}) error {
+	if r.maxReplySizes == nil {
+		return nil
+	}
+
+	max, ok := r.maxReplySizes[strings.ToUpper(cmd.name)]
+	if !ok {
+		max, ok = r.maxReplySizes[""]
+	}
+	if !ok || max <= 0 {
+		return nil
+	}
+
+	if size := replySize(v); size > max {
+		r.counter("oversized_replies", "", 1)
+		return &ReplySizeError{Command: cmd.name, Size: size, Max: max}
+	}
+	return nil
+}
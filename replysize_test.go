@@ -0,0 +1,24 @@
+package twunproxy
+
+import (
+	"testing"
+)
+
+func TestMaxReplySizeRejectsLargeReplies(t *testing.T) {
+	reply := []interface{}{[]byte("aaaa"), []byte("bbbb")}
+	pool := connPool{&nilStyleConn{reply: reply}}
+	proxy := getMockProxy(pool)
+	proxy.KeyInstance["KEY"] = pool
+	WithMaxReplySize("", 100)(proxy)
+	WithMaxReplySize("lrange", 6)(proxy)
+
+	canMap := func(v interface{}) bool { return v != nil }
+	_, err := proxy.Do(NewRedisCmd("LRANGE", "KEY", 0, -1), canMap)
+	if se, ok := err.(*ReplySizeError); !ok || se.Size != 8 || se.Max != 6 {
+		t.Fatalf("Expected reply size error, got %v", err)
+	}
+
+	if _, err := proxy.Do(NewRedisCmd("SMEMBERS", "KEY"), canMap); err != nil {
+		t.Fatalf("Expected the default limit to allow the reply, got %v", err)
+	}
+}
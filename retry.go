@@ -0,0 +1,90 @@
+package twunproxy
+
+import (
+	"context"
+	"time"
+)
+
+// Defaults for RetryPolicy.
+const (
+	DefaultRetryAttempts   = 3
+	DefaultRetryBaseDelay  = 50 * time.Millisecond
+	DefaultRetryMaxBackoff = time.Second
+)
+
+// RetryPolicy retries commands that fail with transient errors.
+// MaxAttempts bounds the number of times a command is run, including the first.
+// Backoff returns the delay before the input retry, counting from 1. Retryable decides which errors are retried.
+// Zero values take the defaults: DefaultRetryAttempts, ExponentialBackoff with the default delays,
+// and retrying connection failures but not error replies from Redis.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     func(retry int) time.Duration
+	Retryable   func(err error) bool
+}
+
+// WithRetryPolicy makes Do and the command helpers retry commands that fail with a retryable error,
+// waiting for the backoff before each retry. Helpers that place their keys, such as Transaction, WriteAndWait
+// and MSet, retry the placement and the command together. Retries stop once the context ends.
+// A retried command may already have run on the instance before its connection failed,
+// so commands that are not idempotent, such as blocking pops, may lose or repeat their effect.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(r *ProxyConn) {
+		if p.MaxAttempts <= 0 {
+			p.MaxAttempts = DefaultRetryAttempts
+		}
+		if p.Backoff == nil {
+			p.Backoff = ExponentialBackoff(DefaultRetryBaseDelay, DefaultRetryMaxBackoff)
+		}
+		if p.Retryable == nil {
+			p.Retryable = isUnavailable
+		}
+		r.retry = &p
+	}
+}
+
+// ExponentialBackoff returns a backoff doubling from the base delay with each retry, up to the maximum.
+func ExponentialBackoff(base, max time.Duration) func(retry int) time.Duration {
+	return func(retry int) time.Duration {
+		d := base
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// Runs the input command as for do, retrying it according to the retry policy if there is one.
+func (r *ProxyConn) doRetry(ctx context.Context, cmd *RedisCmd, canMap func(interface{}) bool) (interface{}, error) {
+	var v interface{}
+	err := r.retrying(ctx, cmd.name, cmd.key, func() (err error) {
+		v, err = r.do(ctx, cmd, canMap)
+		return err
+	})
+	return v, err
+}
+
+// Runs the input function, retrying it according to the retry policy if there is one.
+// The command name and key are those logged for each retry.
+func (r *ProxyConn) retrying(ctx context.Context, name, key string, fn func() error) error {
+	err := fn()
+	if r.retry == nil {
+		return err
+	}
+
+	for retry := 1; retry < r.retry.MaxAttempts && err != nil && ctx.Err() == nil && r.retry.Retryable(err); retry++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.retry.Backoff(retry)):
+		}
+
+		r.counter("retries", "", 1)
+		r.log().Info("Command retried", "command", name, "key", key, "attempt", retry+1, "err", err)
+		err = fn()
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// A connection that fails with a network error for its first commands.
+type failNConn struct {
+	failures int
+	calls    int
+}
+
+func (c *failNConn) Do(string, ...interface{}) (interface{}, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}
+	}
+	return "VALUE", nil
+}
+
+func (c *failNConn) Close() error { return nil }
+
+func TestRetryPolicyRetriesTransientErrors(t *testing.T) {
+	conn := &failNConn{failures: 2}
+	pool := connPool{conn}
+	proxy := getMockProxy(pool)
+	proxy.mapKey("KEY", pool)
+
+	metrics := newFakeMetrics()
+	WithMetrics(metrics)(proxy)
+	WithRetryPolicy(RetryPolicy{Backoff: func(int) time.Duration { return time.Millisecond }})(proxy)
+
+	v, err := proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil })
+	if err != nil || v != "VALUE" {
+		t.Fatalf("Expected the command to succeed on retry, got %v, %v", v, err)
+	}
+	if conn.calls != 3 || metrics.get("retries", "") != 2 {
+		t.Fatalf("Expected 2 retries, got %d calls and %v retries", conn.calls, metrics.get("retries", ""))
+	}
+}
+
+func TestRetryPolicyStopsAtMaxAttempts(t *testing.T) {
+	conn := &failNConn{failures: 5}
+	pool := connPool{conn}
+	proxy := getMockProxy(pool)
+	proxy.mapKey("KEY", pool)
+	WithRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: func(int) time.Duration { return time.Millisecond }})(proxy)
+
+	if _, err := proxy.Do(NewRedisCmd("GET", "KEY"), nil); !isUnavailable(err) {
+		t.Fatalf("Expected the connection error, got %v", err)
+	}
+	if conn.calls != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", conn.calls)
+	}
+}
+
+func TestRetryPolicyDoesNotRetryErrorReplies(t *testing.T) {
+	conn := &nilStyleConn{err: errors.New("WRONGTYPE")}
+	pool := connPool{conn}
+	proxy := getMockProxy(pool)
+	proxy.mapKey("KEY", pool)
+	WithRetryPolicy(RetryPolicy{})(proxy)
+
+	start := time.Now()
+	if _, err := proxy.Do(NewRedisCmd("GET", "KEY"), nil); err == nil || err.Error() != "WRONGTYPE" {
+		t.Fatalf("Expected the error reply, got %v", err)
+	}
+	if time.Since(start) >= DefaultRetryBaseDelay {
+		t.Fatal("Expected no backoff for an error reply.")
+	}
+}
+
+func TestRetryPolicyStopsWhenContextEnds(t *testing.T) {
+	conn := &failNConn{failures: 5}
+	pool := connPool{conn}
+	proxy := getMockProxy(pool)
+	proxy.mapKey("KEY", pool)
+	WithRetryPolicy(RetryPolicy{MaxAttempts: 5, Backoff: func(int) time.Duration { return time.Hour }})(proxy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := proxy.DoContext(ctx, NewRedisCmd("GET", "KEY"), nil); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the context error, got %v", err)
+	}
+}
+
+func TestExponentialBackoffDoublesUpToMax(t *testing.T) {
+	b := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	for i, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if got := b(i + 1); got != want*time.Millisecond {
+			t.Fatalf("Retry %d: expected %v, got %v", i+1, want*time.Millisecond, got)
+		}
+	}
+}
+
+// A pool whose first connections fail to dial.
+type dialFailPool struct {
+	failures int
+	gets     int
+	conn     Conn
+}
+
+func (p *dialFailPool) Get() Conn {
+	p.gets++
+	if p.gets <= p.failures {
+		return &nilStyleConn{err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	}
+	return p.conn
+}
+
+func TestRetryPolicyAppliesToKeyedHelpers(t *testing.T) {
+	pool := &dialFailPool{failures: 1, conn: &nilStyleConn{reply: int64(1)}}
+	proxy := getMockProxy(pool)
+	proxy.mapKey("KEY", pool)
+
+	metrics := newFakeMetrics()
+	WithMetrics(metrics)(proxy)
+	WithRetryPolicy(RetryPolicy{Backoff: func(int) time.Duration { return time.Millisecond }})(proxy)
+
+	if n, err := proxy.SetBit("KEY", 7, 1); err != nil || n != 1 {
+		t.Fatalf("Expected SetBit to succeed on retry, got %v, %v", n, err)
+	}
+
+	pool.gets, pool.failures = 0, 1
+	if _, n, err := proxy.WriteAndWait(NewRedisCmd("SET", "KEY", "v"), 1, time.Second); err != nil || n != 1 {
+		t.Fatalf("Expected WriteAndWait to succeed on retry, got %v, %v", n, err)
+	}
+	if metrics.get("retries", "") != 2 {
+		t.Fatalf("Expected 2 retries, got %v", metrics.get("retries", ""))
+	}
+}
@@ -0,0 +1,137 @@
+package twunproxy
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Twemproxy ketama constants.
+const (
+	ketamaPointsPerServer = 160
+	ketamaPointsPerHash   = 4
+)
+
+// HashRing places keys on instances the same way Twemproxy does for a pool's hash and distribution settings.
+// Ketama and modula distributions are deterministic. The random distribution has no fixed placement.
+type hashRing struct {
+	hash     hashFunc
+	hashName string
+	dist     string
+	tag      string
+	modula   bool
+	random   bool
+	points   []ringPoint
+}
+
+// A point on the continuum. For modula distributions the value is unused.
+type ringPoint struct {
+	value uint32
+	index int
+}
+
+// Settings for routing unmapped keys by the hash ring rather than by discovery.
+type hashRouting struct {
+	fallback bool
+}
+
+// WithHashRouting sends commands for unmapped keys only to the instance that Twemproxy would place them on,
+// computed from the hash and distribution settings of the pool. This avoids the discovery fan-out,
+// so that blocking commands such as BLPOP are never issued to the wrong instances.
+// If fallback is true and the owning instance does not return an accepted result, the other instances are probed,
+// which finds keys written before a topology change. Such misses are counted as "hash_routing_misses".
+// Pools with the random distribution or an unsupported hash function are still routed by discovery.
+// It is the same as WithDiscoveryStrategy with HashRouting.
+func WithHashRouting(fallback bool) Option {
+	return WithDiscoveryStrategy(HashRouting{Fallback: fallback})
+}
+
+// Builds the ring for the input server descriptors, hash function name, distribution name and hash tag.
+// If the hash tag is set, only the part of each key within its delimiters is hashed, as Twemproxy does.
+// Every server is treated as live; ejected hosts are not taken into account.
+func newHashRing(servers []string, hash, dist, tag string) (*hashRing, error) {
+	f, err := getHashFunc(hash)
+	if err != nil {
+		return nil, err
+	}
+	if tag != "" && len(tag) != 2 {
+		return nil, errors.New("Hash tag must be two characters.")
+	}
+
+	h := &hashRing{hash: f, hashName: hash, dist: dist, tag: tag}
+	switch dist {
+	case "", "ketama":
+		h.points = ketamaPoints(servers)
+	case "modula":
+		h.modula = true
+		h.points = modulaPoints(servers)
+	case "random":
+		h.random = true
+	default:
+		return nil, errors.New("Unsupported distribution " + dist + ".")
+	}
+	return h, nil
+}
+
+// Returns the index of the server that the input key is placed on.
+// False is returned if placement is not deterministic or there are no servers.
+func (h *hashRing) owner(key string) (int, bool) {
+	if h == nil || h.random || len(h.points) == 0 {
+		return -1, false
+	}
+
+	v := h.hash([]byte(hashTagOf(key, h.tag)))
+	if h.modula {
+		return h.points[v%uint32(len(h.points))].index, true
+	}
+
+	i := sort.Search(len(h.points), func(i int) bool { return h.points[i].value >= v })
+	if i == len(h.points) {
+		i = 0
+	}
+	return h.points[i].index, true
+}
+
+// Builds the sorted ketama continuum. Each server receives points in proportion to its weight,
+// calculated in single precision exactly as Twemproxy does so that rounding agrees.
+func ketamaPoints(servers []string) []ringPoint {
+	var total int
+	names := make([]string, len(servers))
+	weights := make([]int, len(servers))
+	for i, s := range servers {
+		_, names[i], weights[i] = parseServer(s)
+		total += weights[i]
+	}
+
+	var points []ringPoint
+	for i := range servers {
+		pct := float32(weights[i]) / float32(total)
+		n := uint32(math.Floor(float64(float32(float64(pct*ketamaPointsPerServer/4*float32(len(servers)))+0.0000000001)))) * 4
+
+		for p := uint32(0); p < n/ketamaPointsPerHash; p++ {
+			digest := md5.Sum([]byte(names[i] + "-" + strconv.FormatUint(uint64(p), 10)))
+			for x := 0; x < ketamaPointsPerHash; x++ {
+				v := binary.LittleEndian.Uint32(digest[x*4:])
+				points = append(points, ringPoint{value: v, index: i})
+			}
+		}
+	}
+
+	sort.Slice(points, func(a, b int) bool { return points[a].value < points[b].value })
+	return points
+}
+
+// Builds the modula continuum, where each server appears once per unit of weight.
+func modulaPoints(servers []string) []ringPoint {
+	var points []ringPoint
+	for i, s := range servers {
+		_, _, w := parseServer(s)
+		for j := 0; j < w; j++ {
+			points = append(points, ringPoint{index: i})
+		}
+	}
+	return points
+}
@@ -0,0 +1,197 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"os"
+	"testing"
+)
+
+func TestParseServerDescriptors(t *testing.T) {
+	cases := []struct {
+		desc, addr, name string
+		weight           int
+	}{
+		{"127.0.0.1:6379:1", "127.0.0.1:6379", "127.0.0.1:6379", 1},
+		{"127.0.0.1:6379:2 server1", "127.0.0.1:6379", "server1", 2},
+		{"127.0.0.1:11211:1", "127.0.0.1:11211", "127.0.0.1", 1},
+		{"/tmp/redis.sock:3", "/tmp/redis.sock", "/tmp/redis.sock", 3},
+		{"127.0.0.1:6379", "127.0.0.1:6379", "127.0.0.1:6379", 1},
+		{"redis-0.cache:6379 server1", "redis-0.cache:6379", "server1", 1},
+		{"[::1]:6379", "[::1]:6379", "[::1]:6379", 1},
+		{"[::1]:6379:2", "[::1]:6379", "[::1]:6379", 2},
+		{"/tmp/redis.sock", "/tmp/redis.sock", "/tmp/redis.sock", 1},
+	}
+
+	for _, c := range cases {
+		addr, name, weight := parseServer(c.desc)
+		if addr != c.addr || name != c.name || weight != c.weight {
+			t.Errorf("parseServer(%q) = %q, %q, %d", c.desc, addr, name, weight)
+		}
+	}
+}
+
+func TestServerNetworkDetectsUnixSockets(t *testing.T) {
+	for desc, want := range map[string]string{
+		"127.0.0.1:6379:1 server1":  "tcp",
+		"/tmp/redis.sock:0 server1": "unix",
+	} {
+		if got := ServerNetwork(desc); got != want {
+			t.Errorf("ServerNetwork(%q) = %q, want %q", desc, got, want)
+		}
+	}
+}
+
+func TestModulaRingPlacesByWeight(t *testing.T) {
+	h, err := newHashRing([]string{"a:6379:1", "b:6379:2"}, "fnv1a_32", "modula", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		want := []int{0, 1, 1}[hashFNV1a_32([]byte(k))%3]
+		if got, ok := h.owner(k); !ok || got != want {
+			t.Errorf("Key %q placed on %d, expected %d", k, got, want)
+		}
+	}
+}
+
+func TestKetamaRingAssignsPointsByWeight(t *testing.T) {
+	h, err := newHashRing([]string{"a:6379:1", "b:6379:1", "c:6379:2"}, "", "ketama", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	counts := make(map[int]int)
+	for _, p := range h.points {
+		counts[p.index]++
+	}
+	if counts[0] != 120 || counts[1] != 120 || counts[2] != 240 {
+		t.Fatalf("Unexpected point counts: %v", counts)
+	}
+
+	for i := 1; i < len(h.points); i++ {
+		if h.points[i].value < h.points[i-1].value {
+			t.Fatal("Expected continuum to be sorted.")
+		}
+	}
+
+	// Keys hashing beyond the last point wrap to the first.
+	if h.points[len(h.points)-1].value != ^uint32(0) {
+		h.hash = func([]byte) uint32 { return ^uint32(0) }
+		if got, _ := h.owner("any"); got != h.points[0].index {
+			t.Fatalf("Expected wrap to first point, got %d", got)
+		}
+	}
+}
+
+func TestRandomAndUnknownDistributions(t *testing.T) {
+	h, err := newHashRing([]string{"a:6379:1"}, "", "random", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := h.owner("k"); ok {
+		t.Fatal("Expected no placement for random distribution.")
+	}
+
+	if _, err := newHashRing([]string{"a:6379:1"}, "", "bogus", ""); err == nil {
+		t.Fatal("Expected error for unsupported distribution.")
+	}
+}
+
+func TestHashRoutingProbesOnlyTheOwner(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	servers := []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}
+	ring, _ := newHashRing(servers, "fnv1a_64", "modula", "")
+	owner, _ := ring.owner("KEY")
+
+	conns := make([]*MockConn, 2)
+	pools := make([]ConnGetter, 2)
+	for i := range pools {
+		conns[i], pools[i] = setupMockPool(ctrl)
+	}
+	conns[owner].EXPECT().Do("BLPOP", "KEY", 1).Return(nil, nil)
+	conns[owner].EXPECT().Close()
+
+	proxy := getMockProxy(pools...)
+	proxy.setTopology(&topology{pools: pools, servers: servers, ring: ring})
+	WithHashRouting(false)(proxy)
+
+	if _, err := proxy.Do(NewRedisCmd("BLPOP", "KEY", 1), func(v interface{}) bool { return v != nil }); err != ErrNoMapping {
+		t.Fatalf("Expected no mapping error, got %v", err)
+	}
+}
+
+func TestHashRoutingFallsBackToDiscovery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	servers := []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}
+	ring, _ := newHashRing(servers, "fnv1a_64", "modula", "")
+	owner, _ := ring.owner("KEY")
+	other := 1 - owner
+
+	conns := make([]*MockConn, 2)
+	pools := make([]ConnGetter, 2)
+	for i := range pools {
+		conns[i], pools[i] = setupMockPool(ctrl)
+		conns[i].EXPECT().Close()
+	}
+	conns[owner].EXPECT().Do("GET", "KEY").Return(nil, nil)
+	conns[other].EXPECT().Do("GET", "KEY").Return([]byte("VAL"), nil)
+
+	proxy := getMockProxy(pools...)
+	proxy.setTopology(&topology{pools: pools, servers: servers, ring: ring})
+	WithHashRouting(true)(proxy)
+
+	if v, err := proxy.Do(NewRedisCmd("GET", "KEY"), func(v interface{}) bool { return v != nil }); err != nil || v == nil {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+	if proxy.KeyInstance["KEY"] != pools[other] {
+		t.Fatal("Expected key to be mapped to the instance that holds it.")
+	}
+}
+
+func TestHashTagPlacesKeysByTag(t *testing.T) {
+	h, err := newHashRing([]string{"a:6379:1", "b:6379:1", "c:6379:1"}, "", "ketama", "{}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, key := range []string{"user:1", "{user:1}:profile", "x{user:1}y"} {
+		got, _ := h.owner(key)
+		want, _ := h.owner("user:1")
+		if got != want {
+			t.Fatalf("Key %s placed on %d, not with its tag on %d.", key, got, want)
+		}
+	}
+
+	if _, err := newHashRing([]string{"a:6379:1"}, "", "ketama", "{"); err == nil {
+		t.Fatal("Expected error for a malformed hash tag.")
+	}
+}
+
+func TestConfiguredHashTagDecidesColocation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("PING").Return("PONG", nil)
+	mockConn.EXPECT().Close()
+
+	path := writeConfig(t, "alpha:\n  hash_tag: \"::\"\n  servers:\n   - 10.0.0.1:6379:1\n")
+	defer os.Remove(path)
+
+	proxy, err := NewProxyConn(path, "alpha", 0, func(desc, auth string) ConnGetter { return mockPool })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if proxy.topology().hashTag != "::" || proxy.topology().ring == nil {
+		t.Fatal("Expected hash tag to be loaded from configuration.")
+	}
+
+	if _, err := proxy.Atomic(NewRedisCmd("GET", "{u1}:a"), NewRedisCmd("GET", "{u1}:b")); err == nil {
+		t.Fatal("Expected braces not to act as a hash tag when another is configured.")
+	}
+}
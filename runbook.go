@@ -0,0 +1,174 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Step is a single operation within a Plan.
+// Run performs the operation. Verify, if set, confirms that it had the intended effect.
+// Rollback, if set, undoes the operation when the step or a later one fails.
+type Step struct {
+	Name     string                 `json:"name"`
+	Run      func(*ProxyConn) error `json:"-"`
+	Verify   func(*ProxyConn) error `json:"-"`
+	Rollback func(*ProxyConn) error `json:"-"`
+}
+
+// Plan is a named, ordered sequence of steps making up a reusable operational runbook.
+// For example: pause writes, save, wait for replicas, promote, then swap the Twemproxy configuration:
+//
+//	Plan{Name: "failover", Steps: []Step{PauseStep(10*time.Second, PauseModeWrite), BGSaveStep(time.Second),
+//		BarrierStep(30*time.Second), PromoteStep(), ReloadStep(), UnpauseStep()}}
+//
+// Plans of the ready-made steps can be run with the twunctl runbook command.
+type Plan struct {
+	Name  string `json:"name"`
+	Steps []Step `json:"steps"`
+}
+
+// StepResult records what happened to a single step when a Plan was executed.
+type StepResult struct {
+	Name        string `json:"name"`
+	Ran         bool   `json:"ran"`
+	Err         error  `json:"-"`
+	RolledBack  bool   `json:"rolled_back"`
+	RollbackErr error  `json:"-"`
+}
+
+// Validate returns an error for the first step that cannot be run, because it has no Run function.
+func (p *Plan) Validate() error {
+	if len(p.Steps) == 0 {
+		return errors.New("Plan " + p.Name + " has no steps.")
+	}
+	for i, s := range p.Steps {
+		if s.Run == nil {
+			return errors.New("Step " + strconv.Itoa(i+1) + " (" + s.Name + ") of plan " + p.Name + " has nothing to run.")
+		}
+	}
+	return nil
+}
+
+// Execute runs each step of the plan in order against the input proxy.
+// The plan is validated first, and nothing is run, even in a dry run, if it is invalid.
+// In a dry run no step is run; the results simply list the steps that would be executed.
+// If a step fails to run or verify, the rollback hooks of that step and every step before it are run in reverse order.
+// Rollback hooks should therefore tolerate an operation that was only partially applied.
+// The error from the failed step is returned along with the results of every step attempted.
+func (p *Plan) Execute(r *ProxyConn, dryRun bool) ([]StepResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	res := make([]StepResult, 0, len(p.Steps))
+
+	for i, s := range p.Steps {
+		res = append(res, StepResult{Name: s.Name})
+		if dryRun {
+			continue
+		}
+
+		res[i].Ran = true
+		err := s.Run(r)
+		if err == nil && s.Verify != nil {
+			err = s.Verify(r)
+		}
+
+		if err != nil {
+			res[i].Err = err
+			p.rollback(r, res)
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// Runs the rollback hooks for the input results in reverse order.
+func (p *Plan) rollback(r *ProxyConn, res []StepResult) {
+	for i := len(res) - 1; i >= 0; i-- {
+		if rb := p.Steps[i].Rollback; rb != nil {
+			res[i].RolledBack = true
+			res[i].RollbackErr = rb(r)
+		}
+	}
+}
+
+/******************************************************
+ * Ready-made steps for common operations.
+ ******************************************************/
+
+// PauseStep pauses clients on every instance, unpausing them again on rollback.
+func PauseStep(d time.Duration, mode PauseMode) Step {
+	return Step{
+		Name:     "pause",
+		Run:      func(r *ProxyConn) error { return r.PauseAll(d, mode) },
+		Rollback: func(r *ProxyConn) error { return r.Unpause() },
+	}
+}
+
+// UnpauseStep resumes clients on every instance.
+func UnpauseStep() Step {
+	return Step{
+		Name: "unpause",
+		Run:  func(r *ProxyConn) error { return r.Unpause() },
+	}
+}
+
+// BGSaveStep runs a staggered background save, verifying that it was issued against every instance.
+func BGSaveStep(interval time.Duration) Step {
+	var n int
+	return Step{
+		Name: "bgsave",
+		Run: func(r *ProxyConn) (err error) {
+			n, err = r.BGSave(interval)
+			return err
+		},
+		Verify: func(r *ProxyConn) error {
+			if n != len(r.topology().pools) {
+				return errors.New("BGSAVE was not issued against every instance.")
+			}
+			return nil
+		},
+	}
+}
+
+// BarrierStep waits for the replicas of every master instance to catch up.
+func BarrierStep(timeout time.Duration) Step {
+	return Step{
+		Name: "barrier",
+		Run:  func(r *ProxyConn) error { return r.BarrierAll(timeout) },
+	}
+}
+
+// PromoteStep promotes every instance to master, verifying that each is a master afterwards.
+func PromoteStep() Step {
+	var res []PromoteResult
+	return Step{
+		Name: "promote",
+		Run: func(r *ProxyConn) (err error) {
+			res, err = r.PromoteVerified(context.Background(), InstanceOptions{})
+			return err
+		},
+		Verify: func(r *ProxyConn) error {
+			for _, p := range res {
+				if p.Outcome != PromotePromoted && p.Outcome != PromoteAlreadyMaster {
+					return errors.New("Instance " + p.Name + " was not promoted to master.")
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// ReloadStep re-reads the Twemproxy configuration and applies changes to the servers, as Reload does,
+// so that a plan can swap the configuration once it has been rewritten, such as after a promotion.
+// A reload that fails leaves the proxy as it was, so the step has no rollback.
+func ReloadStep() Step {
+	return Step{
+		Name: "reload",
+		Run:  func(r *ProxyConn) error { return r.Reload() },
+	}
+}
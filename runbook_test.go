@@ -0,0 +1,119 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanExecuteRollsBackCompletedStepsInReverse(t *testing.T) {
+	var calls []string
+	step := func(name string, fail bool) Step {
+		return Step{
+			Name: name,
+			Run: func(*ProxyConn) error {
+				calls = append(calls, "run:"+name)
+				if fail {
+					return errors.New("failed")
+				}
+				return nil
+			},
+			Rollback: func(*ProxyConn) error {
+				calls = append(calls, "rollback:"+name)
+				return nil
+			},
+		}
+	}
+
+	plan := Plan{Name: "test", Steps: []Step{step("a", false), step("b", true), step("c", false)}}
+	res, err := plan.Execute(getMockProxy(), false)
+
+	if err == nil {
+		t.Fatal("Expected error from failed step.")
+	}
+
+	exp := []string{"run:a", "run:b", "rollback:b", "rollback:a"}
+	if !reflect.DeepEqual(calls, exp) {
+		t.Fatalf("Unexpected call sequence: %v", calls)
+	}
+
+	if len(res) != 2 || res[1].Err == nil || !res[0].RolledBack {
+		t.Fatalf("Unexpected results: %+v", res)
+	}
+}
+
+func TestPlanExecuteDryRunDoesNotRunSteps(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockPool := setupMockPool(ctrl)
+
+	plan := Plan{Name: "failover", Steps: []Step{PauseStep(time.Second, PauseModeWrite), BarrierStep(time.Second), PromoteStep()}}
+	res, err := plan.Execute(getMockProxy(mockPool), true)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(res) != 3 || res[0].Name != "pause" || res[2].Name != "promote" || res[0].Ran {
+		t.Fatalf("Unexpected results: %+v", res)
+	}
+}
+
+func TestPlanExecuteFailsVerification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("INFO", "replication").Return("role:slave\r\n", nil)
+	mockConn.EXPECT().Do("SLAVEOF", "NO", "ONE").Return(nil, errors.New("ERR"))
+	mockConn.EXPECT().Close()
+
+	plan := Plan{Name: "promote", Steps: []Step{PromoteStep()}}
+	if _, err := plan.Execute(getMockProxy(mockPool), false); err == nil {
+		t.Fatal("Expected error from failed promotion.")
+	}
+}
+
+func TestPlanExecuteValidatesStepsBeforeRunning(t *testing.T) {
+	ran := false
+	plan := Plan{Name: "broken", Steps: []Step{
+		{Name: "first", Run: func(*ProxyConn) error { ran = true; return nil }},
+		{Name: "missing"},
+	}}
+
+	res, err := plan.Execute(getMockProxy(), false)
+	if err == nil || res != nil || ran {
+		t.Fatalf("Expected the plan to be refused before running, got %v, %+v", err, res)
+	}
+	if _, err := plan.Execute(getMockProxy(), true); err == nil {
+		t.Fatal("Expected a dry run of the plan to be refused.")
+	}
+}
+
+func TestReloadStepSwapsConfiguration(t *testing.T) {
+	create := func(desc, auth string) ConnGetter { return connPool{&nilStyleConn{reply: "PONG"}} }
+	path := writeConfig(t, "alpha:\n  servers:\n   - 10.0.0.1:6379:1\n")
+	defer os.Remove(path)
+
+	proxy, err := NewProxyConn(path, "alpha", 0, create)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("alpha:\n  servers:\n   - 10.0.0.2:6379:1\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	plan := Plan{Name: "swap", Steps: []Step{ReloadStep()}}
+	if _, err := plan.Execute(proxy, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if proxy.topology().server(0) != "10.0.0.2:6379" {
+		t.Fatalf("Configuration not swapped: %v", proxy.Servers)
+	}
+}
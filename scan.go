@@ -0,0 +1,192 @@
+package twunproxy
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// ScanOptions configures Scan. Match is a glob-style pattern, matching every key if empty.
+// Count is a hint for the number of keys each instance returns per round trip, using the server default if zero.
+type ScanOptions struct {
+	Match string
+	Count int
+}
+
+// ScanIterator iterates over the keys of every instance in turn, keeping a SCAN cursor for the current instance.
+// As with SCAN, a key may be returned more than once, and keys added or removed during iteration may or may not be.
+// An iterator is not safe for concurrent use.
+type ScanIterator struct {
+	t      *topology
+	opts   ScanOptions
+	pool   int
+	cursor string
+	keys   []string
+	page   string
+	key    string
+	server string
+	err    error
+}
+
+// Scan returns an iterator over the keys of every instance, which Twemproxy cannot provide since it does not
+// forward SCAN. Instances are scanned one after another, in the order of the pool configuration.
+// Advance the iterator with Next until it returns false, then check Err:
+//
+//	it := proxy.Scan(ScanOptions{Match: "user:*"})
+//	for it.Next() {
+//		fmt.Println(it.Key(), it.Server())
+//	}
+//	if err := it.Err(); err != nil { ... }
+func (r *ProxyConn) Scan(opts ScanOptions) *ScanIterator {
+	return &ScanIterator{t: r.topology(), opts: opts, cursor: "0"}
+}
+
+// Next advances to the next key, fetching further pages from each instance as needed.
+// It returns false when every instance has been scanned or an error occurs.
+func (it *ScanIterator) Next() bool {
+	for len(it.keys) == 0 {
+		if it.err != nil || it.pool >= len(it.t.pools) {
+			return false
+		}
+
+		c := it.t.pools[it.pool].Get()
+		cursor, keys, err := scanPage(c, it.cursor, it.opts.Match, it.opts.Count)
+		c.Close()
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.keys = keys
+		it.page = it.t.server(it.pool)
+		it.cursor = cursor
+		if cursor == "0" {
+			it.pool++
+		}
+	}
+
+	it.key, it.keys = it.keys[0], it.keys[1:]
+	it.server = it.page
+	return true
+}
+
+// Key returns the current key.
+func (it *ScanIterator) Key() string {
+	return it.key
+}
+
+// Server returns the address of the instance holding the current key.
+func (it *ScanIterator) Server() string {
+	return it.server
+}
+
+// Err returns the error that ended iteration, if any.
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// ScanKeys iterates SCAN over a single instance, passing each batch of keys matching the pattern to fn.
+// Count is a hint for the number of keys returned per batch. Iteration stops at the first error from fn.
+func scanKeys(c Conn, pattern string, count int, fn func([]string) error) error {
+	cursor := "0"
+	for {
+		var keys []string
+		var err error
+		if cursor, keys, err = scanPage(c, cursor, pattern, count); err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// Runs one SCAN from the input cursor, returning the next cursor and the keys in the page.
+// The pattern and count are omitted if empty or zero.
+func scanPage(c Conn, cursor, pattern string, count int) (string, []string, error) {
+	args := []interface{}{cursor}
+	if pattern != "" {
+		args = append(args, "MATCH", pattern)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+
+	v, err := c.Do("SCAN", args...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	reply, ok := v.([]interface{})
+	if !ok || len(reply) != 2 {
+		return "", nil, errors.New("Unexpected reply to SCAN.")
+	}
+
+	if cursor, ok = replyString(reply[0]); !ok {
+		return "", nil, errors.New("Unexpected cursor in reply to SCAN.")
+	}
+	if _, err := strconv.ParseUint(cursor, 10, 64); err != nil {
+		return "", nil, errors.New("Unexpected cursor in reply to SCAN.")
+	}
+
+	items, _ := reply[1].([]interface{})
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		if k, ok := replyString(item); ok {
+			keys = append(keys, k)
+		}
+	}
+	return cursor, keys, nil
+}
+
+// Returned by Keys when more keys match than the caller's limit.
+var errTooManyKeys = errors.New("More keys match the pattern than the limit allows.")
+
+// Keys returns the keys of every instance matching the input pattern, de-duplicated and in no particular order.
+// Instances are scanned concurrently with SCAN rather than KEYS, so that large keyspaces do not block them.
+// If more than limit keys match, scanning stops and an error is returned rather than a partial result.
+// If any instance fails, an error is returned, unless partial results are enabled and others succeeded,
+// in which case the keys of the others are returned with a PartialError.
+func (r *ProxyConn) Keys(pattern string, limit int) ([]string, error) {
+	t := r.topology()
+	seen := make(map[string]bool)
+	var mu sync.Mutex
+
+	errs := t.forEach(func(i int, c Conn) error {
+		return scanKeys(c, pattern, scanCount, func(keys []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, k := range keys {
+				seen[k] = true
+			}
+			if len(seen) > limit {
+				return errTooManyKeys
+			}
+			return nil
+		})
+	})
+
+	for _, err := range errs {
+		if err == errTooManyKeys {
+			return nil, err
+		}
+	}
+	err := r.fanOutError(t, errs)
+	if _, partial := err.(*PartialError); err != nil && !partial {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(seen))
+	for k := range seen {
+		res = append(res, k)
+	}
+	return res, err
+}
@@ -0,0 +1,90 @@
+package twunproxy
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+// Answers SCAN from pages of keys indexed by cursor, each page linking to the next.
+type scanConn struct {
+	pages map[string][]interface{}
+	args  [][]interface{}
+	err   error
+}
+
+func (c *scanConn) Close() error { return nil }
+
+func (c *scanConn) Do(name string, args ...interface{}) (interface{}, error) {
+	c.args = append(c.args, args)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.pages[args[0].(string)], nil
+}
+
+func TestScanIteratesEveryInstance(t *testing.T) {
+	first := &scanConn{pages: map[string][]interface{}{
+		"0": {[]byte("7"), []interface{}{[]byte("a"), []byte("b")}},
+		"7": {[]byte("0"), []interface{}{}},
+	}}
+	second := &scanConn{pages: map[string][]interface{}{
+		"0": {[]byte("0"), []interface{}{[]byte("c")}},
+	}}
+	proxy := getMockProxy(connPool{first}, connPool{second})
+
+	it := proxy.Scan(ScanOptions{Match: "*", Count: 10})
+	var keys, servers []string
+	for it.Next() {
+		keys = append(keys, it.Key())
+		servers = append(servers, it.Server())
+	}
+	if it.Err() != nil {
+		t.Fatalf("Unexpected error: %v", it.Err())
+	}
+
+	if len(keys) != 3 || keys[0] != "a" || keys[1] != "b" || keys[2] != "c" {
+		t.Fatalf("Unexpected keys: %v", keys)
+	}
+	if servers[0] != "0" || servers[1] != "0" || servers[2] != "1" {
+		t.Fatalf("Unexpected servers: %v", servers)
+	}
+	if len(first.args) != 2 || len(first.args[0]) != 5 || first.args[0][2] != "*" || first.args[0][4] != 10 {
+		t.Fatalf("Unexpected SCAN arguments: %v", first.args)
+	}
+}
+
+func TestScanOmitsEmptyOptionsAndStopsOnError(t *testing.T) {
+	failing := &scanConn{err: errors.New("down")}
+	proxy := getMockProxy(connPool{failing}, connPool{&scanConn{}})
+
+	it := proxy.Scan(ScanOptions{})
+	if it.Next() {
+		t.Fatal("Expected iteration to stop")
+	}
+	if it.Err() == nil {
+		t.Fatal("Expected error")
+	}
+	if len(failing.args) != 1 || len(failing.args[0]) != 1 {
+		t.Fatalf("Expected only the cursor to be sent, got %v", failing.args)
+	}
+}
+
+func TestKeysMergesAndDeduplicates(t *testing.T) {
+	page := map[string][]interface{}{"0": {[]byte("0"), []interface{}{[]byte("a"), []byte("b")}}}
+	other := map[string][]interface{}{"0": {[]byte("0"), []interface{}{[]byte("b"), []byte("c")}}}
+	proxy := getMockProxy(connPool{&scanConn{pages: page}}, connPool{&scanConn{pages: other}})
+
+	keys, err := proxy.Keys("*", 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 3 || keys[0] != "a" || keys[2] != "c" {
+		t.Fatalf("Unexpected keys: %v", keys)
+	}
+
+	if _, err := proxy.Keys("*", 2); err != errTooManyKeys {
+		t.Fatalf("Expected limit error, got %v", err)
+	}
+}
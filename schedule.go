@@ -0,0 +1,196 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+/******************************************************
+ * Scheduling of recurring maintenance jobs.
+ * Embedding services register jobs as options rather than running tickers around each helper.
+ ******************************************************/
+
+// Job is a recurring task run by the proxy's scheduler.
+// A job runs every Interval, measured from the end of its previous run, so runs of a job never overlap.
+// If Aligned is set, runs instead start on wall clock multiples of the interval, such as on the hour for
+// an interval of an hour, skipping any that pass while the previous run is still going.
+// Timeout, if positive, limits each run through its context.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Aligned  bool
+	Timeout  time.Duration
+	Run      func(ctx context.Context, r *ProxyConn) error
+}
+
+// JobStatus records the runs of a scheduled job.
+type JobStatus struct {
+	Name         string        `json:"name"`
+	Runs         int64         `json:"runs"`
+	Failures     int64         `json:"failures"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration_ns"`
+	LastErr      error         `json:"-"`
+}
+
+// Recorded for jobs that are not scheduled because their interval is not positive.
+var errInvalidJobInterval = errors.New("Job interval must be positive.")
+
+// The jobs scheduled on a proxy and their status.
+type jobScheduler struct {
+	mu     sync.Mutex
+	status map[string]*JobStatus
+}
+
+// WithScheduledJobs runs each input job on its own goroutine until the context ends or the proxy is closed.
+// Failures are recorded in the job's status and counted in the "scheduled_job_failures" metric.
+// Jobs with an interval that is not positive are not scheduled; their status records the error.
+func WithScheduledJobs(ctx context.Context, jobs ...Job) Option {
+	return func(r *ProxyConn) {
+		ctx, cancel := context.WithCancel(ctx)
+		r.onClose(cancel)
+
+		r.mu.Lock()
+		if r.jobs == nil {
+			r.jobs = &jobScheduler{status: make(map[string]*JobStatus)}
+		}
+		s := r.jobs
+		r.mu.Unlock()
+
+		for _, j := range jobs {
+			s.mu.Lock()
+			s.status[j.Name] = &JobStatus{Name: j.Name}
+			if j.Interval <= 0 {
+				s.status[j.Name].LastErr = errInvalidJobInterval
+			}
+			s.mu.Unlock()
+
+			if j.Interval <= 0 {
+				r.log().Warn("Scheduled job not started", "job", j.Name, "err", errInvalidJobInterval)
+				continue
+			}
+			go r.runJob(ctx, s, j)
+		}
+	}
+}
+
+// Jobs returns the status of every scheduled job, ordered by name.
+func (r *ProxyConn) Jobs() []JobStatus {
+	r.mu.Lock()
+	s := r.jobs
+	r.mu.Unlock()
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]JobStatus, 0, len(s.status))
+	for _, st := range s.status {
+		res = append(res, *st)
+	}
+	sort.Slice(res, func(a, b int) bool { return res[a].Name < res[b].Name })
+	return res
+}
+
+// Runs the input job at its interval until the context ends.
+func (r *ProxyConn) runJob(ctx context.Context, s *jobScheduler, j Job) {
+	for {
+		wait := j.Interval
+		if j.Aligned {
+			now := time.Now()
+			wait = now.Truncate(j.Interval).Add(j.Interval).Sub(now)
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		jctx, cancel := ctx, context.CancelFunc(func() {})
+		if j.Timeout > 0 {
+			jctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		}
+		start := time.Now()
+		err := j.Run(jctx, r)
+		cancel()
+
+		if err != nil {
+			r.counter("scheduled_job_failures", "", 1)
+			r.log().Warn("Scheduled job failed", "job", j.Name, "err", err)
+		}
+
+		s.mu.Lock()
+		st := s.status[j.Name]
+		st.Runs++
+		st.LastRun = start
+		st.LastDuration = time.Since(start)
+		st.LastErr = err
+		if err != nil {
+			st.Failures++
+		}
+		s.mu.Unlock()
+	}
+}
+
+// BGSaveJob returns a job running BGSave at the input interval, with the input spacing between instances.
+func BGSaveJob(interval, spacing time.Duration) Job {
+	return Job{
+		Name:     "bgsave",
+		Interval: interval,
+		Run: func(ctx context.Context, r *ProxyConn) error {
+			_, err := r.BGSaveContext(ctx, spacing)
+			return err
+		},
+	}
+}
+
+// AuditJob returns a job running AuditMappings at the input interval, repairing stale mappings if repair is set.
+func AuditJob(interval time.Duration, repair bool) Job {
+	return Job{
+		Name:     "audit_mappings",
+		Interval: interval,
+		Run: func(ctx context.Context, r *ProxyConn) error {
+			_, err := r.AuditMappings(false, repair)
+			return err
+		},
+	}
+}
+
+// SweepJob returns a job running SweepQueues for the input pattern and idle time at the input interval.
+func SweepJob(interval time.Duration, pattern string, maxIdle time.Duration) Job {
+	return Job{
+		Name:     "sweep_queues",
+		Interval: interval,
+		Run: func(ctx context.Context, r *ProxyConn) error {
+			_, err := r.SweepQueues(pattern, maxIdle, false)
+			return err
+		},
+	}
+}
+
+// StatsJob returns a job passing the difference in the proxy's stats since its previous run to the input function
+// at the input interval. The first difference holds everything recorded before the first run.
+func StatsJob(interval time.Duration, fn func(StatsSnapshot)) Job {
+	var prev StatsSnapshot
+	return Job{
+		Name:     "sample_stats",
+		Interval: interval,
+		Run: func(ctx context.Context, r *ProxyConn) error {
+			snap := r.SnapshotStats()
+			if prev.Time.IsZero() {
+				prev.Time = snap.Time.Add(-interval)
+			}
+			fn(snap.Diff(prev))
+			prev = snap
+			return nil
+		},
+	}
+}
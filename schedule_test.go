@@ -0,0 +1,88 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduledJobsRunAndRecordStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make(chan bool, 10)
+	ok := Job{Name: "ok", Interval: 10 * time.Millisecond, Run: func(context.Context, *ProxyConn) error {
+		runs <- true
+		return nil
+	}}
+	failing := Job{Name: "failing", Interval: 10 * time.Millisecond, Run: func(context.Context, *ProxyConn) error {
+		return errors.New("failed")
+	}}
+
+	m := newFakeMetrics()
+	proxy := getMockProxy()
+	WithMetrics(m)(proxy)
+	WithScheduledJobs(ctx, ok, failing)(proxy)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the job to run.")
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	jobs := proxy.Jobs()
+	if len(jobs) != 2 || jobs[0].Name != "failing" || jobs[1].Name != "ok" {
+		t.Fatalf("Unexpected jobs: %+v", jobs)
+	}
+	if jobs[0].Failures == 0 || jobs[0].LastErr == nil || jobs[1].Runs < 2 || jobs[1].Failures != 0 {
+		t.Fatalf("Unexpected status: %+v", jobs)
+	}
+	if m.get("scheduled_job_failures", "") == 0 {
+		t.Fatal("Expected failures to be counted.")
+	}
+}
+
+func TestStatsJobPassesDifferences(t *testing.T) {
+	proxy := getMockProxy()
+	var got []StatsSnapshot
+	job := StatsJob(time.Minute, func(d StatsSnapshot) { got = append(got, d) })
+
+	proxy.counter("commands", "", 2)
+	job.Run(context.Background(), proxy)
+	proxy.counter("commands", "", 3)
+	job.Run(context.Background(), proxy)
+
+	if len(got) != 2 || got[0].Counters["commands"][""] != 2 || got[1].Counters["commands"][""] != 3 {
+		t.Fatalf("Unexpected differences: %+v", got)
+	}
+}
+
+func TestScheduledJobsRejectNonPositiveInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make(chan bool, 10)
+	j := Job{Name: "spin", Run: func(context.Context, *ProxyConn) error {
+		runs <- true
+		return nil
+	}}
+
+	proxy := getMockProxy()
+	WithScheduledJobs(ctx, j)(proxy)
+
+	select {
+	case <-runs:
+		t.Fatal("Expected the job not to run.")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	jobs := proxy.Jobs()
+	if len(jobs) != 1 || jobs[0].Runs != 0 || jobs[0].LastErr != errInvalidJobInterval {
+		t.Fatalf("Unexpected jobs: %+v", jobs)
+	}
+}
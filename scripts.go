@@ -0,0 +1,171 @@
+package twunproxy
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+/******************************************************
+ * Lua scripting, which Twemproxy does not forward.
+ ******************************************************/
+
+// Returned by EvalSha for a script that is neither loaded on the instance nor known to the proxy.
+var errUnknownScript = errors.New("Script is not loaded and its source is unknown; run it once with Eval.")
+
+// Tracks the source of every script run through the proxy and the scripts loaded on each pool,
+// so that scripts are sent to an instance once and then run by SHA.
+type scriptCache struct {
+	mu      sync.Mutex
+	sources map[string]string
+	loaded  map[ConnGetter]map[string]bool
+}
+
+// Eval runs the input Lua script on the instance holding the input keys, with the remaining arguments.
+// At least one key is required for routing, and all keys must share the same hash tag, as for Atomic.
+// The script is loaded on the instance with SCRIPT LOAD the first time it is run there and is then run with
+// EVALSHA, so that its source is not resent. If the instance has since lost the script, such as after a restart
+// or SCRIPT FLUSH, it is reloaded and run again. The key is placed as for BRPopLPush and mapped once the script runs.
+func (r *ProxyConn) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	sum := sha1.Sum([]byte(script))
+	sha := hex.EncodeToString(sum[:])
+
+	sc := r.scriptCache()
+	sc.mu.Lock()
+	sc.sources[sha] = script
+	sc.mu.Unlock()
+
+	return r.evalSha(sha, keys, args)
+}
+
+// EvalSha runs the script with the input SHA1 digest, as Eval. If the instance does not have the script,
+// it is loaded if its source is known from an earlier Eval, and errUnknownScript is returned otherwise.
+func (r *ProxyConn) EvalSha(sha string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.evalSha(strings.ToLower(sha), keys, args)
+}
+
+// Runs EVALSHA on the instance holding the keys, loading the script first if it is not known to be loaded there.
+func (r *ProxyConn) evalSha(sha string, keys []string, args []interface{}) (interface{}, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("At least one key is required to route EVALSHA.")
+	}
+
+	delims := r.colocationTag()
+	tag := hashTagOf(keys[0], delims)
+	rest := []interface{}{sha, len(keys)}
+	for _, k := range keys[1:] {
+		if hashTagOf(k, delims) != tag {
+			return nil, errors.New("Keys do not share a hash tag: " + keys[0] + ", " + k + ".")
+		}
+		rest = append(rest, k)
+	}
+	rest = append(rest, args...)
+	cmd := &RedisCmd{name: "EVALSHA", key: keys[0], args: rest, keyPos: 2}
+
+	var v interface{}
+	err := r.retrying(context.Background(), cmd.name, cmd.key, func() (err error) {
+		v, err = r.runScript(cmd, sha)
+		return err
+	})
+	return v, err
+}
+
+// Places the keys of the input EVALSHA command and runs it once, as for evalSha.
+func (r *ProxyConn) runScript(cmd *RedisCmd, sha string) (interface{}, error) {
+	start := time.Now()
+	t := r.topology()
+	pool, ok, err := r.place(cmd.key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if len(t.pools) != 1 {
+			r.deadLetter(cmd, errNoPlacement)
+			return nil, errNoPlacement
+		}
+		pool = t.pools[0]
+	}
+
+	defer r.inflight.release(r.inflight.acquire(1))
+
+	c := pool.Get()
+	defer c.Close()
+
+	sc := r.scriptCache()
+	if !sc.isLoaded(pool, sha) {
+		if err := sc.load(c, pool, sha); err != nil && err != errUnknownScript {
+			return nil, err
+		}
+	}
+
+	v, err := r.run(c, cmd)
+	if isNoScript(err) {
+		sc.forget(pool)
+		if err = sc.load(c, pool, sha); err != nil {
+			return nil, err
+		}
+		v, err = r.run(c, cmd)
+	}
+	r.observe(cmd, t.serverOf(pool), false, start, v, err)
+
+	if err == nil {
+		r.mapKey(cmd.key, pool)
+	}
+	return v, err
+}
+
+// Returns the script cache of the proxy, creating it if needed.
+func (r *ProxyConn) scriptCache() *scriptCache {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.scripts == nil {
+		r.scripts = &scriptCache{sources: make(map[string]string), loaded: make(map[ConnGetter]map[string]bool)}
+	}
+	return r.scripts
+}
+
+// Reports whether the script with the input digest is known to be loaded on the pool.
+func (sc *scriptCache) isLoaded(pool ConnGetter, sha string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.loaded[pool][sha]
+}
+
+// Loads the script with the input digest on the connection, which is from the input pool, and records it as loaded.
+func (sc *scriptCache) load(c Conn, pool ConnGetter, sha string) error {
+	sc.mu.Lock()
+	src, ok := sc.sources[sha]
+	sc.mu.Unlock()
+	if !ok {
+		return errUnknownScript
+	}
+
+	if _, err := c.Do("SCRIPT", "LOAD", src); err != nil {
+		return err
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.loaded[pool] == nil {
+		sc.loaded[pool] = make(map[string]bool)
+	}
+	sc.loaded[pool][sha] = true
+	return nil
+}
+
+// Forgets every script loaded on the pool, which has evidently lost its scripts.
+func (sc *scriptCache) forget(pool ConnGetter) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.loaded, pool)
+}
+
+// Reports whether the input error is the NOSCRIPT error for a script that is not loaded.
+func isNoScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT")
+}
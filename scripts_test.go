@@ -0,0 +1,74 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+const testScript = "return redis.call('GET', KEYS[1])"
+
+// The SHA1 digest of testScript.
+const testScriptSha = "d3c21d0c2b9ca22f82737626a27bcaf5d288f99f"
+
+func TestEvalLoadsScriptOnceAndRunsBySha(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	gomock.InOrder(
+		mockConn.EXPECT().Do("SCRIPT", "LOAD", testScript).Return(testScriptSha, nil),
+		mockConn.EXPECT().Do("EVALSHA", testScriptSha, 1, "KEY", "a").Return("v", nil).Times(2),
+	)
+	mockConn.EXPECT().Close().Times(2)
+
+	for i := 0; i < 2; i++ {
+		if v, err := proxy.Eval(testScript, []string{"KEY"}, "a"); err != nil || v != "v" {
+			t.Fatalf("Unexpected result: %v, %v", v, err)
+		}
+	}
+}
+
+func TestEvalShaReloadsOnNoScript(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	sc := proxy.scriptCache()
+	sc.sources[testScriptSha] = testScript
+	sc.loaded[mockPool] = map[string]bool{testScriptSha: true}
+
+	noScript := errors.New("NOSCRIPT No matching script. Please use EVAL.")
+	gomock.InOrder(
+		mockConn.EXPECT().Do("EVALSHA", testScriptSha, 1, "KEY").Return(nil, noScript),
+		mockConn.EXPECT().Do("SCRIPT", "LOAD", testScript).Return(testScriptSha, nil),
+		mockConn.EXPECT().Do("EVALSHA", testScriptSha, 1, "KEY").Return("v", nil),
+	)
+	mockConn.EXPECT().Close()
+
+	if v, err := proxy.EvalSha(testScriptSha, []string{"KEY"}); err != nil || v != "v" {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestEvalShaUnknownScript(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	mockConn.EXPECT().Do("EVALSHA", "abc", 1, "KEY").Return(nil, errors.New("NOSCRIPT No matching script."))
+	mockConn.EXPECT().Close()
+
+	if _, err := proxy.EvalSha("ABC", []string{"KEY"}); err != errUnknownScript {
+		t.Fatalf("Expected errUnknownScript, got %v", err)
+	}
+}
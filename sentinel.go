@@ -0,0 +1,249 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/txodds/twunproxy/reply"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/******************************************************
+ * Redis Sentinel, for following the masters of the pool through failovers.
+ ******************************************************/
+
+// SentinelConfig configures WatchSentinel. Addrs are the "host:port" addresses of the Sentinels, tried in order.
+// Create creates a pool for each Sentinel, with Auth; its connections must implement PubSubConn to watch for
+// failovers. ReconnectInterval is the delay before watching again after a Sentinel connection fails.
+// OnSwitch, if set, is called with the name of each master whose pool is re-pointed and its old and new addresses.
+// OnError, if set, is called with failures to resolve a master, re-point its pool or watch a Sentinel.
+type SentinelConfig struct {
+	Addrs             []string
+	Create            CreatePool
+	Auth              string
+	ReconnectInterval time.Duration
+	OnSwitch          func(name, old, new string)
+	OnError           func(err error)
+}
+
+// WatchSentinel follows the masters of the pool through Sentinel failovers, so that Promote is not needed.
+// The name of each server descriptor, as in "host:port:weight name", is taken as the name of a master monitored
+// by the Sentinels. Each is resolved with "SENTINEL get-master-addr-by-name" and its pool re-pointed at the master
+// if it has moved; then +switch-master events are watched, and the pool of the master named in each is re-pointed
+// at its new address. A re-pointed pool is created from a descriptor with the new address and the same weight and
+// name, so keys are placed as before, and keys mapped to the old pool are mapped to the new one, since it holds
+// the same data. After a Sentinel connection fails, the masters are resolved again before watching resumes.
+// Servers whose names no Sentinel monitors are left as they are. An error is returned if no Sentinel answers.
+// Reload and SyncBackends restore the configured addresses. Call the returned function to stop watching.
+func (r *ProxyConn) WatchSentinel(conf SentinelConfig) (func(), error) {
+	if len(conf.Addrs) == 0 || conf.Create == nil {
+		return nil, errors.New("Sentinel addresses and a CreatePool for them are required.")
+	}
+	if conf.ReconnectInterval <= 0 {
+		conf.ReconnectInterval = DefaultReconnectInterval
+	}
+
+	w := &sentinelWatch{proxy: r, conf: conf, stop: make(chan bool)}
+	for _, addr := range conf.Addrs {
+		w.pools = append(w.pools, conf.Create(addr, conf.Auth))
+	}
+
+	if err := w.resolveAll(); err != nil {
+		return nil, err
+	}
+
+	w.wg.Add(1)
+	go w.run()
+	return w.close, nil
+}
+
+// The state of a WatchSentinel.
+type sentinelWatch struct {
+	proxy *ProxyConn
+	conf  SentinelConfig
+	pools []ConnGetter
+	stop  chan bool
+	wg    sync.WaitGroup
+
+	// Guards the connection being watched, which is closed to end a blocked receive.
+	mu     sync.Mutex
+	conn   Conn
+	closed bool
+}
+
+// Stops watching and waits for the watch to end.
+func (w *sentinelWatch) close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.stop)
+	if w.conn != nil {
+		w.conn.Close()
+	}
+	w.mu.Unlock()
+
+	w.wg.Wait()
+}
+
+// Resolves the master of every server through the first Sentinel that answers, re-pointing those that have moved.
+// An error is returned if no Sentinel answers.
+func (w *sentinelWatch) resolveAll() error {
+	var err error
+	for _, pool := range w.pools {
+		if err = w.resolveWith(pool); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Resolves the master of every server through the Sentinel of the input pool.
+func (w *sentinelWatch) resolveWith(pool ConnGetter) error {
+	c := pool.Get()
+	defer c.Close()
+
+	t := w.proxy.topology()
+	for i := range t.pools {
+		name := t.instance(i).Name
+		addr, err := sentinelMaster(c, name)
+		if err == errUnknownMaster {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		w.repoint(name, addr)
+	}
+	return nil
+}
+
+// Returned by sentinelMaster when the Sentinel does not monitor the named master.
+var errUnknownMaster = errors.New("Sentinel does not monitor the master.")
+
+// Returns the "host:port" address of the named master, according to the Sentinel on the input connection.
+func sentinelMaster(c Conn, name string) (string, error) {
+	v, err := c.Do("SENTINEL", "get-master-addr-by-name", name)
+	if v == nil && err == nil {
+		return "", errUnknownMaster
+	}
+
+	hostPort, err := reply.Strings(v, err)
+	if err != nil {
+		return "", err
+	}
+	if len(hostPort) != 2 {
+		return "", errors.New("Unexpected reply to SENTINEL get-master-addr-by-name.")
+	}
+	return net.JoinHostPort(hostPort[0], hostPort[1]), nil
+}
+
+// Re-points the pool of the server with the input name at the input address, if it is elsewhere.
+func (w *sentinelWatch) repoint(name, addr string) {
+	r := w.proxy
+	t := r.topology()
+
+	for i, pool := range t.pools {
+		inst := t.instance(i)
+		if inst.Name != name || inst.Addr == addr {
+			continue
+		}
+
+		desc := addr + ":" + strconv.Itoa(inst.Weight) + " " + name
+		if err := r.rebuildPool(pool, desc); err != nil {
+			w.error(err)
+			return
+		}
+
+		r.counter("sentinel_switches", addr, 1)
+		r.log().Info("Master switched", "name", name, "old", inst.Addr, "new", addr)
+		if w.conf.OnSwitch != nil {
+			w.conf.OnSwitch(name, inst.Addr, addr)
+		}
+		return
+	}
+}
+
+// Watches each Sentinel in turn for +switch-master events until stopped, moving to the next after a failure.
+func (w *sentinelWatch) run() {
+	defer w.wg.Done()
+
+	for i := 0; ; i = (i + 1) % len(w.pools) {
+		err := w.watch(w.pools[i].Get())
+
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+		w.error(err)
+
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(w.conf.ReconnectInterval):
+		}
+
+		// Switches may have been missed while no Sentinel was watched.
+		w.error(w.resolveWith(w.pools[(i+1)%len(w.pools)]))
+	}
+}
+
+// Subscribes to +switch-master on the input Sentinel connection and re-points pools until receiving fails.
+func (w *sentinelWatch) watch(conn Conn) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	w.conn = conn
+	w.mu.Unlock()
+
+	defer func() {
+		w.mu.Lock()
+		w.conn = nil
+		w.mu.Unlock()
+		conn.Close()
+	}()
+
+	c, ok := conn.(PubSubConn)
+	if !ok {
+		return errors.New("Sentinel connection does not support pub/sub.")
+	}
+	if err := subscribe(c, "SUBSCRIBE", []string{"+switch-master"}); err != nil {
+		return err
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		v, err := c.Receive()
+		if err != nil {
+			return err
+		}
+
+		// The message is "<name> <old ip> <old port> <new ip> <new port>".
+		m, ok := parseMessage(v)
+		if !ok || m.Channel != "+switch-master" {
+			continue
+		}
+		f := strings.Fields(string(m.Data))
+		if len(f) != 5 {
+			continue
+		}
+		w.repoint(f[0], net.JoinHostPort(f[3], f[4]))
+	}
+}
+
+// Reports the input error, if any.
+func (w *sentinelWatch) error(err error) {
+	if err != nil && w.conf.OnError != nil {
+		w.conf.OnError(err)
+	}
+}
@@ -0,0 +1,90 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestWatchSentinelRepointsPoolsAndKeepsMappings(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("PING").Return("PONG", nil).AnyTimes()
+	mockConn.EXPECT().Close().AnyTimes()
+
+	created := make(map[string]ConnGetter)
+	proxy := getMockProxy(mockPool, mockPool)
+	proxy.Servers = []string{"10.0.0.1:6379:1 alpha", "10.0.0.2:6379:1 beta"}
+	proxy.config = func() (PoolConfig, error) { return PoolConfig{Servers: proxy.Servers}, nil }
+	proxy.create = func(desc, auth string) ConnGetter {
+		p := &closingPool{ConnGetter: mockPool}
+		created[desc] = p
+		return p
+	}
+
+	// Alpha has already failed over; beta is where it was configured.
+	sentinel := &fakeSentinelPool{events: make(chan interface{}, 1), masters: map[string][]interface{}{
+		"alpha": {[]byte("10.0.1.1"), []byte("6379")},
+		"beta":  {[]byte("10.0.0.2"), []byte("6379")},
+	}}
+
+	switched := make(chan string, 2)
+	stop, err := proxy.WatchSentinel(SentinelConfig{
+		Addrs:    []string{"10.0.9.1:26379"},
+		Create:   func(desc, auth string) ConnGetter { return sentinel },
+		OnSwitch: func(name, old, new string) { switched <- name + " " + old + " " + new },
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stop()
+
+	if s := <-switched; s != "alpha 10.0.0.1:6379 10.0.1.1:6379" {
+		t.Fatalf("Unexpected switch: %s", s)
+	}
+	if proxy.Servers[0] != "10.0.1.1:6379:1 alpha" || proxy.Pools[0] != created["10.0.1.1:6379:1 alpha"] {
+		t.Fatalf("Alpha not re-pointed: %v", proxy.Servers)
+	}
+
+	beta := proxy.Pools[1]
+	proxy.mapKey("KEY", beta)
+	sentinel.events <- []interface{}{[]byte("message"), []byte("+switch-master"), []byte("beta 10.0.0.2 6379 10.0.1.2 6380")}
+
+	select {
+	case s := <-switched:
+		if s != "beta 10.0.0.2:6379 10.0.1.2:6380" {
+			t.Fatalf("Unexpected switch: %s", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected beta to be re-pointed.")
+	}
+
+	if pool, ok := proxy.lookup("KEY"); !ok || pool != created["10.0.1.2:6380:1 beta"] || pool == beta {
+		t.Fatal("Expected mapping to move to the new master.")
+	}
+}
+
+// A Sentinel pool whose connections answer get-master-addr-by-name from a map, and receive events sent on a channel.
+type fakeSentinelPool struct {
+	events  chan interface{}
+	masters map[string][]interface{}
+}
+
+func (p *fakeSentinelPool) Get() Conn {
+	return &fakeSentinel{&fakePubSubConn{replies: p.events, closed: make(chan bool)}, p.masters}
+}
+
+// A connection of a fakeSentinelPool.
+type fakeSentinel struct {
+	*fakePubSubConn
+	masters map[string][]interface{}
+}
+
+func (c *fakeSentinel) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if v, ok := c.masters[args[1].(string)]; ok {
+		return v, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,95 @@
+package twunproxy
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// ShardedKeyMapper is a KeyMapper that stripes mappings across several maps, each with its own lock,
+// chosen by a hash of the key. Concurrent commands on many distinct keys then rarely contend for the same lock,
+// as they do on the single mutex guarding the KeyInstance map.
+type ShardedKeyMapper struct {
+	shards []mappingShard
+}
+
+// A single stripe of a ShardedKeyMapper.
+type mappingShard struct {
+	mu sync.RWMutex
+	m  map[string]ConnGetter
+}
+
+// NewShardedKeyMapper returns a ShardedKeyMapper with the input number of stripes.
+// Use it with WithKeyMapper. A power of two somewhat larger than GOMAXPROCS is a reasonable choice.
+func NewShardedKeyMapper(shards int) *ShardedKeyMapper {
+	if shards < 1 {
+		shards = 1
+	}
+
+	s := &ShardedKeyMapper{shards: make([]mappingShard, shards)}
+	for i := range s.shards {
+		s.shards[i].m = make(map[string]ConnGetter)
+	}
+	return s
+}
+
+// Returns the stripe holding the input key.
+func (s *ShardedKeyMapper) shard(key string) *mappingShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// Lookup returns the pool mapped to the input key.
+func (s *ShardedKeyMapper) Lookup(key string) (ConnGetter, bool) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	pool, ok := sh.m[key]
+	return pool, ok
+}
+
+// Map maps the input key to the pool.
+func (s *ShardedKeyMapper) Map(key string, pool ConnGetter) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.m[key] = pool
+}
+
+// Unmap removes any mapping for the input key.
+func (s *ShardedKeyMapper) Unmap(key string) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	delete(sh.m, key)
+}
+
+// Range calls fn for each mapping until it returns false. Each stripe is copied under its lock and visited after
+// releasing it, so fn may map and unmap keys.
+func (s *ShardedKeyMapper) Range(fn func(key string, pool ConnGetter) bool) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		copied := make(map[string]ConnGetter, len(sh.m))
+		for k, p := range sh.m {
+			copied[k] = p
+		}
+		sh.mu.RUnlock()
+
+		for k, p := range copied {
+			if !fn(k, p) {
+				return
+			}
+		}
+	}
+}
+
+// Purge removes every mapping.
+func (s *ShardedKeyMapper) Purge() {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		sh.m = make(map[string]ConnGetter)
+		sh.mu.Unlock()
+	}
+}
@@ -0,0 +1,70 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestShardedKeyMapperConcurrentMapping(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, pool := setupMockPool(ctrl)
+	s := NewShardedKeyMapper(8)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.Map(strconv.Itoa(i), pool)
+		}(i)
+	}
+	wg.Wait()
+
+	n := 0
+	s.Range(func(string, ConnGetter) bool {
+		n++
+		return true
+	})
+	if n != 100 {
+		t.Fatalf("Expected 100 mappings, got %d", n)
+	}
+
+	s.Unmap("7")
+	if _, ok := s.Lookup("7"); ok {
+		t.Fatal("Expected key to be unmapped.")
+	}
+	if p, ok := s.Lookup("8"); !ok || p != pool {
+		t.Fatal("Expected key to be mapped.")
+	}
+
+	s.Purge()
+	if _, ok := s.Lookup("8"); ok {
+		t.Fatal("Expected mappings to be purged.")
+	}
+}
+
+func TestShardedKeyMapperRangeAllowsUnmapping(t *testing.T) {
+	s := NewShardedKeyMapper(2)
+	pool := connPool{}
+	for i := 0; i < 10; i++ {
+		s.Map(strconv.Itoa(i), pool)
+	}
+
+	s.Range(func(k string, p ConnGetter) bool {
+		s.Unmap(k)
+		return true
+	})
+
+	n := 0
+	s.Range(func(string, ConnGetter) bool {
+		n++
+		return true
+	})
+	if n != 0 {
+		t.Fatalf("Expected every mapping to be removed, got %d", n)
+	}
+}
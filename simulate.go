@@ -0,0 +1,187 @@
+package twunproxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+/******************************************************
+ * Offline simulation against a recorded topology.
+ * Routing logic, reshard plans and runbooks can be exercised without any live Redis.
+ ******************************************************/
+
+// TopologyRecord is a recording of the servers, placement settings and key mappings of a proxy.
+// Mappings are server addresses by key.
+type TopologyRecord struct {
+	Servers      []string          `json:"servers"`
+	Hash         string            `json:"hash,omitempty"`
+	Distribution string            `json:"distribution,omitempty"`
+	HashTag      string            `json:"hash_tag,omitempty"`
+	Mappings     map[string]string `json:"mappings"`
+}
+
+// RecordTopology captures the current topology and key mappings of the proxy, for use with NewSimulatedProxy.
+// It fails if the key mapper cannot enumerate its mappings.
+func (r *ProxyConn) RecordTopology() (*TopologyRecord, error) {
+	m, ok := r.mappings()
+	if !ok {
+		return nil, errors.New("Key mapper cannot enumerate mappings.")
+	}
+
+	t := r.topology()
+	rec := &TopologyRecord{
+		Servers:  append([]string(nil), t.servers...),
+		HashTag:  t.hashTag,
+		Mappings: make(map[string]string, len(m)),
+	}
+	if t.ring != nil {
+		rec.Hash = t.ring.hashName
+		rec.Distribution = t.ring.dist
+	}
+
+	for k, pool := range m {
+		if server := t.serverOf(pool); server != "" {
+			rec.Mappings[k] = server
+		}
+	}
+	return rec, nil
+}
+
+// Simulator answers commands for simulated instances, identified by their server address.
+// Implementations must be safe for concurrent use.
+type Simulator interface {
+	Do(server, commandName string, args ...interface{}) (interface{}, error)
+}
+
+// NewSimulatedProxy creates a proxy from the input recording, whose commands are all answered by the simulator.
+// The proxy routes exactly as one created from the recorded configuration would, starting from the recorded mappings.
+// Options are applied as for NewProxyConn.
+func NewSimulatedProxy(rec *TopologyRecord, sim Simulator, opts ...Option) (*ProxyConn, error) {
+	if len(rec.Servers) == 0 {
+		return nil, errNoServers
+	}
+
+	t := &topology{servers: rec.Servers, hashTag: rec.HashTag}
+	t.ring, _ = newHashRing(rec.Servers, rec.Hash, rec.Distribution, rec.HashTag)
+	for _, desc := range rec.Servers {
+		t.pools = append(t.pools, &simPool{sim: sim, server: ServerAddr(desc)})
+	}
+
+	proxy := new(ProxyConn)
+	proxy.setTopology(t)
+	proxy.KeyInstance = make(map[string]ConnGetter, len(rec.Mappings))
+	proxy.keyInstanceMutex = new(sync.RWMutex)
+
+	for _, opt := range opts {
+		opt(proxy)
+	}
+
+	for k, server := range rec.Mappings {
+		if err := proxy.Map(k, server); err != nil {
+			return nil, err
+		}
+	}
+	return proxy, nil
+}
+
+// A pool of connections to one simulated instance.
+type simPool struct {
+	sim    Simulator
+	server string
+}
+
+func (p *simPool) Get() Conn {
+	return simConn{p}
+}
+
+type simConn struct {
+	pool *simPool
+}
+
+func (c simConn) Close() error {
+	return nil
+}
+
+func (c simConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return c.pool.sim.Do(c.pool.server, commandName, args...)
+}
+
+// MemorySimulator is a minimal Simulator holding string values in memory per instance.
+// It answers PING, GET, SET, DEL and EXISTS; other commands return an error.
+// Values may be seeded with Set to mirror where keys live in production.
+type MemorySimulator struct {
+	mu   sync.Mutex
+	data map[string]map[string]string
+}
+
+// NewMemorySimulator returns an empty MemorySimulator.
+func NewMemorySimulator() *MemorySimulator {
+	return &MemorySimulator{data: make(map[string]map[string]string)}
+}
+
+// Set stores the input value for the key on the instance with the input address.
+func (s *MemorySimulator) Set(server, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instance(server)[key] = value
+}
+
+// Returns the keys of the instance with the input address, creating them if needed. The mutex must be held.
+func (s *MemorySimulator) instance(server string) map[string]string {
+	d, ok := s.data[server]
+	if !ok {
+		d = make(map[string]string)
+		s.data[server] = d
+	}
+	return d
+}
+
+// Do runs the command against the simulated instance with the input address.
+func (s *MemorySimulator) Do(server, commandName string, args ...interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.instance(server)
+
+	keys := make([]string, len(args))
+	for i, a := range args {
+		var ok bool
+		if keys[i], ok = keyString(a); !ok {
+			keys[i] = fmt.Sprint(a)
+		}
+	}
+
+	switch strings.ToUpper(commandName) {
+	case "PING":
+		return "PONG", nil
+	case "GET":
+		if len(keys) != 1 {
+			break
+		}
+		if v, ok := d[keys[0]]; ok {
+			return []byte(v), nil
+		}
+		return nil, nil
+	case "SET":
+		if len(keys) != 2 {
+			break
+		}
+		d[keys[0]] = keys[1]
+		return "OK", nil
+	case "DEL", "EXISTS":
+		var n int64
+		for _, k := range keys {
+			if _, ok := d[k]; ok {
+				n++
+				if strings.ToUpper(commandName) == "DEL" {
+					delete(d, k)
+				}
+			}
+		}
+		return n, nil
+	default:
+		return nil, errors.New("ERR unsupported command '" + commandName + "' in simulation")
+	}
+	return nil, errors.New("ERR wrong number of arguments for '" + commandName + "' in simulation")
+}
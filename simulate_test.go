@@ -0,0 +1,45 @@
+package twunproxy
+
+import (
+	"testing"
+)
+
+func TestRecordTopologyAndSimulate(t *testing.T) {
+	servers := []string{"10.0.0.1:6379:1", "10.0.0.2:6379:1"}
+	pools := []ConnGetter{connPool{&nilStyleConn{}}, connPool{&nilStyleConn{}}}
+
+	proxy := getMockProxy(pools...)
+	ring, _ := newHashRing(servers, "fnv1a_64", "ketama", "{}")
+	proxy.setTopology(&topology{pools: pools, servers: servers, ring: ring, hashTag: "{}"})
+	proxy.KeyInstance["KNOWN"] = pools[1]
+
+	rec, err := proxy.RecordTopology()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rec.Hash != "fnv1a_64" || rec.Distribution != "ketama" || rec.Mappings["KNOWN"] != "10.0.0.2:6379" {
+		t.Fatalf("Unexpected recording: %+v", rec)
+	}
+
+	sim := NewMemorySimulator()
+	sim.Set("10.0.0.1:6379", "OTHER", "a")
+	sim.Set("10.0.0.2:6379", "KNOWN", "b")
+
+	simProxy, err := NewSimulatedProxy(rec, sim)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if server, ok := simProxy.Lookup("KNOWN"); !ok || server != "10.0.0.2:6379" {
+		t.Fatalf("Expected recorded mapping, got %s, %v", server, ok)
+	}
+
+	canMap := func(v interface{}) bool { return v != nil }
+	v, err := simProxy.Do(NewRedisCmd("GET", "OTHER"), canMap)
+	if err != nil || string(v.([]byte)) != "a" {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+	if server, _ := simProxy.Lookup("OTHER"); server != "10.0.0.1:6379" {
+		t.Fatalf("Expected key to be discovered on the simulated instance, got %s", server)
+	}
+}
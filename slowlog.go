@@ -0,0 +1,90 @@
+package twunproxy
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// SlowLogEntry is an entry from the slow log of an instance.
+// Client and ClientName are empty for instances older than Redis 4.0, which do not record them.
+type SlowLogEntry struct {
+	Server     string        `json:"server"`
+	ID         int64         `json:"id"`
+	Time       time.Time     `json:"time"`
+	Duration   time.Duration `json:"duration_ns"`
+	Args       []string      `json:"args"`
+	Client     string        `json:"client,omitempty"`
+	ClientName string        `json:"client_name,omitempty"`
+}
+
+// SlowLog fetches up to the input number of the most recent slow log entries from every instance concurrently
+// and returns them merged, newest first. A count of zero or less fetches the server default.
+// Entries from instances that fail are omitted, and the first error is returned with the rest,
+// or a PartialError if partial results are enabled.
+func (r *ProxyConn) SlowLog(count int) ([]SlowLogEntry, error) {
+	t := r.topology()
+	logs := make([][]SlowLogEntry, len(t.pools))
+
+	args := []interface{}{"GET"}
+	if count > 0 {
+		args = append(args, count)
+	}
+
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := c.Do("SLOWLOG", args...)
+		if err != nil {
+			return err
+		}
+
+		logs[i], err = parseSlowLog(t.server(i), v)
+		return err
+	})
+
+	var entries []SlowLogEntry
+	for _, l := range logs {
+		entries = append(entries, l...)
+	}
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].Time.After(entries[b].Time) })
+
+	return entries, r.fanOutError(t, errs)
+}
+
+// Decodes the reply of SLOWLOG GET from the instance with the input server name.
+func parseSlowLog(server string, v interface{}) ([]SlowLogEntry, error) {
+	reply, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("Unexpected reply to SLOWLOG GET.")
+	}
+
+	entries := make([]SlowLogEntry, 0, len(reply))
+	for _, e := range reply {
+		fields, ok := e.([]interface{})
+		if !ok || len(fields) < 4 {
+			return nil, errors.New("Unexpected slow log entry.")
+		}
+
+		id, _ := replyInt(fields[0])
+		ts, _ := replyInt(fields[1])
+		micros, _ := replyInt(fields[2])
+		entry := SlowLogEntry{
+			Server:   server,
+			ID:       id,
+			Time:     time.Unix(ts, 0),
+			Duration: time.Duration(micros) * time.Microsecond,
+		}
+
+		args, _ := fields[3].([]interface{})
+		for _, a := range args {
+			s, _ := replyString(a)
+			entry.Args = append(entry.Args, s)
+		}
+
+		if len(fields) >= 6 {
+			entry.Client, _ = replyString(fields[4])
+			entry.ClientName, _ = replyString(fields[5])
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,28 @@
+package twunproxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowLogMergesEntriesNewestFirst(t *testing.T) {
+	entry := func(id, ts int64, cmd string) []interface{} {
+		return []interface{}{id, ts, int64(1500), []interface{}{[]byte(cmd), []byte("KEY")},
+			[]byte("10.0.0.9:5000"), []byte("worker")}
+	}
+
+	proxy := getMockProxy(
+		connPool{&nilStyleConn{reply: []interface{}{entry(2, 300, "GET"), entry(1, 100, "SET")}}},
+		connPool{&nilStyleConn{reply: []interface{}{entry(7, 200, "KEYS")}}})
+
+	entries, err := proxy.SlowLog(10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 3 || entries[0].ID != 2 || entries[1].Server != "1" || entries[2].Args[0] != "SET" {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+	if entries[0].Duration != 1500*time.Microsecond || entries[0].ClientName != "worker" {
+		t.Fatalf("Unexpected entry: %+v", entries[0])
+	}
+}
@@ -0,0 +1,56 @@
+package twunproxy
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Snapshot describes the state of a single instance captured by SnapshotAll.
+// Offset is the master replication offset recorded while writes were paused.
+type Snapshot struct {
+	Server string `json:"server"`
+	Offset int64  `json:"offset"`
+	Err    error  `json:"-"`
+}
+
+// SnapshotAll produces a near-consistent point-in-time snapshot set across every instance in the pool.
+// Writes are paused on all instances using PauseAll for at most the input duration.
+// While paused, the replication offset of each instance is recorded and a BGSAVE is triggered.
+// The instances are then unpaused, whatever the outcome.
+// NOTE: Pausing writes requires Redis 6.2 or later on every instance.
+func (r *ProxyConn) SnapshotAll(pause time.Duration) ([]Snapshot, error) {
+	if err := r.PauseAll(pause, PauseModeWrite); err != nil {
+		return nil, err
+	}
+	defer r.Unpause()
+
+	t := r.topology()
+	snaps := make([]Snapshot, len(t.pools))
+	errs := t.forEach(func(i int, c Conn) error {
+		snaps[i].Server = t.server(i)
+
+		v, err := c.Do("INFO", "replication")
+		if err != nil {
+			return err
+		}
+
+		info, err := parseInfo(v)
+		if err != nil {
+			return err
+		}
+
+		if snaps[i].Offset, err = strconv.ParseInt(info["master_repl_offset"], 10, 64); err != nil {
+			return errors.New("Unable to read replication offset.")
+		}
+
+		_, err = c.Do("BGSAVE")
+		return err
+	})
+
+	for i, err := range errs {
+		snaps[i].Err = err
+	}
+
+	return snaps, nil
+}
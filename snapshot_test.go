@@ -0,0 +1,62 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestSnapshotAllRecordsOffsetsAndSavesEachPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	offsets := []string{"100", "200"}
+	for i, c := range []*MockConn{mockConn1, mockConn2} {
+		info := []byte("# Replication\r\nrole:master\r\nmaster_repl_offset:" + offsets[i] + "\r\n")
+		gomock.InOrder(
+			c.EXPECT().Do("CLIENT", "PAUSE", int64(500), "WRITE").Return("OK", nil),
+			c.EXPECT().Do("INFO", "replication").Return(info, nil),
+			c.EXPECT().Do("BGSAVE").Return("Background saving started", nil),
+			c.EXPECT().Do("CLIENT", "UNPAUSE").Return("OK", nil),
+		)
+		c.EXPECT().Close().Times(3)
+	}
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+	proxy.Servers = []string{"10.0.0.1:6379:1 one", "10.0.0.2:6379:1 two"}
+
+	snaps, err := proxy.SnapshotAll(500 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if snaps[0].Server != "10.0.0.1:6379" || snaps[0].Offset != 100 || snaps[0].Err != nil {
+		t.Fatalf("Unexpected snapshot: %+v", snaps[0])
+	}
+
+	if snaps[1].Server != "10.0.0.2:6379" || snaps[1].Offset != 200 || snaps[1].Err != nil {
+		t.Fatalf("Unexpected snapshot: %+v", snaps[1])
+	}
+}
+
+func TestSnapshotAllUnpausesWhenPauseFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("CLIENT", "PAUSE", int64(500), "WRITE").Return("OK", nil)
+	mockConn2.EXPECT().Do("CLIENT", "PAUSE", int64(500), "WRITE").Return(nil, errors.New("ERR unknown command"))
+	mockConn1.EXPECT().Do("CLIENT", "UNPAUSE").Return("OK", nil)
+	mockConn2.EXPECT().Do("CLIENT", "UNPAUSE").Return(nil, errors.New("ERR unknown command"))
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Close().Times(2)
+
+	if _, err := getMockProxy(mockPool1, mockPool2).SnapshotAll(500 * time.Millisecond); err == nil {
+		t.Fatal("Expected error from failed pause.")
+	}
+}
@@ -0,0 +1,77 @@
+package twunproxy
+
+import (
+	"context"
+)
+
+// SpanStarter starts tracing spans, such as OpenTelemetry spans, for the commands run through the proxy.
+// The otel subpackage provides one for OpenTelemetry.
+// Each command gets a span named after it, with a child span named "<command> probe" for each instance probed
+// by discovery. The command span is annotated with "twunproxy.mapping_hit", "server.address" once the instance is
+// known, and "twunproxy.outcome", which is "ok", "not_found" or "error". Each probe span is annotated with the
+// "server.address" of its instance and a "twunproxy.outcome" of "accepted", "rejected", "error", "aborted" for a probe
+// interrupted once another instance accepted the command, or "discarded" for an acceptance that came too late.
+type SpanStarter interface {
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a SpanStarter. Attribute values are strings, bools or ints.
+// End is called once, with the error of the command if it failed.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End(err error)
+}
+
+// WithSpans sets the SpanStarter that traces every command run through the proxy.
+func WithSpans(s SpanStarter) Option {
+	return func(r *ProxyConn) {
+		r.spans = s
+	}
+}
+
+// The context key of the span of the command running under a context.
+type spanKey struct{}
+
+// A Span discarding everything, used when no SpanStarter is configured.
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(string, interface{}) {}
+func (nopSpan) End(error)                        {}
+
+// Starts a span with the input name if a SpanStarter is configured, and returns a context carrying it.
+func (r *ProxyConn) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if r.spans == nil {
+		return ctx, nopSpan{}
+	}
+
+	ctx, s := r.spans.StartSpan(ctx, name)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Returns the span of the command running under the input context, or one discarding everything.
+func (r *ProxyConn) span(ctx context.Context) Span {
+	if r.spans == nil {
+		return nopSpan{}
+	}
+	if s, ok := ctx.Value(spanKey{}).(Span); ok {
+		return s
+	}
+	return nopSpan{}
+}
+
+// Annotates the input span with its outcome and ends it.
+func endSpan(s Span, outcome string, err error) {
+	s.SetAttribute("twunproxy.outcome", outcome)
+	s.End(err)
+}
+
+// Returns the outcome of a command span for the error returned by the command.
+func commandOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case err == ErrNoMapping:
+		return "not_found"
+	}
+	return "error"
+}
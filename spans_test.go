@@ -0,0 +1,104 @@
+package twunproxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records the spans started and their attributes once ended.
+type recordingSpans struct {
+	mu    sync.Mutex
+	ended []*recordedSpan
+}
+
+type recordedSpan struct {
+	spans *recordingSpans
+	name  string
+	attrs map[string]interface{}
+	err   error
+}
+
+func (s *recordingSpans) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, &recordedSpan{spans: s, name: name, attrs: make(map[string]interface{})}
+}
+
+func (s *recordingSpans) spans() []*recordedSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*recordedSpan(nil), s.ended...)
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.spans.mu.Lock()
+	defer s.spans.mu.Unlock()
+	s.attrs[key] = value
+}
+
+func (s *recordedSpan) End(err error) {
+	s.spans.mu.Lock()
+	defer s.spans.mu.Unlock()
+	s.err = err
+	s.spans.ended = append(s.spans.ended, s)
+}
+
+func TestSpansTraceCommandAndProbes(t *testing.T) {
+	rec := &recordingSpans{}
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: []byte("v")}}, connPool{&nilStyleConn{}})
+	proxy.Servers = []string{"a:6379:1", "b:6379:1"}
+	WithSpans(rec)(proxy)
+
+	if _, err := proxy.Do(NewRedisCmd("GET", "key"), KeyFound); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The probe of the rejecting instance may end after the command.
+	deadline := time.Now().Add(time.Second)
+	for len(rec.spans()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	byName := make(map[string]map[string]interface{})
+	probes := make(map[interface{}]interface{})
+	for _, s := range rec.spans() {
+		if s.name == "GET probe" {
+			probes[s.attrs["server.address"]] = s.attrs["twunproxy.outcome"]
+			continue
+		}
+		byName[s.name] = s.attrs
+	}
+
+	cmd := byName["GET"]
+	if cmd["twunproxy.mapping_hit"] != false || cmd["server.address"] != "a:6379" || cmd["twunproxy.outcome"] != "ok" {
+		t.Fatalf("Unexpected command span: %v", cmd)
+	}
+	if probes["a:6379"] != "accepted" || probes["b:6379"] != "rejected" {
+		t.Fatalf("Unexpected probe spans: %v", probes)
+	}
+
+	// A mapped command has no probes.
+	if _, err := proxy.Do(NewRedisCmd("GET", "key"), KeyFound); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	last := rec.spans()[len(rec.spans())-1]
+	if len(rec.spans()) != 4 || last.attrs["twunproxy.mapping_hit"] != true || last.attrs["server.address"] != "a:6379" {
+		t.Fatalf("Unexpected span for mapped command: %+v", last.attrs)
+	}
+}
+
+func TestSpansReportMissingKeys(t *testing.T) {
+	rec := &recordingSpans{}
+	proxy := getMockProxy(connPool{&nilStyleConn{}})
+	WithSpans(rec)(proxy)
+
+	if _, err := proxy.Do(NewRedisCmd("GET", "key"), KeyFound); err != ErrNoMapping {
+		t.Fatalf("Expected ErrNoMapping, got %v", err)
+	}
+
+	spans := rec.spans()
+	last := spans[len(spans)-1]
+	if last.name != "GET" || last.attrs["twunproxy.outcome"] != "not_found" || last.err != ErrNoMapping {
+		t.Fatalf("Unexpected command span: %+v", last)
+	}
+}
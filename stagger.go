@@ -0,0 +1,183 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// DefaultStaggerPoll is the interval between INFO polls when waiting for a save to complete, if none is configured.
+const DefaultStaggerPoll = time.Second
+
+// DefaultCPUWindow is the period over which instance CPU usage is measured, if none is configured.
+const DefaultCPUWindow = time.Second
+
+// Stagger controls how an operation such as BGSAVE is spread across the instances of the pool.
+// The zero value runs the operation on one instance at a time with no delay.
+//
+// Interval is a fixed delay after each instance, or batch of instances.
+// If WaitForCompletion is set, INFO persistence is polled every PollInterval after each instance, until no save or
+// AOF rewrite is in progress there, so that two instances never fork at once. A save that then reports failure is
+// an error for the instance. If CompletionTimeout is positive, it bounds the wait on each instance.
+// If SkipBusy is set, instances already forked for a save or AOF rewrite are skipped.
+// If MaxCPU is positive, instances whose Redis process used more than that many CPU seconds per second over
+// CPUWindow are also skipped.
+// Concurrency is the fraction of the pool, between 0 and 1, that may run the operation at once.
+// Delays and waits then apply between batches of that size.
+type Stagger struct {
+	Interval          time.Duration
+	WaitForCompletion bool
+	PollInterval      time.Duration
+	CompletionTimeout time.Duration
+	SkipBusy          bool
+	MaxCPU            float64
+	CPUWindow         time.Duration
+	Concurrency       float64
+}
+
+// BGSaveStaggered issues BGSAVE across the pool according to the input stagger strategy and reports on every instance.
+// Skipped instances are reported with Skipped set; they are not saved.
+func (r *ProxyConn) BGSaveStaggered(ctx context.Context, s Stagger, opts InstanceOptions) ([]InstanceResult, error) {
+	return r.eachInstance(ctx, opts, s, "BGSAVE")
+}
+
+// BGSaveAndWait issues BGSAVE to each instance in turn, moving to the next only once the save has completed,
+// as shown by INFO persistence polled every pollInterval, so that no two instances fork at once.
+// It returns once the save on the last instance has completed. An instance whose save fails or does not complete
+// within the input timeout carries the error in its result, with TimedOut set for a timeout, and stops the run
+// unless opts.Continue is set. The timeout of opts bounds issuing BGSAVE, as for BGSaveEach.
+func (r *ProxyConn) BGSaveAndWait(
+	ctx context.Context,
+	pollInterval, timeout time.Duration,
+	opts InstanceOptions) ([]InstanceResult, error) {
+
+	s := Stagger{WaitForCompletion: true, PollInterval: pollInterval, CompletionTimeout: timeout}
+	res, err := r.eachInstance(ctx, opts, s, "BGSAVE")
+	if err != nil || len(res) == 0 {
+		return res, err
+	}
+
+	// Saves are only awaited between instances, so the last is awaited here.
+	t := r.topology()
+	last := len(res) - 1
+	if last >= len(t.pools) {
+		return res, nil
+	}
+	return res, r.awaitBatch(ctx, opts, s, t, res, last, last+1)
+}
+
+// Returns the number of instances in each batch for a pool of the input size.
+func (s Stagger) batchSize(n int) int {
+	b := int(s.Concurrency * float64(n))
+	if b < 1 {
+		b = 1
+	}
+	return b
+}
+
+// Reports whether the instance is too busy to start the operation, according to the strategy.
+func (s Stagger) busy(ctx context.Context, c Conn) (bool, error) {
+	if s.SkipBusy {
+		info, err := infoSection(ctx, c, "persistence")
+		if err != nil {
+			return false, err
+		}
+		if forking(info) {
+			return true, nil
+		}
+	}
+
+	if s.MaxCPU > 0 {
+		window := s.CPUWindow
+		if window <= 0 {
+			window = DefaultCPUWindow
+		}
+
+		cpu, err := cpuUsage(ctx, c, window)
+		if err != nil {
+			return false, err
+		}
+		return cpu > s.MaxCPU, nil
+	}
+	return false, nil
+}
+
+// Waits until no save or AOF rewrite is in progress on the instance, or the context ends.
+func (s Stagger) awaitCompletion(ctx context.Context, c Conn) error {
+	poll := s.PollInterval
+	if poll <= 0 {
+		poll = DefaultStaggerPoll
+	}
+
+	for {
+		info, err := infoSection(ctx, c, "persistence")
+		if err != nil {
+			return err
+		}
+		if !forking(info) {
+			if info["rdb_last_bgsave_status"] == "err" {
+				return errors.New("Background save failed.")
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+	}
+}
+
+// Indicates whether INFO persistence fields show a fork for an RDB save or AOF rewrite.
+func forking(info map[string]string) bool {
+	return info["rdb_bgsave_in_progress"] == "1" || info["aof_rewrite_in_progress"] == "1"
+}
+
+// Returns the fields of the input INFO section from the instance.
+func infoSection(ctx context.Context, c Conn, section string) (map[string]string, error) {
+	v, err := doContext(ctx, c, "INFO", section)
+	if err != nil {
+		return nil, err
+	}
+	return parseInfo(v)
+}
+
+// Measures the CPU seconds per second used by the instance over the input window, from INFO cpu.
+func cpuUsage(ctx context.Context, c Conn, window time.Duration) (float64, error) {
+	before, err := cpuSeconds(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(window):
+	}
+
+	after, err := cpuSeconds(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+	return (after - before) / window.Seconds(), nil
+}
+
+// Returns the total system and user CPU seconds used by the instance.
+func cpuSeconds(ctx context.Context, c Conn) (float64, error) {
+	info, err := infoSection(ctx, c, "cpu")
+	if err != nil {
+		return 0, err
+	}
+
+	var total float64
+	for _, f := range []string{"used_cpu_sys", "used_cpu_user"} {
+		n, err := strconv.ParseFloat(info[f], 64)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
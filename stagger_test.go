@@ -0,0 +1,111 @@
+package twunproxy
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestBGSaveStaggeredSkipsBusyInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("INFO", "persistence").Return("rdb_bgsave_in_progress:1\r\naof_rewrite_in_progress:0\r\n", nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("INFO", "persistence").Return("rdb_bgsave_in_progress:0\r\naof_rewrite_in_progress:0\r\n", nil)
+	mockConn2.EXPECT().Do("BGSAVE").Return("Background saving started", nil)
+	mockConn2.EXPECT().Close()
+
+	res, err := getMockProxy(mockPool1, mockPool2).BGSaveStaggered(context.Background(), Stagger{SkipBusy: true}, InstanceOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !res[0].Skipped || res[0].Issued || res[1].Skipped || !res[1].Issued {
+		t.Fatalf("Unexpected results: %+v", res)
+	}
+}
+
+func TestBGSaveStaggeredWaitsForCompletion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	gomock.InOrder(
+		mockConn1.EXPECT().Do("BGSAVE").Return("Background saving started", nil),
+		mockConn1.EXPECT().Do("INFO", "persistence").Return("rdb_bgsave_in_progress:1\r\n", nil),
+		mockConn1.EXPECT().Do("INFO", "persistence").Return("rdb_bgsave_in_progress:0\r\n", nil),
+		mockConn2.EXPECT().Do("BGSAVE").Return("Background saving started", nil),
+	)
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Close()
+
+	s := Stagger{WaitForCompletion: true, PollInterval: time.Millisecond}
+	res, err := getMockProxy(mockPool1, mockPool2).BGSaveStaggered(context.Background(), s, InstanceOptions{})
+	if err != nil || !res[0].Issued || !res[1].Issued {
+		t.Fatalf("Unexpected result: %+v, %v", res, err)
+	}
+}
+
+func TestBGSaveAndWaitAwaitsEveryInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	gomock.InOrder(
+		mockConn1.EXPECT().Do("BGSAVE").Return("Background saving started", nil),
+		mockConn1.EXPECT().Do("INFO", "persistence").Return("rdb_bgsave_in_progress:0\r\nrdb_last_bgsave_status:ok\r\n", nil),
+		mockConn2.EXPECT().Do("BGSAVE").Return("Background saving started", nil),
+		mockConn2.EXPECT().Do("INFO", "persistence").Return("rdb_bgsave_in_progress:1\r\n", nil),
+		mockConn2.EXPECT().Do("INFO", "persistence").Return("rdb_bgsave_in_progress:0\r\nrdb_last_bgsave_status:err\r\n", nil),
+	)
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Close().Times(2)
+
+	res, err := getMockProxy(mockPool1, mockPool2).BGSaveAndWait(context.Background(), time.Millisecond, time.Second, InstanceOptions{})
+	if err == nil || res[0].Err != nil || res[1].Err != err || res[1].TimedOut {
+		t.Fatalf("Unexpected result: %+v, %v", res, err)
+	}
+}
+
+func TestBGSaveAndWaitTimesOutSlowSave(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("BGSAVE").Return("Background saving started", nil)
+	mockConn1.EXPECT().Do("INFO", "persistence").Return("rdb_bgsave_in_progress:1\r\n", nil).MinTimes(1)
+	mockConn1.EXPECT().Close().Times(2)
+	mockConn2.EXPECT().Do("BGSAVE").Return("Background saving started", nil)
+	mockConn2.EXPECT().Do("INFO", "persistence").Return("rdb_bgsave_in_progress:0\r\n", nil)
+	mockConn2.EXPECT().Close().Times(2)
+
+	opts := InstanceOptions{Continue: true}
+	res, err := getMockProxy(mockPool1, mockPool2).BGSaveAndWait(context.Background(), 10*time.Millisecond, 50*time.Millisecond, opts)
+	if err != nil || !res[0].TimedOut || !res[1].Issued || res[1].Err != nil {
+		t.Fatalf("Unexpected result: %+v, %v", res, err)
+	}
+}
+
+func TestStaggerBatchSize(t *testing.T) {
+	cases := []struct {
+		concurrency float64
+		n, want     int
+	}{
+		{0, 10, 1},
+		{0.25, 10, 2},
+		{0.5, 3, 1},
+		{1, 4, 4},
+	}
+
+	for _, c := range cases {
+		if got := (Stagger{Concurrency: c.concurrency}).batchSize(c.n); got != c.want {
+			t.Fatalf("Batch size for %v of %d: expected %d, got %d", c.concurrency, c.n, c.want, got)
+		}
+	}
+}
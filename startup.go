@@ -0,0 +1,169 @@
+package twunproxy
+
+import (
+	"errors"
+	"time"
+)
+
+// Returned when the configured pool has no servers.
+var errNoServers = errors.New("No servers are configured for the pool.")
+
+// Returned for commands issued while the proxy has no pools, such as after a degraded startup.
+var errNoPools error = unavailableError("No pools are available.")
+
+// StartupMode determines what NewProxyConn does when the pool has no servers or its servers fail the startup PING.
+type StartupMode int
+
+const (
+	// StartupFail returns the error from NewProxyConn. This is the default.
+	StartupFail StartupMode = iota
+
+	// StartupDegrade returns a proxy with no pools. Commands fail without blocking until Reload succeeds.
+	StartupDegrade
+
+	// StartupRetry returns a proxy with no pools, as for StartupDegrade,
+	// and reloads the configuration in the background until the pools start.
+	StartupRetry
+
+	// StartupQuarantine returns a proxy with every configured pool, quarantining those that failed the PING.
+	// A HealthMonitor checking at the retry interval re-admits them when they answer.
+	// The configuration must still be readable and name at least one server.
+	StartupQuarantine
+)
+
+// DefaultStartupRetryInterval is the interval between background startup attempts if none is configured.
+const DefaultStartupRetryInterval = 5 * time.Second
+
+// StartupPolicy configures the behaviour of NewProxyConn when no pools can be started.
+// OnEvent, if set, is called when the proxy starts degraded, after each failed background attempt,
+// and when a background attempt succeeds.
+type StartupPolicy struct {
+	Mode          StartupMode
+	RetryInterval time.Duration
+	OnEvent       func(StartupEvent)
+}
+
+// StartupEvent reports a change in the startup state of the proxy.
+// Attempt is 0 for the initial attempt in NewProxyConn and counts background attempts after that.
+// Err is nil for the event raised when the pools start.
+type StartupEvent struct {
+	Time    time.Time
+	Attempt int
+	Err     error
+}
+
+// WithStartupPolicy sets the behaviour of NewProxyConn when no pools can be started.
+// Embedding services can then choose availability over failing fast when Redis is not yet reachable.
+// Degraded startup events are also counted in the proxy metrics as "startup_failures".
+func WithStartupPolicy(p StartupPolicy) Option {
+	return func(r *ProxyConn) {
+		if p.RetryInterval <= 0 {
+			p.RetryInterval = DefaultStartupRetryInterval
+		}
+		r.startup = p
+	}
+}
+
+// Reads the configured pools as for loadPools, but treats a pool with no servers as a failure.
+func (r *ProxyConn) loadTopology() (*topology, error) {
+	t, err := r.loadPools()
+	if err != nil {
+		return nil, err
+	}
+	if len(t.pools) == 0 {
+		return nil, errNoServers
+	}
+	return t, nil
+}
+
+// Applies the startup policy to the input error from the initial attempt to start the pools.
+// The error is returned if the proxy should not be used.
+func (r *ProxyConn) degradedStartup(err error) error {
+	if r.startup.Mode == StartupFail {
+		return err
+	}
+
+	if r.startup.Mode == StartupQuarantine {
+		return r.quarantinedStartup()
+	}
+
+	r.startupEvent(0, err)
+	if r.startup.Mode == StartupRetry {
+		go r.retryStartup()
+	}
+	return nil
+}
+
+// Installs every configured pool, quarantining those that fail their PING under a health monitor.
+func (r *ProxyConn) quarantinedStartup() error {
+	t, errs, err := r.openPools()
+	if err != nil {
+		return err
+	}
+	if len(t.pools) == 0 {
+		return errNoServers
+	}
+
+	var failed []int
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, i)
+		}
+	}
+
+	r.setTopology(t)
+	m := newHealthMonitor(r, HealthCheck{Interval: r.startup.RetryInterval})
+	m.quarantine(t, failed)
+	r.installHealthMonitor(m)
+	go m.run()
+
+	r.startupEvent(0, firstError(errs))
+	return nil
+}
+
+// Attempts to start the pools at the retry interval until successful or the proxy is closed.
+// Any pools installed in the meantime by Reload end the retries.
+func (r *ProxyConn) retryStartup() {
+	t := time.NewTicker(r.startup.RetryInterval)
+	defer t.Stop()
+
+	done := make(chan bool)
+	stop := r.onClose(func() { close(done) })
+	defer stop()
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		if len(r.topology().pools) > 0 {
+			return
+		}
+
+		top, err := r.loadTopology()
+		if err != nil {
+			r.startupEvent(attempt, err)
+			continue
+		}
+
+		r.setTopology(top)
+		r.purgeMappings()
+		r.startupEvent(attempt, nil)
+		return
+	}
+}
+
+// Records a startup event in the metrics and passes it to the handler, if one is configured.
+func (r *ProxyConn) startupEvent(attempt int, err error) {
+	if err != nil {
+		r.counter("startup_failures", "", 1)
+		r.log().Warn("Startup failed", "attempt", attempt, "err", err)
+	} else if attempt > 0 {
+		r.log().Info("Started", "attempt", attempt)
+	}
+
+	if r.startup.OnEvent != nil {
+		r.startup.OnEvent(StartupEvent{Time: time.Now(), Attempt: attempt, Err: err})
+	}
+}
@@ -0,0 +1,90 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewProxyConnFailsForPoolWithNoServers(t *testing.T) {
+	path := writeConfig(t, "alpha:\n  servers:\n")
+	defer os.Remove(path)
+
+	create := func(desc, auth string) ConnGetter { return nil }
+	if _, err := NewProxyConn(path, "alpha", 0, create); err != errNoServers {
+		t.Fatalf("Expected no servers error, got %v", err)
+	}
+}
+
+func TestDegradedStartupReturnsProxyWithNoPools(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("PING").Return(nil, errors.New("Connection refused."))
+	mockConn.EXPECT().Close()
+
+	path := writeConfig(t, "alpha:\n  servers:\n   - 10.0.0.1:6379:1\n")
+	defer os.Remove(path)
+
+	var events []StartupEvent
+	policy := StartupPolicy{Mode: StartupDegrade, OnEvent: func(e StartupEvent) { events = append(events, e) }}
+	create := func(desc, auth string) ConnGetter { return mockPool }
+
+	proxy, err := NewProxyConn(path, "alpha", 0, create, WithStartupPolicy(policy))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].Err == nil {
+		t.Fatalf("Expected a degraded startup event, got %+v", events)
+	}
+
+	if _, err := proxy.Do(getRedisCmd(), func(interface{}) bool { return true }); err != errNoPools {
+		t.Fatalf("Expected no pools error, got %v", err)
+	}
+}
+
+func TestRetryStartupInstallsPoolsOnceAvailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	gomock.InOrder(
+		mockConn.EXPECT().Do("PING").Return(nil, errors.New("Connection refused.")),
+		mockConn.EXPECT().Do("PING").Return("PONG", nil),
+	)
+	mockConn.EXPECT().Close().Times(2)
+
+	path := writeConfig(t, "alpha:\n  servers:\n   - 10.0.0.1:6379:1\n")
+	defer os.Remove(path)
+
+	started := make(chan StartupEvent, 2)
+	policy := StartupPolicy{
+		Mode:          StartupRetry,
+		RetryInterval: 10 * time.Millisecond,
+		OnEvent:       func(e StartupEvent) { started <- e },
+	}
+	create := func(desc, auth string) ConnGetter { return mockPool }
+
+	proxy, err := NewProxyConn(path, "alpha", 0, create, WithStartupPolicy(policy))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, want := range []bool{true, false} {
+		select {
+		case e := <-started:
+			if (e.Err != nil) != want {
+				t.Fatalf("Unexpected startup event: %+v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for startup event.")
+		}
+	}
+
+	if len(proxy.topology().pools) != 1 {
+		t.Fatal("Expected pools to be installed after retry.")
+	}
+}
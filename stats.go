@@ -0,0 +1,239 @@
+package twunproxy
+
+import (
+	"sync"
+	"time"
+)
+
+// StatsSnapshot is a copy of the counters and observations recorded by the proxy, by metric name and then instance.
+// The instance is empty for pool-wide values. Names are those passed to any configured Metrics sink.
+// Window is zero for a snapshot, and the time between the two snapshots for a difference.
+type StatsSnapshot struct {
+	Time         time.Time                         `json:"time"`
+	Window       time.Duration                     `json:"window_ns"`
+	Counters     map[string]map[string]float64     `json:"counters"`
+	Observations map[string]map[string]Observation `json:"observations"`
+}
+
+// Observation summarises the values observed for a metric, such as a latency.
+type Observation struct {
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+}
+
+// Mean returns the mean of the values observed, or zero if there were none.
+func (o Observation) Mean() float64 {
+	if o.Count == 0 {
+		return 0
+	}
+	return o.Sum / float64(o.Count)
+}
+
+// ProxyStats is a typed snapshot of the activity of the proxy: the statistics of each instance, in pool order,
+// and of the key mappings.
+type ProxyStats struct {
+	Time      time.Time       `json:"time"`
+	Instances []InstanceStats `json:"instances"`
+	Mapping   MappingStats    `json:"mapping"`
+}
+
+// InstanceStats is the activity of one instance since the proxy was created or its stats were reset.
+// Commands counts every command run on the instance, including discovery probes, and Errors those that failed.
+// Probes interrupted once another instance accepts the command are not counted.
+// MappingHits counts the commands routed to the instance by a key mapping, and Discoveries the keys found on it by
+// discovery after a mapping miss. MeanLatency is the mean time for the instance to reply to a command.
+// RateLimit is the limit currently applied to the instance, and RateLimited counts the probes and broadcasts
+// that waited for it.
+type InstanceStats struct {
+	Server      string        `json:"server"`
+	Commands    int64         `json:"commands"`
+	Probes      int64         `json:"probes"`
+	Errors      int64         `json:"errors"`
+	MappingHits int64         `json:"mapping_hits"`
+	Discoveries int64         `json:"discoveries"`
+	MeanLatency time.Duration `json:"mean_latency_ns"`
+	RateLimit   RateLimit     `json:"rate_limit"`
+	RateLimited int64         `json:"rate_limited"`
+}
+
+// Holds the counters and observations recorded by the proxy. The zero value is ready for use.
+type statsStore struct {
+	mu           sync.Mutex
+	counters     map[string]map[string]float64
+	observations map[string]map[string]Observation
+}
+
+// SnapshotStats returns a copy of the counters and observations recorded by the proxy since it was created
+// or its stats were last reset. These are kept whether or not a Metrics sink is configured.
+func (r *ProxyConn) SnapshotStats() StatsSnapshot {
+	return r.stats.snapshot()
+}
+
+// Stats returns the activity of each instance and of the key mappings, such as for dashboards or for sizing
+// a bounded KeyMapper. The instance values are those of SnapshotStats, and are cleared by ResetStats.
+func (r *ProxyConn) Stats() ProxyStats {
+	snap := r.stats.snapshot()
+	t := r.topology()
+
+	s := ProxyStats{Time: snap.Time, Instances: make([]InstanceStats, len(t.pools)), Mapping: r.MappingStats()}
+	for i := range t.pools {
+		server := t.server(i)
+		s.Instances[i] = InstanceStats{
+			Server:      server,
+			Commands:    int64(snap.Counters["commands"][server]),
+			Probes:      int64(snap.Counters["discovery_probes"][server]),
+			Errors:      int64(snap.Counters["command_errors"][server]),
+			MappingHits: int64(snap.Counters["mapped_commands"][server]),
+			Discoveries: int64(snap.Counters["discoveries"][server]),
+			MeanLatency: time.Duration(snap.Observations["command_latency_seconds"][server].Mean() * float64(time.Second)),
+			RateLimit:   r.RateLimit(server),
+			RateLimited: int64(snap.Counters["rate_limited"][server]),
+		}
+	}
+	return s
+}
+
+// ResetStats clears every counter and observation recorded by the proxy.
+func (r *ProxyConn) ResetStats() {
+	r.stats.reset(func(string) bool { return true })
+}
+
+// ResetServerStats clears the counters and observations recorded for the instance with the input server address.
+// Pool-wide values are kept.
+func (r *ProxyConn) ResetServerStats(server string) {
+	r.stats.reset(func(instance string) bool { return instance == server })
+}
+
+// Diff returns the activity between the input earlier snapshot and this one.
+// A value lower than in the earlier snapshot was reset in between, so its current value is taken as the activity.
+func (s StatsSnapshot) Diff(prev StatsSnapshot) StatsSnapshot {
+	d := StatsSnapshot{
+		Time:         s.Time,
+		Window:       s.Time.Sub(prev.Time),
+		Counters:     make(map[string]map[string]float64, len(s.Counters)),
+		Observations: make(map[string]map[string]Observation, len(s.Observations)),
+	}
+
+	for name, byInstance := range s.Counters {
+		d.Counters[name] = make(map[string]float64, len(byInstance))
+		for instance, v := range byInstance {
+			if p := prev.Counters[name][instance]; p <= v {
+				v -= p
+			}
+			d.Counters[name][instance] = v
+		}
+	}
+
+	for name, byInstance := range s.Observations {
+		d.Observations[name] = make(map[string]Observation, len(byInstance))
+		for instance, o := range byInstance {
+			if p := prev.Observations[name][instance]; p.Count <= o.Count {
+				o = Observation{Count: o.Count - p.Count, Sum: o.Sum - p.Sum}
+			}
+			d.Observations[name][instance] = o
+		}
+	}
+	return d
+}
+
+// Adds the delta to the named counter of the instance.
+func (s *statsStore) add(name, instance string, delta float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counters == nil {
+		s.counters = make(map[string]map[string]float64)
+	}
+	if s.counters[name] == nil {
+		s.counters[name] = make(map[string]float64)
+	}
+	s.counters[name][instance] += delta
+}
+
+// Returns a copy of the values of the named counter, by instance.
+func (s *statsStore) counter(name string) map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := make(map[string]float64, len(s.counters[name]))
+	for instance, v := range s.counters[name] {
+		values[instance] = v
+	}
+	return values
+}
+
+// Records the value observed for the named metric of the instance.
+func (s *statsStore) observe(name, instance string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.observations == nil {
+		s.observations = make(map[string]map[string]Observation)
+	}
+	if s.observations[name] == nil {
+		s.observations[name] = make(map[string]Observation)
+	}
+	o := s.observations[name][instance]
+	s.observations[name][instance] = Observation{Count: o.Count + 1, Sum: o.Sum + value}
+}
+
+// Returns a copy of the recorded values.
+func (s *statsStore) snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := StatsSnapshot{
+		Time:         time.Now(),
+		Counters:     make(map[string]map[string]float64, len(s.counters)),
+		Observations: make(map[string]map[string]Observation, len(s.observations)),
+	}
+	for name, byInstance := range s.counters {
+		snap.Counters[name] = make(map[string]float64, len(byInstance))
+		for instance, v := range byInstance {
+			snap.Counters[name][instance] = v
+		}
+	}
+	for name, byInstance := range s.observations {
+		snap.Observations[name] = make(map[string]Observation, len(byInstance))
+		for instance, o := range byInstance {
+			snap.Observations[name][instance] = o
+		}
+	}
+	return snap
+}
+
+// Clears the recorded values of every instance for which the input function returns true.
+func (s *statsStore) reset(match func(instance string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, byInstance := range s.counters {
+		for instance := range byInstance {
+			if match(instance) {
+				delete(byInstance, instance)
+			}
+		}
+	}
+	for _, byInstance := range s.observations {
+		for instance := range byInstance {
+			if match(instance) {
+				delete(byInstance, instance)
+			}
+		}
+	}
+}
+
+// Records a command run on the instance with the input server address, routed by a mapping or as a discovery probe,
+// with the time it took to reply and any error.
+func (r *ProxyConn) recordCommand(server string, probe bool, d time.Duration, err error) {
+	r.counter("commands", server, 1)
+	if probe {
+		r.counter("discovery_probes", server, 1)
+	} else {
+		r.counter("mapped_commands", server, 1)
+	}
+	if err != nil {
+		r.counter("command_errors", server, 1)
+	}
+	r.histogram("command_latency_seconds", server, d.Seconds())
+}
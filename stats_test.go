@@ -0,0 +1,80 @@
+package twunproxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStatsSnapshotDiffAndReset(t *testing.T) {
+	proxy := getMockProxy()
+	proxy.counter("commands", "10.0.0.1:6379", 2)
+	proxy.counter("commands", "10.0.0.2:6379", 1)
+	proxy.histogram("latency_seconds", "10.0.0.1:6379", 0.5)
+
+	before := proxy.SnapshotStats()
+	time.Sleep(time.Millisecond)
+	proxy.counter("commands", "10.0.0.1:6379", 3)
+	proxy.histogram("latency_seconds", "10.0.0.1:6379", 1.5)
+
+	d := proxy.SnapshotStats().Diff(before)
+	if d.Counters["commands"]["10.0.0.1:6379"] != 3 || d.Counters["commands"]["10.0.0.2:6379"] != 0 {
+		t.Fatalf("Unexpected counters: %v", d.Counters)
+	}
+	if o := d.Observations["latency_seconds"]["10.0.0.1:6379"]; o.Count != 1 || o.Mean() != 1.5 {
+		t.Fatalf("Unexpected observation: %+v", o)
+	}
+	if d.Window <= 0 {
+		t.Fatalf("Expected a positive window, got %v", d.Window)
+	}
+
+	proxy.ResetServerStats("10.0.0.1:6379")
+	snap := proxy.SnapshotStats()
+	if _, ok := snap.Counters["commands"]["10.0.0.1:6379"]; ok || snap.Counters["commands"]["10.0.0.2:6379"] != 1 {
+		t.Fatalf("Unexpected counters after server reset: %v", snap.Counters)
+	}
+
+	proxy.ResetStats()
+	if d := proxy.SnapshotStats().Diff(before); d.Counters["commands"]["10.0.0.2:6379"] != 0 {
+		t.Fatalf("Unexpected counters after reset: %v", d.Counters)
+	}
+}
+
+func TestStatsCountsCommandsByInstance(t *testing.T) {
+	a := connPool{&nilStyleConn{reply: []byte("v")}}
+	proxy := getMockProxy(a, connPool{&nilStyleConn{}}, connPool{&nilStyleConn{err: errors.New("ERR failed")}})
+	proxy.Servers = []string{"a:6379:1", "b:6379:1", "c:6379:1"}
+
+	// A discovery that no instance accepts completes every probe.
+	none := func(interface{}) bool { return false }
+	if _, err := proxy.Do(NewRedisCmd("GET", "missing"), none); err != ErrNoMapping {
+		t.Fatalf("Expected ErrNoMapping, got %v", err)
+	}
+
+	proxy.KeyInstance["mapped"] = a
+	if _, err := proxy.Do(NewRedisCmd("GET", "mapped"), KeyFound); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Probes of the other instances may be interrupted once the first accepts.
+	if _, err := proxy.Do(NewRedisCmd("GET", "key"), KeyFound); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	s := proxy.Stats()
+	if len(s.Instances) != 3 || s.Mapping.Hits != 1 || s.Mapping.Misses != 2 {
+		t.Fatalf("Unexpected stats: %+v", s)
+	}
+
+	got := s.Instances[0]
+	got.MeanLatency = 0
+	if e := (InstanceStats{Server: "a:6379", Commands: 3, Probes: 2, MappingHits: 1, Discoveries: 1}); got != e {
+		t.Fatalf("Expected %+v, got %+v", e, got)
+	}
+	if b := s.Instances[1]; b.Server != "b:6379" || b.Probes < 1 || b.Errors != 0 || b.Discoveries != 0 {
+		t.Fatalf("Unexpected stats: %+v", b)
+	}
+	if c := s.Instances[2]; c.Server != "c:6379" || c.Errors < 1 || c.Errors != c.Commands {
+		t.Fatalf("Unexpected stats: %+v", c)
+	}
+}
@@ -0,0 +1,368 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"github.com/txodds/twunproxy/reply"
+	"sort"
+	"strings"
+	"time"
+)
+
+/******************************************************
+ * Stream reads, which may block, across the instances that may hold the streams.
+ * As for BLPopKeys, the read is split into one per instance holding any of the streams.
+ ******************************************************/
+
+// BlockForever makes stream reads block until entries arrive or the context ends.
+const BlockForever time.Duration = -1
+
+// Returned for replies to XREAD and XREADGROUP that cannot be decoded.
+var errStreamReply = errors.New("Unexpected reply for stream entries.")
+
+// StreamRead configures XRead and XReadGroup.
+// Count caps the entries returned for each stream; zero leaves no cap.
+// Block is how long to wait for entries when there are none. Zero does not wait and BlockForever waits until
+// entries arrive, re-issuing the read so that it remains cancellable.
+// NoAck and CreateGroup only apply to XReadGroup. NoAck reads without adding entries to the pending list.
+// CreateGroup creates the consumer group, from the end of the stream, on an instance that reports it missing.
+type StreamRead struct {
+	Count       int64
+	Block       time.Duration
+	NoAck       bool
+	CreateGroup bool
+}
+
+// StreamEntry is an entry of a stream, with its field-value pairs in order.
+// Values is empty for entries pending in a consumer group that have since been deleted.
+type StreamEntry struct {
+	ID     string   `json:"id"`
+	Values []string `json:"values"`
+}
+
+// StreamMessages are the entries read from one stream, with the server of the instance holding it.
+type StreamMessages struct {
+	Key     string        `json:"key"`
+	Server  string        `json:"server"`
+	Entries []StreamEntry `json:"entries"`
+}
+
+// The reply from one instance to a stream read.
+type streamReturn struct {
+	msgs []StreamMessages
+	err  error
+}
+
+// XRead reads entries after the input IDs from each stream, keyed by stream.
+// Mapped streams are read from their instance. Others are read from their ring owner with hash routing,
+// or else from every instance, and are mapped to the instance that returns entries for them.
+// Without blocking, the entries from every instance are returned. When blocking, the entries from the first
+// instance to return any are. No entries and no error are returned if the block passed without any.
+func (r *ProxyConn) XRead(opts StreamRead, streams map[string]string) ([]StreamMessages, error) {
+	return r.XReadContext(context.Background(), opts, streams)
+}
+
+// XReadContext reads as for XRead, but returns the context error if the context ends first.
+// The block sent to the server is clamped to the context deadline.
+func (r *ProxyConn) XReadContext(ctx context.Context, opts StreamRead, streams map[string]string) ([]StreamMessages, error) {
+	if len(streams) == 0 {
+		return nil, errNoKeys
+	}
+
+	t := r.topology()
+	if len(t.pools) == 0 {
+		return nil, errNoPools
+	}
+
+	return r.readStreams(ctx, t, r.groupKeys(t, streamNames(streams)), "", "", opts, streams)
+}
+
+// XReadGroup reads entries from each stream, keyed by stream, for the consumer of the consumer group.
+// The ID ">" reads entries never delivered to the group. Since the group is held by the instance holding its stream,
+// each stream is read from the instance it is mapped to or found on with EXISTS, or else from its ring owner.
+// Streams on several instances are read from each concurrently. When blocking, the entries of the first instance
+// to return any are returned. Entries delivered meanwhile by the others remain pending for the consumer,
+// and can be read again with the ID "0".
+func (r *ProxyConn) XReadGroup(group, consumer string, opts StreamRead, streams map[string]string) ([]StreamMessages, error) {
+	return r.XReadGroupContext(context.Background(), group, consumer, opts, streams)
+}
+
+// XReadGroupContext reads as for XReadGroup, but returns the context error if the context ends first.
+func (r *ProxyConn) XReadGroupContext(
+	ctx context.Context,
+	group, consumer string,
+	opts StreamRead,
+	streams map[string]string) ([]StreamMessages, error) {
+
+	if len(streams) == 0 {
+		return nil, errNoKeys
+	}
+
+	var res []StreamMessages
+	err := r.retrying(ctx, "XREADGROUP", streamNames(streams)[0], func() (err error) {
+		res, err = r.xReadGroup(ctx, group, consumer, opts, streams)
+		return err
+	})
+	return res, err
+}
+
+// Places the input streams and reads them once, as for XReadGroupContext.
+func (r *ProxyConn) xReadGroup(
+	ctx context.Context,
+	group, consumer string,
+	opts StreamRead,
+	streams map[string]string) ([]StreamMessages, error) {
+
+	t := r.topology()
+	if len(t.pools) == 0 {
+		return nil, errNoPools
+	}
+
+	groups := make(map[int][]string)
+	for _, k := range streamNames(streams) {
+		pool, ok, err := r.place(k)
+		if err != nil {
+			return nil, err
+		}
+		i := t.indexOf(pool)
+		if !ok || i < 0 {
+			return nil, errNoPlacement
+		}
+		groups[i] = append(groups[i], k)
+	}
+
+	return r.readStreams(ctx, t, groups, group, consumer, opts, streams)
+}
+
+// XGroupCreate creates the consumer group on the stream at key, starting after the input ID, on the instance
+// holding the stream. "$" starts at the end of the stream and "0" at its start.
+// A stream that does not exist is created empty on its ring owner. An existing group is left as it is.
+func (r *ProxyConn) XGroupCreate(key, group, start string) error {
+	cmd := &RedisCmd{name: "XGROUP", key: key, args: []interface{}{"CREATE", group, start, "MKSTREAM"}, keyPos: 1}
+	if _, err := r.doKeyed(cmd, true); err != nil && !isBusyGroup(err) {
+		return err
+	}
+	return nil
+}
+
+// Issues the stream read to each instance for its streams, re-issuing it while it should block forever.
+// The read is XREADGROUP for the consumer of the input group, or XREAD if the group is empty.
+func (r *ProxyConn) readStreams(
+	ctx context.Context,
+	t *topology,
+	groups map[int][]string,
+	group, consumer string,
+	opts StreamRead,
+	streams map[string]string) ([]StreamMessages, error) {
+
+	if opts.Block >= 0 {
+		return r.readStreamsOnce(ctx, t, groups, group, consumer, opts, streams)
+	}
+
+	once := opts
+	once.Block = blockForeverSlice
+	for {
+		msgs, err := r.readStreamsOnce(ctx, t, groups, group, consumer, once, streams)
+		if len(msgs) > 0 || err != nil {
+			return msgs, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Issues the stream read to each instance for its streams concurrently, and gathers the entries returned.
+// The streams returning entries are mapped to their instance.
+func (r *ProxyConn) readStreamsOnce(
+	ctx context.Context,
+	t *topology,
+	groups map[int][]string,
+	group, consumer string,
+	opts StreamRead,
+	streams map[string]string) ([]StreamMessages, error) {
+
+	name := "XREAD"
+	var args []interface{}
+	if group != "" {
+		name = "XREADGROUP"
+		args = append(args, "GROUP", group, consumer)
+	}
+	if opts.Count > 0 {
+		args = append(args, "COUNT", opts.Count)
+	}
+	if opts.Block > 0 {
+		block, err := streamBlock(ctx, opts.Block)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "BLOCK", block)
+	}
+	if opts.NoAck && group != "" {
+		args = append(args, "NOACK")
+	}
+
+	results := make(chan streamReturn, len(groups))
+	for i, ks := range groups {
+		go func(i int, ks []string) {
+			cmdArgs := append(append([]interface{}{}, args...), "STREAMS")
+			for _, k := range ks {
+				cmdArgs = append(cmdArgs, k)
+			}
+			for _, k := range ks {
+				cmdArgs = append(cmdArgs, streams[k])
+			}
+
+			c := t.pools[i].Get()
+			defer c.Close()
+
+			v, err := r.runContext(ctx, c, NewCommand(name, cmdArgs...))
+			if err != nil && opts.CreateGroup && group != "" && isNoGroup(err) {
+				if err = r.createGroups(ctx, c, group, ks); err == nil {
+					v, err = r.runContext(ctx, c, NewCommand(name, cmdArgs...))
+				}
+			}
+
+			res := streamReturn{err: err}
+			if err == nil {
+				res.msgs, res.err = streamsReply(v)
+			}
+			for j := range res.msgs {
+				res.msgs[j].Server = t.server(i)
+				r.mapKey(res.msgs[j].Key, t.pools[i])
+			}
+			results <- res
+		}(i, ks)
+	}
+
+	var msgs []StreamMessages
+	var first error
+	for n := 0; n < len(groups); n++ {
+		res := <-results
+		if first == nil {
+			first = res.err
+		}
+		msgs = append(msgs, res.msgs...)
+		if len(msgs) > 0 && opts.Block > 0 {
+			break
+		}
+	}
+
+	if len(msgs) == 0 || opts.Block == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if first != nil {
+			return msgs, first
+		}
+	}
+
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].Key < msgs[j].Key })
+	return msgs, nil
+}
+
+// Creates the consumer group from the end of each stream on the input connection, creating missing streams.
+func (r *ProxyConn) createGroups(ctx context.Context, c Conn, group string, keys []string) error {
+	for _, k := range keys {
+		_, err := r.runContext(ctx, c, NewCommand("XGROUP", "CREATE", k, group, "$", "MKSTREAM"))
+		if err != nil && !isBusyGroup(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the BLOCK argument in milliseconds for the input wait, clamped to the context deadline.
+// The context error is returned if the deadline has passed.
+func streamBlock(ctx context.Context, d time.Duration) (int64, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, context.DeadlineExceeded
+		}
+		if remaining < d {
+			d = remaining
+		}
+	}
+
+	// A BLOCK of zero blocks indefinitely.
+	if ms := d.Milliseconds(); ms > 0 {
+		return ms, nil
+	}
+	return 1, nil
+}
+
+// Returns the streams of the input map in order, so that commands are issued deterministically.
+func streamNames(streams map[string]string) []string {
+	keys := make([]string, 0, len(streams))
+	for k := range streams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Decodes the reply to XREAD or XREADGROUP. A nil reply, for a read that found no entries, decodes to none.
+func streamsReply(v interface{}) ([]StreamMessages, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	streams, ok := v.([]interface{})
+	if !ok {
+		return nil, errStreamReply
+	}
+
+	msgs := make([]StreamMessages, 0, len(streams))
+	for _, s := range streams {
+		pair, ok := s.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, errStreamReply
+		}
+		key, ok := replyString(pair[0])
+		if !ok {
+			return nil, errStreamReply
+		}
+		entries, ok := pair[1].([]interface{})
+		if !ok {
+			return nil, errStreamReply
+		}
+
+		m := StreamMessages{Key: key, Entries: make([]StreamEntry, 0, len(entries))}
+		for _, e := range entries {
+			entry, ok := e.([]interface{})
+			if !ok || len(entry) != 2 {
+				return nil, errStreamReply
+			}
+			id, ok := replyString(entry[0])
+			if !ok {
+				return nil, errStreamReply
+			}
+
+			var values []string
+			if entry[1] != nil {
+				var err error
+				if values, err = reply.Strings(entry[1], nil); err != nil {
+					return nil, errStreamReply
+				}
+			}
+			m.Entries = append(m.Entries, StreamEntry{ID: id, Values: values})
+		}
+
+		// Streams with no entries are omitted by Redis, except when reading pending entries.
+		if len(m.Entries) > 0 {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs, nil
+}
+
+// Reports whether the error is a reply that the consumer group, or its stream, does not exist.
+func isNoGroup(err error) bool {
+	return strings.HasPrefix(err.Error(), "NOGROUP")
+}
+
+// Reports whether the error is a reply that the consumer group already exists.
+func isBusyGroup(err error) bool {
+	return strings.HasPrefix(err.Error(), "BUSYGROUP")
+}
@@ -0,0 +1,76 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestXReadBlocksOnEveryInstanceAndMapsStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn1.EXPECT().Do("XREAD", "COUNT", int64(10), "BLOCK", int64(1000), "STREAMS", "events", "0").Return(nil, nil).MaxTimes(1)
+	mockConn1.EXPECT().Close().MaxTimes(1)
+	mockConn2.EXPECT().Do("XREAD", "COUNT", int64(10), "BLOCK", int64(1000), "STREAMS", "events", "0").Return([]interface{}{
+		[]interface{}{[]byte("events"), []interface{}{
+			[]interface{}{[]byte("1-0"), []interface{}{[]byte("f"), []byte("v")}},
+		}},
+	}, nil)
+	mockConn2.EXPECT().Close()
+
+	// The read returns as soon as the second instance returns entries.
+	proxy := getMockProxy(mockPool1, mockPool2)
+	msgs, err := proxy.XRead(StreamRead{Count: 10, Block: time.Second}, map[string]string{"events": "0"})
+	if err != nil || len(msgs) != 1 || msgs[0].Server != "1" || len(msgs[0].Entries) != 1 {
+		t.Fatalf("Unexpected result: %v, %v", msgs, err)
+	}
+	if e := msgs[0].Entries[0]; e.ID != "1-0" || len(e.Values) != 2 || e.Values[1] != "v" {
+		t.Fatalf("Unexpected entry: %v", e)
+	}
+	if proxy.KeyInstance["events"] != mockPool2 {
+		t.Fatal("Expected the stream to be mapped to the instance returning entries.")
+	}
+}
+
+func TestXReadGroupCreatesMissingGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	read := mockConn.EXPECT().Do("XREADGROUP", "GROUP", "workers", "w1", "NOACK", "STREAMS", "events", ">")
+	gomock.InOrder(
+		read.Return(nil, errors.New("NOGROUP No such key 'events' or consumer group 'workers'")),
+		mockConn.EXPECT().Do("XGROUP", "CREATE", "events", "workers", "$", "MKSTREAM").Return([]byte("OK"), nil),
+		mockConn.EXPECT().Do("XREADGROUP", "GROUP", "workers", "w1", "NOACK", "STREAMS", "events", ">").Return(nil, nil),
+	)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["events"] = mockPool
+
+	opts := StreamRead{NoAck: true, CreateGroup: true}
+	if msgs, err := proxy.XReadGroup("workers", "w1", opts, map[string]string{"events": ">"}); err != nil || len(msgs) != 0 {
+		t.Fatalf("Unexpected result: %v, %v", msgs, err)
+	}
+}
+
+func TestXGroupCreateIgnoresExistingGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("XGROUP", "CREATE", "events", "workers", "0", "MKSTREAM").
+		Return(nil, errors.New("BUSYGROUP Consumer Group name already exists"))
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["events"] = mockPool
+
+	if err := proxy.XGroupCreate("events", "workers", "0"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
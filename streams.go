@@ -0,0 +1,107 @@
+package twunproxy
+
+import (
+	"errors"
+)
+
+/******************************************************
+ * Stream commands, routed to the instance holding the stream.
+ ******************************************************/
+
+// StreamTrim configures the trimming applied by XAdd. Set one of MaxLen or MinID.
+// Approximate trimming ("~") lets Redis trim in whole macro nodes, which is far cheaper and usually preferable.
+// Limit caps the number of entries evicted by an approximate trim; 0 leaves the Redis default.
+type StreamTrim struct {
+	MaxLen      int64
+	MinID       string
+	Approximate bool
+	Limit       int64
+}
+
+// Returns the XADD or XTRIM arguments for the trim strategy.
+func (st *StreamTrim) args() ([]interface{}, error) {
+	var args []interface{}
+	switch {
+	case st.MinID != "" && st.MaxLen > 0:
+		return nil, errors.New("Only one of MaxLen and MinID may be set.")
+	case st.MinID != "":
+		args = append(args, "MINID")
+	case st.MaxLen > 0:
+		args = append(args, "MAXLEN")
+	default:
+		return nil, errors.New("One of MaxLen and MinID must be set.")
+	}
+
+	if st.Approximate {
+		args = append(args, "~")
+	}
+
+	if st.MinID != "" {
+		args = append(args, st.MinID)
+	} else {
+		args = append(args, st.MaxLen)
+	}
+
+	if st.Limit > 0 {
+		if !st.Approximate {
+			return nil, errors.New("Limit requires approximate trimming.")
+		}
+		args = append(args, "LIMIT", st.Limit)
+	}
+	return args, nil
+}
+
+// XAdd appends an entry with the input field-value pairs to the stream at key, on the instance holding it.
+// An empty ID lets Redis generate one. If trim is not nil, the stream is trimmed in the same command.
+// The ID of the added entry is returned.
+// NOTE: MINID and LIMIT require Redis 6.2 or later.
+func (r *ProxyConn) XAdd(key, id string, trim *StreamTrim, fieldValues ...interface{}) (string, error) {
+	if len(fieldValues) == 0 || len(fieldValues)%2 != 0 {
+		return "", errors.New("XAdd requires field-value pairs.")
+	}
+
+	var args []interface{}
+	if trim != nil {
+		t, err := trim.args()
+		if err != nil {
+			return "", err
+		}
+		args = append(args, t...)
+	}
+
+	if id == "" {
+		id = "*"
+	}
+	args = append(args, id)
+	args = append(args, fieldValues...)
+
+	v, err := r.doKeyed(&RedisCmd{name: "XADD", key: key, args: args}, true)
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := replyString(v)
+	if !ok {
+		return "", errors.New("Unexpected reply to XADD.")
+	}
+	return s, nil
+}
+
+// XTrim trims the stream at key on the instance holding it, returning the number of entries removed.
+func (r *ProxyConn) XTrim(key string, trim StreamTrim) (int64, error) {
+	args, err := trim.args()
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := r.doKeyed(&RedisCmd{name: "XTRIM", key: key, args: args}, true)
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := replyInt(v)
+	if !ok {
+		return 0, errors.New("Unexpected reply to XTRIM.")
+	}
+	return n, nil
+}
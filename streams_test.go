@@ -0,0 +1,48 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestXAddWithApproximateMaxLen(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("XADD", "events", "MAXLEN", "~", int64(1000), "LIMIT", int64(100), "*", "f", "v").
+		Return([]byte("1-0"), nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["events"] = mockPool
+
+	id, err := proxy.XAdd("events", "", &StreamTrim{MaxLen: 1000, Approximate: true, Limit: 100}, "f", "v")
+	if err != nil || id != "1-0" {
+		t.Fatalf("Unexpected result: %s, %v", id, err)
+	}
+}
+
+func TestXTrimByMinID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("XTRIM", "events", "MINID", "5-0").Return(int64(4), nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["events"] = mockPool
+
+	if n, err := proxy.XTrim("events", StreamTrim{MinID: "5-0"}); err != nil || n != 4 {
+		t.Fatalf("Unexpected result: %d, %v", n, err)
+	}
+}
+
+func TestStreamTrimValidation(t *testing.T) {
+	for _, st := range []StreamTrim{{}, {MaxLen: 1, MinID: "1-0"}, {MaxLen: 1, Limit: 10}} {
+		if _, err := st.args(); err == nil {
+			t.Errorf("Expected error for %+v", st)
+		}
+	}
+}
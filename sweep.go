@@ -0,0 +1,108 @@
+package twunproxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reasons that SweepQueues removes a queue key.
+const (
+	SweepEmpty = "empty"
+	SweepIdle  = "idle"
+)
+
+// SweptKey describes a queue key removed by SweepQueues.
+// Type is the Redis type of the key, either "list" or "stream". Reason is SweepEmpty or SweepIdle.
+type SweptKey struct {
+	Key    string `json:"key"`
+	Server string `json:"server"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// SweepQueues scans every instance concurrently for list and stream keys matching the input pattern,
+// and deletes those that are empty or, if maxIdle is positive, have not been accessed for at least maxIdle.
+// Each key is deleted on the instance that holds it and any mapping for it is removed.
+// The swept keys are returned ordered by key and server. If dryRun is set, nothing is deleted.
+// Queue-heavy workloads that create many short-lived keys can run this periodically to keep instances tidy.
+// NOTE: A key written to between its inspection and deletion is still deleted.
+func (r *ProxyConn) SweepQueues(pattern string, maxIdle time.Duration, dryRun bool) ([]SweptKey, error) {
+	t := r.topology()
+
+	var mu sync.Mutex
+	var swept []SweptKey
+	errs := t.forEach(func(i int, c Conn) error {
+		return scanKeys(c, pattern, scanCount, func(keys []string) error {
+			for _, k := range keys {
+				s, err := sweepReason(c, k, maxIdle)
+				if err != nil {
+					return err
+				}
+				if s.Reason == "" {
+					continue
+				}
+
+				if !dryRun {
+					if _, err := c.Do("DEL", k); err != nil {
+						return err
+					}
+					r.unmap(k)
+				}
+
+				s.Key, s.Server = k, t.server(i)
+				mu.Lock()
+				swept = append(swept, s)
+				mu.Unlock()
+			}
+			return nil
+		})
+	})
+
+	sort.Slice(swept, func(a, b int) bool {
+		if swept[a].Key != swept[b].Key {
+			return swept[a].Key < swept[b].Key
+		}
+		return swept[a].Server < swept[b].Server
+	})
+	return swept, firstError(errs)
+}
+
+// Inspects the input key and returns its type with the reason it should be swept, if any.
+func sweepReason(c Conn, key string, maxIdle time.Duration) (SweptKey, error) {
+	v, err := c.Do("TYPE", key)
+	if err != nil {
+		return SweptKey{}, err
+	}
+
+	s := SweptKey{}
+	s.Type, _ = replyString(v)
+
+	var lenCmd string
+	switch s.Type {
+	case "list":
+		lenCmd = "LLEN"
+	case "stream":
+		lenCmd = "XLEN"
+	default:
+		return s, nil
+	}
+
+	if v, err = c.Do(lenCmd, key); err != nil {
+		return s, err
+	}
+	if n, ok := replyInt(v); ok && n == 0 {
+		s.Reason = SweepEmpty
+		return s, nil
+	}
+
+	if maxIdle > 0 {
+		if v, err = c.Do("OBJECT", "IDLETIME", key); err != nil {
+			return s, err
+		}
+		if n, ok := replyInt(v); ok && time.Duration(n)*time.Second >= maxIdle {
+			s.Reason = SweepIdle
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,68 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestSweepQueuesDeletesEmptyAndIdleQueues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["q:idle"] = mockPool
+
+	keys := []interface{}{[]byte("q:empty"), []byte("q:idle"), []byte("q:busy"), []byte("q:str")}
+	mockConn.EXPECT().Do("SCAN", "0", "MATCH", "q:*", "COUNT", scanCount).Return([]interface{}{[]byte("0"), keys}, nil)
+
+	mockConn.EXPECT().Do("TYPE", "q:empty").Return("stream", nil)
+	mockConn.EXPECT().Do("XLEN", "q:empty").Return(int64(0), nil)
+	mockConn.EXPECT().Do("DEL", "q:empty").Return(int64(1), nil)
+
+	mockConn.EXPECT().Do("TYPE", "q:idle").Return("list", nil)
+	mockConn.EXPECT().Do("LLEN", "q:idle").Return(int64(3), nil)
+	mockConn.EXPECT().Do("OBJECT", "IDLETIME", "q:idle").Return(int64(7200), nil)
+	mockConn.EXPECT().Do("DEL", "q:idle").Return(int64(1), nil)
+
+	mockConn.EXPECT().Do("TYPE", "q:busy").Return("list", nil)
+	mockConn.EXPECT().Do("LLEN", "q:busy").Return(int64(3), nil)
+	mockConn.EXPECT().Do("OBJECT", "IDLETIME", "q:busy").Return(int64(10), nil)
+
+	mockConn.EXPECT().Do("TYPE", "q:str").Return("string", nil)
+	mockConn.EXPECT().Close()
+
+	swept, err := proxy.SweepQueues("q:*", time.Hour, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(swept) != 2 || swept[0].Key != "q:empty" || swept[0].Reason != SweepEmpty ||
+		swept[1].Key != "q:idle" || swept[1].Reason != SweepIdle || swept[1].Type != "list" {
+		t.Fatalf("Unexpected result: %+v", swept)
+	}
+
+	if _, ok := proxy.KeyInstance["q:idle"]; ok {
+		t.Fatal("Expected swept key to be unmapped.")
+	}
+}
+
+func TestSweepQueuesDryRunDeletesNothing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+
+	keys := []interface{}{[]byte("q:empty")}
+	mockConn.EXPECT().Do("SCAN", "0", "MATCH", "q:*", "COUNT", scanCount).Return([]interface{}{[]byte("0"), keys}, nil)
+	mockConn.EXPECT().Do("TYPE", "q:empty").Return("stream", nil)
+	mockConn.EXPECT().Do("XLEN", "q:empty").Return(int64(0), nil)
+	mockConn.EXPECT().Close()
+
+	swept, err := proxy.SweepQueues("q:*", 0, true)
+	if err != nil || len(swept) != 1 {
+		t.Fatalf("Unexpected result: %+v, %v", swept, err)
+	}
+}
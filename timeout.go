@@ -0,0 +1,106 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// TimeoutConn is implemented by connections that can apply a read timeout to a single command,
+// such as those from redigo. Command timeouts are only enforced on connections implementing it.
+type TimeoutConn interface {
+	Conn
+	DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (reply interface{}, err error)
+}
+
+// AbortableConn is implemented by connections that can interrupt a command in progress from another goroutine,
+// such as by closing their network connection or setting its deadline in the past. The command then returns an error
+// and the connection is not reused. Discovery probes that lose, and commands whose context ends, are aborted on
+// connections implementing it, rather than holding the connection until the instance replies.
+type AbortableConn interface {
+	Conn
+	Abort() error
+}
+
+// Returned by wrapping connections whose underlying connection cannot abort commands.
+var errNotAbortable = errors.New("Connection cannot abort commands.")
+
+// WithCommandTimeout sets the default read timeout for every command with the input name.
+// A slow O(N) command on one instance then cannot hold a discovery fan-out beyond its budget.
+// Timeouts set on an individual command with RedisCmd.WithTimeout take precedence.
+func WithCommandTimeout(name string, d time.Duration) Option {
+	return func(r *ProxyConn) {
+		if r.timeouts == nil {
+			r.timeouts = make(map[string]time.Duration)
+		}
+		r.timeouts[strings.ToUpper(name)] = d
+	}
+}
+
+// WithTimeout sets the read timeout for this command, overriding any default for the command name.
+func (c *RedisCmd) WithTimeout(d time.Duration) *RedisCmd {
+	c.timeout = d
+	return c
+}
+
+// Runs the input command on the connection, applying its read timeout if it has one and the connection supports it.
+// Nil replies are normalised, so that every client library presents them the same way to canMap predicates.
+// Replies larger than the maximum reply size for the command are replaced with a ReplySizeError.
+func (r *ProxyConn) run(conn Conn, cmd *RedisCmd) (interface{}, error) {
+	d := cmd.timeout
+	if d == 0 {
+		d = r.timeouts[strings.ToUpper(cmd.name)]
+	}
+
+	var v interface{}
+	var err error
+	if tc, ok := conn.(TimeoutConn); ok && d > 0 {
+		v, err = tc.DoWithTimeout(d, cmd.name, cmd.getArgs()...)
+	} else if ac, ok := conn.(AbortableConn); ok && d > 0 {
+		timer := time.AfterFunc(d, func() { r.abort(ac) })
+		v, err = conn.Do(cmd.name, cmd.getArgs()...)
+		timer.Stop()
+	} else {
+		v, err = conn.Do(cmd.name, cmd.getArgs()...)
+	}
+
+	if err == nil {
+		if err = r.guardReplySize(cmd, v); err != nil {
+			return nil, err
+		}
+	}
+	return r.normalizeReply(conn, v, err)
+}
+
+// Runs the input command as for run, but returns the context error if the context ends before the reply arrives.
+func (r *ProxyConn) runContext(ctx context.Context, conn Conn, cmd *RedisCmd) (interface{}, error) {
+	if ctx.Done() == nil {
+		return r.run(conn, cmd)
+	}
+
+	done := make(chan redisReturn, 1)
+	go func() {
+		v, err := r.run(conn, cmd)
+		done <- redisReturn{val: v, err: err}
+	}()
+
+	select {
+	case rr := <-done:
+		return rr.val, rr.err
+	case <-ctx.Done():
+		r.abort(conn)
+		return nil, ctx.Err()
+	}
+}
+
+// Interrupts the command in progress on the input connection, if the connection supports it.
+// Returns whether the command was aborted.
+func (r *ProxyConn) abort(conn Conn) bool {
+	ac, ok := conn.(AbortableConn)
+	if !ok || ac.Abort() != nil {
+		return false
+	}
+	r.counter("aborted_commands", "", 1)
+	return true
+}
@@ -0,0 +1,118 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"net"
+	"testing"
+	"time"
+)
+
+// A connection supporting per-command timeouts that records the timeout it was given.
+type timeoutConn struct {
+	*MockConn
+	timeout time.Duration
+}
+
+func (c *timeoutConn) DoWithTimeout(d time.Duration, name string, args ...interface{}) (interface{}, error) {
+	c.timeout = d
+	return c.Do(name, args...)
+}
+
+func TestCommandTimeoutsAppliedByNameAndPerCall(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := NewMockConn(ctrl)
+	conn := &timeoutConn{MockConn: mockConn}
+	mockConn.EXPECT().Do("KEYS", "*").Return([]interface{}{}, nil).Times(2)
+
+	proxy := getMockProxy()
+	WithCommandTimeout("keys", time.Second)(proxy)
+
+	proxy.run(conn, NewRedisCmd("KEYS", "*"))
+	if conn.timeout != time.Second {
+		t.Fatalf("Expected default timeout, got %v", conn.timeout)
+	}
+
+	proxy.run(conn, NewRedisCmd("KEYS", "*").WithTimeout(time.Millisecond))
+	if conn.timeout != time.Millisecond {
+		t.Fatalf("Expected per-call timeout, got %v", conn.timeout)
+	}
+}
+
+// A connection whose commands block until they are aborted, or answer at once if reply is set.
+type blockingConn struct {
+	reply   interface{}
+	aborted chan bool
+}
+
+func newBlockingConn(reply interface{}) *blockingConn {
+	return &blockingConn{reply: reply, aborted: make(chan bool)}
+}
+
+func (c *blockingConn) Do(string, ...interface{}) (interface{}, error) {
+	if c.reply != nil {
+		return c.reply, nil
+	}
+	<-c.aborted
+	return nil, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("use of closed network connection")}
+}
+
+func (c *blockingConn) Abort() error {
+	close(c.aborted)
+	return nil
+}
+
+func (c *blockingConn) Close() error { return nil }
+
+func TestLosingProbesAreAborted(t *testing.T) {
+	losing := newBlockingConn(nil)
+	proxy := getMockProxy(connPool{losing}, connPool{newBlockingConn([]interface{}{"KEY", "VALUE"})})
+	WithAutoEject(EjectionPolicy{FailureLimit: 1})(proxy)
+
+	canMap := func(v interface{}) bool { return v != nil }
+	if _, err := proxy.Do(NewRedisCmd("BLPOP", "KEY", 0), canMap); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case <-losing.aborted:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the losing probe to be aborted.")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if len(proxy.liveIndexes(proxy.topology())) != 2 {
+		t.Fatal("Expected an aborted probe not to count as a failure of its instance.")
+	}
+}
+
+func TestContextEndAbortsCommand(t *testing.T) {
+	conn := newBlockingConn(nil)
+	pool := connPool{conn}
+	proxy := getMockProxy(pool)
+	proxy.mapKey("KEY", pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := proxy.DoContext(ctx, NewRedisCmd("BLPOP", "KEY", 0), nil); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the context error, got %v", err)
+	}
+
+	select {
+	case <-conn.aborted:
+	default:
+		t.Fatal("Expected the command to be aborted.")
+	}
+}
+
+func TestCommandTimeoutAbortsConnectionsWithoutReadTimeouts(t *testing.T) {
+	conn := newBlockingConn(nil)
+	proxy := getMockProxy()
+
+	if _, err := proxy.run(conn, NewRedisCmd("BLPOP", "KEY", 0).WithTimeout(10*time.Millisecond)); !isUnavailable(err) {
+		t.Fatalf("Expected the aborted command to fail, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package twunproxy
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Topology is a consistent view of the pools and their server descriptors at a point in time.
+// The proxy topology may be replaced wholesale by Reload, so operations spanning several steps work from one view.
+// Ring is nil if keys cannot be placed deterministically for the pool configuration.
+// HashTag holds the two hash_tag delimiters from the pool configuration, if set.
+type topology struct {
+	pools   []ConnGetter
+	servers []string
+	ring    *hashRing
+	hashTag string
+}
+
+// Returns the current topology of the proxy.
+func (r *ProxyConn) topology() *topology {
+	r.topologyMutex.RLock()
+	defer r.topologyMutex.RUnlock()
+	return &topology{pools: r.Pools, servers: r.Servers, ring: r.ring, hashTag: r.hashTag}
+}
+
+// Replaces the pools, server descriptors, hash ring and hash tag of the proxy.
+func (r *ProxyConn) setTopology(t *topology) {
+	r.topologyMutex.Lock()
+	defer r.topologyMutex.Unlock()
+	r.Pools = t.pools
+	r.Servers = t.servers
+	r.ring = t.ring
+	r.hashTag = t.hashTag
+}
+
+// Server returns the address of the instance behind the pool at the input index.
+// Twemproxy server descriptors take the form "host:port:weight name"; only "host:port" is returned.
+// If no descriptor is known for the pool, its index is returned instead.
+func (t *topology) server(i int) string {
+	if i >= len(t.servers) {
+		return strconv.Itoa(i)
+	}
+	return ServerAddr(t.servers[i])
+}
+
+// Returns the index of the pool for the instance with the input address.
+func (t *topology) index(server string) (int, error) {
+	for i := range t.pools {
+		if t.server(i) == server {
+			return i, nil
+		}
+	}
+	return -1, errors.New("No pool configured for server " + server + ".")
+}
+
+// Returns the index of the input pool, or -1 if it is not one of ours.
+func (t *topology) indexOf(pool ConnGetter) int {
+	for i, p := range t.pools {
+		if p == pool {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the address of the instance behind the input pool, or an empty string if it is not one of ours.
+func (t *topology) serverOf(pool ConnGetter) string {
+	if i := t.indexOf(pool); i >= 0 {
+		return t.server(i)
+	}
+	return ""
+}
+
+// Runs the input function concurrently against a connection from each pool and waits for all of them to complete.
+// The returned slice holds the error from each invocation, indexed in the same order as the pools.
+func (t *topology) forEach(fn func(int, Conn) error) []error {
+	errs := make([]error, len(t.pools))
+	wg := new(sync.WaitGroup)
+
+	for i, pool := range t.pools {
+		wg.Add(1)
+		go func(i int, pool ConnGetter) {
+			defer wg.Done()
+			c := pool.Get()
+			defer c.Close()
+			errs[i] = fn(i, c)
+		}(i, pool)
+	}
+
+	wg.Wait()
+	return errs
+}
+
+// ServerAddr returns the address of a Twemproxy server descriptor, stripping its weight and name.
+// This is "host:port", or the socket path for Unix socket descriptors.
+func ServerAddr(desc string) string {
+	addr, _, _ := parseServer(desc)
+	return addr
+}
+
+// ServerNetwork returns the network to dial for a Twemproxy server descriptor: "unix" for Unix socket descriptors,
+// whose paths Twemproxy requires to be absolute, and otherwise "tcp".
+func ServerNetwork(desc string) string {
+	if strings.HasPrefix(ServerAddr(desc), "/") {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// ParseServer splits a Twemproxy server descriptor of the form "host:port:weight name" into its parts.
+// Unix socket descriptors take the form "/path/to/socket:weight name".
+// If no name is given, the name Twemproxy uses for placing keys is returned: "host:port", or just the host
+// for the memcached default port of 11211. If no weight is given, it is 1.
+func parseServer(desc string) (addr, name string, weight int) {
+	f := strings.Fields(desc)
+	if len(f) == 0 {
+		return desc, desc, 1
+	}
+
+	// A trailing number is only a weight if what precedes it is a socket path or a host and port,
+	// so that the port of "host:port" is kept.
+	addr, weight = f[0], 1
+	if i := strings.LastIndex(addr, ":"); i > 0 {
+		_, _, err := net.SplitHostPort(addr[:i])
+		if w, werr := strconv.Atoi(addr[i+1:]); werr == nil && (err == nil || strings.HasPrefix(addr, "/")) {
+			addr, weight = addr[:i], w
+		}
+	}
+
+	switch {
+	case len(f) > 1:
+		name = f[1]
+	case strings.HasSuffix(addr, ":11211"):
+		name = strings.TrimSuffix(addr, ":11211")
+	default:
+		name = addr
+	}
+	return addr, name, weight
+}
@@ -0,0 +1,106 @@
+package twunproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TraceEntry records a single command issued through the proxy.
+// Discovery is true when the instance was located by fanning out to every pool rather than from a known mapping.
+// Server is empty if discovery failed to locate an instance.
+type TraceEntry struct {
+	Time      time.Time     `json:"time"`
+	Name      string        `json:"name"`
+	Key       string        `json:"key"`
+	Server    string        `json:"server"`
+	Duration  time.Duration `json:"duration_ns"`
+	Discovery bool          `json:"discovery"`
+	Err       error         `json:"-"`
+}
+
+// Tracer is a fixed-size, in-memory ring buffer of the most recent commands issued through a proxy.
+// It answers "what was the proxy doing just before the incident" without the cost of full logging.
+// Tracer implements http.Handler, serving its entries as JSON, so it can be mounted on an admin endpoint.
+type Tracer struct {
+	mu      sync.Mutex
+	entries []TraceEntry
+	next    int
+	full    bool
+}
+
+// NewTracer creates a tracer retaining the input number of most recent commands.
+func NewTracer(size int) *Tracer {
+	return &Tracer{entries: make([]TraceEntry, size)}
+}
+
+// Entries returns the retained commands, oldest first.
+func (t *Tracer) Entries() []TraceEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.full {
+		return append([]TraceEntry(nil), t.entries[:t.next]...)
+	}
+	return append(append([]TraceEntry(nil), t.entries[t.next:]...), t.entries[:t.next]...)
+}
+
+// ServeHTTP writes the retained commands as a JSON array, oldest first.
+func (t *Tracer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.Entries())
+}
+
+// Adds an entry to the buffer, overwriting the oldest once full.
+func (t *Tracer) add(e TraceEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.entries) == 0 {
+		return
+	}
+
+	t.entries[t.next] = e
+	t.next = (t.next + 1) % len(t.entries)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// Reports a completed command to the recorder, tracer and wire capture, if they are configured.
+// Arguments and replies are redacted before they are passed to the tracer or capture, but not the recorder.
+func (r *ProxyConn) observe(cmd *RedisCmd, server string, discovery bool, start time.Time, val interface{}, err error) {
+	if r.recorder != nil {
+		r.recorder.record(recordedCommand(cmd, server, discovery, start))
+	}
+
+	if r.capture == nil && r.tracer == nil {
+		return
+	}
+
+	args := r.redactedArgs(cmd)
+	if r.capture != nil {
+		r.capture.capture(server, cmd.name, args, r.redactedReply(cmd, val), err)
+	}
+
+	if r.tracer == nil {
+		return
+	}
+
+	// Commands created with NewCommand have no key.
+	key := ""
+	if cmd.keyPos >= 0 && cmd.keyPos < len(args) {
+		key = formatReply(args[cmd.keyPos])
+	}
+
+	r.tracer.add(TraceEntry{
+		Time:      start,
+		Name:      cmd.name,
+		Key:       key,
+		Server:    server,
+		Duration:  time.Since(start),
+		Discovery: discovery,
+		Err:       err,
+	})
+}
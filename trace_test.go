@@ -0,0 +1,83 @@
+package twunproxy
+
+import (
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracerRetainsMostRecentEntriesOldestFirst(t *testing.T) {
+	tr := NewTracer(3)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		tr.add(TraceEntry{Key: k})
+	}
+
+	e := tr.Entries()
+	if len(e) != 3 || e[0].Key != "b" || e[2].Key != "d" {
+		t.Fatalf("Unexpected entries: %+v", e)
+	}
+}
+
+func TestDoRecordsDiscoveryAndMappedCommands(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("CMD", "KEY", "A1", "A2").Return(true, nil).Times(2)
+	mockConn.EXPECT().Close().Times(2)
+
+	tr := NewTracer(10)
+	proxy := getMockProxy(mockPool)
+	proxy.Servers = []string{"10.0.0.1:6379:1"}
+	WithTracer(tr)(proxy)
+
+	canMap := func(v interface{}) bool { return v != nil }
+	proxy.Do(getRedisCmd(), canMap)
+	proxy.Do(getRedisCmd(), canMap)
+
+	e := tr.Entries()
+	if len(e) != 2 {
+		t.Fatalf("Unexpected number of entries: %d", len(e))
+	}
+
+	if !e[0].Discovery || e[0].Server != "10.0.0.1:6379" || e[0].Name != "CMD" || e[0].Key != "KEY" {
+		t.Fatalf("Unexpected discovery entry: %+v", e[0])
+	}
+
+	if e[1].Discovery || e[1].Server != "10.0.0.1:6379" {
+		t.Fatalf("Unexpected mapped entry: %+v", e[1])
+	}
+}
+
+func TestDoTracesCommandsWithoutKey(t *testing.T) {
+	tr := NewTracer(10)
+	proxy := getMockProxy(connPool{&nilStyleConn{reply: "PONG"}})
+	WithTracer(tr)(proxy)
+
+	if _, err := proxy.Do(NewCommand("PING"), func(v interface{}) bool { return v != nil }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	e := tr.Entries()
+	if len(e) != 1 || e[0].Name != "PING" || e[0].Key != "" {
+		t.Fatalf("Unexpected entries: %+v", e)
+	}
+}
+
+func TestTracerServesEntriesAsJSON(t *testing.T) {
+	tr := NewTracer(2)
+	tr.add(TraceEntry{Name: "BLPOP", Key: "k", Server: "10.0.0.1:6379"})
+
+	w := httptest.NewRecorder()
+	tr.ServeHTTP(w, httptest.NewRequest("GET", "/trace", nil))
+
+	var e []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(e) != 1 || e[0]["name"] != "BLPOP" || e[0]["server"] != "10.0.0.1:6379" {
+		t.Fatalf("Unexpected JSON: %s", w.Body.String())
+	}
+}
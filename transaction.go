@@ -0,0 +1,79 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+)
+
+// Transaction runs the input commands in a MULTI/EXEC transaction on the instance holding their keys,
+// which Twemproxy does not allow. Each command's reply is returned in order.
+// Every key is placed as for BRPopLPush: on the instance mapped to it or holding it, or else on its owner in the
+// hash ring. If the keys are placed on different instances, errCrossInstance is returned, and if a key cannot be
+// placed, errNoPlacement; nothing is run in either case. Keys are mapped to the instance once the transaction runs.
+// The commands are queued on a connection of their own. If queueing fails, the transaction is discarded.
+// As in Redis, a command that fails when executed does not stop the others; its error is returned in its place.
+func (r *ProxyConn) Transaction(cmds ...*RedisCmd) ([]interface{}, error) {
+	if len(cmds) == 0 {
+		return nil, errors.New("No commands to run.")
+	}
+
+	var res []interface{}
+	err := r.retrying(context.Background(), "MULTI", cmds[0].key, func() (err error) {
+		res, err = r.transaction(cmds)
+		return err
+	})
+	return res, err
+}
+
+// Places the keys of the input commands and runs them in a transaction once, as for Transaction.
+func (r *ProxyConn) transaction(cmds []*RedisCmd) ([]interface{}, error) {
+	t := r.topology()
+	target := -1
+	for _, cmd := range cmds {
+		pool, ok, err := r.place(cmd.key)
+		if err != nil {
+			return nil, err
+		}
+
+		i := t.indexOf(pool)
+		if !ok || i < 0 {
+			if len(t.pools) != 1 {
+				return nil, errNoPlacement
+			}
+			i = 0
+		}
+
+		if target >= 0 && i != target {
+			return nil, errCrossInstance
+		}
+		target = i
+	}
+
+	c := t.pools[target].Get()
+	defer c.Close()
+
+	if _, err := c.Do("MULTI"); err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		if _, err := c.Do(cmd.name, cmd.getArgs()...); err != nil {
+			c.Do("DISCARD")
+			return nil, err
+		}
+	}
+
+	v, err := c.Do("EXEC")
+	if err != nil {
+		return nil, err
+	}
+
+	res, ok := v.([]interface{})
+	if !ok || len(res) != len(cmds) {
+		return nil, errors.New("Unexpected reply to EXEC.")
+	}
+
+	for _, cmd := range cmds {
+		r.mapKey(cmd.key, t.pools[target])
+	}
+	return res, nil
+}
@@ -0,0 +1,69 @@
+package twunproxy
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestTransactionRunsMultiExecOnMappedInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	_, otherPool := setupMockPool(ctrl)
+	proxy := getMockProxy(otherPool, mockPool)
+	proxy.KeyInstance["A"] = mockPool
+	proxy.KeyInstance["B"] = mockPool
+
+	gomock.InOrder(
+		mockConn.EXPECT().Do("MULTI").Return("OK", nil),
+		mockConn.EXPECT().Do("INCR", "A").Return("QUEUED", nil),
+		mockConn.EXPECT().Do("SET", "B", "v").Return("QUEUED", nil),
+		mockConn.EXPECT().Do("EXEC").Return([]interface{}{int64(1), "OK"}, nil),
+	)
+	mockConn.EXPECT().Close()
+
+	res, err := proxy.Transaction(NewRedisCmd("INCR", "A"), NewRedisCmd("SET", "B", "v"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(res) != 2 || res[0] != int64(1) || res[1] != "OK" {
+		t.Fatalf("Unexpected result: %v", res)
+	}
+}
+
+func TestTransactionRejectsKeysOnDifferentInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, pool1 := setupMockPool(ctrl)
+	_, pool2 := setupMockPool(ctrl)
+	proxy := getMockProxy(pool1, pool2)
+	proxy.KeyInstance["A"] = pool1
+	proxy.KeyInstance["B"] = pool2
+
+	if _, err := proxy.Transaction(NewRedisCmd("GET", "A"), NewRedisCmd("GET", "B")); err != errCrossInstance {
+		t.Fatalf("Expected errCrossInstance, got %v", err)
+	}
+}
+
+func TestTransactionDiscardsOnQueueError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["A"] = mockPool
+
+	gomock.InOrder(
+		mockConn.EXPECT().Do("MULTI").Return("OK", nil),
+		mockConn.EXPECT().Do("BOGUS", "A").Return(nil, errors.New("ERR unknown command")),
+		mockConn.EXPECT().Do("DISCARD").Return("OK", nil),
+	)
+	mockConn.EXPECT().Close()
+
+	if _, err := proxy.Transaction(NewRedisCmd("BOGUS", "A")); err == nil {
+		t.Fatal("Expected queueing error")
+	}
+}
@@ -0,0 +1,89 @@
+package twunproxy
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TTLMode determines what EnforceTTL does with keys that violate the policy.
+type TTLMode string
+
+const (
+	// TTLModeReport only reports violations.
+	TTLModeReport TTLMode = "REPORT"
+
+	// TTLModeSet sets the policy TTL on violating keys.
+	TTLModeSet TTLMode = "SET"
+)
+
+// TTLViolation describes a key found by EnforceTTL without an expiry, or with one beyond the policy TTL.
+// TTL is the remaining time to live before enforcement, or -1 if the key had no expiry.
+// Set indicates that the policy TTL was applied to the key.
+type TTLViolation struct {
+	Key    string        `json:"key"`
+	Server string        `json:"server"`
+	TTL    time.Duration `json:"ttl_ns"`
+	Set    bool          `json:"set"`
+}
+
+// Returned by EnforceTTL for a TTL below a millisecond, which PEXPIRE would take as deleting every violating key.
+var errInvalidTTL = errors.New("TTL must be at least a millisecond.")
+
+// EnforceTTL scans every instance concurrently for keys matching the input pattern that have no expiry
+// or expire later than the input TTL allows. Violations are returned ordered by key and server.
+// In TTLModeSet, the TTL of each violating key is set to the input TTL on the instance holding it.
+// This supports policies that mandate expirations on every key written through Twemproxy.
+// An error is returned for a TTL below a millisecond, without scanning.
+func (r *ProxyConn) EnforceTTL(pattern string, ttl time.Duration, mode TTLMode) ([]TTLViolation, error) {
+	if ttl < time.Millisecond {
+		return nil, errInvalidTTL
+	}
+
+	t := r.topology()
+
+	var mu sync.Mutex
+	var found []TTLViolation
+	errs := t.forEach(func(i int, c Conn) error {
+		return scanKeys(c, pattern, scanCount, func(keys []string) error {
+			for _, k := range keys {
+				v, err := c.Do("PTTL", k)
+				if err != nil {
+					return err
+				}
+
+				// Keys that expired or were deleted since the scan report -2.
+				ms, _ := replyInt(v)
+				if ms == -2 || (ms >= 0 && time.Duration(ms)*time.Millisecond <= ttl) {
+					continue
+				}
+
+				tv := TTLViolation{Key: k, Server: t.server(i), TTL: -1}
+				if ms >= 0 {
+					tv.TTL = time.Duration(ms) * time.Millisecond
+				}
+
+				if mode == TTLModeSet {
+					if _, err := c.Do("PEXPIRE", k, int64(ttl/time.Millisecond)); err != nil {
+						return err
+					}
+					tv.Set = true
+				}
+
+				mu.Lock()
+				found = append(found, tv)
+				mu.Unlock()
+			}
+			return nil
+		})
+	})
+
+	sort.Slice(found, func(a, b int) bool {
+		if found[a].Key != found[b].Key {
+			return found[a].Key < found[b].Key
+		}
+		return found[a].Server < found[b].Server
+	})
+	return found, firstError(errs)
+}
@@ -0,0 +1,62 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestEnforceTTLSetsMissingAndExcessiveTTLs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+
+	keys := []interface{}{[]byte("none"), []byte("long"), []byte("ok"), []byte("gone")}
+	mockConn.EXPECT().Do("SCAN", "0", "MATCH", "*", "COUNT", scanCount).Return([]interface{}{[]byte("0"), keys}, nil)
+	mockConn.EXPECT().Do("PTTL", "none").Return(int64(-1), nil)
+	mockConn.EXPECT().Do("PTTL", "long").Return(int64(7200000), nil)
+	mockConn.EXPECT().Do("PTTL", "ok").Return(int64(1000), nil)
+	mockConn.EXPECT().Do("PTTL", "gone").Return(int64(-2), nil)
+	mockConn.EXPECT().Do("PEXPIRE", "none", int64(3600000)).Return(int64(1), nil)
+	mockConn.EXPECT().Do("PEXPIRE", "long", int64(3600000)).Return(int64(1), nil)
+	mockConn.EXPECT().Close()
+
+	found, err := proxy.EnforceTTL("*", time.Hour, TTLModeSet)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(found) != 2 || found[0].Key != "long" || found[0].TTL != 2*time.Hour || !found[0].Set ||
+		found[1].Key != "none" || found[1].TTL != -1 || !found[1].Set {
+		t.Fatalf("Unexpected result: %+v", found)
+	}
+}
+
+func TestEnforceTTLReportModeChangesNothing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+
+	keys := []interface{}{[]byte("none")}
+	mockConn.EXPECT().Do("SCAN", "0", "MATCH", "*", "COUNT", scanCount).Return([]interface{}{[]byte("0"), keys}, nil)
+	mockConn.EXPECT().Do("PTTL", "none").Return(int64(-1), nil)
+	mockConn.EXPECT().Close()
+
+	found, err := proxy.EnforceTTL("*", time.Hour, TTLModeReport)
+	if err != nil || len(found) != 1 || found[0].Set {
+		t.Fatalf("Unexpected result: %+v, %v", found, err)
+	}
+}
+
+func TestEnforceTTLRejectsNonPositiveTTL(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{}})
+	for _, ttl := range []time.Duration{0, -time.Second, time.Microsecond} {
+		if _, err := proxy.EnforceTTL("*", ttl, TTLModeSet); err != errInvalidTTL {
+			t.Fatalf("Expected TTL %v to be rejected, got %v", ttl, err)
+		}
+	}
+}
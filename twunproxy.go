@@ -1,10 +1,15 @@
 package twunproxy
 
 import (
+	"context"
 	"errors"
 	"gopkg.in/yaml.v2"
+	"io"
 	"io/ioutil"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Conn interface represents the minimum implemented signature for underlying Redis connections.
@@ -18,37 +23,215 @@ type ConnGetter interface {
 	Get() Conn
 }
 
-// RedisPoolConfig represents one named pool from a Twemproxy configuration file.
-type redisPoolConfig struct {
-	Servers []string `yaml:"servers"`
-	Auth    string   `yaml:"redis_auth"`
+// PoolCloser is implemented by connection pools that can be shut down, releasing their connections.
+// It is optional: ProxyConn.Close closes the pools that implement it and leaves others to the garbage collector.
+type PoolCloser interface {
+	ConnGetter
+	Close() error
+}
+
+// DBSelector is implemented by connection pools that can connect to a database other than 0, as set by redis_db.
+// SelectDB is called once, after the pool is created and before it is used. Pools for a configuration with
+// a non-zero redis_db must implement it; those of the built-in CreatePool implementations do.
+type DBSelector interface {
+	ConnGetter
+	SelectDB(db int) error
+}
+
+// PoolConfig represents one named pool from a Twemproxy configuration file.
+// Name is the name of the pool, which is the key of its section rather than a setting.
+// ServerAuth overrides redis_auth for the servers with the addresses it holds, "host:port". It is not a Twemproxy
+// setting, so configurations using it may have to be kept apart from those that Twemproxy reads.
+type PoolConfig struct {
+	Name         string            `yaml:"-"`
+	Servers      []string          `yaml:"servers"`
+	Auth         string            `yaml:"redis_auth"`
+	ServerAuth   map[string]string `yaml:"server_auth"`
+	DB           int               `yaml:"redis_db"`
+	Hash         string            `yaml:"hash"`
+	Distribution string            `yaml:"distribution"`
+	HashTag      string            `yaml:"hash_tag"`
+
+	AutoEjectHosts     bool `yaml:"auto_eject_hosts"`
+	ServerRetryTimeout int  `yaml:"server_retry_timeout"`
+	ServerFailureLimit int  `yaml:"server_failure_limit"`
+
+	// Redis is false for memcached pools. Twemproxy defaults it to false, but twunproxy treats a pool
+	// without the setting as Redis, so that configurations written for it keep working.
+	Redis *bool `yaml:"redis"`
+}
+
+// Memcached indicates whether the pool is a memcached pool, which is one that sets redis to false.
+func (c PoolConfig) Memcached() bool {
+	return c.Redis != nil && !*c.Redis
+}
+
+// AuthFor returns the auth for the server with the input descriptor: its override in server_auth, if any,
+// or else redis_auth.
+func (c PoolConfig) AuthFor(desc string) string {
+	if auth, ok := c.ServerAuth[ServerAddr(desc)]; ok {
+		return auth
+	}
+	return c.Auth
 }
 
 // RedisReturn allows us to pass Redis command returns around as a single value.
+// Pool is the index of the pool that produced the return.
 type redisReturn struct {
-	val interface{}
-	err error
+	val  interface{}
+	err  error
+	pool int
 }
 
 // RedisCmd is a container for all the requisite properties of a Redis command.
-// Assumed usage is for commands where the key is the first argument after the command name.
+// Args holds every argument other than the key, which is inserted at index keyPos when the command is run.
+// For the usual case of the key being the first argument after the command name, keyPos is 0.
 type RedisCmd struct {
-	name string
-	key  string
-	args []interface{}
+	name      string
+	key       string
+	args      []interface{}
+	keyPos    int
+	timeout   time.Duration
+	noCache   bool
+	probe     bool
+	fallbacks []func(interface{}) bool
+}
+
+// NewRedisCmd returns a command whose key is the first argument after the command name.
+func NewRedisCmd(name, key string, args ...interface{}) *RedisCmd {
+	return &RedisCmd{name: name, key: key, args: args}
+}
+
+// NewRedisCmdBytes returns a command for a binary key, as for NewRedisCmd. Keys are held as Go strings, which hold
+// any bytes, so binary keys are sent and mapped exactly; this saves converting them.
+func NewRedisCmdBytes(name string, key []byte, args ...interface{}) *RedisCmd {
+	return NewRedisCmd(name, string(key), args...)
+}
+
+// NewRedisCmdAt returns a command whose key is the argument at the input index, counting from 0 after the command name.
+// This supports commands such as "GEORADIUS src ... STORE dst", where the key that determines routing is not first.
+func NewRedisCmdAt(name string, keyPos int, args ...interface{}) (*RedisCmd, error) {
+	if keyPos < 0 || keyPos >= len(args) {
+		return nil, errors.New("Key position is out of range.")
+	}
+
+	key, ok := keyString(args[keyPos])
+	if !ok {
+		return nil, errors.New("Key argument is not a string.")
+	}
+
+	rest := make([]interface{}, 0, len(args)-1)
+	rest = append(rest, args[:keyPos]...)
+	rest = append(rest, args[keyPos+1:]...)
+	return &RedisCmd{name: name, key: key, args: rest, keyPos: keyPos}, nil
+}
+
+// NewCommand returns a command without a key, such as BGSAVE or INFO, for broadcasting with DoAll.
+// It is never mapped; Do would send it to an arbitrary instance that accepts its reply.
+func NewCommand(name string, args ...interface{}) *RedisCmd {
+	return &RedisCmd{name: name, args: args, keyPos: -1, noCache: true}
+}
+
+// NoCache marks this command as a one-off, so that discovering its key does not add a mapping.
+// This suits probes of keys that will not be used again, which would otherwise churn the mappings.
+// A mapping that already exists for the key is still used.
+func (c *RedisCmd) NoCache() *RedisCmd {
+	c.noCache = true
+	return c
 }
 
 // The 'Do' command accepts a variadic list of args after the command name.
-// We need to create a single slice.
+// We need to create a single slice with the key in its place.
 func (c *RedisCmd) getArgs() []interface{} {
-	return append([]interface{}{c.key}, c.args...)
+	if c.keyPos < 0 {
+		return c.args
+	}
+
+	args := make([]interface{}, 0, len(c.args)+1)
+	args = append(args, c.args[:c.keyPos]...)
+	args = append(args, c.key)
+	return append(args, c.args[c.keyPos:]...)
 }
 
 // ProxyConn maintains its own slice of Redis connection pools and mappings of Redis keys to pools.
+// KeyInstance holds the mappings unless a KeyMapper is configured. Commands write to it concurrently,
+// so access mappings through Lookup, Map and Unmap rather than the map itself. Keys are held as Go strings,
+// which hold any bytes, so binary keys are mapped as they are.
 type ProxyConn struct {
 	Pools            []ConnGetter
+	Servers          []string
 	KeyInstance      map[string]ConnGetter
 	keyInstanceMutex *sync.RWMutex
+	mapper           KeyMapper
+	metrics          Metrics
+	logger           Logger
+	spans            SpanStarter
+	tracer           *Tracer
+	capture          *WireCapture
+	redactor         Redactor
+	onDeadLetter     func(DeadLetter)
+	queue            *outageQueue
+	maxValueSize     int64
+	timeouts         map[string]time.Duration
+	inflight         *inflightLimiter
+	adaptive         *discoveryStats
+	prefixes         *prefixRules
+	processors       map[string]ReplyProcessor
+	nilErrors        []error
+	startup          StartupPolicy
+	hashRouting      *hashRouting
+	recorder         *Recorder
+	costs            *costAccount
+	maxReplySizes    map[string]int64
+	rounding         TimeoutRounding
+	duplicates       *duplicateHandling
+	partial          bool
+	ejector          *ejector
+	retry            *RetryPolicy
+	repair           *mappingRepair
+	blockingRepair   *mappingRepair
+	flights          *discoveryFlights
+	probes           *probeLimiter
+	drainTimeout     time.Duration
+	reads            *readRouting
+	discovery        DiscoveryStrategy
+	preProbe         bool
+	adminGuard       *AdminGuard
+
+	// Guards the Pools and Servers slices, which are replaced wholesale on reload.
+	topologyMutex sync.RWMutex
+	ring          *hashRing
+	hashTag       string
+	config        func() (PoolConfig, error)
+	poolName      string
+	create        CreatePool
+
+	// Guards the background subsystems and routing table attached to the proxy.
+	mu         sync.Mutex
+	middleware []func(next Handler) Handler
+	prober     *LatencyProber
+	commands   map[string]CommandInfo
+	registered map[string]CommandInfo
+	scripts    *scriptCache
+	versions   map[ConnGetter]redisVersion
+	jobs       *jobScheduler
+	health     *HealthMonitor
+	replicas   map[string][]ConnGetter
+	closers    map[int]func()
+	nextCloser int
+	closed     bool
+
+	// Set for proxies whose pools are shared with other proxies, and are closed by their owner instead.
+	poolsShared bool
+
+	// Counters and observations kept for SnapshotStats, which has its own lock.
+	stats statsStore
+
+	// Rate limits of discovery probes and broadcasts, which have their own lock.
+	rates rateLimiter
+
+	// Counts of mapping lookups for MappingStats, updated atomically.
+	mappingCounts mappingCounts
 }
 
 // CreatePool is the signature for returning a connection pool based on the input Redis address and auth strings.
@@ -58,100 +241,440 @@ type CreatePool func(string, string) ConnGetter
 // Read the Twemproxy configuration file from the input path.
 // Instantiate a ProxyConn based on the input pool name.
 // Initialise a key-to-pool mapping with the input initial capacity.
-func NewProxyConn(confPath, poolName string, keyCap int, create CreatePool) (*ProxyConn, error) {
-	f, err := ioutil.ReadFile(confPath)
+// Any options are applied to the proxy before it is returned.
+// If the pool has no servers or any server fails its PING, an error is returned unless WithStartupPolicy allows
+// the proxy to start degraded. Options are applied to a degraded proxy as if it had no pools.
+// If the pool sets auto_eject_hosts, failing instances are ejected from discovery as Twemproxy would eject them.
+// The file is read again whenever the proxy reloads its configuration, such as on Reload.
+func NewProxyConn(confPath, poolName string, keyCap int, create CreatePool, opts ...Option) (*ProxyConn, error) {
+	return newProxyConn(poolName, keyCap, create, func() (PoolConfig, error) {
+		return readPoolConfig(confPath, poolName)
+	}, false, opts)
+}
+
+// NewProxyConnFromReader creates a proxy as for NewProxyConn, reading the Twemproxy configuration from the input
+// reader, such as a Kubernetes ConfigMap or an embedded asset. The configuration is read once,
+// so reloading the proxy rebuilds its pools from the same configuration.
+func NewProxyConnFromReader(rd io.Reader, poolName string, keyCap int, create CreatePool, opts ...Option) (*ProxyConn, error) {
+	data, err := ioutil.ReadAll(rd)
 	if err != nil {
 		return nil, err
 	}
+	return NewProxyConnFromBytes(data, poolName, keyCap, create, opts...)
+}
 
-	var m map[string]redisPoolConfig
-	if err := yaml.Unmarshal(f, &m); err != nil {
+// NewProxyConnFromBytes creates a proxy as for NewProxyConnFromReader from the input Twemproxy configuration.
+func NewProxyConnFromBytes(data []byte, poolName string, keyCap int, create CreatePool, opts ...Option) (*ProxyConn, error) {
+	conf, err := ParsePoolConfig(data, poolName)
+	if err != nil {
 		return nil, err
 	}
+	return NewProxyConnFromConfig(conf, keyCap, create, opts...)
+}
 
-	conf := m[poolName]
-	pools := make([]ConnGetter, len(conf.Servers))
+// NewProxyConnFromConfig creates a proxy as for NewProxyConn from an already parsed or constructed pool configuration.
+// Reloading the proxy rebuilds its pools from the same configuration.
+func NewProxyConnFromConfig(conf PoolConfig, keyCap int, create CreatePool, opts ...Option) (*ProxyConn, error) {
+	return newProxyConn(conf.Name, keyCap, create, func() (PoolConfig, error) {
+		return conf, nil
+	}, false, opts)
+}
 
-	// For each instance described in the Twemproxy configuration, create a connection pool.
-	// Execute a PING command to check that it is valid and available.
-	for i, def := range conf.Servers {
-		p := create(def, conf.Auth)
+// Creates a proxy for the named pool, whose configuration is returned by the input function.
+// An error is returned if the configuration is for memcached and the input flag is not, or the other way round.
+func newProxyConn(
+	poolName string,
+	keyCap int,
+	create CreatePool,
+	config func() (PoolConfig, error),
+	memcached bool,
+	opts []Option) (*ProxyConn, error) {
 
-		c := p.Get()
-		defer c.Close()
-		if _, err := c.Do("PING"); err != nil {
-			return nil, err
+	if conf, err := config(); err == nil && conf.Memcached() != memcached {
+		if memcached {
+			return nil, errors.New("Pool " + poolName + " is not a memcached pool.")
 		}
-
-		pools[i] = p
+		return nil, errors.New("Pool " + poolName + " is a memcached pool; use NewMemcachedProxyConn.")
 	}
 
 	proxy := new(ProxyConn)
-	proxy.Pools = pools
 	proxy.KeyInstance = make(map[string]ConnGetter, keyCap)
 	proxy.keyInstanceMutex = new(sync.RWMutex)
+	proxy.config = config
+	proxy.poolName = poolName
+	proxy.create = create
+
+	t, err := proxy.loadTopology()
+	if err == nil {
+		proxy.setTopology(t)
+	}
+
+	if conf, err := config(); err == nil && conf.AutoEjectHosts {
+		proxy.ejector = newEjector(conf.ejectionPolicy())
+	}
+
+	for _, opt := range opts {
+		opt(proxy)
+	}
+
+	if err != nil {
+		if err = proxy.degradedStartup(err); err != nil {
+			return nil, err
+		}
+	}
 	return proxy, nil
 }
 
+// Reads the configuration of the pool and creates a connection pool for each of its servers.
+// The hash ring is omitted if the configured hash, distribution or hash tag is unsupported.
+// An error is returned if any server fails its PING.
+func (r *ProxyConn) loadPools() (*topology, error) {
+	t, errs, err := r.openPools()
+	if err != nil {
+		return nil, err
+	}
+	if err := firstError(errs); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Creates pools as for loadPools, but returns the topology whatever the outcome of each PING,
+// with the PING error of each pool in the same order.
+func (r *ProxyConn) openPools() (*topology, []error, error) {
+	conf, err := r.readConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pools := make([]ConnGetter, len(conf.Servers))
+	errs := make([]error, len(conf.Servers))
+
+	// For each instance described in the Twemproxy configuration, create a connection pool.
+	// Execute a PING command to check that it is valid and available.
+	for i, def := range conf.Servers {
+		p, err := r.createPool(conf, def)
+		if err == nil {
+			c := p.Get()
+			_, err = c.Do("PING")
+			c.Close()
+		}
+
+		pools[i], errs[i] = p, err
+	}
+
+	ring, _ := newHashRing(conf.Servers, conf.Hash, conf.Distribution, conf.HashTag)
+	return &topology{pools: pools, servers: conf.Servers, ring: ring, hashTag: conf.HashTag}, errs, nil
+}
+
+// Creates a pool for the server with the input descriptor, with its auth and the database of the input configuration.
+// An error is returned if the database cannot be selected.
+func (r *ProxyConn) createPool(conf PoolConfig, desc string) (ConnGetter, error) {
+	p := r.create(desc, conf.AuthFor(desc))
+	if conf.DB == 0 {
+		return p, nil
+	}
+
+	s, ok := p.(DBSelector)
+	if !ok {
+		return p, errCannotSelectDB(ServerAddr(desc), conf.DB)
+	}
+	return p, s.SelectDB(conf.DB)
+}
+
+// Returned for pools that do not implement DBSelector when a database other than 0 is configured.
+func errCannotSelectDB(server string, db int) error {
+	return errors.New("Pool for server " + server + " cannot select database " + strconv.Itoa(db) + ".")
+}
+
+// Returns the configuration of the pool, read again from its file if the proxy was created from one.
+func (r *ProxyConn) readConfig() (PoolConfig, error) {
+	if r.config == nil {
+		return PoolConfig{}, errors.New("Proxy was not created from a configuration.")
+	}
+	return r.config()
+}
+
+// Reads the named pool from the Twemproxy configuration file at the input path.
+func readPoolConfig(confPath, poolName string) (PoolConfig, error) {
+	f, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+	return ParsePoolConfig(f, poolName)
+}
+
+// ParsePoolConfig returns the named pool from the input Twemproxy configuration.
+// A pool missing from the configuration is returned with no servers.
+func ParsePoolConfig(data []byte, poolName string) (PoolConfig, error) {
+	pools, err := parsePools(data)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+
+	conf := pools[poolName]
+	conf.Name = poolName
+	return conf, nil
+}
+
+// Parses every pool of the input Twemproxy configuration, by name.
+func parsePools(data []byte) (map[string]PoolConfig, error) {
+	var m map[string]PoolConfig
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	for name, conf := range m {
+		conf.Name = name
+		m[name] = conf
+	}
+	return m, nil
+}
+
 // Do runs the input command against the cluster.
 // If we already have a pool mapped to the command key, just run it there and return the result.
 // Otherwise set up Goroutines running against each connection in the pool.
 // The Goroutines will terminate upon the first successful Redis command return.
+// If an outage queue is configured and every instance is unavailable, the command waits and is replayed on recovery.
+// Commands that ultimately cannot be routed are passed to the dead-letter handler.
+// Any reply processor registered for the command is applied to the result.
+// If canMap is nil, the predicate is inferred for known commands, such as GET or BLPOP, or those registered with
+// an Accept predicate; other commands fail. A predicate that panics rejects the reply.
 // NOTE: Blocking commands should be issued with a timeout or risk blocking permanently.
 func (r *ProxyConn) Do(cmd *RedisCmd, canMap func(interface{}) bool) (interface{}, error) {
-	// If we have already determined the instance for this key, just run it.
+	return r.DoContext(context.Background(), cmd, canMap)
+}
 
-	// Unlock as soon as possible.
-	pool, ok := func() (ConnGetter, bool) {
-		r.keyInstanceMutex.RLock()
-		defer r.keyInstanceMutex.RUnlock()
-		pool, ok := r.KeyInstance[cmd.key]
-		return pool, ok
-	}()
+// DoContext runs the input command as for Do, but returns early with the context error if the context is
+// cancelled or its deadline passes. Discovery fan-outs stop waiting on every instance when this happens.
+// Commands already written to an instance still run there; only the wait for their replies is abandoned.
+func (r *ProxyConn) DoContext(ctx context.Context, cmd *RedisCmd, canMap func(interface{}) bool) (interface{}, error) {
+	canMap, err := r.predicate(cmd, canMap)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := r.doRouted(ctx, cmd, canMap)
+	return r.process(cmd.name, v, err)
+}
+
+// DoKey runs the named command with the input key as its first argument, followed by the input args, on the instance
+// holding the key, as for DoContext. Instances are discovered with the predicate inferred for the command, as for Do
+// with a nil predicate, or else with KeyFound. The command should then reply with nil, an empty array or zero on
+// instances where the key does not exist, as most read commands do. Use DoContext with a predicate for commands
+// that do not.
+func (r *ProxyConn) DoKey(ctx context.Context, name, key string, args ...interface{}) (interface{}, error) {
+	canMap, ok := r.acceptance(name)
+	if !ok {
+		canMap = KeyFound
+	}
+	return r.DoContext(ctx, NewRedisCmd(name, key, args...), canMap)
+}
+
+// KeyFound is the predicate of DoKey. It rejects the replies that Redis gives for most commands on a missing key:
+// nil, an empty array and zero. Any other reply is accepted.
+func KeyFound(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		return len(t) > 0
+	case int64:
+		return t != 0
+	}
+	return true
+}
 
+// Runs the input command as for DoContext, but returns the raw reply without applying reply processors.
+// Helpers that decode replies themselves use this, so that their decoding is unaffected by registrations.
+func (r *ProxyConn) doRouted(ctx context.Context, cmd *RedisCmd, canMap func(interface{}) bool) (interface{}, error) {
+	start := time.Now()
+
+	label := CostLabel(ctx)
+	if err := r.costs.admit(label); err != nil {
+		r.counter("quota_rejections", "", 1)
+		return nil, err
+	}
+
+	ctx, span := r.startSpan(ctx, cmd.name)
+	span.SetAttribute("db.system", "redis")
+	span.SetAttribute("db.operation", cmd.name)
+
+	v, err := r.doRetry(ctx, cmd, canMap)
+	for err != nil && r.queue != nil && ctx.Err() == nil && r.isOutage(err) {
+		if r.queue.wait(r, start) != nil {
+			break
+		}
+		v, err = r.doRetry(ctx, cmd, canMap)
+	}
+
+	// Commands abandoned by the caller are not dead-lettered, even though context errors satisfy net.Error.
+	if err == ErrNoMapping || err == errNoPools || (isUnavailable(err) && err != ctx.Err()) {
+		r.deadLetter(cmd, err)
+	}
+
+	r.costs.charge(label, cmd, v)
+	endSpan(span, commandOutcome(err), err)
+	return v, err
+}
+
+// Runs the input command once, either against its mapped pool or by discovery across all pools.
+// If the context ends before an instance accepts the command, the context error is returned.
+func (r *ProxyConn) do(ctx context.Context, cmd *RedisCmd, canMap func(interface{}) bool) (interface{}, error) {
+	start := time.Now()
+
+	// If we have already determined the instance for this key, just run it.
+	t := r.topology()
+	if len(t.pools) == 0 {
+		return nil, errNoPools
+	}
+
+	pool, ok := r.lookup(cmd.key)
+	r.countLookup(ok)
+	span := r.span(ctx)
+	span.SetAttribute("twunproxy.mapping_hit", ok)
 	if ok {
-		conn := pool.Get()
-		defer conn.Close()
-		return conn.Do(cmd.name, cmd.getArgs()...)
+		span.SetAttribute("server.address", t.serverOf(pool))
+		v, err := r.doMapped(ctx, t, pool, cmd, start)
+		if moved, ok := r.rediscoverBlocked(ctx, t, pool, cmd, canMap, v, err); ok {
+			pool = moved
+			v, err = r.doMapped(ctx, t, pool, cmd, start)
+		}
+		if !r.repairMapping(ctx, t, pool, cmd, canMap, v, err) {
+			return v, err
+		}
+	}
+
+	// Commands for a key already being discovered may wait for that discovery instead.
+	shared, finish := r.coalesce(ctx, t, cmd, start)
+	if shared != nil {
+		return shared.val, shared.err
+	}
+	defer finish()
+
+	// Ejected instances are left out of discovery, and the rest are probed heaviest first.
+	idxs := t.byWeight(r.liveIndexes(t))
+	if len(idxs) == 0 {
+		return nil, errAllEjected
+	}
+
+	defer r.inflight.release(r.inflight.acquire(len(idxs)))
+
+	r.histogram("discovery_fanout", "", float64(len(idxs)))
+	r.log().Debug("Discovery started", "command", cmd.name, "key", cmd.key, "instances", len(idxs))
+	res := r.discoverWith(ctx, t, idxs, cmd, canMap)
+
+	server := ""
+	if res.pool >= 0 {
+		server = t.server(res.pool)
+		r.counter("discoveries", server, 1)
+		span.SetAttribute("server.address", server)
+		r.log().Debug("Discovery finished", "command", cmd.name, "key", cmd.key, "server", server,
+			"duration", time.Since(start))
+		if !cmd.noCache {
+			r.log().Debug("Mapping added", "key", cmd.key, "server", server)
+		}
+		r.adaptive.record(cmd.key, server)
+		r.prefixes.learn(cmd.key, r.adaptive)
+	} else {
+		if ctx.Err() != nil {
+			res.err = ctx.Err()
+		}
+		r.log().Debug("Discovery finished", "command", cmd.name, "key", cmd.key, "duration", time.Since(start),
+			"err", res.err)
+	}
+	r.observe(cmd, server, true, start, res.val, res.err)
+
+	return res.val, res.err
+}
+
+// Runs the input command on the pools at the input indices of the topology and returns the first accepted result.
+// If no result is accepted, the return carries ErrNoMapping and a pool index of -1.
+func (r *ProxyConn) discover(
+	ctx context.Context,
+	t *topology,
+	idxs []int,
+	cmd *RedisCmd,
+	canMap func(interface{}) bool) redisReturn {
+
+	if (r.duplicates != nil && len(idxs) > 1) || len(cmd.fallbacks) > 0 {
+		return r.discoverAll(ctx, t, idxs, cmd, canMap)
 	}
 
 	// Start the command on each of the pools and receive results on a channel.
 	results := make(chan redisReturn)
 	wg := new(sync.WaitGroup)
-	stop := make([]chan bool, len(r.Pools))
-	for i := range r.Pools {
+	stop := make([]chan bool, len(idxs))
+	for j, i := range idxs {
 		// Buffer prevents blocking when sending stop commands to completed Goroutines.
-		stop[i] = make(chan bool, 1)
+		stop[j] = make(chan bool, 1)
 		wg.Add(1)
-		go r.doInstance(i, cmd, canMap, results, stop[i], wg)
+		go r.doInstance(ctx, t, i, cmd, canMap, results, stop[j], wg)
 	}
 
 	// Wait for the first accepted Redis command result then send a message on the stop channel to other Goroutines.
-	// Goroutines started above will detect this condition and complete.
-	res := redisReturn{val: nil, err: errors.New("No results returned that could determine a key mapping.")}
+	// Goroutines started above will detect this condition and complete. Only the first result maps the key.
+	// If the key exists on several instances, later accepted results are counted and discarded;
+	// each already holds a stop message.
+	res := redisReturn{val: nil, err: ErrNoMapping, pool: -1}
+	done := make(chan bool)
 	go func() {
 		for rr := range results {
+			if res.pool >= 0 {
+				r.counter("discarded_accepted_results", t.server(rr.pool), 1)
+				continue
+			}
 			res = rr
+			if !cmd.noCache {
+				r.mapKey(cmd.key, t.pools[rr.pool])
+			}
 			for _, c := range stop {
 				c <- true
 			}
 		}
+		close(done)
 	}()
 
 	// Wait for all the Redis connections to run their operations.
 	wg.Wait()
 	close(results)
+	<-done
 
-	return res.val, res.err
+	return res
+}
+
+// Runs the input command on the pool its key is mapped to.
+func (r *ProxyConn) doMapped(ctx context.Context, t *topology, pool ConnGetter, cmd *RedisCmd, start time.Time) (interface{}, error) {
+	defer r.inflight.release(r.inflight.acquire(1))
+
+	if rr, ok := r.readReplica(ctx, t, pool, cmd); ok {
+		r.observe(cmd, t.serverOf(pool), false, start, rr.val, rr.err)
+		return rr.val, rr.err
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+	began := time.Now()
+	v, err := r.intercept(ctx, t.serverOf(pool), false, cmd, func() (interface{}, error) {
+		return r.runContext(ctx, conn, cmd)
+	})
+	if ctx.Err() == nil {
+		r.recordOutcome(pool, err)
+		r.recordCommand(t.serverOf(pool), false, time.Since(began), err)
+	}
+	r.observe(cmd, t.serverOf(pool), false, start, v, err)
+	return v, err
 }
 
-// Runs the input Redis command against a connection from the input pool.
-// If the canMap test returns true for the result, the key is mapped to the pool.
-// The result is then sent on the result channel, which causes a subsequent message on the stop channel.
+// Runs the input Redis command against a connection from the pool at the input index of the topology.
+// If the canMap test returns true for the result, it is sent on the result channel, whose reader maps the key
+// to the pool of the first accepted result. This causes a subsequent message on the stop channel.
 // Any Redis command return causes the wait group to be notified and a return from the method.
 // The last remaining path is for the a message on the stop channel before a return is received from the Redis command.
-// This causes wait group notification and return.
+// This causes wait group notification and return. The end of the context is treated in the same way.
 func (r *ProxyConn) doInstance(
+	ctx context.Context,
+	t *topology,
 	pIdx int,
 	cmd *RedisCmd,
 	canMap func(interface{}) bool,
@@ -160,35 +683,115 @@ func (r *ProxyConn) doInstance(
 	wg *sync.WaitGroup) {
 
 	defer wg.Done()
-	pool := r.Pools[pIdx]
+	pool := t.pools[pIdx]
+
+	// Probes wait for the rate limit of the instance before taking a slot, so that waiting holds no slot.
+	if !r.waitRate(ctx, t.server(pIdx), stop) {
+		return
+	}
+
+	// Probes may have to wait for a slot if discovery concurrency is limited.
+	// The slot is held until the command completes, even if this Goroutine returns first.
+	release, ok := r.probes.acquire(ctx, pool, stop)
+	if !ok {
+		return
+	}
 
 	// This is outside the Goroutine below to ensure connection closure.
 	conn := pool.Get()
 	defer conn.Close()
 
+	_, span := r.startSpan(ctx, cmd.name+" probe")
+	span.SetAttribute("server.address", t.server(pIdx))
+
 	// Start the command on a new Goroutine.
 	// If we receive a return, test it and add a mapping if we have located the instance correctly.
 	// If we have, send the return on the results channel.
 
-	// NOTE: Bad canMap definitions can result in panics here.
-	// If the definition returns true for more than one result, there will be an attempted write to a closed channel.
-	cmdDone := make(chan bool)
+	// Accepted returns are forwarded to the results channel from this Goroutine, which the wait group tracks.
+	// Buffers let the command Goroutine complete after this one has returned on stop or the end of the context.
+	// Once this Goroutine stops waiting, the command Goroutine discards any return it accepts instead,
+	// so that every discarded return is counted exactly once.
+	accepted := make(chan redisReturn, 1)
+	cmdDone := make(chan bool, 1)
+	var mu sync.Mutex
+	abandoned := false
+	var aborted int32
 	go func() {
-		if val, err := conn.Do(cmd.name, cmd.getArgs()...); canMap(val) {
-			r.keyInstanceMutex.Lock()
-			defer r.keyInstanceMutex.Unlock()
-			r.KeyInstance[cmd.key] = pool
-			res <- redisReturn{val: val, err: err}
-		} else {
+		defer release()
+		began := time.Now()
+		val, err := r.intercept(ctx, t.server(pIdx), true, cmd, func() (interface{}, error) {
+			return r.run(conn, cmd)
+		})
+		probeAborted := atomic.LoadInt32(&aborted) != 0
+		if !probeAborted {
+			r.recordOutcome(pool, err)
+			r.recordCommand(t.server(pIdx), true, time.Since(began), err)
+			if isUnavailable(err) {
+				r.log().Warn("Probe failed", "server", t.server(pIdx), "command", cmd.name, "key", cmd.key, "err", err)
+			} else if err != nil {
+				r.log().Debug("Probe failed", "server", t.server(pIdx), "command", cmd.name, "key", cmd.key, "err", err)
+			}
+		}
+		if !canMap(val) {
+			outcome := "rejected"
+			if probeAborted {
+				outcome = "aborted"
+			} else if err != nil {
+				outcome = "error"
+			}
+			endSpan(span, outcome, err)
 			cmdDone <- true
+			return
 		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if abandoned {
+			r.counter("discarded_accepted_results", t.server(pIdx), 1)
+			endSpan(span, "discarded", err)
+			return
+		}
+		endSpan(span, "accepted", err)
+		accepted <- redisReturn{val: val, err: err, pool: pIdx}
 	}()
 
 	// Wait for completion of this command or notification of accepted return from any others.
 	select {
-	case <-stop:
+	case rr := <-accepted:
+		// Every accepted return is followed by a stop message, which marks it as received.
+		res <- rr
+		<-stop
 		return
+	case <-stop:
+	case <-ctx.Done():
 	case <-cmdDone:
 		return
 	}
+
+	// Another instance accepted the command or the context ended, so a command still blocking here is interrupted.
+	mu.Lock()
+	defer mu.Unlock()
+	abandoned = true
+
+	select {
+	case <-cmdDone:
+	case <-accepted:
+		r.counter("discarded_accepted_results", t.server(pIdx), 1)
+	default:
+		atomic.StoreInt32(&aborted, 1)
+		if !r.abort(conn) {
+			atomic.StoreInt32(&aborted, 0)
+		}
+	}
+}
+
+// Returns the first non-nil error from the input slice.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -1,7 +1,9 @@
 package twunproxy
 
 import (
+	"context"
 	"github.com/golang/mock/gomock"
+	"io/ioutil"
 	"sync"
 	"testing"
 	"time"
@@ -29,7 +31,7 @@ func TestDoInstanceReturnsOnStopChannelMessage(t *testing.T) {
 		return false
 	}
 
-	go proxy.doInstance(0, getRedisCmd(), canMap, results, stop, wg)
+	go proxy.doInstance(context.Background(), proxy.topology(), 0, getRedisCmd(), canMap, results, stop, wg)
 	time.Sleep(500 * time.Millisecond)
 	stop <- true
 	wg.Wait()
@@ -55,7 +57,7 @@ func TestDoInstanceReturnsOnBadCommandResult(t *testing.T) {
 	wg.Add(1)
 
 	canMap := func(v interface{}) bool { return false }
-	go proxy.doInstance(0, getRedisCmd(), canMap, results, stop, wg)
+	go proxy.doInstance(context.Background(), proxy.topology(), 0, getRedisCmd(), canMap, results, stop, wg)
 
 	var res redisReturn
 	go func() {
@@ -93,7 +95,7 @@ func TestDoInstanceWritesToChannelAndReturnsOnAcceptedResult(t *testing.T) {
 	wg.Add(1)
 
 	canMap := func(v interface{}) bool { return true }
-	go proxy.doInstance(0, getRedisCmd(), canMap, results, stop, wg)
+	go proxy.doInstance(context.Background(), proxy.topology(), 0, getRedisCmd(), canMap, results, stop, wg)
 
 	var res redisReturn
 	go func() {
@@ -110,8 +112,9 @@ func TestDoInstanceWritesToChannelAndReturnsOnAcceptedResult(t *testing.T) {
 		t.Fatal("Unexpected Redis return value.")
 	}
 
-	if _, ok := proxy.KeyInstance["KEY"]; !ok {
-		t.Fatal("Expected mapping entry for Redis key.")
+	// The reader of the results maps the key, so that only the first accepted result does.
+	if res.pool != 0 {
+		t.Fatalf("Expected the result to identify its pool, got %d", res.pool)
 	}
 }
 
@@ -147,6 +150,52 @@ func TestDoExecutesCommandOnAllProxyPools(t *testing.T) {
 	}
 }
 
+func TestDoWithNoCacheDoesNotMapKey(t *testing.T) {
+	proxy := getMockProxy(connPool{&nilStyleConn{}}, connPool{&nilStyleConn{reply: "VAL"}})
+	canMap := func(v interface{}) bool { return v != nil }
+
+	v, err := proxy.Do(NewRedisCmd("GET", "KEY").NoCache(), canMap)
+	if err != nil || v != "VAL" {
+		t.Fatalf("Unexpected result: %v, %v", v, err)
+	}
+	if _, ok := proxy.Lookup("KEY"); ok {
+		t.Fatal("Expected no mapping for a command issued with NoCache.")
+	}
+}
+
+func TestDoContextReturnsContextErrorWhenCancelledDuringDiscovery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("CMD", "KEY", "A1", "A2").DoAndReturn(func(string, ...interface{}) (interface{}, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	})
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	var dead []DeadLetter
+	proxy.onDeadLetter = func(d DeadLetter) { dead = append(dead, d) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := proxy.DoContext(ctx, getRedisCmd(), func(v interface{}) bool { return v != nil }); err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline error, got %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("Discovery did not return promptly on cancellation: %v", d)
+	}
+	if len(dead) != 0 {
+		t.Fatal("Cancelled commands should not be dead-lettered.")
+	}
+
+	// Allow the abandoned command to complete before the controller checks expectations.
+	time.Sleep(time.Second)
+}
+
 /******************************************************
  * Helpers
  ******************************************************/
@@ -176,3 +225,66 @@ func getRedisCmd() *RedisCmd {
 		args: []interface{}{"A1", "A2"},
 	}
 }
+
+// Writes the input Twemproxy configuration to a temporary file and returns its path.
+func writeConfig(t *testing.T, conf string) string {
+	f, err := ioutil.TempFile("", "nutcracker")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(conf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return f.Name()
+}
+
+// A pool recording the database selected for it.
+type selectingPool struct {
+	ConnGetter
+	db int
+}
+
+func (p *selectingPool) SelectDB(db int) error {
+	p.db = db
+	return nil
+}
+
+func TestNewProxyConnSelectsDBAndOverridesAuth(t *testing.T) {
+	conf, err := ParsePoolConfig([]byte("alpha:\n  redis_auth: secret\n  redis_db: 3\n"+
+		"  server_auth:\n    10.0.0.2:6379: other\n  servers:\n   - 10.0.0.1:6379:1\n   - 10.0.0.2:6379:1 b\n"), "alpha")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	auths := make(map[string]string)
+	var pools []*selectingPool
+	create := func(desc, auth string) ConnGetter {
+		auths[ServerAddr(desc)] = auth
+		p := &selectingPool{ConnGetter: connPool{&nilStyleConn{reply: "PONG"}}}
+		pools = append(pools, p)
+		return p
+	}
+
+	if _, err := NewProxyConnFromConfig(conf, 0, create); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if auths["10.0.0.1:6379"] != "secret" || auths["10.0.0.2:6379"] != "other" {
+		t.Fatalf("Unexpected auths: %v", auths)
+	}
+	if len(pools) != 2 || pools[0].db != 3 || pools[1].db != 3 {
+		t.Fatal("Expected every pool to select the configured database.")
+	}
+}
+
+func TestNewProxyConnFailsForPoolsThatCannotSelectDB(t *testing.T) {
+	conf := PoolConfig{Servers: []string{"10.0.0.1:6379:1"}, DB: 1}
+	create := func(desc, auth string) ConnGetter {
+		return connPool{&nilStyleConn{reply: "PONG"}}
+	}
+
+	if _, err := NewProxyConnFromConfig(conf, 0, create); err == nil {
+		t.Fatal("Expected error for pool that cannot select a database.")
+	}
+}
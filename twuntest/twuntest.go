@@ -0,0 +1,104 @@
+// Package twuntest runs in-memory Redis backends for testing code that uses twunproxy, without gomock or real
+// Redis servers. A Cluster is a set of miniredis servers described by a synthetic Twemproxy pool configuration,
+// from which proxies are created as they would be in production.
+package twuntest
+
+import (
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/txodds/twunproxy"
+	"github.com/txodds/twunproxy/redigo"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// PoolName is the name of the pool in the configuration of a Cluster.
+const PoolName = "twuntest"
+
+// Cluster is a set of miniredis servers standing in for the backends of a Twemproxy pool.
+// Servers are in the order of the configuration, and are stopped when the test completes.
+// Seed keys on particular backends through Servers, for example with Servers[1].Lpush, to test discovery.
+type Cluster struct {
+	Servers []*miniredis.Miniredis
+}
+
+// NewCluster starts n miniredis servers for the duration of the test.
+func NewCluster(tb testing.TB, n int) *Cluster {
+	c := &Cluster{Servers: make([]*miniredis.Miniredis, n)}
+	for i := range c.Servers {
+		c.Servers[i] = miniredis.RunT(tb)
+	}
+	return c
+}
+
+// Config returns a pool configuration for the servers of the cluster, named PoolName,
+// with Twemproxy's default hashing and distribution and a hash tag of "{}".
+func (c *Cluster) Config() twunproxy.PoolConfig {
+	conf := twunproxy.PoolConfig{Name: PoolName, Hash: "fnv1a_64", Distribution: "ketama", HashTag: "{}"}
+	for i, s := range c.Servers {
+		conf.Servers = append(conf.Servers, fmt.Sprintf("%s:1 server%d", s.Addr(), i))
+	}
+	return conf
+}
+
+// YAML returns the configuration of the cluster as a Twemproxy configuration file.
+func (c *Cluster) YAML() []byte {
+	data, _ := yaml.Marshal(map[string]twunproxy.PoolConfig{PoolName: c.Config()})
+	return data
+}
+
+// WriteConfig writes the configuration of the cluster to a file in a temporary directory of the test,
+// and returns its path, as for NewProxyConn.
+func (c *Cluster) WriteConfig(tb testing.TB) string {
+	path := filepath.Join(tb.TempDir(), "nutcracker.yml")
+	if err := ioutil.WriteFile(path, c.YAML(), 0644); err != nil {
+		tb.Fatalf("Writing Twemproxy configuration: %v", err)
+	}
+	return path
+}
+
+// CreatePool creates a pool connected to the miniredis server of the input server line, as for redigo.CreatePool.
+func (c *Cluster) CreatePool(desc, auth string) twunproxy.ConnGetter {
+	return redigo.CreatePool(desc, auth)
+}
+
+// Proxy creates a proxy for the cluster with the input options, closed when the test completes.
+func (c *Cluster) Proxy(tb testing.TB, opts ...twunproxy.Option) *twunproxy.ProxyConn {
+	proxy, err := twunproxy.NewProxyConnFromConfig(c.Config(), 0, c.CreatePool, opts...)
+	if err != nil {
+		tb.Fatalf("Creating proxy: %v", err)
+	}
+	tb.Cleanup(func() { proxy.Close() })
+	return proxy
+}
+
+// Server returns the server with the input address, "host:port", or nil if it is not in the cluster.
+func (c *Cluster) Server(addr string) *miniredis.Miniredis {
+	for _, s := range c.Servers {
+		if s.Addr() == addr {
+			return s
+		}
+	}
+	return nil
+}
+
+// Holders returns the addresses of the servers holding the input key in their selected database, in order.
+func (c *Cluster) Holders(key string) []string {
+	var addrs []string
+	for _, s := range c.Servers {
+		if s.Exists(key) {
+			addrs = append(addrs, s.Addr())
+		}
+	}
+	return addrs
+}
+
+// Pool returns a pool connected to the input miniredis server, for testing code that takes a ConnGetter.
+// It is closed when the test completes.
+func Pool(tb testing.TB, s *miniredis.Miniredis) twunproxy.ConnGetter {
+	p := redigo.CreatePool(s.Addr()+":1", "").(*redigo.Pool)
+	tb.Cleanup(func() { p.Close() })
+	return p
+}
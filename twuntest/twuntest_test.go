@@ -0,0 +1,48 @@
+package twuntest
+
+import (
+	"github.com/txodds/twunproxy"
+	"reflect"
+	"testing"
+)
+
+func TestProxyDiscoversKeysSeededOnServers(t *testing.T) {
+	c := NewCluster(t, 3)
+	c.Servers[2].Set("key", "value")
+
+	proxy := c.Proxy(t)
+	v, err := proxy.Do(twunproxy.NewRedisCmd("GET", "key"), twunproxy.KeyFound)
+	if err != nil || string(v.([]byte)) != "value" {
+		t.Fatalf("Expected the seeded value, got %v, %v", v, err)
+	}
+	if server, ok := proxy.Lookup("key"); !ok || server != c.Servers[2].Addr() {
+		t.Fatalf("Expected key to be mapped to the seeded server, got %q", server)
+	}
+	if !reflect.DeepEqual(c.Holders("key"), []string{c.Servers[2].Addr()}) {
+		t.Fatalf("Unexpected holders: %v", c.Holders("key"))
+	}
+}
+
+func TestWriteConfigIsReadByNewProxyConn(t *testing.T) {
+	c := NewCluster(t, 2)
+
+	proxy, err := twunproxy.NewProxyConn(c.WriteConfig(t), PoolName, 0, c.CreatePool)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer proxy.Close()
+
+	if len(proxy.Pools) != 2 || c.Server(twunproxy.ServerAddr(proxy.Servers[1])) != c.Servers[1] {
+		t.Fatalf("Unexpected servers: %v", proxy.Servers)
+	}
+}
+
+func TestPoolConnectsToServer(t *testing.T) {
+	c := NewCluster(t, 1)
+	conn := Pool(t, c.Servers[0]).Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", "key", "value"); err != nil || !c.Servers[0].Exists("key") {
+		t.Fatalf("Expected key to be set on the server, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package twunproxy
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// RedisVersion is a Redis server version as major, minor and patch numbers.
+type redisVersion [3]int
+
+// Returns whether the version is at least the input major and minor version.
+func (v redisVersion) atLeast(major, minor int) bool {
+	return v[0] > major || (v[0] == major && v[1] >= minor)
+}
+
+// Parses a version string such as "7.0.11". Missing components are 0.
+func parseVersion(s string) (redisVersion, error) {
+	var v redisVersion
+	for i, part := range strings.SplitN(s, ".", 3) {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, errors.New("Unexpected version " + s + ".")
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// Returns the version of the instance on the input connection, from INFO server.
+func serverVersion(c Conn) (redisVersion, error) {
+	v, err := c.Do("INFO", "server")
+	if err != nil {
+		return redisVersion{}, err
+	}
+
+	info, err := parseInfo(v)
+	if err != nil {
+		return redisVersion{}, err
+	}
+	return parseVersion(info["redis_version"])
+}
+
+// Checks that every instance runs at least the input major and minor version.
+// The feature name is used in the error for instances that do not.
+func (t *topology) requireVersion(major, minor int, feature string) error {
+	errs := t.forEach(func(i int, c Conn) error {
+		v, err := serverVersion(c)
+		if err != nil {
+			return err
+		}
+		if !v.atLeast(major, minor) {
+			return errors.New(feature + " requires Redis " + strconv.Itoa(major) + "." + strconv.Itoa(minor) +
+				" or later, but " + t.server(i) + " runs " + strconv.Itoa(v[0]) + "." + strconv.Itoa(v[1]) + ".")
+		}
+		return nil
+	})
+	return firstError(errs)
+}
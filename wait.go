@@ -0,0 +1,108 @@
+package twunproxy
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Wait issues WAIT on the instance holding the input key, returning the number of its replicas that acknowledged
+// writes within the timeout, which is rounded to whole milliseconds. If the key cannot be placed, WAIT is issued
+// on every instance and the counts are summed.
+// WAIT only covers writes made on the connection it runs on, and pooled connections are shared, so Wait confirms
+// that replication has caught up rather than that a particular write is durable; use WriteAndWait for that.
+func (r *ProxyConn) Wait(key string, numReplicas int, timeout time.Duration) (int64, error) {
+	var n int64
+	err := r.retrying(context.Background(), "WAIT", key, func() (err error) {
+		n, err = r.wait(key, numReplicas, timeout)
+		return err
+	})
+	return n, err
+}
+
+// Issues WAIT once, as for Wait.
+func (r *ProxyConn) wait(key string, numReplicas int, timeout time.Duration) (int64, error) {
+	args := []interface{}{numReplicas, timeout.Nanoseconds() / int64(time.Millisecond)}
+
+	pool, ok, err := r.place(key)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		c := pool.Get()
+		defer c.Close()
+		return waitReply(c.Do("WAIT", args...))
+	}
+
+	t := r.topology()
+	if len(t.pools) == 0 {
+		return 0, errNoPools
+	}
+
+	counts := make([]int64, len(t.pools))
+	errs := t.forEach(func(i int, c Conn) error {
+		var err error
+		counts[i], err = waitReply(c.Do("WAIT", args...))
+		return err
+	})
+
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total, firstError(errs)
+}
+
+// WriteAndWait runs the input write on the instance holding its key, or its owner in the hash ring, and then issues
+// WAIT on the same connection, so that the count returned is of replicas that acknowledged that write.
+// The write's reply is returned with the count. The key is mapped to the instance once the write succeeds.
+// If fewer replicas than requested acknowledge it, the write has still been made on the master.
+func (r *ProxyConn) WriteAndWait(cmd *RedisCmd, numReplicas int, timeout time.Duration) (interface{}, int64, error) {
+	var v interface{}
+	var n int64
+	err := r.retrying(context.Background(), cmd.name, cmd.key, func() (err error) {
+		v, n, err = r.writeAndWait(cmd, numReplicas, timeout)
+		return err
+	})
+	return v, n, err
+}
+
+// Runs the write and WAIT once, as for WriteAndWait.
+func (r *ProxyConn) writeAndWait(cmd *RedisCmd, numReplicas int, timeout time.Duration) (interface{}, int64, error) {
+	pool, ok, err := r.place(cmd.key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		t := r.topology()
+		if len(t.pools) != 1 {
+			return nil, 0, errNoPlacement
+		}
+		pool = t.pools[0]
+	}
+
+	c := pool.Get()
+	defer c.Close()
+
+	v, err := r.run(c, cmd)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.mapKey(cmd.key, pool)
+
+	n, err := waitReply(c.Do("WAIT", numReplicas, timeout.Nanoseconds()/int64(time.Millisecond)))
+	return v, n, err
+}
+
+// Decodes the reply to WAIT.
+func waitReply(v interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := replyInt(v)
+	if !ok {
+		return 0, errors.New("Unexpected reply to WAIT.")
+	}
+	return n, nil
+}
@@ -0,0 +1,65 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+// Answers EXISTS with 0, so that no key is located, and WAIT with its own value.
+type waitConn int64
+
+func (c waitConn) Close() error { return nil }
+
+func (c waitConn) Do(name string, args ...interface{}) (interface{}, error) {
+	if name == "WAIT" {
+		return int64(c), nil
+	}
+	return int64(0), nil
+}
+
+func TestWaitRoutesToMappedInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	_, otherPool := setupMockPool(ctrl)
+	proxy := getMockProxy(otherPool, mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	mockConn.EXPECT().Do("WAIT", 1, int64(250)).Return(int64(1), nil)
+	mockConn.EXPECT().Close()
+
+	if n, err := proxy.Wait("KEY", 1, 250*time.Millisecond); err != nil || n != 1 {
+		t.Fatalf("Unexpected result: %d, %v", n, err)
+	}
+}
+
+func TestWaitBroadcastsForUnplacedKey(t *testing.T) {
+	proxy := getMockProxy(connPool{waitConn(1)}, connPool{waitConn(2)})
+
+	n, err := proxy.Wait("KEY", 1, time.Second)
+	if err != nil || n != 3 {
+		t.Fatalf("Expected summed replicas, got %d, %v", n, err)
+	}
+}
+
+func TestWriteAndWaitUsesOneConnection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["KEY"] = mockPool
+
+	gomock.InOrder(
+		mockConn.EXPECT().Do("SET", "KEY", "v").Return("OK", nil),
+		mockConn.EXPECT().Do("WAIT", 2, int64(1000)).Return(int64(2), nil),
+	)
+	mockConn.EXPECT().Close()
+
+	v, n, err := proxy.WriteAndWait(NewRedisCmd("SET", "KEY", "v"), 2, time.Second)
+	if err != nil || v != "OK" || n != 2 {
+		t.Fatalf("Unexpected result: %v, %d, %v", v, n, err)
+	}
+}
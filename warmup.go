@@ -0,0 +1,35 @@
+package twunproxy
+
+// WarmUp scans every instance concurrently for keys matching the input pattern and maps each key to the instance
+// holding it, so that the first command on a key after startup, blocking commands in particular, need not discover
+// it across every instance. The number of keys mapped is returned by server, including servers with none.
+// A key held by more than one instance is mapped to its ring owner if the owner holds it, and is otherwise left
+// unmapped, to be resolved by discovery. Existing mappings for the keys found are replaced.
+func (r *ProxyConn) WarmUp(pattern string) (map[string]int, error) {
+	t := r.topology()
+	found, err := scanHolders(t, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(t.pools))
+	for i := range t.pools {
+		counts[t.server(i)] = 0
+	}
+
+	for k, idxs := range found {
+		i := idxs[0]
+		if len(idxs) > 1 {
+			owner, ok := t.ring.owner(k)
+			if !ok || !containsIndex(idxs, owner) {
+				r.counter("warm_up_duplicates", "", 1)
+				continue
+			}
+			i = owner
+		}
+
+		r.mapKey(k, t.pools[i])
+		counts[t.server(i)]++
+	}
+	return counts, nil
+}
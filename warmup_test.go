@@ -0,0 +1,85 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestWarmUpMapsKeysAndCountsByServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+	mockConn3, mockPool3 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2, mockPool3)
+	proxy.Servers = []string{"a:6379:1", "b:6379:1", "c:6379:1"}
+	proxy.ring, _ = newHashRing(proxy.Servers, "fnv1a_32", "modula", "")
+
+	// A duplicated key is mapped to its owner.
+	owner, _ := proxy.ring.owner("dup")
+	pools := []ConnGetter{mockPool1, mockPool2, mockPool3}
+	conns := []*MockConn{mockConn1, mockConn2, mockConn3}
+
+	scan := func(keys ...string) interface{} {
+		items := make([]interface{}, len(keys))
+		for i, k := range keys {
+			items[i] = []byte(k)
+		}
+		return []interface{}{[]byte("0"), items}
+	}
+
+	other := (owner + 1) % 3
+	for i, c := range conns {
+		var keys []string
+		switch i {
+		case owner:
+			keys = []string{"dup", "q:own"}
+		case other:
+			keys = []string{"dup", "q:other"}
+		}
+		c.EXPECT().Do("SCAN", "0", "MATCH", "q:*", "COUNT", scanCount).Return(scan(keys...), nil)
+		c.EXPECT().Close()
+	}
+
+	counts, err := proxy.WarmUp("q:*")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	servers := []string{"a:6379", "b:6379", "c:6379"}
+	if len(counts) != 3 || counts[servers[owner]] != 2 || counts[servers[other]] != 1 {
+		t.Fatalf("Unexpected counts: %v", counts)
+	}
+	if proxy.KeyInstance["dup"] != pools[owner] || proxy.KeyInstance["q:other"] != pools[other] {
+		t.Fatal("Expected keys to be mapped to the instances holding them.")
+	}
+}
+
+func TestWarmUpLeavesUnplacedDuplicatesUnmapped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn1, mockPool1 := setupMockPool(ctrl)
+	mockConn2, mockPool2 := setupMockPool(ctrl)
+
+	proxy := getMockProxy(mockPool1, mockPool2)
+
+	scan := []interface{}{[]byte("0"), []interface{}{[]byte("dup")}}
+	mockConn1.EXPECT().Do("SCAN", "0", "MATCH", "*", "COUNT", scanCount).Return(scan, nil)
+	mockConn1.EXPECT().Close()
+	mockConn2.EXPECT().Do("SCAN", "0", "MATCH", "*", "COUNT", scanCount).Return(scan, nil)
+	mockConn2.EXPECT().Close()
+
+	counts, err := proxy.WarmUp("*")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if counts["0"] != 0 || counts["1"] != 0 {
+		t.Fatalf("Unexpected counts: %v", counts)
+	}
+	if _, ok := proxy.KeyInstance["dup"]; ok {
+		t.Fatal("Expected duplicated key to be left unmapped.")
+	}
+}
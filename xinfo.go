@@ -0,0 +1,166 @@
+package twunproxy
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// StreamInfo is the decoded reply of XINFO STREAM.
+// EntriesAdded is only reported by Redis 7.0 and later, and is otherwise 0.
+type StreamInfo struct {
+	Length          int64  `json:"length"`
+	Groups          int64  `json:"groups"`
+	LastGeneratedID string `json:"last_generated_id"`
+	EntriesAdded    int64  `json:"entries_added"`
+	FirstEntryID    string `json:"first_entry_id"`
+	LastEntryID     string `json:"last_entry_id"`
+}
+
+// StreamGroup is one consumer group from the reply of XINFO GROUPS.
+// Lag is the number of entries not yet delivered to the group. It is only reported by Redis 7.0 and later,
+// and even then not in every case, so LagKnown indicates whether it is valid.
+type StreamGroup struct {
+	Name            string `json:"name"`
+	Consumers       int64  `json:"consumers"`
+	Pending         int64  `json:"pending"`
+	LastDeliveredID string `json:"last_delivered_id"`
+	Lag             int64  `json:"lag"`
+	LagKnown        bool   `json:"lag_known"`
+}
+
+// StreamLag is the state of one consumer group on one stream, as reported by StreamLagReport.
+type StreamLag struct {
+	Key    string `json:"key"`
+	Server string `json:"server"`
+	StreamGroup
+}
+
+// XInfoStream returns information about the stream at key from the instance holding it.
+func (r *ProxyConn) XInfoStream(key string) (*StreamInfo, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "XINFO", key: key, args: []interface{}{"STREAM"}, keyPos: 1}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := replyMap(v)
+	if !ok {
+		return nil, errors.New("Unexpected reply to XINFO STREAM.")
+	}
+
+	info := &StreamInfo{}
+	info.Length, _ = replyInt(m["length"])
+	info.Groups, _ = replyInt(m["groups"])
+	info.LastGeneratedID, _ = replyString(m["last-generated-id"])
+	info.EntriesAdded, _ = replyInt(m["entries-added"])
+	info.FirstEntryID = entryID(m["first-entry"])
+	info.LastEntryID = entryID(m["last-entry"])
+	return info, nil
+}
+
+// XInfoGroups returns the consumer groups of the stream at key from the instance holding it.
+func (r *ProxyConn) XInfoGroups(key string) ([]StreamGroup, error) {
+	v, err := r.doKeyed(&RedisCmd{name: "XINFO", key: key, args: []interface{}{"GROUPS"}, keyPos: 1}, false)
+	if err != nil {
+		return nil, err
+	}
+	return parseGroups(v)
+}
+
+// StreamLagReport scans every instance concurrently for streams matching the input pattern and reports the state of
+// each of their consumer groups, ordered by key and group. This allows stream pipelines to be monitored
+// across the pool without knowing which instance holds each stream.
+func (r *ProxyConn) StreamLagReport(pattern string) ([]StreamLag, error) {
+	t := r.topology()
+
+	var mu sync.Mutex
+	var lags []StreamLag
+	errs := t.forEach(func(i int, c Conn) error {
+		return scanKeys(c, pattern, scanCount, func(keys []string) error {
+			for _, k := range keys {
+				v, err := c.Do("TYPE", k)
+				if err != nil {
+					return err
+				}
+				if s, _ := replyString(v); s != "stream" {
+					continue
+				}
+
+				if v, err = c.Do("XINFO", "GROUPS", k); err != nil {
+					return err
+				}
+
+				groups, err := parseGroups(v)
+				if err != nil {
+					return err
+				}
+
+				mu.Lock()
+				for _, g := range groups {
+					lags = append(lags, StreamLag{Key: k, Server: t.server(i), StreamGroup: g})
+				}
+				mu.Unlock()
+			}
+			return nil
+		})
+	})
+
+	sort.Slice(lags, func(a, b int) bool {
+		if lags[a].Key != lags[b].Key {
+			return lags[a].Key < lags[b].Key
+		}
+		return lags[a].Name < lags[b].Name
+	})
+	return lags, firstError(errs)
+}
+
+// Decodes the reply of XINFO GROUPS.
+func parseGroups(v interface{}) ([]StreamGroup, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("Unexpected reply to XINFO GROUPS.")
+	}
+
+	groups := make([]StreamGroup, len(items))
+	for i, item := range items {
+		m, ok := replyMap(item)
+		if !ok {
+			return nil, errors.New("Unexpected reply to XINFO GROUPS.")
+		}
+
+		g := &groups[i]
+		g.Name, _ = replyString(m["name"])
+		g.Consumers, _ = replyInt(m["consumers"])
+		g.Pending, _ = replyInt(m["pending"])
+		g.LastDeliveredID, _ = replyString(m["last-delivered-id"])
+		g.Lag, g.LagKnown = replyInt(m["lag"])
+	}
+	return groups, nil
+}
+
+// ReplyMap converts a reply of alternating field names and values to a map.
+func replyMap(v interface{}) (map[string]interface{}, bool) {
+	items, ok := v.([]interface{})
+	if !ok || len(items)%2 != 0 {
+		return nil, false
+	}
+
+	m := make(map[string]interface{}, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		k, ok := replyString(items[i])
+		if !ok {
+			return nil, false
+		}
+		m[k] = items[i+1]
+	}
+	return m, true
+}
+
+// Returns the ID of a stream entry reply, or an empty string for an empty stream.
+func entryID(v interface{}) string {
+	if e, ok := v.([]interface{}); ok && len(e) > 0 {
+		id, _ := replyString(e[0])
+		return id
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package twunproxy
+
+import (
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func TestXInfoStreamDecodesReply(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	mockConn.EXPECT().Do("XINFO", "STREAM", "events").Return([]interface{}{
+		[]byte("length"), int64(2),
+		[]byte("groups"), int64(1),
+		[]byte("last-generated-id"), []byte("2-0"),
+		[]byte("first-entry"), []interface{}{[]byte("1-0"), []interface{}{[]byte("f"), []byte("v")}},
+		[]byte("last-entry"), []interface{}{[]byte("2-0"), []interface{}{[]byte("f"), []byte("v")}},
+	}, nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+	proxy.KeyInstance["events"] = mockPool
+
+	info, err := proxy.XInfoStream("events")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	exp := StreamInfo{Length: 2, Groups: 1, LastGeneratedID: "2-0", FirstEntryID: "1-0", LastEntryID: "2-0"}
+	if *info != exp {
+		t.Fatalf("Unexpected info: %+v", info)
+	}
+}
+
+func TestStreamLagReportAggregatesGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn, mockPool := setupMockPool(ctrl)
+	keys := []interface{}{[]byte("events"), []byte("list")}
+	mockConn.EXPECT().Do("SCAN", "0", "MATCH", "*", "COUNT", scanCount).Return([]interface{}{[]byte("0"), keys}, nil)
+	mockConn.EXPECT().Do("TYPE", "events").Return("stream", nil)
+	mockConn.EXPECT().Do("TYPE", "list").Return("list", nil)
+	mockConn.EXPECT().Do("XINFO", "GROUPS", "events").Return([]interface{}{
+		[]interface{}{
+			[]byte("name"), []byte("workers"),
+			[]byte("consumers"), int64(2),
+			[]byte("pending"), int64(3),
+			[]byte("last-delivered-id"), []byte("1-0"),
+			[]byte("lag"), int64(5),
+		},
+		[]interface{}{
+			[]byte("name"), []byte("audit"),
+			[]byte("consumers"), int64(1),
+			[]byte("pending"), int64(0),
+			[]byte("last-delivered-id"), []byte("2-0"),
+		},
+	}, nil)
+	mockConn.EXPECT().Close()
+
+	proxy := getMockProxy(mockPool)
+
+	lags, err := proxy.StreamLagReport("*")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(lags) != 2 || lags[0].Name != "audit" || lags[0].LagKnown ||
+		lags[1].Name != "workers" || lags[1].Lag != 5 || !lags[1].LagKnown || lags[1].Server != "0" {
+		t.Fatalf("Unexpected report: %+v", lags)
+	}
+}